@@ -0,0 +1,167 @@
+// Package app wires the components of go-base for an application
+package app
+
+import (
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/cache"
+	cache_inmem "github.com/unbxd/go-base/v2/data/cache/inmem"
+	"github.com/unbxd/go-base/v2/data/driver"
+	driver_inmem "github.com/unbxd/go-base/v2/data/driver/inmem"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
+	"github.com/unbxd/go-base/v2/notifier"
+	"github.com/unbxd/go-base/v2/rate"
+)
+
+type (
+	// Services are the components of an application, behind the
+	// interfaces of go-base. Moving a component to its distributed
+	// implementation, e.g. the cache to redis, is a change of constructor
+	Services struct {
+		Logger   log.Logger
+		Cache    cache.Cache
+		Notifier notifier.Notifier
+		Limiter  rate.Limiter
+		Driver   driver.Driver
+		Metrics  metrics.Provider
+	}
+
+	standalone struct {
+		logLevel string
+		logger   log.Logger
+
+		cacheExpiry   time.Duration
+		cacheEviction time.Duration
+
+		limit          float64
+		burst          int
+		limiterOptions []rate.ShardedLimiterOption
+
+		driverOptions []driver_inmem.DriverOption
+		handlers      []notifier.Handler
+	}
+
+	// StandaloneOption customises the services of Standalone
+	StandaloneOption func(*standalone) error
+)
+
+// WithLogLevel sets the level of the logger writing to stdout, defaults
+// to info
+func WithLogLevel(level string) StandaloneOption {
+	return func(s *standalone) error {
+		s.logLevel = level
+		return nil
+	}
+}
+
+// WithLogger replaces the logger writing to stdout
+func WithLogger(logger log.Logger) StandaloneOption {
+	return func(s *standalone) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// WithCacheExpiry sets the default expiry of the cached items & how often
+// the expired ones are evicted, defaults to 5 & 10 minutes
+func WithCacheExpiry(expiry, eviction time.Duration) StandaloneOption {
+	return func(s *standalone) error {
+		s.cacheExpiry, s.cacheEviction = expiry, eviction
+		return nil
+	}
+}
+
+// WithRateLimit sets the limit per second & the burst of every key of the
+// limiter, defaults to 100 & 100
+func WithRateLimit(limit float64, burst int, options ...rate.ShardedLimiterOption) StandaloneOption {
+	return func(s *standalone) error {
+		s.limit, s.burst, s.limiterOptions = limit, burst, options
+		return nil
+	}
+}
+
+// WithDriverOptions sets the options of the in-memory driver, e.g. to seed
+// it with a config embedded in the binary
+//
+//	//go:embed config.json
+//	var config []byte
+//
+//	app.Standalone(app.WithDriverOptions(inmem.WithJSON(config)))
+func WithDriverOptions(options ...driver_inmem.DriverOption) StandaloneOption {
+	return func(s *standalone) error {
+		s.driverOptions = append(s.driverOptions, options...)
+		return nil
+	}
+}
+
+// WithNotifyHandlers subscribes the handlers to the in-memory notifier
+func WithNotifyHandlers(handlers ...notifier.Handler) StandaloneOption {
+	return func(s *standalone) error {
+		s.handlers = append(s.handlers, handlers...)
+		return nil
+	}
+}
+
+// Standalone returns the in-process implementations of the services, for
+// the tools which don't need redis, nats or zookeeper:
+//
+//   - the logger writes to stdout
+//   - the cache is in memory
+//   - the notifier delivers to the handlers in the process
+//   - the limiter is the sharded in-memory one
+//   - the driver is in memory, seeded from memory or a file
+//   - the metrics are published with expvar
+//
+// None of the constructors of the networked implementations is linked in
+// a binary using only Standalone, which the tests of the package check.
+// The driver is open, Close releases the services
+func Standalone(options ...StandaloneOption) (*Services, error) {
+	s := &standalone{
+		logLevel:      "info",
+		cacheExpiry:   5 * time.Minute,
+		cacheEviction: 10 * time.Minute,
+		limit:         100,
+		burst:         100,
+	}
+
+	for _, fn := range options {
+		if err := fn(s); err != nil {
+			return nil, err
+		}
+	}
+
+	logger := s.logger
+	if logger == nil {
+		var err error
+		logger, err = log.NewZeroLogger(log.ZeroLoggerWithLevel(s.logLevel))
+		if err != nil {
+			return nil, errors.Wrap(err, "create logger failed")
+		}
+	}
+
+	limiter, err := rate.NewShardedLimiter(s.limit, s.burst, s.limiterOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "create limiter failed")
+	}
+
+	dr := driver_inmem.NewInMemoryDriver(s.driverOptions...)
+	if err := dr.Open(); err != nil {
+		return nil, errors.Wrap(err, "open driver failed")
+	}
+
+	return &Services{
+		Logger:   logger,
+		Cache:    cache_inmem.New(s.cacheExpiry, s.cacheEviction),
+		Notifier: notifier.NewInMemoryNotifier(s.handlers...),
+		Limiter:  limiter,
+		Driver:   dr,
+		Metrics:  metrics.NewExpvarMetrics(),
+	}, nil
+}
+
+// Close closes the driver & flushes the logger
+func (s *Services) Close() error {
+	return errors.Join(s.Driver.Close(), s.Logger.Flush())
+}
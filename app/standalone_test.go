@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	driver_inmem "github.com/unbxd/go-base/v2/data/driver/inmem"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/rate"
+)
+
+func TestStandalone(t *testing.T) {
+	var notified []interface{}
+
+	s, err := Standalone(
+		WithLogger(log.NewNoopLogger()),
+		WithRateLimit(1, 1),
+		WithDriverOptions(driver_inmem.WithJSON([]byte(`{"/config/name": "tool"}`))),
+		WithNotifyHandlers(func(_ context.Context, data interface{}) error {
+			notified = append(notified, data)
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Standalone() error = %v", err)
+	}
+	defer s.Close()
+
+	cx := context.Background()
+
+	if got, _ := s.Driver.ReadContext(cx, "/config/name"); string(got) != "tool" {
+		t.Errorf("Driver.ReadContext() = %s, want tool", got)
+	}
+
+	s.Cache.Set(cx, "k", []byte("v"))
+	if got, ok := s.Cache.Get(cx, "k"); !ok || string(got) != "v" {
+		t.Errorf("Cache.Get() = %s, %v, want v", got, ok)
+	}
+
+	if err := s.Notifier.Notify(cx, "event"); err != nil || len(notified) != 1 {
+		t.Errorf("Notify() error = %v, notified %v", err, notified)
+	}
+
+	first, _ := s.Limiter.Allow(cx, rate.Key("user"))
+	second, _ := s.Limiter.Allow(cx, rate.Key("user"))
+	if !first || second {
+		t.Errorf("Allow() = %v, %v, want true, false", first, second)
+	}
+
+	s.Metrics.NewCounter("standalone_test", 1).Add(1)
+}
+
+// TestStandalone_linked checks the networked constructors aren't in a
+// binary using only Standalone. go test strips its binaries, the one of
+// testdata/standalone is built with the symbols
+func TestStandalone_linked(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "standalone")
+	if out, err := exec.Command("go", "build", "-o", bin, "./testdata/standalone").CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v, %s", err, out)
+	}
+
+	out, err := exec.Command("go", "tool", "nm", bin).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool nm failed: %v, %s", err, out)
+	}
+
+	if !strings.Contains(string(out), " github.com/unbxd/go-base/v2/rate.NewShardedLimiter") {
+		t.Fatalf("NewShardedLimiter isn't linked, the symbols aren't usable")
+	}
+
+	for _, sym := range []string{
+		"github.com/redis/go-redis/v9.NewClient",
+		"github.com/redis/go-redis/v9.NewClusterClient",
+		"github.com/nats-io/nats%2ego.Connect",
+		"github.com/samuel/go-zookeeper/zk.Connect",
+		"github.com/segmentio/kafka-go.",
+		"github.com/DataDog/datadog-go/statsd.New",
+		"github.com/unbxd/go-base/v2/data/cache.NewRedisCache",
+		"github.com/unbxd/go-base/v2/data/cache/redis.NewRedisCache",
+		"github.com/unbxd/go-base/v2/data/driver/zook.NewZKDriver",
+		"github.com/unbxd/go-base/v2/notifier.NewNotifier",
+		"github.com/unbxd/go-base/v2/metrics.NewDatadogMetrics",
+		"github.com/unbxd/go-base/v2/rate.NewRedisLimiter",
+		"github.com/unbxd/go-base/v2/rate.NewRedisLeakyBucketLimiter",
+	} {
+		if strings.Contains(string(out), " "+sym) {
+			t.Errorf("%s is linked in standalone mode", sym)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// Command standalone links only app.Standalone, TestStandalone_linked
+// checks the symbols of its binary
+package main
+
+import "github.com/unbxd/go-base/v2/app"
+
+func main() {
+	s, err := app.Standalone()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+}
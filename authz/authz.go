@@ -0,0 +1,185 @@
+// Package authz provides declarative authorization policies evaluated
+// after authentication. Authentication (a filter or before func) is expected
+// to establish the principal in the context using WithPrincipal, policies
+// then decide if the principal is allowed to perform the request.
+//
+// Policies must be pure and fast, anything which needs IO should be done
+// by the authentication layer and cached on the principal.
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Error Codes, stable across releases
+const (
+	CodeUnauthenticated = "unauthenticated"
+	CodeForbidden       = "forbidden"
+)
+
+// Errors
+var (
+	ErrUnauthenticated = errors.New("authz: no principal in context")
+	ErrForbidden       = errors.New("authz: access denied")
+)
+
+type contextKey int
+
+const (
+	contextKeyPrincipal contextKey = iota
+	contextKeyTenant
+)
+
+type (
+	// Policy decides if principal is allowed to perform req. A nil error
+	// allows the request, any error denies it
+	Policy func(cx context.Context, principal interface{}, req interface{}) error
+
+	// Identifier is implemented by principals which expose an identity,
+	// used for audit
+	Identifier interface{ ID() string }
+
+	// RoleBearer is implemented by principals which carry roles
+	RoleBearer interface{ Roles() []string }
+
+	// ScopeBearer is implemented by principals which carry scopes
+	ScopeBearer interface{ Scopes() []string }
+
+	// Decision captures the outcome of evaluating a policy, meant to be
+	// consumed by audit logs
+	Decision struct {
+		Allowed     bool
+		Policy      string
+		PrincipalID string
+		Reason      string
+	}
+)
+
+// Error is returned when the policy denies the request. It carries the
+// HTTP status and a stable code and is understood by the default
+// error encoder of transport/http
+type Error struct {
+	Code   string
+	Policy string
+	Reason string
+
+	err error
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString("authz: ")
+	sb.WriteString(e.Code)
+
+	if e.Policy != "" {
+		sb.WriteString(" by ")
+		sb.WriteString(e.Policy)
+	}
+
+	if e.Reason != "" {
+		sb.WriteString(": ")
+		sb.WriteString(e.Reason)
+	}
+
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error { return e.err }
+
+// StatusCode is 401 if there is no principal, 403 otherwise
+func (e *Error) StatusCode() int {
+	if e.Code == CodeUnauthenticated {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// MarshalJSON doesn't expose the reason to the client
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"code":   e.Code,
+		"policy": e.Policy,
+	})
+}
+
+func deny(policy, reason string) error {
+	return &Error{
+		Code:   CodeForbidden,
+		Policy: policy,
+		Reason: reason,
+		err:    ErrForbidden,
+	}
+}
+
+// WithPrincipal returns a context carrying the authenticated principal
+func WithPrincipal(cx context.Context, principal interface{}) context.Context {
+	return context.WithValue(cx, contextKeyPrincipal, principal)
+}
+
+// PrincipalFromContext returns the principal set by WithPrincipal
+func PrincipalFromContext(cx context.Context) (interface{}, bool) {
+	p := cx.Value(contextKeyPrincipal)
+	return p, p != nil
+}
+
+// WithTenant returns a context carrying the tenant the request is
+// authenticated for
+func WithTenant(cx context.Context, tenant string) context.Context {
+	return context.WithValue(cx, contextKeyTenant, tenant)
+}
+
+// TenantFromContext returns the tenant set by WithTenant
+func TenantFromContext(cx context.Context) (string, bool) {
+	t, ok := cx.Value(contextKeyTenant).(string)
+	return t, ok && t != ""
+}
+
+// Evaluate runs the policy for the principal in context. If there is no
+// principal, the policy isn't evaluated and an Error with
+// CodeUnauthenticated is returned. name is used in the decision if the
+// policy doesn't report a more specific one.
+func Evaluate(
+	cx context.Context,
+	name string,
+	policy Policy,
+	req interface{},
+) (Decision, error) {
+	principal, ok := PrincipalFromContext(cx)
+	if !ok {
+		return Decision{Policy: name, Reason: "no principal"}, &Error{
+			Code:   CodeUnauthenticated,
+			Policy: name,
+			err:    ErrUnauthenticated,
+		}
+	}
+
+	d := Decision{Policy: name}
+	if id, ok := principal.(Identifier); ok {
+		d.PrincipalID = id.ID()
+	}
+
+	err := policy(cx, principal, req)
+	if err == nil {
+		d.Allowed = true
+		return d, nil
+	}
+
+	var ae *Error
+	if !errors.As(err, &ae) {
+		ae = &Error{Code: CodeForbidden, Policy: name, Reason: err.Error(), err: err}
+	}
+
+	if ae.Policy == "" {
+		ae.Policy = name
+	}
+
+	d.Policy = ae.Policy
+	d.Reason = ae.Reason
+	return d, ae
+}
@@ -0,0 +1,119 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+type principal struct {
+	id     string
+	roles  []string
+	scopes []string
+}
+
+func (p principal) ID() string       { return p.id }
+func (p principal) Roles() []string  { return p.roles }
+func (p principal) Scopes() []string { return p.scopes }
+
+var denyAll Policy = func(context.Context, interface{}, interface{}) error {
+	return errors.New("nope")
+}
+
+func TestCombinators(t *testing.T) {
+	var (
+		cx = context.Background()
+		pr = principal{"u1", []string{"admin"}, []string{"read", "write"}}
+	)
+
+	tests := []struct {
+		name   string
+		policy Policy
+		allow  bool
+	}{
+		{"allow", Allow, true},
+		{"role match", RequireRole("viewer", "admin"), true},
+		{"role mismatch", RequireRole("owner"), false},
+		{"all scopes", RequireScope("read", "write"), true},
+		{"missing scope", RequireScope("read", "delete"), false},
+		{"all of allow", AllOf(Allow, RequireRole("admin")), true},
+		{"all of deny", AllOf(Allow, denyAll), false},
+		{"all of empty", AllOf(), true},
+		{"any of allow", AnyOf(denyAll, RequireRole("admin")), true},
+		{"any of deny", AnyOf(denyAll, RequireRole("owner")), false},
+		{"any of empty", AnyOf(), false},
+		{"not allow", Not(denyAll), true},
+		{"not deny", Not(Allow), false},
+		{"nested", AllOf(AnyOf(RequireRole("owner"), RequireScope("read")), Not(RequireRole("banned"))), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy(cx, pr, nil)
+			if (err == nil) != tt.allow {
+				t.Errorf("policy() error = %v, allow %v", err, tt.allow)
+			}
+		})
+	}
+}
+
+func TestRequireRoleWithoutRoles(t *testing.T) {
+	if err := RequireRole("admin")(context.Background(), struct{}{}, nil); err == nil {
+		t.Errorf("RequireRole() should deny principals without roles")
+	}
+}
+
+func TestRequireTenantMatch(t *testing.T) {
+	var (
+		policy = RequireTenantMatch(func(req interface{}) string { return req.(string) })
+		cx     = WithTenant(context.Background(), "acme")
+	)
+
+	if err := policy(cx, principal{}, "acme"); err != nil {
+		t.Errorf("RequireTenantMatch() same tenant error = %v", err)
+	}
+
+	if err := policy(cx, principal{}, "globex"); err == nil {
+		t.Errorf("RequireTenantMatch() should deny tenant mismatch")
+	}
+
+	if err := policy(context.Background(), principal{}, "acme"); err == nil {
+		t.Errorf("RequireTenantMatch() should deny without tenant in context")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cx := context.Background()
+
+	d, err := Evaluate(cx, "p", Allow, nil)
+	var ae *Error
+	if !errors.As(err, &ae) || ae.StatusCode() != http.StatusUnauthorized || d.Allowed {
+		t.Errorf("Evaluate() without principal = %v, %v, want 401", d, err)
+	}
+
+	cx = WithPrincipal(cx, principal{id: "u1"})
+
+	d, err = Evaluate(cx, "p", RequireRole("admin"), nil)
+	if !errors.As(err, &ae) || ae.StatusCode() != http.StatusForbidden {
+		t.Errorf("Evaluate() denied error = %v, want 403", err)
+	}
+
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("Evaluate() denied error should wrap ErrForbidden")
+	}
+
+	if d.Allowed || d.Policy != "require-role" || d.PrincipalID != "u1" {
+		t.Errorf("Evaluate() decision = %+v", d)
+	}
+
+	d, err = Evaluate(cx, "p", denyAll, nil)
+	if err == nil || d.Policy != "p" || d.Reason != "nope" {
+		t.Errorf("Evaluate() plain error decision = %+v, %v", d, err)
+	}
+
+	d, err = Evaluate(cx, "p", Allow, nil)
+	if err != nil || !d.Allowed || d.Policy != "p" {
+		t.Errorf("Evaluate() allowed decision = %+v, %v", d, err)
+	}
+}
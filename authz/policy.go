@@ -0,0 +1,116 @@
+package authz
+
+import (
+	"context"
+	"strings"
+)
+
+// Allow is a policy which allows every authenticated principal
+func Allow(context.Context, interface{}, interface{}) error { return nil }
+
+// AllOf allows the request only if all the policies allow it, it stops at
+// the first denial
+func AllOf(policies ...Policy) Policy {
+	return func(cx context.Context, principal interface{}, req interface{}) error {
+		for _, p := range policies {
+			if err := p(cx, principal, req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyOf allows the request if any of the policies allow it. An empty
+// AnyOf denies
+func AnyOf(policies ...Policy) Policy {
+	return func(cx context.Context, principal interface{}, req interface{}) error {
+		reasons := make([]string, 0, len(policies))
+
+		for _, p := range policies {
+			err := p(cx, principal, req)
+			if err == nil {
+				return nil
+			}
+			reasons = append(reasons, err.Error())
+		}
+
+		return deny("any-of", strings.Join(reasons, "; "))
+	}
+}
+
+// Not inverts the policy
+func Not(policy Policy) Policy {
+	return func(cx context.Context, principal interface{}, req interface{}) error {
+		if err := policy(cx, principal, req); err != nil {
+			return nil
+		}
+		return deny("not", "negated policy allowed")
+	}
+}
+
+func contains(have []string, want string) bool {
+	for _, h := range have {
+		if h == want {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole allows principals which have at least one of the roles.
+// The principal must implement RoleBearer
+func RequireRole(roles ...string) Policy {
+	return func(_ context.Context, principal interface{}, _ interface{}) error {
+		rb, ok := principal.(RoleBearer)
+		if !ok {
+			return deny("require-role", "principal has no roles")
+		}
+
+		have := rb.Roles()
+		for _, r := range roles {
+			if contains(have, r) {
+				return nil
+			}
+		}
+
+		return deny("require-role", "missing role, want one of: "+strings.Join(roles, ","))
+	}
+}
+
+// RequireScope allows principals which have all of the scopes.
+// The principal must implement ScopeBearer
+func RequireScope(scopes ...string) Policy {
+	return func(_ context.Context, principal interface{}, _ interface{}) error {
+		sb, ok := principal.(ScopeBearer)
+		if !ok {
+			return deny("require-scope", "principal has no scopes")
+		}
+
+		have := sb.Scopes()
+		for _, s := range scopes {
+			if !contains(have, s) {
+				return deny("require-scope", "missing scope: "+s)
+			}
+		}
+
+		return nil
+	}
+}
+
+// RequireTenantMatch allows the request only if the tenant extracted
+// from the decoded request matches the tenant in context (see WithTenant)
+func RequireTenantMatch(extract func(req interface{}) string) Policy {
+	return func(cx context.Context, _ interface{}, req interface{}) error {
+		tenant, ok := TenantFromContext(cx)
+		if !ok {
+			return deny("require-tenant-match", "no tenant in context")
+		}
+
+		if rt := extract(req); rt != tenant {
+			return deny("require-tenant-match", "tenant mismatch")
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,259 @@
+package coordinator
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+const (
+	defaultDrainGatePoll    = 500 * time.Millisecond
+	defaultDrainGateRefresh = 5 * time.Second
+)
+
+type (
+	// DrainGate limits the number of replicas draining at once. A replica
+	// acquires the gate when it receives SIGTERM, before starting its
+	// graceful shutdown, and releases it once drained.
+	//
+	//	release, _ := gate.Acquire(cx)
+	//	defer release()
+	//
+	//	_ = transport.Close()
+	//	_ = consumer.Close()
+	DrainGate struct {
+		sem     DistributedSemaphore
+		limit   int
+		maxWait time.Duration
+
+		holder  string
+		logger  log.Logger
+		poll    time.Duration
+		refresh time.Duration
+	}
+
+	// DrainGateOption customises the DrainGate
+	DrainGateOption func(*DrainGate)
+)
+
+// WithDrainGateHolder sets the identity of the replica, defaults to the
+// hostname, which is the pod name on Kubernetes
+func WithDrainGateHolder(holder string) DrainGateOption {
+	return func(dg *DrainGate) { dg.holder = holder }
+}
+
+// WithDrainGateLogger sets the logger, nothing is logged by default
+func WithDrainGateLogger(logger log.Logger) DrainGateOption {
+	return func(dg *DrainGate) { dg.logger = logger }
+}
+
+// WithDrainGatePollInterval sets how often a waiting replica retries
+// acquiring a slot, defaults to 500ms. Zero or less keeps the default
+func WithDrainGatePollInterval(d time.Duration) DrainGateOption {
+	return func(dg *DrainGate) {
+		if d > 0 {
+			dg.poll = d
+		}
+	}
+}
+
+// WithDrainGateRefreshInterval sets how often the slot is refreshed while
+// draining, it should be well within the TTL of the semaphore. Defaults
+// to 5s, zero or less keeps the default
+func WithDrainGateRefreshInterval(d time.Duration) DrainGateOption {
+	return func(dg *DrainGate) {
+		if d > 0 {
+			dg.refresh = d
+		}
+	}
+}
+
+// Acquire blocks till a drain slot is available, up to maxWait or till cx is
+// done. The replicas waiting are queued, their position is logged while
+// waiting. If the slot can't be acquired in time, the replica drains
+// anyway and acquired is false. release must be called once the drain
+// completes.
+func (dg *DrainGate) Acquire(cx context.Context) (release func(), acquired bool) {
+	var (
+		start  = time.Now()
+		ticker = time.NewTicker(dg.poll)
+		timer  = time.NewTimer(dg.maxWait)
+	)
+
+	defer ticker.Stop()
+	defer timer.Stop()
+
+	for {
+		ok, err := dg.sem.TryAcquire(cx, dg.holder, dg.limit)
+		if err != nil {
+			dg.logger.Warn(
+				"drain gate: failed to acquire slot",
+				log.String("holder", dg.holder),
+				log.Error(err),
+			)
+		}
+
+		if ok {
+			dg.logger.Info(
+				"drain gate: acquired slot, draining",
+				log.String("holder", dg.holder),
+				log.Duration("waited", time.Since(start)),
+			)
+
+			return dg.hold(), true
+		}
+
+		position, err := dg.sem.Position(cx, dg.holder)
+		if err != nil {
+			dg.logger.Warn(
+				"drain gate: failed to queue for slot",
+				log.String("holder", dg.holder),
+				log.Error(err),
+			)
+		}
+
+		draining, _ := dg.sem.Holders(cx)
+
+		dg.logger.Info(
+			"drain gate: waiting for slot",
+			log.String("holder", dg.holder),
+			log.Int("position", position),
+			log.Int("draining", draining),
+			log.Int("max_concurrent", dg.limit),
+			log.Duration("waited", time.Since(start)),
+		)
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			dg.logger.Error(
+				"drain gate: TIMED OUT waiting for slot, DRAINING ANYWAY",
+				log.String("holder", dg.holder),
+				log.Int("draining", draining),
+				log.Int("max_concurrent", dg.limit),
+				log.Duration("waited", time.Since(start)),
+			)
+			dg.leave()
+			return func() {}, false
+		case <-cx.Done():
+			dg.logger.Error(
+				"drain gate: context done waiting for slot, DRAINING ANYWAY",
+				log.String("holder", dg.holder),
+				log.Error(cx.Err()),
+			)
+			dg.leave()
+			return func() {}, false
+		}
+	}
+}
+
+// leave gives up the place of the replica in the queue, it would expire
+// with the TTL otherwise
+func (dg *DrainGate) leave() {
+	if err := dg.sem.Release(context.Background(), dg.holder); err != nil {
+		dg.logger.Warn(
+			"drain gate: failed to leave the queue, it expires with the ttl",
+			log.String("holder", dg.holder),
+			log.Error(err),
+		)
+	}
+}
+
+// hold refreshes the slot till released, so long drains don't lose
+// their slot to the TTL
+func (dg *DrainGate) hold() func() {
+	var (
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(dg.refresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := dg.sem.TryAcquire(context.Background(), dg.holder, dg.limit); err != nil {
+					dg.logger.Warn(
+						"drain gate: failed to refresh slot",
+						log.String("holder", dg.holder),
+						log.Error(err),
+					)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		close(stop)
+		<-done
+
+		if err := dg.sem.Release(context.Background(), dg.holder); err != nil {
+			dg.logger.Warn(
+				"drain gate: failed to release slot, it expires with the ttl",
+				log.String("holder", dg.holder),
+				log.Error(err),
+			)
+			return
+		}
+
+		dg.logger.Info("drain gate: released slot", log.String("holder", dg.holder))
+	}
+}
+
+// Drain runs fn holding a drain slot, see Acquire
+func (dg *DrainGate) Drain(cx context.Context, fn func(context.Context) error) error {
+	release, _ := dg.Acquire(cx)
+	defer release()
+
+	return fn(cx)
+}
+
+// NewDrainGate returns a DrainGate allowing at most maxConcurrentDrains
+// replicas sharing the semaphore to drain at once, waiting up to maxWait
+// for a slot
+func NewDrainGate(
+	locker DistributedSemaphore,
+	maxConcurrentDrains int,
+	maxWait time.Duration,
+	options ...DrainGateOption,
+) (*DrainGate, error) {
+	if maxConcurrentDrains <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	holder, err := os.Hostname()
+	if err != nil {
+		holder = "pid-" + strconv.Itoa(os.Getpid())
+	}
+
+	dg := &DrainGate{
+		sem:     locker,
+		limit:   maxConcurrentDrains,
+		maxWait: maxWait,
+		holder:  holder,
+		logger:  log.NewNoopLogger(),
+		poll:    defaultDrainGatePoll,
+		refresh: defaultDrainGateRefresh,
+	}
+
+	for _, o := range options {
+		o(dg)
+	}
+
+	return dg, nil
+}
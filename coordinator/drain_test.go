@@ -0,0 +1,241 @@
+package coordinator
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func newMiniRedisSemaphore(t *testing.T, ttl time.Duration) (*miniredis.Miniredis, DistributedSemaphore) {
+	mr := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	sem, err := NewRedisSemaphore(client, "drain", ttl)
+	if err != nil {
+		t.Fatalf("NewRedisSemaphore() error = %v", err)
+	}
+
+	return mr, sem
+}
+
+func newTestGate(t *testing.T, sem DistributedSemaphore, limit int, wait time.Duration, holder string) *DrainGate {
+	dg, err := NewDrainGate(
+		sem, limit, wait,
+		WithDrainGateHolder(holder),
+		WithDrainGateLogger(log.FromCtx(context.Background())),
+		WithDrainGatePollInterval(5*time.Millisecond),
+		WithDrainGateRefreshInterval(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewDrainGate() error = %v", err)
+	}
+	return dg
+}
+
+func TestDrainGateConcurrentPods(t *testing.T) {
+	const (
+		pods  = 8
+		limit = 2
+	)
+
+	for name, sem := range map[string]func() DistributedSemaphore{
+		"redis": func() DistributedSemaphore {
+			_, sem := newMiniRedisSemaphore(t, time.Minute)
+			return sem
+		},
+		"in-memory": func() DistributedSemaphore {
+			sem, _ := NewInMemorySemaphore(time.Minute)
+			return sem
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				s        = sem()
+				wg       sync.WaitGroup
+				draining int32
+				peak     int32
+				timeouts int32
+			)
+
+			for i := 0; i < pods; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					dg := newTestGate(t, s, limit, 5*time.Second, "pod-"+strconv.Itoa(i))
+					release, ok := dg.Acquire(context.Background())
+					if !ok {
+						atomic.AddInt32(&timeouts, 1)
+					}
+
+					n := atomic.AddInt32(&draining, 1)
+					for {
+						p := atomic.LoadInt32(&peak)
+						if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+							break
+						}
+					}
+
+					time.Sleep(20 * time.Millisecond)
+					atomic.AddInt32(&draining, -1)
+					release()
+				}(i)
+			}
+
+			wg.Wait()
+
+			if peak > limit || peak == 0 {
+				t.Errorf("peak concurrent drains = %d, want 1..%d", peak, limit)
+			}
+
+			if timeouts != 0 {
+				t.Errorf("timeouts = %d, want 0", timeouts)
+			}
+
+			if n, _ := s.Holders(context.Background()); n != 0 {
+				t.Errorf("Holders() after all drained = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestRedisSemaphoreCrashedHolderExpires(t *testing.T) {
+	var (
+		cx      = context.Background()
+		mr, sem = newMiniRedisSemaphore(t, 10*time.Second)
+		now     = time.Now()
+	)
+
+	mr.SetTime(now)
+
+	if ok, err := sem.TryAcquire(cx, "crashed", 1); !ok || err != nil {
+		t.Fatalf("TryAcquire() = %v, %v", ok, err)
+	}
+
+	if ok, _ := sem.TryAcquire(cx, "pod-2", 1); ok {
+		t.Errorf("TryAcquire() should fail while the slot is held")
+	}
+
+	// the crashed holder never refreshes nor releases
+	mr.SetTime(now.Add(11 * time.Second))
+
+	if ok, err := sem.TryAcquire(cx, "pod-2", 1); !ok || err != nil {
+		t.Errorf("TryAcquire() after ttl = %v, %v, want acquired", ok, err)
+	}
+}
+
+func TestDrainGateMaxWait(t *testing.T) {
+	sem, _ := NewInMemorySemaphore(time.Minute)
+
+	holder := newTestGate(t, sem, 1, time.Second, "holder")
+	release, ok := holder.Acquire(context.Background())
+	if !ok {
+		t.Fatalf("Acquire() should succeed on an empty semaphore")
+	}
+	defer release()
+
+	var (
+		waiter = newTestGate(t, sem, 1, 50*time.Millisecond, "waiter")
+		start  = time.Now()
+	)
+
+	wrelease, ok := waiter.Acquire(context.Background())
+	wrelease()
+
+	if ok {
+		t.Errorf("Acquire() = true, want timed out")
+	}
+
+	if el := time.Since(start); el < 50*time.Millisecond || el > time.Second {
+		t.Errorf("Acquire() waited %v, want ~maxWait", el)
+	}
+
+	// the waiter left the queue on timing out
+	if pos, _ := sem.Position(context.Background(), "next"); pos != 1 {
+		t.Errorf("Position() after the waiter timed out = %d, want 1", pos)
+	}
+}
+
+func TestSemaphorePosition(t *testing.T) {
+	for name, sem := range map[string]func() DistributedSemaphore{
+		"redis": func() DistributedSemaphore {
+			_, sem := newMiniRedisSemaphore(t, time.Minute)
+			return sem
+		},
+		"in-memory": func() DistributedSemaphore {
+			sem, _ := NewInMemorySemaphore(time.Minute)
+			return sem
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				cx = context.Background()
+				s  = sem()
+			)
+
+			if ok, _ := s.TryAcquire(cx, "pod-1", 1); !ok {
+				t.Fatal("TryAcquire() on an empty semaphore = false")
+			}
+
+			for _, tt := range []struct {
+				holder string
+				want   int
+			}{
+				{"pod-2", 1},
+				{"pod-3", 2},
+				{"pod-2", 1}, // asking again keeps the place
+			} {
+				if pos, err := s.Position(cx, tt.holder); pos != tt.want || err != nil {
+					t.Errorf("Position(%s) = %d, %v, want %d", tt.holder, pos, err, tt.want)
+				}
+			}
+
+			// acquiring a slot leaves the queue
+			_ = s.Release(cx, "pod-1")
+			if ok, _ := s.TryAcquire(cx, "pod-2", 1); !ok {
+				t.Fatal("TryAcquire() after the release = false")
+			}
+			if pos, _ := s.Position(cx, "pod-3"); pos != 1 {
+				t.Errorf("Position(pod-3) after pod-2 acquired = %d, want 1", pos)
+			}
+
+			// so does releasing
+			_ = s.Release(cx, "pod-3")
+			if pos, _ := s.Position(cx, "pod-4"); pos != 1 {
+				t.Errorf("Position(pod-4) after pod-3 released = %d, want 1", pos)
+			}
+		})
+	}
+}
+
+func TestDrainGateIntervals(t *testing.T) {
+	sem, _ := NewInMemorySemaphore(time.Minute)
+
+	dg, err := NewDrainGate(
+		sem, 1, time.Second,
+		WithDrainGatePollInterval(0),
+		WithDrainGateRefreshInterval(-time.Second),
+	)
+	if err != nil {
+		t.Fatalf("NewDrainGate() error = %v", err)
+	}
+
+	if dg.poll != defaultDrainGatePoll || dg.refresh != defaultDrainGateRefresh {
+		t.Errorf("intervals = %v, %v, want the defaults", dg.poll, dg.refresh)
+	}
+
+	release, ok := dg.Acquire(context.Background())
+	if !ok {
+		t.Error("Acquire() on an empty semaphore = false")
+	}
+	release()
+}
@@ -0,0 +1,277 @@
+// Package coordinator provides primitives to coordinate work across the
+// replicas of a service, e.g. limiting how many replicas drain at once
+// during a rolling restart.
+package coordinator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Errors
+var (
+	ErrInvalidLimit = errors.New("coordinator: limit should be positive")
+	ErrInvalidTTL   = errors.New("coordinator: ttl should be positive")
+)
+
+// DistributedSemaphore is a counting semaphore shared across replicas.
+// Slots are held with a TTL, so a holder which crashes releases its slot
+// once the TTL expires. Holders refresh their slot by acquiring it again.
+type DistributedSemaphore interface {
+	// TryAcquire takes a slot for holder if less than limit slots are
+	// held, it doesn't block. Acquiring an already held slot refreshes it
+	TryAcquire(cx context.Context, holder string, limit int) (bool, error)
+
+	// Release gives up the slot of holder & its place in the queue
+	Release(cx context.Context, holder string) error
+
+	// Holders returns the number of slots currently held
+	Holders(cx context.Context) (int, error)
+
+	// Position queues holder waiting for a slot & returns its position
+	// in the queue, 1 being the next in line. A holder leaves the queue
+	// once it acquires a slot or releases, or after the TTL without
+	// asking for its position again
+	Position(cx context.Context, holder string) (int, error)
+}
+
+// semaphoreAcquireScript keeps holders in a sorted set scored by the
+// expiry (microseconds, server time). Expired holders are pruned on every
+// call.
+// KEYS[1] set, KEYS[2] queue, KEYS[3] queue expiry, ARGV[1] holder,
+// ARGV[2] limit, ARGV[3] ttl in microseconds
+var semaphoreAcquireScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local ttl = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) == false and
+	redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('ZADD', KEYS[1], now + ttl, ARGV[1])
+redis.call('PEXPIRE', KEYS[1], math.ceil(ttl / 1000))
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+return 1
+`)
+
+// KEYS[1] set
+var semaphoreHoldersScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// semaphoreQueueScript keeps the waiting holders in a sorted set scored
+// by the time they were queued, & their expiry in another one.
+// KEYS[1] queue, KEYS[2] queue expiry, ARGV[1] holder, ARGV[2] ttl in
+// microseconds
+var semaphoreQueueScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local ttl = tonumber(ARGV[2])
+
+for _, h in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now)) do
+	redis.call('ZREM', KEYS[1], h)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) == false then
+	redis.call('ZADD', KEYS[1], now, ARGV[1])
+end
+redis.call('ZADD', KEYS[2], now + ttl, ARGV[1])
+
+redis.call('PEXPIRE', KEYS[1], math.ceil(ttl / 1000))
+redis.call('PEXPIRE', KEYS[2], math.ceil(ttl / 1000))
+return redis.call('ZRANK', KEYS[1], ARGV[1]) + 1
+`)
+
+// KEYS[1] set, KEYS[2] queue, KEYS[3] queue expiry, ARGV[1] holder
+var semaphoreReleaseScript = redis.NewScript(`
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+return redis.call('ZREM', KEYS[1], ARGV[1])
+`)
+
+type redisSemaphore struct {
+	client redis.Scripter
+	key    string
+	ttl    time.Duration
+}
+
+// keys are the set of the slots, the queue & the expiry of the queued
+func (rs *redisSemaphore) keys() []string {
+	return []string{rs.key, rs.key + ":queue", rs.key + ":queue:ttl"}
+}
+
+func (rs *redisSemaphore) TryAcquire(cx context.Context, holder string, limit int) (bool, error) {
+	if limit <= 0 {
+		return false, ErrInvalidLimit
+	}
+
+	res, err := semaphoreAcquireScript.Run(
+		cx, rs.client, rs.keys(), holder, limit, rs.ttl.Microseconds(),
+	).Int()
+	if err != nil {
+		return false, errors.Wrap(err, "coordinator: failed to acquire semaphore")
+	}
+
+	return res == 1, nil
+}
+
+func (rs *redisSemaphore) Release(cx context.Context, holder string) error {
+	return errors.Wrap(
+		semaphoreReleaseScript.Run(cx, rs.client, rs.keys(), holder).Err(),
+		"coordinator: failed to release semaphore",
+	)
+}
+
+func (rs *redisSemaphore) Holders(cx context.Context) (int, error) {
+	n, err := semaphoreHoldersScript.Run(cx, rs.client, []string{rs.key}).Int()
+	return n, errors.Wrap(err, "coordinator: failed to count semaphore holders")
+}
+
+func (rs *redisSemaphore) Position(cx context.Context, holder string) (int, error) {
+	n, err := semaphoreQueueScript.Run(
+		cx, rs.client, rs.keys()[1:], holder, rs.ttl.Microseconds(),
+	).Int()
+	return n, errors.Wrap(err, "coordinator: failed to queue for semaphore")
+}
+
+// NewRedisSemaphore returns a DistributedSemaphore stored in redis as a
+// sorted set at key, the holders waiting are queued at key:queue &
+// key:queue:ttl. Slots expire ttl after they were last acquired.
+// Requires redis 7+ (see data/cache/redis).
+func NewRedisSemaphore(
+	client redis.Scripter,
+	key string,
+	ttl time.Duration,
+) (DistributedSemaphore, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	return &redisSemaphore{client, key, ttl}, nil
+}
+
+type inMemorySemaphore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	holders map[string]time.Time
+	now     func() time.Time
+
+	// the holders waiting, in order, & their expiry
+	queue  []string
+	queued map[string]time.Time
+}
+
+// prune expects the lock to be held
+func (ms *inMemorySemaphore) prune() {
+	now := ms.now()
+	for h, exp := range ms.holders {
+		if !now.Before(exp) {
+			delete(ms.holders, h)
+		}
+	}
+
+	for h, exp := range ms.queued {
+		if !now.Before(exp) {
+			ms.dequeue(h)
+		}
+	}
+}
+
+// dequeue expects the lock to be held
+func (ms *inMemorySemaphore) dequeue(holder string) {
+	if _, ok := ms.queued[holder]; !ok {
+		return
+	}
+
+	delete(ms.queued, holder)
+	for i, h := range ms.queue {
+		if h == holder {
+			ms.queue = append(ms.queue[:i], ms.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ms *inMemorySemaphore) TryAcquire(_ context.Context, holder string, limit int) (bool, error) {
+	if limit <= 0 {
+		return false, ErrInvalidLimit
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.prune()
+
+	if _, ok := ms.holders[holder]; !ok && len(ms.holders) >= limit {
+		return false, nil
+	}
+
+	ms.holders[holder] = ms.now().Add(ms.ttl)
+	ms.dequeue(holder)
+	return true, nil
+}
+
+func (ms *inMemorySemaphore) Release(_ context.Context, holder string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.holders, holder)
+	ms.dequeue(holder)
+	return nil
+}
+
+func (ms *inMemorySemaphore) Holders(context.Context) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.prune()
+	return len(ms.holders), nil
+}
+
+func (ms *inMemorySemaphore) Position(_ context.Context, holder string) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.prune()
+
+	if _, ok := ms.queued[holder]; !ok {
+		ms.queue = append(ms.queue, holder)
+	}
+	ms.queued[holder] = ms.now().Add(ms.ttl)
+
+	for i, h := range ms.queue {
+		if h == holder {
+			return i + 1, nil
+		}
+	}
+	return len(ms.queue), nil
+}
+
+// NewInMemorySemaphore returns a DistributedSemaphore local to the
+// process, for tests & single instance deployments
+func NewInMemorySemaphore(ttl time.Duration) (DistributedSemaphore, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	return &inMemorySemaphore{
+		ttl:     ttl,
+		holders: make(map[string]time.Time),
+		queued:  make(map[string]time.Time),
+		now:     time.Now,
+	}, nil
+}
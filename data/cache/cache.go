@@ -63,6 +63,17 @@ func NewInMemoryCache(
 	return inmem.New(expiry, eviction, options...), nil
 }
 
+// NewShardedInMemoryCache returns an in-memory cache split across
+// shards, reducing lock contention under heavy concurrent access
+func NewShardedInMemoryCache(
+	expiry time.Duration,
+	eviction time.Duration,
+	shards int,
+	options ...inmem.Option,
+) (Cache, error) {
+	return inmem.NewSharded(expiry, eviction, shards, options...), nil
+}
+
 func NewRedisCache(
 	logger log.Logger,
 	addr string,
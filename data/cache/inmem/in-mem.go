@@ -2,19 +2,39 @@
 package inmem
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"runtime"
 	"sync"
 	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/metrics"
+	"golang.org/x/sync/singleflight"
 )
 
+// ErrComputePanicked is returned by GetOrCompute when the computation
+// panicked
+var ErrComputePanicked = errors.New("inmem: compute panicked")
+
 type (
 	item struct {
 		expired bool
 		object  []byte
 		expires int64
 		evicts  int64
+
+		// elem is the place of the item in the recency list, nil
+		// without WithMaxEntries
+		elem *list.Element
+	}
+
+	// sweeper is implemented by caches which are cleaned up
+	// periodically by the janitor
+	sweeper interface {
+		MarkExpired()
+		Purge()
 	}
 
 	janitor struct {
@@ -31,6 +51,18 @@ type (
 		onExpired  func(string, []byte)
 		onEvicted  func(string, []byte)
 		janitor    *janitor
+
+		// maxEntries bounds the items, the least recently used one is
+		// evicted beyond it. recency has the keys, most recent first
+		maxEntries int
+		recency    *list.List
+
+		// flight dedupes the computations of GetOrCompute per key
+		flight singleflight.Group
+
+		// hits & misses count the gets, nil without WithMetrics
+		hits   metrics.Counter
+		misses metrics.Counter
 	}
 
 	keyval struct {
@@ -46,7 +78,7 @@ func (i *item) Expired() bool      { return i.expired }
 func (i *item) Expires() time.Time { return time.Unix(0, i.expires) }
 func (i *item) Evicts() time.Time  { return time.Unix(0, i.evicts) }
 
-func (j *janitor) Run(c *cache) {
+func (j *janitor) Run(c sweeper) {
 	exticker := time.NewTicker(j.expireDuration)
 	puticker := time.NewTicker(j.purgeDuration)
 
@@ -67,34 +99,41 @@ func (j *janitor) Run(c *cache) {
 func (c *cache) Flush() {
 	c.mutex.Lock()
 	c.items = make(map[string]*item)
+	if c.recency != nil {
+		c.recency.Init()
+	}
 	c.mutex.Unlock()
 }
 
 // Returns the object value stored and if it is found
 // This method is not thread safe
 func (c *cache) delete(k string) ([]byte, bool) {
-	if c.onEvicted != nil {
-		if v, found := c.items[k]; found {
-			delete(c.items, k)
-			return v.object, true
-		}
+	v, found := c.items[k]
+	if found && v.elem != nil {
+		c.recency.Remove(v.elem)
 	}
 
 	delete(c.items, k)
+
+	if c.onEvicted != nil && found {
+		return v.object, true
+	}
 	return nil, false
 }
 
 // Adds the item to cache replacing existing one
-func (c *cache) Set(_ context.Context, k string, val []byte) {
+func (c *cache) Set(cx context.Context, k string, val []byte) {
 	c.mutex.Lock()
-	c.set(k, val)
+	evicted := c.set(k, val)
 	// c.print()
 	c.mutex.Unlock()
+
+	c.evicted(cx, evicted)
 }
 
 // Add an item to the cache only if an item doesn't exist for the given key
 // or if the existing item has expired. Returns error otherwise
-func (c *cache) Add(_ context.Context, k string, val []byte) error {
+func (c *cache) Add(cx context.Context, k string, val []byte) error {
 	c.mutex.Lock()
 	_, found := c.get(k)
 	if found {
@@ -102,13 +141,15 @@ func (c *cache) Add(_ context.Context, k string, val []byte) error {
 		return fmt.Errorf("Item %s already exists", k)
 	}
 
-	c.set(k, val)
+	evicted := c.set(k, val)
 	c.mutex.Unlock()
+
+	c.evicted(cx, evicted)
 	return nil
 }
 
 // Replace item if it exists
-func (c *cache) Replace(_ context.Context, k string, val []byte) error {
+func (c *cache) Replace(cx context.Context, k string, val []byte) error {
 	c.mutex.Lock()
 	_, found := c.get(k)
 	if !found {
@@ -116,39 +157,71 @@ func (c *cache) Replace(_ context.Context, k string, val []byte) error {
 		return fmt.Errorf("Item %s doesn't exist", k)
 	}
 
-	c.set(k, val)
+	evicted := c.set(k, val)
 	c.mutex.Unlock()
+
+	c.evicted(cx, evicted)
 	return nil
 }
 
-func (c *cache) set(k string, val []byte) {
-	expires := time.Now().Add(c.expiration)
+func (c *cache) set(k string, val []byte) []keyval {
+	return c.setWithDuration(k, val, c.expiration)
+}
+
+// setWithDuration stores the item as the most recently used one & returns
+// the items evicted to make room for it, but is not thread safe
+func (c *cache) setWithDuration(k string, val []byte, expiration time.Duration) []keyval {
+	expires := time.Now().Add(expiration)
 	evicts := expires.Add(c.eviction)
-	c.items[k] = &item{
+
+	it := &item{
 		object:  val,
 		expired: false,
 		expires: expires.UnixNano(),
 		evicts:  evicts.UnixNano(),
 	}
+
+	if c.maxEntries <= 0 {
+		c.items[k] = it
+		return nil
+	}
+
+	if old, found := c.items[k]; found && old.elem != nil {
+		it.elem = old.elem
+		c.recency.MoveToFront(it.elem)
+	} else {
+		it.elem = c.recency.PushFront(k)
+	}
+	c.items[k] = it
+
+	var evicted []keyval
+	for len(c.items) > c.maxEntries {
+		lk := c.recency.Back().Value.(string)
+		if v, ok := c.delete(lk); ok {
+			evicted = append(evicted, keyval{lk, v})
+		}
+	}
+	return evicted
+}
+
+// evicted calls onEvicted for the items evicted by the bound on entries
+func (c *cache) evicted(cx context.Context, evicted []keyval) {
+	for _, kv := range evicted {
+		callback(cx, c.onEvicted, kv.key, kv.value)
+	}
 }
 
 func (c *cache) SetWithDuration(
-	_ context.Context,
+	cx context.Context,
 	k string,
 	val []byte,
 	expiration time.Duration,
 ) {
-	expires := time.Now().Add(expiration)
-	evicts := expires.Add(c.eviction)
-
 	c.mutex.Lock()
-	c.items[k] = &item{
-		object:  val,
-		expired: false,
-		expires: expires.UnixNano(),
-		evicts:  evicts.UnixNano(),
-	}
+	evicted := c.setWithDuration(k, val, expiration)
 	c.mutex.Unlock()
+
+	c.evicted(cx, evicted)
 }
 
 // get retrieves the item from cache, but is not thread safe
@@ -163,6 +236,21 @@ func (c *cache) get(k string) ([]byte, bool) {
 }
 
 func (c *cache) Get(_ context.Context, k string) ([]byte, bool) {
+	val, found := c.lookup(k)
+
+	switch {
+	case c.hits == nil:
+	case found:
+		c.hits.Add(1)
+	default:
+		c.misses.Add(1)
+	}
+
+	return val, found
+}
+
+// lookup retrieves the item from cache as the most recently used one
+func (c *cache) lookup(k string) ([]byte, bool) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -170,10 +258,57 @@ func (c *cache) Get(_ context.Context, k string) ([]byte, bool) {
 	if !found {
 		return nil, false
 	}
+
+	if it := c.items[k]; it.elem != nil {
+		c.recency.MoveToFront(it.elem)
+	}
 	//c.print()
 	return val, true
 }
 
+// GetOrCompute returns the value of k, computing it with fn & storing it
+// with the default expiration on a miss. The concurrent misses of a key
+// share a single call of fn, the callers wait for it or for their context
+// to be done. Errors of fn aren't stored, neither are panics, which fail
+// the callers with ErrComputePanicked
+func (c *cache) GetOrCompute(cx context.Context, k string, fn func() ([]byte, error)) ([]byte, error) {
+	if val, found := c.Get(cx, k); found {
+		return val, nil
+	}
+
+	ch := c.flight.DoChan(k, func() (v interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = errors.Wrapf(ErrComputePanicked, "%v", p)
+			}
+		}()
+
+		// computed by the flight which ended while this one began,
+		// the miss is counted already
+		if val, found := c.lookup(k); found {
+			return val, nil
+		}
+
+		val, err := fn()
+		if err != nil {
+			return nil, err
+		}
+
+		c.Set(cx, k, val)
+		return val, nil
+	})
+
+	select {
+	case rs := <-ch:
+		if rs.Err != nil {
+			return nil, rs.Err
+		}
+		return rs.Val.([]byte), nil
+	case <-cx.Done():
+		return nil, cx.Err()
+	}
+}
+
 func (c *cache) GetItem(k string) (*item, bool) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -182,13 +317,33 @@ func (c *cache) GetItem(k string) (*item, bool) {
 	return item, found
 }
 
-func (c *cache) Delete(_ context.Context, key string) {
+func (c *cache) Delete(cx context.Context, key string) {
 	c.mutex.Lock()
 	v, evicted := c.delete(key)
 	c.mutex.Unlock()
 
 	if evicted {
-		c.onEvicted(key, v)
+		callback(cx, c.onEvicted, key, v)
+	}
+}
+
+// callback calls fn without holding the caller past cx, a cancelled caller
+// returns while fn completes in the background
+func callback(cx context.Context, fn func(string, []byte), k string, v []byte) {
+	if cx.Done() == nil {
+		fn(k, v)
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(k, v)
+	}()
+
+	select {
+	case <-done:
+	case <-cx.Done():
 	}
 }
 
@@ -270,6 +425,19 @@ func (c *cache) Items() map[string]*item {
 	return m
 }
 
+// Keys returns the keys of the items which aren't expired
+func (c *cache) Keys() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	keys := make([]string, 0, len(c.items))
+	for k, v := range c.items {
+		if !v.expired {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
 func (c *cache) OnExpired(fn func(string, []byte)) {
 	c.mutex.Lock()
 	c.onExpired = fn
@@ -346,6 +514,40 @@ func WithOnEvictCallback(fn func(k string, val []byte)) Option {
 	}
 }
 
+// WithMaxEntries bounds the cache to n items, the least recently set or
+// got one is evicted to make room for a new one, calling the callback of
+// WithOnEvictCallback. Items are still expired & purged by the janitor.
+// The sharded cache splits n across its shards. Zero or less doesn't
+// bound the cache
+func WithMaxEntries(n int) Option {
+	return func(c *cache) {
+		c.maxEntries = n
+		if n > 0 && c.recency == nil {
+			c.recency = list.New()
+		}
+	}
+}
+
+// WithMetrics counts the hits & misses of Get in the `cache_hits` &
+// `cache_misses` counters of provider, labelled with `cache` as name to
+// tell the caches apart. Nothing is counted without a provider
+func WithMetrics(provider metrics.Provider, name string) Option {
+	if provider == nil {
+		return func(*cache) {}
+	}
+
+	// created once, the sharded cache applies the options to every shard
+	var (
+		hits   = provider.NewCounter("cache_hits", 1).With("cache", name)
+		misses = provider.NewCounter("cache_misses", 1).With("cache", name)
+	)
+
+	return func(c *cache) {
+		c.hits = hits
+		c.misses = misses
+	}
+}
+
 func WithOnExpiredCallback(fn func(k string, val []byte)) Option {
 	return func(c *cache) {
 		c.onExpired = fn
@@ -0,0 +1,200 @@
+package inmem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kit_metrics "github.com/go-kit/kit/metrics"
+	"github.com/unbxd/go-base/v2/metrics"
+)
+
+// counters counts by name & label values
+type counters struct {
+	metrics.Provider
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+type counter struct {
+	cs  *counters
+	key string
+}
+
+func (c counter) With(lvs ...string) kit_metrics.Counter {
+	return counter{c.cs, c.key + fmt.Sprint(lvs)}
+}
+
+func (c counter) Add(delta float64) {
+	c.cs.mu.Lock()
+	c.cs.counts[c.key] += delta
+	c.cs.mu.Unlock()
+}
+
+func (cs *counters) NewCounter(name string, _ float64) metrics.Counter {
+	return counter{cs, name}
+}
+
+func TestWithMetrics(t *testing.T) {
+	var (
+		cx = context.Background()
+		cs = &counters{counts: map[string]float64{}}
+	)
+
+	c := NewSharded(time.Minute, time.Minute, 4, WithMetrics(cs, "products"))
+	c.Set(cx, "k", []byte("v"))
+
+	c.Get(cx, "k")
+	c.Get(cx, "k")
+	c.Get(cx, "missing")
+
+	// the miss is counted once
+	_, _ = c.GetOrCompute(cx, "computed", func() ([]byte, error) { return []byte("v"), nil })
+
+	want := map[string]float64{
+		"cache_hits[cache products]":   2,
+		"cache_misses[cache products]": 2,
+	}
+	if fmt.Sprint(cs.counts) != fmt.Sprint(want) {
+		t.Errorf("counts = %v, want %v", cs.counts, want)
+	}
+
+	// no-op without a provider
+	New(time.Minute, time.Minute, WithMetrics(nil, "none")).Get(cx, "k")
+}
+
+func TestWithMaxEntries(t *testing.T) {
+	var (
+		cx      = context.Background()
+		evicted []string
+	)
+
+	c := New(time.Minute, time.Minute, WithMaxEntries(2), WithOnEvictCallback(func(k string, _ []byte) {
+		evicted = append(evicted, k)
+	}))
+
+	c.Set(cx, "a", []byte("1"))
+	c.Set(cx, "b", []byte("2"))
+
+	// a is now more recent than b
+	if _, ok := c.Get(cx, "a"); !ok {
+		t.Fatal("Get(a) missed")
+	}
+
+	c.SetWithDuration(cx, "c", []byte("3"), time.Minute)
+
+	if _, ok := c.Get(cx, "b"); ok || len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("evicted = %v, want the least recently used b", evicted)
+	}
+
+	// replacing doesn't grow the cache
+	if err := c.Replace(cx, "a", []byte("4")); err != nil || len(evicted) != 1 {
+		t.Errorf("Replace() = %v evicted %v, want nothing evicted", err, evicted)
+	}
+
+	c.Delete(cx, "a")
+	c.Set(cx, "d", []byte("5"))
+	if len(c.Keys()) != 2 || len(evicted) != 2 {
+		t.Errorf("Keys() = %v evicted %v, want c & d", c.Keys(), evicted)
+	}
+
+	// expired & purged items leave the recency list too
+	c.SetWithDuration(cx, "e", []byte("6"), -time.Second)
+	c.MarkExpired()
+	c.Purge()
+	c.Flush()
+	for i := 0; i < 10; i++ {
+		c.Set(cx, strconv.Itoa(i), nil)
+	}
+	if l := len(c.items); l != 2 || c.recency.Len() != 2 {
+		t.Errorf("items = %d recency = %d, want 2", l, c.recency.Len())
+	}
+}
+
+func TestShardedWithMaxEntries(t *testing.T) {
+	cx := context.Background()
+	sc := NewSharded(time.Minute, time.Minute, 4, WithMaxEntries(8))
+
+	for i := 0; i < 100; i++ {
+		sc.Set(cx, strconv.Itoa(i), nil)
+	}
+
+	if l := len(sc.Keys()); l > 8 || l == 0 {
+		t.Errorf("Keys() = %d, want up to 8", l)
+	}
+
+	// n not a multiple of the shards, or fewer than the shards
+	for _, tt := range []struct{ shards, n int }{{16, 100}, {0, 10}, {4, 1}} {
+		sc := NewSharded(time.Minute, time.Minute, tt.shards, WithMaxEntries(tt.n))
+
+		for i := 0; i < 10*tt.n; i++ {
+			sc.Set(cx, strconv.Itoa(i), nil)
+
+			if l := len(sc.Keys()); l > tt.n {
+				t.Fatalf("%d shards, Keys() = %d after %d sets, want up to %d", tt.shards, l, i+1, tt.n)
+			}
+		}
+
+		if len(sc.Keys()) == 0 {
+			t.Errorf("%d shards, Keys() = 0, want up to %d", tt.shards, tt.n)
+		}
+	}
+}
+
+func TestGetOrCompute(t *testing.T) {
+	var (
+		cx    = context.Background()
+		c     = New(time.Minute, time.Minute)
+		calls atomic.Int32
+		wg    sync.WaitGroup
+	)
+
+	compute := func() ([]byte, error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return []byte("v"), nil
+	}
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.GetOrCompute(cx, "k", compute); err != nil || string(v) != "v" {
+				t.Errorf("GetOrCompute() = %s, %v, want v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fn called %d times, want once", n)
+	}
+	if v, ok := c.Get(cx, "k"); !ok || string(v) != "v" {
+		t.Errorf("Get() = %s, %v, want the computed value", v, ok)
+	}
+
+	failing := errors.New("downstream failed")
+	if _, err := c.GetOrCompute(cx, "e", func() ([]byte, error) { return nil, failing }); err != failing {
+		t.Errorf("GetOrCompute() error = %v, want %v", err, failing)
+	}
+	if _, ok := c.Get(cx, "e"); ok {
+		t.Error("Get() after a failed computation hit, want the error not stored")
+	}
+
+	if _, err := c.GetOrCompute(cx, "p", func() ([]byte, error) { panic("boom") }); !errors.Is(err, ErrComputePanicked) {
+		t.Errorf("GetOrCompute() error = %v, want ErrComputePanicked", err)
+	}
+	if v, err := c.GetOrCompute(cx, "p", compute); err != nil || string(v) != "v" {
+		t.Errorf("GetOrCompute() after a panic = %s, %v, want v", v, err)
+	}
+
+	sc := NewSharded(time.Minute, time.Minute, 4)
+	if v, err := sc.GetOrCompute(cx, "k", compute); err != nil || string(v) != "v" {
+		t.Errorf("sharded GetOrCompute() = %s, %v, want v", v, err)
+	}
+}
@@ -0,0 +1,223 @@
+package inmem
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// DefaultShards is the number of shards used by NewSharded when
+// the shard count passed is not positive
+const DefaultShards = 256
+
+type shardedCache struct {
+	shards  []*cache
+	mask    uint64
+	janitor *janitor
+}
+
+// fnv-1a, inlined to avoid allocating a hash.Hash per operation
+func hashKey(k string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	var h uint64 = offset64
+	for i := 0; i < len(k); i++ {
+		h ^= uint64(k[i])
+		h *= prime64
+	}
+	return h
+}
+
+func (sc *shardedCache) shard(k string) *cache {
+	return sc.shards[hashKey(k)&sc.mask]
+}
+
+// Set adds the item to cache replacing existing one
+func (sc *shardedCache) Set(cx context.Context, k string, val []byte) {
+	sc.shard(k).Set(cx, k, val)
+}
+
+// Add an item to the cache only if an item doesn't exist for the given key
+// or if the existing item has expired. Returns error otherwise
+func (sc *shardedCache) Add(cx context.Context, k string, val []byte) error {
+	return sc.shard(k).Add(cx, k, val)
+}
+
+// Replace item if it exists
+func (sc *shardedCache) Replace(cx context.Context, k string, val []byte) error {
+	return sc.shard(k).Replace(cx, k, val)
+}
+
+func (sc *shardedCache) SetWithDuration(
+	cx context.Context,
+	k string,
+	val []byte,
+	expiration time.Duration,
+) {
+	sc.shard(k).SetWithDuration(cx, k, val, expiration)
+}
+
+func (sc *shardedCache) Get(cx context.Context, k string) ([]byte, bool) {
+	return sc.shard(k).Get(cx, k)
+}
+
+// GetOrCompute returns the value of k, computing it with fn on a miss,
+// see Cache.GetOrCompute
+func (sc *shardedCache) GetOrCompute(cx context.Context, k string, fn func() ([]byte, error)) ([]byte, error) {
+	return sc.shard(k).GetOrCompute(cx, k, fn)
+}
+
+func (sc *shardedCache) GetItem(k string) (*item, bool) {
+	return sc.shard(k).GetItem(k)
+}
+
+func (sc *shardedCache) Delete(cx context.Context, k string) {
+	sc.shard(k).Delete(cx, k)
+}
+
+func (sc *shardedCache) Flush() {
+	for _, c := range sc.shards {
+		c.Flush()
+	}
+}
+
+// MarkExpired walks all the shards, locking one shard at a time
+func (sc *shardedCache) MarkExpired() {
+	for _, c := range sc.shards {
+		c.MarkExpired()
+	}
+}
+
+// Purge walks all the shards, locking one shard at a time
+func (sc *shardedCache) Purge() {
+	for _, c := range sc.shards {
+		c.Purge()
+	}
+}
+
+func (sc *shardedCache) ExpiredItems() map[string]*item {
+	m := make(map[string]*item)
+	for _, c := range sc.shards {
+		for k, v := range c.ExpiredItems() {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// Items Returns items which aren't expired
+func (sc *shardedCache) Items() map[string]*item {
+	m := make(map[string]*item)
+	for _, c := range sc.shards {
+		for k, v := range c.Items() {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// Keys returns the keys of the items which aren't expired
+func (sc *shardedCache) Keys() []string {
+	var keys []string
+	for _, c := range sc.shards {
+		keys = append(keys, c.Keys()...)
+	}
+	return keys
+}
+
+func (sc *shardedCache) OnExpired(fn func(string, []byte)) {
+	for _, c := range sc.shards {
+		c.OnExpired(fn)
+	}
+}
+
+func (sc *shardedCache) OnEvicted(fn func(string, []byte)) {
+	for _, c := range sc.shards {
+		c.OnEvicted(fn)
+	}
+}
+
+// ShardedCache is sharable object which encapsulates a cache split
+// into multiple independently locked shards. Operations on keys which
+// land on different shards don't contend on the same lock.
+// Prefer it over Cache for high concurrency, Cache is cheaper for small
+// use cases.
+type ShardedCache struct{ *shardedCache }
+
+func shardedFinalizer(c *ShardedCache) {
+	c.janitor.stop <- true
+}
+
+// nextPow2 rounds n up to the next power of two, so shard can be
+// selected with a mask instead of a modulo
+func nextPow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// NewSharded returns a new cache object split in `shards` shards, rounded up
+// to a power of two. The options are applied to every shard.
+// A single janitor walks all the shards for expiry & purge.
+// The n items of WithMaxEntries are split over the shards, the cache never
+// holds more than n. With fewer items than shards, the shards are halved
+// till each has room for one, a shard evicts once its share is full
+func NewSharded(
+	expires time.Duration,
+	evicts time.Duration,
+	shards int,
+	opts ...Option,
+) *ShardedCache {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+
+	shards = nextPow2(shards)
+
+	sc := &shardedCache{
+		shards: make([]*cache, shards),
+		mask:   uint64(shards - 1),
+	}
+
+	for ix := range sc.shards {
+		c := newCache(expires, evicts, make(map[string]*item))
+		for _, o := range opts {
+			o(c)
+		}
+		sc.shards[ix] = c
+	}
+
+	// the bound is for the whole cache, split over at most n shards so
+	// each holds one item at least
+	if n := sc.shards[0].maxEntries; n > 0 {
+		for shards > n {
+			shards /= 2
+		}
+
+		sc.shards, sc.mask = sc.shards[:shards], uint64(shards-1)
+		for ix, c := range sc.shards {
+			c.maxEntries = n / shards
+			if ix < n%shards {
+				c.maxEntries++
+			}
+		}
+	}
+
+	sc.janitor = &janitor{
+		expireDuration: defaultExpiryTicker,
+		purgeDuration:  defaultEvictTicker,
+		stop:           make(chan bool),
+	}
+
+	C := &ShardedCache{sc}
+
+	go sc.janitor.Run(sc)
+	runtime.SetFinalizer(C, shardedFinalizer)
+
+	return C
+}
@@ -0,0 +1,124 @@
+package inmem
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedCacheOperations(t *testing.T) {
+	var (
+		cx = context.Background()
+		sc = NewSharded(time.Minute, time.Minute, 10)
+	)
+
+	if len(sc.shards) != 16 {
+		t.Errorf("NewSharded() shards = %d, want rounded to 16", len(sc.shards))
+	}
+
+	for i := 0; i < 100; i++ {
+		sc.Set(cx, strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+
+	for i := 0; i < 100; i++ {
+		v, ok := sc.Get(cx, strconv.Itoa(i))
+		if !ok || string(v) != strconv.Itoa(i) {
+			t.Errorf("Get(%d) = %s, %v", i, v, ok)
+		}
+	}
+
+	if err := sc.Add(cx, "1", []byte("x")); err == nil {
+		t.Errorf("Add() on existing key should fail")
+	}
+
+	if err := sc.Replace(cx, "missing", []byte("x")); err == nil {
+		t.Errorf("Replace() on missing key should fail")
+	}
+
+	sc.Delete(cx, "1")
+	if _, ok := sc.Get(cx, "1"); ok {
+		t.Errorf("Get() after Delete() should miss")
+	}
+
+	if l := len(sc.Items()); l != 99 {
+		t.Errorf("Items() = %d, want 99", l)
+	}
+}
+
+func TestShardedCacheJanitorWalksAllShards(t *testing.T) {
+	var (
+		cx      = context.Background()
+		evicted int32
+		sc      = NewSharded(
+			time.Millisecond,
+			0,
+			8,
+			WithOnEvictCallback(func(string, []byte) {
+				atomic.AddInt32(&evicted, 1)
+			}),
+		)
+	)
+
+	for i := 0; i < 64; i++ {
+		sc.Set(cx, strconv.Itoa(i), []byte("v"))
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	sc.MarkExpired()
+	if l := len(sc.ExpiredItems()); l != 64 {
+		t.Errorf("ExpiredItems() = %d, want 64", l)
+	}
+
+	sc.Purge()
+	if l := len(sc.ExpiredItems()); l != 0 {
+		t.Errorf("ExpiredItems() after Purge() = %d, want 0", l)
+	}
+
+	if atomic.LoadInt32(&evicted) != 64 {
+		t.Errorf("evicted = %d, want 64", evicted)
+	}
+}
+
+type benchCache interface {
+	Set(context.Context, string, []byte)
+	Get(context.Context, string) ([]byte, bool)
+}
+
+func benchmarkMixed(b *testing.B, c benchCache) {
+	var (
+		cx   = context.Background()
+		keys = make([]string, 4096)
+		val  = []byte("value")
+	)
+
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		c.Set(cx, keys[i], val)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i%len(keys)]
+			// 1 write for every 4 reads
+			if i%5 == 0 {
+				c.Set(cx, k, val)
+			} else {
+				c.Get(cx, k)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheMixed(b *testing.B) {
+	benchmarkMixed(b, New(time.Minute, time.Minute))
+}
+
+func BenchmarkShardedCacheMixed(b *testing.B) {
+	benchmarkMixed(b, NewSharded(time.Minute, time.Minute, DefaultShards))
+}
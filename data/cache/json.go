@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+var (
+	// ErrEncode is returned by SetJSON when the value doesn't encode
+	ErrEncode = errors.New("cache: failed to encode the value")
+	// ErrDecode is returned by GetJSON when the cached value doesn't
+	// decode in the destination
+	ErrDecode = errors.New("cache: failed to decode the value")
+)
+
+// SetJSON stores v encoded as JSON for key in c. It fails with ErrEncode
+// wrapping the error of encoding/json, the failures of the backend aren't
+// returned by Cache.Set, the backends log them
+func SetJSON(cx context.Context, c Cache, key string, v interface{}) error {
+	bt, err := json.Marshal(v)
+	if err != nil {
+		return errors.With(ErrEncode, err)
+	}
+
+	c.Set(cx, key, bt)
+	return nil
+}
+
+// GetJSON decodes the JSON value of key in c into dst, found is false on
+// a miss & dst is left untouched. It fails with ErrDecode wrapping the
+// error of encoding/json when the value doesn't decode in dst
+func GetJSON(cx context.Context, c Cache, key string, dst interface{}) (found bool, err error) {
+	bt, found := c.Get(cx, key)
+	if !found {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(bt, dst); err != nil {
+		return true, errors.With(ErrDecode, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	cx := context.Background()
+	c, _ := NewInMemoryCache(time.Minute, time.Minute)
+
+	if err := SetJSON(cx, c, "sku-42", product{"sku-42", 9.5}); err != nil {
+		t.Fatalf("SetJSON() error = %v", err)
+	}
+
+	var p product
+	if found, err := GetJSON(cx, c, "sku-42", &p); !found || err != nil || p.Price != 9.5 {
+		t.Errorf("GetJSON() = %+v, %v, %v, want sku-42", p, found, err)
+	}
+
+	// a miss leaves dst untouched
+	if found, err := GetJSON(cx, c, "missing", &p); found || err != nil || p.SKU != "sku-42" {
+		t.Errorf("GetJSON() of a miss = %+v, %v, %v", p, found, err)
+	}
+
+	var ute *json.UnsupportedTypeError
+	if err := SetJSON(cx, c, "fn", func() {}); !errors.Is(err, ErrEncode) || !errors.As(err, &ute) {
+		t.Errorf("SetJSON() of a func error = %v, want ErrEncode", err)
+	}
+
+	var n int
+	if found, err := GetJSON(cx, c, "sku-42", &n); !found || !errors.Is(err, ErrDecode) {
+		t.Errorf("GetJSON() in an int = %v, %v, want ErrDecode", found, err)
+	}
+}
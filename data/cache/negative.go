@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"time"
+)
+
+// absentMarker is the value stored for keys known to be absent, a value
+// nobody should cache for real
+var absentMarker = []byte("\x00\xffgo-base:absent\xff\x00")
+
+// Presence is the state of a key in a NegativeCache
+type Presence int
+
+// Presences
+const (
+	// Miss is a key the cache knows nothing about, ask the origin
+	Miss Presence = iota
+	// Hit is a key with a value
+	Hit
+	// Absent is a key known to be missing at the origin, skip it
+	Absent
+)
+
+type (
+	// NegativeCache is a Cache which also remembers the keys missing at the
+	// origin for a while, so repeated lookups of keys which don't exist,
+	// e.g. random keys probed to get past the cache, don't reach it
+	NegativeCache interface {
+		Cache
+
+		// SetNotFound records key as absent at the origin for ttl, zero
+		// uses the TTL of the cache. Setting a value for the key clears it
+		SetNotFound(cx context.Context, key string, ttl time.Duration)
+
+		// Lookup returns the value & Hit, Absent if the key was recorded
+		// as not found, or Miss
+		Lookup(cx context.Context, key string) ([]byte, Presence)
+	}
+
+	negativeCache struct {
+		Cache
+		ttl time.Duration
+	}
+)
+
+func (nc *negativeCache) SetNotFound(cx context.Context, key string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = nc.ttl
+	}
+	nc.Cache.SetWithDuration(cx, key, absentMarker, ttl)
+}
+
+func (nc *negativeCache) Lookup(cx context.Context, key string) ([]byte, Presence) {
+	val, found := nc.Cache.Get(cx, key)
+	switch {
+	case !found:
+		return nil, Miss
+	case bytes.Equal(val, absentMarker):
+		return nil, Absent
+	default:
+		return val, Hit
+	}
+}
+
+// Get returns the value for the key, keys recorded as not found aren't
+// found
+func (nc *negativeCache) Get(cx context.Context, key string) ([]byte, bool) {
+	val, presence := nc.Lookup(cx, key)
+	return val, presence == Hit
+}
+
+// NewNegativeCache adds negative caching to c, keys are recorded as not
+// found for ttl by default, usually much shorter than the TTL of values
+// so keys created at the origin show up soon. e.g.
+//
+//	val, presence := nc.Lookup(cx, key)
+//	switch presence {
+//	case cache.Absent:
+//		return nil, ErrNotFound
+//	case cache.Miss:
+//		val, err = origin.Get(cx, key)
+//		if errors.Is(err, ErrNotFound) {
+//			nc.SetNotFound(cx, key, 0)
+//		}
+//	}
+//
+// The absence is stored in c as a marker value, it works with any Cache
+// & is shared with the other instances of a shared one, like redis
+func NewNegativeCache(c Cache, ttl time.Duration) NegativeCache {
+	return &negativeCache{Cache: c, ttl: ttl}
+}
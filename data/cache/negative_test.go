@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/cache/inmem"
+)
+
+func TestNegativeCache(t *testing.T) {
+	var (
+		cx = context.Background()
+		nc = NewNegativeCache(inmem.New(time.Minute, time.Minute), time.Minute)
+	)
+
+	nc.Set(cx, "hit", []byte("v"))
+	nc.SetNotFound(cx, "absent", 0)
+
+	tests := []struct {
+		key      string
+		want     string
+		presence Presence
+	}{
+		{"hit", "v", Hit},
+		{"absent", "", Absent},
+		{"miss", "", Miss},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			val, presence := nc.Lookup(cx, tt.key)
+			if string(val) != tt.want || presence != tt.presence {
+				t.Errorf("Lookup() = %q, %v, want %q, %v", val, presence, tt.want, tt.presence)
+			}
+
+			if _, found := nc.Get(cx, tt.key); found != (tt.presence == Hit) {
+				t.Errorf("Get() found = %v, want %v", found, tt.presence == Hit)
+			}
+		})
+	}
+
+	// created at the origin since
+	nc.Set(cx, "absent", []byte("v"))
+	if _, presence := nc.Lookup(cx, "absent"); presence != Hit {
+		t.Errorf("Lookup() after Set = %v, want %v", presence, Hit)
+	}
+}
@@ -10,26 +10,64 @@ package redis
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	redis "github.com/redis/go-redis/v9"
 	"github.com/unbxd/go-base/v2/errors"
 	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
 )
 
 var NOEXPIRE = time.Duration(0)
 
+// batchSize is the most keys sent in a single command by GetMulti &
+// SetMulti, larger batches are split
+const batchSize = 500
+
+// incrScript adds to the counter & sets the expiry of a fresh one.
+// KEYS[1] counter, ARGV[1] delta, ARGV[2] ttl in milliseconds
+var incrScript = redis.NewScript(`
+local fresh = redis.call('EXISTS', KEYS[1]) == 0
+local val = redis.call('INCRBY', KEYS[1], ARGV[1])
+if fresh then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return val
+`)
+
 type (
 	cache struct {
 		logger log.Logger
-		opt    *redis.Options
+		opt    *redis.UniversalOptions
+
+		// timeouts per operation, zero leaves the context as is
+		readTimeout  time.Duration
+		writeTimeout time.Duration
+
+		// hits & misses count the gets, nil without WithMetrics
+		hits   metrics.Counter
+		misses metrics.Counter
 
-		cc *redis.Client
+		// cc is a *redis.Client or, with cluster, a *redis.ClusterClient
+		cc      redis.UniversalClient
+		cluster bool
 	}
 
 	Option func(*cache)
 )
 
+// withTimeout bounds cx by the timeout of the operation
+func withTimeout(
+	cx context.Context,
+	timeout time.Duration,
+) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return cx, func() {}
+	}
+	return context.WithTimeout(cx, timeout)
+}
+
 func (c *cache) set(
 	cx context.Context,
 	key string,
@@ -38,6 +76,9 @@ func (c *cache) set(
 ) error {
 	var err error
 
+	cx, cancel := withTimeout(cx, c.writeTimeout)
+	defer cancel()
+
 	stcmd := c.cc.Set(cx, key, val, duration)
 	err = stcmd.Err()
 
@@ -62,6 +103,9 @@ func (c *cache) exists(cx context.Context, key string) (bool, error) {
 		rc     int64
 	)
 
+	cx, cancel := withTimeout(cx, c.readTimeout)
+	defer cancel()
+
 	intcmd = c.cc.Exists(cx, key)
 	err = intcmd.Err()
 
@@ -105,6 +149,9 @@ func (c *cache) delete(
 		rc     int64
 	)
 
+	cx, cancel := withTimeout(cx, c.writeTimeout)
+	defer cancel()
+
 	intcmd = c.cc.Del(cx, key)
 	err = intcmd.Err()
 	if err != nil {
@@ -170,11 +217,29 @@ func (c *cache) SetWithDuration(
 }
 
 func (c *cache) Get(cx context.Context, key string) (val []byte, found bool) {
+	val, found = c.get(cx, key)
+
+	switch {
+	case c.hits == nil:
+	case found:
+		c.hits.Add(1)
+	default:
+		c.misses.Add(1)
+	}
+
+	return val, found
+}
+
+// get reads key, the failures are logged & are misses
+func (c *cache) get(cx context.Context, key string) ([]byte, bool) {
 	var (
 		strcmd *redis.StringCmd
 		err    error
 	)
 
+	cx, cancel := withTimeout(cx, c.readTimeout)
+	defer cancel()
+
 	strcmd = c.cc.Get(cx, key)
 	err = strcmd.Err()
 
@@ -208,6 +273,138 @@ func (c *cache) Get(cx context.Context, key string) (val []byte, found bool) {
 	return []byte(vs), true
 }
 
+// GetMulti gets the values of keys with MGET, the keys missing aren't in
+// the map. Large batches are split, it fails if any of them does
+func (c *cache) GetMulti(cx context.Context, keys []string) (map[string][]byte, error) {
+	vals := make(map[string][]byte, len(keys))
+
+	for start := 0; start < len(keys); start += batchSize {
+		batch := keys[start:min(start+batchSize, len(keys))]
+
+		if err := c.mget(cx, batch, vals); err != nil {
+			c.logger.Error(
+				"failed to get data from redis",
+				log.Int("keys", len(keys)),
+				log.Error(err),
+			)
+			return nil, errors.Wrapf(err, "failed to get %d keys", len(keys))
+		}
+	}
+
+	if c.hits != nil {
+		c.hits.Add(float64(len(vals)))
+		c.misses.Add(float64(len(keys) - len(vals)))
+	}
+
+	return vals, nil
+}
+
+func (c *cache) mget(cx context.Context, keys []string, vals map[string][]byte) error {
+	cx, cancel := withTimeout(cx, c.readTimeout)
+	defer cancel()
+
+	// the keys of MGET are to be in a single slot of the cluster, the
+	// pipeline is split by node
+	if c.cluster {
+		cmds, err := c.cc.Pipelined(cx, func(pp redis.Pipeliner) error {
+			for _, k := range keys {
+				pp.Get(cx, k)
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		for ix, cmd := range cmds {
+			if vs, err := cmd.(*redis.StringCmd).Result(); err == nil {
+				vals[keys[ix]] = []byte(vs)
+			}
+		}
+		return nil
+	}
+
+	res, err := c.cc.MGet(cx, keys...).Result()
+	if err != nil {
+		return err
+	}
+
+	for ix, v := range res {
+		if vs, ok := v.(string); ok {
+			vals[keys[ix]] = []byte(vs)
+		}
+	}
+	return nil
+}
+
+// SetMulti sets items with a pipeline, expiring after expiration, zero
+// doesn't expire them. Large batches are split, it fails if any of the
+// writes does, the others are kept
+func (c *cache) SetMulti(cx context.Context, items map[string][]byte, expiration time.Duration) error {
+	var (
+		failed int
+		first  error
+		batch  = make(map[string][]byte, min(len(items), batchSize))
+	)
+
+	flush := func() {
+		if n, err := c.mset(cx, batch, expiration); err != nil {
+			failed += n
+			if first == nil {
+				first = err
+			}
+		}
+		clear(batch)
+	}
+
+	for k, v := range items {
+		batch[k] = v
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+
+	if len(batch) > 0 {
+		flush()
+	}
+
+	if first != nil {
+		c.logger.Error(
+			"failed to write to redis",
+			log.Int("keys", len(items)),
+			log.Int("failed", failed),
+			log.Error(first),
+		)
+		return errors.Wrapf(first, "failed to set %d of %d keys", failed, len(items))
+	}
+
+	return nil
+}
+
+// mset returns the number of writes which failed with the first error
+func (c *cache) mset(cx context.Context, items map[string][]byte, expiration time.Duration) (int, error) {
+	cx, cancel := withTimeout(cx, c.writeTimeout)
+	defer cancel()
+
+	cmds, err := c.cc.Pipelined(cx, func(pp redis.Pipeliner) error {
+		for k, v := range items {
+			pp.Set(cx, k, v, expiration)
+		}
+		return nil
+	})
+	if err == nil {
+		return 0, nil
+	}
+
+	var failed int
+	for _, cmd := range cmds {
+		if cmd.Err() != nil {
+			failed++
+		}
+	}
+	return failed, err
+}
+
 func (c *cache) Delete(
 	cx context.Context,
 	key string,
@@ -222,6 +419,102 @@ func (c *cache) Delete(
 	}
 }
 
+func (c *cache) incr(
+	cx context.Context,
+	key string,
+	delta int64,
+	expiration time.Duration,
+) (int64, error) {
+	cx, cancel := withTimeout(cx, c.writeTimeout)
+	defer cancel()
+
+	if expiration <= 0 {
+		return c.cc.IncrBy(cx, key, delta).Result()
+	}
+
+	ms := expiration.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+
+	return incrScript.Run(cx, c.cc, []string{key}, delta, ms).Int64()
+}
+
+// Increment adds delta to the counter at key with INCRBY & returns its
+// value, a missing key counts from zero. It fails for a value which
+// isn't an integer
+func (c *cache) Increment(cx context.Context, key string, delta int64) (int64, error) {
+	return c.IncrementWithDuration(cx, key, delta, NOEXPIRE)
+}
+
+// IncrementWithDuration is Increment, the counter expires after
+// expiration if it is created by this call
+func (c *cache) IncrementWithDuration(
+	cx context.Context,
+	key string,
+	delta int64,
+	expiration time.Duration,
+) (int64, error) {
+	val, err := c.incr(cx, key, delta, expiration)
+	if err != nil {
+		c.logger.Error(
+			"failed to increment counter in redis",
+			log.String("key", key),
+			log.Int64("delta", delta),
+			log.Error(err),
+		)
+		return 0, errors.Wrapf(err, "failed to increment %s", key)
+	}
+
+	return val, nil
+}
+
+// Decrement subtracts delta from the counter at key with DECRBY & returns
+// its value, see Increment
+func (c *cache) Decrement(cx context.Context, key string, delta int64) (int64, error) {
+	cx, cancel := withTimeout(cx, c.writeTimeout)
+	defer cancel()
+
+	val, err := c.cc.DecrBy(cx, key, delta).Result()
+	if err != nil {
+		c.logger.Error(
+			"failed to decrement counter in redis",
+			log.String("key", key),
+			log.Int64("delta", delta),
+			log.Error(err),
+		)
+		return 0, errors.Wrapf(err, "failed to decrement %s", key)
+	}
+
+	return val, nil
+}
+
+// DecrementWithDuration is Decrement, the counter expires after
+// expiration if it is created by this call
+func (c *cache) DecrementWithDuration(
+	cx context.Context,
+	key string,
+	delta int64,
+	expiration time.Duration,
+) (int64, error) {
+	if expiration <= 0 {
+		return c.Decrement(cx, key, delta)
+	}
+
+	val, err := c.incr(cx, key, -delta, expiration)
+	if err != nil {
+		c.logger.Error(
+			"failed to decrement counter in redis",
+			log.String("key", key),
+			log.Int64("delta", delta),
+			log.Error(err),
+		)
+		return 0, errors.Wrapf(err, "failed to decrement %s", key)
+	}
+
+	return val, nil
+}
+
 func WithPassword(password string) Option {
 	return func(cc *cache) {
 		cc.opt.Password = password
@@ -240,15 +533,39 @@ func WithOnConnect(callback func(context.Context, *redis.Conn) error) Option {
 	}
 }
 
+// WithOpTimeout bounds the reads (Get & the existence checks) and the
+// writes (Set, Delete...) to redis, on top of the deadline of the context
+// passed. Zero leaves the operation to the context alone
+func WithOpTimeout(read, write time.Duration) Option {
+	return func(cc *cache) {
+		cc.readTimeout = read
+		cc.writeTimeout = write
+	}
+}
+
+// WithMetrics counts the hits & misses of Get in the `cache_hits` &
+// `cache_misses` counters of provider, labelled with `cache` as name to
+// tell the caches apart. Failed reads are misses. Nothing is counted
+// without a provider
+func WithMetrics(provider metrics.Provider, name string) Option {
+	return func(cc *cache) {
+		if provider == nil {
+			return
+		}
+
+		cc.hits = provider.NewCounter("cache_hits", 1).With("cache", name)
+		cc.misses = provider.NewCounter("cache_misses", 1).With("cache", name)
+	}
+}
+
 type Cache struct{ *cache }
 
-func NewRedisCache(
-	logger log.Logger,
-	addr string,
-	options ...Option,
-) (*Cache, error) {
-	opt := &redis.Options{
-		Addr: addr,
+func newCache(logger log.Logger, addrs []string, options []Option) *cache {
+	opt := &redis.UniversalOptions{
+		Addrs: addrs,
+		// commands give up with their context, not only past the
+		// read & write timeouts of the connection
+		ContextTimeoutEnabled: true,
 	}
 
 	ch := &cache{logger: logger, opt: opt, cc: nil}
@@ -257,18 +574,48 @@ func NewRedisCache(
 		fn(ch)
 	}
 
-	// create client
-	cc := redis.NewClient(ch.opt)
+	return ch
+}
 
+// connect pings redis with the client
+func (c *cache) connect(cc redis.UniversalClient, addrs []string) (*Cache, error) {
 	sc := cc.Ping(context.Background())
 	if sc.Err() != nil {
+		_ = cc.Close()
 		return nil, errors.Wrapf(
 			sc.Err(),
 			"failed to connect to redis. addr: %s",
-			addr,
+			strings.Join(addrs, ","),
 		)
 	}
 
-	ch.cc = cc
-	return &Cache{ch}, nil
+	c.cc = cc
+	return &Cache{c}, nil
+}
+
+func NewRedisCache(
+	logger log.Logger,
+	addr string,
+	options ...Option,
+) (*Cache, error) {
+	ch := newCache(logger, []string{addr}, options)
+
+	// create client
+	return ch.connect(redis.NewClient(ch.opt.Simple()), ch.opt.Addrs)
+}
+
+// NewRedisClusterCache returns the cache on a redis cluster, the nodes
+// are discovered from the ones at addrs. The options are the ones of
+// NewRedisCache, WithDatabase is ignored as a cluster has a single
+// database. GetMulti sends GETs in a pipeline, as the keys of MGET are
+// to be in a single slot
+func NewRedisClusterCache(
+	logger log.Logger,
+	addrs []string,
+	options ...Option,
+) (*Cache, error) {
+	ch := newCache(logger, addrs, options)
+	ch.cluster = true
+
+	return ch.connect(redis.NewClusterClient(ch.opt.Cluster()), addrs)
 }
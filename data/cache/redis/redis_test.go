@@ -0,0 +1,173 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestWithOpTimeout(t *testing.T) {
+	// accepts connections & never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := &cache{logger: log.NewNoopLogger()}
+	WithOpTimeout(20*time.Millisecond, 20*time.Millisecond)(c)
+	c.cc = redis.NewClient(&redis.Options{
+		Addr:                  ln.Addr().String(),
+		ContextTimeoutEnabled: true,
+		MaxRetries:            -1,
+	})
+	defer c.cc.Close()
+
+	start := time.Now()
+
+	if _, found := c.Get(context.Background(), "k"); found {
+		t.Error("Get() found = true, want false")
+	}
+	c.Set(context.Background(), "k", []byte("v"))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get() & Set() took %v, want them bounded by the timeouts", elapsed)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	var (
+		cx = context.Background()
+		mr = miniredis.RunT(t)
+	)
+
+	c, err := NewRedisCache(log.NewNoopLogger(), mr.Addr())
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+
+	if v, err := c.Increment(cx, "hits", 5); err != nil || v != 5 {
+		t.Errorf("Increment() = %d, %v, want 5", v, err)
+	}
+	if v, err := c.Decrement(cx, "hits", 2); err != nil || v != 3 {
+		t.Errorf("Decrement() = %d, %v, want 3", v, err)
+	}
+
+	// the expiry is set on a fresh counter only
+	if v, err := c.IncrementWithDuration(cx, "daily", 1, time.Minute); err != nil || v != 1 {
+		t.Errorf("IncrementWithDuration() = %d, %v, want 1", v, err)
+	}
+	mr.FastForward(30 * time.Second)
+
+	if v, err := c.DecrementWithDuration(cx, "daily", 3, time.Hour); err != nil || v != -2 {
+		t.Errorf("DecrementWithDuration() = %d, %v, want -2", v, err)
+	}
+	if ttl := mr.TTL("daily"); ttl != 30*time.Second {
+		t.Errorf("TTL() = %v, want the one of the fresh counter", ttl)
+	}
+	if ttl := mr.TTL("hits"); ttl != 0 {
+		t.Errorf("TTL() = %v, want none", ttl)
+	}
+
+	c.Set(cx, "name", []byte("shoe"))
+	if _, err := c.Increment(cx, "name", 1); err == nil {
+		t.Error("Increment() of a string error = nil")
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	var (
+		cx    = context.Background()
+		mr    = miniredis.RunT(t)
+		items = make(map[string][]byte)
+		keys  []string
+	)
+
+	c, err := NewRedisCache(log.NewNoopLogger(), mr.Addr())
+	if err != nil {
+		t.Fatalf("NewRedisCache() error = %v", err)
+	}
+
+	// more than a batch
+	for i := 0; i < 2*batchSize+10; i++ {
+		k := strconv.Itoa(i)
+		items[k] = []byte("v" + k)
+		keys = append(keys, k)
+	}
+
+	if err := c.SetMulti(cx, items, time.Minute); err != nil {
+		t.Fatalf("SetMulti() error = %v", err)
+	}
+	if ttl := mr.TTL("7"); ttl != time.Minute {
+		t.Errorf("TTL() = %v, want a minute", ttl)
+	}
+
+	vals, err := c.GetMulti(cx, append(keys, "missing"))
+	if err != nil {
+		t.Fatalf("GetMulti() error = %v", err)
+	}
+
+	if _, ok := vals["missing"]; ok || len(vals) != len(items) || string(vals["42"]) != "v42" {
+		t.Errorf("GetMulti() = %d values, want %d without the missing one", len(vals), len(items))
+	}
+
+	mr.Close()
+
+	if _, err := c.GetMulti(cx, keys); err == nil {
+		t.Error("GetMulti() with redis down error = nil")
+	}
+	if err := c.SetMulti(cx, items, NOEXPIRE); err == nil {
+		t.Error("SetMulti() with redis down error = nil")
+	}
+}
+
+func TestNewRedisClusterCache(t *testing.T) {
+	var (
+		cx = context.Background()
+		mr = miniredis.RunT(t)
+	)
+
+	// miniredis serves a cluster of a single node
+	c, err := NewRedisClusterCache(log.NewNoopLogger(), []string{mr.Addr()}, WithOpTimeout(time.Second, time.Second))
+	if err != nil {
+		t.Fatalf("NewRedisClusterCache() error = %v", err)
+	}
+
+	c.Set(cx, "a", []byte("1"))
+	if err := c.SetMulti(cx, map[string][]byte{"b": []byte("2"), "c": []byte("3")}, NOEXPIRE); err != nil {
+		t.Fatalf("SetMulti() error = %v", err)
+	}
+
+	if v, found := c.Get(cx, "a"); !found || string(v) != "1" {
+		t.Errorf("Get() = %q, %v, want 1", v, found)
+	}
+
+	vals, err := c.GetMulti(cx, []string{"a", "b", "c", "missing"})
+	if err != nil || len(vals) != 3 || string(vals["c"]) != "3" {
+		t.Errorf("GetMulti() = %q, %v, want a, b & c", vals, err)
+	}
+
+	if v, err := c.IncrementWithDuration(cx, "hits", 2, time.Minute); err != nil || v != 2 {
+		t.Errorf("IncrementWithDuration() = %d, %v, want 2", v, err)
+	}
+
+	if _, err := NewRedisClusterCache(log.NewNoopLogger(), []string{"127.0.0.1:1"}); err == nil {
+		t.Error("NewRedisClusterCache() of no cluster error = nil")
+	}
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type (
+	// Codec encodes the values of a TypedCache to the bytes stored in the
+	// cache, see JSONCodec
+	Codec[T any] interface {
+		Marshal(v T) ([]byte, error)
+		Unmarshal(bt []byte) (T, error)
+	}
+
+	// JSONCodec encodes the values as JSON, the default of TypedCache
+	JSONCodec[T any] struct{}
+
+	// TypedCache stores values of T in a Cache, encoded with a Codec, so
+	// the callers neither encode nor assert. The Cache stays usable as
+	// is, e.g. for the keys of other types
+	TypedCache[T any] struct {
+		cache Cache
+		codec Codec[T]
+	}
+
+	// TypedCacheOption customises the TypedCache
+	TypedCacheOption[T any] func(*TypedCache[T])
+)
+
+// Marshal encodes v as JSON
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal decodes the JSON in bt
+func (JSONCodec[T]) Unmarshal(bt []byte) (v T, err error) {
+	err = json.Unmarshal(bt, &v)
+	return v, err
+}
+
+// WithCodec encodes the values with codec instead of JSON
+func WithCodec[T any](codec Codec[T]) TypedCacheOption[T] {
+	return func(tc *TypedCache[T]) { tc.codec = codec }
+}
+
+// NewTypedCache returns a TypedCache of T storing the values in c, e.g.
+//
+//	products := cache.NewTypedCache[Product](c)
+//	products.Set(cx, "sku-42", Product{Name: "shoe"})
+//	p, ok := products.Get(cx, "sku-42")
+func NewTypedCache[T any](c Cache, options ...TypedCacheOption[T]) *TypedCache[T] {
+	tc := &TypedCache[T]{cache: c, codec: JSONCodec[T]{}}
+
+	for _, o := range options {
+		o(tc)
+	}
+
+	return tc
+}
+
+// Cache returns the underlying cache
+func (tc *TypedCache[T]) Cache() Cache { return tc.cache }
+
+// Get returns the value of key, the zero value of T & false on a miss.
+// A value which doesn't decode is a miss
+func (tc *TypedCache[T]) Get(cx context.Context, key string) (v T, found bool) {
+	bt, found := tc.cache.Get(cx, key)
+	if !found {
+		return v, false
+	}
+
+	v, err := tc.codec.Unmarshal(bt)
+	if err != nil {
+		var zero T
+		return zero, false
+	}
+
+	return v, true
+}
+
+// Set stores v for key, replacing the existing one. It fails when v
+// doesn't encode
+func (tc *TypedCache[T]) Set(cx context.Context, key string, v T) error {
+	bt, err := tc.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tc.cache.Set(cx, key, bt)
+	return nil
+}
+
+// SetWithDuration stores v for key for the expiration
+func (tc *TypedCache[T]) SetWithDuration(cx context.Context, key string, v T, expiration time.Duration) error {
+	bt, err := tc.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tc.cache.SetWithDuration(cx, key, bt, expiration)
+	return nil
+}
+
+// Add stores v for key only if the key has no value, see Cache.Add
+func (tc *TypedCache[T]) Add(cx context.Context, key string, v T) error {
+	bt, err := tc.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tc.cache.Add(cx, key, bt)
+}
+
+// Replace stores v for key only if the key has a value, see
+// Cache.Replace
+func (tc *TypedCache[T]) Replace(cx context.Context, key string, v T) error {
+	bt, err := tc.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tc.cache.Replace(cx, key, bt)
+}
+
+// Delete deletes key
+func (tc *TypedCache[T]) Delete(cx context.Context, key string) {
+	tc.cache.Delete(cx, key)
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type product struct {
+	SKU   string  `json:"sku"`
+	Price float64 `json:"price"`
+}
+
+type priceCodec struct{}
+
+func (priceCodec) Marshal(v float64) ([]byte, error) {
+	return []byte(strconv.FormatFloat(v, 'f', -1, 64)), nil
+}
+
+func (priceCodec) Unmarshal(bt []byte) (float64, error) {
+	return strconv.ParseFloat(string(bt), 64)
+}
+
+func TestTypedCache(t *testing.T) {
+	cx := context.Background()
+	c, _ := NewInMemoryCache(time.Minute, time.Minute)
+
+	products := NewTypedCache[product](c)
+
+	if err := products.Set(cx, "sku-42", product{"sku-42", 9.5}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if p, ok := products.Get(cx, "sku-42"); !ok || p.Price != 9.5 {
+		t.Errorf("Get() = %+v, %v, want sku-42", p, ok)
+	}
+
+	if err := products.Add(cx, "sku-42", product{}); err == nil {
+		t.Error("Add() of an existing key error = nil")
+	}
+
+	// the untyped cache is still usable, a value which doesn't decode is
+	// a miss
+	c.Set(cx, "garbage", []byte("{"))
+	if p, ok := products.Get(cx, "garbage"); ok || p != (product{}) {
+		t.Errorf("Get() of garbage = %+v, %v, want the zero value", p, ok)
+	}
+
+	products.Delete(cx, "sku-42")
+	if _, ok := products.Get(cx, "sku-42"); ok {
+		t.Error("Get() after Delete() hit")
+	}
+
+	prices := NewTypedCache[float64](c, WithCodec[float64](priceCodec{}))
+	_ = prices.SetWithDuration(cx, "price", 12.25, time.Minute)
+
+	if bt, _ := c.Get(cx, "price"); string(bt) != "12.25" {
+		t.Errorf("stored price = %q, want encoded by the codec", bt)
+	}
+	if p, ok := prices.Get(cx, "price"); !ok || p != 12.25 {
+		t.Errorf("Get() = %v, %v, want 12.25", p, ok)
+	}
+}
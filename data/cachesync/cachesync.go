@@ -0,0 +1,408 @@
+// Package cachesync keeps the local caches of the replicas of a service
+// coherent over NATS. Writes through a Sync broadcast invalidations which
+// the other replicas apply to their cache, and a replica starting up can
+// warm its cache with the hot keys of a peer, see Sync.Warm.
+//
+// Delivery is best effort, NATS core drops messages when a replica is
+// disconnected or slow. The TTL of the cache stays the backstop against
+// stale entries, lost invalidations show up as sequence gaps in Stats.
+package cachesync
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/data/cache"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
+	"github.com/unbxd/go-base/v2/transport/nats"
+)
+
+const (
+	defaultSubject          = "cachesync"
+	defaultHotKeys          = 1024
+	defaultSnapshotMaxKeys  = 1024
+	defaultSnapshotMaxBytes = 512 << 10
+	defaultWarmTimeout      = 2 * time.Second
+
+	gapMetric = "cachesync.gap"
+)
+
+var (
+	// ErrNoPeers is returned by Warm when no peer sent a snapshot in time
+	ErrNoPeers = errors.New("cachesync: no peer responded with a snapshot")
+	// ErrNotOpen is returned by Warm when the NATS transport isn't open
+	ErrNotOpen = errors.New("cachesync: transport is not open")
+)
+
+type (
+	// Option customises the Sync
+	Option func(*Sync)
+
+	// Stats are the counters of a Sync
+	Stats struct {
+		// Sent & Received count the invalidations
+		Sent     uint64
+		Received uint64
+		// SelfIgnored counts own invalidations echoed back by NATS
+		SelfIgnored uint64
+		// Gaps counts the invalidations lost, going by the sequence
+		// numbers of the peers
+		Gaps uint64
+		// PublishErrors counts the broadcasts which failed
+		PublishErrors uint64
+	}
+
+	// Sync is a cache.Cache which broadcasts the writes made through it
+	// as invalidations to the peers and applies theirs to the local cache
+	Sync struct {
+		cache     cache.Cache
+		publisher *nats.Publisher
+		transport *nats.Transport
+		logger    log.Logger
+
+		id      string
+		subject string
+
+		hot              *hotKeys
+		hotMax           int
+		snapshotMaxKeys  int
+		snapshotMaxBytes int
+		warmTTL          time.Duration
+		warmTimeout      time.Duration
+
+		seq uint64
+
+		mu   sync.Mutex
+		last map[string]uint64 // last sequence seen per peer
+
+		// set while Warm waits for a snapshot
+		snapshots chan *snapshot
+
+		subscribers []nats.Subscriber
+
+		sent, received, selfIgnored, gaps, publishErrors uint64
+		gapCounter                                       metrics.Counter
+	}
+
+	invalidation struct {
+		Origin string `json:"origin"`
+		Seq    uint64 `json:"seq"`
+		Key    string `json:"key,omitempty"`
+		Prefix string `json:"prefix,omitempty"`
+	}
+)
+
+// WithSubject sets the subject the messages are exchanged on, replicas
+// of a service must share it. Defaults to `cachesync`
+func WithSubject(subject string) Option {
+	return func(s *Sync) { s.subject = subject }
+}
+
+// WithInstanceID sets the ID the replica is known by to its peers,
+// defaults to a random UUID
+func WithInstanceID(id string) Option {
+	return func(s *Sync) { s.id = id }
+}
+
+// WithLogger sets the logger, defaults to noop
+func WithLogger(logger log.Logger) Option {
+	return func(s *Sync) { s.logger = logger }
+}
+
+// WithHotKeys sets the number of hot keys tracked for the snapshot,
+// defaults to 1024
+func WithHotKeys(n int) Option {
+	return func(s *Sync) { s.hotMax = n }
+}
+
+// WithSnapshotLimits bounds the snapshot sent to a warming peer by the
+// number of keys & the total size of the values. Defaults to 1024 keys
+// and 512KiB, the snapshot must fit the max payload of NATS
+func WithSnapshotLimits(maxKeys, maxBytes int) Option {
+	return func(s *Sync) {
+		s.snapshotMaxKeys = maxKeys
+		s.snapshotMaxBytes = maxBytes
+	}
+}
+
+// WithWarmTimeout sets for how long Warm waits for a snapshot, defaults
+// to 2s
+func WithWarmTimeout(d time.Duration) Option {
+	return func(s *Sync) { s.warmTimeout = d }
+}
+
+// WithWarmTTL sets the expiry of the entries loaded by Warm, the default
+// expiry of the cache is used when not set
+func WithWarmTTL(d time.Duration) Option {
+	return func(s *Sync) { s.warmTTL = d }
+}
+
+// WithMetrics counts the lost invalidations as `cachesync.gap`
+func WithMetrics(provider metrics.Provider) Option {
+	return func(s *Sync) {
+		if provider != nil {
+			s.gapCounter = provider.NewCounter(gapMetric, 1)
+		}
+	}
+}
+
+func (s *Sync) invalidateSubject() string { return s.subject + ".invalidate" }
+
+// broadcast publishes the invalidation, failures are logged & counted,
+// the TTL takes care of the peers
+func (s *Sync) broadcast(cx context.Context, key, prefix string) {
+	inv := invalidation{
+		Origin: s.id,
+		Seq:    atomic.AddUint64(&s.seq, 1),
+		Key:    key,
+		Prefix: prefix,
+	}
+
+	// the write is done, a cancelled request shouldn't stop the broadcast
+	if err := s.publisher.Publish(context.WithoutCancel(cx), s.invalidateSubject(), inv); err != nil {
+		atomic.AddUint64(&s.publishErrors, 1)
+		s.logger.Error(
+			"cachesync: failed to broadcast invalidation",
+			log.String("key", key), log.String("prefix", prefix), log.Error(err),
+		)
+		return
+	}
+
+	atomic.AddUint64(&s.sent, 1)
+}
+
+// Set sets the value locally and invalidates the key on the peers
+func (s *Sync) Set(cx context.Context, key string, val []byte) {
+	s.cache.Set(cx, key, val)
+	s.broadcast(cx, key, "")
+}
+
+// Add adds the value locally and invalidates the key on the peers
+func (s *Sync) Add(cx context.Context, key string, val []byte) error {
+	if err := s.cache.Add(cx, key, val); err != nil {
+		return err
+	}
+
+	s.broadcast(cx, key, "")
+	return nil
+}
+
+// Replace replaces the value locally and invalidates the key on the peers
+func (s *Sync) Replace(cx context.Context, key string, val []byte) error {
+	if err := s.cache.Replace(cx, key, val); err != nil {
+		return err
+	}
+
+	s.broadcast(cx, key, "")
+	return nil
+}
+
+// SetWithDuration sets the value locally and invalidates the key on the
+// peers
+func (s *Sync) SetWithDuration(cx context.Context, key string, val []byte, exp time.Duration) {
+	s.cache.SetWithDuration(cx, key, val, exp)
+	s.broadcast(cx, key, "")
+}
+
+// Get reads the local cache, reads are tracked for the snapshot
+func (s *Sync) Get(cx context.Context, key string) ([]byte, bool) {
+	s.hot.Touch(key)
+	return s.cache.Get(cx, key)
+}
+
+// Delete deletes the key locally and on the peers
+func (s *Sync) Delete(cx context.Context, key string) {
+	s.cache.Delete(cx, key)
+	s.hot.Forget(key)
+	s.broadcast(cx, key, "")
+}
+
+// InvalidatePrefix deletes the keys with the prefix locally and on the
+// peers. Only caches which list their keys, like the in-memory cache,
+// support it, others ignore it
+func (s *Sync) InvalidatePrefix(cx context.Context, prefix string) {
+	s.deletePrefix(cx, prefix)
+	s.broadcast(cx, "", prefix)
+}
+
+func (s *Sync) deletePrefix(cx context.Context, prefix string) {
+	kc, ok := s.cache.(interface{ Keys() []string })
+	if !ok {
+		s.logger.Warn(
+			"cachesync: cache doesn't list keys, prefix invalidation ignored",
+			log.String("prefix", prefix),
+		)
+		return
+	}
+
+	for _, k := range kc.Keys() {
+		if strings.HasPrefix(k, prefix) {
+			s.cache.Delete(cx, k)
+			s.hot.Forget(k)
+		}
+	}
+}
+
+// Stats returns the counters
+func (s *Sync) Stats() Stats {
+	return Stats{
+		Sent:          atomic.LoadUint64(&s.sent),
+		Received:      atomic.LoadUint64(&s.received),
+		SelfIgnored:   atomic.LoadUint64(&s.selfIgnored),
+		Gaps:          atomic.LoadUint64(&s.gaps),
+		PublishErrors: atomic.LoadUint64(&s.publishErrors),
+	}
+}
+
+// ID returns the instance ID of the replica
+func (s *Sync) ID() string { return s.id }
+
+// sequence records the sequence of the peer and counts the gap since the
+// last one seen. Out of order messages don't count
+func (s *Sync) sequence(origin string, seq uint64) {
+	s.mu.Lock()
+	last, seen := s.last[origin]
+	if seq > last {
+		s.last[origin] = seq
+	}
+	s.mu.Unlock()
+
+	// the first message of a peer can't tell what was lost before
+	if !seen || seq <= last+1 {
+		return
+	}
+
+	gap := seq - last - 1
+	atomic.AddUint64(&s.gaps, gap)
+
+	if s.gapCounter != nil {
+		s.gapCounter.Add(float64(gap))
+	}
+}
+
+func (s *Sync) onInvalidation(cx context.Context, inv *invalidation) {
+	if inv.Origin == s.id {
+		atomic.AddUint64(&s.selfIgnored, 1)
+		return
+	}
+
+	atomic.AddUint64(&s.received, 1)
+	s.sequence(inv.Origin, inv.Seq)
+
+	switch {
+	case inv.Key != "":
+		s.cache.Delete(cx, inv.Key)
+		s.hot.Forget(inv.Key)
+	case inv.Prefix != "":
+		s.deletePrefix(cx, inv.Prefix)
+	}
+}
+
+func decodeJSON(newFn func() interface{}) nats.Decoder {
+	return func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+		v := newFn()
+		if err := json.Unmarshal(msg.Data, v); err != nil {
+			return nil, errors.Wrap(err, "cachesync: malformed message")
+		}
+		return v, nil
+	}
+}
+
+func (s *Sync) subscribe(subject string, dec nats.Decoder, fn func(context.Context, interface{})) error {
+	sub, err := s.transport.Subscribe(
+		nats.WithSubjectSubscriberOption(s.publisher.Subject(subject)),
+		nats.WithDecoderSubscriberOption(dec),
+		nats.WithId(s.id+"."+subject),
+		nats.WithEndpointSubscriberOption(func(cx context.Context, req interface{}) (interface{}, error) {
+			fn(cx, req)
+			return nil, nil
+		}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "cachesync: failed to subscribe to %s", subject)
+	}
+
+	s.subscribers = append(s.subscribers, sub)
+	return nil
+}
+
+// Close stops applying the invalidations & answering snapshot requests
+func (s *Sync) Close() error {
+	var errs []error
+	for _, sub := range s.subscribers {
+		if err := s.transport.Unsubscribe(sub.Id()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// New returns a Sync over the local cache c. Invalidations are published
+// with publisher and received through transport, both must reach the
+// same NATS & publisher must have the same subject prefix on all the
+// replicas. The subscriptions start with the transport, see
+// nats.Transport.Open
+func New(
+	publisher *nats.Publisher,
+	transport *nats.Transport,
+	c cache.Cache,
+	opts ...Option,
+) (*Sync, error) {
+	s := &Sync{
+		cache:            c,
+		publisher:        publisher,
+		transport:        transport,
+		logger:           log.NewNoopLogger(),
+		id:               uuid.NewString(),
+		subject:          defaultSubject,
+		hotMax:           defaultHotKeys,
+		snapshotMaxKeys:  defaultSnapshotMaxKeys,
+		snapshotMaxBytes: defaultSnapshotMaxBytes,
+		warmTimeout:      defaultWarmTimeout,
+		last:             make(map[string]uint64),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	s.hot = newHotKeys(s.hotMax)
+
+	// invalidations last, once they arrive the replica answers snapshots too
+	err := s.subscribe(
+		s.snapshotSubject(s.id),
+		decodeJSON(func() interface{} { return &snapshot{} }),
+		func(_ context.Context, req interface{}) { s.onSnapshot(req.(*snapshot)) },
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.subscribe(
+		s.snapshotRequestSubject(),
+		decodeJSON(func() interface{} { return &snapshotRequest{} }),
+		func(cx context.Context, req interface{}) { s.onSnapshotRequest(cx, req.(*snapshotRequest)) },
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.subscribe(
+		s.invalidateSubject(),
+		decodeJSON(func() interface{} { return &invalidation{} }),
+		func(cx context.Context, req interface{}) { s.onInvalidation(cx, req.(*invalidation)) },
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
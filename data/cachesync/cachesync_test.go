@@ -0,0 +1,260 @@
+package cachesync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/data/cache/inmem"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/transport/nats"
+)
+
+type (
+	replica struct {
+		*Sync
+		cache *inmem.Cache
+	}
+
+	// broker is an embedded nats-server, with a connection publishing
+	// as a peer would
+	broker struct {
+		*server.Server
+		conn *natn.Conn
+	}
+)
+
+func newBroker(t *testing.T) *broker {
+	t.Helper()
+
+	ns := natsserver.RunRandClientPortServer()
+	t.Cleanup(ns.Shutdown)
+
+	conn, err := natn.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(conn.Close)
+
+	return &broker{ns, conn}
+}
+
+func (b *broker) publish(t *testing.T, subject string, data []byte) {
+	t.Helper()
+
+	if err := b.conn.Publish(subject, data); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+// newReplica connects a Sync to the broker & waits for its subscriptions
+func newReplica(t *testing.T, nb *broker, id string, opts ...Option) *replica {
+	t.Helper()
+
+	pub, err := nats.NewPublisher(nb.ClientURL())
+	if err != nil {
+		t.Fatalf("publisher: %v", err)
+	}
+
+	tr, err := nats.NewTransport(
+		make(chan struct{}),
+		nats.WithServers([]string{nb.ClientURL()}),
+		nats.WithLogging(log.NewNoopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("transport: %v", err)
+	}
+	if err := tr.Open(); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	c := inmem.New(time.Minute, time.Minute)
+	s, err := New(pub, tr, c, append([]Option{WithInstanceID(id)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	t.Cleanup(func() { _ = s.Close() })
+
+	// the invalidations are subscribed last, a probe getting through means
+	// the subscriptions are in place
+	c.Set(context.Background(), "probe", []byte("1"))
+	data, _ := json.Marshal(invalidation{Origin: "probe", Key: "probe"})
+	eventually(t, func() bool {
+		nb.publish(t, pub.Subject(s.invalidateSubject()), data)
+		time.Sleep(time.Millisecond)
+		_, ok := c.Get(context.Background(), "probe")
+		return !ok
+	})
+
+	return &replica{s, c}
+}
+
+func eventually(t *testing.T, fn func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInvalidationPropagates(t *testing.T) {
+	var (
+		cx = context.Background()
+		nb = newBroker(t)
+		a  = newReplica(t, nb, "a")
+		b  = newReplica(t, nb, "b")
+	)
+
+	b.cache.Set(cx, "k1", []byte("stale"))
+
+	// the probes of newReplica are counted too
+	aRecv, bRecv := a.Stats().Received, b.Stats().Received
+
+	start := time.Now()
+	a.Set(cx, "k1", []byte("fresh"))
+
+	eventually(t, func() bool {
+		_, ok := b.cache.Get(cx, "k1")
+		return !ok
+	})
+	t.Logf("propagated in %s", time.Since(start))
+
+	if val, _ := a.Get(cx, "k1"); string(val) != "fresh" {
+		t.Errorf("a.Get = %q, want fresh", val)
+	}
+
+	// self-originated messages are echoed back by NATS & ignored
+	eventually(t, func() bool { return a.Stats().SelfIgnored == 1 })
+	if st := a.Stats(); st.Sent != 1 || st.Received != aRecv {
+		t.Errorf("a stats = %+v, want 1 sent & nothing received", st)
+	}
+	if st := b.Stats(); st.Received != bRecv+1 {
+		t.Errorf("b stats = %+v, want 1 received", st)
+	}
+}
+
+func TestInvalidatePrefix(t *testing.T) {
+	var (
+		cx = context.Background()
+		nb = newBroker(t)
+		a  = newReplica(t, nb, "a")
+		b  = newReplica(t, nb, "b")
+	)
+
+	for _, k := range []string{"user:1", "user:2", "product:1"} {
+		b.cache.Set(cx, k, []byte("v"))
+	}
+
+	a.InvalidatePrefix(cx, "user:")
+
+	eventually(t, func() bool {
+		_, ok1 := b.cache.Get(cx, "user:1")
+		_, ok2 := b.cache.Get(cx, "user:2")
+		return !ok1 && !ok2
+	})
+
+	if _, ok := b.cache.Get(cx, "product:1"); !ok {
+		t.Errorf("product:1 shouldn't be invalidated")
+	}
+}
+
+func TestSequenceGaps(t *testing.T) {
+	var (
+		nb = newBroker(t)
+		a  = newReplica(t, nb, "a")
+	)
+
+	recv := a.Stats().Received
+
+	subject := a.publisher.Subject(a.invalidateSubject())
+	for _, seq := range []uint64{1, 2, 5, 4, 6} {
+		data, _ := json.Marshal(invalidation{Origin: "peer", Seq: seq, Key: "k"})
+		nb.publish(t, subject, data)
+	}
+
+	// 3 & 4 were skipped between 2 & 5, 4 arriving late doesn't count
+	eventually(t, func() bool { return a.Stats().Received == recv+5 })
+	if gaps := a.Stats().Gaps; gaps != 2 {
+		t.Errorf("gaps = %d, want 2", gaps)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	var (
+		cx = context.Background()
+		nb = newBroker(t)
+		a  = newReplica(t, nb, "a", WithSnapshotLimits(3, 1<<10))
+	)
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		a.cache.Set(cx, key, []byte(key))
+
+		// k0 is the hottest
+		for j := 0; j < 10-i; j++ {
+			a.Get(cx, key)
+		}
+	}
+
+	b := newReplica(t, nb, "b", WithWarmTimeout(time.Second))
+
+	n, err := b.Warm(cx)
+	if err != nil {
+		t.Fatalf("Warm: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Warm loaded %d keys, want 3", n)
+	}
+
+	for _, k := range []string{"k0", "k1", "k2"} {
+		if val, ok := b.cache.Get(cx, k); !ok || string(val) != k {
+			t.Errorf("b.Get(%s) = %q, %v after warm", k, val, ok)
+		}
+	}
+
+	// warming doesn't broadcast
+	if st := b.Stats(); st.Sent != 0 {
+		t.Errorf("b sent %d invalidations while warming", st.Sent)
+	}
+}
+
+func TestWarmNoPeers(t *testing.T) {
+	var (
+		nb = newBroker(t)
+		a  = newReplica(t, nb, "a", WithWarmTimeout(50*time.Millisecond))
+	)
+
+	if _, err := a.Warm(context.Background()); !errors.Is(err, ErrNoPeers) {
+		t.Errorf("Warm error = %v, want ErrNoPeers", err)
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	hk := newHotKeys(2)
+
+	for i, k := range []string{"a", "b", "c"} {
+		for j := 0; j < (i+1)*5; j++ {
+			hk.Touch(k)
+		}
+	}
+
+	if top := hk.Top(); len(top) != 2 || top[0] != "c" || top[1] != "b" {
+		t.Errorf("Top = %v, want [c b]", top)
+	}
+
+	hk.Forget("c")
+	if top := hk.Top(); len(top) != 1 || top[0] != "b" {
+		t.Errorf("Top after Forget = %v, want [b]", top)
+	}
+}
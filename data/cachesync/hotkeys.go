@@ -0,0 +1,172 @@
+package cachesync
+
+import (
+	"container/heap"
+	"hash/maphash"
+	"sort"
+	"sync"
+)
+
+const sketchDepth = 4
+
+type (
+	// hotKeys tracks the most frequently read keys in bounded memory, a
+	// count-min sketch estimates the frequency of every key & a min-heap
+	// keeps the top ones. Counts are halved periodically, so keys which
+	// were hot a while back fade out (as in TinyLFU)
+	hotKeys struct {
+		mu sync.Mutex
+
+		seed  maphash.Seed
+		mask  uint64
+		rows  [sketchDepth][]uint32
+		incrs int
+		reset int
+
+		top topHeap
+		ix  map[string]*hotKey
+		max int
+	}
+
+	hotKey struct {
+		key   string
+		count uint32
+		pos   int
+	}
+
+	topHeap []*hotKey
+)
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h topHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos, h[j].pos = i, j
+}
+func (h *topHeap) Push(x interface{}) {
+	hk := x.(*hotKey)
+	hk.pos = len(*h)
+	*h = append(*h, hk)
+}
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	hk := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return hk
+}
+
+func newHotKeys(max int) *hotKeys {
+	width := 64
+	for width < max*8 {
+		width <<= 1
+	}
+
+	hk := &hotKeys{
+		seed:  maphash.MakeSeed(),
+		mask:  uint64(width - 1),
+		reset: width * 10,
+		ix:    make(map[string]*hotKey, max),
+		max:   max,
+	}
+
+	for i := range hk.rows {
+		hk.rows[i] = make([]uint32, width)
+	}
+	return hk
+}
+
+// incr counts a read of key and returns its estimated frequency
+func (hk *hotKeys) incr(key string) uint32 {
+	var (
+		h      = maphash.String(hk.seed, key)
+		h1, h2 = h, h>>32 | 1
+		est    = ^uint32(0)
+	)
+
+	for i := range hk.rows {
+		c := &hk.rows[i][(h1+uint64(i)*h2)&hk.mask]
+		if *c < ^uint32(0) {
+			*c++
+		}
+		if *c < est {
+			est = *c
+		}
+	}
+	return est
+}
+
+func (hk *hotKeys) age() {
+	for i := range hk.rows {
+		for j := range hk.rows[i] {
+			hk.rows[i][j] >>= 1
+		}
+	}
+
+	for _, k := range hk.top {
+		k.count >>= 1
+	}
+	heap.Init(&hk.top)
+	hk.incrs = 0
+}
+
+// Touch records a read of key
+func (hk *hotKeys) Touch(key string) {
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+
+	if hk.incrs++; hk.incrs >= hk.reset {
+		hk.age()
+	}
+
+	est := hk.incr(key)
+
+	if k, ok := hk.ix[key]; ok {
+		k.count = est
+		heap.Fix(&hk.top, k.pos)
+		return
+	}
+
+	if len(hk.top) < hk.max {
+		k := &hotKey{key: key, count: est}
+		heap.Push(&hk.top, k)
+		hk.ix[key] = k
+		return
+	}
+
+	if min := hk.top[0]; est > min.count {
+		delete(hk.ix, min.key)
+		min.key, min.count = key, est
+		hk.ix[key] = min
+		heap.Fix(&hk.top, 0)
+	}
+}
+
+// Forget drops key, e.g. once it is deleted
+func (hk *hotKeys) Forget(key string) {
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+
+	if k, ok := hk.ix[key]; ok {
+		heap.Remove(&hk.top, k.pos)
+		delete(hk.ix, key)
+	}
+}
+
+// Top returns the tracked keys, hottest first
+func (hk *hotKeys) Top() []string {
+	hk.mu.Lock()
+	top := make([]*hotKey, len(hk.top))
+	for i, k := range hk.top {
+		cp := *k
+		top[i] = &cp
+	}
+	hk.mu.Unlock()
+
+	sort.Slice(top, func(i, j int) bool { return top[i].count > top[j].count })
+
+	keys := make([]string, len(top))
+	for i, k := range top {
+		keys[i] = k.key
+	}
+	return keys
+}
@@ -0,0 +1,149 @@
+package cachesync
+
+import (
+	"context"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+type (
+	snapshotRequest struct {
+		Origin string `json:"origin"`
+	}
+
+	snapshotEntry struct {
+		Key   string `json:"key"`
+		Value []byte `json:"value"`
+	}
+
+	snapshot struct {
+		Origin  string          `json:"origin"`
+		Entries []snapshotEntry `json:"entries"`
+	}
+)
+
+func (s *Sync) snapshotRequestSubject() string { return s.subject + ".snapshot.request" }
+
+func (s *Sync) snapshotSubject(id string) string { return s.subject + ".snapshot." + id }
+
+// snapshot reads the hot keys still in the cache, hottest first, within
+// the limits
+func (s *Sync) snapshot(cx context.Context) []snapshotEntry {
+	var (
+		entries []snapshotEntry
+		size    int
+	)
+
+	for _, k := range s.hot.Top() {
+		if len(entries) >= s.snapshotMaxKeys {
+			break
+		}
+
+		val, ok := s.cache.Get(cx, k)
+		if !ok {
+			continue
+		}
+
+		if size += len(k) + len(val); size > s.snapshotMaxBytes {
+			break
+		}
+
+		entries = append(entries, snapshotEntry{k, val})
+	}
+	return entries
+}
+
+func (s *Sync) onSnapshotRequest(cx context.Context, req *snapshotRequest) {
+	if req.Origin == s.id {
+		return
+	}
+
+	// a peer with nothing to offer stays quiet, the others may have
+	entries := s.snapshot(cx)
+	if len(entries) == 0 {
+		return
+	}
+
+	err := s.publisher.Publish(
+		cx, s.snapshotSubject(req.Origin), snapshot{s.id, entries},
+	)
+	if err != nil {
+		s.logger.Error(
+			"cachesync: failed to send snapshot",
+			log.String("peer", req.Origin), log.Error(err),
+		)
+	}
+}
+
+func (s *Sync) onSnapshot(snap *snapshot) {
+	s.mu.Lock()
+	ch := s.snapshots
+	s.mu.Unlock()
+
+	if ch == nil {
+		return
+	}
+
+	// only the first snapshot is used
+	select {
+	case ch <- snap:
+	default:
+	}
+}
+
+// Warm asks the peers for their hot keys & loads the first snapshot to
+// arrive into the local cache, it returns the number of keys loaded.
+// Loaded keys aren't broadcast. ErrNoPeers is returned when no peer
+// answers within the warm timeout, e.g. for the first replica to start,
+// which is safe to ignore.
+// Call it once the transport is open & before serving traffic
+func (s *Sync) Warm(cx context.Context) (int, error) {
+	for _, sub := range s.subscribers {
+		if !sub.IsValid() {
+			return 0, ErrNotOpen
+		}
+	}
+
+	ch := make(chan *snapshot, 1)
+
+	s.mu.Lock()
+	s.snapshots = ch
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.snapshots = nil
+		s.mu.Unlock()
+	}()
+
+	if err := s.publisher.Publish(
+		cx, s.snapshotRequestSubject(), snapshotRequest{s.id},
+	); err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(s.warmTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-cx.Done():
+		return 0, cx.Err()
+	case <-timer.C:
+		return 0, ErrNoPeers
+	case snap := <-ch:
+		for _, e := range snap.Entries {
+			if s.warmTTL > 0 {
+				s.cache.SetWithDuration(cx, e.Key, e.Value, s.warmTTL)
+			} else {
+				s.cache.Set(cx, e.Key, e.Value)
+			}
+		}
+
+		s.logger.Info(
+			"cachesync: warmed cache from peer",
+			log.String("peer", snap.Origin), log.Int("keys", len(snap.Entries)),
+		)
+		return len(snap.Entries), nil
+	}
+}
@@ -0,0 +1,121 @@
+// Package ctxvet checks in tests that caches & drivers give up on an
+// operation once its context is done, e.g.
+//
+//	c := ctxvet.Cache(t, cache, 10*time.Millisecond)
+//
+//	cx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+//	defer cancel()
+//	c.Get(cx, "key") // fails t if Get runs 10ms past the timeout
+package ctxvet
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/cache"
+	"github.com/unbxd/go-base/v2/data/driver"
+)
+
+type (
+	// T is the part of testing.TB used to report
+	T interface {
+		Helper()
+		Errorf(format string, args ...interface{})
+	}
+
+	checker struct {
+		t         T
+		tolerance time.Duration
+	}
+
+	vetCache struct {
+		checker
+		cache.Cache
+	}
+
+	vetDriver struct {
+		checker
+		driver.Driver
+	}
+)
+
+// watch starts watching op, the returned func reports it if it ran past
+// its context by more than the tolerance
+func (ck checker) watch(cx context.Context, op string) func() {
+	var doneAt atomic.Int64
+	stop := context.AfterFunc(cx, func() { doneAt.Store(time.Now().UnixNano()) })
+
+	return func() {
+		stop()
+
+		if at := doneAt.Load(); at != 0 {
+			if over := time.Since(time.Unix(0, at)); over > ck.tolerance {
+				ck.t.Helper()
+				ck.t.Errorf("ctxvet: %s outlived its context by %v (tolerance %v)", op, over, ck.tolerance)
+			}
+		}
+	}
+}
+
+// Cache returns c failing t when an operation returns more than tolerance
+// after its context is done
+func Cache(t T, c cache.Cache, tolerance time.Duration) cache.Cache {
+	return &vetCache{checker{t, tolerance}, c}
+}
+
+func (vc *vetCache) Set(cx context.Context, key string, val []byte) {
+	defer vc.watch(cx, "Set "+key)()
+	vc.Cache.Set(cx, key, val)
+}
+
+func (vc *vetCache) Add(cx context.Context, key string, val []byte) error {
+	defer vc.watch(cx, "Add "+key)()
+	return vc.Cache.Add(cx, key, val)
+}
+
+func (vc *vetCache) Replace(cx context.Context, key string, val []byte) error {
+	defer vc.watch(cx, "Replace "+key)()
+	return vc.Cache.Replace(cx, key, val)
+}
+
+func (vc *vetCache) SetWithDuration(cx context.Context, key string, val []byte, expiration time.Duration) {
+	defer vc.watch(cx, "SetWithDuration "+key)()
+	vc.Cache.SetWithDuration(cx, key, val, expiration)
+}
+
+func (vc *vetCache) Get(cx context.Context, key string) ([]byte, bool) {
+	defer vc.watch(cx, "Get "+key)()
+	return vc.Cache.Get(cx, key)
+}
+
+func (vc *vetCache) Delete(cx context.Context, key string) {
+	defer vc.watch(cx, "Delete "+key)()
+	vc.Cache.Delete(cx, key)
+}
+
+// Driver returns d failing t when an operation taking a context returns
+// more than tolerance after the context is done
+func Driver(t T, d driver.Driver, tolerance time.Duration) driver.Driver {
+	return &vetDriver{checker{t, tolerance}, d}
+}
+
+func (vd *vetDriver) ReadContext(cx context.Context, path string) ([]byte, error) {
+	defer vd.watch(cx, "ReadContext "+path)()
+	return vd.Driver.ReadContext(cx, path)
+}
+
+func (vd *vetDriver) WriteContext(cx context.Context, path string, data []byte) error {
+	defer vd.watch(cx, "WriteContext "+path)()
+	return vd.Driver.WriteContext(cx, path, data)
+}
+
+func (vd *vetDriver) ChildrenContext(cx context.Context, path string) ([]string, error) {
+	defer vd.watch(cx, "ChildrenContext "+path)()
+	return vd.Driver.ChildrenContext(cx, path)
+}
+
+func (vd *vetDriver) DeleteContext(cx context.Context, path string) error {
+	defer vd.watch(cx, "DeleteContext "+path)()
+	return vd.Driver.DeleteContext(cx, path)
+}
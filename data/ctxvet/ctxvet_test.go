@@ -0,0 +1,74 @@
+package ctxvet
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/cache"
+	"github.com/unbxd/go-base/v2/data/cache/inmem"
+)
+
+type recorder struct{ errs []string }
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+// slowCache ignores the context of Get
+type slowCache struct{ cache.Cache }
+
+func (sc slowCache) Get(cx context.Context, key string) ([]byte, bool) {
+	time.Sleep(100 * time.Millisecond)
+	return sc.Cache.Get(cx, key)
+}
+
+func TestCache(t *testing.T) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	mem, _ := cache.NewInMemoryCache(time.Minute, time.Minute, inmem.WithOnEvictCallback(
+		func(string, []byte) { <-blocked },
+	))
+	mem.Set(context.Background(), "k", []byte("v"))
+
+	tests := []struct {
+		name    string
+		c       cache.Cache
+		op      func(cx context.Context, c cache.Cache)
+		flagged bool
+	}{
+		{
+			name:    "ignores context",
+			c:       slowCache{mem},
+			op:      func(cx context.Context, c cache.Cache) { c.Get(cx, "k") },
+			flagged: true,
+		},
+		{
+			name: "blocking evict callback",
+			c:    mem,
+			op:   func(cx context.Context, c cache.Cache) { c.Delete(cx, "k") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rec = &recorder{}
+				c   = Cache(rec, tt.c, 20*time.Millisecond)
+			)
+
+			cx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			tt.op(cx, c)
+
+			if flagged := len(rec.errs) > 0; flagged != tt.flagged {
+				t.Errorf("flagged = %v (%q), want %v", flagged, rec.errs, tt.flagged)
+			}
+		})
+	}
+}
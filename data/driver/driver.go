@@ -1,22 +1,41 @@
 package driver
 
+import "context"
+
 // Driver defines an interface for reading/writing data
 // to data source
 type Driver interface {
 	// Open opens the driver
 	Open() error
+	// ReadContext reads the node from unix like tree path
+	ReadContext(cx context.Context, path string) ([]byte, error)
+	// WriteContext writes to designated location
+	WriteContext(cx context.Context, path string, data []byte) error
+	// ChildrenContext returns the list of children for a path
+	ChildrenContext(cx context.Context, path string) ([]string, error)
+	// DeleteContext deletes the node in path
+	DeleteContext(cx context.Context, path string) error
+	// Watch gets the value and watches for future changes
+	Watch(path string) ([]byte, <-chan *Event, error)
+	// Watch gets the children and watches for future changes
+	WatchChildren(path string) ([]string, <-chan *Event, error)
+	// Close shuts down the connection for the driver
+	Close() error
+
 	// Read reads the node from unix like tree path
+	//
+	// Deprecated: use ReadContext, the read can't be cancelled
 	Read(path string) ([]byte, error)
 	// Write writes to designated location
+	//
+	// Deprecated: use WriteContext, the write can't be cancelled
 	Write(path string, data []byte) error
 	// Children returns the list of children for a path
+	//
+	// Deprecated: use ChildrenContext, the call can't be cancelled
 	Children(path string) ([]string, error)
 	// Delete deletes the node in path
+	//
+	// Deprecated: use DeleteContext, the delete can't be cancelled
 	Delete(path string) error
-	// Watch gets the value and watches for future changes
-	Watch(path string) ([]byte, <-chan *Event, error)
-	// Watch gets the children and watches for future changes
-	WatchChildren(path string) ([]string, <-chan *Event, error)
-	// Close shuts down the connection for the driver
-	Close() error
 }
@@ -0,0 +1,438 @@
+// Package inmem is a driver keeping the tree in memory, for the tools &
+// the tests which have no zookeeper. It follows the zook driver: writes
+// create the missing parents with "{}", deletes are recursive & the
+// watches behave the same, see Driver.Watch
+package inmem
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/unbxd/go-base/v2/data/driver"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Errors of the in-memory driver
+var (
+	ErrInvalidPath  = errors.New("invalid path, must be absolute & clean")
+	ErrNodeNotFound = errors.New("node not found")
+	ErrDeleteRoot   = errors.New("root node can't be deleted")
+	ErrDriverClosed = errors.New("driver is closed")
+)
+
+type (
+	node struct {
+		data     []byte
+		children map[string]struct{}
+
+		// closed & replaced on every change, closed when the node is
+		// deleted, the watches wait on them
+		changed         chan struct{}
+		childrenChanged chan struct{}
+	}
+
+	// Driver keeps the nodes in a map, by path
+	Driver struct {
+		mu    sync.RWMutex
+		nodes map[string]*node
+
+		seeds []func() (map[string][]byte, error)
+
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+
+	DriverOption func(*Driver)
+)
+
+func newNode(data []byte) *node {
+	return &node{
+		data:            data,
+		children:        make(map[string]struct{}),
+		changed:         make(chan struct{}),
+		childrenChanged: make(chan struct{}),
+	}
+}
+
+func signal(ch *chan struct{}) {
+	close(*ch)
+	*ch = make(chan struct{})
+}
+
+func clone(data []byte) []byte { return append([]byte(nil), data...) }
+
+func valid(p string) error {
+	if p == "/" || (strings.HasPrefix(p, "/") && path.Clean(p) == p) {
+		return nil
+	}
+	return errors.Wrap(ErrInvalidPath, p)
+}
+
+func (d *Driver) check(cx context.Context, p string) error {
+	if err := cx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case <-d.done:
+		return ErrDriverClosed
+	default:
+	}
+	return valid(p)
+}
+
+// Open seeds the tree with the data of the options, later seeds overwrite
+// the nodes of the earlier ones
+func (d *Driver) Open() error {
+	for _, seed := range d.seeds {
+		data, err := seed()
+		if err != nil {
+			return err
+		}
+
+		paths := make([]string, 0, len(data))
+		for p := range data {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		for _, p := range paths {
+			if err := d.WriteContext(context.Background(), p, data[p]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadContext returns the data of the node, ErrNodeNotFound if there is none
+func (d *Driver) ReadContext(cx context.Context, p string) ([]byte, error) {
+	if err := d.check(cx, p); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	n, ok := d.nodes[p]
+	if !ok {
+		return nil, errors.Wrap(ErrNodeNotFound, p)
+	}
+	return clone(n.data), nil
+}
+
+// create adds the node & its missing parents, with "{}" as data
+func (d *Driver) create(p string) *node {
+	n := newNode([]byte("{}"))
+	d.nodes[p] = n
+
+	dir, name := path.Split(p)
+	if dir != "/" {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+
+	parent, ok := d.nodes[dir]
+	if !ok {
+		parent = d.create(dir)
+	}
+
+	parent.children[name] = struct{}{}
+	signal(&parent.childrenChanged)
+	return n
+}
+
+// WriteContext sets the data of the node, creating the missing nodes of
+// the path
+func (d *Driver) WriteContext(cx context.Context, p string, data []byte) error {
+	if err := d.check(cx, p); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n, ok := d.nodes[p]
+	if !ok {
+		n = d.create(p)
+	}
+
+	n.data = clone(data)
+	signal(&n.changed)
+	return nil
+}
+
+func (d *Driver) children(n *node) []string {
+	children := make([]string, 0, len(n.children))
+	for name := range n.children {
+		children = append(children, name)
+	}
+	sort.Strings(children)
+	return children
+}
+
+// ChildrenContext returns the names of the children of the node, sorted
+func (d *Driver) ChildrenContext(cx context.Context, p string) ([]string, error) {
+	if err := d.check(cx, p); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	n, ok := d.nodes[p]
+	if !ok {
+		return nil, errors.Wrap(ErrNodeNotFound, p)
+	}
+	return d.children(n), nil
+}
+
+func (d *Driver) remove(p string, n *node) {
+	for name := range n.children {
+		child := path.Join(p, name)
+		d.remove(child, d.nodes[child])
+	}
+
+	delete(d.nodes, p)
+	close(n.changed)
+	close(n.childrenChanged)
+}
+
+// DeleteContext deletes the node & all its children
+func (d *Driver) DeleteContext(cx context.Context, p string) error {
+	if err := d.check(cx, p); err != nil {
+		return err
+	}
+
+	if p == "/" {
+		return ErrDeleteRoot
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n, ok := d.nodes[p]
+	if !ok {
+		return errors.Wrap(ErrNodeNotFound, p)
+	}
+
+	d.remove(p, n)
+
+	dir, name := path.Split(p)
+	if dir != "/" {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+
+	parent := d.nodes[dir]
+	delete(parent.children, name)
+	signal(&parent.childrenChanged)
+	return nil
+}
+
+// watch sends an event for every change signalled on the channel picked
+// by ch, until the node is deleted or the driver closed. changed is the
+// channel of n, taken with the lock held
+func (d *Driver) watch(
+	p string,
+	n *node,
+	changed <-chan struct{},
+	ch func(*node) <-chan struct{},
+	event func(*node) *driver.Event,
+	out chan *driver.Event,
+) {
+	defer close(out)
+
+	for {
+		select {
+		case <-changed:
+		case <-d.done:
+			return
+		}
+
+		d.mu.RLock()
+		cur, ok := d.nodes[p]
+		if !ok {
+			d.mu.RUnlock()
+			return
+		}
+
+		ev := event(cur)
+		if cur != n {
+			// deleted & created again before the watch was set again
+			ev.Type, n = driver.EventDeleted, cur
+		}
+		changed = ch(cur)
+		d.mu.RUnlock()
+
+		select {
+		case out <- ev:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// Watch returns the data of the node & a channel getting an
+// EventDataChanged with the new data for every write. Like zook, the
+// changes made while the last event isn't received yet are sent as one &
+// the channel is closed once the node is deleted, or the driver closed.
+// A node deleted & created again between two events sends an
+// EventDeleted with the data of the new node
+func (d *Driver) Watch(p string) ([]byte, <-chan *driver.Event, error) {
+	if err := d.check(context.Background(), p); err != nil {
+		return nil, nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	n, ok := d.nodes[p]
+	if !ok {
+		return nil, nil, errors.Wrap(ErrNodeNotFound, p)
+	}
+
+	out := make(chan *driver.Event)
+	go d.watch(
+		p, n, n.changed,
+		func(n *node) <-chan struct{} { return n.changed },
+		func(n *node) *driver.Event {
+			return &driver.Event{Type: driver.EventDataChanged, P: p, D: clone(n.data)}
+		},
+		out,
+	)
+	return clone(n.data), out, nil
+}
+
+// WatchChildren returns the children of the node & a channel getting an
+// EventChildrenChanged with the new children whenever one is created or
+// deleted, the rest is the same as Watch
+func (d *Driver) WatchChildren(p string) ([]string, <-chan *driver.Event, error) {
+	if err := d.check(context.Background(), p); err != nil {
+		return nil, nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	n, ok := d.nodes[p]
+	if !ok {
+		return nil, nil, errors.Wrap(ErrNodeNotFound, p)
+	}
+
+	out := make(chan *driver.Event)
+	go d.watch(
+		p, n, n.childrenChanged,
+		func(n *node) <-chan struct{} { return n.childrenChanged },
+		func(n *node) *driver.Event {
+			return &driver.Event{Type: driver.EventChildrenChanged, P: p, D: d.children(n)}
+		},
+		out,
+	)
+	return d.children(n), out, nil
+}
+
+// Close closes the channels of the watches, the driver can't be used after
+func (d *Driver) Close() error {
+	d.closeOnce.Do(func() { close(d.done) })
+	return nil
+}
+
+// Read reads the data of the node
+//
+// Deprecated: use ReadContext
+func (d *Driver) Read(p string) ([]byte, error) {
+	return d.ReadContext(context.Background(), p)
+}
+
+// Write writes the data of the node
+//
+// Deprecated: use WriteContext
+func (d *Driver) Write(p string, data []byte) error {
+	return d.WriteContext(context.Background(), p, data)
+}
+
+// Children returns the children of the node
+//
+// Deprecated: use ChildrenContext
+func (d *Driver) Children(p string) ([]string, error) {
+	return d.ChildrenContext(context.Background(), p)
+}
+
+// Delete deletes the node & all its children
+//
+// Deprecated: use DeleteContext
+func (d *Driver) Delete(p string) error {
+	return d.DeleteContext(context.Background(), p)
+}
+
+// WithData seeds the tree with the nodes in data, by path
+func WithData(data map[string][]byte) DriverOption {
+	return func(d *Driver) {
+		d.seeds = append(d.seeds, func() (map[string][]byte, error) {
+			return data, nil
+		})
+	}
+}
+
+// WithJSON seeds the tree with a JSON object of the nodes by path, e.g. a
+// config embedded in the binary. A string is the data as is, any other
+// value its JSON
+//
+//	{"/config/app": {"workers": 4}, "/config/name": "indexer"}
+func WithJSON(data []byte) DriverOption {
+	return func(d *Driver) {
+		d.seeds = append(d.seeds, func() (map[string][]byte, error) {
+			return decode(data)
+		})
+	}
+}
+
+// WithFile seeds the tree with the JSON file, in the format of WithJSON,
+// read by Open
+func WithFile(name string) DriverOption {
+	return func(d *Driver) {
+		d.seeds = append(d.seeds, func() (map[string][]byte, error) {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return nil, errors.Wrap(err, "read seed file failed")
+			}
+			return decode(data)
+		})
+	}
+}
+
+func decode(data []byte) (map[string][]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "decode seed failed")
+	}
+
+	nodes := make(map[string][]byte, len(raw))
+	for p, val := range raw {
+		var str string
+		if json.Unmarshal(val, &str) == nil {
+			nodes[p] = []byte(str)
+			continue
+		}
+		nodes[p] = val
+	}
+	return nodes, nil
+}
+
+// NewInMemoryDriver returns a driver with only the root node, seeded by the
+// options on Open
+func NewInMemoryDriver(options ...DriverOption) driver.Driver {
+	d := &Driver{
+		nodes: map[string]*node{"/": newNode(nil)},
+		done:  make(chan struct{}),
+	}
+
+	for _, fn := range options {
+		fn(d)
+	}
+	return d
+}
@@ -0,0 +1,189 @@
+package inmem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/driver"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+func next(t *testing.T, ch <-chan *driver.Event) (*driver.Event, bool) {
+	t.Helper()
+
+	select {
+	case ev, ok := <-ch:
+		return ev, ok
+	case <-time.After(time.Second):
+		t.Fatal("no event in 1s")
+		return nil, false
+	}
+}
+
+func TestDriver(t *testing.T) {
+	var (
+		cx = context.Background()
+		d  = NewInMemoryDriver()
+	)
+	defer d.Close()
+
+	if err := d.WriteContext(cx, "/a/b/c", []byte("c")); err != nil {
+		t.Fatalf("WriteContext() error = %v", err)
+	}
+
+	// parents are created with "{}", like zook
+	if got, _ := d.ReadContext(cx, "/a/b"); string(got) != "{}" {
+		t.Errorf("ReadContext(/a/b) = %s, want {}", got)
+	}
+
+	_ = d.WriteContext(cx, "/a/a", nil)
+	if got, _ := d.ChildrenContext(cx, "/a"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("ChildrenContext(/a) = %v, want [a b]", got)
+	}
+
+	if err := d.DeleteContext(cx, "/a"); err != nil {
+		t.Fatalf("DeleteContext() error = %v", err)
+	}
+
+	if _, err := d.ReadContext(cx, "/a/b/c"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("ReadContext() after delete error = %v, want %v", err, ErrNodeNotFound)
+	}
+
+	for _, p := range []string{"a", "/a/", "/a//b"} {
+		if err := d.WriteContext(cx, p, nil); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("WriteContext(%q) error = %v, want %v", p, err, ErrInvalidPath)
+		}
+	}
+
+	if err := d.DeleteContext(cx, "/"); err != ErrDeleteRoot {
+		t.Errorf("DeleteContext(/) error = %v, want %v", err, ErrDeleteRoot)
+	}
+}
+
+func TestDriver_Watch(t *testing.T) {
+	var (
+		cx = context.Background()
+		d  = NewInMemoryDriver(WithData(map[string][]byte{"/config": []byte("v1")}))
+	)
+	defer d.Close()
+
+	if err := d.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if _, _, err := d.Watch("/missing"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Watch(/missing) error = %v, want %v", err, ErrNodeNotFound)
+	}
+
+	val, ch, err := d.Watch("/config")
+	if err != nil || string(val) != "v1" {
+		t.Fatalf("Watch() = %s, %v, want v1", val, err)
+	}
+
+	_ = d.WriteContext(cx, "/config", []byte("v2"))
+	if ev, _ := next(t, ch); ev.Type != driver.EventDataChanged || string(ev.D.([]byte)) != "v2" {
+		t.Errorf("event = %v %s, want %v v2", ev.Type, ev.D, driver.EventDataChanged)
+	}
+
+	// writes while the event isn't received are coalesced
+	_ = d.WriteContext(cx, "/config", []byte("v3"))
+	_ = d.WriteContext(cx, "/config", []byte("v4"))
+	if ev, _ := next(t, ch); string(ev.D.([]byte)) != "v4" {
+		t.Errorf("event data = %s, want v4", ev.D)
+	}
+
+	// children don't change the data
+	_ = d.WriteContext(cx, "/config/child", nil)
+	select {
+	case ev := <-ch:
+		t.Errorf("unexpected event %v", ev.Type)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// deleted & created again before the event is received
+	_ = d.WriteContext(cx, "/config", []byte("v5"))
+	time.Sleep(10 * time.Millisecond)
+	_ = d.DeleteContext(cx, "/config")
+	_ = d.WriteContext(cx, "/config", []byte("v6"))
+
+	if ev, _ := next(t, ch); ev.Type != driver.EventDataChanged || string(ev.D.([]byte)) != "v5" {
+		t.Errorf("event = %v %s, want %v v5", ev.Type, ev.D, driver.EventDataChanged)
+	}
+	if ev, _ := next(t, ch); ev.Type != driver.EventDeleted || string(ev.D.([]byte)) != "v6" {
+		t.Errorf("event = %v %s, want %v v6", ev.Type, ev.D, driver.EventDeleted)
+	}
+
+	// deleted, the channel is closed without an event
+	_ = d.DeleteContext(cx, "/config")
+	if ev, ok := next(t, ch); ok {
+		t.Errorf("event %v after delete, want a closed channel", ev.Type)
+	}
+}
+
+func TestDriver_WatchChildren(t *testing.T) {
+	var (
+		cx = context.Background()
+		d  = NewInMemoryDriver()
+	)
+
+	_ = d.WriteContext(cx, "/services/a", nil)
+
+	children, ch, err := d.WatchChildren("/services")
+	if err != nil || !reflect.DeepEqual(children, []string{"a"}) {
+		t.Fatalf("WatchChildren() = %v, %v, want [a]", children, err)
+	}
+
+	_ = d.WriteContext(cx, "/services/b", nil)
+	if ev, _ := next(t, ch); ev.Type != driver.EventChildrenChanged || !reflect.DeepEqual(ev.D, []string{"a", "b"}) {
+		t.Errorf("event = %v %v, want %v [a b]", ev.Type, ev.D, driver.EventChildrenChanged)
+	}
+
+	// the data & the grandchildren don't change the children
+	_ = d.WriteContext(cx, "/services", []byte("x"))
+	_ = d.WriteContext(cx, "/services/a/x", nil)
+
+	_ = d.DeleteContext(cx, "/services/a")
+	if ev, _ := next(t, ch); !reflect.DeepEqual(ev.D, []string{"b"}) {
+		t.Errorf("event data = %v, want [b]", ev.D)
+	}
+
+	// closed with the driver
+	_ = d.Close()
+	if _, ok := next(t, ch); ok {
+		t.Errorf("event after Close, want a closed channel")
+	}
+
+	if _, err := d.ReadContext(cx, "/services"); err != ErrDriverClosed {
+		t.Errorf("ReadContext() after Close error = %v, want %v", err, ErrDriverClosed)
+	}
+}
+
+func TestWithFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "seed.json")
+	_ = os.WriteFile(name, []byte(`{"/app/name": "indexer", "/app/config": {"workers": 4}}`), 0o600)
+
+	d := NewInMemoryDriver(
+		WithFile(name),
+		WithJSON([]byte(`{"/app/name": "override"}`)),
+	)
+	if err := d.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for p, want := range map[string]string{
+		"/app/name":   "override",
+		"/app/config": `{"workers": 4}`,
+	} {
+		if got, _ := d.ReadContext(context.Background(), p); string(got) != want {
+			t.Errorf("ReadContext(%s) = %s, want %s", p, got, want)
+		}
+	}
+
+	if err := NewInMemoryDriver(WithFile("missing.json")).Open(); err == nil {
+		t.Errorf("Open() with a missing file succeeded")
+	}
+}
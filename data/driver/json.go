@@ -0,0 +1,65 @@
+package driver
+
+import (
+	"encoding/json"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// ErrDecode is returned when the data of a node watched by WatchJSON
+// doesn't decode in its type
+var ErrDecode = errors.New("driver: failed to decode the node")
+
+// Update is an update of a node watched by WatchJSON, Value is nil when
+// Err is set
+type Update[T any] struct {
+	Value *T
+	Err   error
+}
+
+// WatchJSON reads the JSON node at path into a T & watches it. The channel
+// gets a freshly decoded T for every EventDataChanged of the watch. The
+// data failing to decode is sent as an Update with Err wrapping ErrDecode
+// & the watch goes on, so does an event carrying an error. The channel is
+// closed with the one of Driver.Watch
+func WatchJSON[T any](d Driver, path string) (*T, <-chan Update[T], error) {
+	bt, events, err := d.Watch(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	val, err := decode[T](bt)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, path)
+	}
+
+	out := make(chan Update[T])
+	go func() {
+		defer close(out)
+
+		for ev := range events {
+			if ev.Err != nil {
+				out <- Update[T]{Err: ev.Err}
+				continue
+			}
+
+			if ev.Type != EventDataChanged {
+				continue
+			}
+
+			bt, _ := ev.D.([]byte)
+			val, err := decode[T](bt)
+			out <- Update[T]{Value: val, Err: err}
+		}
+	}()
+
+	return val, out, nil
+}
+
+func decode[T any](bt []byte) (*T, error) {
+	var val T
+	if err := json.Unmarshal(bt, &val); err != nil {
+		return nil, errors.With(ErrDecode, err)
+	}
+	return &val, nil
+}
@@ -0,0 +1,62 @@
+package driver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/driver"
+	"github.com/unbxd/go-base/v2/data/driver/inmem"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+type config struct {
+	Name    string `json:"name"`
+	Replica int    `json:"replica"`
+}
+
+func next(t *testing.T, ch <-chan driver.Update[config]) driver.Update[config] {
+	t.Helper()
+
+	select {
+	case up, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return up
+	case <-time.After(time.Second):
+		t.Fatal("no update in 1s")
+		return driver.Update[config]{}
+	}
+}
+
+func TestWatchJSON(t *testing.T) {
+	var (
+		cx = context.Background()
+		d  = inmem.NewInMemoryDriver()
+	)
+	defer d.Close()
+
+	_ = d.WriteContext(cx, "/config", []byte(`{"name": "search", "replica": 2}`))
+
+	cfg, updates, err := driver.WatchJSON[config](d, "/config")
+	if err != nil || *cfg != (config{"search", 2}) {
+		t.Fatalf("WatchJSON() = %+v, %v, want the current config", cfg, err)
+	}
+
+	// a malformed update is sent as an error, the watch goes on
+	_ = d.WriteContext(cx, "/config", []byte(`{"name":`))
+	if up := next(t, updates); up.Value != nil || !errors.Is(up.Err, driver.ErrDecode) {
+		t.Errorf("update = %+v, want %v", up, driver.ErrDecode)
+	}
+
+	_ = d.WriteContext(cx, "/config", []byte(`{"name": "search", "replica": 3}`))
+	if up := next(t, updates); up.Err != nil || *up.Value != (config{"search", 3}) {
+		t.Errorf("update = %+v, want replica 3", up)
+	}
+
+	_ = d.WriteContext(cx, "/broken", []byte(`[]`))
+	if _, _, err := driver.WatchJSON[config](d, "/broken"); !errors.Is(err, driver.ErrDecode) {
+		t.Errorf("WatchJSON() of a malformed node error = %v, want %v", err, driver.ErrDecode)
+	}
+}
@@ -0,0 +1,133 @@
+package zook
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// lockPrefix prefixes the nodes of the contenders of a lock
+const lockPrefix = "lock-"
+
+// ErrLockLost is returned when the node of a contender is gone before the
+// lock is acquired, the session of the driver has ended
+var ErrLockLost = errors.New("zook: lock node lost with the session")
+
+// Lock acquires the lock at path, blocking till it is held, see TryLock
+func (d *Driver) Lock(path string) (unlock func() error, err error) {
+	return d.TryLock(context.Background(), path)
+}
+
+// TryLock acquires the lock at path, waiting till cx is done. It follows
+// the recipe of zookeeper, the contenders create an ephemeral sequential
+// node under path & the lowest holds the lock, the others watch the node
+// before theirs. The node is ephemeral, the lock is released when the
+// session of the driver ends.
+// unlock deletes the node, it can be called more than once & after the
+// session is lost, a failed delete is retried by the next call.
+// The node is created regardless of cx, if the lock isn't acquired the
+// node is deleted before returning
+func (d *Driver) TryLock(cx context.Context, path string) (unlock func() error, err error) {
+	if err := d.makePath(cx, path); err != nil {
+		return nil, err
+	}
+
+	// not bounded, an abandoned create would leave a node holding the
+	// lock till the session ends
+	node, err := d.conn.Create(path+"/"+lockPrefix, nil, zk.FlagEphemeral|zk.FlagSequence, d.acl)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating lock node. Path: "+path)
+	}
+
+	unlock = d.unlocker(node)
+
+	if err := d.acquire(cx, path, node[strings.LastIndex(node, "/")+1:]); err != nil {
+		_ = unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// acquire waits till name is the lowest of the contenders of the lock
+func (d *Driver) acquire(cx context.Context, path, name string) error {
+	for {
+		children, err := d.ChildrenContext(cx, path)
+		if err != nil {
+			return err
+		}
+
+		contenders := children[:0]
+		for _, child := range children {
+			if strings.HasPrefix(child, lockPrefix) {
+				contenders = append(contenders, child)
+			}
+		}
+		sort.Strings(contenders)
+
+		i := sort.SearchStrings(contenders, name)
+		switch {
+		case i == len(contenders) || contenders[i] != name:
+			return ErrLockLost
+		case i == 0:
+			return nil
+		}
+
+		type watch struct {
+			exists bool
+			ech    <-chan zk.Event
+		}
+
+		w, err := bounded(cx, d, func() (watch, error) {
+			exists, _, ech, err := d.conn.ExistsW(path + "/" + contenders[i-1])
+			return watch{exists, ech}, err
+		})
+		if err != nil {
+			return err
+		}
+
+		if !w.exists {
+			continue
+		}
+
+		select {
+		case <-w.ech:
+		case <-cx.Done():
+			return cx.Err()
+		}
+	}
+}
+
+// unlocker returns a func deleting the node, the node deleted with the
+// session is fine. A delete failing otherwise, e.g. on a lost connection,
+// is tried again by the next call, once deleted the calls are noops
+func (d *Driver) unlocker(node string) func() error {
+	var (
+		mu   sync.Mutex
+		done bool
+	)
+
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if done {
+			return nil
+		}
+
+		_, err := bounded(context.Background(), d, func() (struct{}, error) {
+			return struct{}{}, d.conn.Delete(node, -1)
+		})
+
+		switch err {
+		case nil, zk.ErrNoNode, zk.ErrSessionExpired:
+			done = true
+			return nil
+		default:
+			return errors.Wrap(err, "Error deleting lock node. Path: "+node)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package zook
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+func (tc *treeConn) Children(path string) ([]string, *zk.Stat, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	var children []string
+	for node := range tc.nodes {
+		if strings.HasPrefix(node, path+"/") && !strings.Contains(node[len(path)+1:], "/") {
+			children = append(children, node[len(path)+1:])
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(children)))
+	return children, &zk.Stat{}, nil
+}
+
+func (tc *treeConn) ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	ech := make(chan zk.Event, 1)
+	if tc.watches == nil {
+		tc.watches = make(map[string][]chan zk.Event)
+	}
+	tc.watches[path] = append(tc.watches[path], ech)
+
+	_, ok := tc.nodes[path]
+	return ok, &zk.Stat{}, ech, nil
+}
+
+func (tc *treeConn) Delete(path string, _ int32) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if _, ok := tc.nodes[path]; !ok {
+		return zk.ErrNoNode
+	}
+	delete(tc.nodes, path)
+
+	for _, ech := range tc.watches[path] {
+		ech <- zk.Event{Type: zk.EventNodeDeleted, Path: path}
+	}
+	delete(tc.watches, path)
+	return nil
+}
+
+// flakyConn fails the first delete of a node
+type flakyConn struct {
+	*treeConn
+	failed bool
+}
+
+func (fc *flakyConn) Delete(path string, version int32) error {
+	if !fc.failed {
+		fc.failed = true
+		return zk.ErrConnectionClosed
+	}
+	return fc.treeConn.Delete(path, version)
+}
+
+func TestDriver_Lock(t *testing.T) {
+	var (
+		tc = &treeConn{nodes: map[string]int32{}}
+		d  = NewZKDriver(nil).(*Driver)
+	)
+	d.conn = tc
+
+	unlock, err := d.Lock("/cron/report")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	cx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := d.TryLock(cx, "/cron/report"); err != context.DeadlineExceeded {
+		t.Errorf("TryLock() of a held lock error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the contender not acquiring the lock deleted its node
+	if children, _, _ := tc.Children("/cron/report"); len(children) != 1 {
+		t.Errorf("contenders = %v, want the holder only", children)
+	}
+
+	acquired := make(chan func() error)
+	go func() {
+		unlock, err := d.Lock("/cron/report")
+		if err != nil {
+			t.Errorf("Lock() error = %v", err)
+		}
+		acquired <- unlock
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Lock() acquired a held lock")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := unlock(); err != nil {
+			t.Errorf("unlock() #%d error = %v", i, err)
+		}
+	}
+
+	select {
+	case next := <-acquired:
+		// the node is gone with the session
+		tc.mu.Lock()
+		tc.nodes = map[string]int32{}
+		tc.mu.Unlock()
+
+		if err := next(); err != nil {
+			t.Errorf("unlock() after the session is lost error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lock() not acquired once unlocked")
+	}
+}
+
+func TestDriver_Lock_unlockRetried(t *testing.T) {
+	var (
+		tc = &treeConn{nodes: map[string]int32{}}
+		d  = NewZKDriver(nil).(*Driver)
+	)
+	d.conn = &flakyConn{treeConn: tc}
+
+	unlock, err := d.Lock("/cron/report")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	if err := unlock(); !errors.Is(err, zk.ErrConnectionClosed) {
+		t.Fatalf("unlock() with the connection closed error = %v, want %v", err, zk.ErrConnectionClosed)
+	}
+
+	// the failed delete is tried again
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock() retried error = %v", err)
+	}
+	if children, _, _ := tc.Children("/cron/report"); len(children) != 0 {
+		t.Errorf("contenders = %v, want none once unlocked", children)
+	}
+
+	if err := unlock(); err != nil {
+		t.Errorf("unlock() once unlocked error = %v", err)
+	}
+}
@@ -1,30 +1,63 @@
 package zook
 
 import (
+	"context"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/samuel/go-zookeeper/zk"
 	"github.com/unbxd/go-base/v2/data/driver"
 	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
 )
 
 type (
+	// conn is the part of zk.Conn used by the driver
+	conn interface {
+		Get(path string) ([]byte, *zk.Stat, error)
+		GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error)
+		Set(path string, data []byte, version int32) (*zk.Stat, error)
+		Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+		Exists(path string) (bool, *zk.Stat, error)
+		ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+		Children(path string) ([]string, *zk.Stat, error)
+		ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+		Delete(path string, version int32) error
+		State() zk.State
+		Close()
+	}
+
 	// Driver defines zookeeper driver for Albus
 	Driver struct {
-		root    string
-		timeout time.Duration
-		acl     []zk.ACL
+		root      string
+		timeout   time.Duration
+		opTimeout time.Duration
+		acl       []zk.ACL
 
 		servers []string
 
-		conn *zk.Conn
+		logger log.Logger
+		warned sync.Map
+
+		// attempts & backoff of Open, see WithConnectRetry
+		attempts int
+		backoff  func(attempt int) time.Duration
+		// rewatch is the delay between the attempts to set a watch back,
+		// zero closes the watch on the first error, see WithRewatch
+		rewatch time.Duration
+
+		dial func(servers []string, timeout time.Duration) (conn, error)
+		conn conn
+
+		done      chan struct{}
+		closeOnce sync.Once
 	}
 
 	DriverOption func(*Driver)
 )
 
-func check(conn *zk.Conn, root string) error {
+func check(conn conn, root string) error {
 	_, _, err := conn.Get(root)
 	switch {
 	case err != nil && (err == zk.ErrInvalidPath || err == zk.ErrNoNode):
@@ -42,39 +75,85 @@ func check(conn *zk.Conn, root string) error {
 	return nil
 }
 
-// Open initializes the driver
-func (d *Driver) Open() error {
+// eventTypes maps the zookeeper events to the driver events
+var eventTypes = map[zk.EventType]driver.EventType{
+	zk.EventNodeCreated:         driver.EventCreated,
+	zk.EventNodeDeleted:         driver.EventDeleted,
+	zk.EventNodeDataChanged:     driver.EventDataChanged,
+	zk.EventNodeChildrenChanged: driver.EventChildrenChanged,
+}
+
+func dial(servers []string, timeout time.Duration) (conn, error) {
 	// TODO: event channel, check what it does
-	conn, _, err := zk.Connect(d.servers, d.timeout)
+	zc, _, err := zk.Connect(servers, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return zc, nil
+}
+
+// Open initializes the driver, it retries as set by WithConnectRetry
+func (d *Driver) Open() error {
+	for attempt := 1; ; attempt++ {
+		err := d.connect()
+		if err == nil || attempt >= d.attempts {
+			return err
+		}
+
+		d.logger.Warn(
+			"zookeeper connect failed, retrying",
+			log.Int("attempt", attempt),
+			log.Error(err),
+		)
+
+		select {
+		case <-time.After(d.backoff(attempt)):
+		case <-d.done:
+			return err
+		}
+	}
+}
+
+func (d *Driver) connect() error {
+	conn, err := d.dial(d.servers, d.timeout)
 	if err != nil {
 		return errors.Wrap(err, "Error initializing ZK Driver")
 	}
 
+	if err := check(conn, d.root); err != nil {
+		conn.Close()
+		return err
+	}
+
 	d.conn = conn
 	d.acl = zk.WorldACL(zk.PermAll)
-
-	return check(d.conn, d.root)
+	return nil
 }
 
-func (d *Driver) makePath(path string) error {
+func (d *Driver) makePath(cx context.Context, path string) error {
 	pathSlice := strings.Split(path, "/")
 
 	var cPath = ""
 	for _, ele := range pathSlice[1:] {
 		cPath = cPath + "/" + ele
 
-		exists, _, err := d.conn.Exists(cPath)
+		exists, err := bounded(cx, d, func() (bool, error) {
+			exists, _, err := d.conn.Exists(cPath)
+			return exists, err
+		})
 		if err != nil {
 			return errors.Wrap(err, "Error walking path")
 		}
 
 		if !exists {
-			_, err := d.conn.Create(
-				cPath,
-				[]byte("{}"),
-				int32(0),
-				d.acl,
-			)
+			_, err := bounded(cx, d, func() (string, error) {
+				return d.conn.Create(
+					cPath,
+					[]byte("{}"),
+					int32(0),
+					d.acl,
+				)
+			})
 			if err != nil {
 				return errors.Wrap(err, "Error adding Node: ")
 			}
@@ -83,20 +162,78 @@ func (d *Driver) makePath(path string) error {
 	return nil
 }
 
+// bounded runs fn until cx is done. go-zookeeper can't cancel a request
+// once sent, on cancellation fn keeps running in the background & its
+// result is dropped. Without a deadline in cx, the operation timeout of
+// the driver applies, so no call waits on zookeeper forever
+func bounded[T any](cx context.Context, d *Driver, fn func() (T, error)) (T, error) {
+	var zero T
+
+	if err := cx.Err(); err != nil {
+		return zero, err
+	}
+
+	if _, ok := cx.Deadline(); !ok && d.opTimeout > 0 {
+		var cancel context.CancelFunc
+		cx, cancel = context.WithTimeout(cx, d.opTimeout)
+		defer cancel()
+	}
+
+	type result struct {
+		val T
+		err error
+	}
+
+	rc := make(chan result, 1)
+	go func() {
+		val, err := fn()
+		rc <- result{val, err}
+	}()
+
+	select {
+	case res := <-rc:
+		return res.val, res.err
+	case <-cx.Done():
+		return zero, cx.Err()
+	}
+}
+
+// deprecated logs the use of a deprecated method, once per method
+func (d *Driver) deprecated(method string) {
+	if _, logged := d.warned.LoadOrStore(method, struct{}{}); !logged {
+		d.logger.Warn(
+			"deprecated zook driver method used, use the one taking a context",
+			log.String("method", method),
+		)
+	}
+}
+
+// ReadContext reads the content from the path and returns the value in bytes
+func (d *Driver) ReadContext(cx context.Context, path string) ([]byte, error) {
+	return bounded(cx, d, func() ([]byte, error) {
+		data, _, err := d.conn.Get(path)
+		return data, err
+	})
+}
+
 // Read reads the content from the path and returns the value in bytes
+//
+// Deprecated: use ReadContext
 func (d *Driver) Read(path string) ([]byte, error) {
-	data, _, err := d.conn.Get(path)
-	if err != nil {
-		return nil, err
-	}
-	return data, nil
+	d.deprecated("Read")
+	return d.ReadContext(context.Background(), path)
 }
 
-// Write writes the content to the path
-func (d *Driver) Write(path string, data []byte) error {
-	_, stat, err := d.conn.Get(path)
+// WriteContext writes the content to the path, creating the missing nodes
+// of the path. cx is checked between the steps, a cancelled write stops
+// at the step it is in
+func (d *Driver) WriteContext(cx context.Context, path string, data []byte) error {
+	stat, err := bounded(cx, d, func() (*zk.Stat, error) {
+		_, stat, err := d.conn.Get(path)
+		return stat, err
+	})
 	if err != nil && err == zk.ErrNoNode {
-		err := d.makePath(path)
+		err := d.makePath(cx, path)
 		if err != nil {
 			return err
 		}
@@ -105,40 +242,106 @@ func (d *Driver) Write(path string, data []byte) error {
 		return err
 	}
 
-	_, er := d.conn.Set(path, data, stat.Version)
+	version := int32(0)
+	if stat != nil {
+		version = stat.Version
+	}
+
+	_, er := bounded(cx, d, func() (*zk.Stat, error) {
+		return d.conn.Set(path, data, version)
+	})
 	if er != nil {
-		return errors.Wrap(err, "Error writing data to node. Path: "+path)
+		return errors.Wrap(er, "Error writing data to node. Path: "+path)
 	}
 	return nil
 }
 
-// Children returns the children of the path
-func (d *Driver) Children(path string) ([]string, error) {
+// Write writes the content to the path
+//
+// Deprecated: use WriteContext
+func (d *Driver) Write(path string, data []byte) error {
+	d.deprecated("Write")
+	return d.WriteContext(context.Background(), path, data)
+}
 
-	// TODO: _ is acctually an event, see what it does
-	children, _, err := d.conn.Children(path)
+// create creates the node with the flags, creating the missing parents
+// as persistent nodes, & returns the path created
+func (d *Driver) create(cx context.Context, path string, data []byte, flags int32) (string, error) {
+	if i := strings.LastIndex(path, "/"); i > 0 {
+		if err := d.makePath(cx, path[:i]); err != nil {
+			return "", err
+		}
+	}
+
+	created, err := bounded(cx, d, func() (string, error) {
+		return d.conn.Create(path, data, flags, d.acl)
+	})
 	if err != nil {
-		return nil, err
+		return "", errors.Wrap(err, "Error creating node. Path: "+path)
 	}
+	return created, nil
+}
 
-	return children, nil
+// CreateEphemeralContext creates an ephemeral node, zookeeper deletes it
+// once the session of the driver ends. The missing parents are created as
+// persistent nodes, an ephemeral node can't have children
+func (d *Driver) CreateEphemeralContext(cx context.Context, path string, data []byte) error {
+	_, err := d.create(cx, path, data, zk.FlagEphemeral)
+	return err
 }
 
-// Delete deletes the node and all its children
-func (d *Driver) Delete(path string) error {
-	children, _, err := d.conn.Children(path)
+// CreateEphemeral creates an ephemeral node, see CreateEphemeralContext
+func (d *Driver) CreateEphemeral(path string, data []byte) error {
+	return d.CreateEphemeralContext(context.Background(), path, data)
+}
+
+// CreateSequentialContext creates a node with a sequence number appended
+// to path by zookeeper & returns the path created. The missing parents
+// are created as persistent nodes
+func (d *Driver) CreateSequentialContext(cx context.Context, path string, data []byte) (string, error) {
+	return d.create(cx, path, data, zk.FlagSequence)
+}
+
+// CreateSequential creates a sequential node, see CreateSequentialContext
+func (d *Driver) CreateSequential(path string, data []byte) (string, error) {
+	return d.CreateSequentialContext(context.Background(), path, data)
+}
+
+// ChildrenContext returns the children of the path
+func (d *Driver) ChildrenContext(cx context.Context, path string) ([]string, error) {
+	return bounded(cx, d, func() ([]string, error) {
+		// TODO: _ is acctually an event, see what it does
+		children, _, err := d.conn.Children(path)
+		return children, err
+	})
+}
+
+// Children returns the children of the path
+//
+// Deprecated: use ChildrenContext
+func (d *Driver) Children(path string) ([]string, error) {
+	d.deprecated("Children")
+	return d.ChildrenContext(context.Background(), path)
+}
+
+// DeleteContext deletes the node and all its children, cx is checked
+// between the nodes, a cancelled delete leaves the nodes not reached yet
+func (d *Driver) DeleteContext(cx context.Context, path string) error {
+	children, err := d.ChildrenContext(cx, path)
 	if err != nil {
 		return err
 	}
 	if len(children) > 0 {
 		for _, child := range children {
-			err := d.Delete(path + "/" + child)
+			err := d.DeleteContext(cx, path+"/"+child)
 			if err != nil {
 				return err
 			}
 		}
 	} else {
-		err := d.conn.Delete(path, -1)
+		_, err := bounded(cx, d, func() (struct{}, error) {
+			return struct{}{}, d.conn.Delete(path, -1)
+		})
 		if err != nil {
 			return err
 		}
@@ -146,81 +349,121 @@ func (d *Driver) Delete(path string) error {
 	return nil
 }
 
-// Watch watches for changes on node
-func (d *Driver) Watch(path string) ([]byte, <-chan *driver.Event, error) {
+// Delete deletes the node and all its children
+//
+// Deprecated: use DeleteContext
+func (d *Driver) Delete(path string) error {
+	d.deprecated("Delete")
+	return d.DeleteContext(context.Background(), path)
+}
+
+// watch emits the events of the watch set by set, which returns the
+// current value of the path. A watch which can't be set back closes the
+// channel, unless WithRewatch is set
+func watch[T any](
+	d *Driver,
+	path string,
+	set func() (T, <-chan zk.Event, error),
+	resync driver.EventType,
+) (T, <-chan *driver.Event, error) {
 	var channel = make(chan *driver.Event)
 
-	val, _, ech, err := d.conn.GetW(path)
+	val, ech, err := set()
 	if err != nil {
-		return nil, nil, err
+		return val, nil, err
 	}
 
-	go func(path string, channel chan *driver.Event) {
+	go func() {
 		for {
 			event := <-ech
 
-			val, _, ech, err = d.conn.GetW(path)
+			// the watch is lost with the session, the changes in between
+			// are missed
+			missed := event.Type == zk.EventNotWatching
+
+			val, ech, err = set()
 			if err != nil {
-				close(channel)
-				return
+				if d.rewatch <= 0 || err == zk.ErrClosing {
+					close(channel)
+					return
+				}
+
+				if val, ech, err = resume(d, path, set); err != nil {
+					close(channel)
+					return
+				}
+				missed = true
 			}
 
-			switch event.Type {
-			case zk.EventNodeCreated:
-				channel <- &driver.Event{Type: driver.EventCreated, P: path, D: val, Err: err}
-			case zk.EventNodeDeleted:
-				channel <- &driver.Event{Type: driver.EventDeleted, P: path, D: val, Err: err}
-			case zk.EventNodeDataChanged:
-				channel <- &driver.Event{Type: driver.EventDataChanged, P: path, D: val, Err: err}
-			case zk.EventNodeChildrenChanged:
-				channel <- &driver.Event{Type: driver.EventChildrenChanged, P: path, D: val, Err: err}
+			// the current value is sent for the consumers to resync
+			if missed && d.rewatch > 0 {
+				channel <- &driver.Event{Type: resync, P: path, D: val}
+				continue
 			}
 
+			// This is done to wrap Zookeeper Events into Driver Events
+			// This will ensure the re-usability of the interface
+			if tp, ok := eventTypes[event.Type]; ok {
+				channel <- &driver.Event{Type: tp, P: path, D: val}
+			}
 		}
-	}(path, channel)
+	}()
 
 	return val, channel, nil
 }
 
-func (d *Driver) WatchChildren(path string) ([]string, <-chan *driver.Event, error) {
-	var channel = make(chan *driver.Event)
-
-	val, _, ech, err := d.conn.ChildrenW(path)
-	if err != nil {
-		return nil, nil, err
-	}
+// resume sets the watch back, till the driver is closed
+func resume[T any](
+	d *Driver,
+	path string,
+	set func() (T, <-chan zk.Event, error),
+) (T, <-chan zk.Event, error) {
+	for {
+		select {
+		case <-time.After(d.rewatch):
+		case <-d.done:
+			var zero T
+			return zero, nil, zk.ErrClosing
+		}
 
-	go func(path string, channel chan *driver.Event) {
-		for {
-			event := <-ech
+		val, ech, err := set()
+		switch err {
+		case nil:
+			return val, ech, nil
+		case zk.ErrClosing:
+			return val, nil, err
+		}
 
-			val, _, ech, err = d.conn.ChildrenW(path)
-			if err != nil {
-				close(channel)
-				return
-			}
+		d.logger.Warn(
+			"zookeeper watch failed, retrying",
+			log.String("path", path),
+			log.Error(err),
+		)
+	}
+}
 
-			// This is done to wrap Zookeeper Events into Driver Events
-			// This will ensure the re-usability of the interface
-			switch event.Type {
-			case zk.EventNodeCreated:
-				channel <- &driver.Event{Type: driver.EventCreated, P: path, D: val}
-			case zk.EventNodeDeleted:
-				channel <- &driver.Event{Type: driver.EventDeleted, P: path, D: val}
-			case zk.EventNodeDataChanged:
-				channel <- &driver.Event{Type: driver.EventDataChanged, P: path, D: val}
-			case zk.EventNodeChildrenChanged: //we will only get this event
-				channel <- &driver.Event{Type: driver.EventChildrenChanged, P: path, D: val}
-			}
-		}
-	}(path, channel)
+// Watch watches for changes on node
+func (d *Driver) Watch(path string) ([]byte, <-chan *driver.Event, error) {
+	return watch(d, path, func() ([]byte, <-chan zk.Event, error) {
+		val, _, ech, err := d.conn.GetW(path)
+		return val, ech, err
+	}, driver.EventDataChanged)
+}
 
-	return val, channel, nil
+// WatchChildren watches for changes of the children of node
+func (d *Driver) WatchChildren(path string) ([]string, <-chan *driver.Event, error) {
+	return watch(d, path, func() ([]string, <-chan zk.Event, error) {
+		val, _, ech, err := d.conn.ChildrenW(path)
+		return val, ech, err
+	}, driver.EventChildrenChanged)
 }
 
 // Close shuts down connection for the driver
 func (d *Driver) Close() error {
-	d.conn.Close()
+	d.closeOnce.Do(func() { close(d.done) })
+	if d.conn != nil {
+		d.conn.Close()
+	}
 	return nil
 }
 
@@ -245,6 +488,63 @@ func WithTimeout(timeout time.Duration) DriverOption {
 	}
 }
 
+// WithOperationTimeout bounds the calls made with a context without a
+// deadline, defaults to the session timeout (see WithTimeout)
+func WithOperationTimeout(timeout time.Duration) DriverOption {
+	return func(d *Driver) {
+		d.opTimeout = timeout
+	}
+}
+
+// WithLogger sets the logger, used to warn about the deprecated methods
+func WithLogger(logger log.Logger) DriverOption {
+	return func(d *Driver) {
+		d.logger = logger
+	}
+}
+
+// maxConnectBackoff caps the backoff of WithConnectRetry
+const maxConnectBackoff = time.Minute
+
+// WithConnectRetry makes Open try to connect up to attempts times, the
+// backoff doubles after every failed attempt, up to a minute
+func WithConnectRetry(attempts int, backoff time.Duration) DriverOption {
+	return func(d *Driver) {
+		d.attempts = attempts
+		d.backoff = func(attempt int) time.Duration {
+			wait := backoff
+			// doubled one attempt at a time, a shift would overflow
+			for i := 1; i < attempt && wait < maxConnectBackoff; i++ {
+				wait *= 2
+			}
+
+			if wait > maxConnectBackoff {
+				return maxConnectBackoff
+			}
+			return wait
+		}
+	}
+}
+
+// WithConnectBackoff sets the wait of Open before the next attempt to
+// connect, see WithConnectRetry
+func WithConnectBackoff(fn func(attempt int) time.Duration) DriverOption {
+	return func(d *Driver) {
+		d.backoff = fn
+	}
+}
+
+// WithRewatch sets the watches back when they fail, e.g. while zookeeper
+// is unreachable, trying every delay till the driver is closed. Once set
+// back, the watch sends the current value, data changed for Watch &
+// children changed for WatchChildren, for the consumers to resync as
+// changes may have been missed
+func WithRewatch(delay time.Duration) DriverOption {
+	return func(d *Driver) {
+		d.rewatch = delay
+	}
+}
+
 func WithRootDirectory(root string) DriverOption {
 	return func(d *Driver) {
 		d.root = root
@@ -258,11 +558,21 @@ func NewZKDriver(servers []string, options ...DriverOption) driver.Driver {
 		timeout: 18 * time.Second,
 		root:    "/",
 		acl:     zk.WorldACL(zk.PermAll),
+		logger:  log.NewNoopLogger(),
+
+		attempts: 1,
+		backoff:  func(int) time.Duration { return 0 },
+		dial:     dial,
+		done:     make(chan struct{}),
 	}
 
 	for _, fn := range options {
 		fn(driver)
 	}
 
+	if driver.opTimeout == 0 {
+		driver.opTimeout = driver.timeout
+	}
+
 	return driver
 }
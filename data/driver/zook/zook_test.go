@@ -0,0 +1,261 @@
+package zook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/unbxd/go-base/v2/data/ctxvet"
+	"github.com/unbxd/go-base/v2/data/driver"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// slowConn answers once released, like a zookeeper which is unreachable
+type slowConn struct {
+	conn
+	release chan struct{}
+}
+
+func (sc *slowConn) Get(string) ([]byte, *zk.Stat, error) {
+	<-sc.release
+	return []byte("v"), &zk.Stat{}, nil
+}
+
+func (sc *slowConn) Children(string) ([]string, *zk.Stat, error) {
+	<-sc.release
+	return nil, &zk.Stat{}, nil
+}
+
+type warnLogger struct {
+	log.Logger
+	warns int
+}
+
+func (wl *warnLogger) Warn(string, ...log.Field) { wl.warns++ }
+
+func TestDriver_cancellation(t *testing.T) {
+	var (
+		sc     = &slowConn{release: make(chan struct{})}
+		logger = &warnLogger{Logger: log.NewNoopLogger()}
+		d      = NewZKDriver(nil, WithOperationTimeout(20*time.Millisecond), WithLogger(logger)).(*Driver)
+	)
+	defer close(sc.release)
+	d.conn = sc
+
+	vd := ctxvet.Driver(t, d, 20*time.Millisecond)
+
+	cx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := vd.ReadContext(cx, "/a"); err != context.DeadlineExceeded {
+		t.Errorf("ReadContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := vd.DeleteContext(cx, "/a"); err != context.DeadlineExceeded {
+		t.Errorf("DeleteContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// no deadline, the operation timeout applies
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := d.Read("/a"); err != context.DeadlineExceeded {
+			t.Errorf("Read() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read() took %v, want the operation timeout", elapsed)
+	}
+
+	if logger.warns != 1 {
+		t.Errorf("deprecation warnings = %d, want 1", logger.warns)
+	}
+}
+
+// watchConn answers the watches in order
+type watchConn struct {
+	conn
+	mu      sync.Mutex
+	watches []watchResult
+}
+
+type watchResult struct {
+	val []byte
+	ech chan zk.Event
+	err error
+}
+
+func (wc *watchConn) GetW(string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	rs := wc.watches[0]
+	wc.watches = wc.watches[1:]
+	return rs.val, &zk.Stat{}, rs.ech, rs.err
+}
+
+func (wc *watchConn) Get(string) ([]byte, *zk.Stat, error) { return nil, &zk.Stat{}, nil }
+
+func (wc *watchConn) Close() {}
+
+func TestWithConnectRetry(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int
+		wantErr  bool
+	}{
+		{attempts: 2, wantErr: true},
+		{attempts: 3},
+	} {
+		var (
+			dials int
+			waits []time.Duration
+			d     = NewZKDriver(nil, WithConnectRetry(tt.attempts, time.Millisecond)).(*Driver)
+		)
+
+		d.dial = func([]string, time.Duration) (conn, error) {
+			if dials++; dials < 3 {
+				return nil, zk.ErrNoServer
+			}
+			return &watchConn{}, nil
+		}
+		backoff := d.backoff
+		d.backoff = func(attempt int) time.Duration {
+			waits = append(waits, backoff(attempt))
+			return backoff(attempt)
+		}
+
+		if err := d.Open(); (err != nil) != tt.wantErr {
+			t.Errorf("Open() with %d attempts error = %v, want error %v", tt.attempts, err, tt.wantErr)
+		}
+		if dials != tt.attempts {
+			t.Errorf("Open() dials = %d, want %d", dials, tt.attempts)
+		}
+		if fmt.Sprint(waits) != fmt.Sprint([]time.Duration{time.Millisecond, 2 * time.Millisecond}[:tt.attempts-1]) {
+			t.Errorf("Open() backoff = %v, want it doubled", waits)
+		}
+	}
+
+	// capped, however many the attempts
+	d := NewZKDriver(nil, WithConnectRetry(100, time.Second)).(*Driver)
+	for _, attempt := range []int{7, 64, 100} {
+		if wait := d.backoff(attempt); wait != maxConnectBackoff {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, wait, maxConnectBackoff)
+		}
+	}
+}
+
+func TestWithRewatch(t *testing.T) {
+	var (
+		ech1 = make(chan zk.Event, 1)
+		ech2 = make(chan zk.Event, 1)
+		wc   = &watchConn{watches: []watchResult{
+			{val: []byte("v1"), ech: ech1},
+			{err: zk.ErrNoServer},
+			{err: zk.ErrNoServer},
+			{val: []byte("v2"), ech: ech2},
+			{err: zk.ErrClosing},
+		}}
+		d = NewZKDriver(nil, WithRewatch(time.Millisecond)).(*Driver)
+	)
+	d.conn = wc
+
+	val, events, err := d.Watch("/a")
+	if err != nil || string(val) != "v1" {
+		t.Fatalf("Watch() = %q, %v, want v1", val, err)
+	}
+
+	// the session is lost, the watch is set back once zookeeper is back
+	ech1 <- zk.Event{Type: zk.EventNotWatching, Err: zk.ErrSessionExpired}
+
+	select {
+	case ev := <-events:
+		if ev.Type != driver.EventDataChanged || string(ev.D.([]byte)) != "v2" {
+			t.Errorf("event = %+v, want the current value", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event after the watch is set back")
+	}
+
+	d.Close()
+	ech2 <- zk.Event{Type: zk.EventNotWatching, Err: zk.ErrClosing}
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("event after Close(), want the channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel open after Close()")
+	}
+}
+
+// treeConn keeps the nodes created, with their flags
+type treeConn struct {
+	conn
+	mu    sync.Mutex
+	nodes map[string]int32
+	seq   int
+
+	watches map[string][]chan zk.Event
+}
+
+func (tc *treeConn) Exists(path string) (bool, *zk.Stat, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	_, ok := tc.nodes[path]
+	return ok, &zk.Stat{}, nil
+}
+
+func (tc *treeConn) Create(path string, _ []byte, flags int32, _ []zk.ACL) (string, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if _, ok := tc.nodes[path]; ok && flags&zk.FlagSequence == 0 {
+		return "", zk.ErrNodeExists
+	}
+
+	if flags&zk.FlagSequence != 0 {
+		path = fmt.Sprintf("%s%010d", path, tc.seq)
+		tc.seq++
+	}
+	tc.nodes[path] = flags
+	return path, nil
+}
+
+func TestDriver_Create(t *testing.T) {
+	var (
+		tc = &treeConn{nodes: map[string]int32{"/services": 0}}
+		d  = NewZKDriver(nil).(*Driver)
+	)
+	d.conn = tc
+
+	if err := d.CreateEphemeral("/services/search/host-1", []byte("10.0.0.1")); err != nil {
+		t.Fatalf("CreateEphemeral() error = %v", err)
+	}
+	if err := d.CreateEphemeral("/services/search/host-1", nil); err == nil {
+		t.Error("CreateEphemeral() of an existing node error = nil")
+	}
+
+	for i := 0; i < 2; i++ {
+		path, err := d.CreateSequential("/election/leader-", nil)
+		if want := fmt.Sprintf("/election/leader-%010d", i); err != nil || path != want {
+			t.Errorf("CreateSequential() = %q, %v, want %q", path, err, want)
+		}
+	}
+
+	want := map[string]int32{
+		"/services":                   0,
+		"/services/search":            0,
+		"/services/search/host-1":     zk.FlagEphemeral,
+		"/election":                   0,
+		"/election/leader-0000000000": zk.FlagSequence,
+		"/election/leader-0000000001": zk.FlagSequence,
+	}
+	if fmt.Sprint(tc.nodes) != fmt.Sprint(want) {
+		t.Errorf("nodes = %v, want %v", tc.nodes, want)
+	}
+}
@@ -0,0 +1,49 @@
+package endpoint
+
+import (
+	"context"
+)
+
+// ContextExtractor returns cx with the values extracted from the request,
+// e.g. the tenant or the locale, or cx as is when the request has none
+type ContextExtractor func(cx context.Context, req interface{}) context.Context
+
+// ValueExtractor is a ContextExtractor setting a single value under key,
+// when fn finds one in the request
+func ValueExtractor(key interface{}, fn func(req interface{}) (interface{}, bool)) ContextExtractor {
+	return func(cx context.Context, req interface{}) context.Context {
+		if v, ok := fn(req); ok {
+			return context.WithValue(cx, key, v)
+		}
+		return cx
+	}
+}
+
+// ContextEnricherMiddleware returns a Middleware which runs the extractors
+// on the request before next, so the values are in the context of the
+// endpoint & everything it calls, whatever the transport. e.g.
+//
+//	endpoint.ContextEnricherMiddleware(
+//		endpoint.ValueExtractor(tenantKey, func(req interface{}) (interface{}, bool) {
+//			r, ok := req.(interface{ Tenant() string })
+//			if !ok {
+//				return nil, false
+//			}
+//			return r.Tenant(), true
+//		}),
+//	)
+//
+// Middlewares run after the transport decoded the request, the extractors
+// see the typed request, not the http.Request or the kafka message.
+// Each extractor gets the context of the ones before, an extractor using
+// the value of another must come after it, others can be in any order
+func ContextEnricherMiddleware(extractors ...ContextExtractor) Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(cx context.Context, req interface{}) (interface{}, error) {
+			for _, fn := range extractors {
+				cx = fn(cx, req)
+			}
+			return next(cx, req)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+)
+
+type enrichKey string
+
+type enrichRequest struct{ tenant, locale string }
+
+func TestContextEnricherMiddleware(t *testing.T) {
+	field := func(get func(enrichRequest) string) func(interface{}) (interface{}, bool) {
+		return func(req interface{}) (interface{}, bool) {
+			r, ok := req.(enrichRequest)
+			if !ok || get(r) == "" {
+				return nil, false
+			}
+			return get(r), true
+		}
+	}
+
+	mw := ContextEnricherMiddleware(
+		ValueExtractor(enrichKey("tenant"), field(func(r enrichRequest) string { return r.tenant })),
+		ValueExtractor(enrichKey("locale"), field(func(r enrichRequest) string { return r.locale })),
+		// depends on the tenant extracted before
+		func(cx context.Context, _ interface{}) context.Context {
+			if tenant, ok := cx.Value(enrichKey("tenant")).(string); ok {
+				return context.WithValue(cx, enrichKey("index"), "idx-"+tenant)
+			}
+			return cx
+		},
+	)
+
+	ep := mw(func(cx context.Context, _ interface{}) (interface{}, error) {
+		return []interface{}{
+			cx.Value(enrichKey("tenant")),
+			cx.Value(enrichKey("locale")),
+			cx.Value(enrichKey("index")),
+		}, nil
+	})
+
+	tests := []struct {
+		name string
+		req  interface{}
+		want []interface{}
+	}{
+		{"all", enrichRequest{"acme", "en"}, []interface{}{"acme", "en", "idx-acme"}},
+		{"partial", enrichRequest{locale: "fr"}, []interface{}{nil, "fr", nil}},
+		{"other request", "raw", []interface{}{nil, nil, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _ := ep(context.Background(), tt.req)
+
+			got := res.([]interface{})
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("value #%d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
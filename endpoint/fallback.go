@@ -0,0 +1,38 @@
+package endpoint
+
+import (
+	"context"
+)
+
+type (
+	// FallbackFunc produces a degraded response for the request when
+	// the endpoint fails with err
+	FallbackFunc func(cx context.Context, req interface{}, err error) (interface{}, error)
+
+	// FallbackDecider reports if the error should be served by the fallback
+	FallbackDecider func(err error) bool
+)
+
+// FallbackMiddleware returns a Middleware which calls fallback when next
+// fails with an error matching shouldFallback, returning a degraded
+// response instead of the error. Errors which don't match are passed
+// through unchanged. nil shouldFallback falls back on every error.
+//
+// Unlike the circuit breaker's fallback, this works for any error, not
+// just the ones returned when the circuit is open.
+func FallbackMiddleware(fallback FallbackFunc, shouldFallback FallbackDecider) Middleware {
+	if shouldFallback == nil {
+		shouldFallback = func(error) bool { return true }
+	}
+
+	return func(next Endpoint) Endpoint {
+		return func(cx context.Context, req interface{}) (interface{}, error) {
+			res, err := next(cx, req)
+			if err == nil || !shouldFallback(err) {
+				return res, err
+			}
+
+			return fallback(cx, req, err)
+		}
+	}
+}
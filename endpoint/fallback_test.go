@@ -0,0 +1,51 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+func TestFallbackMiddleware(t *testing.T) {
+	var (
+		errDegraded = errors.New("degraded")
+		errFatal    = errors.New("fatal")
+	)
+
+	mw := FallbackMiddleware(
+		func(cx context.Context, req interface{}, err error) (interface{}, error) {
+			return "default", nil
+		},
+		func(err error) bool { return errors.Is(err, errDegraded) },
+	)
+
+	tests := []struct {
+		name    string
+		err     error
+		want    interface{}
+		wantErr error
+	}{
+		{"success", nil, "ok", nil},
+		{"fallback", errors.Wrap(errDegraded, "upstream"), "default", nil},
+		{"passthrough", errFatal, "partial", errFatal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := mw(func(context.Context, interface{}) (interface{}, error) {
+				if tt.err == nil {
+					return "ok", nil
+				}
+				return "partial", tt.err
+			})
+
+			got, err := ep(context.Background(), nil)
+			if err != tt.wantErr {
+				t.Errorf("Endpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Endpoint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
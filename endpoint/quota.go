@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/rate"
+)
+
+// ErrQuotaExceeded is returned by QuotaMiddleware for the calls over the
+// quota of their key
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+const quotaKeyPrefix = "quota:"
+
+type (
+	// Quota is the usage of the quota of a key in the current window
+	Quota struct {
+		Key   string
+		Limit int64
+		Used  int64
+		// Reset is when the window ends & the usage resets
+		Reset time.Time
+	}
+
+	quotaContextKey struct{}
+)
+
+// Remaining returns the calls left in the window
+func (q Quota) Remaining() int64 {
+	if q.Used >= q.Limit {
+		return 0
+	}
+	return q.Limit - q.Used
+}
+
+// ContextWithQuota returns cx with room for the quota of the call, so the
+// layers around the endpoint, e.g. the response encoder of the HTTP
+// transport, see it with QuotaFromContext
+func ContextWithQuota(cx context.Context) context.Context {
+	return context.WithValue(cx, quotaContextKey{}, &Quota{})
+}
+
+// QuotaFromContext returns the quota of the call checked by
+// QuotaMiddleware, ok is false for calls it didn't check
+func QuotaFromContext(cx context.Context) (q Quota, ok bool) {
+	qt, ok := cx.Value(quotaContextKey{}).(*Quota)
+	if !ok || qt.Key == "" {
+		return Quota{}, false
+	}
+	return *qt, true
+}
+
+// QuotaMiddleware returns a Middleware allowing up to limit calls per key
+// in each window, e.g. the calls of a tenant in a month with
+// rate.MonthlyQuotaWindow. Calls over it fail with ErrQuotaExceeded, they
+// count towards the usage too. The usage resets at the end of the window.
+// Calls without a key aren't counted. The call fails when the store does,
+// as the limiters do. The quota is available with QuotaFromContext, see
+// ContextWithQuota for the layers outside the endpoint
+//
+// Unlike the rate limiters, which smooth out bursts, quotas bound the
+// total consumption of a key
+func QuotaMiddleware(
+	store rate.QuotaStore,
+	keyFunc func(cx context.Context, req interface{}) string,
+	limit int64,
+	window rate.QuotaWindow,
+) Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(cx context.Context, req interface{}) (interface{}, error) {
+			key := keyFunc(cx, req)
+			if key == "" {
+				return next(cx, req)
+			}
+
+			now := time.Now()
+			start, end := window(now)
+
+			used, err := store.Incr(
+				cx,
+				quotaKeyPrefix+key+":"+strconv.FormatInt(start.Unix(), 10),
+				1,
+				end.Sub(now),
+			)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to count the quota")
+			}
+
+			quota := Quota{Key: key, Limit: limit, Used: used, Reset: end}
+
+			if qt, ok := cx.Value(quotaContextKey{}).(*Quota); ok {
+				*qt = quota
+			} else {
+				cx = context.WithValue(cx, quotaContextKey{}, &quota)
+			}
+
+			if used > limit {
+				return nil, errors.Wrapf(ErrQuotaExceeded, "%s: %d of %d", key, used, limit)
+			}
+
+			return next(cx, req)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/cache"
+	"github.com/unbxd/go-base/v2/rate"
+)
+
+func TestQuotaMiddleware(t *testing.T) {
+	inmem, _ := cache.NewInMemoryCache(time.Minute, time.Minute)
+
+	var (
+		start  = time.Now().Truncate(time.Second)
+		end    = start.Add(time.Hour)
+		window = func(time.Time) (time.Time, time.Time) { return start, end }
+		tenant = func(_ context.Context, req interface{}) string { return req.(string) }
+	)
+
+	ep := QuotaMiddleware(rate.NewCacheQuotaStore(inmem), tenant, 2, window)(
+		func(cx context.Context, _ interface{}) (interface{}, error) {
+			q, _ := QuotaFromContext(cx)
+			return q.Remaining(), nil
+		},
+	)
+
+	for i, want := range []int64{1, 0} {
+		if res, err := ep(context.Background(), "acme"); res != want || err != nil {
+			t.Errorf("call #%d = %v, %v, want %d remaining", i, res, err, want)
+		}
+	}
+
+	// the layers around the endpoint see the quota of rejected calls too
+	cx := ContextWithQuota(context.Background())
+	if _, err := ep(cx, "acme"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("call over the quota error = %v, want ErrQuotaExceeded", err)
+	}
+
+	q, ok := QuotaFromContext(cx)
+	if !ok || q.Remaining() != 0 || q.Used != 3 || !q.Reset.Equal(end) {
+		t.Errorf("QuotaFromContext() = %+v, %v, want none remaining till %s", q, ok, end)
+	}
+
+	if _, err := ep(context.Background(), "globex"); err != nil {
+		t.Errorf("call of another tenant error = %v, want nil", err)
+	}
+
+	// a new window resets the usage
+	start, end = end, end.Add(time.Hour)
+	if _, err := ep(context.Background(), "acme"); err != nil {
+		t.Errorf("call in the next window error = %v, want nil", err)
+	}
+
+	if res, err := ep(context.Background(), ""); err != nil || res != int64(0) {
+		t.Errorf("call without a key = %v, %v, want it passed through", res, err)
+	}
+}
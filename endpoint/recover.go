@@ -0,0 +1,40 @@
+package endpoint
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// ErrPanic is wrapped by the errors of the endpoints which panicked,
+// see Recover
+var ErrPanic = errors.New("endpoint panicked")
+
+// Recover returns a Middleware which recovers the panics of next, logs
+// them with the stack & returns them as errors wrapping ErrPanic, so
+// they are handled as any other error of the endpoint. It recovers the
+// panics of the middlewares it wraps too, so it goes first in a Chain
+func Recover(logger log.Logger) Middleware {
+	return func(next Endpoint) Endpoint {
+		return func(cx context.Context, req interface{}) (res interface{}, err error) {
+			defer func() {
+				rc := recover()
+				if rc == nil {
+					return
+				}
+
+				logger.Error(
+					"panic: endpoint",
+					log.Reflect("error", rc),
+					log.String("stackTrace", string(debug.Stack())),
+				)
+
+				res, err = nil, errors.Wrapf(ErrPanic, "%v", rc)
+			}()
+
+			return next(cx, req)
+		}
+	}
+}
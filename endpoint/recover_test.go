@@ -0,0 +1,25 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestRecover(t *testing.T) {
+	mw := Recover(log.NewNoopLogger())
+
+	res, err := mw(func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})(context.Background(), nil)
+	if res != nil || !errors.Is(err, ErrPanic) {
+		t.Errorf("Endpoint() = %v, %v, want %v", res, err, ErrPanic)
+	}
+
+	res, err = mw(NopEndpoint)(context.Background(), nil)
+	if res != struct{}{} || err != nil {
+		t.Errorf("Endpoint() = %v, %v, want the response", res, err)
+	}
+}
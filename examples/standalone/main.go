@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"flag"
+	"io"
+	clog "log"
+	net_http "net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/unbxd/go-base/v2/app"
+	"github.com/unbxd/go-base/v2/data/driver/inmem"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
+	"github.com/unbxd/go-base/v2/transport/http"
+)
+
+/*
+	This example is a tool running as a single binary, without redis,
+	nats or zookeeper. app.Standalone gives the in-memory implementations
+	of the services, seeded with the config embedded below.
+
+	$ go run . -port 4444
+	$ curl localhost:4444/config/greeting
+	$ curl -d 'buy milk' localhost:4444/notes
+	$ curl localhost:4444/debug/vars
+*/
+
+//go:embed config.json
+var config []byte
+
+func main() {
+	var (
+		port     = flag.String("port", "4444", "port to listen on")
+		level    = flag.String("log-level", "info", "log level")
+		override = flag.String("config", "", "JSON file overriding the embedded config")
+	)
+	flag.Parse()
+
+	driverOptions := []inmem.DriverOption{inmem.WithJSON(config)}
+	if *override != "" {
+		driverOptions = append(driverOptions, inmem.WithFile(*override))
+	}
+
+	var svc *app.Services
+
+	// the notes are delivered to the handler in the process, moving to
+	// nats is a change of constructor for svc.Notifier
+	logNote := func(_ context.Context, data interface{}) error {
+		svc.Logger.Info("note", log.String("text", data.(string)))
+		return nil
+	}
+
+	svc, err := app.Standalone(
+		app.WithLogLevel(*level),
+		app.WithRateLimit(1, 5),
+		app.WithDriverOptions(driverOptions...),
+		app.WithNotifyHandlers(logNote),
+	)
+	if err != nil {
+		clog.Fatal("error init services: ", err)
+	}
+	defer svc.Close()
+
+	tr, err := http.NewHTTPTransport(
+		"standalone-example",
+		http.WithCustomHostPort("0.0.0.0", *port),
+		http.WithCustomLogger(svc.Logger),
+		http.WithFilters(http.RateLimitFilter(svc.Limiter, nil,
+			http.WithRateLimitSkipPaths("/ping", "/debug/vars"),
+			http.WithRateLimitMetrics(svc.Metrics),
+		)),
+	)
+	if err != nil {
+		clog.Fatal("error init server: ", err)
+	}
+
+	reads := svc.Metrics.NewCounter("config.reads", 1)
+
+	// the config, read from the driver & cached
+	tr.Get("/config/{key}", func(cx context.Context, req *net_http.Request) (*net_http.Response, error) {
+		key := "/config/" + http.Parameters(req).ByName("key")
+
+		if val, ok := svc.Cache.Get(cx, key); ok {
+			return http.NewResponse(req, http.ResponseWithBytes(val)), nil
+		}
+
+		val, err := svc.Driver.ReadContext(cx, key)
+		if err != nil {
+			return http.NewResponse(req,
+				http.ResponseWithCode(net_http.StatusNotFound),
+				http.ResponseWithBytes([]byte(err.Error())),
+			), nil
+		}
+
+		reads.Add(1)
+		svc.Cache.Set(cx, key, val)
+		return http.NewResponse(req, http.ResponseWithBytes(val)), nil
+	})
+
+	// the notes, notified to the handlers in the process
+	tr.Post("/notes", func(cx context.Context, req *net_http.Request) (*net_http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := svc.Notifier.Notify(cx, strings.TrimSpace(string(body))); err != nil {
+			return nil, err
+		}
+		return http.NewResponse(req,
+			http.ResponseWithCode(net_http.StatusAccepted),
+			http.ResponseWithBytes([]byte("noted")),
+		), nil
+	})
+
+	// the metrics, published with expvar
+	if h, ok := svc.Metrics.(metrics.Handler); ok {
+		tr.Mux().Handler(net_http.MethodGet, "/debug/vars", h.Handler())
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		_ = tr.Close()
+	}()
+
+	svc.Logger.Info("listening", log.String("port", *port))
+	if err := tr.Open(); err != nil && err != net_http.ErrServerClosed {
+		clog.Fatal("error serving: ", err)
+	}
+}
@@ -0,0 +1,43 @@
+// Package health defines how the components of a process, e.g. the kafka
+// & nats consumers, report their health, so a single endpoint of the http
+// transport reflects the whole process
+package health
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// Status is the health of a component at a point in time
+	Status struct {
+		// Healthy is false when the component can't do its work
+		Healthy bool `json:"healthy"`
+
+		// Connected is false when the component lost its broker or server
+		Connected bool `json:"connected"`
+
+		// LastProcessed is when the last message was processed, zero if
+		// none was yet
+		LastProcessed time.Time `json:"last_processed,omitempty"`
+
+		// Lag is the number of messages waiting to be processed, -1 when
+		// unknown
+		Lag int64 `json:"lag"`
+
+		// Detail explains an unhealthy status
+		Detail string `json:"detail,omitempty"`
+	}
+
+	// Reporter is implemented by the components reporting their health,
+	// Health must be cheap & return quickly, it runs on every probe
+	Reporter interface {
+		Health(cx context.Context) Status
+	}
+
+	// ReporterFunc is a func adapter for Reporter
+	ReporterFunc func(cx context.Context) Status
+)
+
+// Health calls fn
+func (fn ReporterFunc) Health(cx context.Context) Status { return fn(cx) }
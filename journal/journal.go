@@ -0,0 +1,241 @@
+// Package journal is a crash journal of the requests in flight. It keeps
+// a fixed number of slots in a memory-mapped file, a request takes a slot
+// when it starts and marks it complete when it ends. The pages of the
+// mapping belong to the kernel, they survive the process being killed
+// (OOM, SIGKILL, a fatal panic) and the slots still marked in flight are
+// the requests which were running when the process died, see Recover.
+//
+// The file is never synced, a power loss or kernel crash loses it, only
+// the death of the process is covered.
+package journal
+
+import (
+	"encoding/binary"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const (
+	magic = "GBJRNL\x00\x01"
+
+	headerSize = 64
+	slotSize   = 256
+
+	// slot layout
+	offWord     = 0
+	offStart    = 8
+	offRouteLen = 16
+	offIDLen    = 18
+	offRoute    = 20
+	maxRoute    = 160
+	offID       = offRoute + maxRoute
+	maxID       = 64
+
+	// states, the low bits of the slot word. The rest of the word is the
+	// sequence of the request, so a slot taken over by a newer request
+	// isn't completed by the older one
+	stateEmpty    = 0
+	stateWriting  = 1
+	stateInFlight = 2
+	stateDone     = 3
+	stateBits     = 2
+	stateMask     = 1<<stateBits - 1
+)
+
+var (
+	// ErrInvalidSlots is returned by Open for non-positive slots
+	ErrInvalidSlots = errors.New("journal: slots should be positive")
+	// ErrCorrupt is returned by Recover for files which aren't journals
+	ErrCorrupt = errors.New("journal: file is not a journal or is corrupt")
+	// ErrUnsupported is returned by Open on platforms without mmap
+	ErrUnsupported = errors.New("journal: not supported on this platform")
+)
+
+type (
+	// Journal is a ring of slots in a memory-mapped file. Begin & End are
+	// lock-free, safe for concurrent use and don't allocate
+	Journal struct {
+		file  *os.File
+		data  []byte
+		slots uint64
+
+		seq    uint64
+		closed int32
+	}
+
+	// Entry is the slot taken by a request, End marks it complete. The
+	// zero Entry is valid and does nothing
+	Entry struct {
+		j    *Journal
+		off  int
+		word uint64
+	}
+
+	// InFlightRecord is a request found in flight by Recover
+	InFlightRecord struct {
+		Slot      int
+		Route     string
+		RequestID string
+		Start     time.Time
+	}
+)
+
+func (j *Journal) word(off int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&j.data[off+offWord]))
+}
+
+// Begin takes the next slot for the request. Slots are reused in a ring,
+// a request running longer than it takes for all the slots to be taken
+// again is overwritten, so slots should be well above the concurrency of
+// the server
+func (j *Journal) Begin(route, requestID string, start time.Time) Entry {
+	if atomic.LoadInt32(&j.closed) == 1 {
+		return Entry{}
+	}
+
+	var (
+		seq = atomic.AddUint64(&j.seq, 1)
+		off = headerSize + int((seq-1)%j.slots)*slotSize
+		wd  = j.word(off)
+	)
+
+	if len(route) > maxRoute {
+		route = route[:maxRoute]
+	}
+	if len(requestID) > maxID {
+		requestID = requestID[:maxID]
+	}
+
+	atomic.StoreUint64(wd, seq<<stateBits|stateWriting)
+
+	slot := j.data[off : off+slotSize]
+	binary.NativeEndian.PutUint64(slot[offStart:], uint64(start.UnixNano()))
+	binary.NativeEndian.PutUint16(slot[offRouteLen:], uint16(len(route)))
+	binary.NativeEndian.PutUint16(slot[offIDLen:], uint16(len(requestID)))
+	copy(slot[offRoute:offRoute+maxRoute], route)
+	copy(slot[offID:offID+maxID], requestID)
+
+	word := seq<<stateBits | stateInFlight
+	atomic.StoreUint64(wd, word)
+
+	return Entry{j, off, word}
+}
+
+// End marks the request complete, unless its slot has been taken over
+func (e Entry) End() {
+	if e.j == nil || atomic.LoadInt32(&e.j.closed) == 1 {
+		return
+	}
+
+	atomic.CompareAndSwapUint64(
+		e.j.word(e.off), e.word, e.word&^stateMask|stateDone,
+	)
+}
+
+// Close unmaps & closes the file. Requests still running must not call
+// End after Close
+func (j *Journal) Close() error {
+	if !atomic.CompareAndSwapInt32(&j.closed, 0, 1) {
+		return nil
+	}
+
+	if err := munmap(j.data); err != nil {
+		_ = j.file.Close()
+		return errors.Wrap(err, "journal: munmap failed")
+	}
+
+	return j.file.Close()
+}
+
+// Open creates the journal at path with the given number of slots, an
+// existing file is truncated, so Recover it first
+func Open(path string, slots int) (*Journal, error) {
+	if slots <= 0 {
+		return nil, ErrInvalidSlots
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "journal: failed to open")
+	}
+
+	size := headerSize + slots*slotSize
+	if err := file.Truncate(int64(size)); err != nil {
+		_ = file.Close()
+		return nil, errors.Wrap(err, "journal: failed to size the file")
+	}
+
+	data, err := mmap(file, size)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	copy(data, magic)
+	binary.NativeEndian.PutUint32(data[8:], slotSize)
+	binary.NativeEndian.PutUint32(data[12:], uint32(slots))
+
+	return &Journal{file: file, data: data, slots: uint64(slots)}, nil
+}
+
+// Recover reads the journal left at path by the previous run and returns
+// the requests which were still in flight, oldest first. A missing file
+// has nothing to recover. The file is left as is, Open truncates it
+func Recover(path string) ([]InFlightRecord, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "journal: failed to read")
+	case len(data) == 0:
+		return nil, nil
+	case len(data) < headerSize || string(data[:len(magic)]) != magic:
+		return nil, ErrCorrupt
+	}
+
+	var (
+		ssize = int(binary.NativeEndian.Uint32(data[8:]))
+		slots = int(binary.NativeEndian.Uint32(data[12:]))
+	)
+
+	if ssize != slotSize || len(data) != headerSize+slots*slotSize {
+		return nil, ErrCorrupt
+	}
+
+	var records []InFlightRecord
+	for i := 0; i < slots; i++ {
+		slot := data[headerSize+i*slotSize : headerSize+(i+1)*slotSize]
+
+		if binary.NativeEndian.Uint64(slot[offWord:])&stateMask != stateInFlight {
+			continue
+		}
+
+		var (
+			rl = int(binary.NativeEndian.Uint16(slot[offRouteLen:]))
+			il = int(binary.NativeEndian.Uint16(slot[offIDLen:]))
+		)
+
+		if rl > maxRoute || il > maxID {
+			return nil, ErrCorrupt
+		}
+
+		records = append(records, InFlightRecord{
+			Slot:      i,
+			Route:     string(slot[offRoute : offRoute+rl]),
+			RequestID: string(slot[offID : offID+il]),
+			Start:     time.Unix(0, int64(binary.NativeEndian.Uint64(slot[offStart:]))),
+		})
+	}
+
+	sort.Slice(records, func(a, b int) bool {
+		return records[a].Start.Before(records[b].Start)
+	})
+
+	return records, nil
+}
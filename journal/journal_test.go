@@ -0,0 +1,142 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJournalRecover(t *testing.T) {
+	var (
+		path  = filepath.Join(t.TempDir(), "journal")
+		start = time.Unix(1700000000, 0)
+	)
+
+	jr, err := Open(path, 4)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	jr.Begin("GET /done", "r1", start).End()
+	jr.Begin("GET /slow", "r2", start.Add(time.Second))
+	jr.Begin("POST /crash", "r3", start)
+
+	// the process dies here, without End or Close, the mapping has it all
+	got, err := Recover(path)
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+
+	want := []InFlightRecord{
+		{Slot: 2, Route: "POST /crash", RequestID: "r3", Start: start},
+		{Slot: 1, Route: "GET /slow", RequestID: "r2", Start: start.Add(time.Second)},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Recover() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Slot != want[i].Slot || got[i].Route != want[i].Route ||
+			got[i].RequestID != want[i].RequestID || !got[i].Start.Equal(want[i].Start) {
+			t.Errorf("Recover()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// reopening truncates
+	_ = jr.Close()
+	if jr, err = Open(path, 4); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer jr.Close()
+
+	if got, _ := Recover(path); len(got) != 0 {
+		t.Errorf("Recover() after Open = %+v, want none", got)
+	}
+}
+
+func TestJournalWraparound(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	jr, err := Open(path, 2)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer jr.Close()
+
+	var (
+		now = time.Now()
+		old = jr.Begin("GET /old", "r1", now)
+	)
+
+	jr.Begin("GET /a", "r2", now).End()
+
+	// takes over the slot of r1, which is still running
+	jr.Begin("GET /"+string(make([]byte, 300)), "r3", now)
+
+	// r1 completing mustn't mark r3 done
+	old.End()
+
+	got, _ := Recover(path)
+	if len(got) != 1 || got[0].RequestID != "r3" || got[0].Slot != 0 || len(got[0].Route) != maxRoute {
+		t.Errorf("Recover() = %+v, want r3 in slot 0 with truncated route", got)
+	}
+}
+
+func TestJournalConcurrent(t *testing.T) {
+	jr, err := Open(filepath.Join(t.TempDir(), "journal"), 64)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer jr.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 1000; k++ {
+				jr.Begin("GET /x", "id", time.Now()).End()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := Recover(jr.file.Name()); len(got) != 0 {
+		t.Errorf("Recover() = %d records, want none", len(got))
+	}
+}
+
+func TestRecoverErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if got, err := Recover(filepath.Join(dir, "missing")); got != nil || err != nil {
+		t.Errorf("Recover() of missing file = %v, %v, want nothing", got, err)
+	}
+
+	bad := filepath.Join(dir, "bad")
+	_ = os.WriteFile(bad, []byte("not a journal, not at all, no way, certainly not a journal file"), 0o644)
+
+	if _, err := Recover(bad); err != ErrCorrupt {
+		t.Errorf("Recover() error = %v, want %v", err, ErrCorrupt)
+	}
+
+	if _, err := Open(filepath.Join(dir, "j"), 0); err != ErrInvalidSlots {
+		t.Errorf("Open() error = %v, want %v", err, ErrInvalidSlots)
+	}
+}
+
+func BenchmarkJournal(b *testing.B) {
+	jr, err := Open(filepath.Join(b.TempDir(), "journal"), 1024)
+	if err != nil {
+		b.Fatalf("Open() error = %v", err)
+	}
+	defer jr.Close()
+
+	now := time.Now()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		jr.Begin("GET /products/search", "0b6b1c1e-8e53-4c1b-a1a0-3f3bd5b5f2c7", now).End()
+	}
+}
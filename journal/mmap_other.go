@@ -0,0 +1,9 @@
+//go:build !unix
+
+package journal
+
+import "os"
+
+func mmap(*os.File, int) ([]byte, error) { return nil, ErrUnsupported }
+
+func munmap([]byte) error { return nil }
@@ -0,0 +1,23 @@
+//go:build unix
+
+package journal
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+func mmap(file *os.File, size int) ([]byte, error) {
+	data, err := syscall.Mmap(
+		int(file.Fd()), 0, size,
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "journal: mmap failed")
+	}
+	return data, nil
+}
+
+func munmap(data []byte) error { return syscall.Munmap(data) }
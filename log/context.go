@@ -0,0 +1,69 @@
+package log
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	// contextField maps the value of a context key to a field
+	contextField struct {
+		key  interface{}
+		name string
+	}
+
+	contextFields struct {
+		mu     sync.RWMutex
+		fields []contextField
+	}
+)
+
+// registered are the context keys logged by FromContext
+var registered = &contextFields{}
+
+// RegisterContextField logs the value of key in the context as the field
+// name, for the loggers returned by FromContext. Registering a key again
+// renames its field, e.g. transport/http registers its request id as
+// request_id
+func RegisterContextField(key interface{}, name string) {
+	registered.mu.Lock()
+	defer registered.mu.Unlock()
+
+	for i, cf := range registered.fields {
+		if cf.key == key {
+			registered.fields[i].name = name
+			return
+		}
+	}
+
+	registered.fields = append(registered.fields, contextField{key, name})
+}
+
+// FromContext returns the logger of the context, see FromCtx, with the
+// values of the registered context keys found in cx as fields, see
+// RegisterContextField. Without a logger in the context it is a noop
+// logger, never nil
+func FromContext(cx context.Context) Logger {
+	logger := FromCtx(cx)
+
+	registered.mu.RLock()
+	defer registered.mu.RUnlock()
+
+	var fields []Field
+	for _, cf := range registered.fields {
+		switch v := cx.Value(cf.key).(type) {
+		case nil:
+		case string:
+			if v != "" {
+				fields = append(fields, String(cf.name, v))
+			}
+		default:
+			fields = append(fields, Reflect(cf.name, v))
+		}
+	}
+
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
+}
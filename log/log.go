@@ -2,8 +2,10 @@ package log
 
 import (
 	"context"
+	"time"
 
 	kit_log "github.com/go-kit/log"
+	"github.com/unbxd/go-base/v2/units"
 )
 
 // FieldType defines the type for a field
@@ -19,6 +21,9 @@ const (
 	STRING
 	ERROR
 	FLOAT
+	DURATION
+	TIME
+	BYTESTRING
 )
 
 // Field defines a standard Key-Value pair used to populate
@@ -71,6 +76,66 @@ func Float(key string, value float64) Field {
 	return Field{Key: key, Type: FLOAT, Value: value}
 }
 
+// Duration is for durations, logged as units.FormatDuration renders
+// them, e.g. "1.5s" or "2m30s", whatever the logger
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Type: DURATION, Integer: int64(value)}
+}
+
+// Bytes is for byte sizes, logged as units.FormatBytes renders them,
+// e.g. "512KiB"
+func Bytes(key string, value int64) Field {
+	return String(key, units.FormatBytes(value))
+}
+
+// Time is for timestamps, logged in the format configured for the logger
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Type: TIME, Value: value}
+}
+
+// ByteString is for UTF-8 encoded bytes, logged as a string
+func ByteString(key string, value []byte) Field {
+	return Field{Key: key, Type: BYTESTRING, Value: value}
+}
+
+// time returns the value of a TIME field, kept in Value by Time. It is
+// false for values which aren't times, the loggers log them as is
+func (f Field) time() (time.Time, bool) {
+	t, ok := f.Value.(time.Time)
+	return t, ok
+}
+
+// bytes returns the value of a BYTESTRING field, kept in Value by
+// ByteString. It is false for values which aren't bytes
+func (f Field) bytes() ([]byte, bool) {
+	bt, ok := f.Value.([]byte)
+	return bt, ok
+}
+
+// float returns the value of a FLOAT field, kept in Value by Float. It is
+// false for values which aren't floats, the loggers log them as is
+func (f Field) float() (float64, bool) {
+	switch v := f.Value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// err returns the value of an ERROR field, kept in Value by Error. It is
+// false for values which aren't errors, the loggers log them as is. A nil
+// error isn't logged
+func (f Field) err() (error, bool) {
+	if f.Value == nil {
+		return nil, true
+	}
+
+	err, ok := f.Value.(error)
+	return err, ok
+}
+
 // Reflect returns a field for which the value is undetermined
 func Reflect(key string, value interface{}) Field {
 	return Field{Key: key, Type: UNKNOWN, Value: value}
@@ -102,6 +167,32 @@ type Logger interface {
 	WithContext(cx context.Context) context.Context
 }
 
+// GroupLogger is a Logger which can namespace its fields, implemented by
+// the loggers of this package. It is optional for the other loggers, see
+// WithGroup
+type GroupLogger interface {
+	Logger
+
+	// WithGroup namespaces the fields added after it, both with With
+	// and at the call site, under name. Groups nest and are rendered
+	// as nested objects, e.g.
+	//
+	//	logger.WithGroup("http").Info("served", log.Int("status", 200))
+	//	// {"msg":"served","http":{"status":200}}
+	//
+	// Empty name returns the logger as is
+	WithGroup(name string) Logger
+}
+
+// WithGroup namespaces the fields of logger under name if it is a
+// GroupLogger, other loggers are returned as is & log the fields flat
+func WithGroup(logger Logger, name string) Logger {
+	if gl, ok := logger.(GroupLogger); ok {
+		return gl.WithGroup(name)
+	}
+	return logger
+}
+
 // Ctx returns the logger wrapped in the Context
 func FromCtx(cx context.Context) Logger {
 	if logger, ok := cx.Value(ctxKey{}).(Logger); ok {
@@ -1,9 +1,18 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestString(t *testing.T) {
@@ -59,7 +68,7 @@ func TestInt64(t *testing.T) {
 		args args
 		want Field
 	}{
-		{"integers", args{"random-int", 123}, Field{Key: "random-int", Type: INT, Integer: 123}},
+		{"integers", args{"random-int", 123}, Field{Key: "random-int", Type: INT64, Integer: 123}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -157,3 +166,332 @@ func TestReflect(t *testing.T) {
 		})
 	}
 }
+
+// flatLogger is a Logger without groups
+type flatLogger struct{ Logger }
+
+func TestWithGroup(t *testing.T) {
+	for _, gl := range []Logger{&zapLogger{}, &zeroLogger{}, &noopLogger{}} {
+		if _, ok := gl.(GroupLogger); !ok {
+			t.Errorf("%T isn't a GroupLogger", gl)
+		}
+	}
+
+	fl := flatLogger{NewNoopLogger()}
+	if got := WithGroup(fl, "http"); got != Logger(fl) {
+		t.Errorf("WithGroup() of a flat logger = %v, want it as is", got)
+	}
+
+	var (
+		zbuf bytes.Buffer
+		rbuf bytes.Buffer
+	)
+
+	zl := &zapLogger{zapLogger: zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&zbuf),
+		zap.DebugLevel,
+	))}
+
+	loggers := map[string]struct {
+		logger Logger
+		buf    *bytes.Buffer
+	}{
+		"zap":     {zl, &zbuf},
+		"zerolog": {&zeroLogger{logger: zerolog.New(&rbuf)}, &rbuf},
+	}
+
+	want := []map[string]interface{}{
+		{
+			"svc": "api",
+			"http": map[string]interface{}{
+				"method":   "GET",
+				"upstream": map[string]interface{}{"host": "search"},
+			},
+		},
+		{
+			"svc":  "api",
+			"http": map[string]interface{}{"method": "GET", "status": float64(200)},
+		},
+	}
+
+	for name, lg := range loggers {
+		t.Run(name, func(t *testing.T) {
+			hl := WithGroup(lg.logger.With(String("svc", "api")), "http").With(String("method", "GET"))
+
+			WithGroup(WithGroup(hl, ""), "upstream").Info("served", String("host", "search"))
+			hl.Info("served", Int("status", 200))
+
+			lines := strings.Split(strings.TrimSpace(lg.buf.String()), "\n")
+			if len(lines) != len(want) {
+				t.Fatalf("got %d lines, want %d", len(lines), len(want))
+			}
+
+			for ix, line := range lines {
+				var got map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &got); err != nil {
+					t.Fatalf("invalid json %q: %v", line, err)
+				}
+
+				for k, v := range want[ix] {
+					if !reflect.DeepEqual(got[k], v) {
+						t.Errorf("WithGroup() %s = %v, want %v", k, got[k], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFieldsParity(t *testing.T) {
+	var (
+		zbuf bytes.Buffer
+		rbuf bytes.Buffer
+	)
+
+	zl := &zapLogger{zapLogger: zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&zbuf),
+		zap.DebugLevel,
+	))}
+
+	loggers := map[string]struct {
+		logger Logger
+		buf    *bytes.Buffer
+	}{
+		"zap":     {zl, &zbuf},
+		"zerolog": {&zeroLogger{logger: zerolog.New(&rbuf)}, &rbuf},
+	}
+
+	fields := []Field{
+		String("string", "v"),
+		Int("int", 1),
+		Int64("int64", 2),
+		Bool("bool", true),
+		Float("float", 1.5),
+		Error(errors.New("boom")),
+		Reflect("reflect", map[string]int{"a": 1}),
+		{Key: "float32", Type: FLOAT, Value: float32(0.5)},
+		{Key: "nil_float", Type: FLOAT},
+		{Key: "not_float", Type: FLOAT, Value: "1.5"},
+	}
+
+	want := map[string]interface{}{
+		"string":    "v",
+		"int":       float64(1),
+		"int64":     float64(2),
+		"bool":      true,
+		"float":     1.5,
+		"error":     "boom",
+		"reflect":   map[string]interface{}{"a": float64(1)},
+		"float32":   0.5,
+		"nil_float": nil,
+		"not_float": "1.5",
+	}
+
+	for name, lg := range loggers {
+		t.Run(name, func(t *testing.T) {
+			lg.logger.Info("fields", fields...)
+			lg.logger.With(fields...).Info("with")
+			lg.logger.With(Error(nil)).Info("nil error", Error(nil))
+
+			lines := strings.Split(strings.TrimSpace(lg.buf.String()), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("got %d lines, want 3", len(lines))
+			}
+
+			for ix, line := range lines {
+				var got map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &got); err != nil {
+					t.Fatalf("invalid json %q: %v", line, err)
+				}
+
+				if ix == 2 {
+					if _, ok := got["error"]; ok {
+						t.Errorf("Error(nil) logged %v, want nothing", got["error"])
+					}
+					continue
+				}
+
+				for k, v := range want {
+					if gv, ok := got[k]; !ok || !reflect.DeepEqual(gv, v) {
+						t.Errorf("line %d: %s = %v, want %v", ix, k, gv, v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestZeroLoggerWithConsoleWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	cfg := &zeroLoggerConfig{level: zerolog.InfoLevel, writer: &buf}
+	for _, o := range []ZeroLoggerOption{ZeroLoggerWithConsoleWriter(), ZeroLoggerWithCaller()} {
+		if err := o(cfg); err != nil {
+			t.Fatalf("option error = %v", err)
+		}
+	}
+
+	lg, _ := cfg.build()
+	lg.Debug("hidden")
+	lg.Info("served", String("path", "/search"))
+
+	out := buf.String()
+	for _, want := range []string{"INF", "served", "path=", "/search", "log_test.go"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q, want %q in it", out, want)
+		}
+	}
+	if strings.Contains(out, "hidden") || strings.HasPrefix(out, "{") {
+		t.Errorf("output %q, want a line at info & above, not JSON", out)
+	}
+
+	// exclusive with the async sink, in any order
+	if _, err := NewZeroLogger(ZeroLoggerWithConsoleWriter(), ZeroLoggerWithAsyncSink(10, time.Millisecond, nil)); err == nil {
+		t.Error("NewZeroLogger() with the console writer & the async sink error = nil")
+	}
+	if _, err := NewZeroLogger(ZeroLoggerWithAsyncSink(10, time.Millisecond, nil), ZeroLoggerWithConsoleWriter()); err == nil {
+		t.Error("NewZeroLogger() with the async sink & the console writer error = nil")
+	}
+}
+
+func TestTypedFields(t *testing.T) {
+	var (
+		zbuf bytes.Buffer
+		rbuf bytes.Buffer
+		at   = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	zl := &zapLogger{zapLogger: zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&zbuf),
+		zap.DebugLevel,
+	))}
+
+	fields := []Field{
+		Duration("took", 1500*time.Millisecond),
+		Bytes("size", 512<<10),
+		Time("at", at),
+		ByteString("body", []byte(`{"q":"shoe"}`)),
+	}
+
+	// each logger formats the times as configured, the durations are
+	// rendered the same by all
+	loggers := map[string]struct {
+		logger Logger
+		buf    *bytes.Buffer
+		want   map[string]interface{}
+	}{
+		"zap": {zl, &zbuf, map[string]interface{}{
+			"took": "1.5s",
+			"size": "512KiB",
+			"at":   float64(at.UnixNano()) / float64(time.Second),
+			"body": `{"q":"shoe"}`,
+		}},
+		"zerolog": {&zeroLogger{logger: zerolog.New(&rbuf)}, &rbuf, map[string]interface{}{
+			"took": "1.5s",
+			"size": "512KiB",
+			"at":   at.Format(time.RFC3339),
+			"body": `{"q":"shoe"}`,
+		}},
+	}
+
+	for name, lg := range loggers {
+		t.Run(name, func(t *testing.T) {
+			lg.logger.Info("fields", fields...)
+
+			// the fields are carried by With & through the context
+			cx := lg.logger.With(fields...).WithContext(context.Background())
+			FromCtx(cx).Info("with")
+
+			lines := strings.Split(strings.TrimSpace(lg.buf.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("got %d lines, want 2", len(lines))
+			}
+
+			for _, line := range lines {
+				var got map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &got); err != nil {
+					t.Fatalf("invalid json %q: %v", line, err)
+				}
+
+				for k, v := range lg.want {
+					if !reflect.DeepEqual(got[k], v) {
+						t.Errorf("%s %s = %v, want %v", got["msg"], k, got[k], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestZeroLoggerDebugf(t *testing.T) {
+	for level, want := range map[zerolog.Level]string{
+		zerolog.InfoLevel:  "",
+		zerolog.DebugLevel: `{"level":"debug","message":"took 3ms"}` + "\n",
+	} {
+		var buf bytes.Buffer
+
+		cfg := &zeroLoggerConfig{level: level, writer: &buf}
+		lg, _ := cfg.build()
+		lg.Debugf("took %dms", 3)
+
+		if got := buf.String(); got != want {
+			t.Errorf("Debugf() at %s = %q, want %q", level, got, want)
+		}
+	}
+}
+
+func TestZeroLoggerWithSampling(t *testing.T) {
+	var buf bytes.Buffer
+
+	cfg := &zeroLoggerConfig{level: zerolog.DebugLevel, writer: &buf}
+	if err := ZeroLoggerWithSampling(2, time.Hour)(cfg); err != nil {
+		t.Fatalf("ZeroLoggerWithSampling() error = %v", err)
+	}
+
+	lg, _ := cfg.build()
+	for i := 0; i < 3; i++ {
+		lg.Debug("debug")
+		lg.Info("info")
+		lg.Error("error")
+	}
+
+	// the burst is shared by debug & info, the errors are never sampled
+	for msg, want := range map[string]int{`"debug"`: 1, `"info"`: 1, `"error"`: 3} {
+		if got := strings.Count(buf.String(), `"message":`+msg); got != want {
+			t.Errorf("%s logged %d times, want %d", msg, got, want)
+		}
+	}
+
+	if _, err := NewZeroLogger(ZeroLoggerWithSampling(0, time.Second)); err == nil {
+		t.Error("NewZeroLogger() without a burst error = nil")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	type ctxField string
+
+	var buf bytes.Buffer
+
+	RegisterContextField(ctxField("tenant"), "site")
+	RegisterContextField(ctxField("rid"), "rid")
+	RegisterContextField(ctxField("rid"), "request_id")
+
+	// without a logger it is still usable
+	if lg := FromContext(context.WithValue(context.Background(), ctxField("rid"), "r1")); lg == nil {
+		t.Fatal("FromContext() = nil, want a noop logger")
+	}
+
+	cx := (&zeroLogger{logger: zerolog.New(&buf)}).WithContext(context.Background())
+	cx = context.WithValue(cx, ctxField("rid"), "r1")
+	cx = context.WithValue(cx, ctxField("other"), "ignored")
+
+	FromContext(cx).Info("served")
+
+	got := buf.String()
+	if !strings.Contains(got, `"request_id":"r1"`) || strings.Contains(got, "site") || strings.Contains(got, "ignored") {
+		t.Errorf("FromContext().Info() = %q, want the request_id only", got)
+	}
+}
@@ -15,6 +15,7 @@ func (nl *noopLogger) Errorf(string, ...interface{})                  {}
 func (nl *noopLogger) Debugf(string, ...interface{})                  {}
 func (nl *noopLogger) Flush() error                                   { return nil }
 func (nl *noopLogger) With(...Field) Logger                           { return &noopLogger{} }
+func (nl *noopLogger) WithGroup(string) Logger                        { return &noopLogger{} }
 func (nl *noopLogger) WithContext(cx context.Context) context.Context { return cx }
 func (nl *noopLogger) Log(keyvals ...interface{}) error               { return nil }
 
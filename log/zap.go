@@ -2,7 +2,9 @@ package log
 
 import (
 	"context"
+	"time"
 
+	"github.com/unbxd/go-base/v2/units"
 	"go.uber.org/zap"
 )
 
@@ -26,14 +28,30 @@ func (zl *zapLogger) convert(fields ...Field) []zap.Field {
 			}
 			zfields = append(zfields, zap.Bool(fl.Key, bl))
 		case ERROR:
-			if fl.Value != nil {
-				zfields = append(zfields, zap.Error(fl.Value.(error)))
+			if err, ok := fl.err(); ok {
+				zfields = append(zfields, zap.Error(err))
 			} else {
-				zfields = append(zfields, zap.Error(nil))
+				zfields = append(zfields, zap.Any(fl.Key, fl.Value))
 			}
 		case FLOAT:
-			if fl.Value != nil {
-				zfields = append(zfields, zap.Float64(fl.Key, fl.Value.(float64)))
+			if fv, ok := fl.float(); ok {
+				zfields = append(zfields, zap.Float64(fl.Key, fv))
+			} else {
+				zfields = append(zfields, zap.Any(fl.Key, fl.Value))
+			}
+		case DURATION:
+			zfields = append(zfields, zap.String(fl.Key, units.FormatDuration(time.Duration(fl.Integer))))
+		case TIME:
+			if t, ok := fl.time(); ok {
+				zfields = append(zfields, zap.Time(fl.Key, t))
+			} else {
+				zfields = append(zfields, zap.Any(fl.Key, fl.Value))
+			}
+		case BYTESTRING:
+			if bt, ok := fl.bytes(); ok {
+				zfields = append(zfields, zap.ByteString(fl.Key, bt))
+			} else {
+				zfields = append(zfields, zap.Any(fl.Key, fl.Value))
 			}
 		case INT64:
 			fallthrough
@@ -97,12 +115,19 @@ func (zl *zapLogger) With(fields ...Field) Logger {
 	return l
 }
 
-func (zl *zapLogger) WithContext(ctx context.Context) context.Context {
-	if _, ok := ctx.Value(ctxKey{}).(Logger); !ok {
-		// Do not store disabled logger.
-		return ctx
+// WithGroup opens a zap.Namespace, fields after it are nested under name
+func (zl *zapLogger) WithGroup(name string) Logger {
+	if name == "" {
+		return zl
 	}
-	return context.WithValue(ctx, ctxKey{}, &zl)
+	l := zl.clone()
+	l.zapLogger = l.zapLogger.With(zap.Namespace(name))
+	return l
+}
+
+// WithContext returns ctx carrying the logger, see FromCtx
+func (zl *zapLogger) WithContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKey{}, zl)
 }
 
 func (zl *zapLogger) clone() *zapLogger {
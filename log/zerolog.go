@@ -11,12 +11,23 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/diode"
+	"github.com/unbxd/go-base/v2/units"
 )
 
 type (
 	zeroLogger struct {
 		withStack bool
 		logger    zerolog.Logger
+
+		// zerolog can't nest fields added later under a key, so the
+		// groups & their fields are kept aside and rendered as nested
+		// dicts on every event
+		groups []zeroGroup
+	}
+
+	zeroGroup struct {
+		name   string
+		fields []Field
 	}
 
 	zeroLoggerConfig struct {
@@ -24,6 +35,12 @@ type (
 		writer     io.Writer
 		withCaller bool
 		withStack  bool
+		// console & async are exclusive, see ZeroLoggerWithConsoleWriter
+		console bool
+		async   bool
+		// sampler drops the debug & info events over the burst, see
+		// ZeroLoggerWithSampling
+		sampler zerolog.Sampler
 
 		fields []Field
 	}
@@ -43,11 +60,33 @@ func zerologEventFields(event *zerolog.Event, fields ...Field) *zerolog.Event {
 		case STRING:
 			event = event.Str(f.Key, f.String)
 		case FLOAT:
-			event = event.Float64(f.Key, f.Value.(float64))
+			if fv, ok := f.float(); ok {
+				event = event.Float64(f.Key, fv)
+			} else {
+				event = event.Interface(f.Key, f.Value)
+			}
 		case ERROR:
-			event = event.Err(f.Value.(error))
-		case UNKNOWN:
-			event = event.Any(f.Key, f.Value)
+			if err, ok := f.err(); ok {
+				event = event.Err(err)
+			} else {
+				event = event.Interface(f.Key, f.Value)
+			}
+		case DURATION:
+			event = event.Str(f.Key, units.FormatDuration(time.Duration(f.Integer)))
+		case TIME:
+			if t, ok := f.time(); ok {
+				event = event.Time(f.Key, t)
+			} else {
+				event = event.Interface(f.Key, f.Value)
+			}
+		case BYTESTRING:
+			if bt, ok := f.bytes(); ok {
+				event = event.Bytes(f.Key, bt)
+			} else {
+				event = event.Interface(f.Key, f.Value)
+			}
+		default:
+			event = event.Interface(f.Key, f.Value)
 		}
 	}
 
@@ -66,31 +105,75 @@ func zerologContextFields(cx zerolog.Context, fields ...Field) zerolog.Context {
 		case STRING:
 			cx = cx.Str(f.Key, f.String)
 		case FLOAT:
-			cx = cx.Float64(f.Key, f.Value.(float64))
+			if fv, ok := f.float(); ok {
+				cx = cx.Float64(f.Key, fv)
+			} else {
+				cx = cx.Interface(f.Key, f.Value)
+			}
 		case ERROR:
-			cx = cx.Err(f.Value.(error))
-		case UNKNOWN:
-			// do nothing
+			if err, ok := f.err(); ok {
+				cx = cx.Err(err)
+			} else {
+				cx = cx.Interface(f.Key, f.Value)
+			}
+		case DURATION:
+			cx = cx.Str(f.Key, units.FormatDuration(time.Duration(f.Integer)))
+		case TIME:
+			if t, ok := f.time(); ok {
+				cx = cx.Time(f.Key, t)
+			} else {
+				cx = cx.Interface(f.Key, f.Value)
+			}
+		case BYTESTRING:
+			if bt, ok := f.bytes(); ok {
+				cx = cx.Bytes(f.Key, bt)
+			} else {
+				cx = cx.Interface(f.Key, f.Value)
+			}
+		default:
+			// UNKNOWN & the rest are logged as is, as by zap
+			cx = cx.Interface(f.Key, f.Value)
 		}
 	}
 	return cx
 }
 
+// fields adds the fields to the event, inside the groups if any
+func (z *zeroLogger) fields(event *zerolog.Event, fields ...Field) *zerolog.Event {
+	if len(z.groups) == 0 || event == nil {
+		return zerologEventFields(event, fields...)
+	}
+
+	var (
+		last = len(z.groups) - 1
+		dict = zerologEventFields(zerolog.Dict(), z.groups[last].fields...)
+	)
+
+	dict = zerologEventFields(dict, fields...)
+
+	for ix := last - 1; ix >= 0; ix-- {
+		parent := zerologEventFields(zerolog.Dict(), z.groups[ix].fields...)
+		dict = parent.Dict(z.groups[ix+1].name, dict)
+	}
+
+	return event.Dict(z.groups[0].name, dict)
+}
+
 func (z *zeroLogger) Info(msg string, fields ...Field) {
 	event := z.logger.Info()
-	event = zerologEventFields(event, fields...)
+	event = z.fields(event, fields...)
 	event.Msg(msg)
 }
 
 func (z *zeroLogger) Debug(msg string, fields ...Field) {
 	event := z.logger.Debug()
-	event = zerologEventFields(event, fields...)
+	event = z.fields(event, fields...)
 	event.Msg(msg)
 }
 
 func (z *zeroLogger) Warn(msg string, fields ...Field) {
 	event := z.logger.Warn()
-	event = zerologEventFields(event, fields...)
+	event = z.fields(event, fields...)
 	event.Msg(msg)
 }
 
@@ -101,24 +184,24 @@ func (z *zeroLogger) Error(msg string, fields ...Field) {
 		event = event.Stack()
 	}
 
-	event = zerologEventFields(event, fields...)
+	event = z.fields(event, fields...)
 	event.Msg(msg)
 }
 
 func (z *zeroLogger) Panic(msg string, fields ...Field) {
 	event := z.logger.Panic()
-	event = zerologEventFields(event, fields...)
+	event = z.fields(event, fields...)
 	event.Msg(msg)
 }
 
 func (z *zeroLogger) Fatal(msg string, fields ...Field) {
 	event := z.logger.Fatal()
-	event = zerologEventFields(event, fields...)
+	event = z.fields(event, fields...)
 	event.Msg(msg)
 }
 
 func (z *zeroLogger) Infof(msg string, vals ...interface{}) {
-	z.logger.Info().Msgf(msg, vals...)
+	z.fields(z.logger.Info()).Msgf(msg, vals...)
 }
 
 func (z *zeroLogger) Errorf(msg string, vals ...interface{}) {
@@ -128,19 +211,36 @@ func (z *zeroLogger) Errorf(msg string, vals ...interface{}) {
 		event = event.Stack()
 	}
 
-	event.Msgf(msg, vals...)
+	z.fields(event).Msgf(msg, vals...)
 }
 func (z *zeroLogger) Debugf(msg string, vals ...interface{}) {
-	z.logger.Error().Msgf(msg, vals...)
+	z.fields(z.logger.Debug()).Msgf(msg, vals...)
 }
 
 func (z *zeroLogger) Flush() error { return nil }
 
 func (z *zeroLogger) With(fields ...Field) Logger {
+	if len(z.groups) > 0 {
+		groups := append([]zeroGroup(nil), z.groups...)
+		last := &groups[len(groups)-1]
+		last.fields = append(append([]Field(nil), last.fields...), fields...)
+		return &zeroLogger{z.withStack, z.logger, groups}
+	}
+
 	cx := z.logger.With()
 	cx = zerologContextFields(cx, fields...)
 	sublogger := cx.Logger()
-	return &zeroLogger{z.withStack, sublogger}
+	return &zeroLogger{z.withStack, sublogger, nil}
+}
+
+// WithGroup nests the fields added after it in a dict under name
+func (z *zeroLogger) WithGroup(name string) Logger {
+	if name == "" {
+		return z
+	}
+
+	groups := append(append([]zeroGroup(nil), z.groups...), zeroGroup{name: name})
+	return &zeroLogger{z.withStack, z.logger, groups}
 }
 
 func (z *zeroLogger) WithContext(ctx context.Context) context.Context {
@@ -149,7 +249,7 @@ func (z *zeroLogger) WithContext(ctx context.Context) context.Context {
 		// Do not store disabled logger.
 		return ctx
 	}
-	return context.WithValue(ctx, ctxKey{}, &z)
+	return context.WithValue(ctx, ctxKey{}, z)
 }
 
 func (z *zeroLogger) Log(keyvals ...interface{}) error {
@@ -237,6 +337,10 @@ func ZeroLoggerWithAsyncSink(
 			return errors.New("no writer set, configure a writer first")
 		}
 
+		if zl.console {
+			return errConsoleAsync
+		}
+
 		w := diode.NewWriter(
 			zl.writer,
 			size,
@@ -245,6 +349,42 @@ func ZeroLoggerWithAsyncSink(
 		)
 
 		zl.writer = w
+		zl.async = true
+		return nil
+	}
+}
+
+var errConsoleAsync = errors.New("console writer & async sink can't be used together")
+
+// ZeroLoggerWithConsoleWriter writes human readable, colorized lines with
+// the time instead of JSON, for local development only, it is a lot
+// slower. The level, the caller & the fields are kept. It can't be used
+// with the async sink, whatever the order of the options
+func ZeroLoggerWithConsoleWriter() ZeroLoggerOption {
+	return func(zl *zeroLoggerConfig) error {
+		if zl.async {
+			return errConsoleAsync
+		}
+
+		zl.console = true
+		return nil
+	}
+}
+
+var errSampling = errors.New("sampling needs a burst & a period")
+
+// ZeroLoggerWithSampling caps the debug & info events to burst in every
+// period, the ones over it are dropped. The warnings & above are always
+// logged. It applies after the level, to whichever writer is set
+func ZeroLoggerWithSampling(burst uint32, period time.Duration) ZeroLoggerOption {
+	return func(zl *zeroLoggerConfig) error {
+		if burst == 0 || period <= 0 {
+			return errSampling
+		}
+
+		// debug & info share the budget
+		bs := &zerolog.BurstSampler{Burst: burst, Period: period}
+		zl.sampler = zerolog.LevelSampler{DebugSampler: bs, InfoSampler: bs}
 		return nil
 	}
 }
@@ -271,11 +411,25 @@ func ZeroLoggerWithFields(fields ...Field) ZeroLoggerOption {
 }
 
 func (zlc *zeroLoggerConfig) build() (Logger, error) {
-	zlg := zerolog.New(zlc.writer)
+	writer := zlc.writer
+	if zlc.console {
+		writer = zerolog.ConsoleWriter{Out: writer, TimeFormat: time.TimeOnly}
+	}
+
+	zlg := zerolog.New(writer)
 	zlg = zlg.Level(zlc.level)
 
+	if zlc.sampler != nil {
+		zlg = zlg.Sample(zlc.sampler)
+	}
+
+	if zlc.console {
+		zlg = zlg.With().Timestamp().Logger()
+	}
+
 	if zlc.withCaller {
-		zlg = zlg.With().Caller().Logger()
+		// skips the frame of zeroLogger, the caller is the code logging
+		zlg = zlg.With().CallerWithSkipFrameCount(zerolog.CallerSkipFrameCount + 1).Logger()
 	}
 
 	if len(zlc.fields) > 0 {
@@ -284,7 +438,7 @@ func (zlc *zeroLoggerConfig) build() (Logger, error) {
 		zlg = cx.Logger()
 	}
 
-	return &zeroLogger{zlc.withStack, zlg}, nil
+	return &zeroLogger{zlc.withStack, zlg, nil}, nil
 }
 
 func NewZeroLogger(options ...ZeroLoggerOption) (Logger, error) {
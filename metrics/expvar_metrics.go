@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"expvar"
+	net_http "net/http"
+	"sync"
+
+	kit_expvar "github.com/go-kit/kit/metrics/expvar"
+)
+
+const defaultExpvarBuckets = 50
+
+// expvar variables are global to the process & can be published once,
+// metrics with the same name are shared by all the providers
+var expvars sync.Map
+
+type expvarMetrics struct{ buckets int }
+
+func expvarMetric[T any](name string, fn func() T) T {
+	if m, ok := expvars.Load(name); ok {
+		return m.(T)
+	}
+
+	m, _ := expvars.LoadOrStore(name, fn())
+	return m.(T)
+}
+
+func (em *expvarMetrics) NewCounter(name string, sampleRate float64) Counter {
+	return expvarMetric(name, func() *kit_expvar.Counter { return kit_expvar.NewCounter(name) })
+}
+
+func (em *expvarMetrics) NewHistogram(name string, sampleRate float64) Histogram {
+	return expvarMetric(name, func() *kit_expvar.Histogram { return kit_expvar.NewHistogram(name, em.buckets) })
+}
+
+func (em *expvarMetrics) NewGauge(name string) Gauge {
+	return expvarMetric(name, func() *kit_expvar.Gauge { return kit_expvar.NewGauge(name) })
+}
+
+// Handler serves the metrics, with the runtime memstats, as JSON
+func (em *expvarMetrics) Handler() net_http.Handler { return expvar.Handler() }
+
+// NewExpvarMetrics returns a Provider keeping the metrics in the process,
+// published with expvar & served by its Handler, for the tools without a
+// metrics backend. Labels are ignored, a name is either a counter, a
+// gauge or a histogram for the whole process
+func NewExpvarMetrics() Provider {
+	return &expvarMetrics{buckets: defaultExpvarBuckets}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
 	"github.com/unbxd/go-base/v2/endpoint"
 	"github.com/unbxd/go-base/v2/log"
 	"github.com/unbxd/go-base/v2/metrics"
 	cbplugins "github.com/unbxd/go-base/v2/net/cb/plugins"
+	"github.com/unbxd/go-base/v2/units"
 
 	"github.com/unbxd/go-base/v2/errors"
 	"github.com/unbxd/hystrix-go/hystrix"
@@ -20,21 +23,76 @@ import (
 type (
 	BreakerConf struct {
 		Enable       bool
-		Timeout      int
+		Timeout      int // in millis, Deprecated: use TimeoutStr
 		MaxConc      int
 		VolThrs      int
-		SlpWind      int
+		SlpWind      int // in millis, Deprecated: use SlpWindStr
 		ErrPerctThrs int
 		Prefix       string
+
+		// TimeoutStr & SlpWindStr are typed alternatives to Timeout
+		// and SlpWind, parsed using units.ParseDuration ("1s", "500ms").
+		// Bare integers are read as milliseconds. When set, these take
+		// precedence over the integer fields.
+		TimeoutStr string
+		SlpWindStr string
+
+		// Native uses the native breaker instead of hystrix, configured
+		// by the fields above & below, see WithNativeBreaker
+		Native         bool
+		WindowSize     int
+		ConsecFails    int
+		HalfOpenProbes int
+
+		// Commands overrides the config per command, by the name of the
+		// command with or without the prefix, or by a name ending with
+		// `*` matching the commands starting with the rest of it
+		Commands map[string]CommandConf
 	}
 
+	// CommandConf overrides the config of the breaker for a command,
+	// fields left zero keep the value of the breaker, see
+	// BreakerConf.Commands
+	CommandConf struct {
+		Timeout      int // in millis, Deprecated: use TimeoutStr
+		MaxConc      int
+		VolThrs      int
+		SlpWind      int // in millis, Deprecated: use SlpWindStr
+		ErrPerctThrs int
+
+		TimeoutStr string
+		SlpWindStr string
+
+		// native breaker only
+		WindowSize     int
+		ConsecFails    int
+		HalfOpenProbes int
+	}
+
+	// configured tracks the commands configured in hystrix, by the
+	// command with their name, with the overrides of the config by the
+	// pattern of the commands
 	configured struct {
-		in map[string]struct{}
-		mu sync.Mutex
+		in        map[string]string
+		overrides map[string]*CommandConf
+		mu        sync.Mutex
 	}
 
 	BreakerAfterFunc func(req interface{}, res interface{}, err error)
 
+	// State is the state of the circuit of a command
+	State int
+
+	// StateChangeFunc is called when the circuit of a command changes
+	// state, see WithOnStateChange
+	StateChangeFunc func(command string, from, to State)
+
+	// circuits tracks the state of the circuit per command
+	circuits struct {
+		in map[string]State
+		mu sync.Mutex
+	}
+
 	// Breaker wraps the endpointer and the command
 	// config required for the hysterix
 	Breaker struct {
@@ -42,9 +100,17 @@ type (
 		cmdcfg     *hystrix.CommandConfig
 		fn         endpoint.Endpoint
 		fallbackfn func(error) error
+		fallback   endpoint.Endpoint
 		cfgred     *configured
 		cmdPrefix  string
 		afterFunc  BreakerAfterFunc
+
+		onStateChange StateChangeFunc
+		circuits      *circuits
+
+		nativeConf nativeConf
+		// natives are the native circuits, nil with hystrix
+		natives *nativeCircuits
 	}
 
 	// BreakerOption is options that modify the Breaker
@@ -57,6 +123,53 @@ type (
 	}
 )
 
+// States of the circuit
+const (
+	// StateClosed lets the requests through
+	StateClosed State = iota
+	// StateOpen rejects the requests, till the sleep window passes
+	StateOpen
+	// StateHalfOpen has a single probe request let through, which
+	// closes the circuit if it succeeds & opens it again otherwise
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// transition moves the circuit of cmd to state to if it is in state from
+func (cs *circuits) transition(cmd string, from, to State) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.in[cmd] != from {
+		return false
+	}
+
+	cs.in[cmd] = to
+	return true
+}
+
+// transition moves the circuit of cmd and calls onStateChange
+func (b *Breaker) transition(cmd string, from, to State) bool {
+	if !b.circuits.transition(cmd, from, to) {
+		return false
+	}
+
+	b.onStateChange(cmd, from, to)
+	return true
+}
+
 func (cf *configured) Has(cmd string) bool {
 	cf.mu.Lock()
 	defer cf.mu.Unlock()
@@ -65,11 +178,87 @@ func (cf *configured) Has(cmd string) bool {
 	return ok
 }
 
-func (cf *configured) Add(cmd string) {
+func (cf *configured) Add(cmd, name string) {
 	cf.mu.Lock()
 	defer cf.mu.Unlock()
 
-	cf.in[cmd] = struct{}{}
+	cf.in[cmd] = name
+}
+
+// configure configures cmd in hystrix the first time it is seen, with the
+// override for the command if there is one & def otherwise
+func (cf *configured) configure(cmd, name string, def *hystrix.CommandConfig) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if _, ok := cf.in[cmd]; ok {
+		return
+	}
+
+	hystrix.ConfigureCommand(cmd, cf.config(cmd, name, def))
+	cf.in[cmd] = name
+}
+
+// matches tells if pattern is cmd or its name, or ends with `*` and
+// either starts with the rest of it
+func matches(pattern, cmd, name string) bool {
+	if pattern == cmd || pattern == name {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	return ok && (strings.HasPrefix(cmd, prefix) || strings.HasPrefix(name, prefix))
+}
+
+// override returns the override of cmd, the one set for cmd or its name
+// over the longest matching `*` pattern. It expects lock to be held
+func (cf *configured) override(cmd, name string) (*CommandConf, bool) {
+	for _, k := range []string{cmd, name} {
+		if ov, ok := cf.overrides[k]; ok {
+			return ov, true
+		}
+	}
+
+	var (
+		match *CommandConf
+		size  = -1
+	)
+
+	for pattern, ov := range cf.overrides {
+		if strings.HasSuffix(pattern, "*") && len(pattern) > size && matches(pattern, cmd, name) {
+			match, size = ov, len(pattern)
+		}
+	}
+
+	return match, match != nil
+}
+
+// config returns def with the override for cmd applied, it expects lock
+// to be held
+func (cf *configured) config(cmd, name string, def *hystrix.CommandConfig) hystrix.CommandConfig {
+	cfg := *def
+	if ov, ok := cf.override(cmd, name); ok {
+		// validated by WithCommandConfig
+		timeout, _ := millis(log.NewNoopLogger(), "timeout", ov.TimeoutStr, ov.Timeout)
+		sleepWindow, _ := millis(log.NewNoopLogger(), "sleep_window", ov.SlpWindStr, ov.SlpWind)
+
+		for _, f := range []struct {
+			dst *int
+			val int
+		}{
+			{&cfg.Timeout, timeout},
+			{&cfg.MaxConcurrentRequests, ov.MaxConc},
+			{&cfg.RequestVolumeThreshold, ov.VolThrs},
+			{&cfg.SleepWindow, sleepWindow},
+			{&cfg.ErrorPercentThreshold, ov.ErrPerctThrs},
+		} {
+			if f.val > 0 {
+				*f.dst = f.val
+			}
+		}
+	}
+
+	return cfg
 }
 
 func (b *Breaker) command(rqi interface{}) (string, error) {
@@ -116,22 +305,45 @@ func (b *Breaker) Endpoint() endpoint.Endpoint {
 			return b.fn(cx, rqi)
 		}
 
-		// check if there is a config for
-		// command name in hysterix
-		// _, ok = b.configured[]
-		// if !ok {
-		// 	hystrix.ConfigureCommand(cmd, *b.cmdcfg)
-		// }
-
-		if !b.cfgred.Has(cmd) {
-			hystrix.ConfigureCommand(
-				cmd, *b.cmdcfg,
-			)
-			b.cfgred.Add(cmd)
+		if b.natives != nil {
+			return b.native(cx, cmd, rqi.(Commander).Command(), rqi)
+		}
+
+		b.cfgred.configure(cmd, rqi.(Commander).Command(), b.cmdcfg)
+
+		var (
+			// the responses of the run & the fallback, the fallback may
+			// answer while the run is still going, e.g. on timeout
+			rc    = make(chan interface{}, 1)
+			fc    = make(chan interface{}, 1)
+			probe int32
+			// why the fallback ran, the error the caller would have got.
+			// hystrix runs the fallback at most once
+			causes = make(chan error, 1)
+		)
+
+		fallbackfn := b.fallbackfn
+		if b.fallback != nil {
+			fallbackfn = func(er error) error {
+				causes <- er
+
+				res, fer := b.fallback(cx, rqi)
+				if fer != nil {
+					return fer
+				}
+
+				fc <- res
+				return nil
+			}
 		}
 
-		rc := make(chan interface{}, 1)
 		ec := hystrix.Go(cmd, func() (er error) {
+			// hystrix lets a single request run while the circuit is
+			// open, once the sleep window has passed
+			if b.onStateChange != nil && b.transition(cmd, StateOpen, StateHalfOpen) {
+				atomic.StoreInt32(&probe, 1)
+			}
+
 			res, er := b.fn(cx, rqi)
 			if er != nil {
 				return er
@@ -139,19 +351,72 @@ func (b *Breaker) Endpoint() endpoint.Endpoint {
 
 			rc <- res
 			return
-		}, b.fallbackfn)
+		}, fallbackfn)
+
+		rsi, ran, err := settle(rc, fc, ec)
 
-		select {
-		case rsi = <-rc:
-			break
-		case err = <-ec:
-			break
+		var cause error
+		if !ran {
+			select {
+			case cause = <-causes:
+			default:
+			}
 		}
+
+		// hystrix wraps the error of a failed fallback, the caller gets
+		// the one which triggered it
+		if err != nil && cause != nil {
+			err = cause
+		}
+
+		if b.onStateChange != nil {
+			failure := err
+			if cause != nil {
+				failure = cause
+			}
+
+			switch {
+			case atomic.LoadInt32(&probe) == 1 && failure == nil:
+				b.transition(cmd, StateHalfOpen, StateClosed)
+			case atomic.LoadInt32(&probe) == 1:
+				b.transition(cmd, StateHalfOpen, StateOpen)
+			case failure == hystrix.ErrCircuitOpen:
+				b.transition(cmd, StateClosed, StateOpen)
+			}
+		}
+
 		b.afterFunc(rqi, rsi, err)
 		return
 	}
 }
 
+// settle returns the response of the run, of the fallback or the error of
+// hystrix, whichever comes first. A run which completed wins over the
+// others, hystrix may report its timeout as it ends
+func settle(rc, fc <-chan interface{}, ec <-chan error) (rsi interface{}, ran bool, err error) {
+	select {
+	case rsi = <-rc:
+		return rsi, true, nil
+	case rsi = <-fc:
+	case err = <-ec:
+	}
+
+	select {
+	case res := <-rc:
+		return res, true, nil
+	default:
+		return rsi, false, err
+	}
+}
+
+// Wrap returns the endpoint of the breaker around fn instead of the one
+// it was built with, the circuits of the commands are shared
+func (b *Breaker) Wrap(fn endpoint.Endpoint) endpoint.Endpoint {
+	bc := *b
+	bc.fn = fn
+	return bc.Endpoint()
+}
+
 // NewBreaker returns a circuit breaker
 func NewBreaker(fn endpoint.Endpoint, opts ...BreakerOption) (*Breaker, error) {
 	bk := &Breaker{
@@ -177,7 +442,11 @@ func NewBreaker(fn endpoint.Endpoint, opts ...BreakerOption) (*Breaker, error) {
 			ErrorPercentThreshold: hystrix.DefaultErrorPercentThreshold,
 		},
 		cfgred: &configured{
-			in: make(map[string]struct{}),
+			in:        make(map[string]string),
+			overrides: make(map[string]*CommandConf),
+		},
+		circuits: &circuits{
+			in: make(map[string]State),
 		},
 	}
 
@@ -187,6 +456,16 @@ func NewBreaker(fn endpoint.Endpoint, opts ...BreakerOption) (*Breaker, error) {
 		}
 	}
 
+	if bk.afterFunc == nil {
+		bk.afterFunc = func(interface{}, interface{}, error) {}
+	}
+
+	if bk.nativeConf.enable {
+		bk.natives = &nativeCircuits{in: make(map[string]*circuit)}
+		return bk, nil
+	}
+
+	registerStatsCollector()
 	return bk, nil
 }
 
@@ -271,6 +550,108 @@ func WithBreakerEnable(en bool) BreakerOption {
 	}
 }
 
+// WithOnStateChange calls fn when the circuit of a command changes state,
+// closed → open when requests start being rejected, open → half-open when
+// the probe is let through after the sleep window and half-open → closed
+// or open by the outcome of the probe. The command is the name given to
+// hystrix, i.e. with the prefix set by WithCommandPrefix.
+// The state is tracked from the requests of this breaker, fn is called
+// on the goroutine of the request, before it returns, so keep it short
+func WithOnStateChange(fn StateChangeFunc) BreakerOption {
+	return func(b *Breaker) (err error) {
+		b.onStateChange = fn
+		return
+	}
+}
+
+// WithStateChangeCallback is WithOnStateChange with the states by name,
+// "closed", "open" & "half-open", e.g. to tag metrics or logs
+func WithStateChangeCallback(fn func(command string, from, to string)) BreakerOption {
+	return WithOnStateChange(func(command string, from, to State) {
+		fn(command, from.String(), to.String())
+	})
+}
+
+// WithFallbackEndpoint serves the request with fn when the breaker fails
+// it, i.e. the circuit is open, the command timed out, is over its max
+// concurrency or the endpoint failed. The response of fn is returned in
+// place of the error, e.g. a stale cached response. If fn fails too, the
+// original error is returned, so hystrix.ErrCircuitOpen & others can
+// still be told apart
+func WithFallbackEndpoint(fn endpoint.Endpoint) BreakerOption {
+	return func(b *Breaker) (err error) {
+		b.fallback = fn
+		return
+	}
+}
+
+// validate checks the durations of the override
+func (cc *CommandConf) validate() error {
+	if _, err := millis(log.NewNoopLogger(), "timeout", cc.TimeoutStr, cc.Timeout); err != nil {
+		return err
+	}
+
+	_, err := millis(log.NewNoopLogger(), "sleep_window", cc.SlpWindStr, cc.SlpWind)
+	return err
+}
+
+// WithCommandConfig overrides the config of the breaker for command, the
+// name returned by Commander.Command, see BreakerConf.Commands for the
+// patterns. Fields left zero keep the value of the breaker, the fields
+// of BreakerConf missing in CommandConf are ignored. Commands without an
+// override use the config of the breaker
+func WithCommandConfig(command string, cfg *BreakerConf) BreakerOption {
+	return withCommandConf(command, CommandConf{
+		Timeout:        cfg.Timeout,
+		MaxConc:        cfg.MaxConc,
+		VolThrs:        cfg.VolThrs,
+		SlpWind:        cfg.SlpWind,
+		ErrPerctThrs:   cfg.ErrPerctThrs,
+		TimeoutStr:     cfg.TimeoutStr,
+		SlpWindStr:     cfg.SlpWindStr,
+		WindowSize:     cfg.WindowSize,
+		ConsecFails:    cfg.ConsecFails,
+		HalfOpenProbes: cfg.HalfOpenProbes,
+	})
+}
+
+func withCommandConf(pattern string, cfg CommandConf) BreakerOption {
+	return func(b *Breaker) error {
+		if err := cfg.validate(); err != nil {
+			return errors.Wrapf(err, "command %s", pattern)
+		}
+
+		b.cfgred.overrides[pattern] = &cfg
+		return nil
+	}
+}
+
+// Reconfigure overrides the config of the commands matching pattern at
+// runtime, see BreakerConf.Commands. The commands already run are
+// reconfigured in place, except for the max concurrency which hystrix
+// sets on the first run. The native circuits of the commands restart,
+// closed
+func (b *Breaker) Reconfigure(pattern string, cfg CommandConf) error {
+	if err := cfg.validate(); err != nil {
+		return errors.Wrapf(err, "command %s", pattern)
+	}
+
+	b.cfgred.mu.Lock()
+	b.cfgred.overrides[pattern] = &cfg
+
+	for cmd, name := range b.cfgred.in {
+		if matches(pattern, cmd, name) {
+			hystrix.ConfigureCommand(cmd, b.cfgred.config(cmd, name, b.cmdcfg))
+		}
+	}
+	b.cfgred.mu.Unlock()
+
+	if b.natives != nil {
+		b.natives.drop(pattern)
+	}
+	return nil
+}
+
 func WithBreakerAfterFunc(b BreakerAfterFunc) BreakerOption {
 	return func(tp *Breaker) (err error) {
 		tp.afterFunc = b
@@ -284,6 +665,32 @@ func fnfn(v int, opts *[]BreakerOption, fn func(int) BreakerOption) {
 	}
 }
 
+// millis resolves the duration config, preferring the typed field and
+// warning when both the typed & legacy fields are set inconsistently
+func millis(lg log.Logger, name, typed string, legacy int) (int, error) {
+	dur, conflict, err := units.ResolveDuration(typed, legacy, time.Millisecond)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid breaker config: %s", name)
+	}
+
+	if conflict && lg != nil {
+		lg.Warn(
+			"deprecated breaker config set along with typed config, using typed config",
+			log.String("config", name),
+			log.String("typed", typed),
+			log.Int("legacy_millis", legacy),
+			log.Duration("using", dur),
+		)
+	}
+
+	// hystrix counts in milliseconds, less would be read as unset
+	if dur > 0 && dur < time.Millisecond {
+		return 0, errors.Wrapf(units.ErrOutOfRange, "invalid breaker config: %s below 1ms", name)
+	}
+
+	return int(dur.Milliseconds()), nil
+}
+
 // NewBreakerFromConfig builds breaker from config
 func NewBreakerFromConfig(
 	fn endpoint.Endpoint, lg log.Logger, cfg *BreakerConf, opts ...BreakerOption,
@@ -299,12 +706,34 @@ func NewBreakerFromConfig(
 
 	*/
 
-	fnfn(cfg.Timeout, &opts, WithTimeout)
+	timeout, err := millis(lg, "timeout", cfg.TimeoutStr, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	sleepWindow, err := millis(lg, "sleep_window", cfg.SlpWindStr, cfg.SlpWind)
+	if err != nil {
+		return nil, err
+	}
+
+	fnfn(timeout, &opts, WithTimeout)
 	fnfn(cfg.MaxConc, &opts, WithMaxConcurrentRequests)
 	fnfn(cfg.VolThrs, &opts, WithRequestVolumeThreshold)
-	fnfn(cfg.SlpWind, &opts, WithSleepWindow)
+	fnfn(sleepWindow, &opts, WithSleepWindow)
 	fnfn(cfg.ErrPerctThrs, &opts, WithErrorPercentageThreshold)
 
+	for pattern, cc := range cfg.Commands {
+		opts = append(opts, withCommandConf(pattern, cc))
+	}
+
+	fnfn(cfg.WindowSize, &opts, WithSlidingWindow)
+	fnfn(cfg.ConsecFails, &opts, WithConsecutiveFailures)
+	fnfn(cfg.HalfOpenProbes, &opts, WithHalfOpenProbes)
+
+	if cfg.Native {
+		opts = append(opts, WithNativeBreaker())
+	}
+
 	opts = append(
 		opts,
 		WithBreakerEnable(cfg.Enable),
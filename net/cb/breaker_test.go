@@ -0,0 +1,590 @@
+package cb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/units"
+	"github.com/unbxd/hystrix-go/hystrix"
+)
+
+type command string
+
+func (c command) Command() string { return string(c) }
+
+// breakers are the implementations the tests of the breaker run over
+var breakers = []struct {
+	name    string
+	options []BreakerOption
+}{
+	{"hystrix", nil},
+	{"native", []BreakerOption{WithNativeBreaker()}},
+}
+
+// forEachBreaker runs test over each implementation with its options & a
+// command prefix of its own, as the circuits of hystrix are global
+func forEachBreaker(t *testing.T, prefix string, test func(t *testing.T, prefix string, options ...BreakerOption)) {
+	for _, bk := range breakers {
+		bk := bk
+		t.Run(bk.name, func(t *testing.T) {
+			test(t, prefix+"-"+bk.name, bk.options...)
+		})
+	}
+}
+
+// commandSettings returns the timeout & the max concurrency of the circuit
+// of cmd, false if it isn't created yet
+func commandSettings(b *Breaker, cmd string) (time.Duration, int, bool) {
+	if b.natives == nil {
+		st, ok := hystrix.GetCircuitSettings()[cmd]
+		if !ok {
+			return 0, 0, false
+		}
+		return st.Timeout, st.MaxConcurrentRequests, true
+	}
+
+	b.natives.mu.Lock()
+	defer b.natives.mu.Unlock()
+
+	cc, ok := b.natives.in[cmd]
+	if !ok {
+		return 0, 0, false
+	}
+	return cc.set.timeout, int(cc.set.maxConc), true
+}
+
+func TestWithOnStateChange(t *testing.T) {
+	forEachBreaker(t, "test", testWithOnStateChange)
+}
+
+func testWithOnStateChange(t *testing.T, prefix string, options ...BreakerOption) {
+	var (
+		mu          sync.Mutex
+		transitions []string
+		fail        = true
+		errDown     = errors.New("downstream is down")
+	)
+
+	b, err := NewBreaker(
+		func(context.Context, interface{}) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if fail {
+				return nil, errDown
+			}
+			return "ok", nil
+		},
+		append([]BreakerOption{
+			WithBreakerEnable(true),
+			WithCommandPrefix(prefix),
+			WithRequestVolumeThreshold(1),
+			WithErrorPercentageThreshold(1),
+			WithSleepWindow(50),
+			WithBreakerAfterFunc(func(interface{}, interface{}, error) {}),
+			WithOnStateChange(func(cmd string, from, to State) {
+				mu.Lock()
+				defer mu.Unlock()
+				transitions = append(transitions, fmt.Sprintf("%s: %s -> %s", cmd, from, to))
+			}),
+		}, options...)...,
+	)
+	if err != nil {
+		t.Fatalf("NewBreaker() error = %v", err)
+	}
+	defer hystrix.Flush()
+
+	ep := b.Endpoint()
+
+	// hystrix updates the health asynchronously, keep failing till the
+	// circuit opens
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := ep(context.Background(), command("state")); err == hystrix.ErrCircuitOpen {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("circuit didn't open")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := ep(context.Background(), command("state")); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+
+	want := []string{
+		prefix + "-state: closed -> open",
+		prefix + "-state: open -> half-open",
+		prefix + "-state: half-open -> closed",
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Errorf("transitions = %q, want %q", transitions, want)
+	}
+}
+
+func TestWithCommandConfig(t *testing.T) {
+	forEachBreaker(t, "override", testWithCommandConfig)
+
+	_, err := NewBreaker(nil, WithCommandConfig("bad", &BreakerConf{TimeoutStr: "soon"}))
+	if err == nil {
+		t.Errorf("NewBreaker() with an invalid override should fail")
+	}
+
+	_, err = NewBreaker(nil, WithCommandConfig("bad", &BreakerConf{TimeoutStr: "500us"}))
+	if !errors.Is(err, units.ErrOutOfRange) {
+		t.Errorf("NewBreaker() with a timeout below 1ms error = %v, want %v", err, units.ErrOutOfRange)
+	}
+}
+
+func testWithCommandConfig(t *testing.T, prefix string, options ...BreakerOption) {
+	b, err := NewBreakerFromConfig(
+		func(context.Context, interface{}) (interface{}, error) { return "ok", nil },
+		log.NewNoopLogger(),
+		&BreakerConf{Enable: true, Prefix: prefix, TimeoutStr: "500ms", MaxConc: 20},
+		append([]BreakerOption{
+			WithCommandConfig("slow", &BreakerConf{TimeoutStr: "5s"}),
+			WithBreakerAfterFunc(func(interface{}, interface{}, error) {}),
+		}, options...)...,
+	)
+	if err != nil {
+		t.Fatalf("NewBreakerFromConfig() error = %v", err)
+	}
+	defer hystrix.Flush()
+
+	ep := b.Endpoint()
+	for _, cmd := range []command{"slow", "fast"} {
+		if _, err := ep(context.Background(), cmd); err != nil {
+			t.Fatalf("endpoint(%s) error = %v", cmd, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		cmd     string
+		timeout time.Duration
+	}{
+		{prefix + "-slow", 5 * time.Second},
+		{prefix + "-fast", 500 * time.Millisecond},
+	} {
+		timeout, maxConc, ok := commandSettings(b, tt.cmd)
+		if !ok {
+			t.Fatalf("%s isn't configured", tt.cmd)
+		}
+
+		if timeout != tt.timeout || maxConc != 20 {
+			t.Errorf("%s settings = %s, %d, want timeout %s & the breaker's max concurrency", tt.cmd, timeout, maxConc, tt.timeout)
+		}
+	}
+}
+
+func TestBreakerConfCommands(t *testing.T) {
+	b, err := NewBreakerFromConfig(
+		func(context.Context, interface{}) (interface{}, error) { return "ok", nil },
+		log.NewNoopLogger(),
+		&BreakerConf{
+			Enable:     true,
+			Prefix:     "commands",
+			TimeoutStr: "1s",
+			Commands: map[string]CommandConf{
+				"search":            {TimeoutStr: "200ms"},
+				"commands-catalog*": {TimeoutStr: "2s"},
+				"car*":              {TimeoutStr: "3s"},
+			},
+		},
+		WithBreakerAfterFunc(func(interface{}, interface{}, error) {}),
+	)
+	if err != nil {
+		t.Fatalf("NewBreakerFromConfig() error = %v", err)
+	}
+	defer hystrix.Flush()
+
+	timeouts := func() map[string]time.Duration {
+		tm := make(map[string]time.Duration)
+		for cmd, st := range hystrix.GetCircuitSettings() {
+			if strings.HasPrefix(cmd, "commands-") {
+				tm[cmd] = st.Timeout
+			}
+		}
+		return tm
+	}
+
+	ep := b.Endpoint()
+	for _, cmd := range []command{"search", "catalog-v2", "cart", "browse"} {
+		if _, err := ep(context.Background(), cmd); err != nil {
+			t.Fatalf("endpoint(%s) error = %v", cmd, err)
+		}
+	}
+
+	want := map[string]time.Duration{
+		"commands-search":     200 * time.Millisecond,
+		"commands-catalog-v2": 2 * time.Second,
+		"commands-cart":       3 * time.Second,
+		"commands-browse":     time.Second,
+	}
+	if fmt.Sprint(timeouts()) != fmt.Sprint(want) {
+		t.Errorf("timeouts = %v, want %v", timeouts(), want)
+	}
+
+	if err := b.Reconfigure("search", CommandConf{TimeoutStr: "soon"}); err == nil {
+		t.Error("Reconfigure() with an invalid config error = nil")
+	}
+
+	// the commands already run are reconfigured
+	if err := b.Reconfigure("car*", CommandConf{TimeoutStr: "5s"}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+
+	want["commands-cart"] = 5 * time.Second
+	if fmt.Sprint(timeouts()) != fmt.Sprint(want) {
+		t.Errorf("timeouts after Reconfigure() = %v, want %v", timeouts(), want)
+	}
+}
+
+// warnLogger records the config of the deprecation warnings
+type warnLogger struct {
+	log.Logger
+	warned []string
+}
+
+func (wl *warnLogger) Warn(_ string, fields ...log.Field) {
+	for _, f := range fields {
+		if f.Key == "config" {
+			wl.warned = append(wl.warned, f.String)
+		}
+	}
+}
+
+func TestBreakerConfDualFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		typed   string
+		legacy  int
+		timeout time.Duration
+		warned  bool
+	}{
+		{"typed", "500ms", 0, 500 * time.Millisecond, false},
+		{"legacy", "", 300, 300 * time.Millisecond, false},
+		{"both agree", "1s", 1000, time.Second, false},
+		{"typed wins", "2s", 30, 2 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		lg := &warnLogger{Logger: log.NewNoopLogger()}
+
+		b, err := NewBreakerFromConfig(
+			func(context.Context, interface{}) (interface{}, error) { return "ok", nil },
+			lg,
+			&BreakerConf{Enable: true, Native: true, Prefix: "dual", TimeoutStr: tt.typed, Timeout: tt.legacy},
+		)
+		if err != nil {
+			t.Fatalf("%s: NewBreakerFromConfig() error = %v", tt.name, err)
+		}
+
+		if _, err := b.Endpoint()(context.Background(), command("search")); err != nil {
+			t.Fatalf("%s: endpoint error = %v", tt.name, err)
+		}
+
+		if timeout, _, _ := commandSettings(b, "dual-search"); timeout != tt.timeout {
+			t.Errorf("%s: timeout = %s, want %s", tt.name, timeout, tt.timeout)
+		}
+
+		if warned := len(lg.warned) == 1 && lg.warned[0] == "timeout"; warned != tt.warned || len(lg.warned) > 1 {
+			t.Errorf("%s: warned for %v, want a timeout warning %v", tt.name, lg.warned, tt.warned)
+		}
+	}
+
+	// the warning is skipped without a logger
+	_, err := NewBreakerFromConfig(nil, nil, &BreakerConf{TimeoutStr: "2s", Timeout: 30})
+	if err != nil {
+		t.Errorf("NewBreakerFromConfig() without a logger error = %v", err)
+	}
+}
+
+func TestWithFallbackEndpoint(t *testing.T) {
+	forEachBreaker(t, "fallback", testWithFallbackEndpoint)
+}
+
+func testWithFallbackEndpoint(t *testing.T, prefix string, options ...BreakerOption) {
+	var (
+		errDown      = errors.New("downstream is down")
+		errNoCache   = errors.New("nothing cached")
+		fallbackFail = false
+		mu           sync.Mutex
+	)
+
+	b, err := NewBreaker(
+		func(context.Context, interface{}) (interface{}, error) { return nil, errDown },
+		append([]BreakerOption{
+			WithBreakerEnable(true),
+			WithCommandPrefix(prefix),
+			WithRequestVolumeThreshold(1),
+			WithErrorPercentageThreshold(1),
+			WithSleepWindow(60000),
+			WithBreakerAfterFunc(func(interface{}, interface{}, error) {}),
+			WithFallbackEndpoint(func(context.Context, interface{}) (interface{}, error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if fallbackFail {
+					return nil, errNoCache
+				}
+				return "stale", nil
+			}),
+		}, options...)...,
+	)
+	if err != nil {
+		t.Fatalf("NewBreaker() error = %v", err)
+	}
+	defer hystrix.Flush()
+
+	ep := b.Endpoint()
+
+	if res, err := ep(context.Background(), command("cmd")); err != nil || res != "stale" {
+		t.Errorf("endpoint() = %v, %v, want the fallback response", res, err)
+	}
+
+	mu.Lock()
+	fallbackFail = true
+	mu.Unlock()
+
+	// a failed fallback returns the original error, till the circuit opens
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := ep(context.Background(), command("cmd"))
+		if err == hystrix.ErrCircuitOpen {
+			break
+		}
+
+		if err != errDown {
+			t.Fatalf("endpoint() error = %v, want %v", err, errDown)
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("circuit didn't open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	fallbackFail = false
+	mu.Unlock()
+
+	if res, err := ep(context.Background(), command("cmd")); err != nil || res != "stale" {
+		t.Errorf("endpoint() with the circuit open = %v, %v, want the fallback response", res, err)
+	}
+}
+
+func TestFallbackWithStateChangeCallback(t *testing.T) {
+	forEachBreaker(t, "callback", testFallbackWithStateChangeCallback)
+}
+
+func testFallbackWithStateChangeCallback(t *testing.T, prefix string, options ...BreakerOption) {
+	var (
+		mu          sync.Mutex
+		transitions []string
+	)
+
+	b, err := NewBreaker(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, errors.New("downstream is down")
+		},
+		append([]BreakerOption{
+			WithBreakerEnable(true),
+			WithCommandPrefix(prefix),
+			WithRequestVolumeThreshold(1),
+			WithErrorPercentageThreshold(1),
+			WithSleepWindow(60000),
+			WithBreakerAfterFunc(func(interface{}, interface{}, error) {}),
+			WithFallbackEndpoint(func(context.Context, interface{}) (interface{}, error) {
+				return "stale", nil
+			}),
+			WithStateChangeCallback(func(cmd, from, to string) {
+				mu.Lock()
+				defer mu.Unlock()
+				transitions = append(transitions, cmd+": "+from+" -> "+to)
+			}),
+		}, options...)...,
+	)
+	if err != nil {
+		t.Fatalf("NewBreaker() error = %v", err)
+	}
+	defer hystrix.Flush()
+
+	ep := b.Endpoint()
+
+	// the fallback answers while the forced errors open the circuit
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if res, err := ep(context.Background(), command("cmd")); err != nil || res != "stale" {
+			t.Fatalf("endpoint() = %v, %v, want the fallback response", res, err)
+		}
+
+		if st, ok := b.Stats()[prefix+"-cmd"]; ok && st.Open {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("circuit didn't open")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if res, err := ep(context.Background(), command("cmd")); err != nil || res != "stale" {
+		t.Errorf("endpoint() with the circuit open = %v, %v, want the fallback response", res, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if want := []string{prefix + "-cmd: closed -> open"}; fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Errorf("transitions = %q, want %q", transitions, want)
+	}
+}
+
+func TestBreaker_Stats(t *testing.T) {
+	forEachBreaker(t, "stats", testBreakerStats)
+}
+
+func testBreakerStats(t *testing.T, prefix string, options ...BreakerOption) {
+	var (
+		errDown = errors.New("downstream is down")
+		cmd     = prefix + "-search"
+	)
+
+	b, err := NewBreaker(
+		func(context.Context, interface{}) (interface{}, error) { return nil, errDown },
+		append([]BreakerOption{
+			WithBreakerEnable(true),
+			WithCommandPrefix(prefix),
+			WithRequestVolumeThreshold(2),
+			WithErrorPercentageThreshold(50),
+			WithSleepWindow(60000),
+			WithBreakerAfterFunc(func(interface{}, interface{}, error) {}),
+		}, options...)...,
+	)
+	if err != nil {
+		t.Fatalf("NewBreaker() error = %v", err)
+	}
+	defer hystrix.Flush()
+
+	ep := b.Endpoint()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !b.Stats()[cmd].Open {
+		_, _ = ep(context.Background(), command("search"))
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats() = %+v, want the circuit open", b.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// the counts lag behind Open, they settle once counted
+	for {
+		cs := b.Stats()[cmd]
+		if cs.Command == cmd && cs.Requests >= 2 && cs.Failures >= 2 && cs.ErrorPercent == 100 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats() = %+v, want the failures counted", cs)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := json.Marshal(b.Stats()); err != nil {
+		t.Errorf("json.Marshal(Stats()) error = %v", err)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	errTimeout := hystrix.ErrTimeout
+
+	// select picks at random among the ready channels
+	for i := 0; i < 100; i++ {
+		var (
+			rc = make(chan interface{}, 1)
+			fc = make(chan interface{}, 1)
+			ec = make(chan error, 1)
+		)
+
+		rc <- "ok"
+		fc <- "stale"
+		ec <- errTimeout
+
+		if rsi, ran, err := settle(rc, fc, ec); rsi != "ok" || !ran || err != nil {
+			t.Fatalf("settle() = %v, %v, %v, want the completed run", rsi, ran, err)
+		}
+	}
+
+	ec := make(chan error, 1)
+	ec <- errTimeout
+
+	if rsi, ran, err := settle(make(chan interface{}), make(chan interface{}), ec); rsi != nil || ran || err != errTimeout {
+		t.Errorf("settle() = %v, %v, %v, want the error", rsi, ran, err)
+	}
+}
+
+func TestBreakerRacyEndpoint(t *testing.T) {
+	forEachBreaker(t, "racy", testBreakerRacyEndpoint)
+}
+
+func testBreakerRacyEndpoint(t *testing.T, prefix string, options ...BreakerOption) {
+	// without WithBreakerAfterFunc
+	b, err := NewBreaker(
+		func(cx context.Context, rqi interface{}) (interface{}, error) {
+			// ends around the timeout
+			time.Sleep(time.Duration(rqi.(racy)) * time.Millisecond)
+			return "ok", nil
+		},
+		append([]BreakerOption{
+			WithBreakerEnable(true),
+			WithCommandPrefix(prefix),
+			WithTimeout(5),
+			WithMaxConcurrentRequests(100),
+			WithRequestVolumeThreshold(1000),
+		}, options...)...,
+	)
+	if err != nil {
+		t.Fatalf("NewBreaker() error = %v", err)
+	}
+	defer hystrix.Flush()
+
+	var (
+		wg sync.WaitGroup
+		ep = b.Endpoint()
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			rsi, err := ep(context.Background(), racy(3+i%5))
+			if (err == nil) != (rsi == "ok") {
+				t.Errorf("endpoint() = %v, %v, want either the response or the error", rsi, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+type racy int
+
+func (racy) Command() string { return "racy" }
@@ -0,0 +1,449 @@
+package cb
+
+import (
+	"context"
+	"io"
+	net_http "net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/unbxd/hystrix-go/hystrix"
+)
+
+// defaults of the native breaker
+const (
+	defaultWindowSize     = 100
+	defaultHalfOpenProbes = 1
+)
+
+type (
+	// nativeConf configures the native breaker, see WithNativeBreaker
+	nativeConf struct {
+		enable         bool
+		windowSize     int
+		consecFailures int
+		halfOpenProbes int
+	}
+
+	// circuitSettings are the settings of the native circuit of a command
+	circuitSettings struct {
+		windowSize     int
+		timeout        time.Duration
+		sleepWindow    time.Duration
+		maxConc        int32
+		volume         int
+		errPercent     int
+		consecFailures int
+		probes         int
+	}
+
+	// circuit is the native circuit of a command, it keeps the outcomes
+	// of the last requests in a sliding window
+	circuit struct {
+		mu   sync.Mutex
+		name string
+		set  circuitSettings
+
+		state    State
+		openedAt time.Time
+		// gen changes with the state, the outcomes of the requests let
+		// through in another state are dropped
+		gen uint64
+
+		// outcomes is a ring of the last requests, true if failed
+		outcomes    []bool
+		next        int
+		count       int
+		failures    int
+		consecutive int
+
+		// probes let through & succeeded in the half-open state, the
+		// last probe let through is due at probesDue
+		probes    int
+		succeeded int
+		probesDue time.Time
+
+		running int32
+
+		shortCircuits int64
+		rejects       int64
+		timeouts      int64
+	}
+
+	// nativeCircuits tracks the native circuit per command
+	nativeCircuits struct {
+		in map[string]*circuit
+		mu sync.Mutex
+	}
+
+	// change is a transition of the state of a circuit
+	change struct{ from, to State }
+)
+
+// circuit returns the circuit of cmd, created with the settings of set on
+// the first request of the command
+func (nc *nativeCircuits) circuit(cmd, name string, set func() circuitSettings) *circuit {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	cc, ok := nc.in[cmd]
+	if !ok {
+		st := set()
+		cc = &circuit{name: name, set: st, outcomes: make([]bool, st.window())}
+		nc.in[cmd] = cc
+	}
+	return cc
+}
+
+// drop drops the circuits of the commands matching pattern, they are
+// created again on their next request
+func (nc *nativeCircuits) drop(pattern string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	for cmd, cc := range nc.in {
+		if matches(pattern, cmd, cc.name) {
+			delete(nc.in, cmd)
+		}
+	}
+}
+
+// window is the size of the sliding window, large enough for the volume
+func (st circuitSettings) window() int {
+	if st.volume > st.windowSize {
+		return st.volume
+	}
+	return st.windowSize
+}
+
+// allow tells if a request is let through, the probes of the half-open
+// state are limited
+func (c *circuit) allow(now time.Time) (gen uint64, changes []change, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateOpen {
+		if now.Sub(c.openedAt) < c.set.sleepWindow {
+			c.shortCircuits++
+			return c.gen, nil, hystrix.ErrCircuitOpen
+		}
+
+		c.transition(StateHalfOpen)
+		changes = append(changes, change{StateOpen, StateHalfOpen})
+	}
+
+	if c.state == StateHalfOpen {
+		// a probe not done in its timeout, e.g. ignoring its context,
+		// failed. It would hold the circuit half-open
+		if c.probes >= c.set.probes && now.After(c.probesDue) {
+			c.transition(StateOpen)
+			c.openedAt = now
+			c.shortCircuits++
+			return c.gen, append(changes, change{StateHalfOpen, StateOpen}), hystrix.ErrCircuitOpen
+		}
+
+		if c.probes >= c.set.probes {
+			c.shortCircuits++
+			return c.gen, changes, hystrix.ErrCircuitOpen
+		}
+
+		c.probes++
+		c.probesDue = now.Add(c.set.timeout)
+	}
+
+	return c.gen, changes, nil
+}
+
+// record adds the outcome of a request let through in the generation gen
+func (c *circuit) record(gen uint64, failed bool, now time.Time) []change {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return nil
+	}
+
+	switch c.state {
+	case StateClosed:
+		c.push(failed)
+		if !c.tripped() {
+			return nil
+		}
+
+		c.transition(StateOpen)
+		c.openedAt = now
+		return []change{{StateClosed, StateOpen}}
+	case StateHalfOpen:
+		if failed {
+			c.transition(StateOpen)
+			c.openedAt = now
+			return []change{{StateHalfOpen, StateOpen}}
+		}
+
+		if c.succeeded++; c.succeeded < c.set.probes {
+			return nil
+		}
+
+		c.transition(StateClosed)
+		return []change{{StateHalfOpen, StateClosed}}
+	}
+
+	return nil
+}
+
+// transition expects lock to be held. The window is kept till the circuit
+// closes again, the stats of an open circuit show why it opened
+func (c *circuit) transition(to State) {
+	c.state = to
+	c.gen++
+
+	if to == StateClosed {
+		c.next, c.count, c.failures, c.consecutive = 0, 0, 0, 0
+	}
+	c.probes, c.succeeded = 0, 0
+}
+
+// push expects lock to be held
+func (c *circuit) push(failed bool) {
+	if c.count == len(c.outcomes) {
+		if c.outcomes[c.next] {
+			c.failures--
+		}
+	} else {
+		c.count++
+	}
+
+	c.outcomes[c.next] = failed
+	c.next = (c.next + 1) % len(c.outcomes)
+
+	if failed {
+		c.failures++
+		c.consecutive++
+	} else {
+		c.consecutive = 0
+	}
+}
+
+// tripped expects lock to be held
+func (c *circuit) tripped() bool {
+	if c.set.consecFailures > 0 && c.consecutive >= c.set.consecFailures {
+		return true
+	}
+
+	return c.count >= c.set.volume &&
+		c.failures*100 >= c.set.errPercent*c.count
+}
+
+func (c *circuit) stats(cs *CircuitStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cs.Open = c.state == StateOpen
+	cs.Requests = int64(c.count)
+	cs.Errors = int64(c.failures)
+	cs.Failures = int64(c.failures)
+	cs.Successes = int64(c.count - c.failures)
+	cs.ShortCircuits = c.shortCircuits
+	cs.Rejects = c.rejects
+	cs.Timeouts = c.timeouts
+
+	if c.count > 0 {
+		cs.ErrorPercent = int(float64(c.failures)/float64(c.count)*100 + 0.5)
+	}
+}
+
+// settings resolves the settings of the native circuit of cmd, with its
+// override
+func (b *Breaker) settings(cmd, name string) circuitSettings {
+	b.cfgred.mu.Lock()
+	defer b.cfgred.mu.Unlock()
+
+	cfg := b.cfgred.config(cmd, name, b.cmdcfg)
+
+	st := circuitSettings{
+		windowSize:     b.nativeConf.windowSize,
+		timeout:        time.Duration(cfg.Timeout) * time.Millisecond,
+		sleepWindow:    time.Duration(cfg.SleepWindow) * time.Millisecond,
+		maxConc:        int32(cfg.MaxConcurrentRequests),
+		volume:         cfg.RequestVolumeThreshold,
+		errPercent:     cfg.ErrorPercentThreshold,
+		consecFailures: b.nativeConf.consecFailures,
+		probes:         b.nativeConf.halfOpenProbes,
+	}
+
+	if ov, ok := b.cfgred.override(cmd, name); ok {
+		if ov.WindowSize > 0 {
+			st.windowSize = ov.WindowSize
+		}
+		if ov.ConsecFails > 0 {
+			st.consecFailures = ov.ConsecFails
+		}
+		if ov.HalfOpenProbes > 0 {
+			st.probes = ov.HalfOpenProbes
+		}
+	}
+
+	if st.windowSize <= 0 {
+		st.windowSize = defaultWindowSize
+	}
+	if st.timeout <= 0 {
+		st.timeout = time.Duration(hystrix.DefaultTimeout) * time.Millisecond
+	}
+	if st.maxConc <= 0 {
+		st.maxConc = int32(hystrix.DefaultMaxConcurrent)
+	}
+	if st.volume <= 0 {
+		st.volume = 1
+	}
+	if st.probes <= 0 {
+		st.probes = defaultHalfOpenProbes
+	}
+	return st
+}
+
+// changed calls onStateChange for the changes of the circuit of cmd
+func (b *Breaker) changed(cmd string, changes []change) {
+	if b.onStateChange == nil {
+		return
+	}
+
+	for _, ch := range changes {
+		b.onStateChange(cmd, ch.from, ch.to)
+	}
+}
+
+// native serves the request through the native circuit of cmd
+func (b *Breaker) native(
+	cx context.Context,
+	cmd, name string,
+	rqi interface{},
+) (rsi interface{}, err error) {
+	cc := b.natives.circuit(cmd, name, func() circuitSettings { return b.settings(cmd, name) })
+
+	rsi, err = b.run(cx, cc, cmd, rqi)
+	if err != nil {
+		switch {
+		case b.fallback != nil:
+			if res, fer := b.fallback(cx, rqi); fer == nil {
+				rsi, err = res, nil
+			}
+		case b.fallbackfn != nil:
+			err = b.fallbackfn(err)
+		}
+	}
+
+	b.afterFunc(rqi, rsi, err)
+	return
+}
+
+// run calls fn if the circuit & the concurrency of cmd allow it
+func (b *Breaker) run(
+	cx context.Context,
+	cc *circuit,
+	cmd string,
+	rqi interface{},
+) (interface{}, error) {
+	if atomic.AddInt32(&cc.running, 1) > cc.set.maxConc {
+		atomic.AddInt32(&cc.running, -1)
+
+		cc.mu.Lock()
+		cc.rejects++
+		cc.mu.Unlock()
+		return nil, hystrix.ErrMaxConcurrency
+	}
+	defer atomic.AddInt32(&cc.running, -1)
+
+	gen, changes, err := cc.allow(time.Now())
+	b.changed(cmd, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	tcx, canc := context.WithTimeout(cx, cc.set.timeout)
+
+	rsi, err := b.fn(tcx, rqi)
+
+	// the body of a response is read after the call, it needs the
+	// context alive till it is closed
+	if rs, ok := rsi.(*net_http.Response); ok && rs != nil && rs.Body != nil && err == nil {
+		rs.Body = &cancelOnClose{rs.Body, canc}
+	} else {
+		canc()
+	}
+
+	// the caller's context is fine, it's the command which timed out
+	if err != nil && tcx.Err() == context.DeadlineExceeded && cx.Err() == nil {
+		err = hystrix.ErrTimeout
+
+		cc.mu.Lock()
+		cc.timeouts++
+		cc.mu.Unlock()
+	}
+
+	b.changed(cmd, cc.record(gen, err != nil, time.Now()))
+	return rsi, err
+}
+
+// cancelOnClose cancels the context of the command when the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	canc context.CancelFunc
+}
+
+func (cc *cancelOnClose) Close() error {
+	defer cc.canc()
+	return cc.ReadCloser.Close()
+}
+
+// WithNativeBreaker serves the requests with a circuit breaker native to
+// this package instead of hystrix, without a goroutine per request. The
+// circuit of a command keeps the outcomes of its last requests in a
+// sliding window, see WithSlidingWindow, it opens when
+// the error percentage threshold is reached over at least the volume
+// threshold of requests, or after the consecutive failures set by
+// WithConsecutiveFailures. Once the sleep window has passed, the probes
+// set by WithHalfOpenProbes are let through, the circuit closes when all
+// of them succeed and opens again on the first failure, or on the first
+// request after a probe outlived its timeout.
+//
+// The timeout is set on the context passed to the endpoint, which is
+// expected to honor it, the request isn't abandoned as with hystrix. The
+// errors are the ones of hystrix, e.g. hystrix.ErrCircuitOpen, the
+// fallbacks, the callbacks & the per command configs work the same
+func WithNativeBreaker() BreakerOption {
+	return func(b *Breaker) (err error) {
+		b.nativeConf.enable = true
+		return
+	}
+}
+
+// WithSlidingWindow sets the number of the last requests of a command the
+// native circuit decides on, see WithNativeBreaker. It is at least the
+// volume threshold, defaults to 100
+func WithSlidingWindow(size int) BreakerOption {
+	return func(b *Breaker) (err error) {
+		b.nativeConf.windowSize = size
+		return
+	}
+}
+
+// WithConsecutiveFailures opens the native circuit of a command after n
+// failures in a row, whatever the volume, see WithNativeBreaker.
+// Zero or less disables it
+func WithConsecutiveFailures(n int) BreakerOption {
+	return func(b *Breaker) (err error) {
+		b.nativeConf.consecFailures = n
+		return
+	}
+}
+
+// WithHalfOpenProbes sets the requests let through by the half-open native
+// circuit of a command, all of them need to succeed to close it, see
+// WithNativeBreaker. Defaults to 1
+func WithHalfOpenProbes(n int) BreakerOption {
+	return func(b *Breaker) (err error) {
+		b.nativeConf.halfOpenProbes = n
+		return
+	}
+}
@@ -0,0 +1,303 @@
+package cb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/hystrix-go/hystrix"
+)
+
+func TestNativeBreaker(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		transitions []string
+		fail        atomic.Bool
+		errDown     = errors.New("downstream is down")
+	)
+
+	b, err := NewBreaker(
+		func(context.Context, interface{}) (interface{}, error) {
+			if fail.Load() {
+				return nil, errDown
+			}
+			return "ok", nil
+		},
+		WithNativeBreaker(),
+		WithBreakerEnable(true),
+		WithCommandPrefix("native"),
+		WithRequestVolumeThreshold(4),
+		WithErrorPercentageThreshold(50),
+		WithSleepWindow(50),
+		WithOnStateChange(func(cmd string, from, to State) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, fmt.Sprintf("%s: %s -> %s", cmd, from, to))
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewBreaker() error = %v", err)
+	}
+
+	ep := b.Endpoint()
+
+	// 2 of 4 requests fail, the failure rate reaches the threshold
+	for _, f := range []bool{false, true, false, true} {
+		fail.Store(f)
+		_, _ = ep(context.Background(), command("search"))
+	}
+
+	if _, err := ep(context.Background(), command("search")); err != hystrix.ErrCircuitOpen {
+		t.Fatalf("endpoint() error = %v, want %v", err, hystrix.ErrCircuitOpen)
+	}
+
+	if cs := b.Stats()["native-search"]; !cs.Open || cs.ShortCircuits != 1 {
+		t.Errorf("Stats() = %+v, want the circuit open", cs)
+	}
+
+	fail.Store(false)
+
+	// the other commands have their own circuit
+	if res, err := ep(context.Background(), command("browse")); err != nil || res != "ok" {
+		t.Errorf("endpoint(browse) = %v, %v, want ok", res, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if res, err := ep(context.Background(), command("search")); err != nil || res != "ok" {
+		t.Fatalf("probe = %v, %v, want ok", res, err)
+	}
+
+	want := []string{
+		"native-search: closed -> open",
+		"native-search: open -> half-open",
+		"native-search: half-open -> closed",
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Errorf("transitions = %q, want %q", transitions, want)
+	}
+}
+
+func TestNativeBreakerHalfOpenProbes(t *testing.T) {
+	var (
+		release = make(chan struct{})
+		fail    atomic.Bool
+		calls   atomic.Int32
+	)
+
+	fail.Store(true)
+
+	b, _ := NewBreaker(
+		func(context.Context, interface{}) (interface{}, error) {
+			calls.Add(1)
+			if fail.Load() {
+				return nil, errors.New("downstream is down")
+			}
+
+			<-release
+			return "ok", nil
+		},
+		WithNativeBreaker(),
+		WithBreakerEnable(true),
+		WithMaxConcurrentRequests(100),
+		WithConsecutiveFailures(3),
+		WithHalfOpenProbes(3),
+		WithSleepWindow(20),
+	)
+
+	ep := b.Endpoint()
+	for i := 0; i < 3; i++ {
+		_, _ = ep(context.Background(), command("probe"))
+	}
+
+	fail.Store(false)
+	calls.Store(0)
+	time.Sleep(30 * time.Millisecond)
+
+	var (
+		wg       sync.WaitGroup
+		rejected atomic.Int32
+		errs     = make(chan error, 50)
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := ep(context.Background(), command("probe"))
+			switch err {
+			case nil:
+			case hystrix.ErrCircuitOpen:
+				rejected.Add(1)
+			default:
+				errs <- err
+			}
+		}()
+	}
+
+	// the probes hold their slots till released
+	deadline := time.Now().Add(5 * time.Second)
+	for rejected.Load()+calls.Load() < 50 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("endpoint() error = %v", err)
+	}
+
+	if calls.Load() != 3 || rejected.Load() != 47 {
+		t.Errorf("calls = %d, rejected = %d, want 3 probes", calls.Load(), rejected.Load())
+	}
+
+	// all of the probes succeeded
+	if res, err := ep(context.Background(), command("probe")); err != nil || res != "ok" {
+		t.Errorf("endpoint() after the probes = %v, %v, want ok", res, err)
+	}
+}
+
+// probe is a request of the command probe, failing or hanging
+type probe string
+
+func (probe) Command() string { return "probe" }
+
+func TestNativeBreakerHungProbe(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		transitions []string
+		started     = make(chan struct{})
+		release     = make(chan struct{})
+	)
+
+	b, _ := NewBreaker(
+		func(_ context.Context, rqi interface{}) (interface{}, error) {
+			switch rqi {
+			case probe("fail"):
+				return nil, errors.New("downstream is down")
+			case probe("hang"):
+				// ignores its context
+				close(started)
+				<-release
+			}
+			return "ok", nil
+		},
+		WithNativeBreaker(),
+		WithBreakerEnable(true),
+		WithTimeout(20),
+		WithSleepWindow(20),
+		WithConsecutiveFailures(1),
+		WithOnStateChange(func(_ string, from, to State) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, fmt.Sprintf("%s -> %s", from, to))
+		}),
+	)
+
+	ep := b.Endpoint()
+	_, _ = ep(context.Background(), probe("fail"))
+
+	time.Sleep(30 * time.Millisecond)
+
+	hung := make(chan struct{})
+	go func() {
+		defer close(hung)
+		_, _ = ep(context.Background(), probe("hang"))
+	}()
+	<-started
+
+	if _, err := ep(context.Background(), probe("ok")); err != hystrix.ErrCircuitOpen {
+		t.Errorf("endpoint() while probing error = %v, want %v", err, hystrix.ErrCircuitOpen)
+	}
+
+	// the probe outlived its timeout, the circuit opens again
+	time.Sleep(30 * time.Millisecond)
+	if _, err := ep(context.Background(), probe("ok")); err != hystrix.ErrCircuitOpen {
+		t.Errorf("endpoint() after the probe timed out error = %v, want %v", err, hystrix.ErrCircuitOpen)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if res, err := ep(context.Background(), probe("ok")); err != nil || res != "ok" {
+		t.Fatalf("next probe = %v, %v, want ok", res, err)
+	}
+
+	// the hung probe ending late doesn't change the circuit
+	close(release)
+	<-hung
+
+	if res, err := ep(context.Background(), probe("ok")); err != nil || res != "ok" {
+		t.Errorf("endpoint() once closed = %v, %v, want ok", res, err)
+	}
+
+	want := []string{
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> open",
+		"open -> half-open",
+		"half-open -> closed",
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Errorf("transitions = %q, want %q", transitions, want)
+	}
+}
+
+func TestNativeBreakerLimits(t *testing.T) {
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	b, _ := NewBreakerFromConfig(
+		func(cx context.Context, rqi interface{}) (interface{}, error) {
+			if rqi == command("slow") {
+				<-cx.Done()
+				return nil, cx.Err()
+			}
+
+			started <- struct{}{}
+			<-release
+			return "ok", nil
+		},
+		log.NewNoopLogger(),
+		&BreakerConf{Enable: true, Native: true, TimeoutStr: "20ms", MaxConc: 1},
+		WithFallbackEndpoint(func(_ context.Context, rqi interface{}) (interface{}, error) {
+			if rqi == command("slow") {
+				return nil, errors.New("nothing cached")
+			}
+			return "stale", nil
+		}),
+	)
+
+	ep := b.Endpoint()
+
+	if _, err := ep(context.Background(), command("slow")); err != hystrix.ErrTimeout {
+		t.Errorf("endpoint(slow) error = %v, want %v", err, hystrix.ErrTimeout)
+	}
+
+	go func() { _, _ = ep(context.Background(), command("busy")) }()
+	<-started
+
+	if res, err := ep(context.Background(), command("busy")); err != nil || res != "stale" {
+		t.Errorf("endpoint() over the max concurrency = %v, %v, want the fallback response", res, err)
+	}
+	close(release)
+
+	if cs := b.Stats()["busy"]; cs.Rejects != 1 {
+		t.Errorf("Stats() = %+v, want the reject counted", cs)
+	}
+}
@@ -0,0 +1,190 @@
+package cb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/unbxd/hystrix-go/hystrix"
+	"github.com/unbxd/hystrix-go/hystrix/metric"
+	"github.com/unbxd/hystrix-go/hystrix/rolling"
+)
+
+type (
+	// CircuitStats are the stats of the circuit of a command over the
+	// rolling window of hystrix (10s)
+	CircuitStats struct {
+		Command string `json:"command"`
+		Open    bool   `json:"open"`
+
+		Requests          int64 `json:"requests"`
+		Errors            int64 `json:"errors"`
+		Successes         int64 `json:"successes"`
+		Failures          int64 `json:"failures"`
+		Rejects           int64 `json:"rejects"`
+		ShortCircuits     int64 `json:"short_circuits"`
+		Timeouts          int64 `json:"timeouts"`
+		FallbackSuccesses int64 `json:"fallback_successes"`
+		FallbackFailures  int64 `json:"fallback_failures"`
+
+		ErrorPercent int `json:"error_percent"`
+	}
+
+	// statsCollector keeps the rolling counts of a circuit, hystrix keeps
+	// its own out of reach
+	statsCollector struct {
+		mu sync.RWMutex
+
+		requests          *rolling.Number
+		errors            *rolling.Number
+		successes         *rolling.Number
+		failures          *rolling.Number
+		rejects           *rolling.Number
+		shortCircuits     *rolling.Number
+		timeouts          *rolling.Number
+		fallbackSuccesses *rolling.Number
+		fallbackFailures  *rolling.Number
+	}
+)
+
+var (
+	statsCollectors = struct {
+		in map[string]*statsCollector
+		mu sync.Mutex
+	}{in: make(map[string]*statsCollector)}
+
+	registerStats sync.Once
+)
+
+// registerStatsCollector adds the stats collector to the circuits created
+// from now on, hystrix creates the circuit of a command on its first run
+func registerStatsCollector() {
+	registerStats.Do(func() {
+		metric.Registry.Register(func(name string) metric.Collector {
+			sc := &statsCollector{}
+			sc.Reset()
+
+			statsCollectors.mu.Lock()
+			statsCollectors.in[name] = sc
+			statsCollectors.mu.Unlock()
+			return sc
+		})
+	})
+}
+
+func (sc *statsCollector) Update(r metric.Result) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	sc.requests.Increment(r.Attempts)
+	sc.errors.Increment(r.Errors)
+	sc.successes.Increment(r.Successes)
+	sc.failures.Increment(r.Failures)
+	sc.rejects.Increment(r.Rejects)
+	sc.shortCircuits.Increment(r.ShortCircuits)
+	sc.timeouts.Increment(r.Timeouts)
+	sc.fallbackSuccesses.Increment(r.FallbackSuccesses)
+	sc.fallbackFailures.Increment(r.FallbackFailures)
+}
+
+func (sc *statsCollector) Reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, n := range []**rolling.Number{
+		&sc.requests, &sc.errors, &sc.successes, &sc.failures, &sc.rejects,
+		&sc.shortCircuits, &sc.timeouts, &sc.fallbackSuccesses, &sc.fallbackFailures,
+	} {
+		*n = rolling.NewNumber()
+	}
+}
+
+func (sc *statsCollector) stats(cs *CircuitStats, now time.Time) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	for _, f := range []struct {
+		dst *int64
+		n   *rolling.Number
+	}{
+		{&cs.Requests, sc.requests},
+		{&cs.Errors, sc.errors},
+		{&cs.Successes, sc.successes},
+		{&cs.Failures, sc.failures},
+		{&cs.Rejects, sc.rejects},
+		{&cs.ShortCircuits, sc.shortCircuits},
+		{&cs.Timeouts, sc.timeouts},
+		{&cs.FallbackSuccesses, sc.fallbackSuccesses},
+		{&cs.FallbackFailures, sc.fallbackFailures},
+	} {
+		*f.dst = int64(f.n.Sum(now))
+	}
+
+	if cs.Requests > 0 {
+		cs.ErrorPercent = int(float64(cs.Errors)/float64(cs.Requests)*100 + 0.5)
+	}
+}
+
+// Stats returns the stats of the circuits of the commands run by the
+// breaker so far, by the command name given to hystrix (with the prefix
+// set by WithCommandPrefix). Open is whether hystrix rejects the requests
+// of the command, hystrix opens an unhealthy circuit on this check like
+// it would on the next request. The counts are updated asynchronously by
+// hystrix, they may lag a few requests behind. Open & the counts come from
+// different collectors of hystrix, a circuit can be reported open before
+// the requests which opened it are counted.
+// For the native breaker the requests, errors & successes are the ones in
+// the sliding window, the rejects, short circuits & timeouts are counted
+// since the first request, see WithNativeBreaker
+func (b *Breaker) Stats() map[string]CircuitStats {
+	if b.natives != nil {
+		return b.nativeStats()
+	}
+
+	b.cfgred.mu.Lock()
+	cmds := make([]string, 0, len(b.cfgred.in))
+	for cmd := range b.cfgred.in {
+		cmds = append(cmds, cmd)
+	}
+	b.cfgred.mu.Unlock()
+
+	var (
+		now   = time.Now()
+		stats = make(map[string]CircuitStats, len(cmds))
+	)
+
+	for _, cmd := range cmds {
+		cs := CircuitStats{Command: cmd}
+
+		if circuit, _, err := hystrix.GetCircuit(cmd); err == nil {
+			cs.Open = circuit.IsOpen()
+		}
+
+		statsCollectors.mu.Lock()
+		sc, ok := statsCollectors.in[cmd]
+		statsCollectors.mu.Unlock()
+
+		if ok {
+			sc.stats(&cs, now)
+		}
+
+		stats[cmd] = cs
+	}
+	return stats
+}
+
+func (b *Breaker) nativeStats() map[string]CircuitStats {
+	b.natives.mu.Lock()
+	circuits := make(map[string]*circuit, len(b.natives.in))
+	for cmd, cc := range b.natives.in {
+		circuits[cmd] = cc
+	}
+	b.natives.mu.Unlock()
+
+	stats := make(map[string]CircuitStats, len(circuits))
+	for cmd, cc := range circuits {
+		cs := CircuitStats{Command: cmd}
+		cc.stats(&cs)
+		stats[cmd] = cs
+	}
+	return stats
+}
@@ -0,0 +1,357 @@
+package dialer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/unbxd/go-base/v2/endpoint"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
+	"github.com/unbxd/go-base/v2/net/cb"
+	"github.com/unbxd/go-base/v2/net/retrier"
+	"github.com/unbxd/go-base/v2/rate"
+	"github.com/unbxd/hystrix-go/hystrix"
+)
+
+// Errors of the Client, they tell the layer which failed the request and
+// are joined with the error of the layer, errors.Is matches both
+var (
+	ErrClientRateLimited = errors.New("client: rate limited")
+	ErrClientBreaker     = errors.New("client: rejected by the circuit breaker")
+	ErrClientRetrier     = errors.New("client: failed after retries")
+	ErrClientExecutor    = errors.New("client: executor failed")
+
+	errNoDeadline = errors.New("context has no deadline")
+)
+
+const (
+	clientRequestMetric  = "client.request"
+	clientDurationMetric = "client.duration"
+)
+
+type (
+	// ClientOption customises the Client
+	ClientOption func(*Client) error
+
+	// Client calls the downstream through the rate limiter, the circuit
+	// breaker & the retrier, in that order, each of them is optional
+	Client struct {
+		logger log.Logger
+		dialer Dialer
+
+		limiter rate.Limiter
+		breaker *cb.Breaker
+		retrier *retrier.Retrier
+
+		key func(*http.Request) string
+
+		requestCounter    metrics.Counter
+		durationHistogram metrics.Histogram
+
+		fn endpoint.Endpoint
+	}
+
+	// request is passed through the layers, the breaker takes its command
+	// & the retrier its deadline from it
+	request struct {
+		req *http.Request
+		cx  context.Context
+		key string
+
+		attempts atomic.Int32
+		// layer is the one which failed the request, when the outcome
+		// alone doesn't tell
+		layer atomic.Value
+	}
+)
+
+func (rq *request) Command() string { return rq.key }
+
+func (rq *request) Deadline() (time.Duration, error) {
+	dl, ok := rq.cx.Deadline()
+	if !ok {
+		return 0, errNoDeadline
+	}
+	return time.Until(dl), nil
+}
+
+// WithDialer calls the downstream with d, e.g. one with validators or a
+// custom round tripper. Defaults to NewDialer
+func WithDialer(d Dialer) ClientOption {
+	return func(c *Client) error {
+		c.dialer = d
+		return nil
+	}
+}
+
+// WithRateLimiter limits the requests with l, keyed by WithRequestKey.
+// Requests over the limit fail with ErrClientRateLimited
+func WithRateLimiter(l rate.Limiter) ClientOption {
+	return func(c *Client) error {
+		c.limiter = l
+		return nil
+	}
+}
+
+// WithBreaker wraps the requests, with their retries, in the circuit
+// breaker b. The command is the key of WithRequestKey, the endpoint b was
+// built with isn't called. Requests rejected by the breaker fail with
+// ErrClientBreaker
+func WithBreaker(b *cb.Breaker) ClientOption {
+	return func(c *Client) error {
+		c.breaker = b
+		return nil
+	}
+}
+
+// WithRetrier retries the requests with r, the endpoint r was built with
+// isn't called. Errors without a response are retrier.ErrExec for its
+// classifier, responses are best classified with
+// retrier.NewHTTPClassifier. Bodies are rewound with GetBody, those of
+// requests without it are buffered. Requests which failed after being
+// retried fail with ErrClientRetrier
+func WithRetrier(r *retrier.Retrier) ClientOption {
+	return func(c *Client) error {
+		c.retrier = r
+		return nil
+	}
+}
+
+// WithRequestKey sets the key of the rate limiter & the command of the
+// breaker for a request. Defaults to the host of the request
+func WithRequestKey(fn func(*http.Request) string) ClientOption {
+	return func(c *Client) error {
+		c.key = fn
+		return nil
+	}
+}
+
+// WithMetrics counts the requests as `client.request`, tagged with the
+// `key` of WithRequestKey & the `layer` which failed it (none,
+// limiter, breaker, retrier or executor), and observes their duration in
+// milliseconds as `client.duration`
+func WithMetrics(provider metrics.Provider) ClientOption {
+	return func(c *Client) error {
+		if provider == nil {
+			return nil
+		}
+
+		c.requestCounter = provider.NewCounter(clientRequestMetric, 1)
+		c.durationHistogram = provider.NewHistogram(clientDurationMetric, 1)
+		return nil
+	}
+}
+
+// NewClient returns a Client composing the options given
+func NewClient(logger log.Logger, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		logger: logger,
+		key:    func(req *http.Request) string { return req.URL.Host },
+	}
+
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.dialer == nil {
+		d, err := NewDialer(logger)
+		if err != nil {
+			return nil, err
+		}
+		c.dialer = d
+	}
+
+	c.fn = c.execute
+	if c.retrier != nil {
+		c.fn = guard(ErrClientRetrier, c.retrier.Wrap(c.fn))
+	}
+	if c.breaker != nil {
+		c.fn = guard(ErrClientBreaker, c.breaker.Wrap(c.fn))
+	}
+
+	return c, nil
+}
+
+// guard fails the request with the layer when the context is done before
+// it is reached
+func guard(layer error, fn endpoint.Endpoint) endpoint.Endpoint {
+	return func(cx context.Context, rqi interface{}) (interface{}, error) {
+		if err := cx.Err(); err != nil {
+			rqi.(*request).layer.Store(layer)
+			return nil, err
+		}
+		return fn(cx, rqi)
+	}
+}
+
+// execute is a single attempt, on a clone of the request with the body
+// rewound for the retries
+func (c *Client) execute(cx context.Context, rqi interface{}) (interface{}, error) {
+	rq := rqi.(*request)
+
+	attempt := rq.attempts.Add(1)
+	if err := cx.Err(); err != nil {
+		rq.layer.Store(ErrClientExecutor)
+		return nil, err
+	}
+
+	req := rq.req.Clone(cx)
+	if attempt > 1 && rq.req.GetBody != nil {
+		body, err := rq.req.GetBody()
+		if err != nil {
+			rq.layer.Store(ErrClientExecutor)
+			return nil, errors.Wrap(err, "failed to rewind the body")
+		}
+		req.Body = body
+	}
+
+	res, err := c.dialer.Dial(cx, req)
+	if err != nil && res == nil {
+		rq.layer.Store(ErrClientExecutor)
+		// the default classifier of the retrier retries ErrExec
+		return nil, errors.With(retrier.ErrExec, err)
+	}
+
+	return res, err
+}
+
+// rewindable returns req with a GetBody, buffering its body if needed
+func rewindable(cx context.Context, req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return req, nil
+	}
+
+	bt, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to buffer the body")
+	}
+
+	req = req.Clone(cx)
+	req.Body = io.NopCloser(bytes.NewReader(bt))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(bt)), nil
+	}
+	return req, nil
+}
+
+// failedLayer returns the layer which failed the request with err
+func (c *Client) failedLayer(rq *request, err error) error {
+	var ce hystrix.CircuitError
+
+	switch {
+	case c.breaker != nil && errors.As(err, &ce):
+		return ErrClientBreaker
+	case c.retrier != nil && (rq.attempts.Load() > 1 || errors.Is(err, retrier.ErrAttemptTimeout)):
+		return ErrClientRetrier
+	}
+
+	if layer, ok := rq.layer.Load().(error); ok {
+		return layer
+	}
+
+	// the retrier gave up without an attempt
+	if c.retrier != nil && rq.attempts.Load() == 0 {
+		return ErrClientRetrier
+	}
+	return ErrClientExecutor
+}
+
+func layerName(layer error) string {
+	switch layer {
+	case nil:
+		return "none"
+	case ErrClientRateLimited:
+		return "limiter"
+	case ErrClientBreaker:
+		return "breaker"
+	case ErrClientRetrier:
+		return "retrier"
+	default:
+		return "executor"
+	}
+}
+
+func (c *Client) observe(key string, layer error, start time.Time) {
+	if c.requestCounter != nil {
+		c.requestCounter.With("key", key, "layer", layerName(layer)).Add(1)
+	}
+
+	if c.durationHistogram != nil {
+		c.durationHistogram.With("key", key).Observe(float64(time.Since(start).Milliseconds()))
+	}
+}
+
+// limit checks the request against the rate limiter, the limiter failing
+// to decide rejects it too
+func (c *Client) limit(cx context.Context, key string) error {
+	if err := cx.Err(); err != nil {
+		return err
+	}
+
+	ok, err := c.limiter.Allow(cx, rate.Key(key))
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		return ErrClientRateLimited
+	}
+	return nil
+}
+
+// Do calls the downstream with req through the layers, the context bounds
+// all of them. The error tells the layer which failed it, e.g.
+// ErrClientBreaker, joined with the error of the layer. The response is
+// returned along with the errors of the validators of the dialer, its
+// body has to be closed
+func (c *Client) Do(cx context.Context, req *http.Request) (res *http.Response, err error) {
+	var (
+		start = time.Now()
+		key   = c.key(req)
+		layer error
+	)
+
+	defer func() { c.observe(key, layer, start) }()
+
+	if c.limiter != nil {
+		if err = c.limit(cx, key); err != nil {
+			layer = ErrClientRateLimited
+			if err != layer {
+				err = errors.Join(layer, err)
+			}
+			return nil, err
+		}
+	}
+
+	if c.retrier != nil {
+		if req, err = rewindable(cx, req); err != nil {
+			layer = ErrClientRetrier
+			return nil, errors.Join(layer, err)
+		}
+	}
+
+	rq := &request{req: req, cx: cx, key: key}
+
+	rsi, err := c.fn(cx, rq)
+	res, _ = rsi.(*http.Response)
+
+	if err != nil {
+		layer = c.failedLayer(rq, err)
+		c.logger.Debug(
+			"client request failed",
+			log.String("key", key),
+			log.String("layer", layerName(layer)),
+			log.Error(err),
+		)
+		return res, errors.Join(layer, err)
+	}
+
+	return res, nil
+}
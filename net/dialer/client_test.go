@@ -0,0 +1,128 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/net/cb"
+	"github.com/unbxd/go-base/v2/net/retrier"
+	"github.com/unbxd/go-base/v2/rate"
+	"github.com/unbxd/hystrix-go/hystrix"
+)
+
+func TestClientRetriesRewindBody(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bt, _ := io.ReadAll(r.Body)
+		if string(bt) != "payload" {
+			t.Errorf("body of attempt %d = %q, want payload", calls.Load()+1, bt)
+		}
+
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	rt, _ := retrier.NewRetrier(
+		log.NewNoopLogger(), nil,
+		retrier.WithRetrierEnable(true),
+		retrier.WithRetryCount(3),
+		retrier.WithConstantBackoff(&retrier.BackoffConf{Incr: 1}),
+		retrier.WithClassifier(retrier.StatusCodeClassifier()),
+	)
+
+	c, err := NewClient(log.NewNoopLogger(), WithRetrier(rt))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// a reader without GetBody is buffered
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, io.MultiReader(strings.NewReader("payload")))
+
+	res, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("Do() = %d after %d calls, want 200 after 3", res.StatusCode, calls.Load())
+	}
+
+	// retries run out on a downstream which is down
+	srv.Close()
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	if _, err = c.Do(context.Background(), req); !errors.Is(err, ErrClientRetrier) || !errors.Is(err, retrier.ErrExec) {
+		t.Errorf("Do() on a closed server error = %v, want ErrClientRetrier", err)
+	}
+}
+
+func TestClientLayers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("limiter", func(t *testing.T) {
+		lm, _ := rate.NewInMemoryLimiter(0.001, 1)
+		c, _ := NewClient(log.NewNoopLogger(), WithRateLimiter(lm))
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if res, err := c.Do(context.Background(), req); err == nil {
+			res.Body.Close()
+		}
+
+		if _, err := c.Do(context.Background(), req); !errors.Is(err, ErrClientRateLimited) {
+			t.Errorf("Do() over the limit error = %v, want ErrClientRateLimited", err)
+		}
+	})
+
+	t.Run("breaker", func(t *testing.T) {
+		bk, _ := cb.NewBreaker(
+			nil,
+			cb.WithBreakerEnable(true),
+			cb.WithTimeout(20),
+			cb.WithCommandPrefix(t.Name()),
+			cb.WithBreakerAfterFunc(func(interface{}, interface{}, error) {}),
+		)
+		c, _ := NewClient(log.NewNoopLogger(), WithBreaker(bk))
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if _, err := c.Do(context.Background(), req); !errors.Is(err, ErrClientBreaker) || !errors.Is(err, hystrix.ErrTimeout) {
+			t.Errorf("Do() slower than the breaker error = %v, want ErrClientBreaker", err)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		lm, _ := rate.NewInMemoryLimiter(100, 100)
+		c, _ := NewClient(log.NewNoopLogger(), WithRateLimiter(lm))
+
+		cx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if _, err := c.Do(cx, req); !errors.Is(err, ErrClientExecutor) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Do() past the deadline error = %v, want ErrClientExecutor", err)
+		}
+
+		if _, err := c.Do(cx, req); !errors.Is(err, ErrClientRateLimited) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Do() with a done context error = %v, want ErrClientRateLimited", err)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package dialer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Headers carrying the time the caller is willing to wait for the response,
+// set on the outgoing requests from the deadline of the request context
+const (
+	// HeaderRequestTimeout is the timeout in milliseconds
+	HeaderRequestTimeout = "X-Request-Timeout"
+	// HeaderGRPCTimeout is the timeout in the format of grpc, e.g. `150m`
+	HeaderGRPCTimeout = "Grpc-Timeout"
+)
+
+// ErrDeadlineExhausted is returned instead of dialing when the deadline of
+// the request leaves no time for the downstream
+var ErrDeadlineExhausted = errors.New("request deadline exhausted before dialing downstream")
+
+// grpc timeouts have at most 8 digits, the units from the finest
+var grpcTimeoutUnits = []struct {
+	unit time.Duration
+	sfx  byte
+}{
+	{time.Nanosecond, 'n'},
+	{time.Microsecond, 'u'},
+	{time.Millisecond, 'm'},
+	{time.Second, 'S'},
+	{time.Minute, 'M'},
+	{time.Hour, 'H'},
+}
+
+func encodeGRPCTimeout(d time.Duration) string {
+	for _, u := range grpcTimeoutUnits {
+		if v := d / u.unit; v < 1e8 {
+			return strconv.FormatInt(int64(v), 10) + string(u.sfx)
+		}
+	}
+	return "99999999H"
+}
+
+func decodeGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+
+	v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+
+	for _, u := range grpcTimeoutUnits {
+		if u.sfx == s[len(s)-1] {
+			return time.Duration(v) * u.unit, true
+		}
+	}
+	return 0, false
+}
+
+// SetRequestTimeout sets the timeout headers on h, both X-Request-Timeout &
+// Grpc-Timeout so either kind of downstream understands it
+func SetRequestTimeout(h http.Header, d time.Duration) {
+	h.Set(HeaderRequestTimeout, strconv.FormatInt(d.Milliseconds(), 10))
+	h.Set(HeaderGRPCTimeout, encodeGRPCTimeout(d))
+}
+
+// RequestTimeout returns the timeout set by the caller in h, X-Request-Timeout
+// first & Grpc-Timeout otherwise
+func RequestTimeout(h http.Header) (time.Duration, bool) {
+	if v := h.Get(HeaderRequestTimeout); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms < 0 {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+
+	if v := h.Get(HeaderGRPCTimeout); v != "" {
+		return decodeGRPCTimeout(v)
+	}
+	return 0, false
+}
+
+// PropagateDeadline passes the deadline of cx on to the downstream of req,
+// the remaining time less margin, i.e. the time for the response to travel
+// back, is set in the timeout headers & bounds the context of the request
+// returned. The request is returned as is when cx has no deadline.
+// cancel must be called once the response is read, it returns
+// ErrDeadlineExhausted if no time is left
+func PropagateDeadline(
+	cx context.Context, req *http.Request, margin time.Duration,
+) (*http.Request, context.CancelFunc, error) {
+	deadline, ok := cx.Deadline()
+	if !ok {
+		return req, func() {}, nil
+	}
+
+	budget := time.Until(deadline) - margin
+	if budget <= 0 {
+		return nil, nil, errors.Wrap(
+			ErrDeadlineExhausted, "remaining: "+time.Until(deadline).String(),
+		)
+	}
+
+	c, cancel := context.WithTimeout(req.Context(), budget)
+
+	req = req.WithContext(c)
+	req.Header = req.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	SetRequestTimeout(req.Header, budget)
+	return req, cancel, nil
+}
+
+// CancelOnClose releases cancel, the context bounding the request of res,
+// once the body of res is closed. The body is read past the return of the
+// call, the context can't be cancelled before it
+func CancelOnClose(res *http.Response, cancel context.CancelFunc) {
+	if res == nil || res.Body == nil {
+		cancel()
+		return
+	}
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (cb *cancelBody) Close() error {
+	err := cb.ReadCloser.Close()
+	cb.cancel()
+	return err
+}
+
+// WithDeadlinePropagation passes the deadline of the request on to the
+// downstream, see PropagateDeadline. The earlier of the deadlines of the
+// context of Dial & the request is used. Set it before the executors
+// wrapping the call, e.g. WithTimeoutExecutor or WithRetrierExecutor, so
+// their timeout counts & each attempt gets the time left
+func WithDeadlinePropagation(margin time.Duration) Option {
+	return func(dd *defaultDialer) error {
+		if dd.exec == nil {
+			return errors.Wrap(
+				errNeedExec, "[dialer.opts] deadline",
+			)
+		}
+
+		ex := dd.exec
+		dd.exec = func(
+			cx context.Context,
+			req *http.Request,
+		) (*http.Response, error) {
+			dc := req.Context()
+			if d, ok := cx.Deadline(); ok {
+				if rd, rok := dc.Deadline(); !rok || d.Before(rd) {
+					dc = cx
+				}
+			}
+
+			req, cancel, err := PropagateDeadline(dc, req, margin)
+			if err != nil {
+				return nil, err
+			}
+
+			res, err := ex(cx, req)
+			if err != nil {
+				cancel()
+				return res, err
+			}
+
+			CancelOnClose(res, cancel)
+			return res, nil
+		}
+		return nil
+	}
+}
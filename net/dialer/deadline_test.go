@@ -0,0 +1,124 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   time.Duration
+		ok     bool
+	}{
+		{"millis", HeaderRequestTimeout, "150", 150 * time.Millisecond, true},
+		{"grpc", HeaderGRPCTimeout, "2S", 2 * time.Second, true},
+		{"grpc micros", HeaderGRPCTimeout, "1500u", 1500 * time.Microsecond, true},
+		{"bad unit", HeaderGRPCTimeout, "10x", 0, false},
+		{"negative", HeaderRequestTimeout, "-1", 0, false},
+		{"missing", "X-Other", "1", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(tt.header, tt.value)
+
+			got, ok := RequestTimeout(h)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("RequestTimeout() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	h := http.Header{}
+	SetRequestTimeout(h, 36*time.Hour)
+	if got, _ := decodeGRPCTimeout(h.Get(HeaderGRPCTimeout)); got != 36*time.Hour {
+		t.Errorf("grpc timeout round trip = %v, want %v", got, 36*time.Hour)
+	}
+}
+
+func TestWithDeadlinePropagation(t *testing.T) {
+	type seen struct {
+		timeout  time.Duration
+		deadline bool
+	}
+
+	var got = make(chan seen, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, ok := RequestTimeout(r.Header)
+		got <- seen{d, ok}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	dl, err := NewDialer(log.NewNoopLogger(), WithDeadlinePropagation(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("budget", func(t *testing.T) {
+		cx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(cx, http.MethodGet, srv.URL, nil)
+		res, err := dl.Dial(cx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the body outlives the call
+		body, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil || string(body) != "ok" {
+			t.Fatalf("body = %q, %v", body, err)
+		}
+
+		s := <-got
+		if !s.deadline || s.timeout <= 0 || s.timeout > 990*time.Millisecond {
+			t.Errorf("downstream timeout = %v, %v, want (0, 990ms]", s.timeout, s.deadline)
+		}
+
+		if req.Header.Get(HeaderRequestTimeout) != "" {
+			t.Errorf("request of the caller modified")
+		}
+	})
+
+	t.Run("no deadline", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		res, err := dl.Dial(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+
+		if s := <-got; s.deadline {
+			t.Errorf("downstream timeout = %v, want none", s.timeout)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		cx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(cx, http.MethodGet, srv.URL, nil)
+		if _, err := dl.Dial(cx, req); !errors.Is(err, ErrDeadlineExhausted) {
+			t.Errorf("Dial() error = %v, want %v", err, ErrDeadlineExhausted)
+		}
+
+		select {
+		case <-got:
+			t.Errorf("downstream called out of time")
+		default:
+		}
+	})
+}
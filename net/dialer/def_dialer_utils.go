@@ -8,6 +8,8 @@ import (
 
 	khttp "github.com/go-kit/kit/transport/http"
 	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/units"
 )
 
 func fnc(o, n int) int {
@@ -17,12 +19,37 @@ func fnc(o, n int) int {
 	return o
 }
 
-func fnt(o time.Duration, n int) time.Duration {
-	if n > 0 {
-		return time.Duration(n) * time.Second
+// fnd resolves a duration config which has both a typed & a legacy integer
+// field, falling back to o when neither is set. A warning is logged when
+// both fields are set and disagree.
+func fnd(
+	lg log.Logger,
+	name string,
+	o time.Duration,
+	typed string,
+	legacy int,
+	unit time.Duration,
+) (time.Duration, error) {
+	dur, conflict, err := units.ResolveDuration(typed, legacy, unit)
+	if err != nil {
+		return o, errors.Wrapf(err, "invalid dialer config: %s", name)
 	}
 
-	return o
+	if conflict && lg != nil {
+		lg.Warn(
+			"deprecated dialer config set along with typed config, using typed config",
+			log.String("config", name),
+			log.String("typed", typed),
+			log.Int("legacy", legacy),
+			log.Duration("using", dur),
+		)
+	}
+
+	if dur > 0 {
+		return dur, nil
+	}
+
+	return o, nil
 }
 
 func statusCodeError(
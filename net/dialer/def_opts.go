@@ -38,7 +38,12 @@ type (
 		// IdleConnTimeout is the maximum amount of time an idle
 		// itself.
 		// Zero means no limit.
+		// In seconds, Deprecated: use IdleConnTimeoutStr
 		IdleConnTimeout int
+
+		// IdleConnTimeoutStr is typed alternative of IdleConnTimeout,
+		// e.g. "90s". Bare integers are read as seconds.
+		IdleConnTimeoutStr string
 	}
 
 	NetworkConf struct {
@@ -54,19 +59,33 @@ type (
 		// With or without a timeout, the operating system may impose
 		// its own earlier timeout. For instance, TCP timeouts are
 		// often around 3 minutes.
+		// In seconds, Deprecated: use TimeoutStr
 		Timeout int
 
+		// TimeoutStr is typed alternative of Timeout, e.g. "30s".
+		// Bare integers are read as seconds.
+		TimeoutStr string
+
 		// KeepAlive specifies the keep-alive period for an active
 		// network connection.
 		// If zero, keep-alives are enabled if supported by the protocol
 		// and operating system. Network protocols or operating systems
 		// that do not support keep-alives ignore this field.
 		// If negative, keep-alives are disabled.
+		// In seconds, Deprecated: use KeepAliveStr
 		KeepAlive int
+
+		// KeepAliveStr is typed alternative of KeepAlive, e.g. "30s".
+		// Bare integers are read as seconds.
+		KeepAliveStr string
 	}
 
 	TimeoutConf struct {
-		Tm int //in millisecond
+		Tm int //in millisecond, Deprecated: use TmStr
+
+		// TmStr is typed alternative of Tm, e.g. "200ms".
+		// Bare integers are read as milliseconds.
+		TmStr string
 	}
 )
 
@@ -91,15 +110,36 @@ func WithRoundTripperExecutor(cfg *Conf) Option {
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
-	return func(dd *defaultDialer) error {
+	return func(dd *defaultDialer) (err error) {
 
 		// Rebuild based on configuration
 		tr.MaxIdleConns = fnc(tr.MaxIdleConns, cfg.Tr.MaxIdleConns)
 		tr.MaxIdleConnsPerHost = fnc(tr.MaxIdleConnsPerHost, cfg.Tr.MaxIdleConnsPerHost)
 		tr.MaxConnsPerHost = fnc(tr.MaxConnsPerHost, cfg.Tr.MaxIdleConnsPerHost)
-		tr.IdleConnTimeout = fnt(tr.IdleConnTimeout, cfg.Tr.IdleConnTimeout)
-		nd.Timeout = fnt(nd.Timeout, cfg.Nw.Timeout)
-		nd.KeepAlive = fnt(nd.KeepAlive, cfg.Nw.KeepAlive)
+
+		tr.IdleConnTimeout, err = fnd(
+			dd.lgr, "idle_conn_timeout", tr.IdleConnTimeout,
+			cfg.Tr.IdleConnTimeoutStr, cfg.Tr.IdleConnTimeout, time.Second,
+		)
+		if err != nil {
+			return err
+		}
+
+		nd.Timeout, err = fnd(
+			dd.lgr, "network_timeout", nd.Timeout,
+			cfg.Nw.TimeoutStr, cfg.Nw.Timeout, time.Second,
+		)
+		if err != nil {
+			return err
+		}
+
+		nd.KeepAlive, err = fnd(
+			dd.lgr, "network_keep_alive", nd.KeepAlive,
+			cfg.Nw.KeepAliveStr, cfg.Nw.KeepAlive, time.Second,
+		)
+		if err != nil {
+			return err
+		}
 
 		// final dialer config
 		tr.DialContext = nd.DialContext
@@ -188,10 +228,12 @@ func WithTimeoutExecutor(cfg *TimeoutConf) Option {
 			)
 		}
 
-		ttl := time.Duration(200) * time.Millisecond
-
-		if cfg.Tm > 0 {
-			ttl = time.Duration(cfg.Tm) * time.Millisecond
+		ttl, err := fnd(
+			dd.lgr, "timeout", time.Duration(200)*time.Millisecond,
+			cfg.TmStr, cfg.Tm, time.Millisecond,
+		)
+		if err != nil {
+			return err
 		}
 
 		ex = dd.exec
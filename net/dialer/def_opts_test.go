@@ -0,0 +1,70 @@
+package dialer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// warnLogger records the config of the deprecation warnings
+type warnLogger struct {
+	log.Logger
+	warned []string
+}
+
+func (wl *warnLogger) Warn(_ string, fields ...log.Field) {
+	for _, f := range fields {
+		if f.Key == "config" {
+			wl.warned = append(wl.warned, f.String)
+		}
+	}
+}
+
+func TestDualFieldPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		typed  string
+		legacy int
+		want   time.Duration
+		warned bool
+	}{
+		{"default", "", 0, 200 * time.Millisecond, false},
+		{"typed", "1s", 0, time.Second, false},
+		{"legacy", "", 300, 300 * time.Millisecond, false},
+		{"both agree", "300ms", 300, 300 * time.Millisecond, false},
+		{"typed wins", "2s", 30, 2 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		lg := &warnLogger{Logger: log.NewNoopLogger()}
+
+		got, err := fnd(lg, "timeout", 200*time.Millisecond, tt.typed, tt.legacy, time.Millisecond)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: fnd() = %s, %v, want %s", tt.name, got, err, tt.want)
+		}
+
+		if warned := len(lg.warned) > 0; warned != tt.warned {
+			t.Errorf("%s: warned for %v, want a warning %v", tt.name, lg.warned, tt.warned)
+		}
+	}
+
+	if _, err := fnd(nil, "timeout", 0, "2s", 30, time.Millisecond); err != nil {
+		t.Errorf("fnd() without a logger error = %v", err)
+	}
+
+	// the conflicts of the config are warned about by the options
+	lg := &warnLogger{Logger: log.NewNoopLogger()}
+	dd := &defaultDialer{lgr: lg}
+
+	err := WithRoundTripperExecutor(&Conf{
+		Nw: NetworkConf{TimeoutStr: "5s", Timeout: 30, KeepAliveStr: "30s", KeepAlive: 30},
+	})(dd)
+	if err != nil {
+		t.Fatalf("WithRoundTripperExecutor() error = %v", err)
+	}
+
+	if len(lg.warned) != 1 || lg.warned[0] != "network_timeout" {
+		t.Errorf("warned for %v, want network_timeout only", lg.warned)
+	}
+}
@@ -0,0 +1,171 @@
+package retrier
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// ErrInvalidBudget is returned for budgets with negative ratio or minimum
+var ErrInvalidBudget = errors.New("retry budget: ratio and minPerSec should be non-negative")
+
+// maximum number of requests' worth of deposits retained, so a long
+// healthy period doesn't bank an unbounded number of retries
+const budgetDepositWindow = 100
+
+// RetryBudget limits the retries issued by a Retrier to a fraction of the
+// requests it handles, to avoid retry storms when a downstream browns out.
+// Every request deposits `ratio` tokens and every retry withdraws one.
+// Independently of the traffic, `minPerSec` retries per second are always
+// allowed so low traffic services can still retry.
+// It is shared by all the requests going through the Retrier and is safe
+// for concurrent use.
+type RetryBudget struct {
+	mu sync.Mutex
+
+	ratio     float64
+	minPerSec float64
+
+	balance float64
+	max     float64
+
+	reserve float64
+	last    time.Time
+
+	requests, retries, rejected uint64
+
+	now func() time.Time
+}
+
+// BudgetStats are the counters of a RetryBudget since it was created,
+// Requests/Retries is the attempt amplification
+type BudgetStats struct {
+	// Requests is the number of first attempts
+	Requests uint64
+	// Retries is the number of retries allowed
+	Retries uint64
+	// Rejected is the number of retries refused by the exhausted budget
+	Rejected uint64
+	// Level is the number of retries currently available
+	Level float64
+}
+
+// NewRetryBudget returns a RetryBudget allowing `ratio` retries per request,
+// e.g. 0.1 allows retries for 10% of the requests, plus `minPerSec` retries
+// every second
+func NewRetryBudget(ratio float64, minPerSec int) (*RetryBudget, error) {
+	if ratio < 0 || minPerSec < 0 {
+		return nil, ErrInvalidBudget
+	}
+
+	rb := &RetryBudget{
+		ratio:     ratio,
+		minPerSec: float64(minPerSec),
+		max:       math.Max(1, ratio*budgetDepositWindow),
+		reserve:   float64(minPerSec),
+		now:       time.Now,
+	}
+
+	rb.last = rb.now()
+	return rb, nil
+}
+
+// deposit is called for every request
+func (rb *RetryBudget) deposit() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.requests++
+	rb.balance = math.Min(rb.max, rb.balance+rb.ratio)
+}
+
+// refill expects lock to be held
+func (rb *RetryBudget) refill() {
+	now := rb.now()
+
+	if elapsed := now.Sub(rb.last).Seconds(); elapsed > 0 {
+		rb.reserve = math.Min(rb.minPerSec, rb.reserve+elapsed*rb.minPerSec)
+		rb.last = now
+	}
+}
+
+// withdraw is called before every retry, it returns false if the budget
+// is exhausted
+func (rb *RetryBudget) withdraw() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.refill()
+
+	switch {
+	case rb.balance >= 1:
+		rb.balance--
+	case rb.reserve >= 1:
+		rb.reserve--
+	default:
+		rb.rejected++
+		return false
+	}
+
+	rb.retries++
+	return true
+}
+
+// Level returns the number of retries currently available, to be
+// reported as a metric
+func (rb *RetryBudget) Level() float64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.refill()
+	return rb.level()
+}
+
+// level expects lock to be held
+func (rb *RetryBudget) level() float64 {
+	return math.Floor(rb.balance) + math.Floor(rb.reserve)
+}
+
+// Stats returns the counters of the budget, to be exported as metrics
+func (rb *RetryBudget) Stats() BudgetStats {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.refill()
+	return BudgetStats{
+		Requests: rb.requests,
+		Retries:  rb.retries,
+		Rejected: rb.rejected,
+		Level:    rb.level(),
+	}
+}
+
+// WithRetryBudget limits retries to `ratio` of the requests, plus
+// `minPerSec` retries per second, see RetryBudget.
+// Once the budget is exhausted the Retrier returns the last error
+// without waiting for the backoff
+func WithRetryBudget(ratio float64, minPerSec int) RetrierOption {
+	return func(r *Retrier) error {
+		rb, err := NewRetryBudget(ratio, minPerSec)
+		if err != nil {
+			return err
+		}
+
+		r.budget = rb
+		return nil
+	}
+}
+
+// Budget returns the retry budget of the Retrier, nil if not set
+func (r *Retrier) Budget() *RetryBudget { return r.budget }
+
+// BudgetStats returns the stats of the retry budget of the Retrier, zero
+// if not set
+func (r *Retrier) BudgetStats() BudgetStats {
+	if r.budget == nil {
+		return BudgetStats{}
+	}
+	return r.budget.Stats()
+}
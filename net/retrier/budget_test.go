@@ -0,0 +1,162 @@
+package retrier
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	rb, err := NewRetryBudget(0.5, 1)
+	if err != nil {
+		t.Fatalf("NewRetryBudget() error = %v", err)
+	}
+	rb.now = func() time.Time { return now }
+	rb.last = now
+
+	// reserve allows minPerSec retries without any traffic
+	if !rb.withdraw() || rb.withdraw() {
+		t.Errorf("withdraw() should allow exactly minPerSec retries")
+	}
+
+	// 4 requests at 0.5 ratio deposit 2 retries
+	for i := 0; i < 4; i++ {
+		rb.deposit()
+	}
+
+	if l := rb.Level(); l != 2 {
+		t.Errorf("Level() = %v, want 2", l)
+	}
+
+	if !rb.withdraw() || !rb.withdraw() || rb.withdraw() {
+		t.Errorf("withdraw() should allow deposited retries only")
+	}
+
+	now = now.Add(time.Second)
+	if !rb.withdraw() {
+		t.Errorf("withdraw() should allow retry after reserve refill")
+	}
+
+	if _, err := NewRetryBudget(-1, 0); err != ErrInvalidBudget {
+		t.Errorf("NewRetryBudget() error = %v, want %v", err, ErrInvalidBudget)
+	}
+}
+
+func TestRetryBudgetConcurrent(t *testing.T) {
+	rb, _ := NewRetryBudget(0.1, 0)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		retries int
+	)
+
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				rb.deposit()
+				if rb.withdraw() {
+					mu.Lock()
+					retries++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if retries > 100 {
+		t.Errorf("retries = %d, want at most 10%% of 1000 requests", retries)
+	}
+}
+
+type noDeadline struct{}
+
+func (noDeadline) Deadline() (time.Duration, error) { return 0, errors.New("no deadline") }
+
+func TestRetrierWithExhaustedBudget(t *testing.T) {
+	var calls int
+
+	r, err := NewRetrier(
+		log.FromCtx(context.Background()),
+		func(context.Context, interface{}) (interface{}, error) {
+			calls++
+			return nil, ErrExec
+		},
+		WithRetrierEnable(true),
+		WithRetryCount(5),
+		WithConstantBackoff(&BackoffConf{Incr: int(time.Hour / time.Millisecond)}),
+		WithRetryBudget(0, 0),
+	)
+	if err != nil {
+		t.Fatalf("NewRetrier() error = %v", err)
+	}
+
+	start := time.Now()
+	if _, err := r.Endpoint()(context.Background(), noDeadline{}); err != ErrExec {
+		t.Errorf("Endpoint() error = %v, want %v", err, ErrExec)
+	}
+
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("Endpoint() calls = %d in %v, want a single call without backoff", calls, time.Since(start))
+	}
+}
+
+func TestRetrierBudgetAmplification(t *testing.T) {
+	const (
+		workers = 20
+		calls   = 50
+		ratio   = 0.2
+	)
+
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+
+	r, _ := NewRetrier(
+		log.NewNoopLogger(),
+		func(context.Context, interface{}) (interface{}, error) {
+			mu.Lock()
+			attempts++
+			mu.Unlock()
+			return nil, ErrExec
+		},
+		WithRetrierEnable(true),
+		WithRetryCount(5),
+		WithConstantBackoff(&BackoffConf{Incr: 1}),
+		WithRespectContextDeadline(),
+		WithRetryBudget(ratio, 0),
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				_, _ = r.Endpoint()(context.Background(), nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// without the budget every call makes 5 attempts
+	if max := workers * calls * (1 + ratio); float64(attempts) > max {
+		t.Errorf("attempts = %d, want at most %v", attempts, max)
+	}
+
+	st := r.BudgetStats()
+	if st.Requests != workers*calls || int(st.Requests+st.Retries) != attempts || st.Rejected == 0 {
+		t.Errorf("BudgetStats() = %+v, want %d requests & %d attempts", st, workers*calls, attempts)
+	}
+}
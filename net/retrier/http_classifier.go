@@ -0,0 +1,157 @@
+package retrier
+
+import (
+	"io"
+	net_http "net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderRetryAfter is the header of the responses telling how long
+	// to wait before retrying, in seconds or as an HTTP date
+	HeaderRetryAfter = "Retry-After"
+	// HeaderIdempotencyKey is the header making a request safe to retry,
+	// the downstream dedupes the requests with the same key
+	HeaderIdempotencyKey = "Idempotency-Key"
+)
+
+// bodies of retried responses are read up to it, so the connection can be
+// reused, bigger ones are closed
+const maxDrainBytes = 64 << 10
+
+type (
+	// ClassifierWithDelay is a Classifier which also tells how long to
+	// wait at least before the next attempt, e.g. as asked by the
+	// downstream. The retrier waits for the longer of it & the backoff
+	ClassifierWithDelay func(error, interface{}) (State, time.Duration)
+
+	// HTTPClassifierConfig configures NewHTTPClassifier
+	HTTPClassifierConfig struct {
+		// RetryOn are the status codes retried, 429, 502, 503 & 504
+		// when empty
+		RetryOn []int
+
+		// MaxRetryAfter fails the responses asking to wait longer
+		// instead of retrying them, zero waits as asked
+		MaxRetryAfter time.Duration
+	}
+)
+
+// NewHTTPClassifier returns a ClassifierWithDelay for endpoints which
+// return *net_http.Response, classifying them as StatusCodeClassifier does
+// with cfg.RetryOn. Retried responses with Retry-After are retried once
+// it passed
+func NewHTTPClassifier(cfg HTTPClassifierConfig) ClassifierWithDelay {
+	retryOn := cfg.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []int{
+			net_http.StatusTooManyRequests,
+			net_http.StatusBadGateway,
+			net_http.StatusServiceUnavailable,
+			net_http.StatusGatewayTimeout,
+		}
+	}
+
+	cl := StatusCodeClassifier(retryOn...)
+
+	return func(err error, res interface{}) (State, time.Duration) {
+		cs := cl(err, res)
+		if cs != RETRY {
+			return cs, 0
+		}
+
+		rs, ok := res.(*net_http.Response)
+		if !ok || rs == nil {
+			return cs, 0
+		}
+
+		delay, ok := RetryAfter(rs)
+		if ok && cfg.MaxRetryAfter > 0 && delay > cfg.MaxRetryAfter {
+			return FAIL, 0
+		}
+
+		return cs, delay
+	}
+}
+
+// RetryAfter returns the wait asked by the Retry-After header of rs,
+// given in seconds or as an HTTP date. ok is false without a valid one
+func RetryAfter(rs *net_http.Response) (d time.Duration, ok bool) {
+	v := strings.TrimSpace(rs.Header.Get(HeaderRetryAfter))
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	at, err := net_http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	// a date in the past asks for no wait
+	if d = time.Until(at); d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// WithDelayClassifier classifies the attempts with cl instead of the
+// Classifier, see NewHTTPClassifier
+func WithDelayClassifier(cl ClassifierWithDelay) RetrierOption {
+	return func(r *Retrier) (err error) {
+		r.delayClassfr = cl
+		return
+	}
+}
+
+// drainAndClose reads what is left of the body, up to maxDrainBytes, so
+// the connection goes back to the pool, and closes it
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	_ = body.Close()
+}
+
+// IdempotentRequest tells if req is an *net_http.Request which can be
+// retried safely, the idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT
+// & DELETE) & the requests with an Idempotency-Key header. For
+// WithRetryOn
+func IdempotentRequest(req interface{}) bool {
+	rq, ok := req.(*net_http.Request)
+	if !ok {
+		return false
+	}
+
+	switch rq.Method {
+	case net_http.MethodGet, net_http.MethodHead, net_http.MethodOptions,
+		net_http.MethodTrace, net_http.MethodPut, net_http.MethodDelete:
+		return true
+	}
+
+	return rq.Header.Get(HeaderIdempotencyKey) != ""
+}
+
+// rewind returns req with a fresh body from GetBody when it is an
+// *net_http.Request with one, req as is otherwise
+func rewind(req interface{}) (interface{}, error) {
+	rq, ok := req.(*net_http.Request)
+	if !ok || rq.GetBody == nil || rq.Body == nil || rq.Body == net_http.NoBody {
+		return req, nil
+	}
+
+	body, err := rq.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	rq = rq.WithContext(rq.Context())
+	rq.Body = body
+	return rq, nil
+}
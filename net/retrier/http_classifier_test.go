@@ -0,0 +1,223 @@
+package retrier
+
+import (
+	"context"
+	"io"
+	net_http "net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func response(code int, retryAfter string) *net_http.Response {
+	rs := &net_http.Response{StatusCode: code, Header: make(net_http.Header)}
+	if retryAfter != "" {
+		rs.Header.Set(HeaderRetryAfter, retryAfter)
+	}
+	return rs
+}
+
+func TestNewHTTPClassifier(t *testing.T) {
+	cl := NewHTTPClassifier(HTTPClassifierConfig{MaxRetryAfter: time.Minute})
+
+	tests := []struct {
+		name  string
+		res   *net_http.Response
+		state State
+		delay time.Duration
+	}{
+		{"ok", response(200, ""), PASS, 0},
+		{"too many requests", response(429, "2"), RETRY, 2 * time.Second},
+		{"unavailable", response(503, ""), RETRY, 0},
+		{"unavailable till a date", response(503, time.Now().Add(time.Hour).UTC().Format(net_http.TimeFormat)), FAIL, 0},
+		{"past date", response(503, "Wed, 21 Oct 2015 07:28:00 GMT"), RETRY, 0},
+		{"garbage", response(503, "soon"), RETRY, 0},
+		{"not found", response(404, "1"), FAIL, 0},
+	}
+
+	for _, tt := range tests {
+		state, delay := cl(nil, tt.res)
+		if state != tt.state || delay != tt.delay {
+			t.Errorf("%s = %v, %v, want %v, %v", tt.name, state, delay, tt.state, tt.delay)
+		}
+	}
+
+	at := time.Now().Add(30 * time.Second).UTC().Format(net_http.TimeFormat)
+	if d, ok := RetryAfter(response(503, at)); !ok || d < 28*time.Second || d > 30*time.Second {
+		t.Errorf("RetryAfter(%s) = %v, %v, want about 30s", at, d, ok)
+	}
+
+	if state, _ := cl(ErrExec, nil); state != RETRY {
+		t.Errorf("error without a response = %v, want RETRY", state)
+	}
+}
+
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (tb *trackedBody) Close() error { tb.closed = true; return nil }
+
+func TestWithDelayClassifier(t *testing.T) {
+	var (
+		bodies []*trackedBody
+		stamps []time.Time
+	)
+
+	r, err := NewRetrier(
+		log.NewNoopLogger(),
+		func(context.Context, interface{}) (interface{}, error) {
+			stamps = append(stamps, time.Now())
+
+			rs := response(503, "1")
+			if len(stamps) == 2 {
+				rs = response(200, "")
+			}
+
+			body := &trackedBody{Reader: strings.NewReader("unavailable")}
+			bodies = append(bodies, body)
+			rs.Body = body
+			return rs, nil
+		},
+		WithRetrierEnable(true),
+		WithRespectContextDeadline(),
+		WithConstantBackoff(&BackoffConf{Incr: 1}),
+		WithDelayClassifier(NewHTTPClassifier(HTTPClassifierConfig{})),
+	)
+	if err != nil {
+		t.Fatalf("NewRetrier() error = %v", err)
+	}
+
+	rsi, err := r.Endpoint()(context.Background(), nil)
+	if err != nil || rsi.(*net_http.Response).StatusCode != 200 {
+		t.Fatalf("Endpoint() = %v, %v, want 200", rsi, err)
+	}
+
+	if wait := stamps[1].Sub(stamps[0]); wait < time.Second {
+		t.Errorf("retried after %s, want at least the 1s of Retry-After", wait)
+	}
+
+	// the retried response is drained & closed, the returned one isn't
+	if n, _ := bodies[0].Read(make([]byte, 1)); n != 0 || !bodies[0].closed || bodies[1].closed {
+		t.Errorf("bodies closed = %v, %v, want the retried one drained & closed", bodies[0].closed, bodies[1].closed)
+	}
+}
+
+func TestRetryAfterOnLastAttempt(t *testing.T) {
+	var attempts int
+
+	r, err := NewRetrier(
+		log.NewNoopLogger(),
+		func(context.Context, interface{}) (interface{}, error) {
+			attempts++
+			return response(503, "60"), nil
+		},
+		WithRetrierEnable(true),
+		WithRetryCount(1),
+		WithRespectContextDeadline(),
+		WithConstantBackoff(&BackoffConf{Incr: 1}),
+		WithDelayClassifier(NewHTTPClassifier(HTTPClassifierConfig{})),
+	)
+	if err != nil {
+		t.Fatalf("NewRetrier() error = %v", err)
+	}
+
+	start := time.Now()
+	rsi, _ := r.Endpoint()(context.Background(), nil)
+
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Endpoint() took %s, want the last response without waiting for Retry-After", took)
+	}
+	if rs, ok := rsi.(*net_http.Response); !ok || rs.StatusCode != 503 || attempts != 1 {
+		t.Errorf("Endpoint() = %v after %d attempts, want the 503 of the only attempt", rsi, attempts)
+	}
+}
+
+func TestExecutorRetrierRewindsBody(t *testing.T) {
+	var (
+		bodies   []string
+		attempts []int
+	)
+
+	r, err := NewExecutorRetrier(
+		func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+			bt, _ := io.ReadAll(req.Body)
+			bodies = append(bodies, string(bt))
+
+			if len(bodies) < 3 {
+				return response(503, ""), nil
+			}
+			return response(200, ""), nil
+		},
+		log.NewNoopLogger(),
+		WithRetrierEnable(true),
+		WithRespectContextDeadline(),
+		WithConstantBackoff(&BackoffConf{Incr: 1}),
+		WithClassifier(StatusCodeClassifier()),
+		WithOnAttempt(func(_ context.Context, attempt int, req interface{}, _ error) {
+			attempts = append(attempts, attempt)
+			req.(*net_http.Request).Header.Set(HeaderIdempotencyKey, "order-42")
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewExecutorRetrier() error = %v", err)
+	}
+
+	req, _ := net_http.NewRequest(net_http.MethodPost, "http://catalog/orders", strings.NewReader(`{"id":42}`))
+
+	res, err := r.Executor()(context.Background(), req)
+	if err != nil || res.StatusCode != 200 {
+		t.Fatalf("Executor() = %v, %v, want 200", res, err)
+	}
+
+	if len(bodies) != 3 || bodies[0] != `{"id":42}` || bodies[1] != bodies[0] || bodies[2] != bodies[0] {
+		t.Errorf("bodies sent = %q, want the body on all 3 attempts", bodies)
+	}
+
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Errorf("attempts = %v, want 1, 2 & 3", attempts)
+	}
+}
+
+func TestWithRetryOn(t *testing.T) {
+	var calls int
+
+	r, _ := NewExecutorRetrier(
+		func(context.Context, *net_http.Request) (*net_http.Response, error) {
+			calls++
+			return response(503, ""), nil
+		},
+		log.NewNoopLogger(),
+		WithRetrierEnable(true),
+		WithRetryCount(3),
+		WithRespectContextDeadline(),
+		WithConstantBackoff(&BackoffConf{Incr: 1}),
+		WithClassifier(StatusCodeClassifier()),
+		WithRetryOn(IdempotentRequest),
+	)
+
+	for _, tt := range []struct {
+		method string
+		key    string
+		calls  int
+	}{
+		{net_http.MethodPost, "", 1},
+		{net_http.MethodPost, "order-42", 3},
+		{net_http.MethodPut, "", 3},
+	} {
+		calls = 0
+
+		req, _ := net_http.NewRequest(tt.method, "http://catalog/orders", nil)
+		if tt.key != "" {
+			req.Header.Set(HeaderIdempotencyKey, tt.key)
+		}
+
+		_, _ = r.Executor()(context.Background(), req)
+		if calls != tt.calls {
+			t.Errorf("%s with key %q called %d times, want %d", tt.method, tt.key, calls, tt.calls)
+		}
+	}
+}
@@ -2,12 +2,15 @@ package retrier
 
 import (
 	"context"
+	"io"
+	"math"
 	"math/rand"
 	net_http "net/http"
 	"time"
 
 	"github.com/unbxd/go-base/v2/endpoint"
 	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
 
 	"github.com/unbxd/go-base/v2/errors"
 	"github.com/unbxd/hystrix-go/hystrix"
@@ -28,12 +31,28 @@ var (
 
 	ErrRequestIsNotHTTP  = errors.New("retrier request is not net_http.Request")
 	ErrResponseIsNotHTTP = errors.New("retrier response is not net_http.Response")
+
+	// ErrAttemptTimeout is returned when a single attempt runs longer
+	// than the per-attempt timeout, it matches context.DeadlineExceeded
+	ErrAttemptTimeout error = attemptTimeoutError{}
 )
 
+type attemptTimeoutError struct{}
+
+func (attemptTimeoutError) Error() string        { return "retrier attempt timed out" }
+func (attemptTimeoutError) Timeout() bool        { return true }
+func (attemptTimeoutError) Is(target error) bool { return target == context.DeadlineExceeded }
+
 type (
 	BackoffConf struct {
 		Name string
 		Incr int
+		// Max caps the backoff in milliseconds, used by exponential
+		// backoff
+		Max int
+		// Multiplier grows the exponential backoff on every retry,
+		// defaults to 2
+		Multiplier float64
 	}
 
 	RetrierConf struct {
@@ -56,7 +75,9 @@ type (
 
 	// Classifier takes a given error generated
 	// by the Proxy and assigns a given state based
-	// on the error emitted
+	// on the error emitted. The response returned by the
+	// endpoint is passed as is, for HTTP it is *net_http.Response
+	// and can be nil, see StatusCodeClassifier
 	Classifier func(error, interface{}) State
 
 	// Backoff defines the strategy in which the duration
@@ -81,6 +102,29 @@ type (
 		backoff Backoff
 		jitter  Jitter
 		classfr Classifier
+		// delayClassfr takes precedence over classfr, see
+		// WithDelayClassifier
+		delayClassfr ClassifierWithDelay
+
+		// retryOn tells the requests which can be retried, nil retries
+		// all of them
+		retryOn func(req interface{}) bool
+		// onAttempt is called before every attempt
+		onAttempt func(cx context.Context, attempt int, req interface{}, prevErr error)
+
+		budget *RetryBudget
+
+		// respectDeadline bounds retries by the deadline of the context
+		// instead of the tolerance applied on request's Deadline
+		respectDeadline bool
+
+		// attemptTimeout bounds every single call to fn
+		attemptTimeout time.Duration
+
+		// attemptCounter counts the attempts by their classified state,
+		// attemptsHistogram observes the attempts per call
+		attemptCounter    metrics.Counter
+		attemptsHistogram metrics.Histogram
 
 		fn endpoint.Endpoint
 	}
@@ -89,6 +133,20 @@ type (
 	RetrierOption func(*Retrier) error
 )
 
+// String returns the name of the state, used as metrics label
+func (s State) String() string {
+	switch s {
+	case PASS:
+		return "pass"
+	case FAIL:
+		return "fail"
+	case RETRY:
+		return "retry"
+	default:
+		return "unknown"
+	}
+}
+
 func (r *Retrier) duration(ctr int) time.Duration {
 	return r.backoff(ctr) + r.jitter()
 }
@@ -111,6 +169,53 @@ func (r *Retrier) Executor() Executor {
 	}
 }
 
+// attempt calls fn once, bounded by the per-attempt timeout if set
+func (r *Retrier) attempt(cx context.Context, rqi interface{}) (interface{}, error) {
+	if r.attemptTimeout <= 0 {
+		return r.fn(cx, rqi)
+	}
+
+	acx, canc := context.WithTimeout(cx, r.attemptTimeout)
+
+	rsi, err := r.fn(acx, rqi)
+
+	// the body of a response is read after the attempt, it needs the
+	// context alive till it is closed
+	if rs, ok := rsi.(*net_http.Response); ok && rs != nil && rs.Body != nil && err == nil {
+		rs.Body = &cancelOnClose{rs.Body, canc}
+		return rsi, err
+	}
+
+	canc()
+
+	// parent's context is fine, it's this attempt which timed out
+	if err != nil && acx.Err() == context.DeadlineExceeded && cx.Err() == nil {
+		err = errors.Wrapf(ErrAttemptTimeout, "after %s: %s", r.attemptTimeout, err)
+	}
+
+	return rsi, err
+}
+
+// classify classifies the outcome of an attempt, with the least wait
+// before the next one when the classifier tells it
+func (r *Retrier) classify(err error, rsi interface{}) (State, time.Duration) {
+	if r.delayClassfr != nil {
+		return r.delayClassfr(err, rsi)
+	}
+	return r.classfr(err, rsi), 0
+}
+
+// cancelOnClose cancels the attempt's context when the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	canc context.CancelFunc
+}
+
+func (cc *cancelOnClose) Close() error {
+	defer cc.canc()
+	return cc.ReadCloser.Close()
+}
+
 // Endpoint returns endpoint.Endpoint with retry wrapped
 func (r *Retrier) Endpoint() endpoint.Endpoint {
 	return func(
@@ -122,16 +227,17 @@ func (r *Retrier) Endpoint() endpoint.Endpoint {
 		}
 
 		var (
-			req       Deadliner
 			canc      context.CancelFunc
 			stamp     = time.Now()
 			tolerance = tolerance()()
 			ddl       time.Duration
 		)
 
-		req = rqi.(Deadliner)
-
-		if ddl, err = req.Deadline(); err == nil {
+		if r.respectDeadline {
+			if err = cx.Err(); err != nil {
+				return nil, err
+			}
+		} else if ddl, err = rqi.(Deadliner).Deadline(); err == nil {
 			// this here is for randomization
 			// the request is dropped at the deadline by the
 			// Proxy, but the retrier will try again
@@ -140,6 +246,8 @@ func (r *Retrier) Endpoint() endpoint.Endpoint {
 			// again, till it either hits the count limit or
 			// reach the deadline computed by the arithmetic
 			// request_deadline * tolerance_factor + tolerance_factor
+			//
+			// use WithRespectContextDeadline to skip this
 
 			//TODO check with ujjwal, why multiplication upto 10 on deadline?
 			cx, canc = context.WithTimeout(
@@ -153,6 +261,15 @@ func (r *Retrier) Endpoint() endpoint.Endpoint {
 			}()
 		}
 
+		if r.budget != nil {
+			r.budget.deposit()
+		}
+
+		var attempts int
+		if r.attemptsHistogram != nil {
+			defer func() { r.attemptsHistogram.Observe(float64(attempts)) }()
+		}
+
 		r.logger.Debug("Setting UP Retry Loop", log.Int("retry_count", r.count))
 
 		for i := 0; i < r.count; i++ {
@@ -162,9 +279,34 @@ func (r *Retrier) Endpoint() endpoint.Endpoint {
 				log.Reflect("prev_error", err),
 			)
 
-			rsi, err = r.fn(cx, rqi)
+			// response being retried isn't returned to the caller,
+			// release the connection it holds
+			if rs, ok := rsi.(*net_http.Response); ok && rs != nil && rs.Body != nil {
+				drainAndClose(rs.Body)
+			}
+
+			// the body was read by the attempt before
+			if i > 0 {
+				rw, er := rewind(rqi)
+				if er != nil {
+					return nil, errors.Wrap(er, "failed to rewind the body")
+				}
+				rqi = rw
+			}
+
+			if r.onAttempt != nil {
+				r.onAttempt(cx, i+1, rqi, err)
+			}
+
+			rsi, err = r.attempt(cx, rqi)
+			attempts++
+
+			cs, delay := r.classify(err, rsi)
+			if r.attemptCounter != nil {
+				r.attemptCounter.With("state", cs.String()).Add(1)
+			}
 
-			switch cs := r.classfr(err, rsi); cs {
+			switch cs {
 			case PASS, FAIL:
 				r.logger.Debug("error classified as PASS/FAIL")
 
@@ -179,14 +321,44 @@ func (r *Retrier) Endpoint() endpoint.Endpoint {
 			case RETRY:
 				r.logger.Debug("error classified as RETRY", log.Reflect("error", err))
 
+				if r.retryOn != nil && !r.retryOn(rqi) {
+					r.logger.Debug("request can't be retried, not retrying")
+					return rsi, err
+				}
+
+				// the last attempt, nothing to wait for
+				if i+1 == r.count {
+					r.logger.Debug("retries exhausted, not retrying")
+					return rsi, err
+				}
+
+				if r.budget != nil && !r.budget.withdraw() {
+					r.logger.Debug("retry budget exhausted, not retrying")
+					return rsi, err
+				}
+
 				wait := r.duration(i)
+				if delay > wait {
+					wait = delay
+				}
+
+				if r.respectDeadline {
+					if dl, ok := cx.Deadline(); ok && time.Until(dl) < wait {
+						r.logger.Debug(
+							"backoff exceeds context deadline, not retrying",
+							log.Int64("after", wait.Milliseconds()),
+						)
+						return rsi, err
+					}
+				}
+
 				tc := time.After(wait)
 
 				select {
 				case <-tc:
 					r.logger.Debug(
 						"encountered error, retrying",
-						log.String("prev-err", err.Error()),
+						log.Reflect("prev-err", err),
 						log.Int64("after", wait.Milliseconds()),
 					)
 					break
@@ -211,6 +383,14 @@ func (r *Retrier) Endpoint() endpoint.Endpoint {
 	}
 }
 
+// Wrap returns the endpoint of the retrier around fn instead of the one
+// it was built with, the options, the budget & the metrics are shared
+func (r *Retrier) Wrap(fn endpoint.Endpoint) endpoint.Endpoint {
+	rc := *r
+	rc.fn = fn
+	return rc.Endpoint()
+}
+
 // NewRetrier returns a new Retrier
 func NewRetrier(logger log.Logger, fn endpoint.Endpoint, options ...RetrierOption) (*Retrier, error) {
 	r := &Retrier{
@@ -262,6 +442,8 @@ func classifier(logger log.Logger) Classifier {
 		case errors.Cause(err) == ErrResponseIsNil:
 			fallthrough
 		case errors.Cause(err) == ErrExec:
+			fallthrough
+		case errors.Cause(err) == ErrAttemptTimeout:
 			logger.Debug("RETRYING with Classified ERROR",
 				log.String("error", err.Error()),
 				log.String("error_cause", errors.Cause(err).Error()),
@@ -283,16 +465,54 @@ func classifier(logger log.Logger) Classifier {
 	}
 }
 
-// default jitter
-func jitter() Jitter {
-	rn := rand.New(
-		rand.NewSource(
-			time.Now().UnixNano(),
-		),
+// StatusCodeClassifier returns a Classifier for endpoints which return
+// *net_http.Response, e.g. the ones wrapped by Executor. Responses with
+// status code in retryOn are retried (502, 503 & 504 when none given),
+// other 4xx & 5xx responses fail and the rest pass.
+// When there is no response (nil, or not an *net_http.Response) the error
+// is classified by the default classifier.
+func StatusCodeClassifier(retryOn ...int) Classifier {
+	if len(retryOn) == 0 {
+		retryOn = []int{
+			net_http.StatusBadGateway,
+			net_http.StatusServiceUnavailable,
+			net_http.StatusGatewayTimeout,
+		}
+	}
+
+	var (
+		retry = make(map[int]bool, len(retryOn))
+		dflt  = classifier(log.NewNoopLogger())
 	)
 
+	for _, code := range retryOn {
+		retry[code] = true
+	}
+
+	return func(err error, res interface{}) State {
+		rs, ok := res.(*net_http.Response)
+		if !ok || rs == nil {
+			return dflt(err, res)
+		}
+
+		switch {
+		case retry[rs.StatusCode]:
+			return RETRY
+		case rs.StatusCode >= net_http.StatusBadRequest:
+			return FAIL
+		case err != nil:
+			return dflt(err, res)
+		default:
+			return PASS
+		}
+	}
+}
+
+// default jitter, uses the global source as the Retrier is shared by
+// concurrent requests
+func jitter() Jitter {
 	return func() time.Duration {
-		return time.Duration(rn.Intn(1000)) * time.Microsecond
+		return time.Duration(rand.Intn(1000)) * time.Microsecond
 	}
 }
 
@@ -370,6 +590,134 @@ func WithConstantBackoff(conf *BackoffConf) RetrierOption {
 	}
 }
 
+// defaults of exponential backoff, the cap in milliseconds
+const (
+	defaultBackoffMax        = 10000
+	defaultBackoffMultiplier = 2
+)
+
+// exponential returns the backoff growing from conf.Incr by
+// conf.Multiplier on every retry, capped at conf.Max milliseconds
+func exponential(conf *BackoffConf) Backoff {
+	var (
+		incr = 100
+		max  = defaultBackoffMax
+		mult = float64(defaultBackoffMultiplier)
+	)
+
+	if conf.Incr > 0 {
+		incr = conf.Incr
+	}
+
+	if conf.Max > 0 {
+		max = conf.Max
+	}
+
+	if conf.Multiplier >= 1 {
+		mult = conf.Multiplier
+	}
+
+	var (
+		base = float64(time.Duration(incr) * time.Millisecond)
+		ceil = time.Duration(max) * time.Millisecond
+	)
+
+	return func(ctr int) time.Duration {
+		if ctr < 0 {
+			return 0 * time.Millisecond
+		}
+
+		// compared as float, large counters overflow to +Inf
+		d := base * math.Pow(mult, float64(ctr))
+		if d >= float64(ceil) {
+			return ceil
+		}
+
+		return time.Duration(d)
+	}
+}
+
+// WithExponentialBackoff multiplies the timer on every retry starting
+// from conf.Incr, i.e. `Incr * Multiplier^ctr`, capped at conf.Max
+// milliseconds. Incr defaults to 100ms, Multiplier to 2 and Max to 10s
+func WithExponentialBackoff(conf *BackoffConf) RetrierOption {
+	return func(r *Retrier) error {
+		r.backoff = exponential(conf)
+		return nil
+	}
+}
+
+// WithFullJitterBackoff waits a random duration between zero and the one
+// of WithExponentialBackoff, AWS' "full jitter". The callers retrying a
+// recovering downstream spread out instead of retrying in lockstep
+func WithFullJitterBackoff(conf *BackoffConf) RetrierOption {
+	return func(r *Retrier) error {
+		exp := exponential(conf)
+
+		r.backoff = func(ctr int) time.Duration {
+			d := exp(ctr)
+			if d <= 0 {
+				return d
+			}
+
+			// the global source, backoff is called concurrently
+			return time.Duration(rand.Int63n(int64(d) + 1))
+		}
+		return nil
+	}
+}
+
+// WithPerAttemptTimeout bounds every attempt by its own timeout, so a
+// hung call is abandoned and the next retry begins instead of consuming
+// the whole retry window. The context of the attempt is derived from the
+// incoming one, which still short-circuits the retries.
+// Timed out attempts fail with ErrAttemptTimeout, which the default
+// classifier retries. For *net_http.Response the context is released
+// when the body is closed
+func WithPerAttemptTimeout(d time.Duration) RetrierOption {
+	return func(r *Retrier) (err error) {
+		r.attemptTimeout = d
+		return
+	}
+}
+
+// WithMetrics reports the attempts made by the retrier to provider.
+// `<prefix>.retrier.attempt` counts every attempt tagged with `state`,
+// the classified state (pass/fail/retry), `<prefix>.retrier.attempts`
+// observes the number of attempts per call of the endpoint. Use prefix
+// to tell the downstreams apart, e.g. `catalog`. Calls made while the
+// retrier is disabled aren't reported
+func WithMetrics(provider metrics.Provider, prefix string) RetrierOption {
+	return func(r *Retrier) (err error) {
+		if provider == nil {
+			return
+		}
+
+		name := "retrier"
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		r.attemptCounter = provider.NewCounter(name+".attempt", 1)
+		r.attemptsHistogram = provider.NewHistogram(name+".attempts", 1)
+		return
+	}
+}
+
+// WithRespectContextDeadline bounds the retries by the deadline of the
+// incoming context. By default the Retrier extends the deadline of the
+// request (see Deadliner) by a random tolerance of up to 9x, with this
+// option the tolerance isn't applied, the request doesn't need to be a
+// Deadliner and retries stop as soon as the context is done or when the
+// next backoff would exceed the remaining time, giving predictable
+// latency bounds
+func WithRespectContextDeadline() RetrierOption {
+	return func(r *Retrier) (err error) {
+		r.respectDeadline = true
+		return
+	}
+}
+
 // WithRetryCount sets custom retry count for Retrier
 func WithRetryCount(count int) RetrierOption {
 	return func(r *Retrier) (err error) {
@@ -401,6 +749,25 @@ func WithClassifier(cl Classifier) RetrierOption {
 	}
 }
 
+// WithRetryOn retries only the requests fn allows, e.g.
+// IdempotentRequest, the others fail on the first error. Defaults to
+// retrying all of them
+func WithRetryOn(fn func(req interface{}) bool) RetrierOption {
+	return func(r *Retrier) (err error) {
+		r.retryOn = fn
+		return
+	}
+}
+
+// WithOnAttempt calls fn before every attempt, counted from 1, with the
+// error of the one before, e.g. to set a header on the request
+func WithOnAttempt(fn func(cx context.Context, attempt int, req interface{}, prevErr error)) RetrierOption {
+	return func(r *Retrier) (err error) {
+		r.onAttempt = fn
+		return
+	}
+}
+
 // NewRetrierFromConfig returns a new retrier based on configuration
 func NewRetrierFromConfig(fn endpoint.Endpoint, lg log.Logger, cfg *RetrierConf, opts ...RetrierOption) (*Retrier, error) {
 
@@ -414,6 +781,10 @@ func NewRetrierFromConfig(fn endpoint.Endpoint, lg log.Logger, cfg *RetrierConf,
 		switch cfg.Backoff.Name {
 		case "linear":
 			opts = append(opts, WithLinearBackoff(cfg.Backoff))
+		case "exponential":
+			opts = append(opts, WithExponentialBackoff(cfg.Backoff))
+		case "exponential-jitter":
+			opts = append(opts, WithFullJitterBackoff(cfg.Backoff))
 		case "constant":
 			fallthrough
 		default:
@@ -0,0 +1,302 @@
+package retrier
+
+import (
+	"context"
+	"fmt"
+	net_http "net/http"
+	"testing"
+	"time"
+
+	kit_metrics "github.com/go-kit/kit/metrics"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
+)
+
+// metricsRecorder records the counts by labels & the observations
+type metricsRecorder struct {
+	metrics.Provider
+
+	names    []string
+	counts   map[string]float64
+	observed []float64
+}
+
+type recordedCounter struct {
+	mr  *metricsRecorder
+	lvs string
+}
+
+func (rc recordedCounter) With(lvs ...string) kit_metrics.Counter {
+	return recordedCounter{rc.mr, fmt.Sprint(lvs)}
+}
+
+func (rc recordedCounter) Add(delta float64) { rc.mr.counts[rc.lvs] += delta }
+
+type recordedHistogram struct{ mr *metricsRecorder }
+
+func (rh recordedHistogram) With(...string) kit_metrics.Histogram { return rh }
+
+func (rh recordedHistogram) Observe(v float64) { rh.mr.observed = append(rh.mr.observed, v) }
+
+func (mr *metricsRecorder) NewCounter(name string, _ float64) metrics.Counter {
+	mr.names = append(mr.names, name)
+	return recordedCounter{mr: mr}
+}
+
+func (mr *metricsRecorder) NewHistogram(name string, _ float64) metrics.Histogram {
+	mr.names = append(mr.names, name)
+	return recordedHistogram{mr}
+}
+
+func TestWithExponentialBackoff(t *testing.T) {
+	r := &Retrier{}
+	if err := WithExponentialBackoff(&BackoffConf{Incr: 100, Max: 1000})(r); err != nil {
+		t.Fatalf("WithExponentialBackoff() error = %v", err)
+	}
+
+	for ctr, want := range map[int]time.Duration{
+		0:   100 * time.Millisecond,
+		1:   200 * time.Millisecond,
+		3:   800 * time.Millisecond,
+		4:   time.Second,
+		63:  time.Second,
+		100: time.Second,
+	} {
+		if got := r.backoff(ctr); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", ctr, got, want)
+		}
+	}
+}
+
+func TestExponentialBackoffMultiplier(t *testing.T) {
+	r := &Retrier{}
+	if err := WithExponentialBackoff(&BackoffConf{Incr: 10, Multiplier: 1.5, Max: 500})(r); err != nil {
+		t.Fatalf("WithExponentialBackoff() error = %v", err)
+	}
+
+	if got := r.backoff(2); got != 22500*time.Microsecond {
+		t.Errorf("backoff(2) = %v, want 22.5ms", got)
+	}
+
+	prev := time.Duration(0)
+	for ctr := 0; ctr < 100; ctr++ {
+		got := r.backoff(ctr)
+		if got < prev || got > 500*time.Millisecond {
+			t.Fatalf("backoff(%d) = %v after %v, want monotonic up to 500ms", ctr, got, prev)
+		}
+		prev = got
+	}
+
+	if prev != 500*time.Millisecond {
+		t.Errorf("backoff(99) = %v, want the cap", prev)
+	}
+}
+
+func TestWithFullJitterBackoff(t *testing.T) {
+	var (
+		conf = &BackoffConf{Incr: 100, Max: 1000}
+		exp  = &Retrier{}
+		r    = &Retrier{}
+	)
+	_ = WithExponentialBackoff(conf)(exp)
+	_ = WithFullJitterBackoff(conf)(r)
+
+	for ctr := 0; ctr < 8; ctr++ {
+		var (
+			ceil = exp.backoff(ctr)
+			sum  time.Duration
+		)
+
+		for i := 0; i < 1000; i++ {
+			got := r.backoff(ctr)
+			if got < 0 || got > ceil {
+				t.Fatalf("backoff(%d) = %v, want within [0, %v]", ctr, got, ceil)
+			}
+			sum += got
+		}
+
+		// uniform, the mean is around half of the exponential one
+		if mean := sum / 1000; mean < ceil*4/10 || mean > ceil*6/10 {
+			t.Errorf("mean of backoff(%d) = %v, want around %v", ctr, mean, ceil/2)
+		}
+	}
+}
+
+func TestNewRetrierFromConfigBackoff(t *testing.T) {
+	for name, full := range map[string]bool{"exponential": false, "exponential-jitter": true} {
+		r, err := NewRetrierFromConfig(nil, log.NewNoopLogger(), &RetrierConf{
+			Backoff: &BackoffConf{Name: name, Incr: 100, Max: 1000},
+		})
+		if err != nil {
+			t.Fatalf("NewRetrierFromConfig(%s) error = %v", name, err)
+		}
+
+		jittered := false
+		for i := 0; i < 100 && !jittered; i++ {
+			jittered = r.backoff(3) != 800*time.Millisecond
+		}
+
+		if jittered != full {
+			t.Errorf("backoff of %s jittered = %v, want %v", name, jittered, full)
+		}
+	}
+}
+
+func TestWithRespectContextDeadline(t *testing.T) {
+	var calls int
+
+	r, err := NewRetrier(
+		log.FromCtx(context.Background()),
+		func(context.Context, interface{}) (interface{}, error) {
+			calls++
+			return nil, ErrExec
+		},
+		WithRetrierEnable(true),
+		WithRetryCount(5),
+		WithConstantBackoff(&BackoffConf{Incr: int(time.Hour / time.Millisecond)}),
+		WithRespectContextDeadline(),
+	)
+	if err != nil {
+		t.Fatalf("NewRetrier() error = %v", err)
+	}
+
+	cx, canc := context.WithTimeout(context.Background(), time.Second)
+	defer canc()
+
+	// request doesn't implement Deadliner, the context bounds the retries.
+	// constant backoff retries immediately once, the next wait of an hour
+	// is past the deadline
+	start := time.Now()
+	if _, err := r.Endpoint()(cx, struct{}{}); err != ErrExec {
+		t.Errorf("Endpoint() error = %v, want %v", err, ErrExec)
+	}
+
+	if calls != 2 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Endpoint() calls = %d in %v, want 2 calls without waiting", calls, time.Since(start))
+	}
+
+	canc()
+	if _, err := r.Endpoint()(cx, struct{}{}); err != context.Canceled || calls != 2 {
+		t.Errorf("Endpoint() error = %v, calls = %d, want %v without calls", err, calls, context.Canceled)
+	}
+}
+
+func TestStatusCodeClassifier(t *testing.T) {
+	var nilResponse *net_http.Response
+
+	tests := []struct {
+		name string
+		cl   Classifier
+		err  error
+		res  interface{}
+		want State
+	}{
+		{"ok", StatusCodeClassifier(), nil, &net_http.Response{StatusCode: 200}, PASS},
+		{"bad gateway", StatusCodeClassifier(), nil, &net_http.Response{StatusCode: 502}, RETRY},
+		{"unavailable", StatusCodeClassifier(), nil, &net_http.Response{StatusCode: 503}, RETRY},
+		{"bad request", StatusCodeClassifier(), nil, &net_http.Response{StatusCode: 400}, FAIL},
+		{"unauthorized", StatusCodeClassifier(), nil, &net_http.Response{StatusCode: 401}, FAIL},
+		{"internal not in retryOn", StatusCodeClassifier(), nil, &net_http.Response{StatusCode: 500}, FAIL},
+		{"custom retryOn", StatusCodeClassifier(429), nil, &net_http.Response{StatusCode: 429}, RETRY},
+		{"custom excludes default", StatusCodeClassifier(429), nil, &net_http.Response{StatusCode: 503}, FAIL},
+		{"nil response", StatusCodeClassifier(), ErrResponseIsNil, nil, RETRY},
+		{"typed nil response", StatusCodeClassifier(), ErrExec, nilResponse, RETRY},
+		{"nil response no error", StatusCodeClassifier(), nil, nilResponse, PASS},
+		{"unknown error", StatusCodeClassifier(), ErrRequestIsNotHTTP, nil, FAIL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl(tt.err, tt.res); got != tt.want {
+				t.Errorf("Classifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithPerAttemptTimeout(t *testing.T) {
+	var calls int
+
+	r, err := NewRetrier(
+		log.FromCtx(context.Background()),
+		func(cx context.Context, _ interface{}) (interface{}, error) {
+			calls++
+			if calls == 1 {
+				// hung downstream
+				<-cx.Done()
+				return nil, cx.Err()
+			}
+			return "ok", cx.Err()
+		},
+		WithRetrierEnable(true),
+		WithRetryCount(3),
+		WithConstantBackoff(&BackoffConf{Incr: 1}),
+		WithRespectContextDeadline(),
+		WithPerAttemptTimeout(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewRetrier() error = %v", err)
+	}
+
+	rs, err := r.Endpoint()(context.Background(), nil)
+	if err != nil || rs != "ok" || calls != 2 {
+		t.Errorf("Endpoint() = %v, %v, calls = %d, want ok after 2 calls", rs, err, calls)
+	}
+
+	// overall context still short-circuits the retries
+	calls = 0
+	cx, canc := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer canc()
+
+	if _, err := r.Endpoint()(cx, nil); err != context.DeadlineExceeded || calls != 1 {
+		t.Errorf("Endpoint() error = %v, calls = %d, want %v after 1 call", err, calls, context.DeadlineExceeded)
+	}
+
+	terr := errors.Wrapf(ErrAttemptTimeout, "after %s", time.Second)
+	if !errors.Is(terr, context.DeadlineExceeded) || classifier(log.NewNoopLogger())(terr, nil) != RETRY {
+		t.Errorf("ErrAttemptTimeout should be deadline exceeded & classified RETRY")
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	var (
+		mr    = &metricsRecorder{counts: map[string]float64{}}
+		calls int
+	)
+
+	r, err := NewRetrier(
+		log.NewNoopLogger(),
+		func(context.Context, interface{}) (interface{}, error) {
+			calls++
+			if calls%3 == 0 {
+				return nil, nil
+			}
+			return nil, ErrExec
+		},
+		WithRetrierEnable(true),
+		WithConstantBackoff(&BackoffConf{Incr: 1}),
+		WithRespectContextDeadline(),
+		WithMetrics(mr, "catalog"),
+	)
+	if err != nil {
+		t.Fatalf("NewRetrier() error = %v", err)
+	}
+
+	if want := []string{"catalog.retrier.attempt", "catalog.retrier.attempts"}; fmt.Sprint(mr.names) != fmt.Sprint(want) {
+		t.Errorf("metrics = %v, want %v", mr.names, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Endpoint()(context.Background(), struct{}{}); err != nil {
+			t.Fatalf("Endpoint() error = %v", err)
+		}
+	}
+
+	if want := map[string]float64{"[state retry]": 4, "[state pass]": 2}; fmt.Sprint(mr.counts) != fmt.Sprint(want) {
+		t.Errorf("attempt counts = %v, want %v", mr.counts, want)
+	}
+
+	if want := []float64{3, 3}; fmt.Sprint(mr.observed) != fmt.Sprint(want) {
+		t.Errorf("attempts observed = %v, want %v", mr.observed, want)
+	}
+}
@@ -0,0 +1,51 @@
+package notifier
+
+import (
+	"context"
+	"sync"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+type (
+	// Handler receives the data notified in the process
+	Handler func(cx context.Context, data interface{}) error
+
+	// InMemoryNotifier delivers the notifications to the handlers
+	// subscribed in the same process, nothing leaves the binary
+	InMemoryNotifier struct {
+		mu       sync.RWMutex
+		handlers []Handler
+	}
+)
+
+// Subscribe adds a handler, called for the notifications after this one
+func (in *InMemoryNotifier) Subscribe(handler Handler) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.handlers = append(in.handlers, handler)
+}
+
+// Notify calls the handlers in the order they subscribed, before
+// returning. A failing handler doesn't stop the others, their errors are
+// joined
+func (in *InMemoryNotifier) Notify(cx context.Context, data interface{}) error {
+	in.mu.RLock()
+	handlers := in.handlers
+	in.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(cx, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewInMemoryNotifier returns a notifier delivering to the handlers in the
+// process, more can subscribe later
+func NewInMemoryNotifier(handlers ...Handler) *InMemoryNotifier {
+	return &InMemoryNotifier{handlers: handlers}
+}
@@ -0,0 +1,247 @@
+package rate
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/cache"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const defaultResolverTTL = 5 * time.Second
+
+// ErrInvalidPattern is returned for rules with malformed key patterns
+var ErrInvalidPattern = errors.New("rate: invalid key pattern")
+
+type (
+	// limitMemo caches resolved limits per key for a short ttl, so the
+	// resolver isn't hit on every request
+	limitMemo struct {
+		ttl time.Duration
+		now func() time.Time
+
+		mu      sync.Mutex
+		entries map[Key]memoEntry
+
+		// order holds the keys in the order they expire, the ttl is
+		// the same for all the entries
+		order []memoExpiry
+	}
+
+	memoEntry struct {
+		limits  Limits
+		ok      bool
+		expires time.Time
+	}
+
+	memoExpiry struct {
+		key     Key
+		expires time.Time
+	}
+
+	// DynamicLimiterOption customises the dynamic limiter
+	DynamicLimiterOption func(*dynamicLimiter)
+
+	dynamicLimiter struct {
+		base     LimitsLimiter
+		resolver LimitResolver
+		fallback Limits
+		memo     *limitMemo
+	}
+
+	// Rules maps keys to their limits. A rule is either an exact key or
+	// a pattern in path.Match syntax, e.g. `plan:free:*`.
+	// An exact key wins over patterns, the longest matching pattern wins
+	// over shorter ones
+	Rules map[string]Limits
+
+	pattern struct {
+		pattern string
+		limits  Limits
+	}
+
+	// compiledRules is Rules split into exact keys & patterns ordered by
+	// precedence
+	compiledRules struct {
+		exact    map[Key]Limits
+		patterns []pattern
+	}
+)
+
+func newLimitMemo(ttl time.Duration, now func() time.Time) *limitMemo {
+	return &limitMemo{ttl: ttl, now: now, entries: make(map[Key]memoEntry)}
+}
+
+func (m *limitMemo) get(key Key, resolve func() (Limits, bool)) (Limits, bool) {
+	now := m.now()
+
+	m.mu.Lock()
+	en, found := m.entries[key]
+	m.mu.Unlock()
+
+	if found && now.Before(en.expires) {
+		return en.limits, en.ok
+	}
+
+	limits, ok := resolve()
+
+	m.mu.Lock()
+	m.sweep(now)
+	m.entries[key] = memoEntry{limits, ok, now.Add(m.ttl)}
+	m.order = append(m.order, memoExpiry{key, now.Add(m.ttl)})
+	m.mu.Unlock()
+
+	return limits, ok
+}
+
+// sweep drops the expired entries, keys which are not seen again
+// shouldn't be retained forever. Only the expired head of order is
+// visited, the entries stored again since are kept
+func (m *limitMemo) sweep(now time.Time) {
+	n := 0
+	for ; n < len(m.order) && !now.Before(m.order[n].expires); n++ {
+		ex := m.order[n]
+		if en, ok := m.entries[ex.key]; ok && en.expires.Equal(ex.expires) {
+			delete(m.entries, ex.key)
+		}
+	}
+
+	m.order = m.order[n:]
+}
+
+// WithResolverTTL sets for how long the resolved limits of a key are
+// reused before the resolver is consulted again, i.e. how long a change
+// of limits takes to apply. Defaults to 5s
+func WithResolverTTL(ttl time.Duration) DynamicLimiterOption {
+	return func(dl *dynamicLimiter) {
+		if ttl > 0 {
+			dl.memo.ttl = ttl
+		}
+	}
+}
+
+func (dl *dynamicLimiter) Allow(cx context.Context, key Key) (bool, error) {
+	limits, ok := dl.memo.get(key, func() (Limits, bool) {
+		limit, burst, ok := dl.resolver.Resolve(cx, key)
+		return Limits{limit, burst}, ok
+	})
+
+	if !ok {
+		if dl.fallback == (Limits{}) {
+			return dl.base.Allow(cx, key)
+		}
+		limits = dl.fallback
+	}
+
+	return dl.base.AllowWithLimits(cx, key, limits)
+}
+
+// NewDynamicLimiter returns a Limiter which applies the limits resolved
+// per key, e.g. by the plan of the tenant, on top of base. Buckets are
+// kept by base, a change of limits carries over the tokens left in the
+// bucket instead of resetting it.
+// Resolved limits are memoized (see WithResolverTTL). Keys the resolver
+// doesn't know get the fallback limits, or the limits of base when the
+// fallback is zero. Resolved limits which aren't positive deny the key.
+// base must implement LimitsLimiter, as the limiters of this package do
+func NewDynamicLimiter(
+	base Limiter,
+	resolver LimitResolver,
+	fallback Limits,
+	options ...DynamicLimiterOption,
+) (Limiter, error) {
+	ll, ok := base.(LimitsLimiter)
+	if !ok {
+		return nil, ErrNotDynamic
+	}
+
+	if fallback != (Limits{}) {
+		if err := fallback.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	dl := &dynamicLimiter{
+		base:     ll,
+		resolver: resolver,
+		fallback: fallback,
+		memo:     newLimitMemo(defaultResolverTTL, time.Now),
+	}
+
+	for _, o := range options {
+		o(dl)
+	}
+
+	return dl, nil
+}
+
+func (r Rules) compile() (*compiledRules, error) {
+	cr := &compiledRules{exact: make(map[Key]Limits)}
+
+	for k, l := range r {
+		if _, err := path.Match(k, ""); err != nil {
+			return nil, errors.Wrapf(ErrInvalidPattern, "pattern: %q", k)
+		}
+
+		cr.exact[Key(k)] = l
+		cr.patterns = append(cr.patterns, pattern{k, l})
+	}
+
+	sort.Slice(cr.patterns, func(i, j int) bool {
+		pi, pj := cr.patterns[i].pattern, cr.patterns[j].pattern
+		if len(pi) != len(pj) {
+			return len(pi) > len(pj)
+		}
+		return pi < pj
+	})
+
+	return cr, nil
+}
+
+func (cr *compiledRules) resolve(key Key) (Limits, bool) {
+	if l, ok := cr.exact[key]; ok {
+		return l, true
+	}
+
+	for _, p := range cr.patterns {
+		if ok, _ := path.Match(p.pattern, string(key)); ok {
+			return p.limits, true
+		}
+	}
+
+	return Limits{}, false
+}
+
+// NewStaticResolver returns a LimitResolver for a fixed set of rules
+func NewStaticResolver(rules Rules) (LimitResolver, error) {
+	cr, err := rules.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return LimitResolverFunc(func(_ context.Context, key Key) (float64, int, bool) {
+		l, ok := cr.resolve(key)
+		return l.Limit, l.Burst, ok
+	}), nil
+}
+
+// NewCacheResolver returns a LimitResolver which reads the limits of a
+// key from the cache at prefix+key, stored as JSON encoded Limits
+func NewCacheResolver(c cache.Cache, prefix string) LimitResolver {
+	return LimitResolverFunc(func(cx context.Context, key Key) (float64, int, bool) {
+		bt, ok := c.Get(cx, prefix+string(key))
+		if !ok {
+			return 0, 0, false
+		}
+
+		var l Limits
+		if err := json.Unmarshal(bt, &l); err != nil {
+			return 0, 0, false
+		}
+		return l.Limit, l.Burst, true
+	})
+}
@@ -0,0 +1,243 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/data/driver"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// fakeDriver serves a single document whose changes are pushed by the test
+type fakeDriver struct {
+	driver.Driver
+
+	data   []byte
+	events chan *driver.Event
+}
+
+func (fd *fakeDriver) Watch(string) ([]byte, <-chan *driver.Event, error) {
+	return fd.data, fd.events, nil
+}
+
+func newTestDynamicLimiter(t *testing.T, resolver LimitResolver, fallback Limits, now *time.Time) *dynamicLimiter {
+	t.Helper()
+
+	base, err := NewInMemoryLimiter(1, 1)
+	if err != nil {
+		t.Fatalf("NewInMemoryLimiter() error = %v", err)
+	}
+	base.(*inMemoryLimiter).now = func() time.Time { return *now }
+
+	l, err := NewDynamicLimiter(base, resolver, fallback, WithResolverTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("NewDynamicLimiter() error = %v", err)
+	}
+
+	dl := l.(*dynamicLimiter)
+	dl.memo.now = func() time.Time { return *now }
+	return dl
+}
+
+// allowed counts the requests of key allowed out of n
+func allowed(l Limiter, key Key, n int) int {
+	var c int
+	for i := 0; i < n; i++ {
+		if ok, _ := l.Allow(context.Background(), key); ok {
+			c++
+		}
+	}
+	return c
+}
+
+func TestDynamicLimiterPrecedence(t *testing.T) {
+	resolver, err := NewStaticResolver(Rules{
+		"plan:pro:acme": {Limit: 1, Burst: 7},
+		"plan:pro:*":    {Limit: 1, Burst: 5},
+		"plan:*":        {Limit: 1, Burst: 3},
+	})
+	if err != nil {
+		t.Fatalf("NewStaticResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      Key
+		fallback Limits
+		want     int
+	}{
+		{"exact", "plan:pro:acme", Limits{}, 7},
+		{"longest pattern", "plan:pro:other", Limits{}, 5},
+		{"shorter pattern", "plan:free:other", Limits{}, 3},
+		{"fallback", "other", Limits{Limit: 1, Burst: 2}, 2},
+		{"base", "other", Limits{}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			dl := newTestDynamicLimiter(t, resolver, tt.fallback, &now)
+
+			if got := allowed(dl, tt.key, 10); got != tt.want {
+				t.Errorf("allowed = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDynamicLimiterMemo(t *testing.T) {
+	var (
+		now   = time.Unix(0, 0)
+		calls int
+		burst = 2
+	)
+
+	resolver := LimitResolverFunc(func(context.Context, Key) (float64, int, bool) {
+		calls++
+		return 1, burst, true
+	})
+
+	dl := newTestDynamicLimiter(t, resolver, Limits{}, &now)
+
+	allowed(dl, "a", 3)
+	if calls != 1 {
+		t.Errorf("resolver calls = %d, want 1 within ttl", calls)
+	}
+
+	now = now.Add(time.Minute)
+	burst = 4
+
+	if got := allowed(dl, "a", 10); got != 4 {
+		t.Errorf("allowed after ttl = %d, want 4", got)
+	}
+	if calls != 2 {
+		t.Errorf("resolver calls = %d, want 2 after ttl", calls)
+	}
+}
+
+func TestLimitMemoSweep(t *testing.T) {
+	var (
+		now  = time.Unix(0, 0)
+		memo = newLimitMemo(time.Minute, func() time.Time { return now })
+		hit  = func() (Limits, bool) { return Limits{1, 1}, true }
+	)
+
+	for i := 0; i < 2000; i++ {
+		memo.get(Key(strconv.Itoa(i)), hit)
+	}
+
+	// expired early & stored again, a second after the others
+	now = now.Add(time.Second)
+	memo.entries["7"] = memoEntry{}
+	memo.get("7", hit)
+
+	now = now.Add(time.Minute - time.Millisecond)
+	memo.get("new", hit)
+
+	if len(memo.entries) != 2 || len(memo.order) != 2 {
+		t.Errorf("memo entries = %d, order = %d, want the new & the refreshed key", len(memo.entries), len(memo.order))
+	}
+	if _, ok := memo.entries["7"]; !ok {
+		t.Error("refreshed key swept before it expired")
+	}
+}
+
+func TestDynamicLimiterKeepsBucket(t *testing.T) {
+	var (
+		now   = time.Unix(0, 0)
+		burst = 5
+	)
+
+	resolver := LimitResolverFunc(func(context.Context, Key) (float64, int, bool) {
+		return 0.125, burst, true
+	})
+
+	dl := newTestDynamicLimiter(t, resolver, Limits{}, &now)
+
+	if got := allowed(dl, "a", 10); got != 5 {
+		t.Fatalf("allowed = %d, want 5", got)
+	}
+
+	// burst goes up, the drained bucket keeps refilling from where it was
+	// (7.5 tokens in a minute) instead of starting over full
+	burst = 10
+	now = now.Add(time.Minute)
+
+	if got := allowed(dl, "a", 20); got != 7 {
+		t.Errorf("allowed after increase = %d, want 7, bucket was reset", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := allowed(dl, "a", 20); got != 10 {
+		t.Errorf("allowed after refill = %d, want 10", got)
+	}
+}
+
+func TestDriverResolver(t *testing.T) {
+	fd := &fakeDriver{
+		data:   []byte(`{"plan:*":{"limit":1,"burst":2}}`),
+		events: make(chan *driver.Event),
+	}
+
+	dr, err := NewDriverResolver(fd, "/limits", log.NewNoopLogger())
+	if err != nil {
+		t.Fatalf("NewDriverResolver() error = %v", err)
+	}
+	defer dr.Close()
+
+	now := time.Unix(0, 0)
+	dl := newTestDynamicLimiter(t, dr, Limits{}, &now)
+
+	if got := allowed(dl, "plan:free", 5); got != 2 {
+		t.Errorf("allowed = %d, want 2", got)
+	}
+
+	fd.events <- &driver.Event{Type: driver.EventDataChanged, D: []byte(`{bad`)}
+	fd.events <- &driver.Event{
+		Type: driver.EventDataChanged,
+		D:    []byte(`{"plan:*":{"limit":1,"burst":2},"plan:free":{"limit":1,"burst":4}}`),
+	}
+	// the watcher is done with the update once it takes the next event
+	fd.events <- &driver.Event{Type: driver.EventChildrenChanged}
+
+	if l, b, _ := dr.Resolve(context.Background(), "plan:free"); l != 1 || b != 4 {
+		t.Errorf("Resolve() after change = %v, %v, want 1, 4", l, b)
+	}
+
+	now = now.Add(time.Minute + 4*time.Second)
+	if got := allowed(dl, "plan:free", 10); got != 4 {
+		t.Errorf("allowed after change = %d, want 4", got)
+	}
+
+	fd.events <- &driver.Event{Type: driver.EventDeleted}
+	fd.events <- &driver.Event{Type: driver.EventChildrenChanged}
+
+	if _, _, ok := dr.Resolve(context.Background(), "plan:free"); ok {
+		t.Errorf("Resolve() after delete found limits")
+	}
+
+	fd.data = []byte(`{bad`)
+	if _, err := NewDriverResolver(fd, "/limits", log.NewNoopLogger()); err == nil {
+		t.Errorf("NewDriverResolver() with bad document should fail")
+	}
+}
+
+func TestNewDynamicLimiterErrors(t *testing.T) {
+	resolver, _ := NewStaticResolver(nil)
+	base, _ := NewInMemoryLimiter(1, 1)
+
+	if _, err := NewDynamicLimiter(struct{ Limiter }{base}, resolver, Limits{}); err != ErrNotDynamic {
+		t.Errorf("NewDynamicLimiter() error = %v, want %v", err, ErrNotDynamic)
+	}
+
+	if _, err := NewDynamicLimiter(base, resolver, Limits{Limit: -1, Burst: 1}); err == nil {
+		t.Errorf("NewDynamicLimiter() with invalid fallback should fail")
+	}
+
+	if _, err := NewStaticResolver(Rules{"plan:[": {1, 1}}); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("NewStaticResolver() error = %v, want %v", err, ErrInvalidPattern)
+	}
+}
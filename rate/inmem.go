@@ -0,0 +1,88 @@
+package rate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket for the time elapsed since last access and
+// consumes one token if available. The limits can change between calls,
+// the tokens left are carried over, capped by the burst
+func (b *bucket) take(now time.Time, limit float64, burst int) bool {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * limit
+		b.last = now
+	}
+
+	b.tokens = math.Min(float64(burst), b.tokens)
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+type inMemoryLimiter struct {
+	limit float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[Key]*bucket
+	now     func() time.Time
+}
+
+func (l *inMemoryLimiter) Allow(cx context.Context, key Key) (bool, error) {
+	return l.AllowWithLimits(cx, key, Limits{l.limit, l.burst})
+}
+
+// AllowWithLimits takes a token from the bucket of the key, refilled as
+// per the limits passed
+func (l *inMemoryLimiter) AllowWithLimits(_ context.Context, key Key, limits Limits) (bool, error) {
+	if err := limits.validate(); err != nil {
+		return false, err
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limits.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	return b.take(now, limits.Limit, limits.Burst), nil
+}
+
+// NewInMemoryLimiter returns a token bucket Limiter which keeps the
+// buckets in process memory. Each key refills at `limit` tokens per
+// second up to `burst` tokens.
+// Buckets are never removed, it is suited for low cardinality keys
+func NewInMemoryLimiter(limit float64, burst int) (Limiter, error) {
+	if limit <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	if burst <= 0 {
+		return nil, ErrInvalidBurst
+	}
+
+	return &inMemoryLimiter{
+		limit:   limit,
+		burst:   burst,
+		buckets: make(map[Key]*bucket),
+		now:     time.Now,
+	}, nil
+}
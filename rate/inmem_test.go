@@ -0,0 +1,41 @@
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInMemoryLimiter(t *testing.T) {
+	var (
+		cx  = context.Background()
+		now = time.Unix(0, 0)
+	)
+
+	l, err := NewInMemoryLimiter(1, 2)
+	if err != nil {
+		t.Fatalf("NewInMemoryLimiter() error = %v", err)
+	}
+
+	iml := l.(*inMemoryLimiter)
+	iml.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, false} {
+		if got, _ := l.Allow(cx, "a"); got != want {
+			t.Errorf("Allow() #%d = %v, want %v", i, got, want)
+		}
+	}
+
+	if got, _ := l.Allow(cx, "b"); !got {
+		t.Errorf("Allow() on a different key should have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if got, _ := l.Allow(cx, "a"); !got {
+		t.Errorf("Allow() after refill = false, want true")
+	}
+
+	if _, err := NewInMemoryLimiter(0, 1); err != ErrInvalidLimit {
+		t.Errorf("NewInMemoryLimiter() error = %v, want %v", err, ErrInvalidLimit)
+	}
+}
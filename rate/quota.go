@@ -0,0 +1,105 @@
+package rate
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/unbxd/go-base/v2/data/cache"
+)
+
+// incrScript adds to the usage, the expiry is set when it is created so
+// the usage is dropped at the end of its window.
+// KEYS[1] usage, ARGV[1] increment, ARGV[2] ttl in milliseconds
+var incrScript = redis.NewScript(`
+local used = redis.call('INCRBY', KEYS[1], ARGV[1])
+if used == tonumber(ARGV[1]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return used
+`)
+
+type (
+	// QuotaStore counts the usage of quotas, unlike a Limiter it counts
+	// calls over long windows, e.g. a day or a month
+	QuotaStore interface {
+		// Incr adds n to the usage of key and returns it, the usage
+		// expires after ttl
+		Incr(cx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+	}
+
+	// QuotaWindow returns the bounds of the window now is in, the usage
+	// of a quota resets at the end of its window
+	QuotaWindow func(now time.Time) (start, end time.Time)
+
+	cacheQuotaStore struct {
+		mu    sync.Mutex
+		cache cache.Cache
+	}
+
+	redisQuotaStore struct {
+		client redis.Scripter
+	}
+)
+
+// FixedQuotaWindow returns windows of d, aligned on the multiples of d
+// since the zero time, in UTC. e.g. an hour starts on the hour
+func FixedQuotaWindow(d time.Duration) QuotaWindow {
+	return func(now time.Time) (time.Time, time.Time) {
+		start := now.UTC().Truncate(d)
+		return start, start.Add(d)
+	}
+}
+
+// DailyQuotaWindow returns windows of a day, from midnight UTC
+func DailyQuotaWindow() QuotaWindow { return FixedQuotaWindow(24 * time.Hour) }
+
+// MonthlyQuotaWindow returns windows of a calendar month, from the first
+// of the month UTC
+func MonthlyQuotaWindow() QuotaWindow {
+	return func(now time.Time) (time.Time, time.Time) {
+		now = now.UTC()
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// NewCacheQuotaStore returns a QuotaStore keeping the usage as a decimal
+// in c. The increments are atomic within the process only, instances
+// sharing a remote cache can lose increments made at the same time, see
+// NewRedisQuotaStore
+func NewCacheQuotaStore(c cache.Cache) QuotaStore {
+	return &cacheQuotaStore{cache: c}
+}
+
+func (cs *cacheQuotaStore) Incr(cx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var used int64
+	if bt, ok := cs.cache.Get(cx, key); ok {
+		// garbage is a new usage
+		used, _ = strconv.ParseInt(string(bt), 10, 64)
+	}
+
+	used += n
+	cs.cache.SetWithDuration(cx, key, []byte(strconv.FormatInt(used, 10)), ttl)
+	return used, nil
+}
+
+// NewRedisQuotaStore returns a QuotaStore keeping the usage as a counter
+// in redis, shared by all the instances of the application
+func NewRedisQuotaStore(client redis.Scripter) QuotaStore {
+	return &redisQuotaStore{client: client}
+}
+
+func (rs *redisQuotaStore) Incr(cx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+
+	return incrScript.Run(cx, rs.client, []string{key}, n, ms).Int64()
+}
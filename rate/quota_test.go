@@ -0,0 +1,68 @@
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/unbxd/go-base/v2/data/cache"
+)
+
+func TestQuotaWindows(t *testing.T) {
+	now := time.Date(2024, time.February, 29, 13, 45, 0, 0, time.FixedZone("IST", 19800))
+
+	tests := []struct {
+		name       string
+		window     QuotaWindow
+		start, end time.Time
+	}{
+		{"hourly", FixedQuotaWindow(time.Hour), time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)},
+		{"daily", DailyQuotaWindow(), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly", MonthlyQuotaWindow(), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		start, end := tt.window(now)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s window = [%s, %s), want [%s, %s)", tt.name, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestQuotaStores(t *testing.T) {
+	var (
+		cx = context.Background()
+		mr = miniredis.RunT(t)
+	)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	inmem, _ := cache.NewInMemoryCache(time.Minute, time.Minute)
+
+	stores := map[string]QuotaStore{
+		"cache": NewCacheQuotaStore(inmem),
+		"redis": NewRedisQuotaStore(client),
+	}
+
+	for name, store := range stores {
+		for i, want := range []int64{1, 3, 4} {
+			n := int64(1)
+			if i == 1 {
+				n = 2
+			}
+
+			if got, err := store.Incr(cx, "tenant", n, time.Minute); got != want || err != nil {
+				t.Errorf("%s Incr() #%d = %d, %v, want %d", name, i, got, err, want)
+			}
+		}
+	}
+
+	// the usage expires with the window it was created in
+	mr.FastForward(time.Minute)
+	if got, _ := stores["redis"].Incr(cx, "tenant", 1, time.Minute); got != 1 {
+		t.Errorf("redis Incr() after the ttl = %d, want 1", got)
+	}
+}
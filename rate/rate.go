@@ -0,0 +1,76 @@
+// Package rate provides request rate limiting primitives. Limiters are
+// keyed, every distinct Key (client ip, tenant, api key) gets its own
+// bucket.
+package rate
+
+import (
+	"context"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Errors
+var (
+	ErrInvalidLimit = errors.New("rate: limit should be positive")
+	ErrInvalidBurst = errors.New("rate: burst should be positive")
+
+	ErrNotDynamic = errors.New("rate: limiter doesn't support limits per call")
+)
+
+type (
+	// Key identifies the bucket the request is accounted against
+	Key string
+
+	// Limiter decides if a request for the given key is allowed.
+	// A non-nil error means the decision could not be made, implementations
+	// return false along with the error (fail-closed)
+	Limiter interface {
+		Allow(cx context.Context, key Key) (bool, error)
+	}
+
+	// WaitLimiter is a Limiter which can also wait for the key to be
+	// allowed, instead of denying it right away
+	WaitLimiter interface {
+		Limiter
+		Wait(cx context.Context, key Key) error
+	}
+
+	// Limits is the refill rate per second & the bucket size of a key
+	Limits struct {
+		Limit float64 `json:"limit"`
+		Burst int     `json:"burst"`
+	}
+
+	// LimitsLimiter is a Limiter which also takes the limits per call.
+	// Both share the bucket state, limits can change between the calls
+	// without resetting the bucket. Required by NewDynamicLimiter
+	LimitsLimiter interface {
+		Limiter
+		AllowWithLimits(cx context.Context, key Key, limits Limits) (bool, error)
+	}
+
+	// LimitResolver resolves the limits of a key, ok is false when the
+	// key has no limits configured
+	LimitResolver interface {
+		Resolve(cx context.Context, key Key) (limit float64, burst int, ok bool)
+	}
+
+	// LimitResolverFunc is a func adapter for LimitResolver
+	LimitResolverFunc func(cx context.Context, key Key) (limit float64, burst int, ok bool)
+)
+
+// Resolve calls fn
+func (fn LimitResolverFunc) Resolve(cx context.Context, key Key) (float64, int, bool) {
+	return fn(cx, key)
+}
+
+func (l Limits) validate() error {
+	if l.Limit <= 0 {
+		return ErrInvalidLimit
+	}
+
+	if l.Burst <= 0 {
+		return ErrInvalidBurst
+	}
+	return nil
+}
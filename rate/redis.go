@@ -0,0 +1,189 @@
+package rate
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const (
+	defaultRedisKeyPrefix   = "rate:"
+	defaultLimitProviderTTL = 30 * time.Second
+)
+
+// tokenBucketScript keeps the bucket as a hash of `tokens` and `ts`
+// (server time in microseconds), refilling it on every call.
+// Server time is used so the limiter is immune to clock skew between
+// application nodes.
+// The limits aren't part of the state, they are passed on every call and
+// can change between calls, the tokens left are carried over.
+// KEYS[1] bucket, ARGV[1] limit per second, ARGV[2] burst
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1])
+local ts = tonumber(b[2])
+
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+local elapsed = math.max(0, now - ts)
+tokens = math.min(burst, tokens + (elapsed / 1000000) * limit)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst / limit) * 1000) * 2)
+
+return allowed
+`)
+
+type (
+	// LimitProvider resolves the limit & burst for a key. Returning zero
+	// values for both falls back to the limiter defaults, a non-positive
+	// limit or burst otherwise denies the key. It is a LimitResolver
+	LimitProvider func(key Key) (limit float64, burst int)
+
+	// RedisLimiterOption customises the redis limiter
+	RedisLimiterOption func(*redisLimiter)
+
+	redisLimiter struct {
+		client redis.Scripter
+		prefix string
+
+		limit float64
+		burst int
+
+		provider    LimitProvider
+		providerTTL time.Duration
+		dynamic     Limiter
+
+		now  func() time.Time
+		take func(cx context.Context, key string, limit float64, burst int) (bool, error)
+	}
+
+	// redisDefaults applies the constructor limits to every key, the
+	// base of the dynamic limiter of WithLimitProvider
+	redisDefaults struct{ *redisLimiter }
+)
+
+// Resolve calls fn, the keys for which it returns zero limits have no
+// limits configured
+func (fn LimitProvider) Resolve(_ context.Context, key Key) (float64, int, bool) {
+	limit, burst := fn(key)
+	return limit, burst, limit != 0 || burst != 0
+}
+
+// WithRedisKeyPrefix sets the prefix for keys of buckets stored in redis,
+// defaults to `rate:`
+func WithRedisKeyPrefix(prefix string) RedisLimiterOption {
+	return func(rl *redisLimiter) { rl.prefix = prefix }
+}
+
+// WithLimitProvider resolves the limits per key at Allow time, instead of
+// applying the constructor limits to every key. The result is cached in
+// process for the ttl (30s if ttl is not positive). It is the limiter
+// wrapped by NewDynamicLimiter with fn as the resolver
+func WithLimitProvider(fn LimitProvider, ttl time.Duration) RedisLimiterOption {
+	return func(rl *redisLimiter) {
+		if ttl <= 0 {
+			ttl = defaultLimitProviderTTL
+		}
+
+		rl.provider = fn
+		rl.providerTTL = ttl
+	}
+}
+
+func (rl *redisLimiter) redisTake(
+	cx context.Context,
+	key string,
+	limit float64,
+	burst int,
+) (bool, error) {
+	res, err := tokenBucketScript.Run(cx, rl.client, []string{key}, limit, burst).Int()
+	if err != nil {
+		return false, errors.Wrap(err, "rate: failed to run token bucket")
+	}
+
+	return res == 1, nil
+}
+
+// withProvider resolves the limits of Allow with the provider, if set
+func (rl *redisLimiter) withProvider() {
+	if rl.provider == nil {
+		return
+	}
+
+	rl.dynamic = &dynamicLimiter{
+		base:     redisDefaults{rl},
+		resolver: rl.provider,
+		memo:     newLimitMemo(rl.providerTTL, func() time.Time { return rl.now() }),
+	}
+}
+
+// Allow takes a token from the bucket of the key. Invalid limits deny
+// the request without calling redis, redis errors deny it as well
+func (rl *redisLimiter) Allow(cx context.Context, key Key) (bool, error) {
+	if rl.dynamic != nil {
+		return rl.dynamic.Allow(cx, key)
+	}
+	return redisDefaults{rl}.Allow(cx, key)
+}
+
+func (rd redisDefaults) Allow(cx context.Context, key Key) (bool, error) {
+	return rd.AllowWithLimits(cx, key, Limits{rd.limit, rd.burst})
+}
+
+// AllowWithLimits takes a token from the bucket of the key, refilled as
+// per the limits passed. LimitProvider isn't consulted
+func (rl *redisLimiter) AllowWithLimits(cx context.Context, key Key, limits Limits) (bool, error) {
+	if err := limits.validate(); err != nil {
+		return false, err
+	}
+
+	return rl.take(cx, rl.prefix+string(key), limits.Limit, limits.Burst)
+}
+
+// NewRedisLimiter returns a token bucket Limiter with buckets stored in
+// redis, shared by all the instances of the application. Each key refills
+// at `limit` tokens per second up to `burst` tokens.
+// The limiter fails closed, if redis can't be reached requests are denied.
+// Requires redis 7+ (see data/cache/redis).
+func NewRedisLimiter(
+	client redis.Scripter,
+	limit float64,
+	burst int,
+	options ...RedisLimiterOption,
+) Limiter {
+	rl := &redisLimiter{
+		client: client,
+		prefix: defaultRedisKeyPrefix,
+		limit:  limit,
+		burst:  burst,
+		now:    time.Now,
+	}
+
+	rl.take = rl.redisTake
+
+	for _, o := range options {
+		o(rl)
+	}
+
+	rl.withProvider()
+
+	return rl
+}
@@ -0,0 +1,167 @@
+package rate
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const defaultRedisLeakyKeyPrefix = "rate:leaky:"
+
+// leakyBucketScript keeps the bucket as a hash of `level` and `ts`
+// (server time in microseconds). The level is the queue of units not yet
+// sent, it drains at ARGV[1] per second. A unit is queued if the queue
+// stays within ARGV[2] and its turn comes within ARGV[3] microseconds,
+// unbounded when negative. The script returns the microseconds until its
+// turn, -1 when the queue is full & -2 when the turn comes too late.
+// KEYS[1] bucket, ARGV[1] rate per second, ARGV[2] capacity, ARGV[3] max
+// wait in microseconds
+var leakyBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local maxWait = tonumber(ARGV[3])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local b = redis.call('HMGET', KEYS[1], 'level', 'ts')
+local level = tonumber(b[1]) or 0
+local ts = tonumber(b[2]) or now
+
+local elapsed = math.max(0, now - ts)
+level = math.max(0, level - (elapsed / 1000000) * rate)
+
+if level + 1 > capacity then
+	redis.call('HSET', KEYS[1], 'level', tostring(level), 'ts', tostring(now))
+	return -1
+end
+
+local wait = math.floor((level / rate) * 1000000)
+if maxWait >= 0 and wait > maxWait then
+	redis.call('HSET', KEYS[1], 'level', tostring(level), 'ts', tostring(now))
+	return -2
+end
+level = level + 1
+
+redis.call('HSET', KEYS[1], 'level', tostring(level), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity / rate) * 1000) * 2)
+
+return wait
+`)
+
+// ErrQueueFull is returned by the Wait of the leaky bucket limiter when
+// the queue of the key is full
+var ErrQueueFull = errors.New("rate: queue is full")
+
+type (
+	// redisLeakyLimiter is the leaky bucket limiter, Wait queues the unit
+	redisLeakyLimiter struct{ *redisLimiter }
+
+	// leakyWaitKey marks the context of Wait, for the take of the limiter
+	// to wait for the turn of the unit
+	leakyWaitKey struct{}
+)
+
+// Wait queues a unit in the bucket of the key & blocks until its turn or
+// cx is done. It fails right away with ErrQueueFull if the queue is full,
+// & with ErrWaitDeadline if the turn comes after the deadline of cx
+func (ll *redisLeakyLimiter) Wait(cx context.Context, key Key) error {
+	ok, err := ll.Allow(context.WithValue(cx, leakyWaitKey{}, true), key)
+	if err == nil && !ok {
+		return ErrQueueFull
+	}
+	return err
+}
+
+func (rl *redisLimiter) redisLeak(
+	cx context.Context,
+	key string,
+	rate float64,
+	capacity int,
+) (bool, error) {
+	// Allow doesn't wait, Wait does up to the deadline of cx
+	var (
+		waiting, _ = cx.Value(leakyWaitKey{}).(bool)
+		maxWait    = int64(0)
+	)
+
+	if waiting {
+		maxWait = -1
+		if deadline, ok := cx.Deadline(); ok {
+			// negative is unbounded, a deadline passed allows no wait
+			maxWait = max(0, time.Until(deadline).Microseconds())
+		}
+	}
+
+	wait, err := leakyBucketScript.Run(
+		cx, rl.client, []string{key}, rate, capacity, maxWait,
+	).Int64()
+	if err != nil {
+		return false, errors.Wrap(err, "rate: failed to run leaky bucket")
+	}
+
+	switch {
+	case wait == -2 && waiting:
+		return false, ErrWaitDeadline
+	case wait < 0:
+		return false, nil
+	case wait == 0:
+		return true, nil
+	}
+
+	timer := time.NewTimer(time.Duration(wait) * time.Microsecond)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-cx.Done():
+		// the unit stays queued, its slot is lost
+		return false, cx.Err()
+	}
+}
+
+// NewRedisLeakyBucketLimiter returns a leaky bucket Limiter with buckets
+// stored in redis, shared by all the instances of the application. Each
+// key is a queue draining at `rate` units per second, holding at most
+// `capacity` units.
+//
+// Unlike the token bucket of NewRedisLimiter, it doesn't burst. The token
+// bucket lets `burst` requests through at once after a quiet period, here
+// the units go out strictly paced at `rate`, 1/rate apart. Allow doesn't
+// block, it lets a unit through only when its turn is now, i.e. the queue
+// is empty, so it fits the HTTP rate limit filter. Wait queues the unit &
+// blocks until its turn, use it to smooth the traffic to a downstream
+// which enforces a strict rate, the queue holding up to `capacity` units.
+// The token bucket is the better fit to protect a server, where a burst
+// shouldn't be denied.
+//
+// The limiter fails closed like NewRedisLimiter and takes the same
+// options, the limits of WithLimitProvider are the rate & capacity. Keys
+// are prefixed with `rate:leaky:` by default
+func NewRedisLeakyBucketLimiter(
+	client redis.Scripter,
+	rate float64,
+	capacity int,
+	options ...RedisLimiterOption,
+) WaitLimiter {
+	rl := &redisLimiter{
+		client: client,
+		prefix: defaultRedisLeakyKeyPrefix,
+		limit:  rate,
+		burst:  capacity,
+		now:    time.Now,
+	}
+
+	rl.take = rl.redisLeak
+
+	for _, o := range options {
+		o(rl)
+	}
+
+	rl.withProvider()
+
+	return &redisLeakyLimiter{rl}
+}
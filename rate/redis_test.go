@@ -0,0 +1,134 @@
+package rate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+)
+
+type call struct {
+	key   string
+	limit float64
+	burst int
+}
+
+func TestRedisLimiterLimitProvider(t *testing.T) {
+	var (
+		cx    = context.Background()
+		now   = time.Unix(0, 0)
+		calls []call
+		hits  = make(map[Key]int)
+	)
+
+	provider := func(key Key) (float64, int) {
+		hits[key]++
+		switch {
+		case strings.HasPrefix(string(key), "user:premium:"):
+			return 100, 200
+		case key == "blocked":
+			return 0, 5
+		default:
+			return 0, 0
+		}
+	}
+
+	rl := NewRedisLimiter(nil, 10, 20, WithLimitProvider(provider, time.Minute)).(*redisLimiter)
+	rl.now = func() time.Time { return now }
+	rl.take = func(_ context.Context, key string, limit float64, burst int) (bool, error) {
+		calls = append(calls, call{key, limit, burst})
+		return true, nil
+	}
+
+	rl.Allow(cx, "user:premium:1")
+	rl.Allow(cx, "user:free:1")
+
+	want := []call{{"rate:user:premium:1", 100, 200}, {"rate:user:free:1", 10, 20}}
+	for i, c := range want {
+		if calls[i] != c {
+			t.Errorf("call #%d = %+v, want %+v", i, calls[i], c)
+		}
+	}
+
+	if ok, err := rl.Allow(cx, "blocked"); ok || err != ErrInvalidLimit {
+		t.Errorf("Allow() with zero limit = %v, %v, want denied", ok, err)
+	}
+
+	if len(calls) != 2 {
+		t.Errorf("denied key shouldn't reach redis, calls = %d", len(calls))
+	}
+
+	rl.Allow(cx, "user:premium:1")
+	if hits["user:premium:1"] != 1 {
+		t.Errorf("provider hits = %d, want cached", hits["user:premium:1"])
+	}
+
+	now = now.Add(2 * time.Minute)
+	rl.Allow(cx, "user:premium:1")
+	if hits["user:premium:1"] != 2 {
+		t.Errorf("provider hits = %d, want refreshed after ttl", hits["user:premium:1"])
+	}
+}
+
+func TestRedisLeakyBucketLimiter(t *testing.T) {
+	var (
+		cx  = context.Background()
+		mr  = miniredis.RunT(t)
+		now = time.Now()
+	)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	// the clock of redis stands still, nothing drains
+	mr.SetTime(now)
+
+	rl := NewRedisLeakyBucketLimiter(client, 50, 3)
+
+	// Allow doesn't wait, only the unit of an empty queue goes through
+	if ok, err := rl.Allow(cx, "k"); !ok || err != nil {
+		t.Fatalf("Allow() = %v, %v, want allowed", ok, err)
+	}
+	if ok, err := rl.Allow(cx, "k"); ok || err != nil {
+		t.Errorf("Allow() while a unit is queued = %v, %v, want denied", ok, err)
+	}
+
+	// the turn comes 20ms later, after the deadline
+	dcx, cancel := context.WithTimeout(cx, 5*time.Millisecond)
+	defer cancel()
+	if err := rl.Wait(dcx, "k"); err != ErrWaitDeadline {
+		t.Errorf("Wait() past the deadline error = %v, want %v", err, ErrWaitDeadline)
+	}
+
+	// queued units wait for their turn, 20ms apart
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := rl.Wait(cx, "k"); err != nil {
+			t.Fatalf("Wait() #%d error = %v", i, err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("2 units let through in %s, want paced 20ms apart", elapsed)
+	}
+
+	if err := rl.Wait(cx, "k"); err != ErrQueueFull {
+		t.Errorf("Wait() on a full queue error = %v, want %v", err, ErrQueueFull)
+	}
+	if ok, err := rl.Allow(cx, "k"); ok || err != nil {
+		t.Errorf("Allow() on a full queue = %v, %v, want denied", ok, err)
+	}
+
+	mr.SetTime(now.Add(time.Second))
+	if ok, err := rl.Allow(cx, "k"); !ok || err != nil {
+		t.Errorf("Allow() after draining = %v, %v, want allowed", ok, err)
+	}
+
+	mr.Close()
+	if ok, err := rl.Allow(cx, "k"); ok || err == nil {
+		t.Errorf("Allow() with redis down = %v, %v, want denied with error", ok, err)
+	}
+}
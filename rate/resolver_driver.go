@@ -0,0 +1,135 @@
+package rate
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/unbxd/go-base/v2/data/driver"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// DriverResolver is a LimitResolver backed by a rules document stored at
+// a path of a driver (e.g. zookeeper). The document is JSON encoded Rules
+//
+//	{
+//		"plan:free:*": {"limit": 10, "burst": 10},
+//		"plan:pro:*":  {"limit": 100, "burst": 200},
+//		"plan:pro:acme": {"limit": 500, "burst": 500}
+//	}
+//
+// The document is watched and reloaded on change. A malformed update is
+// logged and ignored, the last good rules stay in effect. Deleting the
+// document removes all the rules
+type DriverResolver struct {
+	logger log.Logger
+	path   string
+
+	rules atomic.Value // *compiledRules
+
+	done chan struct{}
+	once sync.Once
+}
+
+func parseRules(bt []byte) (*compiledRules, error) {
+	var rules Rules
+
+	if len(bt) > 0 {
+		if err := json.Unmarshal(bt, &rules); err != nil {
+			return nil, errors.Wrap(err, "rate: failed to parse rules")
+		}
+	}
+
+	return rules.compile()
+}
+
+func (dr *DriverResolver) watch(events <-chan *driver.Event) {
+	for {
+		select {
+		case <-dr.done:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				dr.logger.Error(
+					"rate limit rules watch stopped, rules won't reload",
+					log.String("path", dr.path),
+				)
+				return
+			}
+
+			dr.apply(ev)
+		}
+	}
+}
+
+func (dr *DriverResolver) apply(ev *driver.Event) {
+	if ev.Error() != nil {
+		dr.logger.Error(
+			"rate limit rules watch failed",
+			log.String("path", dr.path), log.Error(ev.Error()),
+		)
+		return
+	}
+
+	switch ev.EventType() {
+	case driver.EventDeleted:
+		dr.logger.Warn("rate limit rules deleted", log.String("path", dr.path))
+		dr.rules.Store(&compiledRules{})
+	case driver.EventCreated, driver.EventDataChanged:
+		bt, _ := ev.Data().([]byte)
+
+		cr, err := parseRules(bt)
+		if err != nil {
+			dr.logger.Error(
+				"rate limit rules ignored",
+				log.String("path", dr.path), log.Error(err),
+			)
+			return
+		}
+
+		dr.rules.Store(cr)
+		dr.logger.Info("rate limit rules reloaded", log.String("path", dr.path))
+	}
+}
+
+// Resolve returns the limits of the rule matching the key
+func (dr *DriverResolver) Resolve(_ context.Context, key Key) (float64, int, bool) {
+	l, ok := dr.rules.Load().(*compiledRules).resolve(key)
+	return l.Limit, l.Burst, ok
+}
+
+// Close stops watching the document
+func (dr *DriverResolver) Close() {
+	dr.once.Do(func() { close(dr.done) })
+}
+
+// NewDriverResolver reads the rules document at path and watches it for
+// changes. It fails if the document can't be read or parsed
+func NewDriverResolver(
+	d driver.Driver,
+	path string,
+	logger log.Logger,
+) (*DriverResolver, error) {
+	bt, events, err := d.Watch(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rate: failed to watch rules at %s", path)
+	}
+
+	cr, err := parseRules(bt)
+	if err != nil {
+		return nil, err
+	}
+
+	dr := &DriverResolver{
+		logger: logger,
+		path:   path,
+		done:   make(chan struct{}),
+	}
+
+	dr.rules.Store(cr)
+
+	go dr.watch(events)
+	return dr, nil
+}
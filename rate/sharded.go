@@ -0,0 +1,484 @@
+package rate
+
+import (
+	"context"
+	"hash/maphash"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const (
+	// buckets expired per call on the shard, the sweep is spread over
+	// the calls instead of a pass over all the keys
+	shardSweepBatch = 16
+
+	// estimated overhead of a map entry of the index, besides the key
+	mapEntryOverhead = 16
+)
+
+// Errors of the sharded limiter
+var (
+	ErrWaitDeadline = errors.New("rate: wait would exceed the context deadline")
+	ErrExceedsBurst = errors.New("rate: tokens requested exceed the burst")
+)
+
+type (
+	// ShardedLimiterOption customises the sharded limiter
+	ShardedLimiterOption func(*ShardedLimiter)
+
+	// ShardStats are the stats of a shard of the sharded limiter
+	ShardStats struct {
+		Keys        int    `json:"keys"`
+		Calls       uint64 `json:"calls"`
+		Contended   uint64 `json:"contended"`
+		Expirations uint64 `json:"expirations"`
+		Evictions   uint64 `json:"evictions"`
+	}
+
+	// ShardedLimiter is an in memory token bucket Limiter for high key
+	// cardinality, see NewShardedLimiter
+	ShardedLimiter struct {
+		limit float64
+		burst int
+
+		shards []shard
+		mask   uint64
+		seed   maphash.Seed
+
+		idle    time.Duration
+		maxKeys int // per shard
+
+		// tillFull keeps the idle buckets till they are full at their own
+		// limits, unless WithIdleExpiry is set
+		tillFull bool
+
+		start time.Time
+		now   func() time.Time
+	}
+
+	// slot is a bucket in the slots of the shard, linked in the order of
+	// access, the least recently used first
+	slot struct {
+		key    Key
+		tokens float64
+		last   int64 // ns since the start of the limiter
+		full   int64 // ns since the start, when the bucket is full
+
+		prev, next int32
+	}
+
+	shard struct {
+		mu sync.Mutex
+
+		index map[Key]int32
+		slots []slot
+
+		head, tail int32 // least & most recently used
+		free       int32 // free slots, linked by next
+
+		peak     int // size of the index before the last shrink
+		keyBytes int
+
+		calls, contended, expirations, evictions uint64
+
+		// keeps the shards off each other's cache lines
+		_ [64]byte
+	}
+)
+
+// WithShards sets the number of shards, rounded up to a power of two.
+// Defaults to 4 × GOMAXPROCS
+func WithShards(n int) ShardedLimiterOption {
+	return func(sl *ShardedLimiter) {
+		if n > 0 {
+			sl.shards = make([]shard, 1<<bitsFor(n))
+		}
+	}
+}
+
+// WithIdleExpiry sets how long a key is kept once idle, whatever the
+// tokens left. By default a key is kept till its bucket is full at the
+// limits it was last taken with, see AllowWithLimits, a full bucket is
+// the same as a new one
+func WithIdleExpiry(d time.Duration) ShardedLimiterOption {
+	return func(sl *ShardedLimiter) {
+		if d > 0 {
+			sl.idle = d
+		}
+	}
+}
+
+// WithMaxKeys bounds the number of keys kept, the least recently used key
+// of a shard is evicted for a new one once the shard has its share of n.
+// Unbounded by default
+func WithMaxKeys(n int) ShardedLimiterOption {
+	return func(sl *ShardedLimiter) {
+		if n > 0 {
+			sl.maxKeys = n
+		}
+	}
+}
+
+// bitsFor returns the bits to address n, rounded up to a power of two
+func bitsFor(n int) int {
+	b := 0
+	for 1<<b < n {
+		b++
+	}
+	return b
+}
+
+func (sh *shard) lock() {
+	if !sh.mu.TryLock() {
+		sh.mu.Lock()
+		sh.contended++
+	}
+	sh.calls++
+}
+
+func (sh *shard) unlink(i int32) {
+	s := &sh.slots[i]
+
+	if s.prev >= 0 {
+		sh.slots[s.prev].next = s.next
+	} else {
+		sh.head = s.next
+	}
+
+	if s.next >= 0 {
+		sh.slots[s.next].prev = s.prev
+	} else {
+		sh.tail = s.prev
+	}
+}
+
+// touch moves the slot to the most recently used end
+func (sh *shard) touch(i int32) {
+	s := &sh.slots[i]
+	s.prev, s.next = sh.tail, -1
+
+	if sh.tail >= 0 {
+		sh.slots[sh.tail].next = i
+	} else {
+		sh.head = i
+	}
+	sh.tail = i
+}
+
+// removeHead frees the slot of the least recently used key
+func (sh *shard) removeHead() {
+	i := sh.head
+	sh.unlink(i)
+
+	s := &sh.slots[i]
+	delete(sh.index, s.key)
+	sh.keyBytes -= len(s.key)
+
+	*s = slot{next: sh.free, prev: -1}
+	sh.free = i
+}
+
+// sweep expires up to a batch of the buckets idle since before cutoff.
+// With tillFull the buckets not full at now, refilling at lower limits,
+// are moved to the most recently used end, the ones behind are swept
+func (sh *shard) sweep(cutoff, now int64, tillFull bool) {
+	for n := 0; n < shardSweepBatch && sh.head >= 0 && sh.slots[sh.head].last < cutoff; n++ {
+		if i := sh.head; tillFull && sh.slots[i].full > now {
+			sh.unlink(i)
+			sh.touch(i)
+			continue
+		}
+
+		sh.removeHead()
+		sh.expirations++
+	}
+
+	// deleting from a map doesn't shrink it
+	if sh.peak > 1024 && len(sh.index) < sh.peak/4 {
+		index := make(map[Key]int32, len(sh.index))
+		for k, v := range sh.index {
+			index[k] = v
+		}
+		sh.index, sh.peak = index, len(index)
+	}
+}
+
+// get returns the slot of the key, a full bucket for a new key
+func (sh *shard) get(key Key, now int64, burst int, maxKeys int) *slot {
+	if i, ok := sh.index[key]; ok {
+		sh.unlink(i)
+		sh.touch(i)
+		return &sh.slots[i]
+	}
+
+	if maxKeys > 0 && len(sh.index) >= maxKeys {
+		sh.removeHead()
+		sh.evictions++
+	}
+
+	i := sh.free
+	if i >= 0 {
+		sh.free = sh.slots[i].next
+	} else {
+		i = int32(len(sh.slots))
+		sh.slots = append(sh.slots, slot{})
+	}
+
+	sh.slots[i] = slot{key: key, tokens: float64(burst), last: now}
+	sh.touch(i)
+
+	sh.index[key] = i
+	sh.keyBytes += len(key)
+	if len(sh.index) > sh.peak {
+		sh.peak = len(sh.index)
+	}
+
+	return &sh.slots[i]
+}
+
+// refill adds the tokens for the time elapsed since the last access, the
+// limits can change between calls, the tokens left are carried over,
+// capped by the burst. last is ahead of now while Wait has reserved the
+// tokens to come
+func (s *slot) refill(now int64, limit float64, burst int) {
+	if elapsed := now - s.last; elapsed > 0 {
+		s.tokens += time.Duration(elapsed).Seconds() * limit
+		s.last = now
+	}
+
+	s.tokens = math.Min(float64(burst), s.tokens)
+}
+
+func (sl *ShardedLimiter) shard(key Key) *shard {
+	return &sl.shards[maphash.String(sl.seed, string(key))&sl.mask]
+}
+
+func (sl *ShardedLimiter) elapsed() int64 { return int64(sl.now().Sub(sl.start)) }
+
+// take runs fn on the refilled bucket of key
+func (sl *ShardedLimiter) take(key Key, limits Limits, fn func(s *slot, now int64) bool) bool {
+	var (
+		now = sl.elapsed()
+		sh  = sl.shard(key)
+	)
+
+	sh.lock()
+	defer sh.mu.Unlock()
+
+	sh.sweep(now-int64(sl.idle), now, sl.tillFull)
+
+	s := sh.get(key, now, limits.Burst, sl.maxKeys)
+	s.refill(now, limits.Limit, limits.Burst)
+
+	ok := fn(s, now)
+	s.full = s.last + int64((float64(limits.Burst)-s.tokens)/limits.Limit*float64(time.Second))
+
+	return ok
+}
+
+// Allow takes a token from the bucket of the key
+func (sl *ShardedLimiter) Allow(cx context.Context, key Key) (bool, error) {
+	return sl.AllowN(cx, key, 1)
+}
+
+// AllowN takes n tokens at once from the bucket of the key, false if the
+// bucket has less than n. It fails with ErrExceedsBurst for more tokens
+// than the burst, the bucket never has them
+func (sl *ShardedLimiter) AllowN(_ context.Context, key Key, n int) (bool, error) {
+	if n > sl.burst {
+		return false, ErrExceedsBurst
+	}
+
+	return sl.take(key, Limits{sl.limit, sl.burst}, func(s *slot, _ int64) bool {
+		if s.tokens < float64(n) {
+			return false
+		}
+
+		s.tokens -= float64(n)
+		return true
+	}), nil
+}
+
+// AllowWithLimits takes a token from the bucket of the key, refilled as
+// per the limits passed
+func (sl *ShardedLimiter) AllowWithLimits(_ context.Context, key Key, limits Limits) (bool, error) {
+	if err := limits.validate(); err != nil {
+		return false, err
+	}
+
+	return sl.take(key, limits, func(s *slot, _ int64) bool {
+		if s.tokens < 1 {
+			return false
+		}
+
+		s.tokens--
+		return true
+	}), nil
+}
+
+// Wait blocks until the bucket of the key has a token for the call or cx
+// is done. Waiting calls queue up in order, each reserves the next token.
+// It fails right away with ErrWaitDeadline if the token comes after the
+// deadline of cx
+func (sl *ShardedLimiter) Wait(cx context.Context, key Key) error {
+	var (
+		wait time.Duration
+		per  = int64(float64(time.Second) / sl.limit)
+	)
+
+	ok := sl.take(key, Limits{sl.limit, sl.burst}, func(s *slot, now int64) bool {
+		if s.tokens >= 1 {
+			s.tokens--
+			return true
+		}
+
+		// the next token comes once the bucket refills from last
+		at := s.last + int64((1-s.tokens)*float64(per))
+		wait = time.Duration(at - now)
+
+		if deadline, ok := cx.Deadline(); ok && sl.now().Add(wait).After(deadline) {
+			return false
+		}
+
+		// reserved, the bucket refills from then on
+		s.tokens, s.last = 0, at
+		return true
+	})
+
+	switch {
+	case !ok:
+		return ErrWaitDeadline
+	case wait <= 0:
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-cx.Done():
+		// give the reservation back
+		sl.take(key, Limits{sl.limit, sl.burst}, func(s *slot, now int64) bool {
+			if s.last-per >= now {
+				s.last -= per
+			} else {
+				s.tokens = math.Min(float64(sl.burst), s.tokens+1)
+			}
+			return true
+		})
+		return cx.Err()
+	}
+}
+
+// Len returns the number of keys kept, idle keys included until swept
+func (sl *ShardedLimiter) Len() int {
+	n := 0
+	for i := range sl.shards {
+		sh := &sl.shards[i]
+
+		sh.mu.Lock()
+		n += len(sh.index)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// MemoryEstimate returns an estimate of the bytes used by the buckets, the
+// slots, the index & the keys
+func (sl *ShardedLimiter) MemoryEstimate() int64 {
+	var n int64
+	for i := range sl.shards {
+		sh := &sl.shards[i]
+
+		sh.mu.Lock()
+		n += int64(cap(sh.slots)) * int64(unsafe.Sizeof(slot{}))
+		n += int64(sh.peak) * int64(unsafe.Sizeof(Key(""))+unsafe.Sizeof(int32(0))+mapEntryOverhead)
+		n += int64(sh.keyBytes)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// Stats returns the stats of the shards, Contended counts the calls which
+// waited for the lock of the shard
+func (sl *ShardedLimiter) Stats() []ShardStats {
+	stats := make([]ShardStats, len(sl.shards))
+	for i := range sl.shards {
+		sh := &sl.shards[i]
+
+		sh.mu.Lock()
+		stats[i] = ShardStats{
+			Keys:        len(sh.index),
+			Calls:       sh.calls,
+			Contended:   sh.contended,
+			Expirations: sh.expirations,
+			Evictions:   sh.evictions,
+		}
+		sh.mu.Unlock()
+	}
+	return stats
+}
+
+// NewShardedLimiter returns a token bucket Limiter which keeps the buckets
+// in process memory like NewInMemoryLimiter, for a high number of keys,
+// e.g. per user limits at the edge.
+//   - keys are spread over shards locked independently
+//   - buckets are fixed size structs in a slice per shard, the GC has
+//     little to scan besides the keys
+//   - buckets idle till full, or for longer than the expiry, are removed
+//     a few at a time on the calls to the shard, there is no pass over
+//     all the keys
+//   - the number of keys can be bounded, see WithMaxKeys
+//
+// Besides Limiter & LimitsLimiter, AllowN & Wait take tokens in bulk &
+// wait for a token
+func NewShardedLimiter(limit float64, burst int, options ...ShardedLimiterOption) (*ShardedLimiter, error) {
+	if limit <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	if burst <= 0 {
+		return nil, ErrInvalidBurst
+	}
+
+	sl := &ShardedLimiter{
+		limit:  limit,
+		burst:  burst,
+		shards: make([]shard, 1<<bitsFor(4*runtime.GOMAXPROCS(0))),
+		seed:   maphash.MakeSeed(),
+		start:  time.Now(),
+		now:    time.Now,
+	}
+
+	for _, o := range options {
+		o(sl)
+	}
+
+	// the buckets at the limits of the limiter are full once idle for
+	// the time they take to refill, the ones at lower limits later
+	if sl.idle == 0 {
+		sl.idle = time.Duration(math.Ceil(float64(burst) / limit * float64(time.Second)))
+		sl.tillFull = true
+	}
+
+	if sl.maxKeys > 0 {
+		sl.maxKeys = (sl.maxKeys + len(sl.shards) - 1) / len(sl.shards)
+	}
+
+	sl.mask = uint64(len(sl.shards) - 1)
+	for i := range sl.shards {
+		sl.shards[i] = shard{
+			index: make(map[Key]int32),
+			head:  -1, tail: -1, free: -1,
+		}
+	}
+
+	return sl, nil
+}
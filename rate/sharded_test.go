@@ -0,0 +1,271 @@
+package rate
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestShardedLimiter(t testing.TB, now *time.Time, options ...ShardedLimiterOption) *ShardedLimiter {
+	sl, err := NewShardedLimiter(1, 2, options...)
+	if err != nil {
+		t.Fatalf("NewShardedLimiter() error = %v", err)
+	}
+
+	sl.start = *now
+	sl.now = func() time.Time { return *now }
+	return sl
+}
+
+func TestShardedLimiter(t *testing.T) {
+	var (
+		cx  = context.Background()
+		now = time.Unix(0, 0)
+		sl  = newTestShardedLimiter(t, &now)
+	)
+
+	for i, want := range []bool{true, true, false} {
+		if got, _ := sl.Allow(cx, "a"); got != want {
+			t.Errorf("Allow() #%d = %v, want %v", i, got, want)
+		}
+	}
+
+	if got, _ := sl.Allow(cx, "b"); !got {
+		t.Errorf("Allow() on a different key should have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if got, _ := sl.Allow(cx, "a"); !got {
+		t.Errorf("Allow() after refill = false, want true")
+	}
+
+	if got, _ := sl.AllowN(cx, "c", 2); !got {
+		t.Errorf("AllowN(2) = false, want true")
+	}
+
+	if _, err := sl.AllowN(cx, "c", 3); err != ErrExceedsBurst {
+		t.Errorf("AllowN(3) error = %v, want %v", err, ErrExceedsBurst)
+	}
+
+	if _, err := NewShardedLimiter(0, 1); err != ErrInvalidLimit {
+		t.Errorf("NewShardedLimiter() error = %v, want %v", err, ErrInvalidLimit)
+	}
+}
+
+func TestShardedLimiter_expiry(t *testing.T) {
+	var (
+		cx  = context.Background()
+		now = time.Unix(0, 0)
+		sl  = newTestShardedLimiter(t, &now, WithShards(1), WithIdleExpiry(100*time.Millisecond))
+	)
+
+	allowed := func(key Key) int {
+		n := 0
+		for i := 0; i < 3; i++ {
+			if ok, _ := sl.Allow(cx, key); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := allowed("a"); n != 2 {
+		t.Fatalf("allowed = %d, want 2", n)
+	}
+
+	// idle within the window, the bucket is kept & barely refilled
+	now = now.Add(50 * time.Millisecond)
+	if n := allowed("a"); n != 0 {
+		t.Errorf("allowed within the window = %d, want 0", n)
+	}
+
+	// idle past the window, swept on the next call & a full burst again
+	now = now.Add(200 * time.Millisecond)
+	if n := allowed("b"); n != 2 {
+		t.Errorf("allowed on another key = %d, want 2", n)
+	}
+
+	if l := sl.Len(); l != 1 {
+		t.Errorf("Len() after the sweep = %d, want 1", l)
+	}
+
+	if n := allowed("a"); n != 2 {
+		t.Errorf("allowed after expiry = %d, want 2", n)
+	}
+
+	if st := sl.Stats()[0]; st.Expirations != 1 {
+		t.Errorf("Expirations = %d, want 1", st.Expirations)
+	}
+}
+
+func TestShardedLimiter_expiryWithLimits(t *testing.T) {
+	var (
+		cx   = context.Background()
+		now  = time.Unix(0, 0)
+		slow = Limits{Limit: 1, Burst: 10}
+	)
+
+	// idle expiry of 100ms at the limits of the limiter
+	sl, err := NewShardedLimiter(100, 10, WithShards(1))
+	if err != nil {
+		t.Fatalf("NewShardedLimiter() error = %v", err)
+	}
+	sl.start = now
+	sl.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		if ok, _ := sl.AllowWithLimits(cx, "slow", slow); !ok {
+			t.Fatalf("AllowWithLimits() #%d = false, want the burst", i)
+		}
+	}
+
+	// swept by another key, kept as it refills at 1/s
+	now = now.Add(200 * time.Millisecond)
+	_, _ = sl.Allow(cx, "fast")
+
+	if ok, _ := sl.AllowWithLimits(cx, "slow", slow); ok {
+		t.Error("AllowWithLimits() 200ms after the burst = true, want the bucket kept & empty")
+	}
+
+	// full after 10s, same as a new one
+	now = now.Add(11 * time.Second)
+	_, _ = sl.Allow(cx, "fast")
+
+	if l, st := sl.Len(), sl.Stats()[0]; l != 1 || st.Expirations != 2 {
+		t.Errorf("Len() = %d, Expirations = %d, want both buckets swept", l, st.Expirations)
+	}
+}
+
+func TestShardedLimiter_maxKeys(t *testing.T) {
+	var (
+		cx  = context.Background()
+		now = time.Unix(0, 0)
+		sl  = newTestShardedLimiter(t, &now, WithShards(1), WithMaxKeys(2))
+	)
+
+	_, _ = sl.AllowN(cx, "a", 2)
+	now = now.Add(time.Millisecond)
+	_, _ = sl.AllowN(cx, "b", 2)
+	now = now.Add(time.Millisecond)
+
+	// a is touched, b is the oldest idle
+	_, _ = sl.Allow(cx, "a")
+	_, _ = sl.Allow(cx, "c")
+
+	if l := sl.Len(); l != 2 {
+		t.Errorf("Len() = %d, want 2", l)
+	}
+
+	if got, _ := sl.Allow(cx, "a"); got {
+		t.Errorf("Allow() on an exhausted key = true, it shouldn't have been evicted")
+	}
+
+	if got, _ := sl.AllowN(cx, "b", 2); !got {
+		t.Errorf("AllowN() on the evicted key = false, want a full bucket")
+	}
+
+	if st := sl.Stats()[0]; st.Evictions != 2 {
+		t.Errorf("Evictions = %d, want 2", st.Evictions)
+	}
+
+	if sl.MemoryEstimate() <= 0 {
+		t.Errorf("MemoryEstimate() = %d, want positive", sl.MemoryEstimate())
+	}
+}
+
+func TestShardedLimiter_Wait(t *testing.T) {
+	sl, err := NewShardedLimiter(50, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cx := context.Background()
+	if err := sl.Wait(cx, "a"); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	begin := time.Now()
+	if err := sl.Wait(cx, "a"); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if el := time.Since(begin); el < 10*time.Millisecond {
+		t.Errorf("Wait() returned after %v, want ~20ms", el)
+	}
+
+	tcx, cancel := context.WithTimeout(cx, time.Millisecond)
+	defer cancel()
+
+	if err := sl.Wait(tcx, "a"); err != ErrWaitDeadline {
+		t.Errorf("Wait() error = %v, want %v", err, ErrWaitDeadline)
+	}
+}
+
+func TestShardedLimiter_concurrent(t *testing.T) {
+	sl, err := NewShardedLimiter(1000, 10, WithShards(4), WithMaxKeys(64), WithIdleExpiry(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := Key(strconv.Itoa((g*7919 + i) % 500))
+				_, _ = sl.Allow(context.Background(), key)
+				if i%100 == 0 {
+					_ = sl.Len()
+					_ = sl.Stats()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if l := sl.Len(); l > 64 {
+		t.Errorf("Len() = %d, want at most 64", l)
+	}
+}
+
+// 1M keys, 64 goroutines
+func benchmarkLimiter(b *testing.B, l Limiter) {
+	const keys = 1 << 20
+
+	ks := make([]Key, keys)
+	for i := range ks {
+		ks[i] = Key("user:" + strconv.Itoa(i))
+	}
+
+	p := (64 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0)
+	b.SetParallelism(p)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		var (
+			cx = context.Background()
+			i  = rand.Intn(keys)
+		)
+		for pb.Next() {
+			_, _ = l.Allow(cx, ks[i&(keys-1)])
+			i += 7919
+		}
+	})
+}
+
+func BenchmarkLimiter(b *testing.B) {
+	b.Run("inmem", func(b *testing.B) {
+		l, _ := NewInMemoryLimiter(100, 10)
+		benchmarkLimiter(b, l)
+	})
+
+	b.Run("sharded", func(b *testing.B) {
+		l, _ := NewShardedLimiter(100, 10)
+		benchmarkLimiter(b, l)
+	})
+}
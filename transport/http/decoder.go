@@ -26,7 +26,8 @@ func NopRequestDecoder() Decoder {
 
 // NewGoKitDecoderHandlerOption sets a decoder of a type kit_http.DecodeRequestFunc
 func NewGoKitDecoderHandlerOption(fn kit_http.DecodeRequestFunc) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
-		h.decoder = Decoder(fn)
+		h.setDecoder(Decoder(fn), c)
 	}
 }
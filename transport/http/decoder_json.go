@@ -0,0 +1,212 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	net_http "net/http"
+	"strings"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Reasons of a DecodeError
+const (
+	DecodeReasonEmptyBody    = "empty_body"
+	DecodeReasonTooLarge     = "too_large"
+	DecodeReasonSyntax       = "syntax"
+	DecodeReasonType         = "type"
+	DecodeReasonUnknownField = "unknown_field"
+	DecodeReasonTrailingData = "trailing_data"
+	DecodeReasonValidation   = "validation"
+	DecodeReasonRead         = "read"
+)
+
+// ErrEmptyBody is the cause of the DecodeError for requests which need a
+// body (POST, PUT & PATCH) but came without one
+var ErrEmptyBody = errors.New("request body is empty")
+
+type (
+	// DecodeError is returned by the JSON decoder when the body can't be
+	// decoded or fails validation. Field & Offset point to the offending
+	// part of the body, when known.
+	// It encodes itself as 400 Bad Request (413 for oversized bodies) with
+	// a JSON body through go-kit's DefaultErrorEncoder
+	DecodeError struct {
+		Err    error  `json:"-"`
+		Reason string `json:"reason"`
+		Field  string `json:"field,omitempty"`
+		Offset int64  `json:"offset,omitempty"`
+	}
+
+	// JSONDecoderOption customises the JSON decoder
+	JSONDecoderOption func(*jsonDecoder)
+
+	jsonDecoder struct {
+		disallowUnknown bool
+		maxBodySize     int64
+		validator       func(interface{}) error
+	}
+)
+
+func (de *DecodeError) Error() string {
+	msg := "decode request: " + de.Reason
+	if de.Field != "" {
+		msg += " at field " + de.Field
+	}
+	if de.Offset > 0 {
+		msg += fmt.Sprintf(" (offset %d)", de.Offset)
+	}
+	return msg + ": " + de.Err.Error()
+}
+
+func (de *DecodeError) Unwrap() error { return de.Err }
+
+// StatusCode implements kit_http.StatusCoder
+func (de *DecodeError) StatusCode() int {
+	if de.Reason == DecodeReasonTooLarge {
+		return net_http.StatusRequestEntityTooLarge
+	}
+	return net_http.StatusBadRequest
+}
+
+// MarshalJSON implements json.Marshaler, used by the error encoder
+func (de *DecodeError) MarshalJSON() ([]byte, error) {
+	type body DecodeError
+	return json.Marshal(struct {
+		Error string `json:"error"`
+		*body
+	}{de.Err.Error(), (*body)(de)})
+}
+
+// WithDisallowUnknownFields fails decoding of bodies with fields the
+// target type doesn't have
+func WithDisallowUnknownFields() JSONDecoderOption {
+	return func(jd *jsonDecoder) { jd.disallowUnknown = true }
+}
+
+// WithMaxBodySize caps the size of the body in bytes, bigger bodies fail
+// with DecodeReasonTooLarge
+func WithMaxBodySize(n int64) JSONDecoderOption {
+	return func(jd *jsonDecoder) { jd.maxBodySize = n }
+}
+
+// WithValidator validates the decoded value, e.g. with go-playground's
+// validator.Struct. Its error fails the request with DecodeReasonValidation
+func WithValidator(fn func(interface{}) error) JSONDecoderOption {
+	return func(jd *jsonDecoder) { jd.validator = fn }
+}
+
+func needsBody(method string) bool {
+	return method == net_http.MethodPost ||
+		method == net_http.MethodPut ||
+		method == net_http.MethodPatch
+}
+
+// decodeError maps the errors of encoding/json to a DecodeError
+func decodeError(err error) *DecodeError {
+	var (
+		syntaxErr  *json.SyntaxError
+		typeErr    *json.UnmarshalTypeError
+		tooLarge   *net_http.MaxBytesError
+		unknownPfx = "json: unknown field "
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Err: err, Reason: DecodeReasonSyntax, Offset: syntaxErr.Offset}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Err: err, Reason: DecodeReasonSyntax}
+	case errors.As(err, &typeErr):
+		return &DecodeError{
+			Err: err, Reason: DecodeReasonType,
+			Field: typeErr.Field, Offset: typeErr.Offset,
+		}
+	case errors.As(err, &tooLarge):
+		return &DecodeError{Err: err, Reason: DecodeReasonTooLarge}
+	case strings.HasPrefix(err.Error(), unknownPfx):
+		// encoding/json has no type for this one
+		return &DecodeError{
+			Err:    err,
+			Reason: DecodeReasonUnknownField,
+			Field:  strings.Trim(strings.TrimPrefix(err.Error(), unknownPfx), `"`),
+		}
+	default:
+		return &DecodeError{Err: err, Reason: DecodeReasonRead}
+	}
+}
+
+func (jd *jsonDecoder) decode(r *net_http.Request, v interface{}) error {
+	if r.Body == nil || r.Body == net_http.NoBody {
+		return io.EOF
+	}
+
+	body := io.Reader(r.Body)
+	if jd.maxBodySize > 0 {
+		body = net_http.MaxBytesReader(nil, r.Body, jd.maxBodySize)
+	}
+
+	dec := json.NewDecoder(body)
+	if jd.disallowUnknown {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	// a body is a single value, `{} {}` or `{}x` are malformed
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("unexpected data after the JSON value")
+		}
+		return &DecodeError{Err: err, Reason: DecodeReasonTrailingData, Offset: dec.InputOffset()}
+	}
+
+	return nil
+}
+
+// NewJSONDecoder returns a Decoder which decodes the JSON body of the
+// request into a new T and returns the *T, e.g.
+//
+//	tr.Post("/products", fn, http.HandlerWithDecoder(
+//		http.NewJSONDecoder[Product](http.WithDisallowUnknownFields()),
+//	))
+//
+// and the request in fn is a *Product. Failures are *DecodeError, which
+// the default error encoder writes as 400 with a JSON body. An empty body
+// fails with ErrEmptyBody for POST, PUT & PATCH, other methods get the
+// zero T
+func NewJSONDecoder[T any](opts ...JSONDecoderOption) Decoder {
+	jd := &jsonDecoder{}
+	for _, o := range opts {
+		o(jd)
+	}
+
+	return func(_ context.Context, r *net_http.Request) (interface{}, error) {
+		v := new(T)
+
+		err := jd.decode(r, v)
+		switch {
+		case err == io.EOF && needsBody(r.Method):
+			return nil, &DecodeError{Err: ErrEmptyBody, Reason: DecodeReasonEmptyBody}
+		case err == io.EOF:
+			return v, nil
+		case err != nil:
+			var de *DecodeError
+			if errors.As(err, &de) {
+				return nil, de
+			}
+			return nil, decodeError(err)
+		}
+
+		if jd.validator != nil {
+			if err := jd.validator(v); err != nil {
+				return nil, &DecodeError{Err: err, Reason: DecodeReasonValidation}
+			}
+		}
+
+		return v, nil
+	}
+}
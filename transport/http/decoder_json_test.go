@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kit_http "github.com/go-kit/kit/transport/http"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+type decodeTarget struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestNewJSONDecoder(t *testing.T) {
+	errInvalid := errors.New("name is required")
+
+	dec := NewJSONDecoder[decodeTarget](
+		WithDisallowUnknownFields(),
+		WithMaxBodySize(64),
+		WithValidator(func(v interface{}) error {
+			if v.(*decodeTarget).Name == "" {
+				return errInvalid
+			}
+			return nil
+		}),
+	)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		want       *decodeTarget
+		wantReason string
+		wantField  string
+	}{
+		{"valid", "POST", `{"name":"a","count":1}`, &decodeTarget{"a", 1}, "", ""},
+		{"empty body", "POST", ``, nil, DecodeReasonEmptyBody, ""},
+		{"empty body on get", "GET", ``, &decodeTarget{}, "", ""},
+		{"syntax", "POST", `{"name":`, nil, DecodeReasonSyntax, ""},
+		{"bad syntax", "POST", `{"name" "a"}`, nil, DecodeReasonSyntax, ""},
+		{"type", "POST", `{"name":"a","count":"1"}`, nil, DecodeReasonType, "count"},
+		{"unknown field", "POST", `{"name":"a","color":"red"}`, nil, DecodeReasonUnknownField, "color"},
+		{"trailing data", "POST", `{"name":"a"} {}`, nil, DecodeReasonTrailingData, ""},
+		{"too large", "POST", `{"name":"` + strings.Repeat("a", 64) + `"}`, nil, DecodeReasonTooLarge, ""},
+		{"validation", "PUT", `{"count":1}`, nil, DecodeReasonValidation, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+
+			got, err := dec(context.Background(), req)
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("decode error = %v", err)
+				}
+				if *got.(*decodeTarget) != *tt.want {
+					t.Errorf("decode = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("decode error = %v, want *DecodeError", err)
+			}
+			if de.Reason != tt.wantReason || de.Field != tt.wantField {
+				t.Errorf("decode error = %+v, want reason %s & field %q", de, tt.wantReason, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestDecodeErrorEncoding(t *testing.T) {
+	rec := httptest.NewRecorder()
+	kit_http.DefaultErrorEncoder(context.Background(), &DecodeError{
+		Err:    errors.New("json: cannot unmarshal"),
+		Reason: DecodeReasonType,
+		Field:  "count",
+		Offset: 12,
+	}, rec)
+
+	if rec.Code != net_http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, net_http.StatusBadRequest)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q isn't JSON: %v", rec.Body, err)
+	}
+
+	want := map[string]interface{}{
+		"error": "json: cannot unmarshal", "reason": "type", "field": "count", "offset": float64(12),
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("body[%s] = %v, want %v", k, body[k], v)
+		}
+	}
+
+	if !errors.Is(&DecodeError{Err: ErrEmptyBody}, ErrEmptyBody) {
+		t.Errorf("DecodeError should unwrap to its cause")
+	}
+}
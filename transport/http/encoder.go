@@ -23,6 +23,12 @@ type pool interface {
 	Put([]byte)
 }
 
+// responseWriterBinder is implemented by response bodies which need the
+// ResponseWriter, e.g. full-duplex streams from the proxy
+type responseWriterBinder interface {
+	BindResponseWriter(net_http.ResponseWriter)
+}
+
 type flusher interface {
 	io.Writer
 	net_http.Flusher
@@ -187,6 +193,14 @@ func newDefaultEncoder() Encoder {
 			return
 		}
 
+		// full-duplex streams need the writer before the response starts
+		// and flush every write, as the client waits on each response chunk
+		flush := flushInterval(rr)
+		if b, ok := rr.Body.(responseWriterBinder); ok {
+			b.BindResponseWriter(rw)
+			flush = -1
+		}
+
 		copyHeader(rw.Header(), rr.Header)
 
 		switch {
@@ -203,7 +217,7 @@ func newDefaultEncoder() Encoder {
 			rr.Close = true
 		}()
 
-		return copyResponse(bufferPool, rw, rr.Body, flushInterval(rr))
+		return copyResponse(bufferPool, rw, rr.Body, flush)
 	}
 }
 
@@ -215,7 +229,8 @@ func NewDefaultJSONEncoder() Encoder { return Encoder(kit_http.EncodeJSONRespons
 
 // NewGoKitEncoderHandlerOption provides option to encode the request
 func NewGoKitEncoderHandlerOption(fn kit_http.EncodeResponseFunc) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
-		h.encoder = Encoder(fn)
+		h.setEncoder(Encoder(fn), c)
 	}
 }
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"net"
+	net_http "net/http"
+	"syscall"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+type (
+	// EncoderErrorHandler is called when the encoder of a handler fails.
+	// err is an *EncoderError, which tells if the response had started
+	EncoderErrorHandler func(ctx context.Context, err error)
+
+	// EncoderError is the failure of an Encoder. When HeaderWritten is
+	// false the error is still encoded in the response by the ErrorEncoder,
+	// otherwise the response is already on the wire & cut short, the error
+	// can only be logged
+	EncoderError struct {
+		Err           error
+		HeaderWritten bool
+	}
+)
+
+func (e *EncoderError) Error() string {
+	if e.HeaderWritten {
+		return "encoder failed after writing header: " + e.Err.Error()
+	}
+	return "encoder failed: " + e.Err.Error()
+}
+
+func (e *EncoderError) Unwrap() error { return e.Err }
+
+// IsClientDisconnect reports whether err is caused by the client going
+// away, i.e. a broken pipe, a reset connection or the cancelled request
+// context. These are rarely actionable and are better logged at debug
+func IsClientDisconnect(err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, context.Canceled)
+}
+
+// WithEncoderErrorHandler sets the EncoderErrorHandler for all the
+// handlers of the transport, see HandlerWithEncoderErrorHandler
+func WithEncoderErrorHandler(fn EncoderErrorHandler) TransportOption {
+	return func(tr *Transport) {
+		tr.handlerOptions = append(
+			tr.handlerOptions, HandlerWithEncoderErrorHandler(fn),
+		)
+	}
+}
+
+// HandlerWithEncoderErrorHandler calls fn whenever the encoder of the
+// handler returns an error, e.g.
+//
+//	func(cx context.Context, err error) {
+//		if http.IsClientDisconnect(err) {
+//			logger.Debug("client went away", log.Error(err))
+//			return
+//		}
+//		logger.Error("failed to write response", log.Error(err))
+//	}
+//
+// Errors before the header is written go on to the ErrorEncoder as
+// usual. Errors after the header is written stop there, as an error
+// response can't be written anymore
+func HandlerWithEncoderErrorHandler(fn EncoderErrorHandler) HandlerOption {
+	return func(h *handler) { h.encoderErrorHandler = fn }
+}
+
+// headerWrittenFilter wraps the writer so the encoder can tell if the
+// response has started
+func headerWrittenFilter() Filter {
+	return func(next net_http.Handler) net_http.Handler {
+		return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			next.ServeHTTP(NewWrapResponseWriter(w, r.ProtoMajor), r)
+		})
+	}
+}
+
+// guardEncoder reports the errors of enc to fn, it is used along with
+// headerWrittenFilter
+func guardEncoder(enc Encoder, fn EncoderErrorHandler) Encoder {
+	return func(cx context.Context, rw net_http.ResponseWriter, res interface{}) error {
+		err := enc(cx, rw, res)
+		if err == nil {
+			return nil
+		}
+
+		ww, ok := rw.(WrapResponseWriter)
+		written := ok && ww.Status() != 0
+
+		fn(cx, &EncoderError{Err: err, HeaderWritten: written})
+
+		if written {
+			return nil
+		}
+		return err
+	}
+}
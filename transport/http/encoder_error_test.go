@@ -0,0 +1,88 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	net_http "net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+)
+
+func TestHandlerWithEncoderErrorHandler(t *testing.T) {
+	errEncode := errors.New("encode failed")
+
+	tests := []struct {
+		name          string
+		writeHeader   bool
+		wantWritten   bool
+		wantStatus    int
+		wantErrEncode bool
+	}{
+		{"before header", false, false, net_http.StatusTeapot, true},
+		{"after header", true, true, net_http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got         error
+				errEncCalls int
+			)
+
+			h := NewHandler(
+				func(context.Context, interface{}) (interface{}, error) {
+					return &net_http.Response{}, nil
+				},
+				HandlerWithEncoder(func(_ context.Context, rw net_http.ResponseWriter, _ interface{}) error {
+					if tt.writeHeader {
+						rw.WriteHeader(net_http.StatusOK)
+						_, _ = rw.Write([]byte("partial"))
+					}
+					return errEncode
+				}),
+				HandlerWithErrorEncoder(func(_ context.Context, _ error, rw net_http.ResponseWriter) {
+					errEncCalls++
+					rw.WriteHeader(net_http.StatusTeapot)
+				}),
+				HandlerWithEncoderErrorHandler(func(_ context.Context, err error) { got = err }),
+			)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, "/", nil))
+
+			var ee *EncoderError
+			if !errors.As(got, &ee) || !errors.Is(got, errEncode) {
+				t.Fatalf("handler got = %v, want *EncoderError wrapping %v", got, errEncode)
+			}
+
+			if ee.HeaderWritten != tt.wantWritten {
+				t.Errorf("HeaderWritten = %v, want %v", ee.HeaderWritten, tt.wantWritten)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if (errEncCalls > 0) != tt.wantErrEncode {
+				t.Errorf("error encoder calls = %d, want called %v", errEncCalls, tt.wantErrEncode)
+			}
+		})
+	}
+}
+
+func TestIsClientDisconnect(t *testing.T) {
+	for err, want := range map[error]bool{
+		fmt.Errorf("write: %w", syscall.EPIPE):     true,
+		fmt.Errorf("read: %w", syscall.ECONNRESET): true,
+		context.Canceled:                         true,
+		&EncoderError{Err: syscall.EPIPE}:        true,
+		errors.New("json: unsupported type"):     false,
+		&EncoderError{Err: errors.New("encode")}: false,
+	} {
+		if got := IsClientDisconnect(err); got != want {
+			t.Errorf("IsClientDisconnect(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
@@ -23,7 +23,9 @@ func WithErrorEncoder(fn ErrorEncoder) TransportOption {
 // NewErrorEncoderHandlerOptions provides a handler specific
 // error encoder
 func NewErrorEncoderHandlerOptions(fn ErrorEncoder) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
+		h.desc.ErrorEncoder = c
 		h.errorEncoder = fn
 		h.options = append(
 			h.options,
@@ -37,7 +39,9 @@ func NewErrorEncoderHandlerOptions(fn ErrorEncoder) HandlerOption {
 // NewGoKitErrorEncoderHandlerOption provides an option to set
 // error encoder for handler or transport based on Go-Kit's ErrorEncoder
 func NewGoKitErrorEncoderHandlerOption(fn kit_http.ErrorEncoder) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
+		h.desc.ErrorEncoder = c
 		h.errorEncoder = ErrorEncoder(fn)
 	}
 }
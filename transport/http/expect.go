@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+
+	kit_http "github.com/go-kit/kit/transport/http"
+)
+
+// ExpectContinueHandler checks a request on its headers, before the body
+// is read. It must not read the body, a non-nil error rejects the request
+type ExpectContinueHandler func(cx context.Context, r *net_http.Request) error
+
+// HandlerWithExpectContinueHandler runs fn before the body of the request
+// is read, e.g. to check the credentials or the Content-Length of an
+// upload. A request rejected by fn gets the error from the error encoder
+// of the handler, e.g.
+//
+//	http.HandlerWithExpectContinueHandler(func(_ context.Context, r *net_http.Request) error {
+//		if r.ContentLength > maxUpload {
+//			return http.NewHTTPError(net_http.StatusRequestEntityTooLarge, "upload_too_large", "")
+//		}
+//		return nil
+//	})
+//
+// For a client sending `Expect: 100-continue`, net/http answers 100
+// Continue on the first read of the body, a rejected request gets the
+// error instead & the body is never sent. fn runs for every request,
+// with or without the header
+func HandlerWithExpectContinueHandler(fn ExpectContinueHandler) HandlerOption {
+	c := component(fn)
+	return func(h *handler) {
+		h.desc.Filters = append(h.desc.Filters, c)
+		h.expectContinue = append(h.expectContinue, fn)
+	}
+}
+
+// expectContinueFilter runs the handlers before the decoder reads the body
+func expectContinueFilter(fns []ExpectContinueHandler, enc ErrorEncoder) Filter {
+	if enc == nil {
+		enc = ErrorEncoder(kit_http.DefaultErrorEncoder)
+	}
+
+	return func(next net_http.Handler) net_http.Handler {
+		return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			for _, fn := range fns {
+				if err := fn(r.Context(), r); err != nil {
+					enc(r.Context(), err, w)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
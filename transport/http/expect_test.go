@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// readFlag records whether the client sent the body
+type readFlag struct {
+	io.Reader
+	read atomic.Bool
+}
+
+func (rf *readFlag) Read(p []byte) (int, error) {
+	rf.read.Store(true)
+	return rf.Reader.Read(p)
+}
+
+func TestHandlerWithExpectContinueHandler(t *testing.T) {
+	tr, err := NewHTTPTransport("test", WithCustomLogger(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Put("/upload", func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		bt, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		return NewResponse(req, ResponseWithBytes(bt)), nil
+	}, HandlerWithExpectContinueHandler(func(_ context.Context, r *net_http.Request) error {
+		if r.Header.Get("Authorization") == "" {
+			return NewHTTPError(net_http.StatusUnauthorized, "unauthorized", "")
+		}
+		return nil
+	}))
+
+	srv := httptest.NewServer(tr.Handler)
+	defer srv.Close()
+
+	client := &net_http.Client{Transport: &net_http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+
+	tests := []struct {
+		name     string
+		auth     string
+		wantCode int
+		wantRead bool
+	}{
+		{"rejected", "", net_http.StatusUnauthorized, false},
+		{"accepted", "Bearer x", net_http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &readFlag{Reader: strings.NewReader(strings.Repeat("x", 1<<20))}
+
+			req, _ := net_http.NewRequest(net_http.MethodPut, srv.URL+"/upload", body)
+			req.ContentLength = 1 << 20
+			req.Header.Set("Expect", "100-continue")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.wantCode || body.read.Load() != tt.wantRead {
+				t.Errorf("Do() = %d, body sent %v, want %d, %v", res.StatusCode, body.read.Load(), tt.wantCode, tt.wantRead)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+type (
+	// AccessLogOption customises AccessLogFilter
+	AccessLogOption func(*accessLog)
+
+	accessLog struct {
+		logger     log.Logger
+		sampleRate float64
+		maxBytes   int64
+		headers    map[string]bool
+		fields     [][]string
+	}
+
+	// accessLogBody is tee'd to the response writer and keeps up to max
+	// bytes of the response. It gives up on streams & oversized bodies
+	accessLogBody struct {
+		header  http.Header
+		max     int64
+		buf     bytes.Buffer
+		started bool
+		skipped string
+	}
+)
+
+// WithAccessLogBodies enables capture of request & response bodies for
+// sampleRate (0, 1] fraction of the requests. Bodies aren't logged by
+// default
+func WithAccessLogBodies(sampleRate float64) AccessLogOption {
+	return func(al *accessLog) { al.sampleRate = sampleRate }
+}
+
+// WithAccessLogMaxBodyBytes sets the cap on the logged bodies, bigger
+// bodies aren't logged at all. Defaults to 64KiB
+func WithAccessLogMaxBodyBytes(n int64) AccessLogOption {
+	return func(al *accessLog) { al.maxBytes = n }
+}
+
+// WithAccessLogRedactHeaders sets the header names whose values are
+// redacted in the log. Defaults are Authorization, Proxy-Authorization,
+// Cookie & Set-Cookie, this adds to them
+func WithAccessLogRedactHeaders(headers ...string) AccessLogOption {
+	return func(al *accessLog) {
+		for _, h := range headers {
+			al.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// WithAccessLogRedactFields sets the JSON field paths redacted in the
+// logged bodies. Paths are dot separated, e.g. "password" or "card.number",
+// arrays are walked through, so "items.sku" redacts sku of every item
+func WithAccessLogRedactFields(paths ...string) AccessLogOption {
+	return func(al *accessLog) {
+		for _, p := range paths {
+			al.fields = append(al.fields, strings.Split(p, "."))
+		}
+	}
+}
+
+func (b *accessLogBody) Write(p []byte) (int, error) {
+	if b.skipped != "" {
+		return len(p), nil
+	}
+
+	if !b.started {
+		b.started = true
+		if strings.HasPrefix(b.header.Get(HeaderContentType), "text/event-stream") {
+			b.skipped = "stream"
+			return len(p), nil
+		}
+	}
+
+	if int64(b.buf.Len()+len(p)) > b.max {
+		b.skipped = "too_large"
+		b.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (al *accessLog) headerFields(hdr http.Header) map[string]string {
+	mp := make(map[string]string, len(hdr))
+	for k, v := range hdr {
+		if al.headers[k] {
+			mp[k] = redacted
+			continue
+		}
+		mp[k] = strings.Join(v, ",")
+	}
+	return mp
+}
+
+func redactPath(val interface{}, path []string) {
+	switch vv := val.(type) {
+	case []interface{}:
+		for _, v := range vv {
+			redactPath(v, path)
+		}
+	case map[string]interface{}:
+		v, ok := vv[path[0]]
+		if !ok {
+			return
+		}
+
+		if len(path) == 1 {
+			vv[path[0]] = redacted
+			return
+		}
+
+		redactPath(v, path[1:])
+	}
+}
+
+// body returns the body as logged, JSON bodies have the configured fields
+// redacted, other bodies are logged as is
+func (al *accessLog) body(bt []byte) string {
+	if len(al.fields) == 0 {
+		return string(bt)
+	}
+
+	var val interface{}
+	if err := json.Unmarshal(bt, &val); err != nil {
+		return string(bt)
+	}
+
+	for _, p := range al.fields {
+		redactPath(val, p)
+	}
+
+	out, err := json.Marshal(val)
+	if err != nil {
+		return string(bt)
+	}
+	return string(out)
+}
+
+// AccessLogFilter logs a structured line for every request with request &
+// response headers, status, size and latency. Sensitive headers are
+// redacted (see WithAccessLogRedactHeaders).
+//
+// Bodies are opt-in and sampled, see WithAccessLogBodies. The request body
+// is replaced by a re-readable copy so decoders still work. Bodies bigger
+// than the cap and event streams aren't captured, the response is never
+// buffered, it is tee'd (replacing an existing WrapResponseWriter.Tee).
+// JSON fields can be redacted with WithAccessLogRedactFields.
+func AccessLogFilter(logger log.Logger, opts ...AccessLogOption) Filter {
+	al := &accessLog{
+		logger:   logger,
+		maxBytes: defaultCaptureMaxBodyBytes,
+		headers: map[string]bool{
+			HeaderAuthorization:   true,
+			"Proxy-Authorization": true,
+			"Cookie":              true,
+			"Set-Cookie":          true,
+		},
+	}
+
+	for _, o := range opts {
+		o(al)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				start  = time.Now()
+				fields = make([]log.Field, 0, 12)
+				resb   *accessLogBody
+			)
+
+			fields = append(fields,
+				log.String("req.method", r.Method),
+				log.String("req.uri", r.URL.RequestURI()),
+				log.String("req.remote_addr", r.RemoteAddr),
+				log.Reflect("req.headers", al.headerFields(r.Header)),
+			)
+
+			if ip := ClientIPFromContext(r.Context()); ip != "" {
+				fields = append(fields, log.String("req.client_ip", ip))
+			}
+
+			ww, ok := w.(WrapResponseWriter)
+			if !ok {
+				ww = NewWrapResponseWriter(w, r.ProtoMajor)
+			}
+
+			if al.sampleRate > 0 && (al.sampleRate >= 1 || rand.Float64() < al.sampleRate) {
+				switch {
+				case r.ContentLength > al.maxBytes:
+					fields = append(fields, log.String("req.body_skipped", "too_large"))
+				default:
+					body, truncated, err := peekBody(r, al.maxBytes)
+					switch {
+					case err != nil:
+						fields = append(fields, log.String("req.body_skipped", "unreadable"))
+					case truncated:
+						fields = append(fields, log.String("req.body_skipped", "too_large"))
+					case len(body) > 0:
+						fields = append(fields, log.String("req.body", al.body(body)))
+					}
+				}
+
+				resb = &accessLogBody{header: ww.Header(), max: al.maxBytes}
+				ww.Tee(resb)
+			}
+
+			next.ServeHTTP(ww, r)
+
+			fields = append(fields,
+				log.Int("status", ww.Status()),
+				log.Int("res.size", ww.BytesWritten()),
+				log.Reflect("res.headers", al.headerFields(ww.Header())),
+			)
+
+			if TimedOutFromContext(r.Context()) {
+				fields = append(fields, log.Bool("timed_out", true))
+			}
+
+			if resb != nil {
+				switch {
+				case resb.skipped != "":
+					fields = append(fields, log.String("res.body_skipped", resb.skipped))
+				case resb.buf.Len() > 0:
+					fields = append(fields, log.String("res.body", al.body(resb.buf.Bytes())))
+				}
+			}
+
+			end := time.Since(start)
+			fields = append(fields,
+				log.String("latencys", end.String()),
+				log.Int64("latency", end.Milliseconds()),
+			)
+
+			al.logger.Info(r.URL.RequestURI(), fields...)
+		})
+	}
+}
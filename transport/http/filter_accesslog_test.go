@@ -0,0 +1,120 @@
+package http
+
+import (
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+type recordLogger struct {
+	log.Logger
+	fields map[string]interface{}
+}
+
+func (rl *recordLogger) Info(_ string, fields ...log.Field) {
+	rl.fields = make(map[string]interface{})
+	for _, f := range fields {
+		switch f.Type {
+		case log.STRING:
+			rl.fields[f.Key] = f.String
+		case log.INT, log.INT64:
+			rl.fields[f.Key] = int(f.Integer)
+		case log.DURATION:
+			rl.fields[f.Key] = time.Duration(f.Integer)
+		default:
+			rl.fields[f.Key] = f.Value
+		}
+	}
+}
+
+func TestAccessLogFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []AccessLogOption
+		contentType string
+		reqBody     string
+		resBody     string
+		want        map[string]interface{}
+		absent      []string
+	}{
+		{
+			name:    "no bodies by default",
+			reqBody: `{"user":"a"}`,
+			resBody: `{"ok":true}`,
+			want:    map[string]interface{}{"status": 200, "res.size": 11},
+			absent:  []string{"req.body", "res.body"},
+		},
+		{
+			name:    "redacted json fields",
+			opts:    []AccessLogOption{WithAccessLogBodies(1), WithAccessLogRedactFields("password", "card.number", "items.sku")},
+			reqBody: `{"password":"p","card":{"number":"4111","exp":"12/30"},"items":[{"sku":"a"},{"sku":"b"}]}`,
+			resBody: `{"ok":true}`,
+			want: map[string]interface{}{
+				"req.body": `{"card":{"exp":"12/30","number":"[REDACTED]"},"items":[{"sku":"[REDACTED]"},{"sku":"[REDACTED]"}],"password":"[REDACTED]"}`,
+				"res.body": `{"ok":true}`,
+			},
+		},
+		{
+			name:    "bodies over the cap",
+			opts:    []AccessLogOption{WithAccessLogBodies(1), WithAccessLogMaxBodyBytes(4)},
+			reqBody: "abcdefgh",
+			resBody: "abcdefgh",
+			want:    map[string]interface{}{"req.body_skipped": "too_large", "res.body_skipped": "too_large"},
+			absent:  []string{"req.body", "res.body"},
+		},
+		{
+			name:        "event stream",
+			opts:        []AccessLogOption{WithAccessLogBodies(1)},
+			contentType: "text/event-stream",
+			resBody:     "data: x\n\n",
+			want:        map[string]interface{}{"res.body_skipped": "stream"},
+			absent:      []string{"res.body"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &recordLogger{Logger: log.NewNoopLogger()}
+
+			handler := AccessLogFilter(logger, tt.opts...)(net_http.HandlerFunc(
+				func(w net_http.ResponseWriter, r *net_http.Request) {
+					body, _ := io.ReadAll(r.Body)
+					if string(body) != tt.reqBody {
+						t.Errorf("handler body = %q, want %q", body, tt.reqBody)
+					}
+
+					if tt.contentType != "" {
+						w.Header().Set(HeaderContentType, tt.contentType)
+					}
+					_, _ = w.Write([]byte(tt.resBody))
+				},
+			))
+
+			req := httptest.NewRequest(net_http.MethodPost, "/x", strings.NewReader(tt.reqBody))
+			req.Header.Set(HeaderAuthorization, "Bearer secret")
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			for k, v := range tt.want {
+				if logger.fields[k] != v {
+					t.Errorf("field %s = %v, want %v", k, logger.fields[k], v)
+				}
+			}
+
+			for _, k := range tt.absent {
+				if _, ok := logger.fields[k]; ok {
+					t.Errorf("field %s = %v, want absent", k, logger.fields[k])
+				}
+			}
+
+			hdrs, _ := logger.fields["req.headers"].(map[string]string)
+			if hdrs[HeaderAuthorization] != redacted {
+				t.Errorf("Authorization header = %q, want redacted", hdrs[HeaderAuthorization])
+			}
+		})
+	}
+}
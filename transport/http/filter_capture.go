@@ -0,0 +1,220 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const (
+	defaultCaptureMaxBodyBytes = 64 * 1024
+
+	redacted = "[REDACTED]"
+)
+
+type (
+	// CapturedRequest is the request captured by CaptureOnErrorFilter,
+	// it has enough details to replay the request
+	CapturedRequest struct {
+		Time      time.Time   `json:"time"`
+		Method    string      `json:"method"`
+		URL       string      `json:"url"`
+		Proto     string      `json:"proto"`
+		Host      string      `json:"host"`
+		Header    http.Header `json:"header"`
+		Body      []byte      `json:"body"`
+		Truncated bool        `json:"truncated"`
+		Status    int         `json:"status"`
+	}
+
+	// CaptureSink persists the captured requests
+	CaptureSink interface {
+		Capture(cx context.Context, cr *CapturedRequest) error
+	}
+
+	// CaptureSinkFunc is a func adapter for CaptureSink
+	CaptureSinkFunc func(cx context.Context, cr *CapturedRequest) error
+
+	// CaptureOption customises CaptureOnErrorFilter
+	CaptureOption func(*captureFilter)
+
+	captureFilter struct {
+		sink       CaptureSink
+		sampleRate float64
+		maxBytes   int64
+		headers    []string
+		redactFn   func(*CapturedRequest)
+		errFn      func(error)
+	}
+)
+
+// Capture calls fn
+func (fn CaptureSinkFunc) Capture(cx context.Context, cr *CapturedRequest) error {
+	return fn(cx, cr)
+}
+
+// WithCaptureMaxBodyBytes sets the cap on the captured body, bigger bodies
+// are truncated and marked as such. The handler still gets the full body.
+// Defaults to 64KiB
+func WithCaptureMaxBodyBytes(n int64) CaptureOption {
+	return func(cf *captureFilter) { cf.maxBytes = n }
+}
+
+// WithCaptureRedactHeaders sets the request headers whose values are
+// redacted before the request is sent to the sink. Defaults are
+// Authorization, Proxy-Authorization & Cookie, this adds to them
+func WithCaptureRedactHeaders(headers ...string) CaptureOption {
+	return func(cf *captureFilter) { cf.headers = append(cf.headers, headers...) }
+}
+
+// WithCaptureRedactFunc sets a custom redaction applied after header
+// redaction, e.g. to scrub fields from the body or the query
+func WithCaptureRedactFunc(fn func(*CapturedRequest)) CaptureOption {
+	return func(cf *captureFilter) { cf.redactFn = fn }
+}
+
+// WithCaptureErrorHandler sets the handler for errors returned by the sink,
+// errors are ignored by default
+func WithCaptureErrorHandler(fn func(error)) CaptureOption {
+	return func(cf *captureFilter) { cf.errFn = fn }
+}
+
+// peekBody reads up to maxBytes of body and restores r.Body so the handler
+// sees the complete body
+func peekBody(r *http.Request, maxBytes int64) ([]byte, bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+
+	if int64(len(buf)) > maxBytes {
+		return buf[:maxBytes], true, nil
+	}
+
+	return buf, false, nil
+}
+
+func (cf *captureFilter) redact(cr *CapturedRequest) {
+	for _, h := range cf.headers {
+		if cr.Header.Get(h) != "" {
+			cr.Header.Set(h, redacted)
+		}
+	}
+
+	if cf.redactFn != nil {
+		cf.redactFn(cr)
+	}
+}
+
+// CaptureOnErrorFilter captures the requests which result in a 5xx response
+// and writes them to the sink, to reproduce hard to catch failures.
+// sampleRate (0, 1] is the fraction of requests considered for capture,
+// only those requests have their body buffered. Captured bodies are capped
+// (see WithCaptureMaxBodyBytes) and sensitive headers are redacted.
+func CaptureOnErrorFilter(
+	sink CaptureSink,
+	sampleRate float64,
+	options ...CaptureOption,
+) Filter {
+	cf := &captureFilter{
+		sink:       sink,
+		sampleRate: sampleRate,
+		maxBytes:   defaultCaptureMaxBodyBytes,
+		headers: []string{
+			HeaderAuthorization, "Proxy-Authorization", "Cookie",
+		},
+	}
+
+	for _, o := range options {
+		o(cf)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cf.sampleRate <= 0 || (cf.sampleRate < 1 && rand.Float64() >= cf.sampleRate) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cr := &CapturedRequest{
+				Time:   time.Now(),
+				Method: r.Method,
+				URL:    r.URL.String(),
+				Proto:  r.Proto,
+				Host:   r.Host,
+				Header: r.Header.Clone(),
+			}
+
+			body, truncated, err := peekBody(r, cf.maxBytes)
+			if err != nil {
+				// the body is broken, the handler will fail on it too,
+				// we don't have anything worth capturing
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cr.Body, cr.Truncated = body, truncated
+
+			ww, ok := w.(WrapResponseWriter)
+			if !ok {
+				ww = NewWrapResponseWriter(w, r.ProtoMajor)
+			}
+
+			next.ServeHTTP(ww, r)
+
+			if ww.Status() < http.StatusInternalServerError {
+				return
+			}
+
+			cr.Status = ww.Status()
+			cf.redact(cr)
+
+			if err := cf.sink.Capture(r.Context(), cr); err != nil && cf.errFn != nil {
+				cf.errFn(err)
+			}
+		})
+	}
+}
+
+// NewDirCaptureSink returns a sink which writes every captured request
+// as a JSON file in dir
+func NewDirCaptureSink(dir string) (CaptureSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create capture directory")
+	}
+
+	return CaptureSinkFunc(func(_ context.Context, cr *CapturedRequest) error {
+		bt, err := json.MarshalIndent(cr, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal captured request")
+		}
+
+		name := strconv.FormatInt(cr.Time.UnixNano(), 10)
+		if id := cr.Header.Get(HeaderRequestID); id != "" {
+			name = name + "-" + filepath.Base(id)
+		}
+
+		return errors.Wrap(
+			os.WriteFile(filepath.Join(dir, name+".json"), bt, 0o644),
+			"failed to write captured request",
+		)
+	}), nil
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCaptureOnErrorFilter(t *testing.T) {
+	var captured []*CapturedRequest
+
+	sink := CaptureSinkFunc(func(_ context.Context, cr *CapturedRequest) error {
+		captured = append(captured, cr)
+		return nil
+	})
+
+	filter := CaptureOnErrorFilter(sink, 1, WithCaptureMaxBodyBytes(4))
+
+	for _, status := range []int{net_http.StatusOK, net_http.StatusBadGateway} {
+		status := status
+		handler := filter(net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != "abcdefgh" {
+				t.Errorf("handler body = %q, want full body", body)
+			}
+			w.WriteHeader(status)
+		}))
+
+		req := httptest.NewRequest(net_http.MethodPost, "/x?y=1", strings.NewReader("abcdefgh"))
+		req.Header.Set(HeaderAuthorization, "Bearer secret")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(captured) != 1 {
+		t.Fatalf("captured = %d, want only the 5xx request", len(captured))
+	}
+
+	cr := captured[0]
+	if cr.Status != net_http.StatusBadGateway || cr.URL != "/x?y=1" || cr.Method != net_http.MethodPost {
+		t.Errorf("captured = %+v", cr)
+	}
+
+	if string(cr.Body) != "abcd" || !cr.Truncated {
+		t.Errorf("captured body = %q, truncated = %v", cr.Body, cr.Truncated)
+	}
+
+	if cr.Header.Get(HeaderAuthorization) != redacted {
+		t.Errorf("captured Authorization header not redacted")
+	}
+}
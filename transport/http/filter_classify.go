@@ -0,0 +1,328 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/rate"
+)
+
+// Request Classes
+const (
+	ClassUnknown    Class = ""
+	ClassHuman      Class = "human"
+	ClassBot        Class = "bot"
+	ClassScript     Class = "script"
+	ClassDatacenter Class = "datacenter"
+)
+
+var (
+	defaultBotAgents = []string{
+		"googlebot", "bingbot", "slurp", "duckduckbot", "baiduspider",
+		"yandexbot", "facebookexternalhit", "twitterbot", "applebot",
+		"ahrefsbot", "semrushbot", "mj12bot", "petalbot", "bytespider",
+		"gptbot", "crawler", "spider", `bot\b`,
+	}
+
+	defaultScriptAgents = []string{
+		"curl", "wget", "python-requests", "python-urllib", "aiohttp",
+		"go-http-client", "java/", "okhttp", "libwww-perl", "apache-httpclient",
+		"axios", "node-fetch", "postmanruntime", "httpie",
+	}
+)
+
+type (
+	// Class is the class of the client making the request, it is an open
+	// type, classifiers can return classes beyond the predefined ones
+	Class string
+
+	// Classifier assigns a class to the request, it is called for every
+	// request and must be cheap
+	Classifier func(*http.Request) Class
+
+	// ClassPolicy defines how requests of a class are handled
+	ClassPolicy struct {
+		// Reject responds with RejectStatus (403 if unset) & RejectBody,
+		// without calling the handler
+		Reject       bool
+		RejectStatus int
+		RejectBody   string
+
+		// UseVariant routes the request to the variant of the route for
+		// the class, if the route has one (see HandlerWithClassVariant)
+		UseVariant bool
+
+		// RateLimitKeyPrefix is prepended to the rate limit keys by
+		// KeyWithClass, giving the class its own key space
+		RateLimitKeyPrefix string
+
+		// Headers are set on the response
+		Headers []KeyValue
+	}
+
+	// ClassifierOption customises the default classifier
+	ClassifierOption func(*classifier) error
+
+	classifier struct {
+		bots    *regexp.Regexp
+		scripts *regexp.Regexp
+		ranges  []*net.IPNet
+
+		overrideHeader  string
+		overrideTrusted func(*http.Request) bool
+	}
+
+	// requestClass is kept in context as pointer, so the class is visible
+	// to the filters wrapping the classification filter, e.g. metrics
+	requestClass struct {
+		class  Class
+		policy ClassPolicy
+	}
+)
+
+func agentMatcher(agents []string) (*regexp.Regexp, error) {
+	if len(agents) == 0 {
+		return nil, nil
+	}
+
+	return regexp.Compile(`(?i)(` + strings.Join(agents, "|") + `)`)
+}
+
+// WithBotAgents replaces the patterns (regular expressions, matched case
+// insensitive) of User-Agents classified as ClassBot
+func WithBotAgents(agents ...string) ClassifierOption {
+	return func(c *classifier) (err error) {
+		c.bots, err = agentMatcher(agents)
+		return errors.Wrap(err, "invalid bot agents")
+	}
+}
+
+// WithScriptAgents replaces the patterns (regular expressions, matched
+// case insensitive) of User-Agents classified as ClassScript
+func WithScriptAgents(agents ...string) ClassifierOption {
+	return func(c *classifier) (err error) {
+		c.scripts, err = agentMatcher(agents)
+		return errors.Wrap(err, "invalid script agents")
+	}
+}
+
+// WithDatacenterRanges adds the CIDRs whose clients are classified as
+// ClassDatacenter
+func WithDatacenterRanges(cidrs ...string) ClassifierOption {
+	return func(c *classifier) error {
+		for _, cidr := range cidrs {
+			_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return errors.Wrapf(err, "invalid datacenter range: %q", cidr)
+			}
+			c.ranges = append(c.ranges, n)
+		}
+		return nil
+	}
+}
+
+// WithDatacenterRangesFrom reads datacenter CIDRs from the reader, one per
+// line. Empty lines & lines starting with `#` are ignored
+func WithDatacenterRangesFrom(r io.Reader) ClassifierOption {
+	return func(c *classifier) error {
+		var (
+			cidrs []string
+			sc    = bufio.NewScanner(r)
+		)
+
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			cidrs = append(cidrs, line)
+		}
+
+		if err := sc.Err(); err != nil {
+			return errors.Wrap(err, "failed to read datacenter ranges")
+		}
+
+		return WithDatacenterRanges(cidrs...)(c)
+	}
+}
+
+// WithClassOverrideHeader lets the value of the header decide the class,
+// for testing. The header is only honoured if trusted returns true for the
+// request, e.g. for requests from the internal network
+func WithClassOverrideHeader(header string, trusted func(*http.Request) bool) ClassifierOption {
+	return func(c *classifier) error {
+		c.overrideHeader = header
+		c.overrideTrusted = trusted
+		return nil
+	}
+}
+
+func clientIP(r *http.Request) net.IP {
+	return net.ParseIP(string(KeyByClientIP()(r)))
+}
+
+func (c *classifier) classify(r *http.Request) Class {
+	if c.overrideHeader != "" {
+		if cl := r.Header.Get(c.overrideHeader); cl != "" && c.overrideTrusted(r) {
+			return Class(cl)
+		}
+	}
+
+	ua := r.Header.Get(HeaderUserAgent)
+
+	switch {
+	case c.bots != nil && c.bots.MatchString(ua):
+		return ClassBot
+	case ua == "" || (c.scripts != nil && c.scripts.MatchString(ua)):
+		return ClassScript
+	}
+
+	if len(c.ranges) > 0 {
+		if ip := clientIP(r); ip != nil {
+			for _, n := range c.ranges {
+				if n.Contains(ip) {
+					return ClassDatacenter
+				}
+			}
+		}
+	}
+
+	// browsers always send Accept
+	if r.Header.Get(HeaderAccept) == "" {
+		return ClassScript
+	}
+
+	return ClassHuman
+}
+
+// NewDefaultClassifier returns a classifier which, in order of precedence,
+// honours the trusted override header, classifies known crawler
+// User-Agents as ClassBot, scripted clients & requests without User-Agent
+// as ClassScript, clients from datacenter ranges as ClassDatacenter,
+// requests without Accept header as ClassScript and the rest as
+// ClassHuman. Matchers are compiled once.
+func NewDefaultClassifier(options ...ClassifierOption) (Classifier, error) {
+	var (
+		c   = &classifier{}
+		err error
+	)
+
+	if c.bots, err = agentMatcher(defaultBotAgents); err != nil {
+		return nil, err
+	}
+
+	if c.scripts, err = agentMatcher(defaultScriptAgents); err != nil {
+		return nil, err
+	}
+
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.classify, nil
+}
+
+// ClassFromContext returns the class assigned to the request by
+// ClassifyRequestsFilter, services can use it to skip expensive work,
+// e.g. personalization for bots
+func ClassFromContext(cx context.Context) Class {
+	rc, ok := cx.Value(ContextKeyRequestClass).(*requestClass)
+	if !ok {
+		return ClassUnknown
+	}
+	return rc.class
+}
+
+func classPolicyFromContext(cx context.Context) (ClassPolicy, bool) {
+	rc, ok := cx.Value(ContextKeyRequestClass).(*requestClass)
+	if !ok || rc.class == ClassUnknown {
+		return ClassPolicy{}, false
+	}
+	return rc.policy, true
+}
+
+// KeyWithClass prefixes the key with RateLimitKeyPrefix of the class
+// policy, so a class can be given a stricter key space, e.g. with a
+// rate.LimitProvider resolving `bot:*` to a lower limit
+func KeyWithClass(keyFn RateLimitKeyFunc) RateLimitKeyFunc {
+	return func(r *http.Request) rate.Key {
+		key := keyFn(r)
+
+		if cp, ok := classPolicyFromContext(r.Context()); ok && cp.RateLimitKeyPrefix != "" {
+			return rate.Key(cp.RateLimitKeyPrefix) + key
+		}
+
+		return key
+	}
+}
+
+// ClassifyRequestsFilter classifies every request and applies the policy
+// of its class. The class is available with ClassFromContext, and is
+// added as `class` tag to CustomMetricsFilter and as `req.class` to the
+// trace log. Classes without a policy are only classified.
+func ClassifyRequestsFilter(classifier Classifier, policies map[Class]ClassPolicy) Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc, ok := r.Context().Value(ContextKeyRequestClass).(*requestClass)
+			if !ok {
+				rc = &requestClass{}
+				r = r.WithContext(context.WithValue(r.Context(), ContextKeyRequestClass, rc))
+			}
+
+			rc.class = classifier(r)
+			rc.policy = policies[rc.class]
+
+			for _, kv := range rc.policy.Headers {
+				w.Header().Set(kv.Key, kv.Value)
+			}
+
+			if rc.policy.Reject {
+				status := rc.policy.RejectStatus
+				if status == 0 {
+					status = http.StatusForbidden
+				}
+
+				w.Header().Set(HeaderContentType, "text/plain; charset=utf-8")
+				w.WriteHeader(status)
+				_, _ = io.WriteString(w, rc.policy.RejectBody)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HandlerWithClassVariant serves requests of the class with the variant,
+// a cheaper version of the route, if the class policy has UseVariant set
+func HandlerWithClassVariant(class Class, variant http.Handler) HandlerOption {
+	return func(h *handler) {
+		if h.variants == nil {
+			h.variants = make(map[Class]http.Handler)
+		}
+		h.variants[class] = variant
+	}
+}
+
+func classVariantFilter(variants map[Class]http.Handler) Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cp, ok := classPolicyFromContext(r.Context()); ok && cp.UseVariant {
+				if v, ok := variants[ClassFromContext(r.Context())]; ok {
+					v.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kit_metrics "github.com/go-kit/kit/metrics"
+	"github.com/unbxd/go-base/v2/metrics"
+)
+
+type labelRecorder struct {
+	labels *[][]string
+}
+
+func (lr labelRecorder) With(lvs ...string) kit_metrics.Histogram {
+	*lr.labels = append(*lr.labels, lvs)
+	return lr
+}
+
+func (lr labelRecorder) Observe(float64) {}
+
+type histogramProvider struct {
+	metrics.Provider
+	labels [][]string
+}
+
+func (hp *histogramProvider) NewHistogram(string, float64) metrics.Histogram {
+	return labelRecorder{&hp.labels}
+}
+
+func newClassifyRequest(ua, accept, xff string) *net_http.Request {
+	r := httptest.NewRequest(net_http.MethodGet, "/x", nil)
+	if ua != "" {
+		r.Header.Set(HeaderUserAgent, ua)
+	}
+	if accept != "" {
+		r.Header.Set(HeaderAccept, accept)
+	}
+	if xff != "" {
+		r.Header.Set(HeaderXForwardedFor, xff)
+	}
+	return r
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	const browser = "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0"
+
+	classify, err := NewDefaultClassifier(
+		WithDatacenterRangesFrom(strings.NewReader("# aws\n3.0.0.0/9\n\n")),
+		WithClassOverrideHeader("X-Test-Class", func(r *net_http.Request) bool {
+			return r.Header.Get("X-Internal") == "1"
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewDefaultClassifier() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  *net_http.Request
+		want Class
+	}{
+		{"browser", newClassifyRequest(browser, "text/html", ""), ClassHuman},
+		{"crawler", newClassifyRequest("Mozilla/5.0 (compatible; Googlebot/2.1)", "*/*", ""), ClassBot},
+		{"curl", newClassifyRequest("curl/8.0", "*/*", ""), ClassScript},
+		{"no user agent", newClassifyRequest("", "*/*", ""), ClassScript},
+		{"no accept", newClassifyRequest(browser, "", ""), ClassScript},
+		{"datacenter", newClassifyRequest(browser, "text/html", "3.1.2.3"), ClassDatacenter},
+		{"bot beats datacenter", newClassifyRequest("bingbot/2.0", "*/*", "3.1.2.3"), ClassBot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.req); got != tt.want {
+				t.Errorf("classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("override", func(t *testing.T) {
+		r := newClassifyRequest("curl/8.0", "", "")
+		r.Header.Set("X-Test-Class", "partner")
+
+		if got := classify(r); got != ClassScript {
+			t.Errorf("untrusted override = %q, want %q", got, ClassScript)
+		}
+
+		r.Header.Set("X-Internal", "1")
+		if got := classify(r); got != "partner" {
+			t.Errorf("trusted override = %q, want partner", got)
+		}
+	})
+}
+
+func TestClassifyRequestsFilter(t *testing.T) {
+	var (
+		seen     Class
+		provider = &histogramProvider{Provider: metrics.NewNoopMetrics()}
+		fixed    = func(c Class) Classifier { return func(*net_http.Request) Class { return c } }
+
+		ok Handler = func(cx context.Context, _ interface{}) (interface{}, error) {
+			seen = ClassFromContext(cx)
+			return NewResponse(nil, ResponseWithBytes([]byte("full"))), nil
+		}
+		cheap = net_http.HandlerFunc(func(w net_http.ResponseWriter, _ *net_http.Request) {
+			_, _ = w.Write([]byte("cheap"))
+		})
+
+		policies = map[Class]ClassPolicy{
+			ClassBot:    {UseVariant: true, Headers: []KeyValue{{"X-Robots-Tag", "noindex"}}},
+			ClassScript: {Reject: true, RejectBody: "User-agent: *\nDisallow: /\n"},
+			"partner":   {RateLimitKeyPrefix: "partner:"},
+		}
+
+		route = NewHandler(ok, HandlerWithClassVariant(ClassBot, cheap))
+	)
+
+	serve := func(c Class) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		chain(route,
+			decorateContextFilter(),
+			CustomMetricsFilter("test", provider, nil),
+			ClassifyRequestsFilter(fixed(c), policies),
+		).ServeHTTP(rw, newClassifyRequest("ua", "*/*", ""))
+		return rw
+	}
+
+	if rw := serve(ClassHuman); rw.Body.String() != "full" || seen != ClassHuman {
+		t.Errorf("human = %q, class in context = %q", rw.Body.String(), seen)
+	}
+
+	rw := serve(ClassBot)
+	if rw.Body.String() != "cheap" || rw.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("bot = %q, headers = %v", rw.Body.String(), rw.Header())
+	}
+
+	rw = serve(ClassScript)
+	if rw.Code != net_http.StatusForbidden || !strings.HasPrefix(rw.Body.String(), "User-agent") {
+		t.Errorf("script = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	wantTags := []string{"human", "bot", "script"}
+	if len(provider.labels) != len(wantTags) {
+		t.Fatalf("metric observations = %d, want %d", len(provider.labels), len(wantTags))
+	}
+
+	for i, lvs := range provider.labels {
+		if !strings.Contains(strings.Join(lvs, ","), "class,"+wantTags[i]) {
+			t.Errorf("metric tags = %v, want class %s", lvs, wantTags[i])
+		}
+	}
+
+	t.Run("rate limit key space", func(t *testing.T) {
+		var key string
+		keyFn := KeyWithClass(KeyByHeader("X-Api-Key"))
+
+		ClassifyRequestsFilter(fixed("partner"), policies)(
+			net_http.HandlerFunc(func(_ net_http.ResponseWriter, r *net_http.Request) {
+				key = string(keyFn(r))
+			}),
+		).ServeHTTP(httptest.NewRecorder(), func() *net_http.Request {
+			r := newClassifyRequest("ua", "*/*", "")
+			r.Header.Set("X-Api-Key", "k1")
+			return r
+		}())
+
+		if key != "partner:k1" {
+			t.Errorf("key = %q, want partner:k1", key)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Headers naming the client of the request, see WithClientIPHeaders
+const (
+	HeaderForwarded = "Forwarded"
+	HeaderXRealIP   = "X-Real-IP"
+)
+
+// ErrInvalidTrustedProxy is returned by WithTrustedProxies for an entry
+// which is neither an IP nor a CIDR
+var ErrInvalidTrustedProxy = errors.New("trusted proxy must be an IP or a CIDR")
+
+type (
+	// ClientIPOption customises the ClientIPResolver
+	ClientIPOption func(*ClientIPResolver) error
+
+	// ClientIPResolver resolves the IP of the client of a request. The
+	// headers set by proxies are only believed when the request came
+	// through trusted proxies, see Resolve
+	ClientIPResolver struct {
+		trusted []netip.Prefix
+		headers []string
+	}
+)
+
+// WithTrustedProxies trusts the proxies in the IPs or CIDRs, e.g.
+// `10.0.0.0/8` or `192.168.1.10`
+func WithTrustedProxies(proxies ...string) ClientIPOption {
+	return func(cr *ClientIPResolver) error {
+		for _, p := range proxies {
+			p = strings.TrimSpace(p)
+
+			if !strings.Contains(p, "/") {
+				addr, err := netip.ParseAddr(p)
+				if err != nil {
+					return errors.Wrapf(ErrInvalidTrustedProxy, "%q", p)
+				}
+
+				addr = addr.Unmap().WithZone("")
+				cr.trusted = append(cr.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				return errors.Wrapf(ErrInvalidTrustedProxy, "%q", p)
+			}
+			cr.trusted = append(cr.trusted, prefix.Masked())
+		}
+		return nil
+	}
+}
+
+// WithTrustedPrivateProxies trusts the proxies in loopback, private &
+// link-local networks, i.e. within the infrastructure
+func WithTrustedPrivateProxies() ClientIPOption {
+	return WithTrustedProxies(
+		"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16",
+		"::1/128", "fc00::/7", "fe80::/10",
+	)
+}
+
+// WithClientIPHeaders sets the headers naming the client, the first one
+// the request has is used. Defaults to Forwarded, X-Forwarded-For &
+// X-Real-IP
+func WithClientIPHeaders(headers ...string) ClientIPOption {
+	return func(cr *ClientIPResolver) error {
+		cr.headers = headers
+		return nil
+	}
+}
+
+// NewClientIPResolver returns a ClientIPResolver, which trusts no proxy
+// unless told with WithTrustedProxies
+func NewClientIPResolver(options ...ClientIPOption) (*ClientIPResolver, error) {
+	cr := &ClientIPResolver{
+		headers: []string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP},
+	}
+
+	for _, o := range options {
+		if err := o(cr); err != nil {
+			return nil, err
+		}
+	}
+
+	return cr, nil
+}
+
+// parseIP parses an address of RemoteAddr or of the headers, with or
+// without port, brackets, quotes or zone
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+func (cr *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range cr.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the `for` of the elements of Forwarded headers
+func forwardedFor(values []string) []string {
+	var hops []string
+
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			hop := ""
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hop = v
+				}
+			}
+			// an element without `for` is a hop we know nothing about
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// hops returns the addresses in the header, the client first
+func hops(name string, values []string) []string {
+	if strings.EqualFold(name, HeaderForwarded) {
+		return forwardedFor(values)
+	}
+
+	var hops []string
+	for _, v := range values {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	return hops
+}
+
+// Resolve returns the IP of the client of r. The remote address is the
+// client unless it is a trusted proxy, the header is then walked from the
+// proxy closest to this server back to the client, the first address
+// which isn't a trusted proxy is the client. Headers with entries which
+// aren't IPs, e.g. `unknown`, resolve to the remote address, so does a
+// request without headers. The IP has neither port nor zone
+func (cr *ClientIPResolver) Resolve(r *http.Request) string {
+	remote, ok := parseIP(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+
+	if !cr.isTrusted(remote) {
+		return remote.String()
+	}
+
+	for _, name := range cr.headers {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		hops := hops(name, values)
+
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseIP(hops[i])
+			if !ok {
+				return remote.String()
+			}
+
+			if i == 0 || !cr.isTrusted(addr) {
+				return addr.String()
+			}
+		}
+	}
+
+	return remote.String()
+}
+
+// ClientIPFilter resolves the IP of the client with the resolver, it is
+// available with ClientIPFromContext & replaces the first address of
+// X-Forwarded-For in KeyByClientIP, TraceLoggingFilter &
+// AccessLogFilter. See WithClientIPResolver to resolve it for all the
+// requests of the transport
+func ClientIPFilter(resolver *ClientIPResolver) Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cx := context.WithValue(r.Context(), ContextKeyClientIP, resolver.Resolve(r))
+			next.ServeHTTP(w, r.WithContext(cx))
+		})
+	}
+}
+
+// ClientIPFromContext returns the IP of the client resolved by
+// ClientIPFilter, empty without it
+func ClientIPFromContext(cx context.Context) string {
+	ip, _ := cx.Value(ContextKeyClientIP).(string)
+	return ip
+}
+
+// WithClientIPResolver resolves the IP of the client of every request
+// with the resolver, see ClientIPFilter
+func WithClientIPResolver(resolver *ClientIPResolver) TransportConfigOption {
+	return func(c *config) error {
+		c.clientIP = resolver
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestClientIPResolver_Resolve(t *testing.T) {
+	cr, err := NewClientIPResolver(WithTrustedPrivateProxies(), WithTrustedProxies("203.0.113.7"))
+	if err != nil {
+		t.Fatalf("NewClientIPResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		header map[string][]string
+		want   string
+	}{
+		{"untrusted remote", "198.51.100.1:4000", map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, "198.51.100.1"},
+		{"no headers", "10.0.0.1:4000", nil, "10.0.0.1"},
+		{"remote without port", "10.0.0.1", nil, "10.0.0.1"},
+		{"garbage remote", "pipe", nil, "pipe"},
+		{"xff", "10.0.0.1:4000", map[string][]string{"X-Forwarded-For": {"1.2.3.4, 10.0.0.2"}}, "1.2.3.4"},
+		{"xff spoofed", "10.0.0.1:4000", map[string][]string{"X-Forwarded-For": {"6.6.6.6, 1.2.3.4, 203.0.113.7"}}, "1.2.3.4"},
+		{"xff multiple headers", "10.0.0.1:4000", map[string][]string{"X-Forwarded-For": {"6.6.6.6", "1.2.3.4", "10.0.0.2"}}, "1.2.3.4"},
+		{"xff all trusted", "10.0.0.1:4000", map[string][]string{"X-Forwarded-For": {"192.168.1.5, 10.0.0.2"}}, "192.168.1.5"},
+		{"xff garbage", "10.0.0.1:4000", map[string][]string{"X-Forwarded-For": {"1.2.3.4, nonsense"}}, "10.0.0.1"},
+		{"xff empty", "10.0.0.1:4000", map[string][]string{"X-Forwarded-For": {""}}, "10.0.0.1"},
+		{"xff ipv4 mapped", "10.0.0.1:4000", map[string][]string{"X-Forwarded-For": {"::ffff:1.2.3.4"}}, "1.2.3.4"},
+		{"x-real-ip", "10.0.0.1:4000", map[string][]string{"X-Real-Ip": {"1.2.3.4"}}, "1.2.3.4"},
+		{
+			"forwarded ipv6", "10.0.0.1:4000",
+			map[string][]string{"Forwarded": {`for=192.0.2.60;proto=http, For="[2001:db8:cafe::17]:4711"`}},
+			"2001:db8:cafe::17",
+		},
+		{"forwarded unknown", "10.0.0.1:4000", map[string][]string{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{"forwarded without for", "10.0.0.1:4000", map[string][]string{"Forwarded": {"proto=https"}}, "10.0.0.1"},
+		{"forwarded first", "10.0.0.1:4000", map[string][]string{
+			"Forwarded":       {"for=1.2.3.4"},
+			"X-Forwarded-For": {"5.6.7.8"},
+		}, "1.2.3.4"},
+		{"ipv6 zone", "[fe80::1%eth0]:4000", map[string][]string{"X-Forwarded-For": {"2001:db8::1"}}, "2001:db8::1"},
+		{"ipv6 zone untrusted", "[2001:db8::2%eth0]:4000", nil, "2001:db8::2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(net_http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for k, vv := range tt.header {
+				for _, v := range vv {
+					r.Header.Add(k, v)
+				}
+			}
+
+			if got := cr.Resolve(r); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientIPResolver_invalid(t *testing.T) {
+	for _, p := range []string{"10.0.0.0/33", "proxy.local", ""} {
+		if _, err := NewClientIPResolver(WithTrustedProxies(p)); err == nil {
+			t.Errorf("NewClientIPResolver(%q) error = nil, want ErrInvalidTrustedProxy", p)
+		}
+	}
+}
+
+func TestWithClientIPResolver(t *testing.T) {
+	cr, _ := NewClientIPResolver(WithTrustedProxies("10.0.0.0/8"))
+
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithClientIPResolver(cr),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	var key string
+	tr.Get("/", func(cx context.Context, req *net_http.Request) (*net_http.Response, error) {
+		key = string(KeyByClientIP()(req))
+		return NewResponse(req, ResponseWithBytes([]byte(ClientIPFromContext(cx)))), nil
+	})
+
+	r := httptest.NewRequest(net_http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.1.1.1:5000"
+	r.Header.Set(HeaderXForwardedFor, "6.6.6.6, 1.2.3.4")
+
+	rec := httptest.NewRecorder()
+	tr.Handler.ServeHTTP(rec, r)
+
+	if rec.Body.String() != "1.2.3.4" || key != "1.2.3.4" {
+		t.Errorf("ClientIPFromContext() = %q, KeyByClientIP() = %q, want 1.2.3.4", rec.Body, key)
+	}
+}
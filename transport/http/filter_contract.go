@@ -0,0 +1,312 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const defaultContractSampleRate = 0.01
+
+// JSON types of a Shape
+const (
+	ShapeObject  = "object"
+	ShapeArray   = "array"
+	ShapeString  = "string"
+	ShapeNumber  = "number"
+	ShapeBoolean = "boolean"
+	ShapeNull    = "null"
+)
+
+type (
+	// Shape is the structure of a JSON document without its values. Type
+	// is one of the Shape* types, or several joined with `|` for array
+	// items or fields which vary, e.g. `null|string`. Fields are the
+	// fields of objects, Items the merged shape of the items of arrays
+	Shape struct {
+		Type   string            `json:"type"`
+		Fields map[string]*Shape `json:"fields,omitempty"`
+		Items  *Shape            `json:"items,omitempty"`
+	}
+
+	// ContractSample is the structure of a request & its response on a
+	// route, recorded by RecordContract. Shapes are only inferred for JSON
+	// bodies which fit the size cap
+	ContractSample struct {
+		Time                time.Time `json:"time"`
+		Method              string    `json:"method"`
+		Route               string    `json:"route"`
+		Status              int       `json:"status"`
+		RequestContentType  string    `json:"request_content_type,omitempty"`
+		ResponseContentType string    `json:"response_content_type,omitempty"`
+		Request             *Shape    `json:"request,omitempty"`
+		Response            *Shape    `json:"response,omitempty"`
+	}
+
+	// ContractSink persists the samples, e.g. to diff against a baseline
+	ContractSink interface {
+		Record(cx context.Context, cs *ContractSample) error
+	}
+
+	// ContractSinkFunc is a func adapter for ContractSink
+	ContractSinkFunc func(cx context.Context, cs *ContractSample) error
+
+	// ContractOption customises RecordContract
+	ContractOption func(*contractFilter)
+
+	contractFilter struct {
+		sink       ContractSink
+		sampleRate float64
+		maxBytes   int64
+		errFn      func(error)
+	}
+
+	// limitedBuffer keeps the first max bytes written to it
+	limitedBuffer struct {
+		bytes.Buffer
+		max       int
+		truncated bool
+	}
+)
+
+// Record calls fn
+func (fn ContractSinkFunc) Record(cx context.Context, cs *ContractSample) error {
+	return fn(cx, cs)
+}
+
+// WithContractSampleRate sets the fraction (0, 1] of requests recorded,
+// defaults to 0.01
+func WithContractSampleRate(rate float64) ContractOption {
+	return func(cf *contractFilter) { cf.sampleRate = rate }
+}
+
+// WithContractMaxBodyBytes sets the cap on the bodies buffered to infer
+// the shape, bigger bodies are recorded without one. Defaults to 64KiB
+func WithContractMaxBodyBytes(n int64) ContractOption {
+	return func(cf *contractFilter) { cf.maxBytes = n }
+}
+
+// WithContractErrorHandler sets the handler for errors returned by the
+// sink, errors are ignored by default
+func WithContractErrorHandler(fn func(error)) ContractOption {
+	return func(cf *contractFilter) { cf.errFn = fn }
+}
+
+// Write never fails, the response mustn't be cut short by the tee
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if left := lb.max - lb.Len(); n > left {
+		lb.truncated = true
+		p = p[:left]
+	}
+
+	lb.Buffer.Write(p)
+	return n, nil
+}
+
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
+
+// ShapeOf returns the shape of the JSON document, nil if it isn't one
+func ShapeOf(bt []byte) *Shape {
+	var v interface{}
+	if err := json.Unmarshal(bt, &v); err != nil {
+		return nil
+	}
+	return shapeOf(v)
+}
+
+func shapeOf(v interface{}) *Shape {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		sh := &Shape{Type: ShapeObject, Fields: make(map[string]*Shape, len(vv))}
+		for k, fv := range vv {
+			sh.Fields[k] = shapeOf(fv)
+		}
+		return sh
+	case []interface{}:
+		sh := &Shape{Type: ShapeArray}
+		for _, iv := range vv {
+			sh.Items = mergeShapes(sh.Items, shapeOf(iv))
+		}
+		return sh
+	case string:
+		return &Shape{Type: ShapeString}
+	case float64:
+		return &Shape{Type: ShapeNumber}
+	case bool:
+		return &Shape{Type: ShapeBoolean}
+	default:
+		return &Shape{Type: ShapeNull}
+	}
+}
+
+// mergeShapes unions the shapes, e.g. of the items of an array
+func mergeShapes(a, b *Shape) *Shape {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+
+	sh := &Shape{Type: mergeTypes(a.Type, b.Type)}
+
+	if a.Fields != nil || b.Fields != nil {
+		sh.Fields = make(map[string]*Shape, len(a.Fields))
+		for k, f := range a.Fields {
+			sh.Fields[k] = f
+		}
+		for k, f := range b.Fields {
+			sh.Fields[k] = mergeShapes(sh.Fields[k], f)
+		}
+	}
+
+	if a.Items != nil || b.Items != nil {
+		sh.Items = mergeShapes(a.Items, b.Items)
+	}
+	return sh
+}
+
+func mergeTypes(a, b string) string {
+	if a == b {
+		return a
+	}
+
+	set := make(map[string]struct{})
+	for _, t := range strings.Split(a+"|"+b, "|") {
+		set[t] = struct{}{}
+	}
+
+	types := make([]string, 0, len(set))
+	for t := range set {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return strings.Join(types, "|")
+}
+
+// RecordContract records the structure of a sample of the requests &
+// responses per route in the sink, for consumer-driven contract checks.
+// Only the route pattern, the content types, the status & the shape of
+// JSON bodies (field names & types) are recorded, values never leave the
+// filter. Bodies of sampled requests are buffered up to a cap (see
+// WithContractMaxBodyBytes), the rest pass through untouched
+func RecordContract(sink ContractSink, options ...ContractOption) Filter {
+	cf := &contractFilter{
+		sink:       sink,
+		sampleRate: defaultContractSampleRate,
+		maxBytes:   defaultCaptureMaxBodyBytes,
+	}
+
+	for _, o := range options {
+		o(cf)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cf.sampleRate <= 0 || (cf.sampleRate < 1 && rand.Float64() >= cf.sampleRate) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cs := &ContractSample{
+				Time:               time.Now(),
+				Method:             r.Method,
+				RequestContentType: r.Header.Get(HeaderContentType),
+			}
+
+			if isJSON(cs.RequestContentType) {
+				body, truncated, err := peekBody(r, cf.maxBytes)
+				if err == nil && !truncated && len(body) > 0 {
+					cs.Request = ShapeOf(body)
+				}
+			}
+
+			var (
+				buf = &limitedBuffer{max: int(cf.maxBytes)}
+				ww  = NewWrapResponseWriter(w, r.ProtoMajor)
+			)
+
+			// a writer of our own, not to take over the tee of another
+			ww.Tee(buf)
+			next.ServeHTTP(ww, r)
+
+			// the pattern is known once the muxer has routed the request
+			if cs.Route = routePattern(r); cs.Route == "not-chi" {
+				cs.Route = r.URL.Path
+			}
+
+			if cs.Status = ww.Status(); cs.Status == 0 {
+				cs.Status = http.StatusOK
+			}
+			cs.ResponseContentType = ww.Header().Get(HeaderContentType)
+
+			if isJSON(cs.ResponseContentType) && !buf.truncated && buf.Len() > 0 {
+				cs.Response = ShapeOf(buf.Bytes())
+			}
+
+			if err := cf.sink.Record(r.Context(), cs); err != nil && cf.errFn != nil {
+				cf.errFn(err)
+			}
+		})
+	}
+}
+
+// NewDirContractSink returns a sink which keeps a JSON file per method,
+// route & status in dir, with the shapes of all the samples merged. The
+// files are stable across runs, to be diffed against a baseline
+func NewDirContractSink(dir string) (ContractSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create contract directory")
+	}
+
+	var mu sync.Mutex
+
+	return ContractSinkFunc(func(_ context.Context, cs *ContractSample) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		name := strings.NewReplacer("/", "_", "{", "", "}", "", "*", "_").Replace(
+			cs.Method + cs.Route + "-" + strconv.Itoa(cs.Status),
+		)
+		path := filepath.Join(dir, name+".json")
+
+		merged := *cs
+
+		if bt, err := os.ReadFile(path); err == nil {
+			var prev ContractSample
+			if json.Unmarshal(bt, &prev) == nil {
+				merged.Request = mergeShapes(prev.Request, cs.Request)
+				merged.Response = mergeShapes(prev.Response, cs.Response)
+			}
+		}
+
+		// without the time, so unchanged contracts leave no diff
+		bt, err := json.MarshalIndent(struct {
+			ContractSample
+			Time *time.Time `json:"time,omitempty"`
+		}{ContractSample: merged}, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal contract")
+		}
+
+		return errors.Wrap(
+			os.WriteFile(path, bt, 0o644), "failed to write contract",
+		)
+	}), nil
+}
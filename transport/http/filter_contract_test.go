@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	net_http "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShapeOf(t *testing.T) {
+	got := ShapeOf([]byte(`{
+		"id": 42, "name": "shoe", "tags": ["a", "b"], "price": null,
+		"variants": [{"size": 9}, {"size": "L", "color": "red"}]
+	}`))
+
+	bt, _ := json.Marshal(got)
+	want := `{"type":"object","fields":{` +
+		`"id":{"type":"number"},"name":{"type":"string"},"price":{"type":"null"},` +
+		`"tags":{"type":"array","items":{"type":"string"}},` +
+		`"variants":{"type":"array","items":{"type":"object","fields":{` +
+		`"color":{"type":"string"},"size":{"type":"number|string"}}}}}}`
+
+	if string(bt) != want {
+		t.Errorf("ShapeOf() = %s\nwant %s", bt, want)
+	}
+
+	if ShapeOf([]byte(`{"broken`)) != nil {
+		t.Errorf("ShapeOf() of malformed JSON should be nil")
+	}
+}
+
+func TestRecordContract(t *testing.T) {
+	var samples []*ContractSample
+
+	h := chain(net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+		w.Header().Set(HeaderContentType, "application/json")
+		w.Write([]byte(`{"id":"secret-id","count":3}`))
+	}), RecordContract(
+		ContractSinkFunc(func(_ context.Context, cs *ContractSample) error {
+			samples = append(samples, cs)
+			return nil
+		}),
+		WithContractSampleRate(1),
+	))
+
+	req := httptest.NewRequest(net_http.MethodPost, "/products", strings.NewReader(`{"name":"secret-name"}`))
+	req.Header.Set(HeaderContentType, "application/json; charset=utf-8")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Body.String() != `{"id":"secret-id","count":3}` {
+		t.Errorf("response = %q, want it untouched", rec.Body)
+	}
+
+	if len(samples) != 1 {
+		t.Fatalf("samples = %d, want 1", len(samples))
+	}
+
+	cs := samples[0]
+	if cs.Route != "/products" || cs.Status != net_http.StatusOK || cs.Method != net_http.MethodPost {
+		t.Errorf("sample = %+v, want POST /products 200", cs)
+	}
+
+	bt, _ := json.Marshal(cs)
+	if strings.Contains(string(bt), "secret") {
+		t.Errorf("sample %s has values of the bodies", bt)
+	}
+
+	if cs.Request.Fields["name"].Type != ShapeString || cs.Response.Fields["count"].Type != ShapeNumber {
+		t.Errorf("shapes = %s, want the fields of the bodies", bt)
+	}
+}
+
+func TestDirContractSink(t *testing.T) {
+	dir := t.TempDir()
+
+	sink, err := NewDirContractSink(dir)
+	if err != nil {
+		t.Fatalf("NewDirContractSink() error = %v", err)
+	}
+
+	for _, body := range []string{`{"a":1}`, `{"b":"x"}`} {
+		err := sink.Record(context.Background(), &ContractSample{
+			Method: "GET", Route: "/items/{id}", Status: 200, Response: ShapeOf([]byte(body)),
+		})
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	bt, err := os.ReadFile(filepath.Join(dir, "GET_items_id-200.json"))
+	if err != nil {
+		t.Fatalf("contract file: %v", err)
+	}
+
+	var got ContractSample
+	if err := json.Unmarshal(bt, &got); err != nil {
+		t.Fatalf("contract %s isn't JSON: %v", bt, err)
+	}
+
+	if len(got.Response.Fields) != 2 || strings.Contains(string(bt), `"time"`) {
+		t.Errorf("contract = %s, want the shapes merged & no time", bt)
+	}
+}
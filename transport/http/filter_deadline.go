@@ -0,0 +1,35 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/unbxd/go-base/v2/net/dialer"
+)
+
+// DeadlineFilter bounds the context of the request by the timeout the caller
+// sent in X-Request-Timeout or Grpc-Timeout, so the work is cancelled once
+// the caller stops waiting. The deadline then propagates on to the calls
+// made through the dialer or the proxy with deadline propagation.
+// max caps the timeout of the caller, zero or less doesn't cap it
+func DeadlineFilter(max time.Duration) Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, ok := dialer.RequestTimeout(r.Header)
+			if max > 0 && (!ok || d > max) {
+				d, ok = max, true
+			}
+
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(cx))
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	kit_http "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	// HeaderContentMD5 is the base64 MD5 of the body, RFC 1864
+	HeaderContentMD5 = "Content-MD5"
+	// HeaderDigest is the list of `algorithm=base64` digests of the body,
+	// RFC 3230
+	HeaderDigest = "Digest"
+
+	defaultDigestMaxBodyBytes = 10 << 20
+)
+
+var (
+	// ErrDigestMismatch is the error of the requests whose body doesn't
+	// match the digest sent with it
+	ErrDigestMismatch = NewHTTPError(http.StatusBadRequest, "digest_mismatch", "body doesn't match its digest")
+	// ErrDigestInvalid is the error of the requests with a digest which
+	// isn't base64
+	ErrDigestInvalid = NewHTTPError(http.StatusBadRequest, "digest_invalid", "digest isn't base64")
+	// ErrDigestBodyTooLarge is the error of the requests with a digest
+	// and a body bigger than the cap, see WithDigestMaxBodyBytes
+	ErrDigestBodyTooLarge = NewHTTPError(http.StatusRequestEntityTooLarge, "body_too_large", "body is too large to verify")
+	// ErrDigestBodyUnreadable is the error of the requests with a digest
+	// whose body can't be read
+	ErrDigestBodyUnreadable = NewHTTPError(http.StatusBadRequest, "body_unreadable", "body can't be read")
+)
+
+// digestAlgorithms are the algorithms verified, by their name in Digest
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+type (
+	// DigestOption customises VerifyDigestFilter
+	DigestOption func(*digestVerifier)
+
+	digestVerifier struct {
+		maxBytes int64
+		encoder  ErrorEncoder
+	}
+)
+
+// WithDigestMaxBodyBytes caps the bodies verified, they are buffered.
+// Bigger bodies are rejected with ErrDigestBodyTooLarge. Defaults to
+// 10MiB
+func WithDigestMaxBodyBytes(n int64) DigestOption {
+	return func(dv *digestVerifier) { dv.maxBytes = n }
+}
+
+// WithDigestErrorEncoder sets the encoder of the rejections, e.g.
+// NewProblemJSONErrorEncoder. Defaults to go-kit's DefaultErrorEncoder
+func WithDigestErrorEncoder(fn ErrorEncoder) DigestOption {
+	return func(dv *digestVerifier) { dv.encoder = fn }
+}
+
+// expectedDigests returns the digests sent with the request by algorithm,
+// those of unknown algorithms are skipped
+func expectedDigests(hdr http.Header) (map[string][]byte, error) {
+	expected := make(map[string][]byte)
+
+	if v := hdr.Get(HeaderContentMD5); v != "" {
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		expected["md5"] = sum
+	}
+
+	for _, v := range hdr.Values(HeaderDigest) {
+		for _, d := range strings.Split(v, ",") {
+			algo, val, ok := strings.Cut(strings.TrimSpace(d), "=")
+			algo = strings.ToLower(algo)
+
+			if _, known := digestAlgorithms[algo]; !ok || !known {
+				continue
+			}
+
+			sum, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, err
+			}
+			expected[algo] = sum
+		}
+	}
+
+	return expected, nil
+}
+
+// VerifyDigestFilter verifies the body of the requests sent with a
+// Content-MD5 or a Digest header before they are served. md5, sha-256 &
+// sha-512 are verified, other algorithms of Digest are ignored, as are
+// requests without a known one. The body is hashed as it is buffered,
+// up to WithDigestMaxBodyBytes, and handed to the handler once verified.
+// Requests whose body doesn't match are rejected with ErrDigestMismatch,
+// a 400
+func VerifyDigestFilter(options ...DigestOption) Filter {
+	dv := &digestVerifier{
+		maxBytes: defaultDigestMaxBodyBytes,
+		encoder:  ErrorEncoder(kit_http.DefaultErrorEncoder),
+	}
+
+	for _, o := range options {
+		o(dv)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expected, err := expectedDigests(r.Header)
+			switch {
+			case err != nil:
+				dv.encoder(r.Context(), ErrDigestInvalid, w)
+				return
+			case len(expected) == 0:
+				next.ServeHTTP(w, r)
+				return
+			case r.ContentLength > dv.maxBytes:
+				dv.encoder(r.Context(), ErrDigestBodyTooLarge, w)
+				return
+			}
+
+			var (
+				buf    bytes.Buffer
+				hashes = make(map[string]hash.Hash, len(expected))
+				dst    = []io.Writer{&buf}
+			)
+
+			for algo := range expected {
+				hashes[algo] = digestAlgorithms[algo]()
+				dst = append(dst, hashes[algo])
+			}
+
+			if r.Body != nil {
+				_, err = io.Copy(io.MultiWriter(dst...), io.LimitReader(r.Body, dv.maxBytes+1))
+			}
+
+			switch {
+			case err != nil:
+				dv.encoder(r.Context(), ErrDigestBodyUnreadable, w)
+				return
+			case int64(buf.Len()) > dv.maxBytes:
+				dv.encoder(r.Context(), ErrDigestBodyTooLarge, w)
+				return
+			}
+
+			for algo, h := range hashes {
+				if subtle.ConstantTimeCompare(h.Sum(nil), expected[algo]) != 1 {
+					dv.encoder(r.Context(), ErrDigestMismatch, w)
+					return
+				}
+			}
+
+			if r.Body != nil {
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{bytes.NewReader(buf.Bytes()), r.Body}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDigestFilter(t *testing.T) {
+	var (
+		body   = `{"order":42}`
+		md5sum = md5.Sum([]byte(body))
+		shasum = sha256.Sum256([]byte(body))
+		b64    = base64.StdEncoding.EncodeToString
+	)
+
+	echo := net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+	h := chain(echo, VerifyDigestFilter(WithDigestMaxBodyBytes(64)))
+
+	tests := []struct {
+		name   string
+		body   string
+		header map[string]string
+		want   int
+	}{
+		{"without digest", body, nil, net_http.StatusOK},
+		{"content-md5", body, map[string]string{HeaderContentMD5: b64(md5sum[:])}, net_http.StatusOK},
+		{"digest sha-256", body, map[string]string{HeaderDigest: "SHA-256=" + b64(shasum[:])}, net_http.StatusOK},
+		{"digest both", body, map[string]string{HeaderDigest: "md5=" + b64(md5sum[:]) + ", sha-256=" + b64(shasum[:])}, net_http.StatusOK},
+		{"digest unknown algorithm", body, map[string]string{HeaderDigest: "unixsum=30637"}, net_http.StatusOK},
+		{"content-md5 mismatch", `{"order":43}`, map[string]string{HeaderContentMD5: b64(md5sum[:])}, net_http.StatusBadRequest},
+		{"digest mismatch", `{"order":43}`, map[string]string{HeaderDigest: "sha-256=" + b64(shasum[:])}, net_http.StatusBadRequest},
+		{"one of the digests mismatch", body, map[string]string{HeaderDigest: "md5=" + b64(md5sum[:]) + ",sha-256=" + b64(md5sum[:])}, net_http.StatusBadRequest},
+		{"invalid digest", body, map[string]string{HeaderContentMD5: "not base64!"}, net_http.StatusBadRequest},
+		{"too large", strings.Repeat("x", 65), map[string]string{HeaderContentMD5: b64(md5sum[:])}, net_http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(net_http.MethodPost, "/", strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d %q, want %d", rec.Code, rec.Body, tt.want)
+			}
+
+			// the handler gets the whole body
+			if tt.want == net_http.StatusOK && rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body, tt.body)
+			}
+		})
+	}
+}
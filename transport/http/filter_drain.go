@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+const defaultShutdownTimeout = 100 * time.Second
+
+// ErrInvalidShutdownTimeout is returned by WithShutdownTimeout for a
+// timeout which isn't positive
+var ErrInvalidShutdownTimeout = errors.New("shutdown timeout must be positive")
+
+// drainer turns requests away once the transport is closing & counts the
+// requests in flight until then
+type drainer struct {
+	draining atomic.Bool
+	inflight atomic.Int64
+}
+
+// streaming requests last until the server shuts down, they aren't waited
+// for while draining
+func isStreaming(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), MIMEEventStream)
+}
+
+func (dr *drainer) filter() Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if dr.draining.Load() {
+				// the client retries on another instance, this
+				// connection goes away
+				w.Header().Set("Connection", "close")
+				http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+				return
+			}
+
+			if isStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			dr.inflight.Add(1)
+			defer dr.inflight.Add(-1)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// drain turns new requests away & waits for the ones in flight until cx is
+// done
+func (dr *drainer) drain(cx context.Context) error {
+	dr.draining.Store(true)
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for dr.inflight.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-cx.Done():
+			return cx.Err()
+		}
+	}
+	return nil
+}
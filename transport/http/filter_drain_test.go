@@ -0,0 +1,129 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	net_http "net/http"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestTransport_CloseWithContext(t *testing.T) {
+	if _, err := NewHTTPTransport("test", WithShutdownTimeout(0)); !errors.Is(err, ErrInvalidShutdownTimeout) {
+		t.Fatalf("WithShutdownTimeout(0) error = %v, want %v", err, ErrInvalidShutdownTimeout)
+	}
+
+	tr, err := NewHTTPTransport("test", WithCustomLogger(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	tr.Get("/slow", func(context.Context, *net_http.Request) (*net_http.Response, error) {
+		close(started)
+		<-release
+		return okResponse()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = tr.Serve(ln) }()
+
+	url := "http://" + ln.Addr().String()
+
+	inflight := make(chan int, 1)
+	go func() {
+		res, err := net_http.Get(url + "/slow")
+		if err != nil {
+			inflight <- 0
+			return
+		}
+		_ = res.Body.Close()
+		inflight <- res.StatusCode
+	}()
+	<-started
+
+	closed := make(chan error, 1)
+	go func() { closed <- tr.CloseWithContext(context.Background()) }()
+
+	for !tr.drain.draining.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// new connections are turned away while the request drains
+	cl := &net_http.Client{Transport: &net_http.Transport{DisableKeepAlives: true}}
+	for _, path := range []string{"/slow", "/ping"} {
+		res, err := cl.Get(url + path)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", path, err)
+		}
+		_ = res.Body.Close()
+
+		if res.StatusCode != net_http.StatusServiceUnavailable {
+			t.Errorf("Get(%s) status = %d, want %d", path, res.StatusCode, net_http.StatusServiceUnavailable)
+		}
+	}
+
+	select {
+	case err := <-closed:
+		t.Fatalf("CloseWithContext() returned before the request finished, error = %v", err)
+	default:
+	}
+
+	close(release)
+
+	if code := <-inflight; code != net_http.StatusOK {
+		t.Errorf("in flight status = %d, want %d", code, net_http.StatusOK)
+	}
+
+	if err := <-closed; err != nil {
+		t.Errorf("CloseWithContext() error = %v", err)
+	}
+}
+
+func TestTransport_CloseWithContext_timeout(t *testing.T) {
+	tr, err := NewHTTPTransport("test", WithCustomLogger(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	tr.Get("/slow", func(context.Context, *net_http.Request) (*net_http.Response, error) {
+		<-release
+		return okResponse()
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = tr.Serve(ln) }()
+
+	go func() {
+		if res, err := net_http.Get("http://" + ln.Addr().String() + "/slow"); err == nil {
+			_ = res.Body.Close()
+		}
+	}()
+
+	for tr.drain.inflight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := tr.CloseWithContext(cx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CloseWithContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderETag         = "ETag"
+	HeaderIfNoneMatch  = "If-None-Match"
+	HeaderCacheControl = "Cache-Control"
+)
+
+// etagWriter holds back the status & body of the response until the
+// handler is done, so the ETag can be set before anything is sent.
+// If the handler flushes, the response is streamed as is from then on
+type etagWriter struct {
+	http.ResponseWriter
+
+	code        int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.passthrough {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if ew.code == 0 {
+		ew.code = code
+	}
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	if ew.passthrough {
+		return ew.ResponseWriter.Write(p)
+	}
+
+	if ew.code == 0 {
+		ew.code = http.StatusOK
+	}
+	return ew.buf.Write(p)
+}
+
+func (ew *etagWriter) Flush() {
+	if !ew.passthrough {
+		ew.passthrough = true
+		ew.writeBuffered()
+	}
+
+	if fl, ok := ew.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (ew *etagWriter) writeBuffered() {
+	if ew.code != 0 {
+		ew.ResponseWriter.WriteHeader(ew.code)
+	}
+
+	if ew.buf.Len() > 0 {
+		_, _ = ew.ResponseWriter.Write(ew.buf.Bytes())
+	}
+}
+
+// etagMatch reports whether the If-None-Match header matches etag. The
+// comparison is weak, as the RFC 9110 requires for If-None-Match, i.e.
+// W/"x" matches "x"
+func etagMatch(ifNoneMatch []string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, hv := range ifNoneMatch {
+		for _, tag := range strings.Split(hv, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ETagFilter sets a strong ETag, the sha256 of the body, on successful
+// GET & HEAD responses and answers 304 Not Modified, without the body,
+// to the requests with a matching If-None-Match.
+// Responses are buffered to compute the ETag. It leaves alone the
+// responses other than 200, those which set their own ETag and those with
+// Cache-Control: no-store. Responses which flush are streamed without one.
+//
+// With GzipCompressionFilter, ETagFilter must come after it, so the ETag
+// is computed over the uncompressed representation, e.g.
+//
+//	WithFilters(GzipCompressionFilter(5), ETagFilter())
+//
+// or use HandlerWithETag, handler filters run inside the transport ones.
+func ETagFilter() Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w}
+			next.ServeHTTP(ew, r)
+
+			if ew.passthrough {
+				return
+			}
+
+			hdr := w.Header()
+			if ew.code != http.StatusOK ||
+				hdr.Get(HeaderETag) != "" ||
+				strings.Contains(strings.ToLower(hdr.Get(HeaderCacheControl)), "no-store") ||
+				// HEAD handlers may not write the body, the ETag would be of
+				// an empty body then
+				(r.Method == http.MethodHead && ew.buf.Len() == 0) {
+				ew.writeBuffered()
+				return
+			}
+
+			sum := sha256.Sum256(ew.buf.Bytes())
+			etag := `"` + hex.EncodeToString(sum[:]) + `"`
+			hdr.Set(HeaderETag, etag)
+
+			if etagMatch(r.Header.Values(HeaderIfNoneMatch), etag) {
+				hdr.Del("Content-Length")
+				hdr.Del(HeaderContentType)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			ew.writeBuffered()
+		})
+	}
+}
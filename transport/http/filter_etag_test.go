@@ -0,0 +1,116 @@
+package http
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagFilter(t *testing.T) {
+	const body = `{"config":"blob"}`
+
+	sum := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	handler := func(status int, headers map[string]string) net_http.Handler {
+		return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+		})
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch []string
+		status      int
+		headers     map[string]string
+		wantStatus  int
+		wantETag    string
+		wantBody    bool
+	}{
+		{"no validator", "GET", nil, 200, nil, 200, etag, true},
+		{"match", "GET", []string{etag}, 200, nil, 304, etag, false},
+		{"head match", "HEAD", []string{etag}, 200, nil, 304, etag, false},
+		{"weak validator", "GET", []string{"W/" + etag}, 200, nil, 304, etag, false},
+		{"multiple values", "GET", []string{`"a", W/"b", ` + etag}, 200, nil, 304, etag, false},
+		{"multiple headers", "GET", []string{`"a"`, etag}, 200, nil, 304, etag, false},
+		{"wildcard", "GET", []string{"*"}, 200, nil, 304, etag, false},
+		{"no match", "GET", []string{`"a", W/"b"`}, 200, nil, 200, etag, true},
+		{"post", "POST", []string{etag}, 200, nil, 200, "", true},
+		{"not 200", "GET", []string{etag}, 201, nil, 201, "", true},
+		{"own etag", "GET", []string{etag}, 200, map[string]string{"ETag": `"own"`}, 200, `"own"`, true},
+		{"no-store", "GET", []string{etag}, 200, map[string]string{"Cache-Control": "private, no-store"}, 200, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/config", nil)
+			for _, v := range tt.ifNoneMatch {
+				req.Header.Add(HeaderIfNoneMatch, v)
+			}
+
+			rec := httptest.NewRecorder()
+			ETagFilter()(handler(tt.status, tt.headers)).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get(HeaderETag); got != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", got, tt.wantETag)
+			}
+			if got := rec.Body.String(); (got == body) != tt.wantBody {
+				t.Errorf("body = %q, want body %v", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestETagFilterWithGzip(t *testing.T) {
+	const body = `{"config":"blob"}`
+
+	sum := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	handler := chain(
+		net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			w.Header().Set(HeaderContentType, "application/json")
+			_, _ = w.Write([]byte(body))
+		}),
+		GzipCompressionFilter(5, "application/json"),
+		ETagFilter(),
+	)
+
+	req := httptest.NewRequest(net_http.MethodGet, "/config", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(HeaderETag); got != etag {
+		t.Errorf("ETag = %s, want the one of the uncompressed body %s", got, etag)
+	}
+
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("response isn't gzipped: %v", err)
+	}
+	if bt, _ := io.ReadAll(gr); string(bt) != body {
+		t.Errorf("body = %q, want %q", bt, body)
+	}
+
+	req.Header.Set(HeaderIfNoneMatch, etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != net_http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("conditional GET = %d with %d bytes, want 304 without body", rec.Code, rec.Body.Len())
+	}
+}
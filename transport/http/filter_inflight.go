@@ -0,0 +1,153 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/metrics"
+)
+
+const (
+	inflightRequestsMetric = "http_inflight_requests"
+	queuedRequestsMetric   = "http_queued_requests"
+	shedRequestsMetric     = "http_shed_requests"
+)
+
+// ErrInvalidMaxInflight is returned by WithMaxInflightRequests for a max
+// which isn't positive or a negative queue
+var ErrInvalidMaxInflight = errors.New("max in-flight requests must be positive & queue not negative")
+
+type (
+	// InflightOption customises WithMaxInflightRequests
+	InflightOption func(*inflight)
+
+	// inflight admits up to cap(slots) requests at once & queues up to
+	// queue more, the rest is shed
+	inflight struct {
+		slots chan struct{}
+		queue int64
+
+		running atomic.Int64
+		queued  atomic.Int64
+
+		inflightGauge metrics.Gauge
+		queuedGauge   metrics.Gauge
+		shedCounter   metrics.Counter
+	}
+)
+
+// WithInflightMetrics publishes the requests in flight & queued as the
+// `http_inflight_requests` & `http_queued_requests` gauges and counts the
+// shed ones as `http_shed_requests`
+func WithInflightMetrics(provider metrics.Provider) InflightOption {
+	return func(in *inflight) {
+		in.inflightGauge = provider.NewGauge(inflightRequestsMetric)
+		in.queuedGauge = provider.NewGauge(queuedRequestsMetric)
+		in.shedCounter = provider.NewCounter(shedRequestsMetric, 1)
+	}
+}
+
+// WithMaxInflightRequests bounds the requests served at once across all
+// connections to max. Up to queue more wait for a slot, until their
+// context is done, the rest is answered with 503. It sheds load before
+// the process is overwhelmed, unlike the limits per route or per
+// connection. Heartbeats, event streams & websockets aren't bounded, see
+// Transport.Inflight for the requests in flight
+func WithMaxInflightRequests(max, queue int, options ...InflightOption) TransportConfigOption {
+	return func(c *config) error {
+		if max <= 0 || queue < 0 {
+			return ErrInvalidMaxInflight
+		}
+
+		in := &inflight{
+			slots: make(chan struct{}, max),
+			queue: int64(queue),
+		}
+
+		for _, o := range options {
+			o(in)
+		}
+
+		c.inflight = in
+		return nil
+	}
+}
+
+// Inflight returns the requests served & the ones waiting for a slot, both
+// are zero without WithMaxInflightRequests
+func (tr *Transport) Inflight() (running, queued int) {
+	if tr.inflight == nil {
+		return 0, 0
+	}
+	return int(tr.inflight.running.Load()), int(tr.inflight.queued.Load())
+}
+
+func (in *inflight) set(gauge metrics.Gauge, n int64) {
+	if gauge != nil {
+		gauge.Set(float64(n))
+	}
+}
+
+// acquire takes a slot, waiting in the queue when there is room. It is
+// false when the request is shed or went away while queued
+func (in *inflight) acquire(r *http.Request) bool {
+	select {
+	case in.slots <- struct{}{}:
+		in.set(in.inflightGauge, in.running.Add(1))
+		return true
+	default:
+	}
+
+	n := in.queued.Add(1)
+	if n > in.queue {
+		in.queued.Add(-1)
+		return false
+	}
+	in.set(in.queuedGauge, n)
+
+	defer func() { in.set(in.queuedGauge, in.queued.Add(-1)) }()
+
+	select {
+	case in.slots <- struct{}{}:
+		in.set(in.inflightGauge, in.running.Add(1))
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (in *inflight) release() {
+	in.set(in.inflightGauge, in.running.Add(-1))
+	<-in.slots
+}
+
+func (in *inflight) filter() Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !in.acquire(r) {
+				if in.shedCounter != nil {
+					in.shedCounter.Add(1)
+				}
+
+				w.Header().Set(HeaderContentType, "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"code":  http.StatusServiceUnavailable,
+					"error": "too many requests in flight",
+				})
+				return
+			}
+			defer in.release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestWithMaxInflightRequests(t *testing.T) {
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithMaxInflightRequests(1, 1),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	release := make(chan struct{})
+	tr.Get("/work", func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		<-release
+		return NewResponse(req, ResponseWithBytes([]byte("done"))), nil
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		tr.Handler.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, path, nil))
+		return rec
+	}
+
+	waitFor := func(running, queued int) {
+		t.Helper()
+		for i := 0; i < 1000; i++ {
+			if r, q := tr.Inflight(); r == running && q == queued {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		r, q := tr.Inflight()
+		t.Fatalf("Inflight() = %d, %d, want %d, %d", r, q, running, queued)
+	}
+
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() { codes <- serve("/work").Code }()
+		waitFor(1, i)
+	}
+
+	if rec := serve("/work"); rec.Code != net_http.StatusServiceUnavailable {
+		t.Errorf("GET /work when saturated = %d, want 503", rec.Code)
+	}
+
+	if rec := serve("/ping"); rec.Code != net_http.StatusOK {
+		t.Errorf("GET /ping when saturated = %d, want 200", rec.Code)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != net_http.StatusOK {
+			t.Errorf("GET /work admitted = %d, want 200", code)
+		}
+	}
+	waitFor(0, 0)
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/journal"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/notifier"
+)
+
+const crashJournalNotifyTimeout = 5 * time.Second
+
+// WithCrashJournal records the requests in flight in a memory-mapped
+// journal at path with the given number of slots (see package journal).
+// At startup the journal left by the previous run is recovered, the
+// requests which were in flight when it died are logged as warnings (and
+// sent to the notifier set by WithCrashJournalNotifier) before the
+// journal is truncated.
+// Slots should be well above the number of concurrent requests, a slot
+// is reused once all the others have been taken. The journal survives the
+// process being killed, not a power loss, nothing is synced to disk
+func WithCrashJournal(path string, slots int) TransportConfigOption {
+	return func(c *config) error {
+		if slots <= 0 {
+			return journal.ErrInvalidSlots
+		}
+
+		c.journalPath = path
+		c.journalSlots = slots
+		return nil
+	}
+}
+
+// WithCrashJournalNotifier publishes the requests recovered from the
+// crash journal, one journal.InFlightRecord each, see WithCrashJournal
+func WithCrashJournalNotifier(nt notifier.Notifier) TransportConfigOption {
+	return func(c *config) error {
+		c.journalNotifier = nt
+		return nil
+	}
+}
+
+// openCrashJournal reports the requests left in flight by the previous
+// run and opens the journal afresh
+func openCrashJournal(
+	logger log.Logger,
+	nt notifier.Notifier,
+	path string,
+	slots int,
+) (*journal.Journal, error) {
+	records, err := journal.Recover(path)
+	if err != nil {
+		// the journal is for forensics, it shouldn't keep the server down
+		logger.Error(
+			"failed to recover crash journal",
+			log.String("path", path), log.Error(err),
+		)
+	}
+
+	for _, rec := range records {
+		logger.Warn(
+			"request was in flight when the process died",
+			log.String("route", rec.Route),
+			log.String("request_id", rec.RequestID),
+			log.String("start", rec.Start.Format(time.RFC3339Nano)),
+			log.Int("slot", rec.Slot),
+		)
+
+		if nt == nil {
+			continue
+		}
+
+		cx, canc := context.WithTimeout(context.Background(), crashJournalNotifyTimeout)
+		if err := nt.Notify(cx, rec); err != nil {
+			logger.Error("failed to notify crash journal record", log.Error(err))
+		}
+		canc()
+	}
+
+	jr, err := journal.Open(path, slots)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open crash journal")
+	}
+	return jr, nil
+}
+
+// crashJournalFilter keeps the request in the journal while it runs
+func crashJournalFilter(jr *journal.Journal) Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			en := jr.Begin(
+				r.Method+" "+r.URL.Path, r.Header.Get(HeaderRequestID), time.Now(),
+			)
+			defer en.End()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/journal"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+type warnLogger struct {
+	log.Logger
+	warns []string
+}
+
+func (wl *warnLogger) Warn(msg string, fields ...log.Field) {
+	for _, f := range fields {
+		if f.Key == "request_id" {
+			msg += " " + f.String
+		}
+	}
+	wl.warns = append(wl.warns, msg)
+}
+
+type notifierFunc func(context.Context, interface{}) error
+
+func (fn notifierFunc) Notify(cx context.Context, data interface{}) error { return fn(cx, data) }
+
+func TestWithCrashJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	// previous run, died with a request in flight
+	jr, err := journal.Open(path, 8)
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	jr.Begin("GET /crash", "r1", time.Now())
+
+	var (
+		logger   = &warnLogger{Logger: log.NewNoopLogger()}
+		notified []interface{}
+	)
+
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(logger),
+		WithCrashJournal(path, 8),
+		WithCrashJournalNotifier(notifierFunc(func(_ context.Context, data interface{}) error {
+			notified = append(notified, data)
+			return nil
+		})),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+	_ = jr.Close()
+
+	want := "request was in flight when the process died r1"
+	if len(logger.warns) != 1 || logger.warns[0] != want {
+		t.Errorf("warnings = %q, want %q", logger.warns, want)
+	}
+
+	if rec, ok := notified[0].(journal.InFlightRecord); len(notified) != 1 || !ok || rec.Route != "GET /crash" {
+		t.Errorf("notified = %+v, want the recovered record", notified)
+	}
+
+	// journal is truncated, and requests which complete don't show up
+	var inflight []journal.InFlightRecord
+	tr.Get("/x", func(context.Context, *net_http.Request) (*net_http.Response, error) {
+		inflight, _ = journal.Recover(path)
+		return &net_http.Response{StatusCode: net_http.StatusOK, Body: net_http.NoBody}, nil
+	})
+
+	req := httptest.NewRequest(net_http.MethodGet, "/x", nil)
+	req.Header.Set(HeaderRequestID, "r2")
+	tr.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(inflight) != 1 || inflight[0].RequestID != "r2" || inflight[0].Route != "GET /x" {
+		t.Errorf("in flight while handling = %+v, want r2 only", inflight)
+	}
+
+	if got, _ := journal.Recover(path); len(got) != 0 {
+		t.Errorf("in flight after the request = %+v, want none", got)
+	}
+
+	if _, err := NewHTTPTransport("test", WithCrashJournal(path, 0)); err != journal.ErrInvalidSlots {
+		t.Errorf("NewHTTPTransport() error = %v, want %v", err, journal.ErrInvalidSlots)
+	}
+}
@@ -143,6 +143,16 @@ func CustomMetricsFilter(
 					{"method", r.Method},
 				}...)
 
+				// request class
+				if cl := ClassFromContext(r.Context()); cl != ClassUnknown {
+					tags = append(tags, KeyValue{"class", string(cl)})
+				}
+
+				// served on timeout
+				if TimedOutFromContext(r.Context()) {
+					tags = append(tags, KeyValue{"timed_out", "true"})
+				}
+
 				// status code
 				if rw, ok := w.(WrapResponseWriter); ok {
 					tags = append(
@@ -0,0 +1,212 @@
+package http
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unbxd/go-base/v2/metrics"
+	"github.com/unbxd/go-base/v2/rate"
+)
+
+const (
+	// HeaderRetryAfter is set on responses denied by the rate limiter
+	HeaderRetryAfter = "Retry-After"
+
+	rateLimitMetric            = "http.ratelimit"
+	defaultRateLimitRetryAfter = time.Second
+)
+
+type (
+	// RateLimitKeyFunc extracts the key the request is rate limited against
+	RateLimitKeyFunc func(*http.Request) rate.Key
+
+	// RateLimitDeniedEncoder writes the response for a request which has been
+	// denied by the limiter. err is non-nil if the limiter failed to make a
+	// decision, in which case the request is denied as well
+	RateLimitDeniedEncoder func(w http.ResponseWriter, r *http.Request, key rate.Key, err error)
+
+	// RateLimitOption customises the RateLimitFilter
+	RateLimitOption func(*rateLimitFilter)
+
+	rateLimitFilter struct {
+		limiter rate.Limiter
+		keyFn   RateLimitKeyFunc
+		encoder RateLimitDeniedEncoder
+
+		retryAfter time.Duration
+		skip       map[string]struct{}
+		counter    metrics.Counter
+	}
+)
+
+// DefaultRateLimitDeniedEncoder writes `429 Too Many Requests` with a JSON body
+func DefaultRateLimitDeniedEncoder(
+	w http.ResponseWriter,
+	_ *http.Request,
+	_ rate.Key,
+	_ error,
+) {
+	w.Header().Set(HeaderContentType, "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":  http.StatusTooManyRequests,
+		"error": http.StatusText(http.StatusTooManyRequests),
+	})
+}
+
+// WithRateLimitDeniedEncoder overrides the response written when the
+// request is denied, so the body can match the service's error envelope
+func WithRateLimitDeniedEncoder(fn RateLimitDeniedEncoder) RateLimitOption {
+	return func(rf *rateLimitFilter) { rf.encoder = fn }
+}
+
+// WithRateLimitRetryAfter sets the `Retry-After` header on denied
+// responses, rounded up to seconds. Defaults to 1s, non-positive
+// duration skips the header
+func WithRateLimitRetryAfter(d time.Duration) RateLimitOption {
+	return func(rf *rateLimitFilter) { rf.retryAfter = d }
+}
+
+// WithRateLimitSkipPaths exempts the paths from rate limiting, e.g.
+// heartbeat & monitoring endpoints
+func WithRateLimitSkipPaths(paths ...string) RateLimitOption {
+	return func(rf *rateLimitFilter) {
+		for _, p := range paths {
+			rf.skip[p] = struct{}{}
+		}
+	}
+}
+
+// WithRateLimitMetrics counts the decisions as `http.ratelimit`, tagged
+// with `decision` (allowed/denied) and the route pattern
+func WithRateLimitMetrics(provider metrics.Provider) RateLimitOption {
+	return func(rf *rateLimitFilter) {
+		if provider != nil {
+			rf.counter = provider.NewCounter(rateLimitMetric, 1)
+		}
+	}
+}
+
+func (rf *rateLimitFilter) count(decision string, r *http.Request) {
+	if rf.counter == nil {
+		return
+	}
+
+	rf.counter.With("decision", decision, "route", routePattern(r)).Add(1)
+}
+
+// KeyByClientIP keys the request by the client IP resolved by
+// ClientIPFilter. Without it, it is the first address in
+// `X-Forwarded-For` if present, the remote address of the connection
+// otherwise, only use it then behind proxies which set the header, as
+// clients can forge it
+func KeyByClientIP() RateLimitKeyFunc {
+	remote := KeyByRemoteIP()
+
+	return func(r *http.Request) rate.Key {
+		if ip := ClientIPFromContext(r.Context()); ip != "" {
+			return rate.Key(ip)
+		}
+
+		xff := r.Header.Get(HeaderXForwardedFor)
+		if xff == "" {
+			return remote(r)
+		}
+
+		if ix := strings.IndexByte(xff, ','); ix >= 0 {
+			xff = xff[:ix]
+		}
+
+		if ip := strings.TrimSpace(xff); ip != "" {
+			return rate.Key(ip)
+		}
+
+		return remote(r)
+	}
+}
+
+// KeyByRemoteIP keys the request by the IP of the remote address
+// of the connection
+func KeyByRemoteIP() RateLimitKeyFunc {
+	return func(r *http.Request) rate.Key {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return rate.Key(r.RemoteAddr)
+		}
+		return rate.Key(host)
+	}
+}
+
+// KeyByHeader keys the request by the value of the given header,
+// requests without the header share a single empty key
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) rate.Key {
+		return rate.Key(r.Header.Get(name))
+	}
+}
+
+// RateLimitFilter applies the limiter to every request, keyed by keyFn.
+// Denied requests are answered with `429 Too Many Requests` and a
+// `Retry-After` header and never reach the handler. If keyFn is nil,
+// requests are keyed by client IP (see KeyByClientIP).
+// Key functions must not read the request body.
+//
+//	limiter, _ := rate.NewInMemoryLimiter(10, 20)
+//	http.WithFilters(
+//		http.RateLimitFilter(limiter, http.KeyByHeader("X-Api-Key")),
+//	)
+func RateLimitFilter(
+	limiter rate.Limiter,
+	keyFn func(*http.Request) rate.Key,
+	options ...RateLimitOption,
+) Filter {
+	rf := &rateLimitFilter{
+		limiter: limiter,
+		keyFn:   keyFn,
+		encoder: DefaultRateLimitDeniedEncoder,
+
+		retryAfter: defaultRateLimitRetryAfter,
+		skip:       make(map[string]struct{}),
+	}
+
+	if rf.keyFn == nil {
+		rf.keyFn = KeyByClientIP()
+	}
+
+	for _, o := range options {
+		o(rf)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := rf.skip[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := rf.keyFn(r)
+
+			allowed, err := rf.limiter.Allow(r.Context(), key)
+			if err != nil || !allowed {
+				if rf.retryAfter > 0 {
+					secs := int64((rf.retryAfter + time.Second - 1) / time.Second)
+					w.Header().Set(HeaderRetryAfter, strconv.FormatInt(secs, 10))
+				}
+
+				rf.encoder(w, r, key, err)
+				rf.count("denied", r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+
+			// route pattern is only available once the request is routed
+			rf.count("allowed", r)
+		})
+	}
+}
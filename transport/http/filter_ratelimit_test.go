@@ -0,0 +1,71 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/rate"
+)
+
+type keyRecorder struct {
+	keys  []rate.Key
+	allow bool
+}
+
+func (kr *keyRecorder) Allow(_ context.Context, key rate.Key) (bool, error) {
+	kr.keys = append(kr.keys, key)
+	return kr.allow, nil
+}
+
+func TestRateLimitFilter(t *testing.T) {
+	var (
+		limiter = &keyRecorder{}
+		next    = net_http.HandlerFunc(func(w net_http.ResponseWriter, _ *net_http.Request) {
+			w.WriteHeader(net_http.StatusNoContent)
+		})
+		handler = RateLimitFilter(limiter, nil, WithRateLimitSkipPaths("/ping"))(next)
+	)
+
+	req := httptest.NewRequest(net_http.MethodGet, "/x", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set(HeaderXForwardedFor, "1.2.3.4, 10.0.0.2")
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	if rw.Code != net_http.StatusTooManyRequests || rw.Header().Get(HeaderRetryAfter) != "1" {
+		t.Errorf("denied = %d, Retry-After %q", rw.Code, rw.Header().Get(HeaderRetryAfter))
+	}
+
+	req.Header.Del(HeaderXForwardedFor)
+	limiter.allow = true
+
+	rw = httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	if rw.Code != net_http.StatusNoContent {
+		t.Errorf("allowed = %d, want %d", rw.Code, net_http.StatusNoContent)
+	}
+
+	limiter.allow = false
+
+	rw = httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(net_http.MethodGet, "/ping", nil))
+
+	if rw.Code != net_http.StatusNoContent {
+		t.Errorf("skipped path = %d, want %d", rw.Code, net_http.StatusNoContent)
+	}
+
+	want := []rate.Key{"1.2.3.4", "10.0.0.1"}
+	if len(limiter.keys) != len(want) {
+		t.Fatalf("keys = %v, want %v", limiter.keys, want)
+	}
+
+	for i := range want {
+		if limiter.keys[i] != want[i] {
+			t.Errorf("key #%d = %q, want %q", i, limiter.keys[i], want[i])
+		}
+	}
+}
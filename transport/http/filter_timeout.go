@@ -0,0 +1,239 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// ErrInvalidRequestTimeout is returned by WithRequestTimeout for a timeout
+// which isn't positive
+var ErrInvalidRequestTimeout = errors.New("request timeout must be positive")
+
+type (
+	// TimeoutOption customises the response served when a request times
+	// out, see WithRequestTimeout & HandlerWithTimeout
+	TimeoutOption func(*requestTimeout)
+
+	requestTimeout struct {
+		timeout     time.Duration
+		status      int
+		contentType string
+		body        []byte
+	}
+
+	// timeoutWriter buffers the response of the handler, it is copied to
+	// the client once the handler returns in time. The handler & the
+	// timeout race on the lock, only one of them writes the response
+	timeoutWriter struct {
+		header http.Header
+		buf    bytes.Buffer
+
+		mu          sync.Mutex
+		timedOut    bool
+		wroteHeader bool
+		code        int
+	}
+)
+
+// WithTimeoutStatus sets the status of the response served on timeout.
+// Defaults to 503 Service Unavailable
+func WithTimeoutStatus(code int) TimeoutOption {
+	return func(rt *requestTimeout) { rt.status = code }
+}
+
+// WithTimeoutBody sets the body of the response served on timeout.
+// Defaults to a JSON error with the status
+func WithTimeoutBody(contentType string, body []byte) TimeoutOption {
+	return func(rt *requestTimeout) {
+		rt.contentType = contentType
+		rt.body = body
+	}
+}
+
+// WithRequestTimeout bounds every request by d, see HandlerWithTimeout.
+// It applies after the filters of WithFilters, so their access logs &
+// metrics see the response served on timeout. Routes can have a shorter
+// timeout of their own with HandlerWithTimeout
+func WithRequestTimeout(d time.Duration, options ...TimeoutOption) TransportConfigOption {
+	return func(c *config) error {
+		if d <= 0 {
+			return ErrInvalidRequestTimeout
+		}
+
+		c.requestTimeout = newRequestTimeout(d, options...)
+		return nil
+	}
+}
+
+// HandlerWithTimeout bounds the requests of the route by d. The context
+// of the request is cancelled after d & a 503 is served, unless the
+// handler returned by then. The response of the handler is buffered until
+// it returns, as with http.TimeoutHandler, writes after the timeout fail
+// with http.ErrHandlerTimeout. Event streams & websockets aren't bounded.
+// Requests served on timeout are logged with `timed_out` by
+// AccessLogFilter & tagged with it by CustomMetricsFilter, see
+// TimedOutFromContext. Zero or less doesn't bound the requests
+func HandlerWithTimeout(d time.Duration, options ...TimeoutOption) HandlerOption {
+	return func(h *handler) {
+		if d <= 0 {
+			h.timeout = nil
+			return
+		}
+
+		h.timeout = newRequestTimeout(d, options...)
+	}
+}
+
+// TimeoutFilter bounds the requests by d, as HandlerWithTimeout does, for
+// the filters of WithFilters or of a handler. The context passed
+// downstream carries the deadline, decoders & endpoints can give up on
+// it. Event streams & websockets aren't bounded. Zero or less doesn't
+// bound the requests
+func TimeoutFilter(d time.Duration, options ...TimeoutOption) Filter {
+	if d <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	return newRequestTimeout(d, options...).filter()
+}
+
+// TimedOutFromContext tells if the request of cx was served on timeout,
+// see HandlerWithTimeout
+func TimedOutFromContext(cx context.Context) bool {
+	to, ok := cx.Value(ContextKeyRequestTimedOut).(*atomic.Bool)
+	return ok && to.Load()
+}
+
+func newRequestTimeout(d time.Duration, options ...TimeoutOption) *requestTimeout {
+	rt := &requestTimeout{
+		timeout:     d,
+		status:      http.StatusServiceUnavailable,
+		contentType: "application/json; charset=utf-8",
+	}
+
+	for _, o := range options {
+		o(rt)
+	}
+
+	if rt.body == nil {
+		rt.body = []byte(`{"code":` + strconv.Itoa(rt.status) + `,"error":"request timed out"}` + "\n")
+	}
+
+	return rt
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) Write(bt []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !tw.wroteHeader {
+		tw.wroteHeader, tw.code = true, http.StatusOK
+	}
+
+	return tw.buf.Write(bt)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+
+	tw.wroteHeader, tw.code = true, code
+}
+
+// flush copies the response of the handler to w
+func (tw *timeoutWriter) flush(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	dst := w.Header()
+	for k, vv := range tw.header {
+		dst[k] = vv
+	}
+
+	if !tw.wroteHeader {
+		tw.code = http.StatusOK
+	}
+
+	w.WriteHeader(tw.code)
+	_, _ = w.Write(tw.buf.Bytes())
+}
+
+func (rt *requestTimeout) filter() Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreaming(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			to, ok := r.Context().Value(ContextKeyRequestTimedOut).(*atomic.Bool)
+			if !ok {
+				to = &atomic.Bool{}
+				r = r.WithContext(context.WithValue(r.Context(), ContextKeyRequestTimedOut, to))
+			}
+
+			cx, cancel := context.WithTimeout(r.Context(), rt.timeout)
+			defer cancel()
+
+			var (
+				tw       = &timeoutWriter{header: make(http.Header)}
+				done     = make(chan struct{})
+				panicked = make(chan interface{}, 1)
+			)
+
+			go func() {
+				defer func() {
+					// re-panicked by the request goroutine, dropped
+					// once the request timed out
+					if p := recover(); p != nil {
+						panicked <- p
+						return
+					}
+					close(done)
+				}()
+
+				next.ServeHTTP(tw, r.WithContext(cx))
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.flush(w)
+			case <-cx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				tw.timedOut = true
+
+				// the client went away, there is no one to answer
+				if cx.Err() != context.DeadlineExceeded {
+					return
+				}
+
+				to.Store(true)
+
+				w.Header().Set(HeaderContentType, rt.contentType)
+				w.WriteHeader(rt.status)
+				_, _ = w.Write(rt.body)
+			}
+		})
+	}
+}
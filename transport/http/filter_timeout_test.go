@@ -0,0 +1,166 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	var (
+		cancelled = make(chan error, 1)
+		timedOut  = make(chan bool, 1)
+	)
+
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithRequestTimeout(200*time.Millisecond),
+		WithFilters(func(next net_http.Handler) net_http.Handler {
+			return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+				next.ServeHTTP(w, r)
+				timedOut <- TimedOutFromContext(r.Context())
+			})
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Get("/fast", func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		return NewResponse(req, ResponseWithBytes([]byte("ok"))), nil
+	})
+	tr.Get("/slow", func(cx context.Context, req *net_http.Request) (*net_http.Response, error) {
+		<-cx.Done()
+		cancelled <- cx.Err()
+		return NewResponse(req, ResponseWithBytes([]byte("late"))), nil
+	})
+	tr.Get("/stream", func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		time.Sleep(300 * time.Millisecond)
+		return NewResponse(req, ResponseWithBytes([]byte("streamed"))), nil
+	})
+
+	serve := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(net_http.MethodGet, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		rec := httptest.NewRecorder()
+		tr.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/fast")
+	if rec.Code != net_http.StatusOK || rec.Body.String() != "ok" || <-timedOut {
+		t.Errorf("/fast = %d %q, want 200 ok", rec.Code, rec.Body)
+	}
+
+	rec = serve("/slow")
+	if rec.Code != net_http.StatusServiceUnavailable || rec.Body.String() != `{"code":503,"error":"request timed out"}`+"\n" {
+		t.Errorf("/slow = %d %q, want 503 with a JSON error", rec.Code, rec.Body)
+	}
+	if !<-timedOut {
+		t.Error("TimedOutFromContext() = false for /slow, want true")
+	}
+	if err := <-cancelled; err != context.DeadlineExceeded {
+		t.Errorf("context of /slow = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	rec = serve("/stream", HeaderAccept, MIMEEventStream)
+	if rec.Code != net_http.StatusOK || rec.Body.String() != "streamed" || <-timedOut {
+		t.Errorf("/stream = %d %q, want 200 streamed", rec.Code, rec.Body)
+	}
+}
+
+func TestHandlerWithTimeout(t *testing.T) {
+	// without a transport timeout, which could fire first under load
+	tr, err := NewHTTPTransport("test", WithCustomLogger(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Get("/route", func(cx context.Context, req *net_http.Request) (*net_http.Response, error) {
+		<-cx.Done()
+		return NewResponse(req, ResponseWithBytes([]byte("late"))), nil
+	}, HandlerWithTimeout(
+		10*time.Millisecond,
+		WithTimeoutStatus(net_http.StatusGatewayTimeout),
+		WithTimeoutBody("text/plain", []byte("too slow")),
+	))
+
+	rec := httptest.NewRecorder()
+	tr.Handler.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, "/route", nil))
+
+	if rec.Code != net_http.StatusGatewayTimeout || rec.Body.String() != "too slow" ||
+		rec.Header().Get(HeaderContentType) != "text/plain" {
+		t.Errorf("/route = %d %q, want 504 too slow", rec.Code, rec.Body)
+	}
+}
+
+func TestWithRequestTimeout_invalid(t *testing.T) {
+	_, err := NewHTTPTransport("test", WithRequestTimeout(0))
+	if err != ErrInvalidRequestTimeout {
+		t.Errorf("NewHTTPTransport() error = %v, want %v", err, ErrInvalidRequestTimeout)
+	}
+}
+
+func TestTimeoutFilter(t *testing.T) {
+	var (
+		// answers once the filter times the request out
+		blocked = net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			if _, ok := r.Context().Deadline(); !ok {
+				t.Error("context without deadline, want the one of the filter")
+			}
+			<-r.Context().Done()
+		})
+
+		quick = net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			if _, ok := r.Context().Deadline(); !ok {
+				t.Error("context without deadline, want the one of the filter")
+			}
+			_, _ = w.Write([]byte("done"))
+		})
+
+		// outlives the timeout, which isn't applied
+		stream = net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			if _, ok := r.Context().Deadline(); ok {
+				t.Error("context with a deadline, want none for an event stream")
+			}
+			time.Sleep(50 * time.Millisecond)
+			_, _ = w.Write([]byte("done"))
+		})
+	)
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		handler net_http.Handler
+		accept  string
+		want    int
+	}{
+		{"timed out", TimeoutFilter(20*time.Millisecond, WithTimeoutStatus(net_http.StatusGatewayTimeout)), blocked, "", net_http.StatusGatewayTimeout},
+		{"in time", TimeoutFilter(5 * time.Second), quick, "", net_http.StatusOK},
+		{"event stream", TimeoutFilter(20 * time.Millisecond), stream, MIMEEventStream, net_http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(net_http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set(HeaderAccept, tt.accept)
+			}
+
+			rec := httptest.NewRecorder()
+			chain(tt.handler, tt.filter).ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d %q, want %d", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+}
@@ -61,6 +61,14 @@ func TraceLoggingFilter(logger log.Logger, fieldGenerators ...TraceLogFieldsGen)
 
 				fields = append(fields, log.Int("status", ww.Status()))
 
+				if ip := ClientIPFromContext(ctx); ip != "" {
+					fields = append(fields, log.String("req.client_ip", ip))
+				}
+
+				if cl := ClassFromContext(ctx); cl != ClassUnknown {
+					fields = append(fields, log.String("req.class", string(cl)))
+				}
+
 				for _, fg := range fieldGenerators {
 					fields = append(fields, fg(ww, r)...)
 				}
@@ -0,0 +1,504 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/unbxd/go-base/v2/endpoint"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/metrics"
+)
+
+const (
+	slowRequestCapturedMetric = "slow_request_captured"
+
+	defaultSlowRequestCapturesPerMinute = 10
+
+	// pprof label set on the goroutines serving a request, to find their
+	// stacks in the goroutine profile
+	watchdogLabel = "http.watchdog"
+
+	watchdogSlots   = 512
+	watchdogMinTick = time.Millisecond
+	watchdogMaxTick = 100 * time.Millisecond
+)
+
+// ErrInvalidSlowRequestThreshold is returned for a watchdog threshold which
+// isn't positive
+var ErrInvalidSlowRequestThreshold = errors.New("slow request threshold must be positive")
+
+// CaptureMode is what the slow request watchdog captures
+type CaptureMode int
+
+// CaptureModes
+const (
+	// CaptureOff disables the watchdog
+	CaptureOff CaptureMode = iota
+	// CaptureStack captures the stacks of the goroutines serving the request
+	CaptureStack
+	// CaptureStackAndCalls captures the downstream calls in progress as
+	// well, see StartDownstreamCall
+	CaptureStackAndCalls
+)
+
+// stages of a request
+const (
+	stageFilters int32 = iota
+	stageDecode
+	stageEndpoint
+	stageEncode
+)
+
+var stageNames = [...]string{"filters", "decode", "endpoint", "encode"}
+
+// states of a watched request
+const (
+	watchRunning int32 = iota
+	watchDone
+	watchCaptured
+)
+
+type (
+	// SlowRequest is what the watchdog captured of a request still running
+	// past its threshold. Route is empty until the request reaches its
+	// handler, Calls are only captured with CaptureStackAndCalls
+	SlowRequest struct {
+		RequestID string
+		Method    string
+		Path      string
+		Route     string
+		Stage     string
+		Elapsed   time.Duration
+		Threshold time.Duration
+		Calls     []string
+		Stack     string
+	}
+
+	// WatchdogOption customises the slow request watchdog
+	WatchdogOption func(*watchdog)
+
+	watchdogContextKey struct{}
+
+	// watchdog is a timer wheel of the requests in flight, a single
+	// goroutine advances it & captures the requests which are due
+	watchdog struct {
+		logger    log.Logger
+		threshold time.Duration
+		mode      CaptureMode
+		perMinute int
+		counter   metrics.Counter
+		fn        func(SlowRequest)
+
+		tick   time.Duration
+		origin time.Time
+		seq    uint64
+
+		mu    sync.Mutex
+		slots [][]*watchEntry
+		cur   int64
+
+		// owned by the goroutine of the wheel
+		window   time.Time
+		captures int
+
+		stop chan struct{}
+		once sync.Once
+	}
+
+	watchEntry struct {
+		wd        *watchdog
+		label     string
+		requestID string
+		method    string
+		path      string
+		start     time.Time
+
+		// tick it is due at, guarded by the lock of the wheel
+		at int64
+
+		state     int32
+		stage     int32
+		threshold int64
+
+		mu    sync.Mutex
+		route string
+		calls map[uint64]string
+		next  uint64
+	}
+)
+
+// WithSlowRequestCaptureLimit caps the captures to n per minute across
+// all the routes, defaults to 10. Zero or less lifts the cap
+func WithSlowRequestCaptureLimit(n int) WatchdogOption {
+	return func(wd *watchdog) { wd.perMinute = n }
+}
+
+// WithSlowRequestMetrics counts the captures as `slow_request_captured`
+// tagged with the route
+func WithSlowRequestMetrics(provider metrics.Provider) WatchdogOption {
+	return func(wd *watchdog) {
+		wd.counter = provider.NewCounter(slowRequestCapturedMetric, 1)
+	}
+}
+
+// WithSlowRequestHandler calls fn with each capture, after it is logged
+func WithSlowRequestHandler(fn func(SlowRequest)) WatchdogOption {
+	return func(wd *watchdog) { wd.fn = fn }
+}
+
+// WithSlowRequestWatchdog captures the requests still running past the
+// threshold, once per request: the stacks of the goroutines serving it,
+// the stage it is in (decode, endpoint or encode) and, with
+// CaptureStackAndCalls, the downstream calls in progress. Captures are
+// logged as warnings with the request id.
+//
+// Requests are kept in a timer wheel advanced by a single goroutine, a
+// request which completes in time costs an insert in the wheel, nothing
+// is captured. Captures fire up to threshold/8 (100ms at most) late. The
+// goroutines serving a request carry a pprof label to find their stacks,
+// capturing dumps the goroutine profile, which is why the captures are
+// rate limited, see WithSlowRequestCaptureLimit.
+// Routes can override the threshold, see HandlerWithSlowRequestThreshold
+func WithSlowRequestWatchdog(
+	threshold time.Duration,
+	mode CaptureMode,
+	options ...WatchdogOption,
+) TransportConfigOption {
+	return func(c *config) error {
+		if mode == CaptureOff {
+			return nil
+		}
+
+		if threshold <= 0 {
+			return ErrInvalidSlowRequestThreshold
+		}
+
+		c.watchdogThreshold = threshold
+		c.watchdogMode = mode
+		c.watchdogOptions = options
+
+		c.transportOptions = append(c.transportOptions, WithHandlerOption(
+			func(h *handler) { h.watched = true },
+		))
+		return nil
+	}
+}
+
+// HandlerWithSlowRequestThreshold overrides the threshold of the slow
+// request watchdog for the route, see WithSlowRequestWatchdog
+func HandlerWithSlowRequestThreshold(d time.Duration) HandlerOption {
+	return func(h *handler) { h.slowThreshold = d }
+}
+
+// StartDownstreamCall records a call to a downstream, e.g. `GET search`,
+// as in progress for the request of cx until the returned func is called.
+// The calls in progress are captured by the watchdog with
+// CaptureStackAndCalls, it is a noop outside of a watched request
+func StartDownstreamCall(cx context.Context, name string) func() {
+	en, ok := cx.Value(watchdogContextKey{}).(*watchEntry)
+	if !ok {
+		return func() {}
+	}
+
+	en.mu.Lock()
+	if en.calls == nil {
+		en.calls = make(map[uint64]string)
+	}
+	en.next++
+	id := en.next
+	en.calls[id] = name
+	en.mu.Unlock()
+
+	return func() {
+		en.mu.Lock()
+		delete(en.calls, id)
+		en.mu.Unlock()
+	}
+}
+
+func newWatchdog(
+	logger log.Logger,
+	threshold time.Duration,
+	mode CaptureMode,
+	options ...WatchdogOption,
+) *watchdog {
+	tick := threshold / 8
+	switch {
+	case tick < watchdogMinTick:
+		tick = watchdogMinTick
+	case tick > watchdogMaxTick:
+		tick = watchdogMaxTick
+	}
+
+	wd := &watchdog{
+		logger:    logger,
+		threshold: threshold,
+		mode:      mode,
+		perMinute: defaultSlowRequestCapturesPerMinute,
+		tick:      tick,
+		origin:    time.Now(),
+		slots:     make([][]*watchEntry, watchdogSlots),
+		stop:      make(chan struct{}),
+	}
+
+	for _, o := range options {
+		o(wd)
+	}
+
+	go wd.run()
+	return wd
+}
+
+func (wd *watchdog) run() {
+	ticker := time.NewTicker(wd.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			wd.advance(now)
+		case <-wd.stop:
+			return
+		}
+	}
+}
+
+func (wd *watchdog) close() {
+	wd.once.Do(func() { close(wd.stop) })
+}
+
+// schedule puts the entry in the wheel at its deadline, a rescheduled
+// entry leaves a stale copy behind which is dropped when reached
+func (wd *watchdog) schedule(en *watchEntry, deadline time.Time) {
+	atomic.StoreInt64(&en.threshold, int64(deadline.Sub(en.start)))
+	at := int64((deadline.Sub(wd.origin) + wd.tick - 1) / wd.tick)
+
+	wd.mu.Lock()
+	if at <= wd.cur {
+		at = wd.cur + 1
+	}
+	en.at = at
+	slot := at % watchdogSlots
+	wd.slots[slot] = append(wd.slots[slot], en)
+	wd.mu.Unlock()
+}
+
+// advance moves the wheel up to now & captures the entries due
+func (wd *watchdog) advance(now time.Time) {
+	var (
+		target = int64(now.Sub(wd.origin) / wd.tick)
+		due    []*watchEntry
+	)
+
+	wd.mu.Lock()
+	for wd.cur < target {
+		wd.cur++
+
+		slot := wd.slots[wd.cur%watchdogSlots]
+		kept := slot[:0]
+		for _, en := range slot {
+			switch {
+			case atomic.LoadInt32(&en.state) != watchRunning, en.at < wd.cur:
+			case en.at == wd.cur:
+				due = append(due, en)
+			default:
+				// a later round
+				kept = append(kept, en)
+			}
+		}
+
+		for i := len(kept); i < len(slot); i++ {
+			slot[i] = nil
+		}
+		wd.slots[wd.cur%watchdogSlots] = kept
+	}
+	wd.mu.Unlock()
+
+	for _, en := range due {
+		wd.capture(en, now)
+	}
+}
+
+// allow rate limits the captures, only called by the wheel goroutine
+func (wd *watchdog) allow(now time.Time) bool {
+	if wd.perMinute <= 0 {
+		return true
+	}
+
+	if now.Sub(wd.window) >= time.Minute {
+		wd.window, wd.captures = now, 0
+	}
+
+	if wd.captures >= wd.perMinute {
+		return false
+	}
+	wd.captures++
+	return true
+}
+
+func (wd *watchdog) capture(en *watchEntry, now time.Time) {
+	if !atomic.CompareAndSwapInt32(&en.state, watchRunning, watchCaptured) {
+		return
+	}
+
+	if !wd.allow(now) {
+		return
+	}
+
+	sr := SlowRequest{
+		RequestID: en.requestID,
+		Method:    en.method,
+		Path:      en.path,
+		Stage:     stageNames[atomic.LoadInt32(&en.stage)],
+		Elapsed:   now.Sub(en.start),
+		Threshold: time.Duration(atomic.LoadInt64(&en.threshold)),
+	}
+
+	en.mu.Lock()
+	sr.Route = en.route
+	if wd.mode == CaptureStackAndCalls {
+		for _, call := range en.calls {
+			sr.Calls = append(sr.Calls, call)
+		}
+	}
+	en.mu.Unlock()
+
+	sr.Stack = labelledStacks(watchdogLabel, en.label)
+
+	wd.logger.Warn(
+		"slow request",
+		log.String("request_id", sr.RequestID),
+		log.String("method", sr.Method),
+		log.String("path", sr.Path),
+		log.String("route", sr.Route),
+		log.String("stage", sr.Stage),
+		log.Int64("elapsed_ms", sr.Elapsed.Milliseconds()),
+		log.Int64("threshold_ms", sr.Threshold.Milliseconds()),
+		log.String("calls", strings.Join(sr.Calls, ", ")),
+		log.String("stack", sr.Stack),
+	)
+
+	if wd.counter != nil {
+		route := sr.Route
+		if route == "" {
+			route = "unknown"
+		}
+		wd.counter.With("route", route).Add(1)
+	}
+
+	if wd.fn != nil {
+		wd.fn(sr)
+	}
+}
+
+// labelledStacks returns the stacks of the goroutines labelled key=value
+// from the goroutine profile
+func labelledStacks(key, value string) string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return ""
+	}
+
+	var (
+		label  = strconv.Quote(key) + ":" + strconv.Quote(value)
+		stacks []string
+	)
+
+	for _, block := range strings.Split(buf.String(), "\n\n") {
+		if strings.Contains(block, label) {
+			stacks = append(stacks, block)
+		}
+	}
+	return strings.Join(stacks, "\n\n")
+}
+
+// filter watches the request from the transport filters on, the
+// goroutine is labelled for the time of the request
+func (wd *watchdog) filter() Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			en := &watchEntry{
+				wd:        wd,
+				label:     strconv.FormatUint(atomic.AddUint64(&wd.seq, 1), 10),
+				requestID: r.Header.Get(HeaderRequestID),
+				method:    r.Method,
+				path:      r.URL.Path,
+				start:     time.Now(),
+			}
+			wd.schedule(en, en.start.Add(wd.threshold))
+
+			cx := pprof.WithLabels(
+				context.WithValue(r.Context(), watchdogContextKey{}, en),
+				pprof.Labels(watchdogLabel, en.label),
+			)
+			pprof.SetGoroutineLabels(cx)
+
+			defer func() {
+				atomic.StoreInt32(&en.state, watchDone)
+				pprof.SetGoroutineLabels(r.Context())
+			}()
+
+			next.ServeHTTP(w, r.WithContext(cx))
+		})
+	}
+}
+
+func setStage(cx context.Context, stage int32) {
+	if en, ok := cx.Value(watchdogContextKey{}).(*watchEntry); ok {
+		atomic.StoreInt32(&en.stage, stage)
+	}
+}
+
+// watchdogRouteFilter records the route of a watched request & applies
+// the threshold of the route
+func watchdogRouteFilter(hn *handler) Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			en, ok := r.Context().Value(watchdogContextKey{}).(*watchEntry)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			en.mu.Lock()
+			en.route = hn.desc.Path
+			en.mu.Unlock()
+
+			if hn.slowThreshold > 0 {
+				en.wd.schedule(en, en.start.Add(hn.slowThreshold))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// watchStages marks the stages of the request for the watchdog
+func (h *handler) watchStages(middlewares []Middleware) []Middleware {
+	decoder, encoder := h.decoder, h.encoder
+
+	h.decoder = func(cx context.Context, r *http.Request) (interface{}, error) {
+		setStage(cx, stageDecode)
+		return decoder(cx, r)
+	}
+
+	h.encoder = func(cx context.Context, w http.ResponseWriter, res interface{}) error {
+		setStage(cx, stageEncode)
+		return encoder(cx, w, res)
+	}
+
+	return append([]Middleware{func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(cx context.Context, req interface{}) (interface{}, error) {
+			setStage(cx, stageEndpoint)
+			return next(cx, req)
+		}
+	}}, middlewares...)
+}
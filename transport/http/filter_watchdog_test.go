@@ -0,0 +1,189 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func newWatchedTransport(
+	t testing.TB,
+	threshold time.Duration,
+	options ...WatchdogOption,
+) (*Transport, chan SlowRequest) {
+	captures := make(chan SlowRequest, 16)
+
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithSlowRequestWatchdog(threshold, CaptureStackAndCalls, append(
+			[]WatchdogOption{WithSlowRequestHandler(func(sr SlowRequest) { captures <- sr })},
+			options...,
+		)...),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+	t.Cleanup(tr.watchdog.close)
+
+	return tr, captures
+}
+
+func okResponse() (*net_http.Response, error) {
+	return &net_http.Response{StatusCode: net_http.StatusOK, Body: net_http.NoBody}, nil
+}
+
+func blockedInDownstream(release chan struct{}) HandlerFunc {
+	return func(cx context.Context, _ *net_http.Request) (*net_http.Response, error) {
+		done := StartDownstreamCall(cx, "GET search")
+		defer done()
+
+		<-release
+		return okResponse()
+	}
+}
+
+func serve(tr *Transport, path, requestID string) {
+	req := httptest.NewRequest(net_http.MethodGet, path, nil)
+	req.Header.Set(HeaderRequestID, requestID)
+	tr.Handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestWithSlowRequestWatchdog(t *testing.T) {
+	tr, captures := newWatchedTransport(t, 20*time.Millisecond)
+
+	release := make(chan struct{})
+	tr.Get("/slow/{id}", blockedInDownstream(release))
+	tr.Get("/fast", func(context.Context, *net_http.Request) (*net_http.Response, error) {
+		return okResponse()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		serve(tr, "/slow/42", "r1")
+		close(done)
+	}()
+
+	var sr SlowRequest
+	select {
+	case sr = <-captures:
+	case <-time.After(2 * time.Second):
+		t.Fatal("slow request wasn't captured")
+	}
+
+	if sr.RequestID != "r1" || sr.Route != "/slow/{id}" || sr.Path != "/slow/42" || sr.Stage != "endpoint" {
+		t.Errorf("capture = %+v, want r1 on /slow/{id} in the endpoint", sr)
+	}
+
+	if sr.Elapsed < 20*time.Millisecond || sr.Threshold != 20*time.Millisecond {
+		t.Errorf("elapsed = %v, threshold = %v, want past 20ms", sr.Elapsed, sr.Threshold)
+	}
+
+	if len(sr.Calls) != 1 || sr.Calls[0] != "GET search" {
+		t.Errorf("calls = %q, want [GET search]", sr.Calls)
+	}
+
+	if !strings.Contains(sr.Stack, "blockedInDownstream") {
+		t.Errorf("stack = %q, want the handler goroutine", sr.Stack)
+	}
+
+	// once, however long it keeps running
+	time.Sleep(60 * time.Millisecond)
+	close(release)
+	<-done
+
+	serve(tr, "/fast", "r2")
+	time.Sleep(60 * time.Millisecond)
+
+	select {
+	case sr := <-captures:
+		t.Errorf("captured %+v, want a single capture of r1", sr)
+	default:
+	}
+}
+
+func TestWithSlowRequestWatchdog_captureLimit(t *testing.T) {
+	tr, captures := newWatchedTransport(t, 10*time.Millisecond, WithSlowRequestCaptureLimit(2))
+
+	release := make(chan struct{})
+	tr.Get("/slow", blockedInDownstream(release))
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"r1", "r2", "r3", "r4"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			serve(tr, "/slow", id)
+		}(id)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-captures:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("captures = %d, want 2", i)
+		}
+	}
+
+	// the others time out, past the limit
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := len(captures); got != 0 {
+		t.Errorf("captures = %d past the limit, want none", got)
+	}
+}
+
+func TestHandlerWithSlowRequestThreshold(t *testing.T) {
+	tr, captures := newWatchedTransport(t, time.Hour)
+
+	release := make(chan struct{})
+	tr.Get("/slow", blockedInDownstream(release), HandlerWithSlowRequestThreshold(10*time.Millisecond))
+
+	done := make(chan struct{})
+	go func() {
+		serve(tr, "/slow", "r1")
+		close(done)
+	}()
+
+	select {
+	case sr := <-captures:
+		if sr.Threshold != 10*time.Millisecond {
+			t.Errorf("threshold = %v, want the route's 10ms", sr.Threshold)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("slow request wasn't captured with the route's threshold")
+	}
+
+	close(release)
+	<-done
+
+	if _, err := NewHTTPTransport("test", WithSlowRequestWatchdog(0, CaptureStack)); err != ErrInvalidSlowRequestThreshold {
+		t.Errorf("NewHTTPTransport() error = %v, want %v", err, ErrInvalidSlowRequestThreshold)
+	}
+}
+
+// requests completing just under the threshold, the cost of the wheel
+func BenchmarkWithSlowRequestWatchdog(b *testing.B) {
+	tr, _ := newWatchedTransport(b, 50*time.Millisecond)
+	tr.Get("/x", func(context.Context, *net_http.Request) (*net_http.Response, error) {
+		return okResponse()
+	})
+
+	req := httptest.NewRequest(net_http.MethodGet, "/x", nil)
+	req.Header.Set(HeaderRequestID, "r1")
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tr.Handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+}
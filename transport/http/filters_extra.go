@@ -1,8 +1,10 @@
 package http
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -165,6 +167,12 @@ func decorateContextFilter() Filter {
 			r *http.Request,
 		) {
 			ctx := decorateContext(r.Context(), r)
+
+			// placeholder for the class, set by ClassifyRequestsFilter
+			ctx = context.WithValue(ctx, ContextKeyRequestClass, &requestClass{})
+			// set when the request is served on timeout
+			ctx = context.WithValue(ctx, ContextKeyRequestTimedOut, &atomic.Bool{})
+
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -2,12 +2,16 @@ package http
 
 import (
 	net_http "net/http"
+	"time"
 
 	"context"
 
 	kit_endpoint "github.com/go-kit/kit/endpoint"
 	kit_http "github.com/go-kit/kit/transport/http"
+	"github.com/unbxd/go-base/v2/authz"
 	"github.com/unbxd/go-base/v2/endpoint"
+	"github.com/unbxd/go-base/v2/metrics"
+	"github.com/unbxd/go-base/v2/units"
 )
 
 type (
@@ -38,10 +42,41 @@ type (
 		errorhandler ErrorHandler
 		middlewares  []Middleware
 
+		// called when the encoder fails
+		encoderErrorHandler EncoderErrorHandler
+
+		// authorization policy, evaluated before middlewares
+		policy     authz.Policy
+		policyName string
+
+		deprecation *deprecation
+
+		// cheaper variants of the handler per request class
+		variants map[Class]net_http.Handler
+
+		// metrics provider for handler level metrics
+		metrics metrics.Provider
+
 		//handler level filter
 		filters []Filter
 
+		// caps the request body, zero or less doesn't
+		maxBodyBytes int64
+
+		// bounds the requests of the route, nil doesn't
+		timeout *requestTimeout
+
+		// checks of the request before its body is read
+		expectContinue []ExpectContinueHandler
+
+		// watched by the slow request watchdog & the threshold of the route
+		watched       bool
+		slowThreshold time.Duration
+
 		options []kit_http.ServerOption
+
+		// what the options resolved to, see RouteDetails
+		desc RouteDescriptor
 	}
 
 	// HandlerOption provides ways to modify the handler
@@ -50,7 +85,9 @@ type (
 
 // HandlerWithBeforeFunc returns a request handler with customer before function
 func HandlerWithBeforeFunc(fn BeforeFunc) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
+		h.desc.Befores = append(h.desc.Befores, c)
 		h.befores = append(h.befores, fn)
 		h.options = append(h.options, kit_http.ServerBefore(kit_http.RequestFunc(fn)))
 	}
@@ -58,7 +95,9 @@ func HandlerWithBeforeFunc(fn BeforeFunc) HandlerOption {
 
 // HandlerWithAfterFunc returns a request handler with customer after function
 func HandlerWithAfterFunc(fn AfterFunc) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
+		h.desc.Afters = append(h.desc.Afters, c)
 		h.afters = append(h.afters, fn)
 		h.options = append(h.options, kit_http.ServerAfter(kit_http.ServerResponseFunc(fn)))
 	}
@@ -66,18 +105,22 @@ func HandlerWithAfterFunc(fn AfterFunc) HandlerOption {
 
 // HandlerWithEncoder returns a request handler with customer encoder function
 func HandlerWithEncoder(fn Encoder) HandlerOption {
-	return func(h *handler) { h.encoder = fn }
+	c := component(fn)
+	return func(h *handler) { h.setEncoder(fn, c) }
 }
 
 // HandlerWithDecoder returns a request handler with a customer decoer function
 func HandlerWithDecoder(fn Decoder) HandlerOption {
-	return func(h *handler) { h.decoder = fn }
+	c := component(fn)
+	return func(h *handler) { h.setDecoder(fn, c) }
 }
 
 // HandlerWithErrorEncoder returns a request handler with a customer error
 // encoder function
 func HandlerWithErrorEncoder(fn ErrorEncoder) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
+		h.desc.ErrorEncoder = c
 		h.errorEncoder = fn
 		h.options = append(h.options, kit_http.ServerErrorEncoder(
 			kit_http.ErrorEncoder(fn),
@@ -95,7 +138,9 @@ func HandlerWithErrorhandler(fn ErrorHandler) HandlerOption {
 
 // HandlerWithMiddleware sets middleware for request
 func HandlerWithMiddleware(fn Middleware) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
+		h.desc.Middlewares = append(h.desc.Middlewares, c)
 		h.middlewares = append(h.middlewares, fn)
 	}
 }
@@ -103,18 +148,30 @@ func HandlerWithMiddleware(fn Middleware) HandlerOption {
 // HandlerWithEndpointMiddleware provides an ability to add a
 // middleware of the base type
 func HandlerWithEndpointMiddleware(fn endpoint.Middleware) HandlerOption {
+	c := component(fn)
 	return func(h *handler) {
+		h.desc.Middlewares = append(h.desc.Middlewares, c)
 		h.middlewares = append(h.middlewares, Middleware(fn))
 	}
 }
 
 // HandlerWithFilter provides an ability to add a
 func HandlerWithFilter(f Filter) HandlerOption {
+	c := component(f)
 	return func(h *handler) {
+		h.desc.Filters = append(h.desc.Filters, c)
 		h.filters = append(h.filters, f)
 	}
 }
 
+// HandlerWithETag sets ETags on the responses of the handler and answers
+// conditional GETs with 304 Not Modified, see ETagFilter
+func HandlerWithETag() HandlerOption {
+	return func(h *handler) {
+		h.filters = append(h.filters, ETagFilter())
+	}
+}
+
 // NoopMiddleware is middleware that does nothing
 // It is returned if a given middleware is not enabled
 func NoopMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
@@ -164,23 +221,82 @@ func newHandler(fn Handler, options ...HandlerOption) *handler {
 	if hn.encoder == nil {
 		// Todo: throw a warn
 		hn.encoder = newDefaultEncoder()
+		hn.desc.Encoder = Component{Name: "default"}
 	}
 
 	if hn.decoder == nil {
 		// Todo: throw a warn
 		hn.decoder = newDefaultDecoder()
+		hn.desc.Decoder = Component{Name: "default"}
+	}
+
+	if hn.errorEncoder == nil {
+		hn.desc.ErrorEncoder = Component{Name: funcName(kit_http.DefaultErrorEncoder)}
+	}
+
+	if hn.encoderErrorHandler != nil {
+		hn.encoder = guardEncoder(hn.encoder, hn.encoderErrorHandler)
+	}
+
+	middlewares := hn.middlewares
+	if hn.policy != nil {
+		hn.options = append(hn.options, kit_http.ServerBefore(policyDecisionBefore))
+		middlewares = append(
+			[]Middleware{policyMiddleware(hn.policyName, hn.policy)},
+			middlewares...,
+		)
+	}
+
+	if hn.watched {
+		middlewares = hn.watchStages(middlewares)
+	}
+
+	if hn.maxBodyBytes > 0 {
+		hn.decoder = maxBodyBytesDecoder(hn.decoder)
 	}
 
 	var handler net_http.Handler
 	handler = kit_http.NewServer(
 		kit_endpoint.Endpoint(
-			wrap(fn, hn.middlewares...),
+			wrap(fn, middlewares...),
 		),
 		kit_http.DecodeRequestFunc(hn.decoder),
 		kit_http.EncodeResponseFunc(hn.encoder),
 		hn.options...,
 	)
 
+	if hn.timeout != nil {
+		hn.filters = append(hn.filters, hn.timeout.filter())
+		hn.desc.Timeout = units.FormatDuration(hn.timeout.timeout)
+	}
+
+	if hn.maxBodyBytes > 0 {
+		hn.filters = append(hn.filters, maxBodyBytesFilter(hn.maxBodyBytes, hn.errorEncoder))
+		hn.desc.MaxBodyBytes = units.FormatBytes(hn.maxBodyBytes)
+	}
+
+	if hn.deprecation != nil {
+		hn.filters = append(hn.filters, deprecationFilter(hn.deprecation, hn.metrics))
+	}
+
+	if hn.variants != nil {
+		hn.filters = append(hn.filters, classVariantFilter(hn.variants))
+	}
+
+	if len(hn.expectContinue) > 0 {
+		hn.filters = append(hn.filters, expectContinueFilter(hn.expectContinue, hn.errorEncoder))
+	}
+
+	if hn.encoderErrorHandler != nil {
+		// innermost, the encoder must see the writer it wraps
+		hn.filters = append(hn.filters, headerWrittenFilter())
+	}
+
+	if hn.watched {
+		// outermost, for the route to be known as early as possible
+		hn.filters = append([]Filter{watchdogRouteFilter(hn)}, hn.filters...)
+	}
+
 	if hn.filters != nil {
 		handler = chain(handler, hn.filters...)
 	}
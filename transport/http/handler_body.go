@@ -0,0 +1,76 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+
+	kit_http "github.com/go-kit/kit/transport/http"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// WithMaxBodyBytes caps the request bodies of all the handlers of the
+// transport, see HandlerWithMaxBodyBytes. Handlers can override it
+func WithMaxBodyBytes(n int64) TransportOption {
+	return func(tr *Transport) {
+		tr.handlerOptions = append(
+			tr.handlerOptions, HandlerWithMaxBodyBytes(n),
+		)
+	}
+}
+
+// HandlerWithMaxBodyBytes caps the request body of the handler to n bytes.
+// Requests announcing a bigger Content-Length are answered with 413
+// before the decoder runs, other bodies are cut at n bytes as they are
+// read, so the decoder never allocates past the cap. Both fail with a
+// *DecodeError (DecodeReasonTooLarge) through the error encoder of the
+// handler. Zero or less lifts the cap
+func HandlerWithMaxBodyBytes(n int64) HandlerOption {
+	return func(h *handler) { h.maxBodyBytes = n }
+}
+
+func tooLargeError(err error) *DecodeError {
+	return &DecodeError{Err: err, Reason: DecodeReasonTooLarge}
+}
+
+// maxBodyBytesFilter cuts the body at n bytes
+func maxBodyBytesFilter(n int64, enc ErrorEncoder) Filter {
+	if enc == nil {
+		enc = ErrorEncoder(kit_http.DefaultErrorEncoder)
+	}
+
+	return func(next net_http.Handler) net_http.Handler {
+		return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			if r.ContentLength > n {
+				// the body isn't read, the connection can't be reused
+				w.Header().Set("Connection", "close")
+				enc(r.Context(), tooLargeError(&net_http.MaxBytesError{Limit: n}), w)
+				return
+			}
+
+			if r.Body != nil && r.Body != net_http.NoBody {
+				r.Body = net_http.MaxBytesReader(w, r.Body, n)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maxBodyBytesDecoder fails with DecodeReasonTooLarge when the decoder
+// read past the cap of maxBodyBytesFilter
+func maxBodyBytesDecoder(dec Decoder) Decoder {
+	return func(cx context.Context, r *net_http.Request) (interface{}, error) {
+		req, err := dec(cx, r)
+
+		var tooLarge *net_http.MaxBytesError
+		if err != nil && errors.As(err, &tooLarge) {
+			var de *DecodeError
+			if errors.As(err, &de) {
+				return nil, de
+			}
+			return nil, tooLargeError(err)
+		}
+
+		return req, err
+	}
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestHandlerWithMaxBodyBytes(t *testing.T) {
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithTransportOption(WithMaxBodyBytes(16)),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	echo := func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		bt, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		return NewResponse(req, ResponseWithBytes(bt)), nil
+	}
+	decoded := func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		return NewResponse(req, ResponseWithBytes([]byte("decoded"))), nil
+	}
+
+	tr.Post("/json", decoded, HandlerWithDecoder(func(cx context.Context, r *net_http.Request) (interface{}, error) {
+		if _, err := NewJSONDecoder[map[string]string]()(cx, r); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}))
+	tr.Post("/big", echo, HandlerWithMaxBodyBytes(64))
+
+	post := func(path, body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(net_http.MethodPost, path, strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+
+		rec := httptest.NewRecorder()
+		tr.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var (
+		small = `{"a":"b"}`
+		large = `{"a":"` + strings.Repeat("b", 32) + `"}`
+	)
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"under the cap", "/json", small, false, net_http.StatusOK},
+		{"content-length over the cap", "/json", large, false, net_http.StatusRequestEntityTooLarge},
+		{"chunked over the cap", "/json", large, true, net_http.StatusRequestEntityTooLarge},
+		{"handler override", "/big", large, true, net_http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(tt.path, tt.body, tt.chunked)
+			if rec.Code != tt.want {
+				t.Errorf("POST %s = %d %q, want %d", tt.path, rec.Code, rec.Body, tt.want)
+			}
+
+			if tt.want == net_http.StatusRequestEntityTooLarge && !strings.Contains(rec.Body.String(), DecodeReasonTooLarge) {
+				t.Errorf("POST %s body = %q, want the %s reason", tt.path, rec.Body, DecodeReasonTooLarge)
+			}
+		})
+	}
+}
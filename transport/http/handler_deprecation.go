@@ -0,0 +1,83 @@
+package http
+
+import (
+	net_http "net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unbxd/go-base/v2/metrics"
+)
+
+// Deprecation Headers
+const (
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+	HeaderLink        = "Link"
+)
+
+const deprecatedCallsMetric = "http.deprecated.calls"
+
+type deprecation struct {
+	sunset time.Time
+	link   string
+}
+
+func routePattern(r *net_http.Request) string {
+	rcx := chi.RouteContext(r.Context())
+	if rcx == nil {
+		return "not-chi"
+	}
+	return rcx.RoutePattern()
+}
+
+func deprecationFilter(dp *deprecation, provider metrics.Provider) Filter {
+	var counter metrics.Counter
+	if provider != nil {
+		counter = provider.NewCounter(deprecatedCallsMetric, 1)
+	}
+
+	return func(next net_http.Handler) net_http.Handler {
+		return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+			w.Header().Set(HeaderDeprecation, "true")
+
+			if !dp.sunset.IsZero() {
+				w.Header().Set(HeaderSunset, dp.sunset.UTC().Format(net_http.TimeFormat))
+			}
+
+			if dp.link != "" {
+				w.Header().Add(HeaderLink, "<"+dp.link+`>; rel="deprecation"`)
+			}
+
+			if counter != nil {
+				counter.With(
+					"method", r.Method,
+					"route", routePattern(r),
+				).Add(1)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HandlerWithDeprecation marks the route as deprecated. Responses carry the
+// `Deprecation` header, the `Sunset` header (RFC 8594) with the date after
+// which the route may be removed and a `Link` to the migration docs.
+// Calls are counted as `http.deprecated.calls` tagged with method & route,
+// if a metrics provider is set for the handler (see
+// HandlerWithMetricsProvider), to track the remaining usage.
+// Zero sunset or empty link skip the respective header.
+func HandlerWithDeprecation(sunset time.Time, link string) HandlerOption {
+	return func(h *handler) {
+		h.deprecation = &deprecation{sunset, link}
+	}
+}
+
+// HandlerWithMetricsProvider sets the metrics provider used by handler
+// level metrics, e.g. deprecated route calls. It is set for all the
+// handlers by WithCustomMetrics
+func HandlerWithMetricsProvider(provider metrics.Provider) HandlerOption {
+	return func(h *handler) {
+		h.metrics = provider
+	}
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerWithDeprecation(t *testing.T) {
+	var (
+		sunset         = time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		ok     Handler = func(context.Context, interface{}) (interface{}, error) {
+			return NewResponse(nil, ResponseWithBytes([]byte("ok"))), nil
+		}
+	)
+
+	rw := httptest.NewRecorder()
+	NewHandler(ok, HandlerWithDeprecation(sunset, "https://docs/migrate")).ServeHTTP(
+		rw, httptest.NewRequest(net_http.MethodGet, "/", nil),
+	)
+
+	for h, want := range map[string]string{
+		HeaderDeprecation: "true",
+		HeaderSunset:      "Wed, 02 Jan 2030 03:04:05 GMT",
+		HeaderLink:        `<https://docs/migrate>; rel="deprecation"`,
+	} {
+		if got := rw.Header().Get(h); got != want {
+			t.Errorf("header %s = %q, want %q", h, got, want)
+		}
+	}
+}
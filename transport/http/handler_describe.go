@@ -0,0 +1,180 @@
+package http
+
+import (
+	"fmt"
+	net_http "net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// ErrHandlerOptionConflict is the cause of the panic on registering a
+// route with conflicting options, see WithStrictHandlerOptions
+var ErrHandlerOptionConflict = errors.New("conflicting handler options")
+
+const pkgPath = "github.com/unbxd/go-base/v2/transport/http."
+
+type (
+	// Component is a part of the handler of a route, Name is the name of
+	// the func & Origin the file:line the option setting it was created at
+	Component struct {
+		Name   string `json:"name"`
+		Origin string `json:"origin,omitempty"`
+	}
+
+	// Conflict is a component set more than once for a route, the second
+	// one wins
+	Conflict struct {
+		Kind   string    `json:"kind"`
+		First  Component `json:"first"`
+		Second Component `json:"second"`
+	}
+
+	// RouteDescriptor is the resolved handler of a route, after the
+	// options of the transport & of the route are applied in order.
+	// Befores, Afters & Middlewares are in the order they run in
+	RouteDescriptor struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Name   string `json:"name,omitempty"`
+
+		Decoder      Component `json:"decoder"`
+		Encoder      Component `json:"encoder"`
+		ErrorEncoder Component `json:"error_encoder"`
+
+		Befores     []Component `json:"befores,omitempty"`
+		Afters      []Component `json:"afters,omitempty"`
+		Middlewares []Component `json:"middlewares,omitempty"`
+		Filters     []Component `json:"filters,omitempty"`
+
+		// the bounds of the requests of the route, e.g. "2s" & "1MiB",
+		// empty when unbounded
+		Timeout      string `json:"timeout,omitempty"`
+		MaxBodyBytes string `json:"max_body_bytes,omitempty"`
+
+		Conflicts []Conflict `json:"conflicts,omitempty"`
+	}
+)
+
+func (c Component) String() string {
+	if c.Origin == "" {
+		return c.Name
+	}
+	return c.Name + " (" + c.Origin + ")"
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s set twice, %s overrides %s", c.Kind, c.Second, c.First)
+}
+
+// funcName is the name of fn, e.g. `main.decodeProduct`
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return "<nil>"
+	}
+
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return "<unknown>"
+}
+
+// origin is the file:line of the first caller outside of this package,
+// i.e. where the user created the option
+func origin() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	for {
+		fr, more := frames.Next()
+		if !strings.HasPrefix(fr.Function, pkgPath) || strings.HasSuffix(fr.File, "_test.go") {
+			return fr.File + ":" + strconv.Itoa(fr.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// component describes fn with the origin of the option being created
+func component(fn interface{}) Component {
+	return Component{Name: funcName(fn), Origin: origin()}
+}
+
+func (h *handler) setDecoder(fn Decoder, c Component) {
+	if h.decoder != nil {
+		h.desc.Conflicts = append(h.desc.Conflicts, Conflict{"decoder", h.desc.Decoder, c})
+	}
+	h.decoder = fn
+	h.desc.Decoder = c
+}
+
+func (h *handler) setEncoder(fn Encoder, c Component) {
+	if h.encoder != nil {
+		h.desc.Conflicts = append(h.desc.Conflicts, Conflict{"encoder", h.desc.Encoder, c})
+	}
+	h.encoder = fn
+	h.desc.Encoder = c
+}
+
+// WithStrictHandlerOptions panics on registering a route with conflicting
+// options, e.g. two decoders, instead of logging a warning. Meant for
+// tests & dev, to catch a route silently using another encoder or decoder
+// than intended
+func WithStrictHandlerOptions() TransportOption {
+	return func(tr *Transport) { tr.strictHandlerOptions = true }
+}
+
+// register binds the handler to the route on the muxer & records its
+// descriptor
+func (tr *Transport) register(method, path string, hn *handler) {
+	hn.desc.Method, hn.desc.Path = method, path
+
+	if len(hn.desc.Conflicts) > 0 {
+		if tr.strictHandlerOptions {
+			panic(errors.Wrapf(
+				ErrHandlerOptionConflict, "%s %s: %s", method, path, hn.desc.Conflicts[0],
+			))
+		}
+
+		for _, c := range hn.desc.Conflicts {
+			tr.logger.Warn(
+				"conflicting handler options",
+				log.String("method", method),
+				log.String("path", path),
+				log.String("conflict", c.String()),
+			)
+		}
+	}
+
+	if tr.routes == nil {
+		tr.routes = make(map[string]*RouteDescriptor)
+	}
+	tr.routes[method+" "+path] = &hn.desc
+	tr.nameRoute(&hn.desc)
+
+	// the parameters are known once the muxer matched the route
+	h := urlParamsFilter(tr.muxer.URLParser())(hn)
+	tr.muxer.Handler(method, path, h)
+
+	if method == net_http.MethodGet && tr.autoHead {
+		if _, ok := tr.routes[net_http.MethodHead+" "+path]; !ok {
+			tr.muxer.Handler(net_http.MethodHead, path, headHandler(h))
+		}
+	}
+}
+
+// RouteDetails returns the descriptor of the handler registered for the
+// route, e.g. to find which encoder a route ended up with
+func (tr *Transport) RouteDetails(method, path string) (RouteDescriptor, bool) {
+	desc, ok := tr.routes[method+" "+path]
+	if !ok {
+		return RouteDescriptor{}, false
+	}
+	return *desc, true
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func describeDecoder(_ context.Context, r *net_http.Request) (interface{}, error) { return r, nil }
+
+func describeOtherDecoder(_ context.Context, r *net_http.Request) (interface{}, error) { return r, nil }
+
+func describeBefore(cx context.Context, _ *net_http.Request) context.Context { return cx }
+
+func describeHandler(_ context.Context, _ *net_http.Request) (*net_http.Response, error) {
+	return &net_http.Response{StatusCode: net_http.StatusOK, Body: net_http.NoBody}, nil
+}
+
+func TestRouteDetails(t *testing.T) {
+	tr, err := NewHTTPTransport(
+		"test",
+		WithHandlerOptionForTransport(
+			HandlerWithErrorEncoder(NewProblemJSONErrorEncoder()),
+			HandlerWithBeforeFunc(describeBefore),
+		),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Get(
+		"/products",
+		describeHandler,
+		HandlerWithDecoder(describeDecoder),
+		HandlerWithEncoder(NewDefaultJSONEncoder()),
+		HandlerWithMiddleware(NoopMiddleware),
+	)
+
+	desc, ok := tr.RouteDetails(net_http.MethodGet, "/products")
+	if !ok {
+		t.Fatal("RouteDetails() found no route")
+	}
+
+	tests := []struct {
+		name string
+		got  Component
+		want string
+	}{
+		{"decoder", desc.Decoder, "describeDecoder"},
+		{"encoder", desc.Encoder, "EncodeJSONResponse"},
+		{"error encoder", desc.ErrorEncoder, "NewProblemJSONErrorEncoder.func1"},
+		{"before", desc.Befores[0], "describeBefore"},
+		{"middleware", desc.Middlewares[0], "NoopMiddleware"},
+	}
+
+	for _, tt := range tests {
+		if !strings.HasSuffix(tt.got.Name, tt.want) {
+			t.Errorf("%s = %q, want %s", tt.name, tt.got.Name, tt.want)
+		}
+
+		// options created in this file, not where they are applied
+		if !strings.Contains(tt.got.Origin, "handler_describe_test.go:") {
+			t.Errorf("%s origin = %q, want this file", tt.name, tt.got.Origin)
+		}
+	}
+
+	if len(desc.Conflicts) != 0 {
+		t.Errorf("conflicts = %v, want none", desc.Conflicts)
+	}
+
+	if _, ok := tr.RouteDetails(net_http.MethodPost, "/products"); ok {
+		t.Errorf("RouteDetails() found an unregistered route")
+	}
+
+	// the bounds of the route are rendered by units
+	tr.Post("/products", describeHandler, HandlerWithTimeout(2*time.Second), HandlerWithMaxBodyBytes(1<<20))
+
+	bounded, _ := tr.RouteDetails(net_http.MethodPost, "/products")
+	if bounded.Timeout != "2s" || bounded.MaxBodyBytes != "1MiB" || desc.Timeout != "" || desc.MaxBodyBytes != "" {
+		t.Errorf("bounds = %q, %q, want 2s & 1MiB, unbounded %q, %q", bounded.Timeout, bounded.MaxBodyBytes, desc.Timeout, desc.MaxBodyBytes)
+	}
+}
+
+func TestRouteDetailsConflict(t *testing.T) {
+	logger := &warnLogger{Logger: log.NewNoopLogger()}
+
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(logger),
+		WithHandlerOptionForTransport(HandlerWithDecoder(describeDecoder)),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Get("/products", describeHandler, HandlerWithDecoder(describeOtherDecoder))
+
+	desc, _ := tr.RouteDetails(net_http.MethodGet, "/products")
+	if len(desc.Conflicts) != 1 || desc.Conflicts[0].Kind != "decoder" {
+		t.Fatalf("conflicts = %v, want the decoder", desc.Conflicts)
+	}
+
+	c := desc.Conflicts[0]
+	if !strings.HasSuffix(c.First.Name, "describeDecoder") ||
+		!strings.HasSuffix(c.Second.Name, "describeOtherDecoder") ||
+		c.First.Origin == c.Second.Origin {
+		t.Errorf("conflict = %v, want both call sites", c)
+	}
+
+	if !strings.HasSuffix(desc.Decoder.Name, "describeOtherDecoder") {
+		t.Errorf("decoder = %s, want the last one", desc.Decoder)
+	}
+
+	if len(logger.warns) != 1 || logger.warns[0] != "conflicting handler options" {
+		t.Errorf("warnings = %q, want the conflict", logger.warns)
+	}
+}
+
+func TestStrictHandlerOptions(t *testing.T) {
+	tr, err := NewHTTPTransport(
+		"test",
+		WithTransportOption(WithStrictHandlerOptions()),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrHandlerOptionConflict) {
+			t.Errorf("recover() = %v, want ErrHandlerOptionConflict", err)
+		}
+	}()
+
+	tr.Get(
+		"/products",
+		describeHandler,
+		HandlerWithEncoder(NewDefaultJSONEncoder()),
+		HandlerWithEncoder(NewDefaultEncoder()),
+	)
+}
@@ -59,7 +59,13 @@ func NewSetResponseHeader(key, val string) HandlerOption {
 
 // NewFiltersHandlerOption allows custom filter added per route
 func NewFiltersHandlerOption(filters ...Filter) HandlerOption {
+	cs := make([]Component, 0, len(filters))
+	for _, f := range filters {
+		cs = append(cs, component(f))
+	}
+
 	return func(h *handler) {
+		h.desc.Filters = append(h.desc.Filters, cs...)
 		h.filters = append(h.filters, filters...)
 	}
 }
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+
+	"github.com/unbxd/go-base/v2/authz"
+	"github.com/unbxd/go-base/v2/endpoint"
+)
+
+const (
+	defaultPolicyName = "default"
+	routePolicyName   = "route"
+)
+
+// policyDecisionBefore puts a placeholder for the decision in context, so
+// it is visible to after funcs & error encoder
+func policyDecisionBefore(cx context.Context, _ *net_http.Request) context.Context {
+	return context.WithValue(cx, ContextKeyPolicyDecision, &authz.Decision{})
+}
+
+func policyMiddleware(name string, policy authz.Policy) Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(cx context.Context, req interface{}) (interface{}, error) {
+			d, err := authz.Evaluate(cx, name, policy, req)
+
+			if holder, ok := cx.Value(ContextKeyPolicyDecision).(*authz.Decision); ok {
+				*holder = d
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			return next(cx, req)
+		}
+	}
+}
+
+// PolicyDecisionFromContext returns the authorization decision taken for
+// the request, to be used by audit logs in after funcs or error encoders.
+// ok is false if the handler has no policy
+func PolicyDecisionFromContext(cx context.Context) (authz.Decision, bool) {
+	d, ok := cx.Value(ContextKeyPolicyDecision).(*authz.Decision)
+	if !ok {
+		return authz.Decision{}, false
+	}
+	return *d, true
+}
+
+// HandlerWithPolicy sets the authorization policy for the handler. The
+// policy is evaluated after the request is decoded and before any
+// middleware or the endpoint. Requests without a principal in context
+// fail with 401, denied requests with 403, both using a stable error code
+// (see authz.Error). It overrides the transport default policy
+func HandlerWithPolicy(p authz.Policy) HandlerOption {
+	return HandlerWithNamedPolicy(routePolicyName, p)
+}
+
+// HandlerWithNamedPolicy is HandlerWithPolicy with the name reported in
+// the decision
+func HandlerWithNamedPolicy(name string, p authz.Policy) HandlerOption {
+	return func(h *handler) {
+		h.policy = p
+		h.policyName = name
+	}
+}
+
+// HandlerWithoutPolicy exempts the handler from the transport
+// default policy, e.g. for public routes
+func HandlerWithoutPolicy() HandlerOption {
+	return func(h *handler) {
+		h.policy = nil
+		h.policyName = ""
+	}
+}
+
+// WithDefaultPolicy sets the policy applied to every handler of the
+// transport, unless overriden by HandlerWithPolicy or exempted by
+// HandlerWithoutPolicy
+func WithDefaultPolicy(p authz.Policy) TransportOption {
+	return func(tr *Transport) {
+		tr.handlerOptions = append(
+			tr.handlerOptions,
+			HandlerWithNamedPolicy(defaultPolicyName, p),
+		)
+	}
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/authz"
+)
+
+type testPrincipal struct{ roles []string }
+
+func (p testPrincipal) ID() string      { return "u1" }
+func (p testPrincipal) Roles() []string { return p.roles }
+
+func TestHandlerWithPolicy(t *testing.T) {
+	var (
+		ok Handler = func(context.Context, interface{}) (interface{}, error) {
+			return NewResponse(
+				nil, ResponseWithCode(net_http.StatusOK), ResponseWithBytes([]byte("ok")),
+			), nil
+		}
+
+		withPrincipal = func(roles ...string) HandlerOption {
+			return HandlerWithBeforeFunc(func(cx context.Context, _ *net_http.Request) context.Context {
+				return authz.WithPrincipal(cx, testPrincipal{roles})
+			})
+		}
+
+		decision authz.Decision
+		audit    = HandlerWithAfterFunc(func(cx context.Context, _ net_http.ResponseWriter) context.Context {
+			decision, _ = PolicyDecisionFromContext(cx)
+			return cx
+		})
+
+		defaultPolicy = HandlerWithNamedPolicy(defaultPolicyName, authz.RequireRole("user"))
+	)
+
+	tests := []struct {
+		name    string
+		options []HandlerOption
+		want    int
+	}{
+		{"no principal", []HandlerOption{defaultPolicy}, net_http.StatusUnauthorized},
+		{"denied", []HandlerOption{defaultPolicy, withPrincipal("guest")}, net_http.StatusForbidden},
+		{"allowed", []HandlerOption{defaultPolicy, withPrincipal("user")}, net_http.StatusOK},
+		{"route override", []HandlerOption{
+			defaultPolicy, withPrincipal("guest"), HandlerWithPolicy(authz.RequireRole("guest")),
+		}, net_http.StatusOK},
+		{"exempt", []HandlerOption{defaultPolicy, HandlerWithoutPolicy()}, net_http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			NewHandler(ok, tt.options...).ServeHTTP(
+				rw, httptest.NewRequest(net_http.MethodGet, "/", nil),
+			)
+
+			if rw.Code != tt.want {
+				t.Errorf("status = %d, want %d, body = %s", rw.Code, tt.want, rw.Body.String())
+			}
+		})
+	}
+
+	t.Run("audit", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		NewHandler(ok, defaultPolicy, withPrincipal("user"), audit).ServeHTTP(
+			rw, httptest.NewRequest(net_http.MethodGet, "/", nil),
+		)
+
+		if !decision.Allowed || decision.Policy != defaultPolicyName || decision.PrincipalID != "u1" {
+			t.Errorf("decision = %+v", decision)
+		}
+	})
+}
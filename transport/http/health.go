@@ -0,0 +1,246 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	net_http "net/http"
+	"sync"
+	"time"
+
+	"github.com/unbxd/go-base/v2/health"
+)
+
+const (
+	healthComponentHTTP = "http"
+
+	// below the 1s probes of kubernetes wait by default
+	defaultHealthCheckTimeout = 500 * time.Millisecond
+)
+
+type (
+	// healthReporters are the components reporting on the health endpoint
+	healthReporters struct {
+		mu        sync.RWMutex
+		reporters map[string]health.Reporter
+	}
+
+	// healthResponse is the body of the health endpoint
+	healthResponse struct {
+		Healthy    bool                     `json:"healthy"`
+		Components map[string]health.Status `json:"components"`
+		Checks     map[string]CheckStatus   `json:"checks,omitempty"`
+	}
+
+	// CheckStatus is the outcome of a check of the HealthChecker
+	CheckStatus struct {
+		Healthy bool   `json:"healthy"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	// HealthChecker is the registry of the checks of the readiness of the
+	// process, e.g. redis being reachable. The checks run concurrently,
+	// bounded by a timeout, so a hung one doesn't hang the probe
+	HealthChecker struct {
+		mu      sync.RWMutex
+		checks  map[string]func(context.Context) error
+		timeout time.Duration
+	}
+)
+
+// NewHealthChecker returns a HealthChecker whose checks have timeout to
+// return, 500ms when zero or less
+func NewHealthChecker(timeout time.Duration) *HealthChecker {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	return &HealthChecker{
+		checks:  make(map[string]func(context.Context) error),
+		timeout: timeout,
+	}
+}
+
+// RegisterCheck adds the check fn under name, replacing the one with the
+// same name. The check fails with an error, it is given a context done
+// at the timeout
+func (hc *HealthChecker) RegisterCheck(name string, fn func(cx context.Context) error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	hc.checks[name] = fn
+}
+
+// Check runs the checks, healthy is true when all of them passed in time
+func (hc *HealthChecker) Check(cx context.Context) (healthy bool, statuses map[string]CheckStatus) {
+	hc.mu.RLock()
+	checks := make(map[string]func(context.Context) error, len(hc.checks))
+	for name, fn := range hc.checks {
+		checks[name] = fn
+	}
+	hc.mu.RUnlock()
+
+	type result struct {
+		name string
+		err  error
+	}
+
+	cx, cancel := context.WithTimeout(cx, hc.timeout)
+	defer cancel()
+
+	// buffered, the checks returning after the timeout don't block
+	results := make(chan result, len(checks))
+
+	for name, fn := range checks {
+		go func(name string, fn func(context.Context) error) {
+			defer func() {
+				if p := recover(); p != nil {
+					results <- result{name, fmt.Errorf("check panicked: %v", p)}
+				}
+			}()
+
+			results <- result{name, fn(cx)}
+		}(name, fn)
+	}
+
+	statuses = make(map[string]CheckStatus, len(checks))
+
+wait:
+	for range checks {
+		select {
+		case rs := <-results:
+			statuses[rs.name] = checkStatus(rs.err)
+		case <-cx.Done():
+			break wait
+		}
+	}
+
+	// select picks at random once cx is done, the results in by then
+	// aren't timed out
+drain:
+	for len(statuses) < len(checks) {
+		select {
+		case rs := <-results:
+			statuses[rs.name] = checkStatus(rs.err)
+		default:
+			break drain
+		}
+	}
+
+	healthy = true
+	for name := range checks {
+		st, ok := statuses[name]
+		if !ok {
+			st = CheckStatus{Error: "check timed out"}
+			statuses[name] = st
+		}
+		healthy = healthy && st.Healthy
+	}
+
+	return healthy, statuses
+}
+
+func checkStatus(err error) CheckStatus {
+	if err != nil {
+		return CheckStatus{Error: err.Error()}
+	}
+	return CheckStatus{Healthy: true}
+}
+
+// WithHealthEndpoint serves the health of the process as JSON on path, the
+// one of the transport, of the reporters registered with
+// RegisterHealthReporter & of the checks registered with RegisterCheck.
+// It answers 200 when all are healthy, 503 otherwise. Off by default
+func WithHealthEndpoint(path string) TransportConfigOption {
+	return func(c *config) error {
+		c.healthPath = path
+		return nil
+	}
+}
+
+// WithHealthEndpoints serves the liveness & the readiness of the process,
+// e.g. `/livez` & `/readyz` for kubernetes. live answers 200 as the
+// heartbeats do, it isn't shed under load. ready is the health endpoint,
+// see WithHealthEndpoint. Either is skipped when empty
+func WithHealthEndpoints(live, ready string) TransportConfigOption {
+	return func(c *config) error {
+		if live != "" {
+			c.heartbeats = append(c.heartbeats, live)
+		}
+		if ready != "" {
+			c.healthPath = ready
+		}
+		return nil
+	}
+}
+
+// WithHealthChecker sets the registry of the checks of the health
+// endpoint, e.g. one shared by the transports of the process. Defaults to
+// one with a timeout of 500ms
+func WithHealthChecker(hc *HealthChecker) TransportConfigOption {
+	return func(c *config) error {
+		c.healthChecker = hc
+		return nil
+	}
+}
+
+// RegisterHealthReporter adds the health of a component, e.g. a kafka
+// consumer, to the health endpoint under name, replacing the one with the
+// same name. The transport reports itself as `http`. See
+// WithHealthEndpoint
+//
+//	tr.RegisterHealthReporter("orders-consumer", consumer)
+func (tr *Transport) RegisterHealthReporter(name string, r health.Reporter) {
+	tr.health.mu.Lock()
+	defer tr.health.mu.Unlock()
+
+	if tr.health.reporters == nil {
+		tr.health.reporters = make(map[string]health.Reporter)
+	}
+	tr.health.reporters[name] = r
+}
+
+// RegisterCheck adds a check of the readiness of the process to the
+// health endpoint under name, e.g. redis being reachable, see
+// HealthChecker & WithHealthEndpoints
+//
+//	tr.RegisterCheck("redis", func(cx context.Context) error {
+//		return rd.Ping(cx).Err()
+//	})
+func (tr *Transport) RegisterCheck(name string, fn func(cx context.Context) error) {
+	tr.checker.RegisterCheck(name, fn)
+}
+
+func healthHandler(tr *Transport) net_http.Handler {
+	return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+		res := healthResponse{
+			Healthy: true,
+			Components: map[string]health.Status{
+				// the requests are turned away while draining, this one
+				// got through
+				healthComponentHTTP: {Healthy: true, Connected: true, Lag: -1},
+			},
+		}
+
+		tr.health.mu.RLock()
+		for name, reporter := range tr.health.reporters {
+			st := reporter.Health(r.Context())
+			res.Components[name] = st
+			res.Healthy = res.Healthy && st.Healthy
+		}
+		tr.health.mu.RUnlock()
+
+		healthy, checks := tr.checker.Check(r.Context())
+		res.Checks = checks
+		res.Healthy = res.Healthy && healthy
+
+		code := net_http.StatusOK
+		if !res.Healthy {
+			code = net_http.StatusServiceUnavailable
+		}
+
+		w.Header().Set(HeaderContentType, "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/health"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestWithHealthEndpoint(t *testing.T) {
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithHealthEndpoint("/health"),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	lag := int64(0)
+	tr.RegisterHealthReporter("orders-consumer", health.ReporterFunc(func(context.Context) health.Status {
+		return health.Status{Healthy: lag < 100, Connected: true, Lag: lag}
+	}))
+
+	get := func() (int, healthResponse) {
+		rec := httptest.NewRecorder()
+		tr.Handler.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, "/health", nil))
+
+		var res healthResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("Unmarshal() error = %v, body = %s", err, rec.Body)
+		}
+		return rec.Code, res
+	}
+
+	code, res := get()
+	if code != net_http.StatusOK || !res.Healthy || len(res.Components) != 2 || !res.Components["http"].Healthy {
+		t.Errorf("/health = %d %+v, want 200 with http & orders-consumer healthy", code, res)
+	}
+
+	lag = 500
+	code, res = get()
+	if code != net_http.StatusServiceUnavailable || res.Healthy || res.Components["orders-consumer"].Lag != 500 {
+		t.Errorf("/health = %d %+v, want 503 with orders-consumer lagging", code, res)
+	}
+}
+
+func TestWithHealthEndpoints(t *testing.T) {
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithHealthEndpoints("/livez", "/readyz"),
+		WithHealthChecker(NewHealthChecker(200*time.Millisecond)),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	var redisErr error
+	tr.RegisterCheck("redis", func(context.Context) error { return redisErr })
+
+	get := func(path string) (int, healthResponse) {
+		rec := httptest.NewRecorder()
+		tr.Handler.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, path, nil))
+
+		var res healthResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &res)
+		return rec.Code, res
+	}
+
+	if code, res := get("/readyz"); code != net_http.StatusOK || !res.Checks["redis"].Healthy {
+		t.Errorf("/readyz = %d %+v, want 200 with redis healthy", code, res)
+	}
+
+	redisErr = errors.New("connection refused")
+	if code, res := get("/readyz"); code != net_http.StatusServiceUnavailable || res.Checks["redis"].Error != "connection refused" {
+		t.Errorf("/readyz = %d %+v, want 503 with the error of redis", code, res)
+	}
+
+	redisErr = nil
+	tr.RegisterCheck("kafka", func(context.Context) error {
+		// ignores the context, the probe mustn't wait for it
+		time.Sleep(3 * time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	if code, res := get("/readyz"); code != net_http.StatusServiceUnavailable || res.Checks["kafka"].Healthy || !res.Checks["redis"].Healthy {
+		t.Errorf("/readyz = %d %+v, want 503 with kafka timed out", code, res)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("/readyz took %s, want the timeout of the checks", took)
+	}
+
+	if code, _ := get("/livez"); code != net_http.StatusOK {
+		t.Errorf("/livez = %d, want 200 with a check failing", code)
+	}
+}
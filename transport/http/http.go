@@ -5,6 +5,7 @@ import (
 	net_http "net/http"
 
 	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
 )
 
 // ContextKey is key for context
@@ -27,8 +28,18 @@ const (
 	ContextKeyRequestAccept
 	ContextKeyResponseHeaders
 	ContextKeyResponseSize
+	ContextKeyPolicyDecision
+	ContextKeyRequestClass
+	ContextKeyRequestTimedOut
+	ContextKeyRequestURLParams
+	ContextKeyClientIP
 )
 
+func init() {
+	// the loggers of log.FromContext carry the request id
+	log.RegisterContextField(ContextKeyRequestXRequestID, "request_id")
+}
+
 func decorateContext(ctx context.Context, r *net_http.Request) context.Context {
 	for k, v := range map[ContextKey]string{
 		ContextKeyRequestMethod:          r.Method,
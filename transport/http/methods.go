@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// methods are checked in this order for the Allow header
+var methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodConnect,
+	http.MethodTrace,
+}
+
+// WithMethodNotAllowed answers `405 Method Not Allowed` with the `Allow`
+// header listing the methods of the path, when the path has routes but
+// none for the method. Disabled, such requests get the 404 of unknown
+// paths. Enabled by default
+func WithMethodNotAllowed(enabled bool) TransportConfigOption {
+	return func(c *config) error {
+		c.methodNotAllowed = enabled
+		return nil
+	}
+}
+
+// WithAutoHead serves HEAD for every GET route with its handler, the body
+// is discarded. A HEAD route registered for the path takes precedence.
+// Enabled by default
+func WithAutoHead(enabled bool) TransportConfigOption {
+	return func(c *config) error {
+		c.autoHead = enabled
+		return nil
+	}
+}
+
+// allowed returns the methods with a route matching the path of r
+func (mx *chiMuxer) allowed(r *http.Request) []string {
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+
+	var allowed []string
+	for _, method := range methods {
+		if mx.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// methodNotAllowedChiMuxOption replaces the 405 of chi, which keeps the
+// methods of the earlier requests in the Allow header, or answers 404
+// when disabled. The options of the application come after, a handler
+// set with MethodNotAllowedChiMuxOption wins
+func methodNotAllowedChiMuxOption(enabled bool) ChiMuxOption {
+	return func(cm *chiMuxer) {
+		if !enabled {
+			cm.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+				cm.NotFoundHandler().ServeHTTP(w, r)
+			})
+			return
+		}
+
+		cm.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			// chi answers 405 for the methods it doesn't know, whatever the path
+			allowed := cm.allowed(r)
+			if len(allowed) == 0 {
+				cm.NotFoundHandler().ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			w.Header().Set(HeaderContentType, "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"code":  http.StatusMethodNotAllowed,
+				"error": http.StatusText(http.StatusMethodNotAllowed),
+			})
+		})
+	}
+}
+
+// headResponseWriter drops the body written by a GET handler serving HEAD
+type headResponseWriter struct{ http.ResponseWriter }
+
+func (hw *headResponseWriter) Write(bt []byte) (int, error) { return len(bt), nil }
+
+func (hw *headResponseWriter) Unwrap() http.ResponseWriter { return hw.ResponseWriter }
+
+func headHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&headResponseWriter{w}, r)
+	})
+}
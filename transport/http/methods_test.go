@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestMethods(t *testing.T) {
+	get := func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		return NewResponse(req, ResponseWithBytes([]byte("get"))), nil
+	}
+
+	newTransport := func(t *testing.T, options ...TransportConfigOption) *Transport {
+		tr, err := NewHTTPTransport("test", append(options, WithCustomLogger(log.NewNoopLogger()))...)
+		if err != nil {
+			t.Fatalf("NewHTTPTransport() error = %v", err)
+		}
+
+		tr.Get("/items/{id}", get)
+		tr.Post("/items/{id}", describeHandler)
+		tr.Get("/head", get)
+		tr.Head("/head", func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+			return NewResponse(req, ResponseWithCode(net_http.StatusNoContent), ResponseWithBytes(nil)), nil
+		})
+		return tr
+	}
+
+	serve := func(tr *Transport, method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		tr.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		tr := newTransport(t)
+
+		// twice, chi kept the methods of the earlier requests
+		for i := 0; i < 2; i++ {
+			rec := serve(tr, net_http.MethodDelete, "/items/1")
+			if rec.Code != net_http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD, POST" {
+				t.Errorf("DELETE = %d, Allow %q, want 405, \"GET, HEAD, POST\"", rec.Code, rec.Header().Get("Allow"))
+			}
+		}
+
+		if rec := serve(tr, net_http.MethodDelete, "/missing"); rec.Code != net_http.StatusNotFound {
+			t.Errorf("DELETE /missing = %d, want 404", rec.Code)
+		}
+
+		if rec := serve(tr, "PROPFIND", "/missing"); rec.Code != net_http.StatusNotFound {
+			t.Errorf("PROPFIND /missing = %d, want 404", rec.Code)
+		}
+
+		rec := serve(tr, net_http.MethodHead, "/items/1")
+		if rec.Code != net_http.StatusOK || rec.Body.Len() != 0 {
+			t.Errorf("HEAD = %d, body %q, want 200 without body", rec.Code, rec.Body)
+		}
+
+		// the HEAD route wins, registered after the GET
+		if rec := serve(tr, net_http.MethodHead, "/head"); rec.Code != net_http.StatusNoContent {
+			t.Errorf("HEAD /head = %d, want 204", rec.Code)
+		}
+
+		if _, ok := tr.RouteDetails(net_http.MethodHead, "/items/{id}"); ok {
+			t.Errorf("RouteDetails() has the implicit HEAD route")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		tr := newTransport(t, WithMethodNotAllowed(false), WithAutoHead(false))
+
+		if rec := serve(tr, net_http.MethodDelete, "/items/1"); rec.Code != net_http.StatusNotFound {
+			t.Errorf("DELETE = %d, want 404", rec.Code)
+		}
+
+		if rec := serve(tr, net_http.MethodHead, "/items/1"); rec.Code != net_http.StatusNotFound {
+			t.Errorf("HEAD = %d, want 404", rec.Code)
+		}
+	})
+}
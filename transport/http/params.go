@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -36,3 +37,35 @@ func Parameters(r *http.Request) URLParamsParser {
 		&chi.RouteContext(r.Context()).URLParams,
 	}
 }
+
+// URLParameters returns the URL parameters of the route serving the
+// request of cx, e.g. `id` of `/products/{id}`, whichever muxer parsed
+// them. Decoders & handlers can read them without the muxer:
+//
+//	func decodeProduct(cx context.Context, r *http.Request) (interface{}, error) {
+//		return &GetProduct{ID: http.Parameter(cx, "id")}, nil
+//	}
+//
+// It is nil outside of the routes registered on the transport. Parameters
+// of the request is kept for compatibility, it only works with chi
+func URLParameters(cx context.Context) URLParams {
+	params, _ := cx.Value(ContextKeyRequestURLParams).(URLParams)
+	return params
+}
+
+// Parameter returns the URL parameter name of the request of cx, empty
+// when the route doesn't have it, see URLParameters
+func Parameter(cx context.Context, name string) string {
+	return URLParameters(cx)[name]
+}
+
+// urlParamsFilter puts the URL parameters parsed by the muxer in the
+// context of the request, see URLParameters
+func urlParamsFilter(parser URLParser) Filter {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cx := context.WithValue(r.Context(), ContextKeyRequestURLParams, parser.Parse(r))
+			next.ServeHTTP(w, r.WithContext(cx))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestURLParameters(t *testing.T) {
+	muxers := map[string][]TransportConfigOption{
+		"chi":     nil,
+		"gorilla": {WithTransportOption(WithMuxer(NewGorillaMux()))},
+	}
+
+	for name, options := range muxers {
+		t.Run(name, func(t *testing.T) {
+			tr, err := NewHTTPTransport("test", append(options, WithCustomLogger(log.NewNoopLogger()))...)
+			if err != nil {
+				t.Fatalf("NewHTTPTransport() error = %v", err)
+			}
+
+			var legacy URLParams
+			tr.Get("/items/{id}/tags/{tag}", func(cx context.Context, req *net_http.Request) (*net_http.Response, error) {
+				legacy = tr.Mux().URLParser().Parse(req)
+				return NewResponse(req, ResponseWithBytes(
+					[]byte(Parameter(cx, "id")+"/"+URLParameters(cx)["tag"]),
+				)), nil
+			}, HandlerWithDecoder(func(cx context.Context, r *net_http.Request) (interface{}, error) {
+				if Parameter(cx, "id") != "42" {
+					t.Errorf("Parameter(id) in the decoder = %q, want 42", Parameter(cx, "id"))
+				}
+				return r, nil
+			}))
+
+			rec := httptest.NewRecorder()
+			tr.Handler.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, "/items/42/tags/new", nil))
+
+			if rec.Code != net_http.StatusOK || rec.Body.String() != "42/new" {
+				t.Errorf("GET = %d %q, want 200 42/new", rec.Code, rec.Body)
+			}
+
+			if legacy.ByName("id") != "42" || legacy.ByName("tag") != "new" {
+				t.Errorf("URLParser().Parse() = %v, want id 42 & tag new", legacy)
+			}
+		})
+	}
+
+	if params := URLParameters(context.Background()); params != nil || Parameter(context.Background(), "id") != "" {
+		t.Errorf("URLParameters() outside of a route = %v, want nil", params)
+	}
+}
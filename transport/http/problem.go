@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	net_http "net/http"
+
+	kit_http "github.com/go-kit/kit/transport/http"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// MIMEProblemJSON is the content type of RFC 7807 problem details
+const MIMEProblemJSON = "application/problem+json"
+
+// detail of the errors which aren't HTTPError, their message may leak
+// internals
+const problemInternalDetail = "the server encountered an internal error"
+
+// HTTPError is an error with the details of the HTTP response it should
+// result in. The problem+json error encoder renders it as
+//
+//	{
+//		"type": "about:blank",
+//		"title": "Not Found",
+//		"status": 404,
+//		"detail": "product 42 doesn't exist",
+//		"code": "product_not_found",
+//		"request_id": "...",
+//		"sku": "42"
+//	}
+//
+// where the fields added with WithField are extension members
+type HTTPError struct {
+	Status int
+	Code   string
+	Title  string
+	Detail string
+
+	fields map[string]interface{}
+}
+
+// NewHTTPError returns an HTTPError, the title defaults to the status
+// text of status
+func NewHTTPError(status int, code, detail string) *HTTPError {
+	return &HTTPError{
+		Status: status,
+		Code:   code,
+		Title:  net_http.StatusText(status),
+		Detail: detail,
+	}
+}
+
+// WithField adds an extension member to the problem, the standard members
+// (type, title, status, detail, instance), code & request_id can't be
+// overridden
+func (he *HTTPError) WithField(k string, v interface{}) *HTTPError {
+	if he.fields == nil {
+		he.fields = make(map[string]interface{})
+	}
+	he.fields[k] = v
+	return he
+}
+
+func (he *HTTPError) Error() string {
+	msg := net_http.StatusText(he.StatusCode())
+	if he.Code != "" {
+		msg += " (" + he.Code + ")"
+	}
+	if he.Detail != "" {
+		msg += ": " + he.Detail
+	}
+	return msg
+}
+
+// StatusCode implements kit_http.StatusCoder, a missing status is 500
+func (he *HTTPError) StatusCode() int {
+	if he.Status == 0 {
+		return net_http.StatusInternalServerError
+	}
+	return he.Status
+}
+
+// problem is the body of the problem+json response
+func (he *HTTPError) problem(requestID string) map[string]interface{} {
+	pb := make(map[string]interface{}, len(he.fields)+6)
+	for k, v := range he.fields {
+		pb[k] = v
+	}
+
+	title := he.Title
+	if title == "" {
+		title = net_http.StatusText(he.StatusCode())
+	}
+
+	pb["type"] = "about:blank"
+	pb["title"] = title
+	pb["status"] = he.StatusCode()
+
+	if he.Detail != "" {
+		pb["detail"] = he.Detail
+	}
+	if he.Code != "" {
+		pb["code"] = he.Code
+	}
+	if requestID != "" {
+		pb["request_id"] = requestID
+	}
+	return pb
+}
+
+// problemOf maps err to an HTTPError. Errors from other packages keep
+// their status through kit_http.StatusCoder, their message is only shown
+// for client errors
+func problemOf(err error) *HTTPError {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+
+	var sc kit_http.StatusCoder
+	if errors.As(err, &sc) {
+		status := sc.StatusCode()
+		if status >= 400 && status < 500 {
+			return NewHTTPError(status, "", err.Error())
+		}
+		return NewHTTPError(status, "", problemInternalDetail)
+	}
+
+	return NewHTTPError(net_http.StatusInternalServerError, "", problemInternalDetail)
+}
+
+// NewProblemJSONErrorEncoder returns an ErrorEncoder which writes errors
+// as RFC 7807 problem details, e.g.
+//
+//	http.WithTransportOption(
+//		http.WithErrorEncoder(http.NewProblemJSONErrorEncoder()),
+//	)
+//
+// HTTPError is rendered as is, errors implementing kit_http.StatusCoder
+// keep their status & any other error is a 500 with a generic detail.
+// Headers of errors implementing kit_http.Headerer are set on the response
+func NewProblemJSONErrorEncoder() ErrorEncoder {
+	return func(cx context.Context, err error, w net_http.ResponseWriter) {
+		he := problemOf(err)
+
+		// decorateContextFilter runs before the request id is generated,
+		// requestIDFilter sets it on the response too
+		requestID, _ := cx.Value(ContextKeyRequestXRequestID).(string)
+		if requestID == "" {
+			requestID = w.Header().Get(HeaderRequestID)
+		}
+
+		var hr kit_http.Headerer
+		if errors.As(err, &hr) {
+			for k, vs := range hr.Headers() {
+				for _, v := range vs {
+					w.Header().Add(k, v)
+				}
+			}
+		}
+
+		body, merr := json.Marshal(he.problem(requestID))
+		if merr != nil {
+			// an extension member which doesn't marshal
+			body, _ = json.Marshal((&HTTPError{
+				Status: he.Status, Code: he.Code, Title: he.Title, Detail: he.Detail,
+			}).problem(requestID))
+		}
+
+		w.Header().Set(HeaderContentType, MIMEProblemJSON)
+		w.WriteHeader(he.StatusCode())
+		_, _ = w.Write(body)
+	}
+}
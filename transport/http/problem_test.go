@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+func TestProblemJSONErrorEncoder(t *testing.T) {
+	notFound := NewHTTPError(net_http.StatusNotFound, "product_not_found", "product 42 doesn't exist").
+		WithField("sku", "42").
+		WithField("status", 200)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		want       map[string]interface{}
+	}{
+		{
+			"http error", notFound, net_http.StatusNotFound,
+			map[string]interface{}{
+				"type": "about:blank", "title": "Not Found", "status": float64(404),
+				"detail": "product 42 doesn't exist", "code": "product_not_found",
+				"sku": "42", "request_id": "req-1",
+			},
+		},
+		{
+			"wrapped http error", errors.Wrap(notFound, "lookup failed"), net_http.StatusNotFound,
+			map[string]interface{}{"code": "product_not_found", "status": float64(404)},
+		},
+		{
+			"status coder", &DecodeError{Err: ErrEmptyBody, Reason: DecodeReasonEmptyBody}, net_http.StatusBadRequest,
+			map[string]interface{}{
+				"title": "Bad Request", "status": float64(400),
+				"detail": "decode request: empty_body: request body is empty",
+			},
+		},
+		{
+			"unknown error", errors.New("db: connection refused"), net_http.StatusInternalServerError,
+			map[string]interface{}{
+				"title": "Internal Server Error", "status": float64(500),
+				"detail": problemInternalDetail,
+			},
+		},
+	}
+
+	enc := NewProblemJSONErrorEncoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				rec = httptest.NewRecorder()
+				cx  = context.WithValue(context.Background(), ContextKeyRequestXRequestID, "req-1")
+			)
+
+			enc(cx, tt.err, rec)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get(HeaderContentType); ct != MIMEProblemJSON {
+				t.Errorf("content type = %q, want %q", ct, MIMEProblemJSON)
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q isn't JSON: %v", rec.Body, err)
+			}
+			for k, v := range tt.want {
+				if body[k] != v {
+					t.Errorf("body[%s] = %v, want %v", k, body[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestProblemJSONGeneratedRequestID(t *testing.T) {
+	var (
+		enc = NewProblemJSONErrorEncoder()
+		rec = httptest.NewRecorder()
+	)
+
+	h := chain(net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+		enc(r.Context(), errors.New("boom"), w)
+	}), decorateContextFilter(), requestIDFilter())
+
+	h.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, "/", nil))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q isn't JSON: %v", rec.Body, err)
+	}
+
+	if id := rec.Header().Get(HeaderRequestID); id == "" || body["request_id"] != id {
+		t.Errorf("request_id = %v, want the generated %q", body["request_id"], id)
+	}
+}
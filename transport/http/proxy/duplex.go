@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"io"
+	net_http "net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// ErrDownstreamClosed is the error seen by the upload direction of a
+// streaming request when downstream finishes its response first
+var ErrDownstreamClosed = errors.New("downstream closed the response")
+
+// isStream is true for requests whose body has no known length, e.g.
+// chunked uploads
+func isStream(req *net_http.Request) bool {
+	if req.Body == nil || req.Body == net_http.NoBody {
+		return false
+	}
+
+	if req.ContentLength < 0 {
+		return true
+	}
+
+	for _, te := range req.TransferEncoding {
+		if strings.EqualFold(te, "chunked") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// duplex pumps a streaming request body to downstream independently of
+// the response being copied back, so either direction can finish first.
+//   - EOF from the client closes the pipe cleanly, the downstream sees
+//     the end of the request body while the response keeps streaming
+//   - downstream finishing the response stops the pump, the pipe is
+//     closed with ErrDownstreamClosed and the pending client read is
+//     interrupted using the read deadline of the connection
+//   - client errors (disconnect, cancelled context) close the pipe with
+//     the error, which aborts the request to downstream. http.Transport
+//     never returns a connection with a partially written request to pool
+type duplex struct {
+	src io.ReadCloser
+
+	pr *io.PipeReader
+	pw *io.PipeWriter
+
+	done chan struct{}
+	once sync.Once
+
+	mu sync.Mutex
+	rc *net_http.ResponseController
+}
+
+func newDuplex(src io.ReadCloser) *duplex {
+	pr, pw := io.Pipe()
+	return &duplex{
+		src:  src,
+		pr:   pr,
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+}
+
+func (d *duplex) pump() {
+	defer close(d.done)
+
+	// io.Copy returns nil on EOF, which closes the pipe cleanly
+	_, err := io.Copy(d.pw, d.src)
+	d.pw.CloseWithError(err)
+}
+
+// bind enables full-duplex on the server connection, so the request body
+// can still be read after the response has started, and keeps the
+// controller to interrupt the pump later
+func (d *duplex) bind(w net_http.ResponseWriter) {
+	rc := net_http.NewResponseController(w)
+
+	// not supported on HTTP/2, which is full-duplex already
+	_ = rc.EnableFullDuplex()
+
+	d.mu.Lock()
+	d.rc = rc
+	d.mu.Unlock()
+}
+
+// stop terminates the upload direction & waits for the pump to exit
+func (d *duplex) stop(err error) {
+	d.once.Do(func() {
+		d.pr.CloseWithError(err)
+
+		d.mu.Lock()
+		rc := d.rc
+		d.mu.Unlock()
+
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+
+		// without the controller there is no way to interrupt a blocked
+		// read from the client, the server unblocks it once the handler
+		// returns and the connection is done with
+		if rc == nil || rc.SetReadDeadline(time.Now()) != nil {
+			return
+		}
+
+		<-d.done
+	})
+}
+
+// duplexBody wraps the downstream response body and stops the upload
+// direction once the response has been consumed
+type duplexBody struct {
+	io.ReadCloser
+	d *duplex
+}
+
+// BindResponseWriter is called by the encoder before the response is
+// written
+func (db *duplexBody) BindResponseWriter(w net_http.ResponseWriter) { db.d.bind(w) }
+
+func (db *duplexBody) Close() error {
+	err := db.ReadCloser.Close()
+	db.d.stop(ErrDownstreamClosed)
+	return err
+}
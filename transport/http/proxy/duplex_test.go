@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+	gobi_http "github.com/unbxd/go-base/v2/transport/http"
+)
+
+// echo acknowledges every line it reads and writes `bye` once the
+// request body ends. It stops early after `stopAfter` lines, if set
+func echo(stopAfter int, exited chan<- error) net_http.HandlerFunc {
+	return func(w net_http.ResponseWriter, r *net_http.Request) {
+		_ = net_http.NewResponseController(w).EnableFullDuplex()
+
+		w.WriteHeader(net_http.StatusOK)
+		w.(net_http.Flusher).Flush()
+
+		var (
+			err error
+			sc  = bufio.NewScanner(r.Body)
+			n   = 0
+		)
+
+		for sc.Scan() {
+			_, _ = io.WriteString(w, "ack:"+sc.Text()+"\n")
+			w.(net_http.Flusher).Flush()
+
+			n++
+			if stopAfter > 0 && n == stopAfter {
+				exited <- nil
+				return
+			}
+		}
+
+		if err = sc.Err(); err == nil {
+			_, _ = io.WriteString(w, "bye\n")
+		}
+
+		exited <- err
+	}
+}
+
+func newFront(t *testing.T, downstream string, wrap func(net_http.Handler) net_http.Handler) *httptest.Server {
+	ep, err := NewProxyEndpoint(log.FromCtx(context.Background()), downstream)
+	if err != nil {
+		t.Fatalf("NewProxyEndpoint() error = %v", err)
+	}
+
+	var h net_http.Handler = gobi_http.NewHandler(gobi_http.Handler(ep))
+	if wrap != nil {
+		h = wrap(h)
+	}
+
+	return httptest.NewServer(h)
+}
+
+type stream struct {
+	pw   *io.PipeWriter
+	res  *net_http.Response
+	read *bufio.Reader
+}
+
+func open(t *testing.T, cx context.Context, url string) *stream {
+	pr, pw := io.Pipe()
+
+	req, _ := net_http.NewRequestWithContext(cx, net_http.MethodPost, url, pr)
+	req.ContentLength = -1
+
+	resc := make(chan *net_http.Response, 1)
+	go func() {
+		res, err := net_http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("Do() error = %v", err)
+			close(resc)
+			return
+		}
+		resc <- res
+	}()
+
+	// headers are only sent by downstream after the request is established
+	_, _ = io.WriteString(pw, "0\n")
+
+	res, ok := <-resc
+	if !ok {
+		t.FailNow()
+	}
+
+	s := &stream{pw, res, bufio.NewReader(res.Body)}
+	s.expect(t, "ack:0")
+	return s
+}
+
+func (s *stream) send(t *testing.T, line string) {
+	if _, err := io.WriteString(s.pw, line+"\n"); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+}
+
+func (s *stream) expect(t *testing.T, want string) {
+	got, err := s.read.ReadString('\n')
+	if err != nil || got != want+"\n" {
+		t.Fatalf("read = %q, %v, want %q", got, err, want)
+	}
+}
+
+func (s *stream) expectEnd(t *testing.T) {
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(s.read)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("response didn't end")
+	}
+}
+
+func wait(t *testing.T, exited <-chan error, wantErr bool) {
+	select {
+	case err := <-exited:
+		if (err != nil) != wantErr {
+			t.Errorf("downstream exited with %v, wantErr %v", err, wantErr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("downstream handler didn't exit")
+	}
+}
+
+func checkLeaks(t *testing.T, base int) {
+	net_http.DefaultClient.CloseIdleConnections()
+	net_http.DefaultTransport.(*net_http.Transport).CloseIdleConnections()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf(
+				"goroutines = %d, want <= %d\n%s",
+				runtime.NumGoroutine(), base, buf[:runtime.Stack(buf, true)],
+			)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDuplexStreaming(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"client finishes first", func(t *testing.T) {
+			exited := make(chan error, 1)
+			ds := httptest.NewServer(echo(0, exited))
+			defer ds.Close()
+			fr := newFront(t, ds.URL, nil)
+			defer fr.Close()
+
+			s := open(t, context.Background(), fr.URL)
+			s.send(t, "1")
+			s.expect(t, "ack:1")
+
+			// half-close, response keeps streaming
+			s.pw.Close()
+			s.expect(t, "bye")
+			s.expectEnd(t)
+			wait(t, exited, false)
+		}},
+		{"downstream finishes first", func(t *testing.T) {
+			exited := make(chan error, 1)
+			ds := httptest.NewServer(echo(2, exited))
+			defer ds.Close()
+			fr := newFront(t, ds.URL, nil)
+			defer fr.Close()
+
+			s := open(t, context.Background(), fr.URL)
+			s.send(t, "1")
+			s.expect(t, "ack:1")
+			wait(t, exited, false)
+
+			// the upload is still open, response must end regardless
+			s.expectEnd(t)
+			s.pw.CloseWithError(io.ErrClosedPipe)
+		}},
+		{"client disconnects mid-stream", func(t *testing.T) {
+			exited := make(chan error, 1)
+			ds := httptest.NewServer(echo(0, exited))
+			defer ds.Close()
+			fr := newFront(t, ds.URL, nil)
+			defer fr.Close()
+
+			cx, cancel := context.WithCancel(context.Background())
+			s := open(t, cx, fr.URL)
+			s.send(t, "1")
+			s.expect(t, "ack:1")
+
+			cancel()
+			wait(t, exited, true)
+			s.pw.Close()
+		}},
+		{"deadline expires", func(t *testing.T) {
+			exited := make(chan error, 1)
+			ds := httptest.NewServer(echo(0, exited))
+			defer ds.Close()
+			fr := newFront(t, ds.URL, func(next net_http.Handler) net_http.Handler {
+				return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+					cx, cancel := context.WithTimeout(r.Context(), 200*time.Millisecond)
+					defer cancel()
+					next.ServeHTTP(w, r.WithContext(cx))
+				})
+			})
+			defer fr.Close()
+
+			s := open(t, context.Background(), fr.URL)
+			wait(t, exited, true)
+			s.expectEnd(t)
+			s.pw.Close()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := runtime.NumGoroutine()
+			tt.run(t)
+			checkLeaks(t, base)
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/unbxd/go-base/v2/endpoint"
 	"github.com/unbxd/go-base/v2/errors"
 	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/net/dialer"
 )
 
 const defaultUserAgent = "Mozart-[go-dialer]"
@@ -46,6 +47,10 @@ type (
 		dialer net_http.RoundTripper
 
 		path string
+
+		// deadline propagation, see ProxyWithDeadlinePropagation
+		propagate bool
+		margin    time.Duration
 	}
 
 	// ProxyOption is set of options which can modify proxy
@@ -236,6 +241,20 @@ func (pr *Proxy) HandlerFunc() func(context.Context, *net_http.Request) (*net_ht
 			)
 		}
 
+		// the downstream gets the time left of the request, the
+		// context is released with the body of the response
+		cancel := func() {}
+		if pr.propagate {
+			outreq, cancel, err = dialer.PropagateDeadline(
+				outreq.Context(), outreq, pr.margin,
+			)
+			if err != nil {
+				return nil, errors.Wrap(
+					err, "propagate deadline failed",
+				)
+			}
+		}
+
 		pr.logger.Debug("Dialing",
 			log.String("Host", outreq.URL.Host),
 			log.String("Path", outreq.URL.Path),
@@ -243,13 +262,37 @@ func (pr *Proxy) HandlerFunc() func(context.Context, *net_http.Request) (*net_ht
 			log.String("RequestID", outreq.Header.Get("x-request-id")),
 		)
 
+		// streaming uploads are pumped independently of the response,
+		// see duplex
+		var dx *duplex
+		if isStream(outreq) {
+			dx = newDuplex(outreq.Body)
+			outreq.Body = dx.pr
+
+			go dx.pump()
+		}
+
 		outres, err = pr.dialer.RoundTrip(outreq)
 		if err != nil {
+			cancel()
+			if dx != nil {
+				dx.stop(err)
+			}
+
 			return nil, errors.Wrap(
 				err, "dial request to downstream failed",
 			)
 		}
 
+		if pr.propagate {
+			dialer.CancelOnClose(outres, cancel)
+		}
+
+		// outermost, the encoder binds it to the response writer
+		if dx != nil {
+			outres.Body = &duplexBody{outres.Body, dx}
+		}
+
 		pr.logger.Debug("Dialed Host",
 			log.String("Host", outreq.URL.Host),
 			log.String("RequestID", outreq.Header.Get("x-request-id")),
@@ -293,6 +336,18 @@ func ProxyWithResponseOptions(fns ...ResponseOption) ProxyOption {
 	}
 }
 
+// ProxyWithDeadlinePropagation passes the deadline of the incoming request
+// on to the downstream, the time left less margin is set in the timeout
+// headers & bounds the outgoing request, see dialer.PropagateDeadline.
+// Requests out of time fail with dialer.ErrDeadlineExhausted without
+// reaching the downstream
+func ProxyWithDeadlinePropagation(margin time.Duration) ProxyOption {
+	return func(pr *Proxy) {
+		pr.propagate = true
+		pr.margin = margin
+	}
+}
+
 // ProxyWithModifiedTransport provides option to customize the transport used
 // in dialing downstream
 func ProxyWithModifiedTransport(
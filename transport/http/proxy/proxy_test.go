@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/net/dialer"
+	gobi_http "github.com/unbxd/go-base/v2/transport/http"
+)
+
+func TestProxyWithDeadlinePropagation(t *testing.T) {
+	got := make(chan time.Duration, 1)
+	down := httptest.NewServer(net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+		d, _ := dialer.RequestTimeout(r.Header)
+		got <- d
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer down.Close()
+
+	ep, err := NewProxyEndpoint(
+		log.FromCtx(context.Background()), down.URL,
+		ProxyWithDeadlinePropagation(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewProxyEndpoint() error = %v", err)
+	}
+
+	front := httptest.NewServer(gobi_http.DeadlineFilter(time.Minute)(
+		gobi_http.NewHandler(gobi_http.Handler(ep)),
+	))
+	defer front.Close()
+
+	tests := []struct {
+		name    string
+		timeout string
+		status  int
+		max     time.Duration
+	}{
+		{"budget", "500", net_http.StatusOK, 480 * time.Millisecond},
+		{"no timeout", "", net_http.StatusOK, time.Minute},
+		{"exhausted", "10", net_http.StatusInternalServerError, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := net_http.NewRequest(net_http.MethodGet, front.URL, nil)
+			if tt.timeout != "" {
+				req.Header.Set(dialer.HeaderRequestTimeout, tt.timeout)
+			}
+
+			res, err := net_http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.Copy(io.Discard, res.Body)
+			_ = res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+
+			if tt.max == 0 {
+				select {
+				case d := <-got:
+					t.Errorf("downstream called out of time, timeout %v", d)
+				default:
+				}
+				return
+			}
+
+			if d := <-got; d <= 0 || d > tt.max {
+				t.Errorf("downstream timeout = %v, want (0, %v]", d, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"encoding/json"
+	net_http "net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// Errors of the reverse router
+var (
+	ErrRouteNotFound      = errors.New("no route with the name")
+	ErrRouteParamMissing  = errors.New("route parameter missing")
+	ErrRouteParamMismatch = errors.New("route parameter doesn't match its pattern")
+)
+
+// RouteInfo is a route registered on the transport
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Name    string `json:"name,omitempty"`
+}
+
+// HandlerWithName names the route, to build its URL with Transport.URL
+func HandlerWithName(name string) HandlerOption {
+	return func(h *handler) { h.desc.Name = name }
+}
+
+// nameRoute records the pattern of a named route
+func (tr *Transport) nameRoute(desc *RouteDescriptor) {
+	if desc.Name == "" {
+		return
+	}
+
+	if tr.names == nil {
+		tr.names = make(map[string]string)
+	}
+
+	// the same route for another method, e.g. GET & HEAD
+	if p, ok := tr.names[desc.Name]; ok && p != desc.Path {
+		tr.logger.Warn(
+			"route name used twice, the first route keeps it",
+			log.String("name", desc.Name),
+			log.String("path", p),
+			log.String("ignored", desc.Path),
+		)
+		return
+	}
+
+	tr.names[desc.Name] = desc.Path
+}
+
+// Routes returns the routes registered on the transport, ordered by the
+// pattern & the method. Routes registered on the muxer directly, like
+// SSE, Websocket & Static, aren't included
+func (tr *Transport) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(tr.routes))
+	for _, desc := range tr.routes {
+		routes = append(routes, RouteInfo{desc.Method, desc.Path, desc.Name})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// URL builds the path of the route named with HandlerWithName, the
+// parameters of the pattern, `{id}` or `{id:[0-9]+}`, are replaced by the
+// escaped values in params. A trailing wildcard takes the value of `*`
+func (tr *Transport) URL(name string, params map[string]string) (string, error) {
+	pattern, ok := tr.names[name]
+	if !ok {
+		return "", errors.Wrap(ErrRouteNotFound, name)
+	}
+
+	var (
+		sb strings.Builder
+		p  = pattern
+	)
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '{':
+			end := closingBrace(p)
+			if end < 0 {
+				sb.WriteString(p)
+				return sb.String(), nil
+			}
+
+			key, expr, _ := strings.Cut(p[1:end], ":")
+			value, ok := params[key]
+			if !ok {
+				return "", errors.Wrapf(ErrRouteParamMissing, "%s: %s", name, key)
+			}
+
+			if expr != "" {
+				re, err := regexp.Compile("^(?:" + expr + ")$")
+				if err == nil && !re.MatchString(value) {
+					return "", errors.Wrapf(ErrRouteParamMismatch, "%s: %s=%q", name, key, value)
+				}
+			}
+
+			sb.WriteString(url.PathEscape(value))
+			p = p[end+1:]
+		case '*':
+			value, ok := params["*"]
+			if !ok {
+				return "", errors.Wrapf(ErrRouteParamMissing, "%s: *", name)
+			}
+
+			// the rest of the path, the slashes are kept
+			sb.WriteString((&url.URL{Path: value}).EscapedPath())
+			p = p[1:]
+		default:
+			sb.WriteByte(p[0])
+			p = p[1:]
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// closingBrace returns the index of the brace closing the one p starts
+// with, patterns may have braces, e.g. `{id:[0-9]{4}}`
+func closingBrace(p string) int {
+	depth := 0
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// WithRouteDebugEndpoint serves the routes of the transport as JSON on
+// path, see Transport.Routes, each with the details of its handler, see
+// Transport.RouteDetails. Off by default
+func WithRouteDebugEndpoint(path string) TransportConfigOption {
+	return func(c *config) error {
+		c.routeDebugPath = path
+		return nil
+	}
+}
+
+// routeDebug is a route served by the route debug endpoint
+type routeDebug struct {
+	RouteInfo
+	Details RouteDescriptor `json:"details"`
+}
+
+func routeDebugHandler(tr *Transport) net_http.Handler {
+	return net_http.HandlerFunc(func(w net_http.ResponseWriter, _ *net_http.Request) {
+		routes := tr.Routes()
+		debug := make([]routeDebug, 0, len(routes))
+		for _, rt := range routes {
+			desc, _ := tr.RouteDetails(rt.Method, rt.Pattern)
+			debug = append(debug, routeDebug{rt, desc})
+		}
+
+		w.Header().Set(HeaderContentType, "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(debug)
+	})
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	net_http "net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestTransport_Routes(t *testing.T) {
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithRouteDebugEndpoint("/debug/routes"),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Post("/employees", describeHandler, HandlerWithName("create-employee"))
+	tr.GET("/employees/{id:[0-9]+}", func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}, HandlerWithName("employee"))
+	tr.Get("/files/*", describeHandler, HandlerWithName("file"))
+	tr.Delete("/employees/{id:[0-9]+}", describeHandler)
+
+	want := []RouteInfo{
+		{net_http.MethodPost, "/employees", "create-employee"},
+		{net_http.MethodDelete, "/employees/{id:[0-9]+}", ""},
+		{net_http.MethodGet, "/employees/{id:[0-9]+}", "employee"},
+		{net_http.MethodGet, "/files/*", "file"},
+	}
+
+	if got := tr.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes() = %v, want %v", got, want)
+	}
+
+	t.Run("debug endpoint", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		tr.Handler.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, "/debug/routes", nil))
+
+		var got []RouteInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Unmarshal() error = %v, body = %s", err, rec.Body)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("/debug/routes = %v, want %v", got, want)
+		}
+
+		// each route comes with the details of its handler
+		var details []struct {
+			Details RouteDescriptor `json:"details"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &details)
+
+		for i, rt := range details {
+			desc, _ := tr.RouteDetails(want[i].Method, want[i].Pattern)
+			if !reflect.DeepEqual(rt.Details, desc) {
+				t.Errorf("/debug/routes details of %s = %+v, want %+v", want[i].Pattern, rt.Details, desc)
+			}
+		}
+		if len(details) != len(want) || details[0].Details.Decoder.Name != "default" {
+			t.Errorf("/debug/routes details = %+v, want the descriptors of the routes", details)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		route   string
+		params  map[string]string
+		want    string
+		wantErr error
+	}{
+		{"static", "create-employee", nil, "/employees", nil},
+		{"param", "employee", map[string]string{"id": "42"}, "/employees/42", nil},
+		{"wildcard", "file", map[string]string{"*": "a b/c.txt"}, "/files/a%20b/c.txt", nil},
+		{"missing", "employee", nil, "", ErrRouteParamMissing},
+		{"mismatch", "employee", map[string]string{"id": "x"}, "", ErrRouteParamMismatch},
+		{"unknown", "nope", nil, "", ErrRouteNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tr.URL(tt.route, tt.params)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("URL() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClosingBrace(t *testing.T) {
+	if got := closingBrace("{id:[0-9]{4}}/x"); got != 12 {
+		t.Errorf("closingBrace() = %d, want 12", got)
+	}
+}
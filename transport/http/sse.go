@@ -0,0 +1,337 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	net_http "net/http"
+	"strings"
+	"sync"
+	"time"
+
+	kit_http "github.com/go-kit/kit/transport/http"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// MIMEEventStream is the content type of Server-Sent Events
+const MIMEEventStream = "text/event-stream"
+
+const defaultSSEHeartbeat = 15 * time.Second
+
+var (
+	// ErrSSEInvalidField is returned by Send for an event or id with a
+	// line break, which would corrupt the stream
+	ErrSSEInvalidField = errors.New("sse: event & id can't have line breaks")
+	// ErrSSEClosed is returned by Send once the handler has returned
+	ErrSSEClosed = errors.New("sse: stream is closed")
+)
+
+type (
+	// SSEWriter writes events to the stream of a Server-Sent Events
+	// handler. It is safe for concurrent use
+	SSEWriter interface {
+		// Send writes the event & flushes it to the client. event & id are
+		// optional, data is sent as is, split in lines. It fails once the
+		// client has gone away
+		Send(event, id string, data []byte) error
+	}
+
+	// SSEHandlerFunc streams events until it returns or ctx is done, i.e.
+	// the client has disconnected. An error returned before anything was
+	// sent is encoded as the response, the stream is cut short otherwise
+	SSEHandlerFunc func(ctx context.Context, req *net_http.Request, stream SSEWriter) error
+
+	// SSEOption customises the SSE handler
+	SSEOption func(*sseHandler)
+
+	sseHandler struct {
+		fn        SSEHandlerFunc
+		heartbeat time.Duration
+		errorFn   func(context.Context, error)
+	}
+
+	// SSEEvent is an event streamed by ResponseWithSSE, ID & Event are
+	// optional
+	SSEEvent struct {
+		ID    string
+		Event string
+		Data  string
+	}
+
+	// sseBody reads the events as the frames of the stream
+	sseBody struct {
+		cx     context.Context
+		events <-chan SSEEvent
+		frame  []byte
+	}
+
+	sseWriter struct {
+		mu      sync.Mutex
+		cx      context.Context
+		w       net_http.ResponseWriter
+		rc      *net_http.ResponseController
+		http1   bool
+		started bool
+		closed  bool
+	}
+)
+
+// WithSSEHeartbeat sets the interval of the comments sent to keep idle
+// connections from being closed by proxies, defaults to 15s. Zero or less
+// disables them
+func WithSSEHeartbeat(d time.Duration) SSEOption {
+	return func(sh *sseHandler) { sh.heartbeat = d }
+}
+
+// WithSSEErrorHandler sets the handler for errors returned after the
+// stream has started, they are ignored by default
+func WithSSEErrorHandler(fn func(context.Context, error)) SSEOption {
+	return func(sh *sseHandler) { sh.errorFn = fn }
+}
+
+// start writes the header, must be called with the lock held
+func (sw *sseWriter) start() {
+	if sw.started {
+		return
+	}
+
+	hdr := sw.w.Header()
+	hdr.Set(HeaderContentType, MIMEEventStream)
+	hdr.Set(HeaderCacheControl, "no-cache")
+	if sw.http1 {
+		// connection specific headers are invalid in HTTP/2
+		hdr.Set("Connection", "keep-alive")
+	}
+	// compression buffers the events, GzipCompressionFilter leaves
+	// responses with an encoding alone
+	hdr.Set("Content-Encoding", "identity")
+	// and so does nginx
+	hdr.Set("X-Accel-Buffering", "no")
+	hdr.Del("Content-Length")
+
+	// streams outlive the write timeout of the server
+	_ = sw.rc.SetWriteDeadline(time.Time{})
+
+	sw.w.WriteHeader(net_http.StatusOK)
+	sw.started = true
+}
+
+// write writes the frame & flushes it
+func (sw *sseWriter) write(frame []byte) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return ErrSSEClosed
+	}
+
+	if err := sw.cx.Err(); err != nil {
+		return err
+	}
+
+	sw.start()
+
+	if _, err := sw.w.Write(frame); err != nil {
+		return err
+	}
+	return sw.rc.Flush()
+}
+
+// sseFrame formats the event for the stream
+func sseFrame(event, id string, data []byte) ([]byte, error) {
+	if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n") {
+		return nil, ErrSSEInvalidField
+	}
+
+	var buf bytes.Buffer
+	if id != "" {
+		buf.WriteString("id: " + id + "\n")
+	}
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func (sw *sseWriter) Send(event, id string, data []byte) error {
+	frame, err := sseFrame(event, id, data)
+	if err != nil {
+		return err
+	}
+	return sw.write(frame)
+}
+
+// close stops the writes & reports if the stream had started
+func (sw *sseWriter) close() bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.closed = true
+	return sw.started
+}
+
+func (sh *sseHandler) ServeHTTP(w net_http.ResponseWriter, r *net_http.Request) {
+	var (
+		cx = r.Context()
+		sw = &sseWriter{
+			cx: cx, w: w, rc: net_http.NewResponseController(w), http1: r.ProtoMajor == 1,
+		}
+	)
+
+	done := make(chan struct{})
+	if sh.heartbeat > 0 {
+		go func() {
+			ticker := time.NewTicker(sh.heartbeat)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					if sw.write([]byte(": ping\n\n")) != nil {
+						return
+					}
+				case <-done:
+					return
+				case <-cx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	err := sh.fn(cx, r, sw)
+	close(done)
+
+	started := sw.close()
+	switch {
+	case err == nil:
+		if !started {
+			w.WriteHeader(net_http.StatusNoContent)
+		}
+	case !started:
+		kit_http.DefaultErrorEncoder(cx, err, w)
+	case sh.errorFn != nil && cx.Err() == nil:
+		sh.errorFn(cx, err)
+	}
+}
+
+// SSEHandler returns a handler streaming Server-Sent Events written by fn,
+// e.g.
+//
+//	http.SSEHandler(func(cx context.Context, r *net_http.Request, stream http.SSEWriter) error {
+//		for {
+//			select {
+//			case <-cx.Done():
+//				return nil
+//			case ev := <-updates:
+//				if err := stream.Send("update", ev.ID, ev.Data); err != nil {
+//					return err
+//				}
+//			}
+//		}
+//	})
+//
+// The stream starts with the first event or heartbeat, with the headers
+// for SSE & without compression or a write deadline. A fn returning
+// without sending anything results in 204 No Content
+func SSEHandler(fn SSEHandlerFunc, options ...SSEOption) net_http.Handler {
+	sh := &sseHandler{fn: fn, heartbeat: defaultSSEHeartbeat}
+	for _, o := range options {
+		o(sh)
+	}
+	return sh
+}
+
+// SSE registers a Server-Sent Events handler for GET requests on url. The
+// HandlerOptions of the transport don't apply, transport filters do.
+// Errors after the stream has started are logged at debug
+func (tr *Transport) SSE(url string, fn SSEHandlerFunc, options ...SSEOption) {
+	options = append([]SSEOption{WithSSEErrorHandler(func(_ context.Context, err error) {
+		tr.logger.Debug("sse stream failed", log.String("url", url), log.Error(err))
+	})}, options...)
+
+	tr.muxer.Handler(net_http.MethodGet, url, SSEHandler(fn, options...))
+}
+
+// Read returns a frame at a time, for each to be flushed on its own
+func (sb *sseBody) Read(p []byte) (int, error) {
+	if len(sb.frame) == 0 {
+		select {
+		case <-sb.cx.Done():
+			return 0, io.EOF
+		case ev, ok := <-sb.events:
+			if !ok {
+				return 0, io.EOF
+			}
+
+			frame, err := sseFrame(ev.Event, ev.ID, []byte(ev.Data))
+			if err != nil {
+				return 0, err
+			}
+			sb.frame = frame
+		}
+	}
+
+	n := copy(p, sb.frame)
+	sb.frame = sb.frame[n:]
+	return n, nil
+}
+
+func (sb *sseBody) Close() error { return nil }
+
+// BindResponseWriter implements responseWriterBinder, the encoder flushes
+// every write of the bound bodies
+func (sb *sseBody) BindResponseWriter(w net_http.ResponseWriter) {
+	// streams outlive the write timeout of the server
+	_ = net_http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
+
+// ResponseWithSSE streams the events as Server-Sent Events with the
+// default encoder, e.g.
+//
+//	events := make(chan http.SSEEvent)
+//	go func() {
+//		defer close(events)
+//		for update := range updates {
+//			select {
+//			case events <- http.SSEEvent{Event: "update", Data: update}:
+//			case <-cx.Done():
+//				return
+//			}
+//		}
+//	}()
+//	return http.NewResponse(req, http.ResponseWithSSE(events)), nil
+//
+// Each event is flushed once written. The stream ends when events is
+// closed or the client disconnects, after which events isn't read, the
+// producer has to stop on the context of the request. See SSEHandler for
+// heartbeats
+func ResponseWithSSE(events <-chan SSEEvent) ResponseOption {
+	return func(res *net_http.Response) {
+		cx := context.Background()
+		if res.Request != nil {
+			cx = res.Request.Context()
+		}
+
+		if res.Header == nil {
+			res.Header = make(net_http.Header)
+		}
+
+		res.Header.Set(HeaderContentType, MIMEEventStream)
+		res.Header.Set(HeaderCacheControl, "no-cache")
+		// as for SSEHandler, neither compression nor nginx buffer it
+		res.Header.Set("Content-Encoding", "identity")
+		res.Header.Set("X-Accel-Buffering", "no")
+
+		res.Body = &sseBody{cx: cx, events: events}
+	}
+}
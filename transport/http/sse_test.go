@@ -0,0 +1,195 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// readEvents reads n events or comments off the stream
+func readEvents(t *testing.T, rd *bufio.Reader, n int) []string {
+	t.Helper()
+
+	var (
+		events []string
+		ev     strings.Builder
+	)
+
+	for len(events) < n {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read events: %v, got %q", err, events)
+		}
+
+		if line == "\n" {
+			events = append(events, ev.String())
+			ev.Reset()
+			continue
+		}
+		ev.WriteString(line)
+	}
+	return events
+}
+
+// disconnecting returns next ending the requests as the server does when
+// the client disconnects, with their context cancelled by the funcs sent,
+// so the tests don't depend on when the server notices a closed connection
+func disconnecting(next net_http.Handler) (net_http.Handler, <-chan context.CancelFunc) {
+	disconnects := make(chan context.CancelFunc, 1)
+
+	return net_http.HandlerFunc(func(w net_http.ResponseWriter, r *net_http.Request) {
+		cx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		disconnects <- cancel
+		next.ServeHTTP(w, r.WithContext(cx))
+	}), disconnects
+}
+
+func TestSSEHandler(t *testing.T) {
+	stopped := make(chan error, 1)
+
+	h := SSEHandler(func(cx context.Context, _ *net_http.Request, stream SSEWriter) error {
+		for i, data := range []string{"one", "two\nlines"} {
+			if err := stream.Send("update", string(rune('1'+i)), []byte(data)); err != nil {
+				return err
+			}
+		}
+
+		<-cx.Done()
+		stopped <- stream.Send("update", "", []byte("late"))
+		return nil
+	}, WithSSEHeartbeat(20*time.Millisecond))
+
+	handler, disconnects := disconnecting(chain(h, GzipCompressionFilter(5, MIMEEventStream)))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	req, _ := net_http.NewRequest(net_http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := net_http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer res.Body.Close()
+
+	for k, want := range map[string]string{
+		HeaderContentType:  MIMEEventStream,
+		HeaderCacheControl: "no-cache",
+		"Content-Encoding": "identity",
+	} {
+		if got := res.Header.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	rd := bufio.NewReader(res.Body)
+
+	got := readEvents(t, rd, 3)
+	want := []string{
+		"id: 1\nevent: update\ndata: one\n",
+		"id: 2\nevent: update\ndata: two\ndata: lines\n",
+		": ping\n",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event #%d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	(<-disconnects)()
+
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Send() after disconnect = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler didn't stop on disconnect")
+	}
+}
+
+func TestSSEHandlerErrorBeforeStream(t *testing.T) {
+	h := SSEHandler(func(context.Context, *net_http.Request, SSEWriter) error {
+		return NewHTTPError(net_http.StatusNotFound, "", "no such stream")
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(net_http.MethodGet, "/", nil))
+
+	if rec.Code != net_http.StatusNotFound || rec.Header().Get(HeaderContentType) == MIMEEventStream {
+		t.Errorf("response = %d %q, want the error encoded", rec.Code, rec.Header().Get(HeaderContentType))
+	}
+
+	if err := (&sseWriter{}).Send("a\nb", "", nil); err != ErrSSEInvalidField {
+		t.Errorf("Send() with a line break = %v, want ErrSSEInvalidField", err)
+	}
+}
+
+func TestResponseWithSSE(t *testing.T) {
+	tr, err := NewHTTPTransport("test", WithCustomLogger(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	stopped := make(chan struct{})
+	tr.Get("/events", func(cx context.Context, req *net_http.Request) (*net_http.Response, error) {
+		events := make(chan SSEEvent)
+		go func() {
+			defer close(stopped)
+			for i := 1; ; i++ {
+				select {
+				case events <- SSEEvent{ID: strconv.Itoa(i), Event: "tick", Data: "n\n" + strconv.Itoa(i)}:
+				case <-cx.Done():
+					return
+				}
+			}
+		}()
+		return NewResponse(req, ResponseWithSSE(events)), nil
+	})
+
+	handler, disconnects := disconnecting(tr.Handler)
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	res, err := net_http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get(HeaderContentType); ct != MIMEEventStream {
+		t.Errorf("Content-Type = %q, want %q", ct, MIMEEventStream)
+	}
+
+	// each is flushed as it is sent, the stream never ends
+	got := readEvents(t, bufio.NewReader(res.Body), 2)
+	want := []string{
+		"id: 1\nevent: tick\ndata: n\ndata: 1\n",
+		"id: 2\nevent: tick\ndata: n\ndata: 2\n",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event #%d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	(<-disconnects)()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("producer didn't stop on disconnect")
+	}
+}
@@ -0,0 +1,240 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	net_http "net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const staticIndex = "index.html"
+
+type (
+	// StaticOption customises the files served by Static & SPA
+	StaticOption func(*staticHandler)
+
+	staticHandler struct {
+		fsys    fs.FS
+		listing net_http.Handler
+
+		maxAge    time.Duration
+		noListing bool
+
+		// fallback is the file served for unknown paths, SPA only
+		fallback string
+
+		etags sync.Map // name -> staticETag
+	}
+
+	// staticETag is the ETag of a file, as long as it isn't modified
+	staticETag struct {
+		modTime time.Time
+		size    int64
+		etag    string
+	}
+)
+
+// WithCacheControl sets the max-age of the files served, no Cache-Control
+// is set by default. The index of an SPA is always served with no-cache,
+// so new deployments show up
+func WithCacheControl(maxAge time.Duration) StaticOption {
+	return func(sh *staticHandler) { sh.maxAge = maxAge }
+}
+
+// WithoutDirectoryListing answers 404 for directories without an index,
+// instead of listing the files in them
+func WithoutDirectoryListing() StaticOption {
+	return func(sh *staticHandler) { sh.noListing = true }
+}
+
+// containsDotDot is true for paths with a `..` element
+func containsDotDot(p string) bool {
+	if !strings.Contains(p, "..") {
+		return false
+	}
+
+	for _, el := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if el == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// etag of the file, computed once per modification
+func (sh *staticHandler) etag(name string, fi fs.FileInfo, f fs.File) (string, io.ReadSeeker, error) {
+	if v, ok := sh.etags.Load(name); ok {
+		if se := v.(staticETag); se.modTime.Equal(fi.ModTime()) && se.size == fi.Size() {
+			if rs, ok := f.(io.ReadSeeker); ok {
+				return se.etag, rs, nil
+			}
+		}
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	sh.etags.Store(name, staticETag{fi.ModTime(), fi.Size(), etag})
+	return etag, bytes.NewReader(data), nil
+}
+
+// serveFile writes the file with its content type & ETag, Last-Modified if
+// the file system has modification times. embed.FS doesn't
+func (sh *staticHandler) serveFile(w net_http.ResponseWriter, r *net_http.Request, name, cacheControl string) {
+	f, err := sh.fsys.Open(name)
+	if err != nil {
+		sh.notFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		net_http.Error(w, "500 internal server error", net_http.StatusInternalServerError)
+		return
+	}
+
+	etag, content, err := sh.etag(name, fi, f)
+	if err != nil {
+		net_http.Error(w, "500 internal server error", net_http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(HeaderETag, etag)
+	if cacheControl != "" {
+		w.Header().Set(HeaderCacheControl, cacheControl)
+	}
+
+	net_http.ServeContent(w, r, fi.Name(), fi.ModTime(), content)
+}
+
+func (sh *staticHandler) notFound(w net_http.ResponseWriter, r *net_http.Request) {
+	if sh.fallback != "" {
+		sh.serveFile(w, r, sh.fallback, "no-cache")
+		return
+	}
+	net_http.NotFound(w, r)
+}
+
+func (sh *staticHandler) ServeHTTP(w net_http.ResponseWriter, r *net_http.Request) {
+	upath := r.URL.Path
+	if !strings.HasPrefix(upath, "/") {
+		upath = "/" + upath
+	}
+
+	if containsDotDot(upath) {
+		net_http.Error(w, "invalid URL path", net_http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(upath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	var cacheControl string
+	if sh.maxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(sh.maxAge.Seconds()))
+	}
+
+	fi, err := fs.Stat(sh.fsys, name)
+	switch {
+	case err != nil:
+		sh.notFound(w, r)
+	case !fi.IsDir():
+		sh.serveFile(w, r, name, cacheControl)
+	case !strings.HasSuffix(upath, "/"):
+		// relative links in the index need the slash
+		net_http.Redirect(w, r, path.Base(upath)+"/", net_http.StatusMovedPermanently)
+	default:
+		index := path.Join(name, staticIndex)
+		if _, err := fs.Stat(sh.fsys, index); err == nil {
+			if index == sh.fallback {
+				cacheControl = "no-cache"
+			}
+			sh.serveFile(w, r, index, cacheControl)
+			return
+		}
+
+		if sh.noListing || sh.fallback != "" {
+			sh.notFound(w, r)
+			return
+		}
+
+		sh.listing.ServeHTTP(w, r)
+	}
+}
+
+// mount registers sh for GET & HEAD requests under prefix
+func (tr *Transport) mount(prefix string, sh *staticHandler) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	var (
+		hn    = net_http.StripPrefix(prefix, sh)
+		slash = net_http.RedirectHandler(prefix+"/", net_http.StatusMovedPermanently)
+	)
+
+	for _, method := range []string{net_http.MethodGet, net_http.MethodHead} {
+		tr.muxer.Handler(method, prefix+"/*", hn)
+		if prefix != "" {
+			tr.muxer.Handler(method, prefix, slash)
+		}
+	}
+}
+
+func newStaticHandler(fsys fs.FS, options ...StaticOption) *staticHandler {
+	sh := &staticHandler{
+		fsys:    fsys,
+		listing: net_http.FileServer(net_http.FS(fsys)),
+	}
+
+	for _, o := range options {
+		o(sh)
+	}
+	return sh
+}
+
+// Static serves the files of fsys for GET & HEAD requests under prefix,
+// e.g. an embedded frontend
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	sub, _ := fs.Sub(dist, "dist")
+//	tr.Static("/assets", sub, http.WithCacheControl(24*time.Hour))
+//
+// Files are served with their Content-Type & an ETag, directories with
+// their index.html or a listing. Paths with `..` are refused.
+// The mount is a catch-all route, routes registered on the transport under
+// prefix take precedence with the default muxer. HandlerOptions of the
+// transport don't apply, transport filters do
+func (tr *Transport) Static(prefix string, fsys fs.FS, options ...StaticOption) {
+	tr.mount(prefix, newStaticHandler(fsys, options...))
+}
+
+// SPA serves a single page application from fsys under prefix like Static,
+// the paths not found in fsys are answered with indexFile so routing on
+// the client works, e.g. `/app/users/1` is answered with it.
+// indexFile is served with `Cache-Control: no-cache` & the directories
+// aren't listed
+func (tr *Transport) SPA(prefix string, fsys fs.FS, indexFile string, options ...StaticOption) {
+	sh := newStaticHandler(fsys, options...)
+	sh.fallback = strings.TrimPrefix(path.Clean("/"+indexFile), "/")
+
+	tr.mount(prefix, sh)
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"io"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestStatic(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<html>spa</html>")},
+		"app.js":        {Data: []byte("console.log(1)")},
+		"docs/a.css":    {Data: []byte("body{}")},
+		"docs/b/c.html": {Data: []byte("c")},
+	}
+
+	tr, err := NewHTTPTransport("test", WithCustomLogger(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Get("/api/ping", func(context.Context, *net_http.Request) (*net_http.Response, error) {
+		return &net_http.Response{StatusCode: net_http.StatusOK, Body: net_http.NoBody}, nil
+	})
+	tr.Static("/assets", fsys, WithCacheControl(time.Hour), WithoutDirectoryListing())
+	tr.SPA("/", fsys, "index.html")
+
+	srv := httptest.NewServer(tr.Handler)
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		status       int
+		body         string
+		contentType  string
+		cacheControl string
+	}{
+		{"file", "/assets/app.js", 200, "console.log(1)", "text/javascript; charset=utf-8", "public, max-age=3600"},
+		{"nested", "/assets/docs/a.css", 200, "body{}", "text/css; charset=utf-8", "public, max-age=3600"},
+		{"missing", "/assets/nope.js", 404, "", "", ""},
+		{"no listing", "/assets/docs/b/", 404, "", "", ""},
+		{"traversal", "/assets/docs/..%2f..%2fapp.js", 400, "", "", ""},
+		{"spa root", "/", 200, "<html>spa</html>", "text/html; charset=utf-8", "no-cache"},
+		{"spa route", "/users/1", 200, "<html>spa</html>", "text/html; charset=utf-8", "no-cache"},
+		{"spa file", "/app.js", 200, "console.log(1)", "text/javascript; charset=utf-8", ""},
+		{"api", "/api/ping", 200, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := net_http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+			if tt.status != 200 {
+				return
+			}
+
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			if got := res.Header.Get(HeaderContentType); tt.contentType != "" && got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := res.Header.Get(HeaderCacheControl); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+		})
+	}
+
+	t.Run("etag", func(t *testing.T) {
+		res, err := net_http.Get(srv.URL + "/assets/app.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+
+		etag := res.Header.Get(HeaderETag)
+		if etag == "" {
+			t.Fatal("ETag not set")
+		}
+
+		req, _ := net_http.NewRequest(net_http.MethodGet, srv.URL+"/assets/app.js", nil)
+		req.Header.Set(HeaderIfNoneMatch, etag)
+
+		res, err = net_http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+
+		if res.StatusCode != net_http.StatusNotModified {
+			t.Errorf("status = %d, want %d", res.StatusCode, net_http.StatusNotModified)
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	http "net/http"
 	"time"
 
+	"github.com/unbxd/go-base/v2/journal"
 	"github.com/unbxd/go-base/v2/log"
 )
 
@@ -25,25 +26,114 @@ type (
 		muxer Muxer
 
 		handlerOptions []HandlerOption
+
+		// descriptors of the registered routes by `METHOD path`
+		routes               map[string]*RouteDescriptor
+		names                map[string]string // route name -> path
+		strictHandlerOptions bool
+
+		journal *journal.Journal
+
+		watchdog *watchdog
+
+		// open websocket connections, nil without websocket routes
+		websockets *websocketConns
+
+		drain           *drainer
+		shutdownTimeout time.Duration
+
+		// GET routes serve HEAD too
+		autoHead bool
+
+		// bounds the requests served at once, nil doesn't
+		inflight *inflight
+
+		// components reporting on the health endpoint
+		health healthReporters
+		// checks of the health endpoint
+		checker *HealthChecker
 	}
 )
 
 // Mux returns the default multiplexer
 func (tr *Transport) Mux() Muxer { return tr.muxer }
 
-// Open starts the Transport
+// Open starts the Transport, serving HTTPS if it has a TLS config, see
+// WithTLS & WithTLSConfig. The address & the limits of the server are
+// logged first
 func (tr *Transport) Open() error {
+	tr.report()
+
+	if tr.TLSConfig != nil {
+		// the certificates are in the config
+		return tr.ListenAndServeTLS("", "")
+	}
 	return tr.ListenAndServe()
 }
 
-// Close shuts down Transport
+// report logs the address & the limits the server starts with
+func (tr *Transport) report() {
+	maxHeaderBytes := tr.MaxHeaderBytes
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+
+	tr.logger.Info(
+		"starting http transport",
+		log.String("name", tr.name),
+		log.String("addr", tr.Addr),
+		log.Bool("tls", tr.TLSConfig != nil),
+		log.Duration("read_timeout", tr.ReadTimeout),
+		log.Duration("write_timeout", tr.WriteTimeout),
+		log.Duration("idle_timeout", tr.IdleTimeout),
+		log.Duration("shutdown_timeout", tr.shutdownTimeout),
+		log.Bytes("max_header_bytes", int64(maxHeaderBytes)),
+		log.Int("routes", len(tr.routes)),
+	)
+}
+
+// Close shuts down Transport, waiting for the requests in flight as long as
+// set by WithShutdownTimeout. See CloseWithContext
 func (tr *Transport) Close() error {
 	ctx, cancel := context.WithTimeout(
-		context.Background(), 100*time.Second,
+		context.Background(), tr.shutdownTimeout,
 	)
 
 	defer cancel()
-	return tr.Shutdown(ctx)
+
+	return tr.CloseWithContext(ctx)
+}
+
+// CloseWithContext shuts down Transport, waiting for the requests in flight
+// until ctx is done. The requests coming in meanwhile, new connections
+// included, are answered with 503 & the connection is closed, so the
+// clients go to other instances, e.g. once the pod is removed from the
+// endpoints of the service on Kubernetes. Heartbeats fail as well.
+// The listener is closed once the requests in flight are done. Websocket
+// & SSE streams aren't waited for, they are closed on shutdown
+func (tr *Transport) CloseWithContext(ctx context.Context) error {
+	err := tr.drain.drain(ctx)
+
+	if serr := tr.Shutdown(ctx); err == nil {
+		err = serr
+	}
+
+	// hijacked connections aren't waited for by Shutdown
+	if tr.websockets != nil {
+		if werr := tr.websockets.close(ctx); err == nil {
+			err = werr
+		}
+	}
+
+	if tr.watchdog != nil {
+		tr.watchdog.close()
+	}
+
+	// requests which didn't finish in time still write to the journal
+	if err == nil && tr.journal != nil {
+		err = tr.journal.Close()
+	}
+	return err
 }
 
 // NewTransport returns a new transport
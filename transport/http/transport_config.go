@@ -1,11 +1,14 @@
 package http
 
 import (
+	"crypto/tls"
 	"net/http"
 	"time"
 
 	kit_http "github.com/go-kit/kit/transport/http"
+	"github.com/unbxd/go-base/v2/journal"
 	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/notifier"
 )
 
 type (
@@ -53,6 +56,48 @@ type (
 		muxOptions []ChiMuxOption
 
 		panicFormatter PanicFormatter
+
+		// crash journal, disabled when path is empty
+		journalPath     string
+		journalSlots    int
+		journalNotifier notifier.Notifier
+
+		// slow request watchdog, disabled with CaptureOff
+		watchdogThreshold time.Duration
+		watchdogMode      CaptureMode
+		watchdogOptions   []WatchdogOption
+
+		// how long Close waits for the requests in flight
+		shutdownTimeout time.Duration
+
+		// resolves the IP of the client, nil doesn't
+		clientIP *ClientIPResolver
+
+		// bounds the requests served at once, nil doesn't
+		inflight *inflight
+
+		// bounds every request, nil doesn't
+		requestTimeout *requestTimeout
+
+		// serves the routes as JSON, disabled when empty
+		routeDebugPath string
+
+		// serves the health of the process, disabled when empty
+		healthPath string
+		// runs the checks of the health endpoint, nil for a new one
+		healthChecker *HealthChecker
+
+		// 405 for the known paths, 404 otherwise
+		methodNotAllowed bool
+		// HEAD served by the GET routes
+		autoHead bool
+
+		// HTTP/2 without TLS
+		h2c bool
+
+		// https, plain http without either
+		tlsCertFile, tlsKeyFile string
+		tlsConfig               *tls.Config
 	}
 
 	TransportConfigOption func(*config) error
@@ -71,7 +116,7 @@ func (kvs keyValues) tags() []string {
 	return ts
 }
 
-func (c *config) filters() []Filter {
+func (c *config) filters(dr *drainer, jr *journal.Journal, wd *watchdog) []Filter {
 	// default filters available by default to all routes
 	filters := []Filter{
 		noopFilter(),
@@ -80,49 +125,133 @@ func (c *config) filters() []Filter {
 			WithCustomFormatter(c.panicFormatter),
 			WithStack(1024*8, false),
 		),
+		dr.filter(),                           // turns requests away on shutdown, heartbeats too
 		heartbeatFilter(c.name, c.heartbeats), // heartbeats for filter
 		serverNameFilter(c.name, c.version),
 		wrappedResponseWriterFilter(), // wraps response for easy status access
 		decorateContextFilter(),
 		requestIDFilter(),
 	}
+
+	if c.clientIP != nil {
+		filters = append(filters, ClientIPFilter(c.clientIP))
+	}
+
+	if c.inflight != nil {
+		// after the heartbeats, they are answered under load
+		filters = append(filters, c.inflight.filter())
+	}
+
+	if jr != nil {
+		// after requestIDFilter, to have the request id
+		filters = append(filters, crashJournalFilter(jr))
+	}
+
+	if wd != nil {
+		filters = append(filters, wd.filter())
+	}
 	return filters
 }
 
 func (c *config) build() (*Transport, error) {
+	tlsConfig, err := c.tls()
+	if err != nil {
+		return nil, err
+	}
+
+	// the options of the application come after the defaults
+	muxOptions := append(
+		[]ChiMuxOption{methodNotAllowedChiMuxOption(c.methodNotAllowed)},
+		c.muxOptions...,
+	)
+
 	tr := &Transport{
 		Server: &http.Server{
 			Addr:         c.host + ":" + c.port,
 			IdleTimeout:  c.idleTimeout,
 			ReadTimeout:  c.readTimeout,
 			WriteTimeout: c.writeTimeout,
+			TLSConfig:    tlsConfig,
 		},
 
 		name:           c.name,
 		logger:         c.logger,
-		muxer:          newChiMux(c.muxOptions...),
+		muxer:          newChiMux(muxOptions...),
 		handlerOptions: []HandlerOption{},
+
+		drain:           &drainer{},
+		shutdownTimeout: c.shutdownTimeout,
+		autoHead:        c.autoHead,
+		inflight:        c.inflight,
+		checker:         c.healthChecker,
 	}
 
 	for _, fn := range c.transportOptions {
 		fn(tr)
 	}
 
+	if c.journalPath != "" {
+		jr, err := openCrashJournal(
+			c.logger, c.journalNotifier, c.journalPath, c.journalSlots,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tr.journal = jr
+	}
+
+	if c.watchdogMode != CaptureOff {
+		tr.watchdog = newWatchdog(
+			c.logger, c.watchdogThreshold, c.watchdogMode, c.watchdogOptions...,
+		)
+	}
+
 	tr.muxer.Use(c.ffs...)
 
-	tr.Handler = chain(tr.muxer, c.filters()...)
+	if c.requestTimeout != nil {
+		// after the filters of the application, their access logs &
+		// metrics see the response served on timeout
+		tr.muxer.Use(c.requestTimeout.filter())
+	}
+
+	if c.routeDebugPath != "" {
+		tr.muxer.Handler(http.MethodGet, c.routeDebugPath, routeDebugHandler(tr))
+	}
+
+	if tr.checker == nil {
+		tr.checker = NewHealthChecker(0)
+	}
+
+	if c.healthPath != "" {
+		tr.muxer.Handler(http.MethodGet, c.healthPath, healthHandler(tr))
+	}
+
+	tr.Handler = chain(tr.muxer, c.filters(tr.drain, tr.journal, tr.watchdog)...)
+
+	if c.h2c {
+		if err := tr.serveH2C(); err != nil {
+			return nil, err
+		}
+	}
 
 	return tr, nil
 }
 
-func newConfig(name string) *config {
-
-	logger, _ := log.NewZeroLogger(
-		log.ZeroLoggerWithAsyncSink(1000, 2, nil),
-		log.ZeroLoggerWithFields(log.String("server", name)),
-		log.ZeroLoggerWithLevel("error"),
-	)
+// defaultLogger returns the logger, building the default one if none is
+// set. It is built on first use, its async sink runs a goroutine which
+// isn't needed once WithCustomLogger or WithLogger set another
+func (c *config) defaultLogger() log.Logger {
+	if c.logger == nil {
+		c.logger, _ = log.NewZeroLogger(
+			log.ZeroLoggerWithAsyncSink(1000, 2, nil),
+			log.ZeroLoggerWithFields(log.String("server", c.name)),
+			log.ZeroLoggerWithLevel("error"),
+		)
+	}
+	return c.logger
+}
 
+func newConfig(name string) *config {
 	return &config{
 		name:         name,
 		version:      "v0.0.0",
@@ -132,7 +261,6 @@ func newConfig(name string) *config {
 		idleTimeout:  90 * time.Second,
 		readTimeout:  5 * time.Second,
 		writeTimeout: 10 * time.Second,
-		logger:       logger,
 		transportOptions: []TransportOption{
 			WithHandlerOption(
 				NewErrorEncoderHandlerOptions(kit_http.DefaultErrorEncoder),
@@ -141,6 +269,11 @@ func newConfig(name string) *config {
 		ffs:            []Filter{},
 		muxOptions:     []ChiMuxOption{},
 		panicFormatter: &textPanicFormatter{},
+
+		shutdownTimeout: defaultShutdownTimeout,
+
+		methodNotAllowed: true,
+		autoHead:         true,
 	}
 }
 
@@ -158,5 +291,6 @@ func NewHTTPTransport(
 		}
 	}
 
+	cfg.defaultLogger()
 	return cfg.build()
 }
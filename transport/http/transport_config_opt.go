@@ -115,6 +115,7 @@ func WithOpenTelemetryMetrics(
 // WithCustomMetrics lets you use `metrics.Counter`, `metrics.Histogram` & `metrics.Gauge` interfaces
 // instead of relying on some third party interfaces. Not passing custom formatter will result in
 // default formatter being used.
+// The provider is also used by handler level metrics, see HandlerWithMetricsProvider.
 func WithCustomMetrics(
 	enabled bool,
 	provider metrics.Provider,
@@ -127,6 +128,11 @@ func WithCustomMetrics(
 				provider,
 				formatter,
 			))
+
+			c.transportOptions = append(
+				c.transportOptions,
+				WithHandlerOption(HandlerWithMetricsProvider(provider)),
+			)
 		}
 		return
 	}
@@ -194,7 +200,20 @@ func WithDefaultPanicFormatter(panicFormatterType PanicFormatterType) TransportC
 
 func WithTraceLogging(fieldsGens ...TraceLogFieldsGen) TransportConfigOption {
 	return func(c *config) error {
-		c.ffs = append(c.ffs, TraceLoggingFilter(c.logger, fieldsGens...))
+		c.ffs = append(c.ffs, TraceLoggingFilter(c.defaultLogger(), fieldsGens...))
+		return nil
+	}
+}
+
+// WithShutdownTimeout sets how long Close waits for the requests in flight,
+// defaults to 100s. See CloseWithContext
+func WithShutdownTimeout(d time.Duration) TransportConfigOption {
+	return func(c *config) error {
+		if d <= 0 {
+			return ErrInvalidShutdownTimeout
+		}
+
+		c.shutdownTimeout = d
 		return nil
 	}
 }
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"github.com/unbxd/go-base/v2/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// WithH2C serves HTTP/2 without TLS (h2c), to the clients connecting with
+// HTTP/2 directly (prior knowledge) or upgrading from HTTP/1.1, e.g. for
+// streaming behind an L4 load balancer. HTTP/1.1 clients are served as
+// before, the requests of both go through the same filters, heartbeats
+// included. On Close the HTTP/2 connections get a GOAWAY, they aren't
+// waited for by the shutdown
+func WithH2C() TransportConfigOption {
+	return func(c *config) error {
+		c.h2c = true
+		return nil
+	}
+}
+
+// serveH2C wraps the handler of the transport to serve h2c
+func (tr *Transport) serveH2C() error {
+	h2s := &http2.Server{IdleTimeout: tr.IdleTimeout}
+
+	// sends GOAWAY on shutdown, it sets a TLS config on servers without
+	// one, with which Open would serve HTTPS
+	tlsConfig := tr.TLSConfig
+	if err := http2.ConfigureServer(tr.Server, h2s); err != nil {
+		return errors.Wrap(err, "configure http2 failed")
+	}
+	tr.TLSConfig = tlsConfig
+
+	tr.Handler = h2c.NewHandler(tr.Handler, h2s)
+	return nil
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	net_http "net/http"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+	"golang.org/x/net/http2"
+)
+
+func TestWithH2C(t *testing.T) {
+	port := freePort(t)
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithCustomHostPort("127.0.0.1", port),
+		WithH2C(),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.Get("/proto", func(_ context.Context, req *net_http.Request) (*net_http.Response, error) {
+		return NewResponse(req, ResponseWithBytes([]byte(req.Proto))), nil
+	})
+
+	if tr.TLSConfig != nil {
+		t.Fatalf("TLSConfig is set, Open would serve HTTPS")
+	}
+
+	go func() { _ = tr.Open() }()
+	defer tr.Close()
+
+	h2 := &net_http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(cx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(cx, network, addr)
+		},
+	}}
+
+	tests := []struct {
+		name   string
+		client *net_http.Client
+		path   string
+		want   int
+	}{
+		{"h2c", h2, "/proto", 2},
+		{"h2c heartbeat", h2, "/ping", 2},
+		{"http/1.1", &net_http.Client{}, "/proto", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res *net_http.Response
+			for i := 0; i < 100; i++ {
+				if res, err = tt.client.Get("http://127.0.0.1:" + port + tt.path); err == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			_ = res.Body.Close()
+
+			if res.StatusCode != net_http.StatusOK || res.ProtoMajor != tt.want {
+				t.Errorf("Get() = %d over %s, want 200 over HTTP/%d", res.StatusCode, res.Proto, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import net_http "net/http"
 
 // Get handles GET request
 func (tr *Transport) Get(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodGet, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodGet, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // GET provides flexible interface for handling request for GET method
@@ -19,7 +19,7 @@ func (tr *Transport) GET(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodGet,
 		uri,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -28,7 +28,7 @@ func (tr *Transport) GET(
 
 // Put handles PUT request
 func (tr *Transport) Put(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodPut, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodPut, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // PUT provides flexible interface for handling request for put method
@@ -43,7 +43,7 @@ func (tr *Transport) PUT(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodPut,
 		url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -52,7 +52,7 @@ func (tr *Transport) PUT(
 
 // Post handles POST request
 func (tr *Transport) Post(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodPost, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodPost, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // POST provides flexible interface for handling request for post method
@@ -67,7 +67,7 @@ func (tr *Transport) POST(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodPost,
 		url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -76,7 +76,7 @@ func (tr *Transport) POST(
 
 // Delete handles DELETE request
 func (tr *Transport) Delete(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodDelete, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodDelete, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // DELETE provides flexible interface for handling request for delete method
@@ -91,7 +91,7 @@ func (tr *Transport) DELETE(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodDelete,
 		url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -100,7 +100,7 @@ func (tr *Transport) DELETE(
 
 // Patch handles PATCH request
 func (tr *Transport) Patch(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodPatch, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodPatch, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // PATCH provides flexible interface for handling request for patch method
@@ -115,7 +115,7 @@ func (tr *Transport) PATCH(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodPatch,
 		url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -124,7 +124,7 @@ func (tr *Transport) PATCH(
 
 // Options handles OPTIONS request
 func (tr *Transport) Options(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodOptions, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodOptions, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // OPTION provides flexible interface for handling request for option method
@@ -139,7 +139,7 @@ func (tr *Transport) OPTION(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodOptions,
 		url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -148,7 +148,7 @@ func (tr *Transport) OPTION(
 
 // Head handles HEAD request
 func (tr *Transport) Head(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodHead, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodHead, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // HEAD provides flexible interface for handling request for head method
@@ -163,7 +163,7 @@ func (tr *Transport) HEAD(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodHead,
 		url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -172,7 +172,7 @@ func (tr *Transport) HEAD(
 
 // Trace handles TRACE request
 func (tr *Transport) Trace(url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(net_http.MethodTrace, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(net_http.MethodTrace, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // TRACE provides flexible interface for handling request for trace method
@@ -187,7 +187,7 @@ func (tr *Transport) TRACE(
 	fn Handler,
 	options ...HandlerOption,
 ) {
-	tr.muxer.Handler(
+	tr.register(
 		net_http.MethodTrace,
 		url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
@@ -196,12 +196,12 @@ func (tr *Transport) TRACE(
 
 // Handle is generic method to allow custom bindings of URL with a method and it's handler
 func (tr *Transport) Handle(method, url string, fn HandlerFunc, options ...HandlerOption) {
-	tr.muxer.Handler(method, url, encapsulate(fn, tr.handlerOptions, options))
+	tr.register(method, url, encapsulate(fn, tr.handlerOptions, options))
 }
 
 // HANDLE gives a generic method agnostic way of binding handler to the request
 func (tr *Transport) HANDLE(met, url string, fn Handler, options ...HandlerOption) {
-	tr.muxer.Handler(
+	tr.register(
 		met, url,
 		newHandler(fn, append(tr.handlerOptions, options...)...),
 	)
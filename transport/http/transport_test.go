@@ -0,0 +1,35 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestTransport_report(t *testing.T) {
+	logger := &recordLogger{Logger: log.NewNoopLogger()}
+
+	tr, err := NewHTTPTransport(
+		"report",
+		WithCustomLogger(logger),
+		WithCustomHostPort("127.0.0.1", "0"),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	tr.report()
+
+	for key, want := range map[string]interface{}{
+		"name":             "report",
+		"addr":             "127.0.0.1:0",
+		"read_timeout":     5 * time.Second,
+		"idle_timeout":     90 * time.Second,
+		"max_header_bytes": "1MiB",
+	} {
+		if got := logger.fields[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"crypto/tls"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Errors of the TLS configuration
+var (
+	ErrTLSConfigNil     = errors.New("tls config is nil")
+	ErrTLSNoCertificate = errors.New("tls config has no certificate")
+)
+
+// WithTLS serves HTTPS with the certificate & the key in the PEM files, the
+// certificate file may have the intermediates after the leaf. The files are
+// loaded by NewHTTPTransport. TLS 1.2 is the minimum version
+func WithTLS(certFile, keyFile string) TransportConfigOption {
+	return func(c *config) error {
+		c.tlsCertFile, c.tlsKeyFile = certFile, keyFile
+		return nil
+	}
+}
+
+// WithTLSConfig serves HTTPS with cfg, e.g. to set the minimum version &
+// the cipher suites for compliance. cfg needs a certificate, from
+// Certificates or GetCertificate, or one from WithTLS. The minimum
+// version is TLS 1.2 when cfg has none. cfg is cloned
+func WithTLSConfig(cfg *tls.Config) TransportConfigOption {
+	return func(c *config) error {
+		if cfg == nil {
+			return ErrTLSConfigNil
+		}
+
+		c.tlsConfig = cfg.Clone()
+		return nil
+	}
+}
+
+// tls returns the TLS config of the server, nil without TLS
+func (c *config) tls() (*tls.Config, error) {
+	if c.tlsConfig == nil && c.tlsCertFile == "" {
+		return nil, nil
+	}
+
+	cfg := c.tlsConfig
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	if c.tlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.tlsCertFile, c.tlsKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls certificate failed")
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil && cfg.GetConfigForClient == nil {
+		return nil, ErrTLSNoCertificate
+	}
+	return cfg, nil
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	net_http "net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// selfSigned writes a certificate for 127.0.0.1 & its key to dir
+func selfSigned(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0o600)
+
+	cert, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return
+}
+
+func freePort(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+func TestWithTLS(t *testing.T) {
+	certFile, keyFile, pool := selfSigned(t, t.TempDir())
+
+	if _, err := NewHTTPTransport("test", WithTLSConfig(&tls.Config{})); !errors.Is(err, ErrTLSNoCertificate) {
+		t.Errorf("NewHTTPTransport() error = %v, want %v", err, ErrTLSNoCertificate)
+	}
+
+	if _, err := NewHTTPTransport("test", WithTLS(certFile, "missing.pem")); err == nil {
+		t.Errorf("NewHTTPTransport() with a missing key succeeded")
+	}
+
+	port := freePort(t)
+	tr, err := NewHTTPTransport(
+		"test",
+		WithCustomLogger(log.NewNoopLogger()),
+		WithCustomHostPort("127.0.0.1", port),
+		WithTLS(certFile, keyFile),
+		WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS13}),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+
+	opened := make(chan error, 1)
+	go func() { opened <- tr.Open() }()
+	defer tr.Close()
+
+	client := func(max uint16) *net_http.Client {
+		return &net_http.Client{Transport: &net_http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MaxVersion: max},
+		}}
+	}
+
+	var res *net_http.Response
+	for i := 0; i < 100; i++ {
+		if res, err = client(0).Get("https://127.0.0.1:" + port + "/ping"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode != net_http.StatusOK || res.TLS == nil || res.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("Get() = %d, tls %+v, want 200 over TLS 1.3", res.StatusCode, res.TLS)
+	}
+
+	// below the minimum version of the config
+	if _, err := client(tls.VersionTLS12).Get("https://127.0.0.1:" + port + "/ping"); err == nil {
+		t.Errorf("Get() over TLS 1.2 succeeded")
+	}
+
+	select {
+	case err := <-opened:
+		t.Fatalf("Open() error = %v", err)
+	default:
+	}
+}
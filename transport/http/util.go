@@ -20,7 +20,7 @@ func encapsulate(
 	fn HandlerFunc,
 	trs []HandlerOption,
 	pats []HandlerOption,
-) net_http.Handler {
+) *handler {
 	return newHandler(
 		decorateEndpoint(fn),
 		append(trs, pats...)...,
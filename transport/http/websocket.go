@@ -0,0 +1,294 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+const (
+	defaultWebsocketPingInterval = 30 * time.Second
+	defaultWebsocketCloseTimeout = 5 * time.Second
+)
+
+type (
+	// WebsocketHandler serves an upgraded connection until it returns or
+	// ctx is done, i.e. the transport is shutting down. The connection is
+	// closed with a close handshake once it returns, with an internal
+	// error status if it failed. Writes mustn't be concurrent, see
+	// websocket.Conn
+	WebsocketHandler func(cx context.Context, conn *websocket.Conn) error
+
+	// WebsocketOption customises the websocket handler
+	WebsocketOption func(*websocketHandler)
+
+	websocketHandler struct {
+		fn       WebsocketHandler
+		upgrader websocket.Upgrader
+		filters  []Filter
+
+		maxMessageSize int64
+		pingInterval   time.Duration
+		closeTimeout   time.Duration
+
+		logger log.Logger
+		conns  *websocketConns
+	}
+
+	// websocketConns are the connections open on the transport, to close
+	// them on shutdown
+	websocketConns struct {
+		cx     context.Context
+		cancel context.CancelFunc
+
+		mu    sync.Mutex
+		conns map[*websocket.Conn]struct{}
+		wg    sync.WaitGroup
+	}
+)
+
+// WithWebsocketOrigins sets the origins allowed to connect, as host
+// patterns matched with path.Match, e.g. `*.unbxd.io`. Only same origin
+// requests are allowed by default
+func WithWebsocketOrigins(patterns ...string) WebsocketOption {
+	return func(wh *websocketHandler) {
+		wh.upgrader.CheckOrigin = func(r *net_http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+
+			u, err := url.Parse(origin)
+			if err != nil {
+				return false
+			}
+
+			for _, p := range patterns {
+				if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(u.Host)); ok {
+					return true
+				}
+			}
+			return false
+		}
+	}
+}
+
+// WithWebsocketMaxMessageSize sets the size limit of the messages read,
+// the connection is closed on a bigger message. No limit by default
+func WithWebsocketMaxMessageSize(n int64) WebsocketOption {
+	return func(wh *websocketHandler) { wh.maxMessageSize = n }
+}
+
+// WithWebsocketPingInterval sets the interval of the pings sent to the
+// client, defaults to 30s. A connection which doesn't answer with a pong
+// within two intervals fails its reads. Zero or less disables the pings
+func WithWebsocketPingInterval(d time.Duration) WebsocketOption {
+	return func(wh *websocketHandler) { wh.pingInterval = d }
+}
+
+// WithWebsocketCloseTimeout sets how long the close handshake waits for
+// the client, defaults to 5s
+func WithWebsocketCloseTimeout(d time.Duration) WebsocketOption {
+	return func(wh *websocketHandler) { wh.closeTimeout = d }
+}
+
+// WithWebsocketFilters sets filters run before the upgrade, after the
+// filters of the transport
+func WithWebsocketFilters(filters ...Filter) WebsocketOption {
+	return func(wh *websocketHandler) { wh.filters = append(wh.filters, filters...) }
+}
+
+func newWebsocketConns() *websocketConns {
+	cx, cancel := context.WithCancel(context.Background())
+	return &websocketConns{
+		cx:     cx,
+		cancel: cancel,
+		conns:  make(map[*websocket.Conn]struct{}),
+	}
+}
+
+// add tracks the connection, false once the transport is shutting down
+func (wc *websocketConns) add(conn *websocket.Conn) bool {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if wc.cx.Err() != nil {
+		return false
+	}
+
+	wc.conns[conn] = struct{}{}
+	wc.wg.Add(1)
+	return true
+}
+
+func (wc *websocketConns) remove(conn *websocket.Conn) {
+	wc.mu.Lock()
+	delete(wc.conns, conn)
+	wc.mu.Unlock()
+
+	wc.wg.Done()
+}
+
+// close cancels the handlers & waits for them until cx is done, the
+// connections left are closed without a handshake
+func (wc *websocketConns) close(cx context.Context) error {
+	wc.mu.Lock()
+	wc.cancel()
+	wc.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-cx.Done():
+	}
+
+	wc.mu.Lock()
+	for conn := range wc.conns {
+		_ = conn.Close()
+	}
+	wc.mu.Unlock()
+
+	return cx.Err()
+}
+
+// keepAlive pings the client until done
+func (wh *websocketHandler) keepAlive(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(wh.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deadline := time.Now().Add(wh.pingInterval)
+			if conn.WriteControl(websocket.PingMessage, nil, deadline) != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// shutdown runs the close handshake, the status reports err
+func (wh *websocketHandler) shutdown(conn *websocket.Conn, err error) {
+	var (
+		code = websocket.CloseNormalClosure
+		text = ""
+	)
+
+	switch {
+	case err != nil:
+		code, text = websocket.CloseInternalServerErr, "internal error"
+	case wh.conns.cx.Err() != nil:
+		code = websocket.CloseGoingAway
+	}
+
+	deadline := time.Now().Add(wh.closeTimeout)
+	if conn.WriteControl(
+		websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline,
+	) == nil {
+		// the client answers with a close, read until it does. Pongs
+		// mustn't push the deadline
+		conn.SetPongHandler(nil)
+		_ = conn.SetReadDeadline(deadline)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				break
+			}
+		}
+	}
+
+	_ = conn.Close()
+}
+
+func (wh *websocketHandler) ServeHTTP(w net_http.ResponseWriter, r *net_http.Request) {
+	conn, err := wh.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has replied with the error
+		wh.logger.Debug("websocket upgrade failed", log.String("path", r.URL.Path), log.Error(err))
+		return
+	}
+
+	if !wh.conns.add(conn) {
+		_ = conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, ""),
+			time.Now().Add(wh.closeTimeout),
+		)
+		_ = conn.Close()
+		return
+	}
+	defer wh.conns.remove(conn)
+
+	if wh.maxMessageSize > 0 {
+		conn.SetReadLimit(wh.maxMessageSize)
+	}
+
+	done := make(chan struct{})
+	if wh.pingInterval > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * wh.pingInterval))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * wh.pingInterval))
+		})
+		go wh.keepAlive(conn, done)
+	}
+
+	// the request context isn't cancelled by the client going away once
+	// hijacked, the handler only stops with its reads failing or shutdown
+	cx, cancel := context.WithCancel(
+		context.WithValue(r.Context(), ContextKeyRequestXRequestID, r.Header.Get(HeaderRequestID)),
+	)
+	stop := context.AfterFunc(wh.conns.cx, cancel)
+
+	err = wh.fn(cx, conn)
+
+	stop()
+	cancel()
+	close(done)
+
+	if err != nil {
+		wh.logger.Debug("websocket handler failed", log.String("path", r.URL.Path), log.Error(err))
+	}
+
+	wh.shutdown(conn, err)
+}
+
+// Websocket registers a handler upgrading GET requests on path to
+// websocket connections. Filters of the transport run before the upgrade,
+// HandlerOptions don't apply. The context of the handler carries the
+// values of the request, with the request id.
+// Close of the transport cancels the contexts of the handlers & waits for
+// them to return, the connections still open when it times out are closed
+// without a handshake
+func (tr *Transport) Websocket(path string, fn WebsocketHandler, options ...WebsocketOption) {
+	if tr.websockets == nil {
+		tr.websockets = newWebsocketConns()
+	}
+
+	wh := &websocketHandler{
+		fn:           fn,
+		pingInterval: defaultWebsocketPingInterval,
+		closeTimeout: defaultWebsocketCloseTimeout,
+		logger:       tr.logger,
+		conns:        tr.websockets,
+	}
+
+	for _, o := range options {
+		o(wh)
+	}
+
+	tr.muxer.Handler(net_http.MethodGet, path, chain(wh, wh.filters...))
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	net_http "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func newWebsocketServer(t *testing.T, fn WebsocketHandler, options ...WebsocketOption) (*Transport, string) {
+	tr, err := NewHTTPTransport("test", WithCustomLogger(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewHTTPTransport() error = %v", err)
+	}
+	tr.Websocket("/ws", fn, options...)
+
+	srv := httptest.NewServer(tr.Handler)
+	t.Cleanup(srv.Close)
+
+	return tr, "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+func dial(t *testing.T, url string, hdr net_http.Header) *websocket.Conn {
+	conn, res, err := websocket.DefaultDialer.Dial(url, hdr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v, response = %+v", err, res)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestTransport_Websocket(t *testing.T) {
+	_, url := newWebsocketServer(t, func(cx context.Context, conn *websocket.Conn) error {
+		id, _ := cx.Value(ContextKeyRequestXRequestID).(string)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(id)); err != nil {
+			return err
+		}
+
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return nil
+			}
+			if err := conn.WriteMessage(mt, msg); err != nil {
+				return err
+			}
+		}
+	}, WithWebsocketOrigins("*.unbxd.io"), WithWebsocketMaxMessageSize(8))
+
+	conn := dial(t, url, net_http.Header{
+		HeaderRequestID: {"r1"}, "Origin": {"https://search.unbxd.io"},
+	})
+
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "r1" {
+		t.Errorf("ReadMessage() = %q, %v, want the request id", msg, err)
+	}
+
+	_ = conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "hello" {
+		t.Errorf("ReadMessage() = %q, %v, want the echo", msg, err)
+	}
+
+	// past the max message size
+	_ = conn.WriteMessage(websocket.TextMessage, []byte("hello world"))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("ReadMessage() error = %v, want the connection closed", err)
+	}
+
+	_, res, err := websocket.DefaultDialer.Dial(url, net_http.Header{"Origin": {"https://evil.io"}})
+	if err == nil || res.StatusCode != net_http.StatusForbidden {
+		t.Errorf("Dial() error = %v, want 403 for an origin not allowed", err)
+	}
+}
+
+func TestTransport_Websocket_close(t *testing.T) {
+	tr, url := newWebsocketServer(t, func(cx context.Context, conn *websocket.Conn) error {
+		<-cx.Done()
+		return nil
+	}, WithWebsocketPingInterval(10*time.Millisecond))
+
+	conn := dial(t, url, nil)
+
+	// pings are answered by the reads
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := tr.websockets.close(context.Background()); err != nil {
+		t.Errorf("close() error = %v, want handlers done", err)
+	}
+
+	if err := <-closed; !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("ReadMessage() error = %v, want going away", err)
+	}
+
+	conn = dial(t, url, nil)
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+		t.Errorf("ReadMessage() error = %v, want service restart after close", err)
+	}
+
+	tr, url = newWebsocketServer(t, func(cx context.Context, conn *websocket.Conn) error {
+		<-make(chan struct{})
+		return nil
+	})
+	_ = dial(t, url, nil)
+	time.Sleep(20 * time.Millisecond)
+
+	cx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := tr.websockets.close(cx); err != context.DeadlineExceeded {
+		t.Errorf("close() error = %v, want %v for a stuck handler", err, context.DeadlineExceeded)
+	}
+}
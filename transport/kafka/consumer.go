@@ -2,7 +2,8 @@ package kafka
 
 import (
 	"context"
-
+	"io"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/transport"
@@ -20,20 +21,50 @@ type (
 	// business logic
 	Decoder func(context.Context, kafgo.Message) (interface{}, error)
 
+	// messageReader is the part of kafgo.Reader used by the consumer
+	messageReader interface {
+		ReadMessage(context.Context) (kafgo.Message, error)
+		FetchMessage(context.Context) (kafgo.Message, error)
+		CommitMessages(context.Context, ...kafgo.Message) error
+		Close() error
+	}
+
 	// Consumer is kafka Consumer
 	Consumer struct {
 		autocommit bool
 
 		reader *kafgo.Reader
 		config *kafgo.ReaderConfig
-
-		end     endpoint.Endpoint
-		dec     Decoder
-		befores []BeforeFunc
-		afters  []AfterFunc
-		errFn   ErrorFunc
+		// rd reads the messages, the reader unless set by the tests
+		rd messageReader
+
+		// pool runs the messages concurrently, see
+		// WithConcurrencyConsumerOption
+		pool pool
+		// dlq publishes the failed messages, see
+		// WithDeadLetterConsumerOption
+		dlq *deadLetter
+
+		end endpoint.Endpoint
+		// norecover lets the panics of the endpoint through, see
+		// WithoutRecoverConsumerOption
+		norecover bool
+		dec       Decoder
+		befores   []BeforeFunc
+		afters    []AfterFunc
+		errFn     ErrorFunc
 
 		errHandler ErrorHandler
+
+		partitionMetrics *partitionMetrics
+
+		health consumerHealth
+
+		// mu guards the state of the fetch loop, see Close
+		mu      sync.Mutex
+		closed  bool
+		cancel  context.CancelFunc
+		stopped chan struct{}
 	}
 )
 
@@ -110,6 +141,13 @@ func WithEndpointConsumerOption(end endpoint.Endpoint) ConsumerOption {
 	return func(c *Consumer) { c.end = end }
 }
 
+// WithoutRecoverConsumerOption lets the panics of the endpoint crash the
+// process. By default they are recovered with endpoint.Recover & handled
+// as errors of the endpoint
+func WithoutRecoverConsumerOption() ConsumerOption {
+	return func(c *Consumer) { c.norecover = true }
+}
+
 // WithReaderConsumerOption lets you set the reader for kafka
 func WithReaderConsumerOption(reader *kafgo.Reader) ConsumerOption {
 	return func(c *Consumer) { c.reader = reader }
@@ -129,69 +167,177 @@ func WithOffsetConsumerOption(offset int64) ConsumerOption {
 	}
 }
 
-// Open actually handles the subcriber messages
-func (c *Consumer) Open() error {
-	if c.reader == nil {
-		c.reader = kafgo.NewReader(*c.config)
+// Open actually handles the subcriber messages, till the reader is
+// closed, it is OpenContext with a background context
+func (c *Consumer) Open() error { return c.OpenContext(context.Background()) }
+
+// OpenContext handles the messages till ctx is done, Close is called or
+// the reader is closed, then returns nil once the message in flight is
+// handled. The messages are handled with the values of ctx but not its
+// cancellation, a message started is handled to the end.
+// A failed read is reported to the ErrorFunc & the ErrorHandler and
+// retried, as is a failed commit, while a failed message is reported &
+// skipped. The reads failing as the loop stops aren't reported
+func (c *Consumer) OpenContext(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+
+	if c.rd == nil {
+		if c.reader == nil {
+			c.reader = kafgo.NewReader(*c.config)
+		}
+		c.health.reader.Store(c.reader)
+		c.rd = c.reader
+	}
+
+	var (
+		fctx, cancel = context.WithCancel(ctx)
+		stopped      = make(chan struct{})
+	)
+	c.cancel, c.stopped = cancel, stopped
+	c.mu.Unlock()
+
+	defer close(stopped)
+	defer cancel()
+
+	if c.pool.workers > 1 {
+		return c.openPool(fctx, context.WithoutCancel(ctx))
 	}
 
 	for {
 		// start a new context
 		var (
-			ctx = context.Background()
-			msg kafgo.Message
-			err error
+			hctx = context.WithoutCancel(ctx)
 		)
 
-		if c.autocommit {
-			msg, err = c.reader.ReadMessage(ctx)
-		} else {
-			msg, err = c.reader.FetchMessage(ctx)
-		}
-
-		if err != nil {
-			c.errFn(ctx, msg, errors.Wrap(
-				err, "read message from kafka failed",
-			))
-			c.errHandler.Handle(ctx, err)
-			continue
-		}
-
-		// before endpoint
-		for _, fn := range c.befores {
-			ctx = fn(ctx, msg)
+		msg, err := c.read(fctx)
+		if err == io.EOF {
+			return nil
 		}
 
-		rq, err := c.dec(ctx, msg)
 		if err != nil {
-			c.errFn(ctx, msg, err)
-			c.errHandler.Handle(ctx, err)
 			continue
 		}
 
-		// execute endpoint
-		rs, err := c.end(ctx, rq)
-		if err != nil {
-			c.errFn(ctx, msg, err)
-			c.errHandler.Handle(ctx, err)
+		if hctx, _, err = c.process(fctx, hctx, msg); err != nil {
 			continue
 		}
-
-		for _, fn := range c.afters {
-			ctx = fn(ctx, msg, rs)
-		}
+		c.health.processed()
 
 		if !c.autocommit {
-			err = c.reader.CommitMessages(ctx, msg)
+			err = c.rd.CommitMessages(hctx, msg)
 			if err != nil {
-				c.errFn(ctx, msg, err)
-				c.errHandler.Handle(ctx, err)
+				c.errFn(hctx, msg, err)
+				c.errHandler.Handle(hctx, err)
 				continue
 			}
 		}
 	}
 }
 
+// Close stops the fetch loop of Open, waits for the messages in flight to
+// be handled & their offsets committed, then closes the reader. ctx bounds
+// the wait, the reader is closed regardless once it is done, failing the
+// commits still pending
+func (c *Consumer) Close(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	rd, cancel, stopped := c.rd, c.cancel, c.stopped
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	var err error
+	if stopped != nil {
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	if c.dlq != nil {
+		if er := c.dlq.wr.Close(); er != nil {
+			err = errors.Join(err, errors.Wrap(er, "close dead-letter writer failed"))
+		}
+	}
+
+	if rd == nil {
+		return err
+	}
+
+	if er := rd.Close(); er != nil {
+		return errors.Join(err, errors.Wrap(er, "close kafka reader failed"))
+	}
+	return err
+}
+
+// read reads the next message, io.EOF once the reader is closed or ctx is
+// done. Failed reads are reported to errFn & errHandler
+func (c *Consumer) read(ctx context.Context) (msg kafgo.Message, err error) {
+	if c.autocommit {
+		msg, err = c.rd.ReadMessage(ctx)
+	} else {
+		msg, err = c.rd.FetchMessage(ctx)
+	}
+
+	if err == io.EOF || (err != nil && ctx.Err() != nil) {
+		return msg, io.EOF
+	}
+
+	c.health.read(err)
+	if err != nil {
+		c.errFn(ctx, msg, errors.Wrap(
+			err, "read message from kafka failed",
+		))
+		c.errHandler.Handle(ctx, err)
+		return msg, err
+	}
+
+	if c.partitionMetrics != nil {
+		c.partitionMetrics.observe(msg)
+	}
+	return msg, nil
+}
+
+// handle runs the message through befores, decoder, endpoint & afters.
+// Errors are reported to errFn & errHandler before being returned
+func (c *Consumer) handle(
+	ctx context.Context,
+	msg kafgo.Message,
+) (context.Context, interface{}, error) {
+	// before endpoint
+	for _, fn := range c.befores {
+		ctx = fn(ctx, msg)
+	}
+
+	rq, err := c.dec(ctx, msg)
+	if err != nil {
+		c.errFn(ctx, msg, err)
+		c.errHandler.Handle(ctx, err)
+		return ctx, nil, err
+	}
+
+	// execute endpoint
+	rs, err := c.end(ctx, rq)
+	if err != nil {
+		c.errFn(ctx, msg, err)
+		c.errHandler.Handle(ctx, err)
+		return ctx, nil, err
+	}
+
+	for _, fn := range c.afters {
+		ctx = fn(ctx, msg, rs)
+	}
+
+	return ctx, rs, nil
+}
+
 // NewConsumer returns kafka consumer for the given brokers
 func NewConsumer(
 	brokers []string,
@@ -227,6 +373,10 @@ func NewConsumer(
 		)
 	}
 
+	if !cs.norecover {
+		cs.end = endpoint.Recover(logger)(cs.end)
+	}
+
 	if cs.errFn == nil {
 		cs.errFn = defaultErrorFunc
 	}
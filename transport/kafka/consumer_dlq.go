@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// headers of the messages published on the dead-letter topic
+const (
+	HeaderDeadLetterError     = "x-dead-letter-error"
+	HeaderDeadLetterTopic     = "x-dead-letter-topic"
+	HeaderDeadLetterPartition = "x-dead-letter-partition"
+	HeaderDeadLetterOffset    = "x-dead-letter-offset"
+	HeaderDeadLetterAttempts  = "x-dead-letter-attempts"
+)
+
+// defaultDeadLetterBackoff is the wait before the second attempt, it
+// doubles after every failure
+const defaultDeadLetterBackoff = 100 * time.Millisecond
+
+// deadLetter configures the dead-letter topic of the consumer
+type deadLetter struct {
+	// wr writes on the dead-letter topic, the tests set a fake
+	wr       messageWriter
+	attempts int
+	backoff  func(attempt int) time.Duration
+}
+
+// process handles the message with ctx, with the retries & the dead-letter
+// topic set by WithDeadLetterConsumerOption. The backoffs between the
+// retries end with stop, done once the consumer is closed
+func (c *Consumer) process(
+	stop context.Context,
+	ctx context.Context,
+	msg kafgo.Message,
+) (context.Context, interface{}, error) {
+	if c.dlq == nil {
+		return c.handle(ctx, msg)
+	}
+
+	var err error
+	for attempt := 1; attempt <= c.dlq.attempts; attempt++ {
+		var (
+			hctx context.Context
+			rs   interface{}
+		)
+
+		if hctx, rs, err = c.handle(ctx, msg); err == nil {
+			return hctx, rs, nil
+		}
+
+		if attempt < c.dlq.attempts {
+			if er := wait(stop, c.dlq.backoff(attempt)); er != nil {
+				return ctx, nil, er
+			}
+		}
+	}
+
+	if er := c.deadLetter(stop, ctx, msg, err); er != nil {
+		c.errFn(ctx, msg, er)
+		c.errHandler.Handle(ctx, er)
+		return ctx, nil, er
+	}
+	return ctx, nil, nil
+}
+
+// deadLetter publishes the message on the dead-letter topic, retried like
+// the message
+func (c *Consumer) deadLetter(stop, ctx context.Context, msg kafgo.Message, cause error) error {
+	dl := kafgo.Message{
+		Key:   msg.Key,
+		Value: msg.Value,
+		Headers: append(
+			append([]kafgo.Header(nil), msg.Headers...),
+			kafgo.Header{Key: HeaderDeadLetterError, Value: []byte(cause.Error())},
+			kafgo.Header{Key: HeaderDeadLetterTopic, Value: []byte(msg.Topic)},
+			kafgo.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+			kafgo.Header{Key: HeaderDeadLetterOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+			kafgo.Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(c.dlq.attempts))},
+		),
+	}
+
+	var err error
+	for attempt := 1; attempt <= c.dlq.attempts; attempt++ {
+		if err = c.dlq.wr.WriteMessages(ctx, dl); err == nil {
+			return nil
+		}
+
+		if attempt < c.dlq.attempts {
+			if er := wait(stop, c.dlq.backoff(attempt)); er != nil {
+				return er
+			}
+		}
+	}
+
+	return errors.Wrap(err, "write on the dead-letter topic failed")
+}
+
+// wait waits for the backoff, the error of stop if it is done first, i.e.
+// when the consumer is closed
+func wait(stop context.Context, backoff time.Duration) error {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-stop.Done():
+		return stop.Err()
+	}
+}
+
+// WithDeadLetterConsumerOption retries a message failing to decode or on
+// the endpoint up to maxAttempts times, with a backoff of 100ms doubling
+// after every failure, then publishes it on the dead-letter topic & commits
+// its offset so the partition goes on. The message keeps its key, value &
+// headers, the error, the source topic, partition & offset and the number
+// of attempts are added in the x-dead-letter-* headers.
+// The failed publishes are retried the same, a message failing to be
+// published isn't committed & is reported to the ErrorFunc, though like
+// any failed message, the next message committed on the partition commits
+// past it. A backoff is cut short by Close, the message isn't committed.
+// Close closes the writer of the dead-letter topic
+func WithDeadLetterConsumerOption(brokers []string, topic string, maxAttempts int) ConsumerOption {
+	return func(c *Consumer) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+
+		c.dlq = &deadLetter{
+			wr: &kafgo.Writer{
+				Addr:     kafgo.TCP(brokers...),
+				Topic:    topic,
+				Balancer: &kafgo.LeastBytes{},
+			},
+			attempts: maxAttempts,
+			backoff: func(attempt int) time.Duration {
+				return defaultDeadLetterBackoff << (attempt - 1)
+			},
+		}
+	}
+}
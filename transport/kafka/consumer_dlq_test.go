@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestWithDeadLetterConsumerOption(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		writeErr  error
+		committed []int64
+	}{
+		{name: "published", committed: []int64{0, 1, 2}},
+		{name: "publish failed", writeErr: errors.New("broker unavailable"), committed: []int64{0, 2}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				attempts int
+				fw       = &fakeWriter{err: tt.writeErr}
+				fr       = &fakeReader{msgs: []kafgo.Message{
+					{Topic: "orders", Partition: 3, Offset: 0},
+					{Topic: "orders", Partition: 3, Offset: 1, Key: []byte("o-1"), Headers: []kafgo.Header{{Key: "trace", Value: []byte("t")}}},
+					{Topic: "orders", Partition: 3, Offset: 2},
+				}}
+			)
+
+			cs, _ := NewConsumer(
+				nil, log.NewNoopLogger(),
+				WithDeadLetterConsumerOption(nil, "orders-dlt", 3),
+				WithDecoderConsumerOption(func(_ context.Context, msg kafgo.Message) (interface{}, error) {
+					return msg, nil
+				}),
+				WithEndpointConsumerOption(func(_ context.Context, req interface{}) (interface{}, error) {
+					if req.(kafgo.Message).Offset == 1 {
+						attempts++
+						return nil, errors.New("invalid order")
+					}
+					return nil, nil
+				}),
+				WithErrorFuncConsumerOption(func(context.Context, kafgo.Message, error) {}),
+			)
+			cs.rd = fr
+			cs.dlq.wr = fw
+			cs.dlq.backoff = func(int) time.Duration { return 0 }
+
+			if err := cs.Open(); err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+
+			if attempts != 3 {
+				t.Errorf("attempts = %d, want 3", attempts)
+			}
+
+			var committed []int64
+			for _, msg := range fr.commits {
+				committed = append(committed, msg.Offset)
+			}
+			if fmt.Sprint(committed) != fmt.Sprint(tt.committed) {
+				t.Errorf("committed = %v, want %v", committed, tt.committed)
+			}
+
+			if tt.writeErr != nil {
+				return
+			}
+
+			if len(fw.written) != 1 {
+				t.Fatalf("dead letters = %v, want 1", fw.written)
+			}
+
+			dl := fw.written[0]
+			headers := make(map[string]string)
+			for _, h := range dl.Headers {
+				headers[h.Key] = string(h.Value)
+			}
+
+			want := map[string]string{
+				"trace":                   "t",
+				HeaderDeadLetterError:     "invalid order",
+				HeaderDeadLetterTopic:     "orders",
+				HeaderDeadLetterPartition: "3",
+				HeaderDeadLetterOffset:    "1",
+				HeaderDeadLetterAttempts:  "3",
+			}
+			for k, v := range want {
+				if headers[k] != v {
+					t.Errorf("header %s = %q, want %q", k, headers[k], v)
+				}
+			}
+
+			if string(dl.Key) != "o-1" || dl.Topic != "" {
+				t.Errorf("dead letter = %+v, want the key & the topic of the writer", dl)
+			}
+		})
+	}
+}
+
+func TestDeadLetterBackoffClose(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		var (
+			failed = make(chan struct{}, 1)
+			fw     = &fakeWriter{}
+			fr     = &fakeReader{msgs: []kafgo.Message{{Topic: "orders", Offset: 1}}, block: true}
+			done   = make(chan error, 1)
+		)
+
+		cs, _ := NewConsumer(
+			nil, log.NewNoopLogger(),
+			WithConcurrencyConsumerOption(workers, 0),
+			WithDeadLetterConsumerOption(nil, "orders-dlt", 3),
+			WithDecoderConsumerOption(func(_ context.Context, msg kafgo.Message) (interface{}, error) {
+				return msg, nil
+			}),
+			WithEndpointConsumerOption(func(context.Context, interface{}) (interface{}, error) {
+				select {
+				case failed <- struct{}{}:
+				default:
+				}
+				return nil, errors.New("invalid order")
+			}),
+			WithErrorFuncConsumerOption(func(context.Context, kafgo.Message, error) {}),
+		)
+		cs.rd = fr
+		cs.dlq.wr = fw
+		cs.dlq.backoff = func(int) time.Duration { return time.Hour }
+
+		go func() { done <- cs.OpenContext(context.Background()) }()
+		<-failed
+
+		// the backoff after the failure ends with Close
+		cx, cancel := context.WithTimeout(context.Background(), time.Second)
+		start := time.Now()
+
+		if err := cs.Close(cx); err != nil {
+			t.Errorf("Close() with %d workers during a backoff error = %v", workers, err)
+		}
+		cancel()
+
+		if took := time.Since(start); took > 500*time.Millisecond {
+			t.Errorf("Close() with %d workers took %s, want the backoff cut short", workers, took)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("OpenContext() with %d workers error = %v, want nil", workers, err)
+		}
+
+		if len(fw.written) != 0 || len(fr.commits) != 0 {
+			t.Errorf("dead letters = %v, commits = %v, want none", fw.written, fr.commits)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/health"
+)
+
+// consumerHealth tracks what Consumer.Health reports, updated by Open
+type consumerHealth struct {
+	reader atomic.Pointer[kafgo.Reader]
+	failed atomic.Bool  // the last read from kafka failed
+	last   atomic.Int64 // unix nano of the last message processed
+
+	maxLag int64
+}
+
+func (ch *consumerHealth) read(err error) { ch.failed.Store(err != nil) }
+
+func (ch *consumerHealth) processed() { ch.last.Store(time.Now().UnixNano()) }
+
+// WithHealthMaxLagConsumerOption reports the consumer unhealthy when it
+// lags more than maxLag messages behind, see Consumer.Health
+func WithHealthMaxLagConsumerOption(maxLag int64) ConsumerOption {
+	return func(c *Consumer) { c.health.maxLag = maxLag }
+}
+
+// Health reports the consumer, it implements health.Reporter. It is
+// connected once open unless the last read from kafka failed, a consumer
+// waiting on its first message is connected, & healthy when connected
+// within the lag set by WithHealthMaxLagConsumerOption. The lag is from
+// the stats of the reader, which resets its counters
+func (c *Consumer) Health(_ context.Context) health.Status {
+	st := health.Status{Lag: -1}
+
+	if last := c.health.last.Load(); last > 0 {
+		st.LastProcessed = time.Unix(0, last)
+	}
+
+	reader := c.health.reader.Load()
+	if reader == nil {
+		st.Detail = "consumer isn't open"
+		return st
+	}
+
+	st.Connected = !c.health.failed.Load()
+	st.Lag = reader.Stats().Lag
+
+	switch {
+	case !st.Connected:
+		st.Detail = "reading from kafka failed"
+	case c.health.maxLag > 0 && st.Lag > c.health.maxLag:
+		st.Detail = "lag above " + strconv.FormatInt(c.health.maxLag, 10)
+	default:
+		st.Healthy = true
+	}
+	return st
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestConsumerHealth(t *testing.T) {
+	var (
+		reported = make(chan struct{}, 1)
+		handled  = make(chan struct{}, 1)
+		fr       = &fakeReader{
+			msgs:  []kafgo.Message{{Offset: 1}},
+			fails: 1,
+			block: true,
+		}
+	)
+
+	cs, err := NewConsumer(
+		nil, log.NewNoopLogger(),
+		WithDecoderConsumerOption(func(_ context.Context, msg kafgo.Message) (interface{}, error) {
+			return msg, nil
+		}),
+		WithEndpointConsumerOption(func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		}),
+		WithErrorFuncConsumerOption(func(context.Context, kafgo.Message, error) {
+			reported <- struct{}{}
+			<-handled
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewConsumer() error = %v", err)
+	}
+
+	if st := cs.Health(context.Background()); st.Healthy || st.Connected {
+		t.Errorf("Health() before Open = %+v, want unhealthy", st)
+	}
+
+	// the reader isn't read from, it only reports the stats
+	reader := kafgo.NewReader(kafgo.ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: defaultTopic})
+	defer reader.Close()
+	cs.health.reader.Store(reader)
+
+	// open & waiting on the first message
+	if st := cs.Health(context.Background()); !st.Healthy || !st.Connected {
+		t.Errorf("Health() without a read = %+v, want healthy & connected", st)
+	}
+
+	cs.rd = fr
+	cx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = cs.OpenContext(cx) }()
+
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("failed read not reported in 1s")
+	}
+
+	if st := cs.Health(context.Background()); st.Healthy || st.Connected || st.Detail != "reading from kafka failed" {
+		t.Errorf("Health() after a failed read = %+v, want unhealthy", st)
+	}
+	handled <- struct{}{}
+
+	// the next read succeeds
+	var st = cs.Health(context.Background())
+	for i := 0; i < 100 && st.LastProcessed.IsZero(); i++ {
+		time.Sleep(time.Millisecond)
+		st = cs.Health(context.Background())
+	}
+
+	if !st.Healthy || !st.Connected || st.LastProcessed.IsZero() {
+		t.Errorf("Health() after a message = %+v, want healthy & connected", st)
+	}
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/metrics"
+)
+
+const (
+	partitionMessagesMetric    = "kafka.consumer.partition.messages"
+	partitionCardinalityMetric = "kafka.consumer.partition.key_cardinality"
+
+	// bits in the linear counting bitmap per partition, 512 bytes each.
+	// estimates are within a few percent up to ~1k distinct keys per
+	// window, lose precision after that and saturate around ~30k
+	keySketchBits = 4096
+)
+
+type (
+	// keySketch estimates the number of distinct keys using linear
+	// counting over a fixed size bitmap
+	keySketch struct {
+		bits [keySketchBits / 64]uint64
+	}
+
+	partitionKey struct {
+		topic     string
+		partition int
+	}
+
+	// partitionMetrics samples consumed messages to report the
+	// distribution of messages, and optionally distinct keys, across
+	// partitions. Skewed partitions are a common cause of consumer lag
+	partitionMetrics struct {
+		sampleRate float64
+		window     time.Duration
+
+		messages    metrics.Counter
+		cardinality metrics.Gauge
+
+		mu       sync.Mutex
+		sketches map[partitionKey]*keySketch
+		started  time.Time
+
+		rand func() float64
+		now  func() time.Time
+	}
+)
+
+// fnv-1a
+func hashBytes(bt []byte) uint64 {
+	var h uint64 = 14695981039346656037
+	for _, b := range bt {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (ks *keySketch) add(key []byte) {
+	ix := hashBytes(key) % keySketchBits
+	ks.bits[ix/64] |= 1 << (ix % 64)
+}
+
+func (ks *keySketch) estimate() float64 {
+	var set int
+	for _, w := range ks.bits {
+		for ; w != 0; w &= w - 1 {
+			set++
+		}
+	}
+
+	zeros := float64(keySketchBits - set)
+	if zeros == 0 {
+		zeros = 1
+	}
+
+	return -keySketchBits * math.Log(zeros/keySketchBits)
+}
+
+func (pm *partitionMetrics) observe(msg kafgo.Message) {
+	if pm.sampleRate < 1 && pm.rand() >= pm.sampleRate {
+		return
+	}
+
+	partition := strconv.Itoa(msg.Partition)
+
+	// scale by the sample rate so the counter approximates the actual
+	// number of messages
+	pm.messages.With(
+		"topic", msg.Topic, "partition", partition,
+	).Add(1 / pm.sampleRate)
+
+	if pm.window <= 0 {
+		return
+	}
+
+	now := pm.now()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if now.Sub(pm.started) >= pm.window {
+		pm.flush()
+		pm.started = now
+	}
+
+	pk := partitionKey{msg.Topic, msg.Partition}
+
+	ks, ok := pm.sketches[pk]
+	if !ok {
+		ks = &keySketch{}
+		pm.sketches[pk] = ks
+	}
+
+	ks.add(msg.Key)
+}
+
+// flush reports the cardinality seen in the last window and resets it,
+// expects the lock to be held
+func (pm *partitionMetrics) flush() {
+	for pk, ks := range pm.sketches {
+		pm.cardinality.With(
+			"topic", pk.topic, "partition", strconv.Itoa(pk.partition),
+		).Set(ks.estimate())
+	}
+
+	pm.sketches = make(map[partitionKey]*keySketch)
+}
+
+// WithPartitionMetricsConsumerOption samples consumed messages and emits
+// `kafka.consumer.partition.messages` tagged with topic & partition, to
+// identify partitions receiving disproportionate traffic.
+// sampleRate (0, 1] is the fraction of messages observed, the counter is
+// scaled to approximate the total.
+// If cardinalityWindow is positive, the approximate number of distinct
+// message keys per partition seen in each window is reported as the
+// `kafka.consumer.partition.key_cardinality` gauge.
+func WithPartitionMetricsConsumerOption(
+	provider metrics.Provider,
+	sampleRate float64,
+	cardinalityWindow time.Duration,
+) ConsumerOption {
+	return func(c *Consumer) {
+		if sampleRate <= 0 || sampleRate > 1 {
+			sampleRate = 1
+		}
+
+		c.partitionMetrics = &partitionMetrics{
+			sampleRate:  sampleRate,
+			window:      cardinalityWindow,
+			messages:    provider.NewCounter(partitionMessagesMetric, 1),
+			cardinality: provider.NewGauge(partitionCardinalityMetric),
+			sketches:    make(map[partitionKey]*keySketch),
+			started:     time.Now(),
+			rand:        rand.Float64,
+			now:         time.Now,
+		}
+	}
+}
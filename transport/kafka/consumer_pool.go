@@ -0,0 +1,187 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	kafgo "github.com/segmentio/kafka-go"
+)
+
+type (
+	// pool configures the workers of the consumer
+	pool struct {
+		workers int
+		buffer  int
+	}
+
+	// handled is a message handled by a worker
+	handled struct {
+		msg kafgo.Message
+		err error
+	}
+
+	partition struct {
+		topic string
+		id    int
+	}
+
+	// inflight is a message fetched & not yet committed
+	inflight struct {
+		msg  kafgo.Message
+		done bool
+		err  error
+	}
+
+	// offsets tracks the messages in flight per partition, in the order
+	// they were fetched, so the commits never go past a message which
+	// isn't handled yet
+	offsets struct {
+		mu sync.Mutex
+		in map[partition][]*inflight
+	}
+)
+
+func partitionOf(msg kafgo.Message) partition {
+	return partition{msg.Topic, msg.Partition}
+}
+
+// fetched adds the message to the ones in flight of its partition
+func (ot *offsets) fetched(msg kafgo.Message) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	pt := partitionOf(msg)
+	ot.in[pt] = append(ot.in[pt], &inflight{msg: msg})
+}
+
+// handled marks the message handled and returns the message to commit,
+// the last one handled successfully of the messages handled from the
+// head of its partition, if any
+func (ot *offsets) handled(msg kafgo.Message, err error) (kafgo.Message, bool) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	var (
+		pt     = partitionOf(msg)
+		queue  = ot.in[pt]
+		commit kafgo.Message
+		ok     bool
+	)
+
+	for _, it := range queue {
+		if it.msg.Offset == msg.Offset {
+			it.done, it.err = true, err
+			break
+		}
+	}
+
+	for len(queue) > 0 && queue[0].done {
+		// a failed message isn't committed, same as Open does, the next
+		// one handled successfully commits past it
+		if queue[0].err == nil {
+			commit, ok = queue[0].msg, true
+		}
+		queue = queue[1:]
+	}
+
+	if len(queue) == 0 {
+		delete(ot.in, pt)
+	} else {
+		ot.in[pt] = queue
+	}
+
+	return commit, ok
+}
+
+// openPool runs the messages on the workers of the pool till the reader
+// is closed or fctx is done, then waits for the messages in flight. The
+// messages are handled & committed with ctx
+func (c *Consumer) openPool(fctx, ctx context.Context) error {
+	var (
+		wg sync.WaitGroup
+
+		msgs      = make(chan kafgo.Message, c.pool.buffer)
+		results   = make(chan handled, c.pool.buffer)
+		committed = make(chan struct{})
+
+		tracked = &offsets{in: make(map[partition][]*inflight)}
+	)
+
+	for i := 0; i < c.pool.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for msg := range msgs {
+				_, _, err := c.process(fctx, ctx, msg)
+				if err == nil {
+					c.health.processed()
+				}
+				results <- handled{msg, err}
+			}
+		}()
+	}
+
+	// commits from a single goroutine, in the order of the offsets
+	go func() {
+		defer close(committed)
+
+		for rs := range results {
+			if c.autocommit {
+				continue
+			}
+
+			msg, ok := tracked.handled(rs.msg, rs.err)
+			if !ok {
+				continue
+			}
+
+			if err := c.rd.CommitMessages(ctx, msg); err != nil {
+				c.errFn(ctx, msg, err)
+				c.errHandler.Handle(ctx, err)
+			}
+		}
+	}()
+
+	for {
+		msg, err := c.read(fctx)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if !c.autocommit {
+			tracked.fetched(msg)
+		}
+		msgs <- msg
+	}
+
+	close(msgs)
+	wg.Wait()
+	close(results)
+	<-committed
+
+	return nil
+}
+
+// WithConcurrencyConsumerOption handles the messages on workers, with up
+// to bufferSize messages waiting for a worker, bufferSize defaults to
+// workers. The messages, of a partition too, are handled in no particular
+// order, without autocommit the offset of a partition is committed only
+// once all the messages fetched before it are handled, so a restart
+// never skips a message. Like Open, failed messages aren't committed but
+// the next one handled successfully commits past them.
+// Open waits for the messages in flight before it returns. One or less
+// workers handles the messages one at a time, as by default
+func WithConcurrencyConsumerOption(workers int, bufferSize int) ConsumerOption {
+	return func(c *Consumer) {
+		if bufferSize <= 0 {
+			bufferSize = workers
+		}
+		c.pool = pool{workers: workers, buffer: bufferSize}
+	}
+}
@@ -0,0 +1,180 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// fakeReader returns msgs then io.EOF & records the commits
+type fakeReader struct {
+	mu      sync.Mutex
+	msgs    []kafgo.Message
+	commits []kafgo.Message
+	closed  bool
+
+	// fails fails the next reads, block waits for ctx instead of io.EOF
+	fails int
+	block bool
+
+	// onCommit checks the commits as they are made
+	onCommit func(kafgo.Message)
+}
+
+func (fr *fakeReader) ReadMessage(cx context.Context) (kafgo.Message, error) {
+	return fr.FetchMessage(cx)
+}
+
+func (fr *fakeReader) FetchMessage(cx context.Context) (kafgo.Message, error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if fr.fails > 0 {
+		fr.fails--
+		return kafgo.Message{}, errors.New("broker unavailable")
+	}
+
+	if len(fr.msgs) == 0 {
+		if !fr.block {
+			return kafgo.Message{}, io.EOF
+		}
+
+		fr.mu.Unlock()
+		<-cx.Done()
+		fr.mu.Lock()
+		return kafgo.Message{}, cx.Err()
+	}
+
+	msg := fr.msgs[0]
+	fr.msgs = fr.msgs[1:]
+	return msg, nil
+}
+
+func (fr *fakeReader) Close() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.closed = true
+	return nil
+}
+
+func (fr *fakeReader) CommitMessages(_ context.Context, msgs ...kafgo.Message) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	for _, msg := range msgs {
+		if fr.onCommit != nil {
+			fr.onCommit(msg)
+		}
+	}
+	fr.commits = append(fr.commits, msgs...)
+	return nil
+}
+
+func TestWithConcurrencyConsumerOption(t *testing.T) {
+	const perPartition = 20
+
+	var (
+		mu      sync.Mutex
+		handled = map[int]map[int64]bool{0: {}, 1: {}}
+		fr      = &fakeReader{}
+	)
+
+	for o := int64(0); o < perPartition; o++ {
+		for p := 0; p < 2; p++ {
+			fr.msgs = append(fr.msgs, kafgo.Message{Topic: "orders", Partition: p, Offset: o})
+		}
+	}
+
+	fr.onCommit = func(msg kafgo.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for o := int64(0); o <= msg.Offset; o++ {
+			if !handled[msg.Partition][o] {
+				t.Errorf("commit of %d@%d before %d is handled", msg.Partition, msg.Offset, o)
+			}
+		}
+	}
+
+	cs, err := NewConsumer(
+		nil, log.NewNoopLogger(),
+		WithConcurrencyConsumerOption(8, 4),
+		WithDecoderConsumerOption(func(_ context.Context, msg kafgo.Message) (interface{}, error) {
+			return msg, nil
+		}),
+		WithEndpointConsumerOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			msg := req.(kafgo.Message)
+
+			// the later offsets complete first
+			time.Sleep(time.Duration(perPartition-msg.Offset) * time.Millisecond / 2)
+
+			mu.Lock()
+			handled[msg.Partition][msg.Offset] = true
+			mu.Unlock()
+
+			if msg.Offset == perPartition-1 && msg.Partition == 1 {
+				return nil, errors.New("failed")
+			}
+			return nil, nil
+		}),
+		WithErrorFuncConsumerOption(func(context.Context, kafgo.Message, error) {}),
+	)
+	if err != nil {
+		t.Fatalf("NewConsumer() error = %v", err)
+	}
+	cs.rd = fr
+
+	if err := cs.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// Open drained the messages in flight
+	last := map[int]int64{0: -1, 1: -1}
+	for _, msg := range fr.commits {
+		if msg.Offset <= last[msg.Partition] {
+			t.Errorf("commit of %d@%d after %d", msg.Partition, msg.Offset, last[msg.Partition])
+		}
+		last[msg.Partition] = msg.Offset
+	}
+
+	// the failed message isn't committed
+	if last[0] != perPartition-1 || last[1] != perPartition-2 {
+		t.Errorf("last commits = %v, want %d & %d", last, perPartition-1, perPartition-2)
+	}
+}
+
+func TestOffsetsHandled(t *testing.T) {
+	ot := &offsets{in: make(map[partition][]*inflight)}
+	msg := func(o int64) kafgo.Message { return kafgo.Message{Offset: o} }
+
+	for o := int64(0); o < 4; o++ {
+		ot.fetched(msg(o))
+	}
+
+	for _, tt := range []struct {
+		offset int64
+		err    error
+		commit int64
+	}{
+		{2, nil, -1},
+		{1, errors.New("failed"), -1},
+		{0, nil, 2},
+		{3, errors.New("failed"), -1},
+	} {
+		got, ok := ot.handled(msg(tt.offset), tt.err)
+		if (tt.commit < 0 && ok) || (tt.commit >= 0 && (!ok || got.Offset != tt.commit)) {
+			t.Errorf("handled(%d) = %d, %v, want %d", tt.offset, got.Offset, ok, tt.commit)
+		}
+	}
+
+	if len(ot.in) != 0 {
+		t.Errorf("in flight = %v, want none", ot.in)
+	}
+}
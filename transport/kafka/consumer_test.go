@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/endpoint"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestConsumerOpenContext(t *testing.T) {
+	var (
+		reported atomic.Int32
+		handled  = make(chan int64, 2)
+		fr       = &fakeReader{
+			msgs:  []kafgo.Message{{Offset: 1}, {Offset: 2}},
+			fails: 2,
+			block: true,
+		}
+	)
+
+	cs, err := NewConsumer(
+		nil, log.NewNoopLogger(),
+		WithDecoderConsumerOption(func(_ context.Context, msg kafgo.Message) (interface{}, error) {
+			return msg, nil
+		}),
+		WithEndpointConsumerOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			handled <- req.(kafgo.Message).Offset
+			return nil, nil
+		}),
+		WithErrorFuncConsumerOption(func(context.Context, kafgo.Message, error) { reported.Add(1) }),
+	)
+	if err != nil {
+		t.Fatalf("NewConsumer() error = %v", err)
+	}
+	cs.rd = fr
+
+	cx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- cs.OpenContext(cx) }()
+
+	// the failed reads are reported & retried
+	for i := 0; i < 2; i++ {
+		<-handled
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("OpenContext() error = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OpenContext() running after the context is cancelled")
+	}
+
+	// the cancelled read isn't reported
+	if n := reported.Load(); n != 2 {
+		t.Errorf("errors reported = %d, want the 2 failed reads", n)
+	}
+	if len(fr.commits) != 2 {
+		t.Errorf("commits = %v, want both messages", fr.commits)
+	}
+}
+
+// blockingConsumer returns a consumer on fr with the endpoint blocked
+// till release is closed
+func blockingConsumer(fr *fakeReader, workers int, started, release chan struct{}) *Consumer {
+	cs, _ := NewConsumer(
+		nil, log.NewNoopLogger(),
+		WithConcurrencyConsumerOption(workers, 0),
+		WithDecoderConsumerOption(func(_ context.Context, msg kafgo.Message) (interface{}, error) {
+			return msg, nil
+		}),
+		WithEndpointConsumerOption(func(cx context.Context, _ interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			return nil, cx.Err()
+		}),
+	)
+	cs.rd = fr
+	return cs
+}
+
+func TestConsumerClose(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		var (
+			started = make(chan struct{})
+			release = make(chan struct{})
+			fr      = &fakeReader{msgs: []kafgo.Message{{Offset: 7}}, block: true}
+			cs      = blockingConsumer(fr, workers, started, release)
+			done    = make(chan error)
+			closed  = make(chan error)
+		)
+
+		go func() { done <- cs.Open() }()
+		<-started
+
+		go func() { closed <- cs.Close(context.Background()) }()
+
+		// Close waits for the message in flight, which isn't cancelled
+		select {
+		case err := <-closed:
+			t.Fatalf("Close() with %d workers = %v before the message is handled", workers, err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		close(release)
+
+		if err := <-closed; err != nil {
+			t.Errorf("Close() with %d workers error = %v", workers, err)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("Open() with %d workers error = %v, want nil", workers, err)
+		}
+
+		if len(fr.commits) != 1 || fr.commits[0].Offset != 7 || !fr.closed {
+			t.Errorf("commits = %v, closed = %v, want offset 7 & the reader closed", fr.commits, fr.closed)
+		}
+
+		// Open after Close returns at once
+		if err := cs.Open(); err != nil {
+			t.Errorf("Open() after Close() error = %v", err)
+		}
+	}
+}
+
+func TestConsumerCloseTimeout(t *testing.T) {
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+		fr      = &fakeReader{msgs: []kafgo.Message{{Offset: 7}}, block: true}
+		cs      = blockingConsumer(fr, 1, started, release)
+	)
+	defer close(release)
+
+	go func() { _ = cs.Open() }()
+	<-started
+
+	cx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := cs.Close(cx); !errors.Is(err, context.DeadlineExceeded) || !fr.closed {
+		t.Errorf("Close() error = %v, closed = %v, want %v & the reader closed", err, fr.closed, context.DeadlineExceeded)
+	}
+}
+
+func TestConsumerRecover(t *testing.T) {
+	var (
+		reported = make(chan error, 1)
+		handled  = make(chan int64, 1)
+		fr       = &fakeReader{msgs: []kafgo.Message{{Offset: 1}, {Offset: 2}}, block: true}
+	)
+
+	cs, err := NewConsumer(
+		nil, log.NewNoopLogger(),
+		WithDecoderConsumerOption(func(_ context.Context, msg kafgo.Message) (interface{}, error) {
+			return msg, nil
+		}),
+		WithEndpointConsumerOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			if req.(kafgo.Message).Offset == 1 {
+				panic("boom")
+			}
+			handled <- req.(kafgo.Message).Offset
+			return nil, nil
+		}),
+		WithErrorFuncConsumerOption(func(_ context.Context, _ kafgo.Message, err error) { reported <- err }),
+	)
+	if err != nil {
+		t.Fatalf("NewConsumer() error = %v", err)
+	}
+	cs.rd = fr
+
+	cx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- cs.OpenContext(cx) }()
+
+	// the panic is reported & the next message is handled
+	if err := <-reported; !errors.Is(err, endpoint.ErrPanic) {
+		t.Errorf("error reported = %v, want %v", err, endpoint.ErrPanic)
+	}
+	if off := <-handled; off != 2 {
+		t.Errorf("handled offset %d, want 2", off)
+	}
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("OpenContext() error = %v, want nil", err)
+	}
+	if len(fr.commits) != 1 || fr.commits[0].Offset != 2 {
+		t.Errorf("commits = %v, want the message handled", fr.commits)
+	}
+}
@@ -0,0 +1,77 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	kafgo "github.com/segmentio/kafka-go"
+)
+
+// defaultMaxMessageBytes is message.max.bytes of a broker with default
+// configuration
+const defaultMaxMessageBytes = 1024 * 1024
+
+// safely runs fn and returns the value it panicked with, if any
+func safely(fn func()) (p interface{}) {
+	defer func() { p = recover() }()
+	fn()
+	return
+}
+
+// TestDecoder checks dec decodes msg into want and holds up against the
+// edge cases the consumer will deliver to it:
+//   - nil value: tombstones on compacted topics, must not panic, an error
+//     is fine
+//   - nil key: messages produced without key, must not panic
+//   - max payload: 1MB of value, must not panic
+//   - no headers & unknown header: must not panic, unknown headers must
+//     not change the result
+//
+// Failures are reported with t.Errorf, so all the cases run.
+func TestDecoder(t testing.TB, dec Decoder, msg kafgo.Message, want interface{}) {
+	t.Helper()
+
+	decode := func(name string, m kafgo.Message) (got interface{}, err error, ok bool) {
+		t.Helper()
+
+		if p := safely(func() { got, err = dec(context.Background(), m) }); p != nil {
+			t.Errorf("decoder contract [%s]: panicked: %v", name, p)
+			return nil, nil, false
+		}
+		return got, err, true
+	}
+
+	expect := func(name string, m kafgo.Message) {
+		t.Helper()
+
+		got, err, ok := decode(name, m)
+		switch {
+		case !ok:
+		case err != nil:
+			t.Errorf("decoder contract [%s]: error = %v", name, err)
+		case !reflect.DeepEqual(got, want):
+			t.Errorf("decoder contract [%s]: got = %#v, want %#v", name, got, want)
+		}
+	}
+
+	clone := func(fn func(*kafgo.Message)) kafgo.Message {
+		m := msg
+		m.Headers = append([]kafgo.Header(nil), msg.Headers...)
+		fn(&m)
+		return m
+	}
+
+	expect("message", clone(func(*kafgo.Message) {}))
+	expect("unknown header", clone(func(m *kafgo.Message) {
+		m.Headers = append(m.Headers, kafgo.Header{Key: "x-contract-test", Value: []byte("1")})
+	}))
+
+	decode("nil value", clone(func(m *kafgo.Message) { m.Value = nil }))
+	decode("nil key", clone(func(m *kafgo.Message) { m.Key = nil }))
+	decode("no headers", clone(func(m *kafgo.Message) { m.Headers = nil }))
+	decode("max payload", clone(func(m *kafgo.Message) {
+		m.Value = bytes.Repeat([]byte{'x'}, defaultMaxMessageBytes)
+	}))
+}
@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// recordTB records the failures instead of failing the test, to check
+// the contract helpers catch the bad implementations
+type recordTB struct {
+	testing.TB
+	errs []string
+}
+
+func (rt *recordTB) Helper() {}
+
+func (rt *recordTB) Errorf(format string, args ...interface{}) {
+	rt.errs = append(rt.errs, fmt.Sprintf(format, args...))
+}
+
+type order struct {
+	ID string `json:"id"`
+}
+
+func jsonDecoder(_ context.Context, msg kafgo.Message) (interface{}, error) {
+	var o order
+	if err := json.Unmarshal(msg.Value, &o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func TestDecoderContract(t *testing.T) {
+	tests := []struct {
+		name    string
+		dec     Decoder
+		wantErr string
+	}{
+		{"json", jsonDecoder, ""},
+		{
+			"panics on tombstone",
+			func(cx context.Context, msg kafgo.Message) (interface{}, error) {
+				_ = msg.Value[0]
+				return jsonDecoder(cx, msg)
+			},
+			"[nil value]: panicked",
+		},
+		{
+			"depends on header order",
+			func(cx context.Context, msg kafgo.Message) (interface{}, error) {
+				if len(msg.Headers) != 1 {
+					return nil, errors.New("unexpected headers")
+				}
+				return jsonDecoder(cx, msg)
+			},
+			"[unknown header]: error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &recordTB{TB: t}
+			TestDecoder(rt, tt.dec, kafgo.Message{
+				Key:     []byte("1"),
+				Value:   []byte(`{"id":"1"}`),
+				Headers: []kafgo.Header{{Key: "content-type", Value: []byte("application/json")}},
+			}, order{ID: "1"})
+
+			errs := strings.Join(rt.errs, "\n")
+			if (tt.wantErr == "") != (errs == "") || !strings.Contains(errs, tt.wantErr) {
+				t.Errorf("TestDecoder() failures = %q, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFakeConsumer(t *testing.T) {
+	var handled []string
+
+	fc, err := NewFakeConsumer(
+		log.NewNoopLogger(),
+		WithTopicConsumerOption("orders"),
+		WithDecoderConsumerOption(jsonDecoder),
+		WithErrorFuncConsumerOption(func(context.Context, kafgo.Message, error) {}),
+		WithEndpointConsumerOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			o := req.(order)
+			if o.ID == "" {
+				return nil, errors.New("missing id")
+			}
+			handled = append(handled, o.ID)
+			return o, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewFakeConsumer() error = %v", err)
+	}
+
+	d := fc.Deliver(kafgo.Message{Value: []byte(`{"id":"1"}`)})
+	d.AssertCommitted(t)
+	if d.Err != nil || d.Response != (order{ID: "1"}) || d.Msg.Topic != "orders" {
+		t.Errorf("Deliver() = %+v", d)
+	}
+
+	fc.Deliver(kafgo.Message{Value: []byte(`{}`)}).AssertNotCommitted(t)
+	fc.Deliver(kafgo.Message{Value: []byte(`not json`)}).AssertNotCommitted(t)
+
+	if len(handled) != 1 || len(fc.Committed()) != 1 {
+		t.Errorf("handled = %v, committed = %d", handled, len(fc.Committed()))
+	}
+}
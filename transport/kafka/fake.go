@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// ErrFakeHandlerPanicked is returned when the consumer pipeline panics
+// on a delivered message
+var ErrFakeHandlerPanicked = errors.New("fake: handler panicked")
+
+type (
+	// Delivery is the outcome of a message delivered by FakeConsumer
+	Delivery struct {
+		Msg      kafgo.Message
+		Response interface{}
+		Err      error
+
+		// Committed reports if the offset of the message would have been
+		// committed
+		Committed bool
+	}
+
+	// FakeConsumer runs the consumer built from the options without a
+	// broker, through the same pipeline as Consumer.Open: befores,
+	// decoder, endpoint, afters, ErrorFunc & ErrorHandler. Deliver is
+	// synchronous, making consumer tests deterministic.
+	//
+	// Gaps with a real broker, tests relying on these won't predict
+	// production behavior:
+	//   - no partitions or rebalances, messages are handled in the
+	//     order they are delivered
+	//   - uncommitted messages aren't redelivered, Committed only reports
+	//     what Open would have done
+	//   - with auto commit the offset is committed on read, failed
+	//     messages are reported as Committed, same as a real consumer
+	FakeConsumer struct {
+		mu sync.Mutex
+		cs *Consumer
+
+		committed []kafgo.Message
+	}
+)
+
+// AssertCommitted fails the test if the message wasn't committed
+func (d *Delivery) AssertCommitted(t testing.TB) {
+	t.Helper()
+	if !d.Committed {
+		t.Errorf("message %s/%d@%d wasn't committed, err: %v", d.Msg.Topic, d.Msg.Partition, d.Msg.Offset, d.Err)
+	}
+}
+
+// AssertNotCommitted fails the test if the message was committed
+func (d *Delivery) AssertNotCommitted(t testing.TB) {
+	t.Helper()
+	if d.Committed {
+		t.Errorf("message %s/%d@%d was committed", d.Msg.Topic, d.Msg.Partition, d.Msg.Offset)
+	}
+}
+
+// NewFakeConsumer returns a FakeConsumer for the consumer options, the
+// same options as NewConsumer
+func NewFakeConsumer(logger log.Logger, options ...ConsumerOption) (*FakeConsumer, error) {
+	cs, err := NewConsumer(nil, logger, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &FakeConsumer{cs: cs}, nil
+}
+
+// Deliver delivers the message to the consumer and returns the outcome.
+// Topic defaults to the consumer's topic
+func (fc *FakeConsumer) Deliver(msg kafgo.Message) *Delivery {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if msg.Topic == "" {
+		msg.Topic = fc.cs.config.Topic
+	}
+
+	d := &Delivery{Msg: msg}
+
+	if p := safely(func() {
+		_, d.Response, d.Err = fc.cs.handle(context.Background(), msg)
+	}); p != nil {
+		d.Err = errors.Wrapf(ErrFakeHandlerPanicked, "panic: %v", p)
+	}
+
+	d.Committed = fc.cs.autocommit || d.Err == nil
+	if d.Committed {
+		fc.committed = append(fc.committed, msg)
+	}
+
+	return d
+}
+
+// Committed returns the messages committed so far
+func (fc *FakeConsumer) Committed() []kafgo.Message {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return append([]kafgo.Message(nil), fc.committed...)
+}
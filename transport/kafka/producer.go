@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/transport"
 	kafgo "github.com/segmentio/kafka-go"
@@ -19,10 +20,18 @@ type (
 	// kafka message
 	Encoder func(context.Context, interface{}) (kafgo.Message, error)
 
+	// messageWriter is the part of kafgo.Writer used by the producer
+	messageWriter interface {
+		WriteMessages(context.Context, ...kafgo.Message) error
+		Close() error
+	}
+
 	// Producer produces message on Kafka
 	Producer struct {
 		writer *kafgo.Writer
 		config *kafgo.WriterConfig
+		// wr writes the messages, the writer unless set by the tests
+		wr messageWriter
 
 		enc Encoder
 
@@ -85,12 +94,80 @@ func WithAfterProducerOption(fns ...AfterFunc) ProducerOption {
 	}
 }
 
+// WithErrorFuncProducerOption provides a callback to handle the errors,
+// including the failed deliveries of the async producer
+func WithErrorFuncProducerOption(fn ErrorFunc) ProducerOption {
+	return func(p *Producer) { p.errFn = fn }
+}
+
+// WithAsyncProducerOption makes the producer queue the messages & return,
+// they are written in batches of up to batchSize messages, at least every
+// flushInterval. The failed deliveries are reported to the ErrorFunc & the
+// ErrorHandler, the afters are executed once the message is queued. Close
+// flushes the messages queued
+func WithAsyncProducerOption(flushInterval time.Duration, batchSize int) ProducerOption {
+	return func(p *Producer) {
+		p.config.Async = true
+		p.config.BatchTimeout = flushInterval
+		if batchSize > 0 {
+			p.config.BatchSize = batchSize
+		}
+	}
+}
+
+// Publish publishes the value through the endpoint of the producer
+func (p *Producer) Publish(cx context.Context, rqi interface{}) error {
+	_, err := p.Endpoint()(cx, rqi)
+	return err
+}
+
+// Close flushes the messages queued by the async producer & closes the
+// writer. ctx bounds the wait, the messages still queued once it is done
+// may be lost
+func (p *Producer) Close(ctx context.Context) error {
+	closed := make(chan error, 1)
+	go func() { closed <- p.wr.Close() }()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			return errors.Wrap(err, "close kafka writer failed")
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// completed reports the messages the async producer failed to deliver
+func (p *Producer) completed(msgs []kafgo.Message, err error) {
+	if err == nil {
+		return
+	}
+
+	cx := context.Background()
+	err = errors.Wrap(err, "write on kafka failed")
+
+	for _, msg := range msgs {
+		p.errFn(cx, msg, err)
+	}
+	p.errHn.Handle(cx, err)
+}
+
 // Endpoint returns a usable endpoint
 func (p *Producer) Endpoint() endpoint.Endpoint {
 	return func(
 		cx context.Context,
 		rqi interface{},
 	) (interface{}, error) {
+		// don't produce for requests which are already cancelled,
+		// writer honors the context from here on
+		if err := cx.Err(); err != nil {
+			err = errors.Wrap(err, "produce cancelled")
+			p.errHn.Handle(cx, err)
+			return nil, err
+		}
+
 		// encode
 		msg, err := p.enc(cx, rqi)
 		if err != nil {
@@ -108,7 +185,7 @@ func (p *Producer) Endpoint() endpoint.Endpoint {
 		}
 
 		// publsih on the kafka queue
-		err = p.writer.WriteMessages(cx, msg)
+		err = p.wr.WriteMessages(cx, msg)
 		if err != nil {
 			err = errors.Wrap(
 				err, "write on kafka failed",
@@ -170,5 +247,10 @@ func NewProducer(
 	}
 
 	pr.writer = kafgo.NewWriter(*pr.config)
+	if pr.config.Async {
+		// the sync writes report their failures as they return
+		pr.writer.Completion = pr.completed
+	}
+	pr.wr = pr.writer
 	return pr, nil
 }
@@ -0,0 +1,127 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	kafgo "github.com/segmentio/kafka-go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// fakeWriter records the messages written, failing with err
+type fakeWriter struct {
+	mu      sync.Mutex
+	written []kafgo.Message
+	err     error
+	closing chan struct{}
+}
+
+func (fw *fakeWriter) WriteMessages(_ context.Context, msgs ...kafgo.Message) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.err != nil {
+		return fw.err
+	}
+	fw.written = append(fw.written, msgs...)
+	return nil
+}
+
+func (fw *fakeWriter) Close() error {
+	if fw.closing != nil {
+		<-fw.closing
+	}
+	return nil
+}
+
+func TestProducerPublish(t *testing.T) {
+	var (
+		failed []kafgo.Message
+		afters int
+		fw     = &fakeWriter{}
+	)
+
+	pr, err := NewProducer(
+		[]string{"localhost:9092"}, log.NewNoopLogger(),
+		WithTopicProducerOption("orders"),
+		WithEncoderProducerOption(func(_ context.Context, v interface{}) (kafgo.Message, error) {
+			if v == nil {
+				return kafgo.Message{}, errors.New("nothing to encode")
+			}
+			return kafgo.Message{Value: []byte(v.(string))}, nil
+		}),
+		WithAfterProducerOption(func(cx context.Context, _ kafgo.Message, _ interface{}) context.Context {
+			afters++
+			return cx
+		}),
+		WithErrorFuncProducerOption(func(_ context.Context, msg kafgo.Message, _ error) {
+			failed = append(failed, msg)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewProducer() error = %v", err)
+	}
+	pr.wr = fw
+
+	if err := pr.Publish(context.Background(), "o-1"); err != nil {
+		t.Errorf("Publish() error = %v", err)
+	}
+	if err := pr.Publish(context.Background(), nil); err == nil {
+		t.Error("Publish() of a value failing to encode error = nil")
+	}
+
+	fw.err = errors.New("broker unavailable")
+	if err := pr.Publish(context.Background(), "o-2"); err == nil {
+		t.Error("Publish() with the broker down error = nil")
+	}
+
+	if len(fw.written) != 1 || string(fw.written[0].Value) != "o-1" || afters != 1 || len(failed) != 2 {
+		t.Errorf("written = %v, afters = %d, failed = %v, want o-1 written only", fw.written, afters, failed)
+	}
+}
+
+func TestProducerAsync(t *testing.T) {
+	var failed []kafgo.Message
+
+	pr, _ := NewProducer(
+		[]string{"localhost:9092"}, log.NewNoopLogger(),
+		WithAsyncProducerOption(10*time.Millisecond, 50),
+		WithEncoderProducerOption(func(_ context.Context, v interface{}) (kafgo.Message, error) {
+			return kafgo.Message{Value: []byte(v.(string))}, nil
+		}),
+		WithErrorFuncProducerOption(func(_ context.Context, msg kafgo.Message, _ error) {
+			failed = append(failed, msg)
+		}),
+	)
+
+	if !pr.writer.Async || pr.writer.BatchSize != 50 || pr.writer.Completion == nil {
+		t.Errorf("writer = %+v, want async batches of 50", pr.writer)
+	}
+
+	// the failed deliveries are reported by the writer
+	pr.writer.Completion([]kafgo.Message{{Offset: 1}, {Offset: 2}}, errors.New("broker unavailable"))
+	pr.writer.Completion([]kafgo.Message{{Offset: 3}}, nil)
+
+	if len(failed) != 2 {
+		t.Errorf("failed = %v, want the 2 messages of the failed batch", failed)
+	}
+
+	// Close waits for the writer to flush, bounded by its context
+	fw := &fakeWriter{closing: make(chan struct{})}
+	pr.wr = fw
+
+	cx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := pr.Close(cx); err != context.DeadlineExceeded {
+		t.Errorf("Close() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(fw.closing)
+	if err := pr.Close(context.Background()); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
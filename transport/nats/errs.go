@@ -8,4 +8,6 @@ import (
 var (
 	ErrCreatingSubscriber = errors.New("error creating subscriber")
 	ErrCreatingPublisher  = errors.New("error creating publisher")
+	ErrNoResponders       = errors.New("no responders for the request")
+	ErrRequestTimeout     = errors.New("request timed out")
 )
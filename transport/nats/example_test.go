@@ -0,0 +1,31 @@
+package nats_test
+
+import (
+	"context"
+	net_http "net/http"
+
+	natn "github.com/nats-io/nats.go"
+	gb_http "github.com/unbxd/go-base/v2/transport/http"
+	"github.com/unbxd/go-base/v2/transport/nats"
+)
+
+// The handler's context is the request's context, it is cancelled when
+// the client disconnects. Passing it down to the publisher drops the
+// publish for requests nobody is waiting on anymore.
+func ExamplePublisher_Endpoint_cancellation() {
+	pb, err := nats.NewPublisher(natn.DefaultURL)
+	if err != nil {
+		return
+	}
+
+	publish := pb.Endpoint("orders.created")
+
+	net_http.Handle("/orders", gb_http.NewHandler(
+		func(cx context.Context, req interface{}) (interface{}, error) {
+			// ... work which might outlast the client
+
+			// not published if the client went away meanwhile
+			return publish(cx, req)
+		},
+	))
+}
@@ -0,0 +1,113 @@
+package nats
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/unbxd/go-base/v2/endpoint"
+	"github.com/unbxd/go-base/v2/health"
+)
+
+// WithHealthMaxLag reports the transport unhealthy when more than maxLag
+// messages wait in the subscriptions, see Transport.Health
+func WithHealthMaxLag(maxLag int64) TransportOption {
+	return func(tr *Transport) {
+		tr.maxLag = maxLag
+	}
+}
+
+// ConnStatus is the state of the connection & of the subscriptions of the
+// transport, see Transport.Status
+type ConnStatus struct {
+	// State of the connection, e.g. CONNECTED or RECONNECTING
+	State     string
+	Connected bool
+	// Subscriptions tells if the subscription of each subscriber, by id,
+	// is valid
+	Subscriptions map[string]bool
+}
+
+// Status returns the state of the connection & of the subscriptions
+func (tr *Transport) Status() ConnStatus {
+	st := ConnStatus{
+		State:         tr.conn.Status().String(),
+		Connected:     tr.conn.IsConnected(),
+		Subscriptions: make(map[string]bool),
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	for id, s := range tr.subscribers {
+		st.Subscriptions[id] = s.IsValid()
+	}
+	return st
+}
+
+// Healthy tells if the transport is open, connected & all the
+// subscriptions are valid, e.g. for the health check of a service
+func (tr *Transport) Healthy() bool {
+	st := tr.Status()
+	if !st.Connected {
+		return false
+	}
+
+	for _, valid := range st.Subscriptions {
+		if !valid {
+			return false
+		}
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.open
+}
+
+// processedMiddleware records when the subscribers processed a message
+func (tr *Transport) processedMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(cx context.Context, req interface{}) (interface{}, error) {
+		res, err := next(cx, req)
+		if err == nil {
+			tr.processed.Store(time.Now().UnixNano())
+		}
+		return res, err
+	}
+}
+
+// Health reports the transport, it implements health.Reporter. It is
+// healthy once open, connected to NATS & within the lag set by
+// WithHealthMaxLag. The lag is the number of messages pending in the
+// subscriptions, delivered by NATS but not processed yet
+func (tr *Transport) Health(_ context.Context) health.Status {
+	st := health.Status{Connected: tr.conn.IsConnected()}
+
+	if last := tr.processed.Load(); last > 0 {
+		st.LastProcessed = time.Unix(0, last)
+	}
+
+	tr.mu.Lock()
+	open := tr.open
+	for _, s := range tr.subscribers {
+		if s.subscription == nil {
+			continue
+		}
+
+		if msgs, _, err := s.subscription.Pending(); err == nil {
+			st.Lag += int64(msgs)
+		}
+	}
+	tr.mu.Unlock()
+
+	switch {
+	case !open:
+		st.Detail = "transport isn't open"
+	case !st.Connected:
+		st.Detail = "nats connection is " + tr.conn.Status().String()
+	case tr.maxLag > 0 && st.Lag > tr.maxLag:
+		st.Detail = "lag above " + strconv.FormatInt(tr.maxLag, 10)
+	default:
+		st.Healthy = true
+	}
+	return st
+}
@@ -0,0 +1,67 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func TestTransport_Health(t *testing.T) {
+	ns := natsserver.RunRandClientPortServer()
+	defer ns.Shutdown()
+
+	tr, err := NewTransport(
+		make(chan struct{}),
+		WithServers([]string{ns.ClientURL()}),
+		WithLogging(log.NewNoopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("NewTransport() error = %v", err)
+	}
+	// Close races on its error, the connection is enough
+	defer tr.conn.Close()
+
+	processed := make(chan struct{}, 1)
+	_, err = tr.Subscribe(
+		WithSubjectSubscriberOption("orders.*"),
+		WithDecoderSubscriberOption(jsonDecoder),
+		WithEndpointSubscriberOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			processed <- struct{}{}
+			return req, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	if st := tr.Health(context.Background()); st.Healthy || st.Detail != "transport isn't open" {
+		t.Errorf("Health() before Open = %+v, want unhealthy", st)
+	}
+
+	if err := tr.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	_ = tr.conn.Flush()
+
+	_ = tr.conn.Publish("orders.created", []byte(`{"id":"1"}`))
+
+	select {
+	case <-processed:
+	case <-time.After(time.Second):
+		t.Fatal("message not processed in 1s")
+	}
+
+	// the time is recorded once the endpoint returned
+	var st = tr.Health(context.Background())
+	for i := 0; i < 100 && st.LastProcessed.IsZero(); i++ {
+		time.Sleep(time.Millisecond)
+		st = tr.Health(context.Background())
+	}
+
+	if !st.Healthy || !st.Connected || st.LastProcessed.IsZero() || st.Lag != 0 {
+		t.Errorf("Health() = %+v, want healthy & connected with a message processed", st)
+	}
+}
@@ -0,0 +1,331 @@
+package nats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// defaults of the JetStream pull subscriber
+const (
+	defaultPullBatchSize = 10
+	defaultPullWait      = time.Second
+)
+
+// AckDecision is how the pull subscriber acknowledges a message
+type AckDecision int
+
+// Ack Decisions
+const (
+	// AckDefault acks the message handled successfully, naks it otherwise
+	AckDefault AckDecision = iota
+	// AckAck acks the message
+	AckAck
+	// AckNak naks the message, it is redelivered
+	AckNak
+	// AckTerm terminates the message, it isn't redelivered
+	AckTerm
+)
+
+type (
+	// JetStreamOption configures the JetStream pull subscriber
+	JetStreamOption func(*jetStream)
+
+	// fetcher is the part of the pull subscription used by the pull loop
+	fetcher interface {
+		Fetch(batch int, opts ...natn.PullOpt) ([]*natn.Msg, error)
+	}
+
+	// jetStream consumes the messages of a durable consumer of a stream
+	// through a pull subscription
+	jetStream struct {
+		stream  string
+		durable string
+
+		batch         int
+		maxInFlight   int
+		wait          time.Duration
+		nakDelay      time.Duration
+		termDecodeErr bool
+
+		// fetch & ack are the subscription & the message methods, unless
+		// set by the tests
+		fetch fetcher
+		ack   func(*natn.Msg, AckDecision, time.Duration) error
+
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+
+	ackKey struct{}
+
+	// ackOverride is the decision of the business layer for the message
+	// handled with the context
+	ackOverride struct {
+		mu       sync.Mutex
+		decision AckDecision
+		delay    time.Duration
+	}
+)
+
+// AckMessage makes the pull subscriber ack the message handled with cx,
+// whatever the endpoint returns. Outside of a pull subscriber it does
+// nothing
+func AckMessage(cx context.Context) { decide(cx, AckAck, 0) }
+
+// NakMessage makes the pull subscriber nak the message handled with cx,
+// it is redelivered after delay whatever the endpoint returns. Outside of
+// a pull subscriber it does nothing
+func NakMessage(cx context.Context, delay time.Duration) { decide(cx, AckNak, delay) }
+
+// TermMessage makes the pull subscriber terminate the message handled with
+// cx, it isn't redelivered. Outside of a pull subscriber it does nothing
+func TermMessage(cx context.Context) { decide(cx, AckTerm, 0) }
+
+func decide(cx context.Context, decision AckDecision, delay time.Duration) {
+	ov, ok := cx.Value(ackKey{}).(*ackOverride)
+	if !ok {
+		return
+	}
+
+	ov.mu.Lock()
+	defer ov.mu.Unlock()
+	ov.decision, ov.delay = decision, delay
+}
+
+func ackMsg(msg *natn.Msg, decision AckDecision, delay time.Duration) error {
+	switch decision {
+	case AckNak:
+		if delay > 0 {
+			return msg.NakWithDelay(delay)
+		}
+		return msg.Nak()
+	case AckTerm:
+		return msg.Term()
+	default:
+		return msg.Ack()
+	}
+}
+
+// WithJetStreamPullSubscriber consumes the messages of the durable
+// consumer of the stream through a pull subscription, created if missing
+// & filtered on the subject of the subscriber, instead of a core NATS
+// subscription. The messages are fetched in batches & handled
+// concurrently, up to the max in flight.
+// A message handled successfully is acked, one failing on the endpoint is
+// naked & redelivered after the nak delay, so is one failing to decode
+// unless WithTermOnDecodeErrorJetStreamOption is set. The endpoint can
+// decide otherwise with AckMessage, NakMessage & TermMessage. The response
+// handler isn't called, the reply subject of a message is its ack.
+// Closing the subscriber stops the fetches & waits for the messages in
+// flight
+func WithJetStreamPullSubscriber(stream, durable string, opts ...JetStreamOption) SubscriberOption {
+	return func(s *subscriber) {
+		s.js = &jetStream{
+			stream:  stream,
+			durable: durable,
+			batch:   defaultPullBatchSize,
+			wait:    defaultPullWait,
+			ack:     ackMsg,
+		}
+
+		for _, o := range opts {
+			o(s.js)
+		}
+
+		if s.js.maxInFlight <= 0 {
+			s.js.maxInFlight = s.js.batch
+		}
+	}
+}
+
+// WithBatchSizeJetStreamOption sets the number of messages fetched at
+// once, defaults to 10
+func WithBatchSizeJetStreamOption(n int) JetStreamOption {
+	return func(js *jetStream) { js.batch = n }
+}
+
+// WithMaxInFlightJetStreamOption sets the number of messages handled at
+// once, defaults to the batch size
+func WithMaxInFlightJetStreamOption(n int) JetStreamOption {
+	return func(js *jetStream) { js.maxInFlight = n }
+}
+
+// WithFetchWaitJetStreamOption sets how long a fetch waits for messages,
+// defaults to 1s
+func WithFetchWaitJetStreamOption(wait time.Duration) JetStreamOption {
+	return func(js *jetStream) { js.wait = wait }
+}
+
+// WithNakDelayJetStreamOption sets the delay before a failed message is
+// redelivered, redelivered at once by default
+func WithNakDelayJetStreamOption(delay time.Duration) JetStreamOption {
+	return func(js *jetStream) { js.nakDelay = delay }
+}
+
+// WithTermOnDecodeErrorJetStreamOption terminates the messages failing to
+// decode instead of naking them, they would fail again
+func WithTermOnDecodeErrorJetStreamOption() JetStreamOption {
+	return func(js *jetStream) { js.termDecodeErr = true }
+}
+
+// openPull creates the pull subscription & starts the pull loop
+func (s *subscriber) openPull() error {
+	jsc, err := s.conn.JetStream()
+	if err != nil {
+		return errors.Wrap(err, "jetstream context failed")
+	}
+
+	s.subscription, err = jsc.PullSubscribe(
+		s.subject,
+		s.js.durable,
+		natn.BindStream(s.js.stream),
+	)
+	if err != nil {
+		return errors.Wrap(err, "jetstream pull subscribe failed")
+	}
+
+	s.startPull(s.subscription)
+	return nil
+}
+
+// startPull runs the pull loop on fetch till closePull
+func (s *subscriber) startPull(fetch fetcher) {
+	var cx context.Context
+
+	s.js.fetch = fetch
+	cx, s.js.cancel = context.WithCancel(context.Background())
+	s.js.done = make(chan struct{})
+
+	go s.pull(cx)
+}
+
+// closePull stops the pull loop & waits for the messages in flight
+func (s *subscriber) closePull() error {
+	if s.js.cancel == nil {
+		return nil
+	}
+
+	s.js.cancel()
+	<-s.js.done
+
+	if s.subscription == nil {
+		return nil
+	}
+	return s.subscription.Unsubscribe()
+}
+
+func (s *subscriber) pull(cx context.Context) {
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, s.js.maxInFlight)
+		ep    = wrap(s.end, s.middlewares...)
+	)
+
+	defer close(s.js.done)
+	defer wg.Wait()
+
+	for {
+		// a free slot at least, as many as the batch if free
+		select {
+		case slots <- struct{}{}:
+		case <-cx.Done():
+			return
+		}
+
+		n := 1
+	fill:
+		for n < s.js.batch {
+			select {
+			case slots <- struct{}{}:
+				n++
+			default:
+				break fill
+			}
+		}
+
+		msgs, err := s.fetchBatch(cx, n)
+		for i := len(msgs); i < n; i++ {
+			<-slots
+		}
+
+		switch {
+		case cx.Err() != nil && len(msgs) == 0:
+			return
+		case errors.Is(err, natn.ErrBadSubscription), errors.Is(err, natn.ErrConnectionClosed):
+			s.errorhn.Handle(cx, errors.Wrap(err, "jetstream fetch failed, pull stopped"))
+			return
+		case err != nil && len(msgs) == 0:
+			if !errors.Is(err, natn.ErrTimeout) && !errors.Is(err, context.DeadlineExceeded) {
+				s.errorhn.Handle(cx, errors.Wrap(err, "jetstream fetch failed"))
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			wg.Add(1)
+			go func(msg *natn.Msg) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				s.handlePull(ep, msg)
+			}(msg)
+		}
+	}
+}
+
+func (s *subscriber) fetchBatch(cx context.Context, n int) ([]*natn.Msg, error) {
+	fcx, cancel := context.WithTimeout(cx, s.js.wait)
+	defer cancel()
+
+	return s.js.fetch.Fetch(n, natn.Context(fcx))
+}
+
+// handlePull runs the message through befores, decoder, endpoint & afters
+// & acknowledges it
+func (s *subscriber) handlePull(ep func(context.Context, interface{}) (interface{}, error), msg *natn.Msg) {
+	var (
+		cx = context.Background()
+		ov = &ackOverride{}
+
+		decision = AckAck
+		delay    time.Duration
+	)
+
+	for _, fn := range s.befores {
+		cx = fn(cx, msg)
+	}
+	cx = context.WithValue(cx, ackKey{}, ov)
+
+	rq, err := s.dec(cx, msg)
+	if err != nil {
+		s.errorhn.Handle(cx, errors.Wrap(err, "decode message failed"))
+
+		decision, delay = AckNak, s.js.nakDelay
+		if s.js.termDecodeErr {
+			decision, delay = AckTerm, 0
+		}
+	} else {
+		if _, err = ep(cx, rq); err != nil {
+			s.errorhn.Handle(cx, err)
+			decision, delay = AckNak, s.js.nakDelay
+		}
+
+		for _, fn := range s.afters {
+			cx = fn(cx, s.conn)
+		}
+	}
+
+	ov.mu.Lock()
+	if ov.decision != AckDefault {
+		decision, delay = ov.decision, ov.delay
+	}
+	ov.mu.Unlock()
+
+	if err := s.js.ack(msg, decision, delay); err != nil {
+		s.errorhn.Handle(cx, errors.Wrap(err, "acknowledge message failed"))
+	}
+}
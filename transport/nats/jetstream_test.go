@@ -0,0 +1,141 @@
+package nats
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+// fakeFetcher returns the messages in order, then times out
+type fakeFetcher struct {
+	mu      sync.Mutex
+	msgs    []*natn.Msg
+	largest int
+}
+
+func (ff *fakeFetcher) Fetch(batch int, _ ...natn.PullOpt) ([]*natn.Msg, error) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+
+	ff.largest = max(ff.largest, batch)
+	if len(ff.msgs) == 0 {
+		ff.mu.Unlock()
+		time.Sleep(time.Millisecond)
+		ff.mu.Lock()
+		return nil, natn.ErrTimeout
+	}
+
+	n := min(batch, len(ff.msgs))
+	msgs := ff.msgs[:n]
+	ff.msgs = ff.msgs[n:]
+	return msgs, nil
+}
+
+type acked struct {
+	decision AckDecision
+	delay    time.Duration
+}
+
+func TestWithJetStreamPullSubscriber(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		acks    = make(map[string]acked)
+		running atomic.Int32
+		busiest atomic.Int32
+
+		ff = &fakeFetcher{}
+	)
+
+	for _, data := range []string{"ok", "fail", "bad", "redeliver", "ok-2", "ok-3"} {
+		ff.msgs = append(ff.msgs, &natn.Msg{Subject: "orders", Data: []byte(data)})
+	}
+
+	s, err := newSubscriber(
+		log.NewNoopLogger(), nil,
+		WithSubjectSubscriberOption("orders"),
+		WithJetStreamPullSubscriber(
+			"ORDERS", "billing",
+			WithBatchSizeJetStreamOption(4),
+			WithMaxInFlightJetStreamOption(2),
+			WithNakDelayJetStreamOption(time.Second),
+			WithTermOnDecodeErrorJetStreamOption(),
+		),
+		WithDecoderSubscriberOption(func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+			if string(msg.Data) == "bad" {
+				return nil, errors.New("malformed order")
+			}
+			return string(msg.Data), nil
+		}),
+		WithEndpointSubscriberOption(func(cx context.Context, req interface{}) (interface{}, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for b := busiest.Load(); n > b && !busiest.CompareAndSwap(b, n); b = busiest.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			switch req {
+			case "fail":
+				return nil, errors.New("billing is down")
+			case "redeliver":
+				NakMessage(cx, 5*time.Second)
+			}
+			return nil, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("newSubscriber() error = %v", err)
+	}
+
+	s.js.ack = func(msg *natn.Msg, decision AckDecision, delay time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		acks[string(msg.Data)] = acked{decision, delay}
+		return nil
+	}
+	s.startPull(ff)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(acks)
+		mu.Unlock()
+
+		if n == 6 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.close(); err != nil {
+		t.Errorf("close() error = %v", err)
+	}
+
+	want := map[string]acked{
+		"ok":        {AckAck, 0},
+		"ok-2":      {AckAck, 0},
+		"ok-3":      {AckAck, 0},
+		"fail":      {AckNak, time.Second},
+		"bad":       {AckTerm, 0},
+		"redeliver": {AckNak, 5 * time.Second},
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for data, w := range want {
+		if got := acks[data]; got != w {
+			t.Errorf("ack of %s = %+v, want %+v", data, got, w)
+		}
+	}
+
+	if busiest.Load() > 2 || ff.largest > 2 {
+		t.Errorf("in flight = %d, fetched = %d, want at most 2", busiest.Load(), ff.largest)
+	}
+}
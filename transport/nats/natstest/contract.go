@@ -0,0 +1,140 @@
+package natstest
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/transport/nats"
+)
+
+const contractReply = "_INBOX.contract"
+
+// safely runs fn and returns the value it panicked with, if any
+func safely(fn func()) (p interface{}) {
+	defer func() { p = recover() }()
+	fn()
+	return
+}
+
+// TestDecoder checks dec decodes msg into want and holds up against the
+// edge cases the framework will deliver to it:
+//   - missing reply: core NATS publishes don't carry a Reply, decoding
+//     must not depend on it
+//   - nil data: empty publishes, must not panic, an error is fine
+//   - max payload: 1MB of data, must not panic
+//   - no headers & unknown header: must not panic, unknown headers must
+//     not change the result
+//
+// Failures are reported with t.Errorf, so all the cases run.
+func TestDecoder(t testing.TB, dec nats.Decoder, msg *natn.Msg, want interface{}) {
+	t.Helper()
+
+	decode := func(name string, m *natn.Msg) (got interface{}, err error, ok bool) {
+		t.Helper()
+
+		if p := safely(func() { got, err = dec(context.Background(), m) }); p != nil {
+			t.Errorf("decoder contract [%s]: panicked: %v", name, p)
+			return nil, nil, false
+		}
+		return got, err, true
+	}
+
+	expect := func(name string, m *natn.Msg) {
+		t.Helper()
+
+		got, err, ok := decode(name, m)
+		switch {
+		case !ok:
+		case err != nil:
+			t.Errorf("decoder contract [%s]: error = %v", name, err)
+		case !reflect.DeepEqual(got, want):
+			t.Errorf("decoder contract [%s]: got = %#v, want %#v", name, got, want)
+		}
+	}
+
+	clone := func(fn func(*natn.Msg)) *natn.Msg {
+		m := &natn.Msg{
+			Subject: msg.Subject,
+			Reply:   msg.Reply,
+			Data:    msg.Data,
+			Header:  natn.Header{},
+		}
+
+		for k, v := range msg.Header {
+			m.Header[k] = v
+		}
+
+		fn(m)
+		return m
+	}
+
+	expect("message", clone(func(*natn.Msg) {}))
+	expect("missing reply", clone(func(m *natn.Msg) { m.Reply = "" }))
+	expect("unknown header", clone(func(m *natn.Msg) { m.Header.Set("X-Contract-Test", "1") }))
+
+	decode("nil data", clone(func(m *natn.Msg) { m.Data = nil }))
+	decode("no headers", clone(func(m *natn.Msg) { m.Header = nil }))
+	decode("max payload", clone(func(m *natn.Msg) {
+		m.Data = bytes.Repeat([]byte{'x'}, defaultMaxPayload)
+	}))
+}
+
+// TestResponseHandler checks rh replies to response and holds up against
+// the edge cases the framework will pass to it:
+//   - missing reply: messages published without reply, must not panic
+//   - nil response: must not panic
+//   - unencodable response (a channel): the encode error must be returned,
+//     not swallowed or replied with an empty message
+//
+// The replies sent for response are returned, to assert on their content.
+func TestResponseHandler(t testing.TB, rh nats.ResponseHandler, response interface{}) []*natn.Msg {
+	t.Helper()
+
+	fb := NewFakeBroker()
+
+	conn, err := fb.Connect()
+	if err != nil {
+		t.Errorf("response handler contract: fake broker: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	handle := func(name, reply string, res interface{}) (replies []*natn.Msg, err error, ok bool) {
+		t.Helper()
+
+		ix := len(fb.Published(""))
+		if p := safely(func() { err = rh(context.Background(), reply, conn, res) }); p != nil {
+			t.Errorf("response handler contract [%s]: panicked: %v", name, p)
+			return nil, nil, false
+		}
+
+		if ferr := conn.Flush(); ferr != nil {
+			t.Errorf("response handler contract [%s]: flush: %v", name, ferr)
+			return nil, nil, false
+		}
+
+		return fb.publishedSince(ix, reply), err, true
+	}
+
+	replies, err, ok := handle("response", contractReply, response)
+	if ok && err != nil {
+		t.Errorf("response handler contract [response]: error = %v", err)
+	}
+
+	handle("missing reply", "", response)
+	handle("nil response", contractReply, nil)
+
+	if bad, err, ok := handle("unencodable response", contractReply, make(chan int)); ok && err == nil {
+		switch {
+		case len(bad) > 0 && len(bad[0].Data) == 0:
+			t.Errorf("response handler contract [unencodable response]: encode error ignored, replied empty message")
+		case len(bad) == 0 && len(replies) > 0:
+			t.Errorf("response handler contract [unencodable response]: encode error swallowed, no reply & no error")
+		}
+	}
+
+	return replies
+}
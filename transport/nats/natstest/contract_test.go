@@ -0,0 +1,221 @@
+package natstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/transport/nats"
+)
+
+// recordTB records the failures instead of failing the test, to check
+// the contract helpers catch the bad implementations
+type recordTB struct {
+	testing.TB
+	errs []string
+}
+
+func (rt *recordTB) Helper() {}
+
+func (rt *recordTB) Errorf(format string, args ...interface{}) {
+	rt.errs = append(rt.errs, fmt.Sprintf(format, args...))
+}
+
+type order struct {
+	ID string `json:"id"`
+}
+
+func jsonDecoder(_ context.Context, msg *natn.Msg) (interface{}, error) {
+	var o order
+	if err := json.Unmarshal(msg.Data, &o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func jsonResponseHandler(_ context.Context, reply string, nc *natn.Conn, res interface{}) error {
+	bt, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return nc.Publish(reply, bt)
+}
+
+func TestDecoderContract(t *testing.T) {
+	tests := []struct {
+		name    string
+		dec     nats.Decoder
+		wantErr string
+	}{
+		{"json", jsonDecoder, ""},
+		{
+			"panics on nil data",
+			func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+				_ = msg.Data[0]
+				return jsonDecoder(nil, msg)
+			},
+			"[nil data]: panicked",
+		},
+		{
+			"depends on reply",
+			func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+				if msg.Reply == "" {
+					return nil, errors.New("no reply")
+				}
+				return jsonDecoder(nil, msg)
+			},
+			"[missing reply]: error",
+		},
+		{
+			"panics without headers",
+			func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+				msg.Header["Seen"] = []string{"1"}
+				return jsonDecoder(nil, msg)
+			},
+			"[no headers]: panicked",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &recordTB{TB: t}
+			TestDecoder(rt, tt.dec, &natn.Msg{
+				Subject: "orders",
+				Reply:   "_INBOX.1",
+				Data:    []byte(`{"id":"1"}`),
+			}, order{ID: "1"})
+
+			errs := strings.Join(rt.errs, "\n")
+			if (tt.wantErr == "") != (errs == "") || !strings.Contains(errs, tt.wantErr) {
+				t.Errorf("TestDecoder() failures = %q, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResponseHandlerContract(t *testing.T) {
+	tests := []struct {
+		name    string
+		rh      nats.ResponseHandler
+		wantErr string
+	}{
+		{"json", jsonResponseHandler, ""},
+		{"noop", nats.NoOpResponseHandler, ""},
+		{
+			"ignores encode error",
+			func(_ context.Context, reply string, nc *natn.Conn, res interface{}) error {
+				bt, _ := json.Marshal(res)
+				return nc.Publish(reply, bt)
+			},
+			"[unencodable response]: encode error ignored",
+		},
+		{
+			"swallows encode error",
+			func(_ context.Context, reply string, nc *natn.Conn, res interface{}) error {
+				bt, err := json.Marshal(res)
+				if err != nil {
+					return nil
+				}
+				return nc.Publish(reply, bt)
+			},
+			"[unencodable response]: encode error swallowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &recordTB{TB: t}
+			TestResponseHandler(rt, tt.rh, order{ID: "1"})
+
+			errs := strings.Join(rt.errs, "\n")
+			if (tt.wantErr == "") != (errs == "") || !strings.Contains(errs, tt.wantErr) {
+				t.Errorf("TestResponseHandler() failures = %q, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+
+	replies := TestResponseHandler(t, jsonResponseHandler, order{ID: "1"})
+	if len(replies) != 1 || string(replies[0].Data) != `{"id":"1"}` {
+		t.Errorf("TestResponseHandler() replies = %v", replies)
+	}
+}
+
+func TestFakeSubscription(t *testing.T) {
+	fs, err := NewFakeSubscription(
+		log.NewNoopLogger(),
+		nats.WithSubjectSubscriberOption("orders.*"),
+		nats.WithDecoderSubscriberOption(jsonDecoder),
+		nats.WithEndpointSubscriberOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			if req.(order).ID == "" {
+				return nil, errors.New("missing id")
+			}
+			return req, nil
+		}),
+		nats.WithResponseHandlerSubscriberOption(jsonResponseHandler),
+	)
+	if err != nil {
+		t.Fatalf("NewFakeSubscription() error = %v", err)
+	}
+	defer fs.Close()
+
+	d, err := fs.Deliver(&natn.Msg{Subject: "orders.created", Reply: "_INBOX.1", Data: []byte(`{"id":"1"}`)})
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	d.AssertReplied(t, []byte(`{"id":"1"}`))
+
+	// endpoint errors go through the error encoder
+	d, err = fs.Deliver(&natn.Msg{Subject: "orders.created", Reply: "_INBOX.2", Data: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	d.AssertReplied(t, []byte(`{"err":"missing id"}`))
+
+	// no reply subject, nothing to reply to
+	d, err = fs.Deliver(&natn.Msg{Subject: "orders.created", Data: []byte(`{"id":"1"}`)})
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	d.AssertNoReply(t)
+
+	if _, err := fs.Deliver(&natn.Msg{Subject: "payments.created"}); !errors.Is(err, ErrFakeNoSubscriber) {
+		t.Errorf("Deliver() error = %v, want %v", err, ErrFakeNoSubscriber)
+	}
+}
+
+func TestFakeSubscriptionAcks(t *testing.T) {
+	fs, err := NewFakeSubscription(
+		log.NewNoopLogger(),
+		nats.WithSubjectSubscriberOption("jobs"),
+		nats.WithDecoderSubscriberOption(func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+			return msg, nil
+		}),
+		nats.WithEndpointSubscriberOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			msg := req.(*natn.Msg)
+			if string(msg.Data) == "bad" {
+				return nil, msg.Nak()
+			}
+			return nil, msg.Ack()
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewFakeSubscription() error = %v", err)
+	}
+	defer fs.Close()
+
+	d, err := fs.Deliver(&natn.Msg{Reply: "$JS.ACK.1", Data: []byte("good")})
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	d.AssertAcked(t)
+	d.AssertNoReply(t)
+
+	d, err = fs.Deliver(&natn.Msg{Reply: "$JS.ACK.2", Data: []byte("bad")})
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	d.AssertNacked(t)
+}
@@ -0,0 +1,47 @@
+package natstest_test
+
+import (
+	"context"
+	"fmt"
+
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/transport/nats"
+	"github.com/unbxd/go-base/v2/transport/nats/natstest"
+)
+
+// A consumer stack is unit tested by delivering crafted messages through
+// the real subscriber pipeline, no NATS server needed.
+func ExampleNewFakeSubscription() {
+	fs, err := natstest.NewFakeSubscription(
+		log.NewNoopLogger(),
+		nats.WithSubjectSubscriberOption("greet"),
+		nats.WithDecoderSubscriberOption(
+			func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+				return string(msg.Data), nil
+			},
+		),
+		nats.WithEndpointSubscriberOption(
+			func(_ context.Context, req interface{}) (interface{}, error) {
+				return "hello " + req.(string), nil
+			},
+		),
+		nats.WithResponseHandlerSubscriberOption(
+			func(_ context.Context, reply string, nc *natn.Conn, res interface{}) error {
+				return nc.Publish(reply, []byte(res.(string)))
+			},
+		),
+	)
+	if err != nil {
+		return
+	}
+	defer fs.Close()
+
+	d, err := fs.Deliver(&natn.Msg{Reply: "_INBOX.1", Data: []byte("gopher")})
+	if err != nil {
+		return
+	}
+
+	fmt.Println(string(d.Replies[0].Data))
+	// Output: hello gopher
+}
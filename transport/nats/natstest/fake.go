@@ -0,0 +1,579 @@
+// Package natstest helps testing the consumers of the nats transport
+// without a NATS server: contract tests for the decoders & the response
+// handlers, see TestDecoder & TestResponseHandler, and FakeSubscription
+// running a subscriber on FakeBroker, an in-memory stand-in for the
+// server. It is for tests only, production code doesn't import it.
+package natstest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+	"github.com/unbxd/go-base/v2/transport/nats"
+)
+
+// defaultMaxPayload is the max payload of a NATS server with default
+// configuration
+const defaultMaxPayload = 1024 * 1024
+
+const fakeDeliveryTimeout = 5 * time.Second
+
+// Fake Errors
+var (
+	ErrFakeNoSubscriber     = errors.New("fake: no subscription for the subject")
+	ErrFakeDeliveryTimeout  = errors.New("fake: message wasn't handled in time")
+	ErrFakeHandlerPanicked  = errors.New("fake: handler panicked")
+	ErrFakeProtocolMismatch = errors.New("fake: unsupported protocol operation")
+)
+
+type (
+	// FakeBroker is an in-memory stand-in for a NATS server. It speaks
+	// enough of the client protocol for a real *natn.Conn to connect,
+	// subscribe & publish, so the code under test uses the real client.
+	// Messages are routed between the connections of the broker and
+	// every publish is recorded.
+	//
+	// Gaps with a real server, tests relying on these won't predict
+	// production behavior:
+	//   - no JetStream, acks are plain publishes on the reply subject,
+	//     they are recorded but nothing is redelivered
+	//   - queue groups deliver to one subscriber of the group, picked
+	//     arbitrarily instead of randomly
+	//   - no auth, TLS, cluster or slow consumer handling
+	//   - a request without subscribers is answered with the no
+	//     responders status, whatever the client supports
+	//   - payloads over the max payload (1MB) are rejected by the client,
+	//     same as a default server, but the broker doesn't enforce it
+	FakeBroker struct {
+		mu        sync.Mutex
+		conns     map[*fakeConn]struct{}
+		published []*natn.Msg
+	}
+
+	fakeConn struct {
+		broker *FakeBroker
+		conn   net.Conn
+		out    chan []byte
+		done   chan struct{}
+
+		// guarded by broker.mu
+		subs map[string]*fakeSub
+	}
+
+	fakeSub struct {
+		subject string
+		queue   string
+		sid     string
+	}
+
+	fakeDelivery struct {
+		conn *fakeConn
+		sid  string
+	}
+)
+
+// NewFakeBroker returns a FakeBroker with no connections
+func NewFakeBroker() *FakeBroker {
+	return &FakeBroker{conns: make(map[*fakeConn]struct{})}
+}
+
+// Dial implements natn.CustomDialer, every dial is a new in-memory
+// connection to the broker
+func (fb *FakeBroker) Dial(_, _ string) (net.Conn, error) {
+	cl, sr := net.Pipe()
+
+	fc := &fakeConn{
+		broker: fb,
+		conn:   sr,
+		out:    make(chan []byte, 1024),
+		done:   make(chan struct{}),
+		subs:   make(map[string]*fakeSub),
+	}
+
+	fb.mu.Lock()
+	fb.conns[fc] = struct{}{}
+	fb.mu.Unlock()
+
+	go fc.write()
+	go fc.serve()
+
+	return cl, nil
+}
+
+// Connect returns a *natn.Conn connected to the broker
+func (fb *FakeBroker) Connect(options ...natn.Option) (*natn.Conn, error) {
+	return natn.Connect(
+		"nats://fake:4222",
+		append([]natn.Option{
+			natn.SetCustomDialer(fb),
+			natn.NoReconnect(),
+		}, options...)...,
+	)
+}
+
+// Publish routes the message to the subscribers as if it was published
+// by a client
+func (fb *FakeBroker) Publish(msg *natn.Msg) {
+	fb.route(msg)
+}
+
+// Published returns the messages published on the subject, wildcards
+// are allowed. Empty subject returns every message
+func (fb *FakeBroker) Published(subject string) []*natn.Msg {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	var msgs []*natn.Msg
+	for _, m := range fb.published {
+		if subject == "" || subjectMatch(subject, m.Subject) {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// publishedSince returns messages on subject published after the ix'th
+func (fb *FakeBroker) publishedSince(ix int, subject string) []*natn.Msg {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	var msgs []*natn.Msg
+	for _, m := range fb.published[ix:] {
+		if m.Subject == subject {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+func (fb *FakeBroker) route(msg *natn.Msg) int {
+	fb.mu.Lock()
+	fb.published = append(fb.published, msg)
+	fb.mu.Unlock()
+
+	return fb.dispatch(msg)
+}
+
+// noResponders answers a request without subscribers like a server does,
+// with a 503 status, the reply isn't recorded
+func (fb *FakeBroker) noResponders(reply string) {
+	fb.dispatch(&natn.Msg{
+		Subject: reply,
+		Header:  natn.Header{"Status": []string{"503"}},
+	})
+}
+
+// dispatch delivers the message to the subscribers & returns their count
+func (fb *FakeBroker) dispatch(msg *natn.Msg) int {
+	var deliveries []fakeDelivery
+
+	fb.mu.Lock()
+	queues := make(map[string]bool)
+	for fc := range fb.conns {
+		for _, s := range fc.subs {
+			if !subjectMatch(s.subject, msg.Subject) {
+				continue
+			}
+
+			if s.queue != "" {
+				if queues[s.queue] {
+					continue
+				}
+				queues[s.queue] = true
+			}
+
+			deliveries = append(deliveries, fakeDelivery{fc, s.sid})
+		}
+	}
+	fb.mu.Unlock()
+
+	for _, d := range deliveries {
+		d.conn.deliver(d.sid, msg)
+	}
+	return len(deliveries)
+}
+
+// subjectMatch matches subject against pattern with NATS wildcards,
+// '*' matches a token and '>' matches one or more trailing tokens
+func subjectMatch(pattern, subject string) bool {
+	var (
+		pt = strings.Split(pattern, ".")
+		st = strings.Split(subject, ".")
+	)
+
+	for ix, tk := range pt {
+		if tk == ">" {
+			return len(st) > ix
+		}
+
+		if ix >= len(st) || (tk != "*" && tk != st[ix]) {
+			return false
+		}
+	}
+	return len(pt) == len(st)
+}
+
+func encodeHeader(hdr natn.Header) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("NATS/1.0\r\n")
+	for k, vs := range hdr {
+		for _, v := range vs {
+			buf.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func (fc *fakeConn) send(bt []byte) {
+	select {
+	case fc.out <- bt:
+	case <-fc.done:
+	}
+}
+
+func (fc *fakeConn) write() {
+	for {
+		select {
+		case bt := <-fc.out:
+			if _, err := fc.conn.Write(bt); err != nil {
+				return
+			}
+		case <-fc.done:
+			return
+		}
+	}
+}
+
+func (fc *fakeConn) deliver(sid string, msg *natn.Msg) {
+	var (
+		buf   bytes.Buffer
+		reply string
+	)
+
+	if msg.Reply != "" {
+		reply = msg.Reply + " "
+	}
+
+	if len(msg.Header) == 0 {
+		fmt.Fprintf(&buf, "MSG %s %s %s%d\r\n", msg.Subject, sid, reply, len(msg.Data))
+		buf.Write(msg.Data)
+	} else {
+		hdr := encodeHeader(msg.Header)
+		fmt.Fprintf(
+			&buf, "HMSG %s %s %s%d %d\r\n",
+			msg.Subject, sid, reply, len(hdr), len(hdr)+len(msg.Data),
+		)
+		buf.Write(hdr)
+		buf.Write(msg.Data)
+	}
+
+	buf.WriteString("\r\n")
+	fc.send(buf.Bytes())
+}
+
+func (fc *fakeConn) close() {
+	fc.broker.mu.Lock()
+	delete(fc.broker.conns, fc)
+	fc.broker.mu.Unlock()
+
+	close(fc.done)
+	fc.conn.Close()
+}
+
+func (fc *fakeConn) serve() {
+	defer fc.close()
+
+	fc.send([]byte(
+		`INFO {"server_id":"FAKE","server_name":"fake","version":"2.10.0",` +
+			`"proto":1,"headers":true,"host":"0.0.0.0","port":4222,` +
+			`"max_payload":` + strconv.Itoa(defaultMaxPayload) + "}\r\n",
+	))
+
+	rd := bufio.NewReader(fc.conn)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "CONNECT", "PONG":
+		case "PING":
+			fc.send([]byte("PONG\r\n"))
+		case "SUB":
+			s := &fakeSub{subject: args[1], sid: args[len(args)-1]}
+			if len(args) == 4 {
+				s.queue = args[2]
+			}
+
+			fc.broker.mu.Lock()
+			fc.subs[s.sid] = s
+			fc.broker.mu.Unlock()
+		case "UNSUB":
+			fc.broker.mu.Lock()
+			delete(fc.subs, args[1])
+			fc.broker.mu.Unlock()
+		case "PUB", "HPUB":
+			msg, err := readPub(rd, args)
+			if err != nil {
+				fc.send([]byte("-ERR '" + err.Error() + "'\r\n"))
+				return
+			}
+			if fc.broker.route(msg) == 0 && msg.Reply != "" {
+				fc.broker.noResponders(msg.Reply)
+			}
+		default:
+			fc.send([]byte("-ERR 'Unknown Protocol Operation'\r\n"))
+			return
+		}
+	}
+}
+
+// readPub reads the payload of PUB & HPUB
+//
+//	PUB <subject> [reply-to] <#bytes>
+//	HPUB <subject> [reply-to] <#header bytes> <#total bytes>
+func readPub(rd *bufio.Reader, args []string) (*natn.Msg, error) {
+	var (
+		hdrs  = strings.ToUpper(args[0]) == "HPUB"
+		sizes = 1
+		msg   = &natn.Msg{Subject: args[1]}
+	)
+
+	if hdrs {
+		sizes = 2
+	}
+
+	switch len(args) {
+	case 2 + sizes:
+	case 3 + sizes:
+		msg.Reply = args[2]
+	default:
+		return nil, ErrFakeProtocolMismatch
+	}
+
+	total, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return nil, ErrFakeProtocolMismatch
+	}
+
+	buf := make([]byte, total+2)
+	if _, err := io.ReadFull(rd, buf); err != nil {
+		return nil, err
+	}
+	buf = buf[:total]
+
+	if hdrs {
+		hl, err := strconv.Atoi(args[len(args)-2])
+		if err != nil || hl > total {
+			return nil, ErrFakeProtocolMismatch
+		}
+
+		msg.Header, err = natn.DecodeHeadersMsg(buf[:hl])
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[hl:]
+	}
+
+	msg.Data = buf
+	return msg, nil
+}
+
+type (
+	// Delivery is the outcome of a message delivered by FakeSubscription
+	Delivery struct {
+		Msg *natn.Msg
+
+		// Replies are the messages published on the reply subject of Msg,
+		// JetStream acknowledgements excluded
+		Replies []*natn.Msg
+
+		Acked  bool
+		Nacked bool
+		Termed bool
+	}
+
+	// FakeSubscription runs the subscriber built from the options on a
+	// FakeBroker, through the same kit pipeline as Transport.Subscribe:
+	// befores, decoder, middlewares, endpoint, response handler, afters
+	// and error encoder. Deliver blocks till the message is handled,
+	// making consumer tests deterministic. See FakeBroker for the gaps
+	// with a real server
+	FakeSubscription struct {
+		mu sync.Mutex
+
+		broker  *FakeBroker
+		conn    *natn.Conn
+		sub     nats.Subscriber
+		sn      *natn.Subscription
+		handled chan interface{}
+	}
+)
+
+// AssertAcked fails the test if the message wasn't acked
+func (d *Delivery) AssertAcked(t testing.TB) {
+	t.Helper()
+	if !d.Acked {
+		t.Errorf("message on %q wasn't acked", d.Msg.Subject)
+	}
+}
+
+// AssertNacked fails the test if the message wasn't negatively acked
+func (d *Delivery) AssertNacked(t testing.TB) {
+	t.Helper()
+	if !d.Nacked {
+		t.Errorf("message on %q wasn't nacked", d.Msg.Subject)
+	}
+}
+
+// AssertReplied fails the test unless exactly one reply with data was sent
+func (d *Delivery) AssertReplied(t testing.TB, data []byte) {
+	t.Helper()
+	if len(d.Replies) != 1 {
+		t.Errorf("message on %q got %d replies, want 1", d.Msg.Subject, len(d.Replies))
+		return
+	}
+
+	if !bytes.Equal(d.Replies[0].Data, data) {
+		t.Errorf("message on %q got reply %q, want %q", d.Msg.Subject, d.Replies[0].Data, data)
+	}
+}
+
+// AssertNoReply fails the test if anything was sent as reply
+func (d *Delivery) AssertNoReply(t testing.TB) {
+	t.Helper()
+	if len(d.Replies) != 0 {
+		t.Errorf("message on %q got %d replies, want none", d.Msg.Subject, len(d.Replies))
+	}
+}
+
+// NewFakeSubscription returns a FakeSubscription for the subscriber
+// options, the same options as Transport.Subscribe
+func NewFakeSubscription(logger log.Logger, options ...nats.SubscriberOption) (*FakeSubscription, error) {
+	fb := NewFakeBroker()
+
+	conn, err := fb.Connect()
+	if err != nil {
+		return nil, errors.Wrap(err, "fake: failed to connect")
+	}
+
+	sub, serve, err := nats.NewMsgHandler(logger, conn, options...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	fs := &FakeSubscription{
+		broker:  fb,
+		conn:    conn,
+		sub:     sub,
+		handled: make(chan interface{}, 1),
+	}
+
+	handler := func(msg *natn.Msg) {
+		defer func() { fs.handled <- recover() }()
+		serve(msg)
+	}
+
+	if sub.Group() != "" {
+		fs.sn, err = conn.QueueSubscribe(sub.Topic(), sub.Group(), handler)
+	} else {
+		fs.sn, err = conn.Subscribe(sub.Topic(), handler)
+	}
+
+	if err == nil {
+		err = conn.Flush()
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "fake: failed to subscribe")
+	}
+
+	return fs, nil
+}
+
+// Broker returns the broker of the subscription, e.g. to inspect
+// messages published by the endpoint
+func (fs *FakeSubscription) Broker() *FakeBroker { return fs.broker }
+
+// Deliver delivers the message to the subscriber and waits till it is
+// handled. Subject defaults to the subscription's subject. Replies,
+// acks & nacks need msg.Reply to be set, same as with a real server
+func (fs *FakeSubscription) Deliver(msg *natn.Msg) (*Delivery, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if msg.Subject == "" {
+		msg.Subject = fs.sub.Topic()
+	}
+
+	fs.broker.mu.Lock()
+	ix := len(fs.broker.published) + 1
+	fs.broker.mu.Unlock()
+
+	if fs.broker.route(msg) == 0 {
+		return nil, errors.Wrapf(ErrFakeNoSubscriber, "subject: %s", msg.Subject)
+	}
+
+	select {
+	case p := <-fs.handled:
+		if p != nil {
+			return nil, errors.Wrapf(ErrFakeHandlerPanicked, "panic: %v", p)
+		}
+	case <-time.After(fakeDeliveryTimeout):
+		return nil, ErrFakeDeliveryTimeout
+	}
+
+	// replies are buffered by the client, flush makes sure the
+	// broker has seen them
+	if err := fs.conn.Flush(); err != nil {
+		return nil, errors.Wrap(err, "fake: flush failed")
+	}
+
+	d := &Delivery{Msg: msg}
+	if msg.Reply == "" {
+		return d, nil
+	}
+
+	for _, rp := range fs.broker.publishedSince(ix, msg.Reply) {
+		switch data := string(rp.Data); {
+		case data == "+ACK":
+			d.Acked = true
+		case strings.HasPrefix(data, "-NAK"):
+			d.Nacked = true
+		case data == "+TERM":
+			d.Termed = true
+		case data == "+WPI":
+		default:
+			d.Replies = append(d.Replies, rp)
+		}
+	}
+
+	return d, nil
+}
+
+// Close drains the subscription and closes the connection
+func (fs *FakeSubscription) Close() error {
+	defer fs.conn.Close()
+	return fs.sn.Unsubscribe()
+}
@@ -99,6 +99,14 @@ func WithCustomPublisherPingInterval(pingInterval time.Duration) PublisherOption
 	}
 }
 
+// WithPublisherCustomDialer sets the dialer used to connect to NATS,
+// e.g. a natstest.FakeBroker in tests
+func WithPublisherCustomDialer(dialer natn.CustomDialer) PublisherOption {
+	return func(p *Publisher) {
+		p.opts.CustomDialer = dialer
+	}
+}
+
 func WithPublishHeader(headers natn.Header) PublisherOption {
 	return func(p *Publisher) {
 		p.headers = headers
@@ -169,6 +177,10 @@ func subject(prefix, subject string) string {
 	return subject
 }
 
+// Subject returns the subject the messages for sub are published on,
+// i.e. with the prefix of the publisher
+func (p *Publisher) Subject(sub string) string { return subject(p.prefix, sub) }
+
 // Endpoint returns a usable endpoint that invokes the remote endpoint.
 func (p *Publisher) Endpoint(sub string) endpoint.Endpoint {
 	return func(ctx context.Context, data interface{}) (interface{}, error) {
@@ -182,7 +194,15 @@ func (p *Publisher) Publish(ctx context.Context, sub string, data interface{}) e
 	return err
 }
 
+// send doesn't publish once the context is done. NATS publish is fire
+// and forget, the context is checked before encoding & once more after
+// befores have run, so a cancelled request (e.g. HTTP client went away)
+// doesn't cause side effects downstream
 func (p *Publisher) send(cx context.Context, sub string, data interface{}) (*natn.Msg, error) {
+	if err := cx.Err(); err != nil {
+		return nil, p.errorHandler(cx, errors.Wrap(err, "publish cancelled"))
+	}
+
 	msg, err := p.encoder(cx, sub, data)
 	if err != nil {
 		return nil, p.errorHandler(cx, err)
@@ -195,6 +215,10 @@ func (p *Publisher) send(cx context.Context, sub string, data interface{}) (*nat
 		}
 	}
 
+	if err = cx.Err(); err != nil {
+		return nil, p.errorHandler(cx, errors.Wrap(err, "publish cancelled"))
+	}
+
 	err = p.conn.PublishMsg(msg)
 	if err != nil {
 		return nil, p.errorHandler(cx, err)
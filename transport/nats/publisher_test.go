@@ -0,0 +1,36 @@
+package nats
+
+import (
+	"context"
+	"testing"
+
+	natn "github.com/nats-io/nats.go"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+func TestPublisherCancelledContext(t *testing.T) {
+	var encoded bool
+
+	// conn is nil, publishing would panic
+	pb := &Publisher{
+		prefix: "gb",
+		encoder: func(cx context.Context, sub string, data interface{}) (*natn.Msg, error) {
+			encoded = true
+			return defaultPublishMessageEncoder(cx, sub, data)
+		},
+		errorHandler: defaultPublishErrorHandler,
+	}
+
+	cx, canc := context.WithCancel(context.Background())
+	canc()
+
+	_, err := pb.Endpoint("orders")(cx, map[string]string{"id": "1"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Endpoint() error = %v, want %v", err, context.Canceled)
+	}
+
+	if encoded {
+		t.Errorf("Endpoint() encoded the message for a cancelled context")
+	}
+}
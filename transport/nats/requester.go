@@ -0,0 +1,214 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/endpoint"
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// defaultRequestTimeout bounds the requests made with a context without a
+// deadline
+const defaultRequestTimeout = 5 * time.Second
+
+type (
+	// RequesterOption lets you modify properties for requester
+	RequesterOption func(*Requester)
+
+	// ReplyDecoder decodes the reply received on NATS into business entity
+	ReplyDecoder func(context.Context, *natn.Msg) (interface{}, error)
+
+	// Requester makes requests on NATS & waits for their reply, the
+	// counterpart of a subscriber replying with its ResponseHandler, e.g.
+	// ReplyJSONResponseHandler
+	Requester struct {
+		conn *natn.Conn
+		opts *natn.Options
+
+		prefix  string
+		timeout time.Duration
+		headers natn.Header
+
+		encoder      PublishMessageEncoder
+		decoder      ReplyDecoder
+		errorHandler PublishErrorHandler
+	}
+
+	headersKey struct{}
+)
+
+// WithRequestEncoder sets the encoder of the requests, JSON by default
+func WithRequestEncoder(encoder PublishMessageEncoder) RequesterOption {
+	return func(r *Requester) {
+		r.encoder = encoder
+	}
+}
+
+// WithReplyDecoder sets the decoder of the replies, JSON decoded in an
+// interface{} by default, see JSONReplyDecoder for a typed one
+func WithReplyDecoder(decoder ReplyDecoder) RequesterOption {
+	return func(r *Requester) {
+		r.decoder = decoder
+	}
+}
+
+// WithRequestErrorHandler sets the handler of the errors, the errors are
+// returned as is by default
+func WithRequestErrorHandler(handler PublishErrorHandler) RequesterOption {
+	return func(r *Requester) {
+		r.errorHandler = handler
+	}
+}
+
+// WithRequesterSubjectPrefix sets the prefix of the subjects, same as
+// WithPublisherSubjectPrefix, defaults to gb
+func WithRequesterSubjectPrefix(prefix string) RequesterOption {
+	return func(r *Requester) {
+		r.prefix = prefix
+	}
+}
+
+// WithRequestTimeout bounds the requests made with a context without a
+// deadline, defaults to 5s
+func WithRequestTimeout(timeout time.Duration) RequesterOption {
+	return func(r *Requester) {
+		r.timeout = timeout
+	}
+}
+
+// WithRequestHeader sets the headers of every request, see
+// ContextWithHeaders for the headers of a request
+func WithRequestHeader(headers natn.Header) RequesterOption {
+	return func(r *Requester) {
+		r.headers = headers
+	}
+}
+
+// WithRequesterCustomDialer sets the dialer used to connect to NATS,
+// e.g. a natstest.FakeBroker in tests
+func WithRequesterCustomDialer(dialer natn.CustomDialer) RequesterOption {
+	return func(r *Requester) {
+		r.opts.CustomDialer = dialer
+	}
+}
+
+// ContextWithHeaders adds headers to the request made with the context,
+// over the ones set by WithRequestHeader
+func ContextWithHeaders(cx context.Context, headers natn.Header) context.Context {
+	return context.WithValue(cx, headersKey{}, headers)
+}
+
+// JSONReplyDecoder decodes the JSON replies in a T
+func JSONReplyDecoder[T any]() ReplyDecoder {
+	return func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+		var val T
+		if err := json.Unmarshal(msg.Data, &val); err != nil {
+			return nil, errors.Wrap(err, "decode reply failed")
+		}
+		return val, nil
+	}
+}
+
+func defaultReplyDecoder(cx context.Context, msg *natn.Msg) (interface{}, error) {
+	return JSONReplyDecoder[interface{}]()(cx, msg)
+}
+
+// NewRequester returns a requester connected to the NATS server
+func NewRequester(connstr string, options ...RequesterOption) (*Requester, error) {
+	var (
+		opts = natn.GetDefaultOptions()
+		rq   = &Requester{
+			opts:         &opts,
+			prefix:       "gb",
+			timeout:      defaultRequestTimeout,
+			encoder:      defaultPublishMessageEncoder,
+			decoder:      defaultReplyDecoder,
+			errorHandler: defaultPublishErrorHandler,
+		}
+	)
+
+	for _, fn := range options {
+		fn(rq)
+	}
+
+	rq.opts.Url = connstr
+
+	cc, err := rq.opts.Connect()
+	if err != nil {
+		return nil, errors.Wrap(
+			err, "unable to connect to nats server",
+		)
+	}
+
+	rq.conn = cc
+	return rq, nil
+}
+
+// Subject returns the subject the requests for sub are made on, i.e. with
+// the prefix of the requester
+func (r *Requester) Subject(sub string) string { return subject(r.prefix, sub) }
+
+// Endpoint returns an endpoint making the requests on sub
+func (r *Requester) Endpoint(sub string) endpoint.Endpoint {
+	return func(cx context.Context, req interface{}) (interface{}, error) {
+		return r.request(cx, subject(r.prefix, sub), req)
+	}
+}
+
+// Request makes the request on sub & returns the decoded reply. It fails
+// with ErrNoResponders when nobody subscribes to sub & ErrRequestTimeout
+// when no reply came in time, both wrapping the error of NATS
+func (r *Requester) Request(cx context.Context, sub string, req interface{}) (interface{}, error) {
+	return r.request(cx, subject(r.prefix, sub), req)
+}
+
+// Close closes the connection of the requester
+func (r *Requester) Close() { r.conn.Close() }
+
+func (r *Requester) request(cx context.Context, sub string, req interface{}) (interface{}, error) {
+	if err := cx.Err(); err != nil {
+		return nil, r.errorHandler(cx, errors.Wrap(err, "request cancelled"))
+	}
+
+	msg, err := r.encoder(cx, sub, req)
+	if err != nil {
+		return nil, r.errorHandler(cx, err)
+	}
+
+	headers, _ := cx.Value(headersKey{}).(natn.Header)
+	for _, hdr := range []natn.Header{r.headers, headers} {
+		for k, vs := range hdr {
+			if msg.Header == nil {
+				msg.Header = natn.Header{}
+			}
+			msg.Header[k] = vs
+		}
+	}
+
+	rcx := cx
+	if _, ok := cx.Deadline(); !ok && r.timeout > 0 {
+		var cancel context.CancelFunc
+		rcx, cancel = context.WithTimeout(cx, r.timeout)
+		defer cancel()
+	}
+
+	rep, err := r.conn.RequestMsgWithContext(rcx, msg)
+	switch {
+	case err == nil:
+	case errors.Is(err, natn.ErrNoResponders):
+		return nil, r.errorHandler(cx, errors.With(ErrNoResponders, err))
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, natn.ErrTimeout):
+		return nil, r.errorHandler(cx, errors.With(ErrRequestTimeout, err))
+	default:
+		return nil, r.errorHandler(cx, err)
+	}
+
+	res, err := r.decoder(cx, rep)
+	if err != nil {
+		return nil, r.errorHandler(cx, err)
+	}
+	return res, nil
+}
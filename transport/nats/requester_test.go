@@ -0,0 +1,99 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+type quote struct {
+	SKU      string `json:"sku"`
+	Price    int    `json:"price"`
+	Currency string `json:"currency"`
+}
+
+func TestRequester(t *testing.T) {
+	ns := natsserver.RunRandClientPortServer()
+	defer ns.Shutdown()
+
+	tr, err := NewTransport(make(chan struct{}), WithServers([]string{ns.ClientURL()}), WithLogging(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewTransport() error = %v", err)
+	}
+	defer tr.Close()
+
+	for sub, end := range map[string]func(context.Context, interface{}) (interface{}, error){
+		"gb.price": func(_ context.Context, req interface{}) (interface{}, error) {
+			msg := req.(*natn.Msg)
+
+			var q quote
+			_ = json.Unmarshal(msg.Data, &q)
+			q.Price, q.Currency = 42, msg.Header.Get("Currency")
+			return q, nil
+		},
+		"gb.slow": func(context.Context, interface{}) (interface{}, error) {
+			time.Sleep(100 * time.Millisecond)
+			return quote{}, nil
+		},
+	} {
+		_, err := tr.Subscribe(
+			WithId(sub),
+			WithSubjectSubscriberOption(sub),
+			WithDecoderSubscriberOption(func(_ context.Context, msg *natn.Msg) (interface{}, error) {
+				return msg, nil
+			}),
+			WithEndpointSubscriberOption(end),
+			WithResponseHandlerSubscriberOption(ReplyJSONResponseHandler),
+		)
+		if err != nil {
+			t.Fatalf("Subscribe() error = %v", err)
+		}
+	}
+
+	if err := tr.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	// the subscriptions are on the server before the requests
+	_ = tr.conn.Flush()
+
+	rq, err := NewRequester(
+		ns.ClientURL(),
+		WithReplyDecoder(JSONReplyDecoder[quote]()),
+		WithRequestHeader(natn.Header{"Currency": []string{"USD"}}),
+		WithRequestTimeout(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewRequester() error = %v", err)
+	}
+	defer rq.Close()
+
+	cx := context.Background()
+
+	res, err := rq.Request(cx, "price", quote{SKU: "shoe"})
+	if err != nil || res != (quote{"shoe", 42, "USD"}) {
+		t.Errorf("Request() = %+v, %v, want the quote", res, err)
+	}
+
+	// the headers of the request are over the ones of the requester
+	res, err = rq.Endpoint("price")(
+		ContextWithHeaders(cx, natn.Header{"Currency": []string{"EUR"}}),
+		quote{SKU: "shoe"},
+	)
+	if err != nil || res.(quote).Currency != "EUR" {
+		t.Errorf("Endpoint() = %+v, %v, want the quote in EUR", res, err)
+	}
+
+	if _, err := rq.Request(cx, "missing", quote{}); !errors.Is(err, ErrNoResponders) || !errors.Is(err, natn.ErrNoResponders) {
+		t.Errorf("Request() without subscriber error = %v, want %v", err, ErrNoResponders)
+	}
+
+	if _, err := rq.Request(cx, "slow", quote{}); !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("Request() to a slow subscriber error = %v, want %v", err, ErrRequestTimeout)
+	}
+}
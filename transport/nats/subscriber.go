@@ -45,9 +45,16 @@ type (
 		conn     *natn.Conn
 
 		middlewares []endpoint.Middleware
+		// norecover lets the panics of the endpoint through, see
+		// WithoutRecoverSubscriberOption
+		norecover bool
 
 		subscription *natn.Subscription
 		options      []kitn.SubscriberOption
+
+		// js pulls the messages from JetStream, see
+		// WithJetStreamPullSubscriber
+		js *jetStream
 	}
 
 	// SubscriberOption provides set of options to modify a Subscriber
@@ -100,6 +107,14 @@ func WithDecoderSubscriberOption(fn Decoder) SubscriberOption {
 	}
 }
 
+// WithResponseHandlerSubscriberOption sets the handler for the endpoint's
+// response, e.g. to reply to the request. Responses are dropped by default
+func WithResponseHandlerSubscriberOption(fn ResponseHandler) SubscriberOption {
+	return func(s *subscriber) {
+		s.reshn = fn
+	}
+}
+
 func WithBeforeFuncsSubscriberOption(fns ...BeforeFunc) SubscriberOption {
 	return func(s *subscriber) {
 		s.befores = append(s.befores, fns...)
@@ -132,6 +147,15 @@ func WithEndpointMiddleware(m endpoint.Middleware) SubscriberOption {
 	}
 }
 
+// WithoutRecoverSubscriberOption lets the panics of the endpoint & its
+// middlewares crash the process. By default they are recovered with
+// endpoint.Recover & handled as errors of the endpoint
+func WithoutRecoverSubscriberOption() SubscriberOption {
+	return func(s *subscriber) {
+		s.norecover = true
+	}
+}
+
 func WithErrorEncoderSubscriberOption(e ErrorEncoder) SubscriberOption {
 	return func(s *subscriber) {
 		s.errorEnc = e
@@ -150,6 +174,9 @@ func WithErrorhandlerSubscriberOption(e ErrorHandler) SubscriberOption {
 }
 
 func (s *subscriber) open() error {
+	if s.js != nil {
+		return s.openPull()
+	}
 
 	var err error
 	if len(s.qGroup) > 0 {
@@ -169,6 +196,9 @@ func (s *subscriber) open() error {
 }
 
 func (s *subscriber) close() error {
+	if s.js != nil {
+		return s.closePull()
+	}
 	return s.subscription.Drain()
 }
 
@@ -211,7 +241,14 @@ func newSubscriber(
 	}
 
 	if s.errorhn == nil {
-		WithErrorhandlerSubscriberOption(transport.NewLogErrorHandler(logger))
+		WithErrorhandlerSubscriberOption(transport.NewLogErrorHandler(logger))(&s)
+	}
+
+	if !s.norecover {
+		s.middlewares = append(
+			[]endpoint.Middleware{endpoint.Recover(logger)},
+			s.middlewares...,
+		)
 	}
 
 	s.Subscriber = kitn.NewSubscriber(
@@ -226,6 +263,23 @@ func newSubscriber(
 	return &s, nil
 }
 
+// NewMsgHandler returns the subscriber built from the options & the
+// handler running the messages through its pipeline, as
+// Transport.Subscribe does, for the subscriptions made outside of a
+// Transport, e.g. by natstest.FakeSubscription. The subscriber isn't
+// subscribed, it isn't valid
+func NewMsgHandler(
+	logger log.Logger,
+	con *natn.Conn,
+	options ...SubscriberOption,
+) (Subscriber, natn.MsgHandler, error) {
+	s, err := newSubscriber(logger, con, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s.ServeMsg(con), nil
+}
+
 func wrap(ep endpoint.Endpoint, mws ...endpoint.Middleware) endpoint.Endpoint {
 
 	newmw := endpoint.Chain(
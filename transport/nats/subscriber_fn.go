@@ -2,6 +2,7 @@ package nats
 
 import (
 	"context"
+	"encoding/json"
 
 	natn "github.com/nats-io/nats.go"
 )
@@ -11,3 +12,18 @@ func NoOpResponseHandler(context.Context, string, *natn.Conn, interface{}) error
 }
 
 func NoOpErrorEncoder(context.Context, error, string, *natn.Conn) {}
+
+// ReplyJSONResponseHandler replies to the request with the response
+// encoded as JSON, the counterpart of a Requester. Messages without a
+// reply are dropped
+func ReplyJSONResponseHandler(_ context.Context, reply string, conn *natn.Conn, response interface{}) error {
+	if reply == "" {
+		return nil
+	}
+
+	bt, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return conn.Publish(reply, bt)
+}
@@ -0,0 +1,111 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/transport"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/endpoint"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+func panicky(_ context.Context, req interface{}) (interface{}, error) {
+	if req == "boom" {
+		panic("boom")
+	}
+	return req, nil
+}
+
+func stringDecoder(_ context.Context, msg *natn.Msg) (interface{}, error) {
+	return string(msg.Data), nil
+}
+
+func TestSubscriberRecover(t *testing.T) {
+	var (
+		handled = make(chan error, 1)
+		encoded = make(chan error, 1)
+	)
+
+	ns := natsserver.RunRandClientPortServer()
+	defer ns.Shutdown()
+
+	tr, err := NewTransport(make(chan struct{}), WithServers([]string{ns.ClientURL()}), WithLogging(log.NewNoopLogger()))
+	if err != nil {
+		t.Fatalf("NewTransport() error = %v", err)
+	}
+	defer tr.Close()
+
+	_, err = tr.Subscribe(
+		WithSubjectSubscriberOption("orders"),
+		WithDecoderSubscriberOption(stringDecoder),
+		WithEndpointSubscriberOption(panicky),
+		WithResponseHandlerSubscriberOption(ReplyJSONResponseHandler),
+		WithErrorEncoderSubscriberOption(func(_ context.Context, err error, _ string, _ *natn.Conn) {
+			encoded <- err
+		}),
+		WithErrorhandlerSubscriberOption(transport.ErrorHandlerFunc(func(_ context.Context, err error) {
+			handled <- err
+		})),
+	)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := tr.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	_ = tr.conn.Flush()
+
+	nc, err := natn.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer nc.Close()
+
+	// nothing is replied to the panicking request
+	if _, err := nc.Request("orders", []byte("boom"), 50*time.Millisecond); err == nil {
+		t.Error("Request() of a panicking message error = nil")
+	}
+
+	for name, ch := range map[string]chan error{"error handler": handled, "error encoder": encoded} {
+		select {
+		case err := <-ch:
+			if !errors.Is(err, endpoint.ErrPanic) {
+				t.Errorf("%s got %v, want %v", name, err, endpoint.ErrPanic)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s not called in 1s", name)
+		}
+	}
+
+	// the subscription is still served
+	msg, err := nc.Request("orders", []byte("shoe"), time.Second)
+	if err != nil || string(msg.Data) != `"shoe"` {
+		t.Errorf("Request() = %v, %v, want the reply", msg, err)
+	}
+}
+
+func TestWithoutRecoverSubscriberOption(t *testing.T) {
+	_, serve, err := NewMsgHandler(
+		log.NewNoopLogger(), nil,
+		WithSubjectSubscriberOption("orders"),
+		WithDecoderSubscriberOption(stringDecoder),
+		WithEndpointSubscriberOption(panicky),
+		WithoutRecoverSubscriberOption(),
+	)
+	if err != nil {
+		t.Fatalf("NewMsgHandler() error = %v", err)
+	}
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("recovered %v, want the panic of the endpoint", p)
+		}
+	}()
+
+	serve(&natn.Msg{Subject: "orders", Data: []byte("boom")})
+	t.Error("handler didn't panic")
+}
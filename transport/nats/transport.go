@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	natn "github.com/nats-io/nats.go"
@@ -28,6 +29,17 @@ type (
 		subscribers map[string]*subscriber
 
 		closeCh chan struct{}
+
+		// reported by Health
+		processed atomic.Int64
+		maxLag    int64
+
+		// connectWait is the wait for the connection at startup, see
+		// WithRetryOnFailedConnect
+		connectWait time.Duration
+		// onResubscribe is called when a subscriber is opened again on
+		// reconnect, see WithOnResubscribe
+		onResubscribe func(Subscriber, error)
 	}
 
 	Subscriber interface {
@@ -71,6 +83,43 @@ func WithFlushTimeout(t time.Duration) TransportOption {
 	}
 }
 
+// WithCustomDialer sets the dialer used to connect to NATS, e.g. a
+// natstest.FakeBroker in tests
+func WithCustomDialer(dialer natn.CustomDialer) TransportOption {
+	return func(tr *Transport) {
+		tr.nopts.CustomDialer = dialer
+	}
+}
+
+// WithRetryOnFailedConnect keeps connecting in the background when NATS
+// can't be reached at startup, instead of failing NewTransport. It waits
+// up to maxWait for the connection, then returns the transport, the
+// subscriptions are sent once connected. The attempts are bounded as the
+// reconnects are, after which the connection is closed
+func WithRetryOnFailedConnect(maxWait time.Duration) TransportOption {
+	return func(tr *Transport) {
+		tr.nopts.RetryOnFailedConnect = true
+		tr.connectWait = maxWait
+	}
+}
+
+// WithReconnectBufferSize sets the bytes published while reconnecting
+// which are buffered, & sent once reconnected. Publishing more fails
+func WithReconnectBufferSize(bytes int) TransportOption {
+	return func(tr *Transport) {
+		tr.nopts.ReconnectBufSize = bytes
+	}
+}
+
+// WithOnResubscribe sets a callback for the subscribers opened again on
+// reconnect, because their subscription was no longer valid, with the
+// error of opening it if any
+func WithOnResubscribe(fn func(sub Subscriber, err error)) TransportOption {
+	return func(tr *Transport) {
+		tr.onResubscribe = fn
+	}
+}
+
 func WithName(n string) TransportOption {
 	return func(tr *Transport) {
 		tr.nopts.Name = n
@@ -107,11 +156,16 @@ func (tr *Transport) Subscribe(
 	options ...SubscriberOption,
 ) (Subscriber, error) {
 
+	options = append(options[:len(options):len(options)], WithEndpointMiddleware(tr.processedMiddleware))
+
 	s, err := newSubscriber(tr.logger, tr.conn, options...)
 	if err != nil {
 		return nil, err
 	}
 
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
 	if tr.open {
 		err := s.open()
 		if err != nil {
@@ -141,6 +195,8 @@ func (tr *Transport) Unsubscribe(id string) error {
 
 // Open starts the Transport
 func (tr *Transport) Open() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
 
 	for _, sub := range tr.subscribers {
 		err := sub.open()
@@ -160,27 +216,23 @@ func (tr *Transport) Close() (err error) {
 	)
 	defer cancel()
 
-	ch := make(chan struct{})
+	ch := make(chan error, 1)
 	go func() {
-		err = tr.close(ch)
-
+		ch <- tr.close()
 	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ch:
-			return
-		}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err = <-ch:
+		return
 	}
 }
 
-func (tr *Transport) close(ch chan struct{}) (err error) {
+func (tr *Transport) close() (err error) {
 	defer func() {
 		// flush and close
 		tr.conn.Close()
-		close(ch)
 	}()
 
 	for _, sub := range tr.subscribers {
@@ -195,6 +247,38 @@ func (tr *Transport) close(ch chan struct{}) (err error) {
 	return
 }
 
+// resubscribe opens again the subscribers of which the subscription is no
+// longer valid, once reconnected
+func (tr *Transport) resubscribe() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if !tr.open {
+		return
+	}
+
+	for _, s := range tr.subscribers {
+		if s.IsValid() {
+			continue
+		}
+
+		_ = s.close()
+		err := s.open()
+		if err != nil {
+			tr.logger.Error(
+				"NATS resubscribe failed",
+				log.String("id", s.id),
+				log.String("subject", s.subject),
+				log.Error(err),
+			)
+		}
+
+		if tr.onResubscribe != nil {
+			tr.onResubscribe(s, err)
+		}
+	}
+}
+
 func (tr *Transport) onClose(_ *natn.Conn) {
 	tr.logger.Info("NATS connection closed..")
 	close(tr.closeCh)
@@ -222,11 +306,31 @@ func NewTransport(
 
 	tr.nopts.ClosedCB = tr.onClose
 
+	reconnected := tr.nopts.ReconnectedCB
+	tr.nopts.ReconnectedCB = func(nc *natn.Conn) {
+		if reconnected != nil {
+			reconnected(nc)
+		}
+		tr.resubscribe()
+	}
+
+	// called for the first connection when it is retried only
+	connected := make(chan struct{})
+	tr.nopts.ConnectedCB = func(*natn.Conn) { close(connected) }
+
 	var err error
 	tr.conn, err = tr.nopts.Connect()
 	if err != nil {
 		return nil, err
 	}
 
+	if tr.nopts.RetryOnFailedConnect && !tr.conn.IsConnected() {
+		select {
+		case <-connected:
+		case <-time.After(tr.connectWait):
+			tr.logger.Warn("NATS isn't connected yet, connecting in the background")
+		}
+	}
+
 	return &tr, nil
 }
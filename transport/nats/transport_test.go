@@ -0,0 +1,260 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natn "github.com/nats-io/nats.go"
+	"github.com/unbxd/go-base/v2/errors"
+	"github.com/unbxd/go-base/v2/log"
+)
+
+type order struct {
+	ID string `json:"id"`
+}
+
+func jsonDecoder(_ context.Context, msg *natn.Msg) (interface{}, error) {
+	var o order
+	if err := json.Unmarshal(msg.Data, &o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// fastReconnect reconnects without waiting
+func fastReconnect(tr *Transport) {
+	tr.nopts.ReconnectWait = 5 * time.Millisecond
+	tr.nopts.ReconnectJitter = 0
+	tr.nopts.MaxReconnect = -1
+}
+
+// waitFor polls cond for 5 seconds
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 1000; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+// freePort returns a port nothing listens on, for a server started later
+// or restarted on the same address
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// runServer runs a nats-server on port
+func runServer(port int) *server.Server {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = port
+	return natsserver.RunServer(&opts)
+}
+
+func subscribeOrders(t *testing.T, tr *Transport, processed chan string) {
+	t.Helper()
+
+	_, err := tr.Subscribe(
+		WithId("orders"),
+		WithSubjectSubscriberOption("orders.*"),
+		WithDecoderSubscriberOption(jsonDecoder),
+		WithEndpointSubscriberOption(func(_ context.Context, req interface{}) (interface{}, error) {
+			processed <- req.(order).ID
+			return req, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	if err := tr.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+}
+
+func assertProcessed(t *testing.T, tr *Transport, processed chan string, id string) {
+	t.Helper()
+
+	_ = tr.conn.Flush()
+	if err := tr.conn.Publish("orders.created", []byte(`{"id":"`+id+`"}`)); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case got := <-processed:
+		if got != id {
+			t.Errorf("processed %q, want %q", got, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("message %q not processed in 5s", id)
+	}
+}
+
+func TestWithRetryOnFailedConnect(t *testing.T) {
+	var (
+		port      = freePort(t)
+		processed = make(chan string, 1)
+	)
+
+	tr, err := NewTransport(
+		make(chan struct{}),
+		WithServers([]string{"nats://127.0.0.1:" + strconv.Itoa(port)}),
+		WithLogging(log.NewNoopLogger()),
+		WithRetryOnFailedConnect(20*time.Millisecond),
+		fastReconnect,
+	)
+	if err != nil {
+		t.Fatalf("NewTransport() with NATS down error = %v", err)
+	}
+	defer tr.Close()
+
+	// subscribed while connecting
+	subscribeOrders(t, tr, processed)
+
+	if st := tr.Status(); st.Connected || st.State != natn.RECONNECTING.String() || tr.Healthy() {
+		t.Errorf("Status() = %+v, want reconnecting & unhealthy", st)
+	}
+
+	ns := runServer(port)
+	defer ns.Shutdown()
+
+	if !waitFor(tr.Healthy) {
+		t.Fatalf("Status() = %+v, want healthy once NATS is up", tr.Status())
+	}
+
+	assertProcessed(t, tr, processed, "1")
+}
+
+func TestWithReconnectBufferSize(t *testing.T) {
+	var (
+		port      = freePort(t)
+		ns        = runServer(port)
+		processed = make(chan string, 1)
+	)
+
+	tr, err := NewTransport(
+		make(chan struct{}),
+		WithServers([]string{ns.ClientURL()}),
+		WithLogging(log.NewNoopLogger()),
+		WithReconnectBufferSize(64),
+		fastReconnect,
+	)
+	if err != nil {
+		t.Fatalf("NewTransport() error = %v", err)
+	}
+	defer tr.Close()
+
+	subscribeOrders(t, tr, processed)
+	_ = tr.conn.Flush()
+
+	ns.Shutdown()
+	if !waitFor(func() bool { return tr.Status().State == natn.RECONNECTING.String() }) {
+		t.Fatalf("Status() = %+v, want reconnecting", tr.Status())
+	}
+
+	// buffered till reconnected, once the buffer is full the publishes fail
+	if err := tr.conn.Publish("orders.created", []byte(`{"id":"buffered"}`)); err != nil {
+		t.Errorf("Publish() while reconnecting error = %v", err)
+	}
+	if err := tr.conn.Publish("filler", make([]byte, 64)); err != nil {
+		t.Errorf("Publish() filling the buffer error = %v", err)
+	}
+	if err := tr.conn.Publish("filler", nil); !errors.Is(err, natn.ErrReconnectBufExceeded) {
+		t.Errorf("Publish() with the buffer full error = %v, want %v", err, natn.ErrReconnectBufExceeded)
+	}
+
+	ns = runServer(port)
+	defer ns.Shutdown()
+
+	select {
+	case got := <-processed:
+		if got != "buffered" {
+			t.Errorf("processed %q, want the buffered message", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("buffered message not processed in 5s")
+	}
+}
+
+func TestWithOnResubscribe(t *testing.T) {
+	var (
+		port         = freePort(t)
+		ns           = runServer(port)
+		processed    = make(chan string, 1)
+		resubscribed = make(chan error, 1)
+	)
+
+	tr, err := NewTransport(
+		make(chan struct{}),
+		WithServers([]string{ns.ClientURL()}),
+		WithLogging(log.NewNoopLogger()),
+		WithOnResubscribe(func(sub Subscriber, err error) {
+			if sub.Id() == "orders" {
+				resubscribed <- err
+			}
+		}),
+		fastReconnect,
+	)
+	if err != nil {
+		t.Fatalf("NewTransport() error = %v", err)
+	}
+	defer tr.Close()
+
+	subscribeOrders(t, tr, processed)
+	assertProcessed(t, tr, processed, "1")
+
+	// the subscriptions stay valid over a restart of the server
+	ns.Shutdown()
+	ns = runServer(port)
+
+	if !waitFor(tr.Healthy) {
+		t.Fatalf("Status() = %+v, want healthy after a restart", tr.Status())
+	}
+	assertProcessed(t, tr, processed, "2")
+
+	select {
+	case err := <-resubscribed:
+		t.Fatalf("resubscribed a valid subscription, error = %v", err)
+	default:
+	}
+
+	// a subscription lost, reopened on reconnect
+	_ = tr.subscribers["orders"].subscription.Unsubscribe()
+
+	if st := tr.Status(); st.Subscriptions["orders"] || tr.Healthy() {
+		t.Errorf("Status() = %+v, want the subscription invalid & unhealthy", st)
+	}
+
+	ns.Shutdown()
+	ns = runServer(port)
+	defer ns.Shutdown()
+
+	select {
+	case err := <-resubscribed:
+		if err != nil {
+			t.Errorf("WithOnResubscribe() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not resubscribed in 5s")
+	}
+
+	if !tr.Healthy() {
+		t.Errorf("Status() = %+v, want healthy", tr.Status())
+	}
+	assertProcessed(t, tr, processed, "3")
+}
@@ -0,0 +1,292 @@
+// Package units provides parsing & formatting helpers for durations and
+// byte sizes used across configuration, logging and admin endpoints.
+//
+// Durations are accepted in Go's duration syntax ("500ms", "2m30s"). Bare
+// integers are only accepted when the call site declares the unit they are
+// expressed in, which keeps legacy millisecond/second integer configs
+// working without guessing. Byte sizes accept both SI ("10MB" = 10*1000^2)
+// and IEC ("512KiB" = 512*1024) suffixes, bare integers are bytes.
+package units
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+// Parse Errors
+var (
+	ErrEmpty       = errors.New("units: empty value")
+	ErrNegative    = errors.New("units: negative value")
+	ErrBareInteger = errors.New("units: bare integer without unit not allowed")
+	ErrInvalid     = errors.New("units: invalid value")
+	ErrUnknownUnit = errors.New("units: unknown unit")
+	ErrOutOfRange  = errors.New("units: value out of range")
+)
+
+// Byte size units
+const (
+	B  int64 = 1
+	KB int64 = 1000
+	MB int64 = 1000 * KB
+	GB int64 = 1000 * MB
+	TB int64 = 1000 * GB
+
+	KiB int64 = 1024
+	MiB int64 = 1024 * KiB
+	GiB int64 = 1024 * MiB
+	TiB int64 = 1024 * GiB
+)
+
+var byteUnits = map[string]int64{
+	"b":   B,
+	"kb":  KB,
+	"mb":  MB,
+	"gb":  GB,
+	"tb":  TB,
+	"kib": KiB,
+	"mib": MiB,
+	"gib": GiB,
+	"tib": TiB,
+}
+
+// ordered largest first, used by FormatBytes
+var iecUnits = []struct {
+	name string
+	size int64
+}{
+	{"TiB", TiB},
+	{"GiB", GiB},
+	{"MiB", MiB},
+	{"KiB", KiB},
+}
+
+func isInteger(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, r := range s {
+		if r == '-' && i == 0 {
+			continue
+		}
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseDuration parses a duration string. Strings in Go's duration format
+// ("300ms", "1.5h", "2m30s") are parsed as is. A bare integer ("30") is
+// interpreted in the unit declared by the call site, e.g.
+//
+//	units.ParseDuration("30", time.Second) // 30s
+//
+// Passing a zero unit makes bare integers an error, see ParseDurationStrict.
+// Negative durations are rejected.
+func ParseDuration(s string, unit time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrEmpty
+	}
+
+	if isInteger(s) {
+		if unit <= 0 {
+			return 0, errors.Wrapf(ErrBareInteger, "value: %q", s)
+		}
+
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(ErrOutOfRange, "value: %q", s)
+		}
+
+		if n < 0 {
+			return 0, errors.Wrapf(ErrNegative, "value: %q", s)
+		}
+
+		if n > int64(math.MaxInt64/unit) {
+			return 0, errors.Wrapf(ErrOutOfRange, "value: %q", s)
+		}
+
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrapf(ErrInvalid, "value: %q, err: %s", s, err.Error())
+	}
+
+	if d < 0 {
+		return 0, errors.Wrapf(ErrNegative, "value: %q", s)
+	}
+
+	return d, nil
+}
+
+// ParseDurationStrict parses the duration and rejects bare integers,
+// forcing the unit to be spelled out in configuration.
+func ParseDurationStrict(s string) (time.Duration, error) {
+	return ParseDuration(s, 0)
+}
+
+// ParseBytes parses a byte size. Accepted forms are bare integers (bytes),
+// SI suffixes (B, KB, MB, GB, TB) and IEC suffixes (KiB, MiB, GiB, TiB).
+// Suffixes are case insensitive and may be separated by spaces from the
+// number. Fractions are allowed as long as the result is a whole number
+// of bytes ("1.5KiB" is fine, "1.5B" is not).
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrEmpty
+	}
+
+	ix := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+
+	var num, unit string
+	if ix < 0 {
+		num = s
+	} else {
+		num, unit = strings.TrimSpace(s[:ix]), strings.TrimSpace(s[ix:])
+	}
+
+	mult := B
+	if unit != "" {
+		m, ok := byteUnits[strings.ToLower(unit)]
+		if !ok {
+			return 0, errors.Wrapf(ErrUnknownUnit, "value: %q", s)
+		}
+		mult = m
+	}
+
+	if num == "" {
+		return 0, errors.Wrapf(ErrInvalid, "value: %q", s)
+	}
+
+	if isInteger(num) {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(ErrOutOfRange, "value: %q", s)
+		}
+		if n < 0 {
+			return 0, errors.Wrapf(ErrNegative, "value: %q", s)
+		}
+		if n > math.MaxInt64/mult {
+			return 0, errors.Wrapf(ErrOutOfRange, "value: %q", s)
+		}
+		return n * mult, nil
+	}
+
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, errors.Wrapf(ErrInvalid, "value: %q", s)
+	}
+
+	if f < 0 {
+		return 0, errors.Wrapf(ErrNegative, "value: %q", s)
+	}
+
+	v := f * float64(mult)
+	if v >= math.MaxInt64 {
+		return 0, errors.Wrapf(ErrOutOfRange, "value: %q", s)
+	}
+
+	if v != math.Trunc(v) {
+		return 0, errors.Wrapf(ErrInvalid, "value: %q is not a whole number of bytes", s)
+	}
+
+	return int64(v), nil
+}
+
+// FormatDuration renders the duration in a stable human readable form.
+// Whole second durations drop zero components ("1h", "2m30s") instead of
+// the "1h0m0s" produced by time.Duration.String, sub-second durations
+// fall back to the standard format ("500ms", "1.5µs").
+// The output is always accepted by ParseDuration and round-trips exactly.
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+
+	if d < 0 || d%time.Second != 0 {
+		return d.String()
+	}
+
+	var (
+		sb strings.Builder
+		h  = d / time.Hour
+		m  = (d % time.Hour) / time.Minute
+		s  = (d % time.Minute) / time.Second
+	)
+
+	if h > 0 {
+		sb.WriteString(strconv.FormatInt(int64(h), 10))
+		sb.WriteRune('h')
+	}
+	if m > 0 {
+		sb.WriteString(strconv.FormatInt(int64(m), 10))
+		sb.WriteRune('m')
+	}
+	if s > 0 {
+		sb.WriteString(strconv.FormatInt(int64(s), 10))
+		sb.WriteRune('s')
+	}
+
+	return sb.String()
+}
+
+// FormatBytes renders the byte size using the largest IEC unit which
+// divides the value exactly ("512KiB", "10MiB"), falling back to bytes
+// ("1500B"). The output round-trips exactly through ParseBytes.
+func FormatBytes(b int64) string {
+	if b == 0 {
+		return "0B"
+	}
+
+	if b > 0 {
+		for _, u := range iecUnits {
+			if b%u.size == 0 {
+				return strconv.FormatInt(b/u.size, 10) + u.name
+			}
+		}
+	}
+
+	return strconv.FormatInt(b, 10) + "B"
+}
+
+// ResolveDuration resolves a configuration value which is available both
+// as a typed string (preferred) and as a legacy integer expressed in
+// legacyUnit. Precedence:
+//   - typed string set: it wins, the legacy value is ignored
+//   - only legacy value set (> 0): legacy * legacyUnit
+//   - neither set: 0
+//
+// conflict is true when both are set and they disagree, callers are
+// expected to log a deprecation warning in that case.
+func ResolveDuration(
+	typed string,
+	legacy int,
+	legacyUnit time.Duration,
+) (d time.Duration, conflict bool, err error) {
+	var ld time.Duration
+
+	if legacy > 0 {
+		ld = time.Duration(legacy) * legacyUnit
+	}
+
+	if strings.TrimSpace(typed) == "" {
+		return ld, false, nil
+	}
+
+	d, err = ParseDuration(typed, legacyUnit)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return d, legacy > 0 && ld != d, nil
+}
@@ -0,0 +1,207 @@
+package units
+
+import (
+	"testing"
+	"time"
+
+	"github.com/unbxd/go-base/v2/errors"
+)
+
+func TestParseDuration(t *testing.T) {
+	type args struct {
+		s    string
+		unit time.Duration
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    time.Duration
+		wantErr error
+	}{
+		{"millis", args{"500ms", time.Second}, 500 * time.Millisecond, nil},
+		{"compound", args{"2m30s", time.Second}, 150 * time.Second, nil},
+		{"fraction", args{"1.5h", 0}, 90 * time.Minute, nil},
+		{"spaces", args{"  10s ", 0}, 10 * time.Second, nil},
+		{"bare int in millis", args{"30", time.Millisecond}, 30 * time.Millisecond, nil},
+		{"bare int in seconds", args{"30", time.Second}, 30 * time.Second, nil},
+		{"bare zero", args{"0", time.Second}, 0, nil},
+		{"bare int strict", args{"30", 0}, 0, ErrBareInteger},
+		{"empty", args{"", time.Second}, 0, ErrEmpty},
+		{"negative", args{"-1s", time.Second}, 0, ErrNegative},
+		{"negative bare", args{"-5", time.Second}, 0, ErrNegative},
+		{"garbage", args{"abc", time.Second}, 0, ErrInvalid},
+		{"missing unit suffix", args{"1.5", time.Second}, 0, ErrInvalid},
+		{"unknown unit", args{"10y", time.Second}, 0, ErrInvalid},
+		{"overflow", args{"9223372036854775807", time.Second}, 0, ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDuration(tt.args.s, tt.args.unit)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseDuration() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("ParseDuration() unexpected error = %v", err)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDurationStrict(t *testing.T) {
+	if _, err := ParseDurationStrict("100"); !errors.Is(err, ErrBareInteger) {
+		t.Errorf("ParseDurationStrict() error = %v, wantErr %v", err, ErrBareInteger)
+	}
+
+	if d, err := ParseDurationStrict("100ms"); err != nil || d != 100*time.Millisecond {
+		t.Errorf("ParseDurationStrict() = %v, %v, want %v", d, err, 100*time.Millisecond)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    int64
+		wantErr error
+	}{
+		{"bare", "1024", 1024, nil},
+		{"bytes suffix", "10B", 10, nil},
+		{"si", "10MB", 10 * MB, nil},
+		{"iec", "512KiB", 512 * KiB, nil},
+		{"lower case", "2gib", 2 * GiB, nil},
+		{"space separated", "4 MiB", 4 * MiB, nil},
+		{"fraction", "1.5KiB", 1536, nil},
+		{"fraction of a byte", "1.5B", 0, ErrInvalid},
+		{"ambiguous m", "10m", 0, ErrUnknownUnit},
+		{"ambiguous k", "10k", 0, ErrUnknownUnit},
+		{"empty", "", 0, ErrEmpty},
+		{"unit only", "MB", 0, ErrInvalid},
+		{"negative", "-1KB", 0, ErrNegative},
+		{"overflow", "9000000TiB", 0, ErrOutOfRange},
+		{"garbage", "1.2.3MB", 0, ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBytes(tt.in)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseBytes() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("ParseBytes() unexpected error = %v", err)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseBytes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{time.Hour, "1h"},
+		{150 * time.Second, "2m30s"},
+		{time.Hour + time.Second, "1h1s"},
+		{500 * time.Millisecond, "500ms"},
+		{1500 * time.Microsecond, "1.5ms"},
+		{90*time.Second + 5*time.Millisecond, "1m30.005s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := FormatDuration(tt.in)
+			if got != tt.want {
+				t.Errorf("FormatDuration() = %v, want %v", got, tt.want)
+			}
+
+			rt, err := ParseDurationStrict(got)
+			if err != nil || rt != tt.in {
+				t.Errorf("round trip = %v, %v, want %v", rt, err, tt.in)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "0B"},
+		{1, "1B"},
+		{1000, "1000B"},
+		{1536, "1536B"},
+		{512 * KiB, "512KiB"},
+		{10 * MiB, "10MiB"},
+		{3 * GiB, "3GiB"},
+		{2 * TiB, "2TiB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := FormatBytes(tt.in)
+			if got != tt.want {
+				t.Errorf("FormatBytes() = %v, want %v", got, tt.want)
+			}
+
+			rt, err := ParseBytes(got)
+			if err != nil || rt != tt.in {
+				t.Errorf("round trip = %v, %v, want %v", rt, err, tt.in)
+			}
+		})
+	}
+}
+
+func TestResolveDuration(t *testing.T) {
+	type args struct {
+		typed  string
+		legacy int
+		unit   time.Duration
+	}
+	tests := []struct {
+		name         string
+		args         args
+		want         time.Duration
+		wantConflict bool
+		wantErr      bool
+	}{
+		{"neither", args{"", 0, time.Millisecond}, 0, false, false},
+		{"legacy only", args{"", 30, time.Millisecond}, 30 * time.Millisecond, false, false},
+		{"typed only", args{"30s", 0, time.Millisecond}, 30 * time.Second, false, false},
+		{"both agree", args{"30ms", 30, time.Millisecond}, 30 * time.Millisecond, false, false},
+		{"both disagree, typed wins", args{"30s", 30, time.Millisecond}, 30 * time.Second, true, false},
+		{"typed bare int uses legacy unit", args{"30", 0, time.Second}, 30 * time.Second, false, false},
+		{"invalid typed", args{"thirty", 30, time.Millisecond}, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict, err := ResolveDuration(tt.args.typed, tt.args.legacy, tt.args.unit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveDuration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveDuration() = %v, want %v", got, tt.want)
+			}
+			if conflict != tt.wantConflict {
+				t.Errorf("ResolveDuration() conflict = %v, want %v", conflict, tt.wantConflict)
+			}
+		})
+	}
+}